@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"grafana-ai-agent-platform/backend/pkg/api"
+
+	"github.com/spf13/cobra"
+)
+
+func newClustersCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clusters",
+		Short: "Manage the clusters the platform deploys to",
+	}
+	cmd.AddCommand(newClustersAddCommand(opts))
+	return cmd
+}
+
+func newClustersAddCommand(opts *options) *cobra.Command {
+	var kubeconfig, kubeContext, environment, prometheusURL string
+	var labels map[string]string
+	cmd := &cobra.Command{
+		Use:   "add [NAME]",
+		Short: "Add a cluster from a kubeconfig, named after its cluster by default",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			config, err := readKubeconfig(kubeconfig)
+			if err != nil {
+				return err
+			}
+			req := api.AddClusterRequest{
+				Context:       kubeContext,
+				PrometheusURL: prometheusURL,
+				Environment:   environment,
+				Labels:        labels,
+			}
+			req.KubeConfig = config
+			if len(args) > 0 {
+				req.Name = args[0]
+			}
+			resp, err := c.AddCluster(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Cluster %d (%s) added, status %s\n", resp.Cluster.ID, resp.Cluster.Name, resp.Cluster.Status)
+			if resp.Warning != "" {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %s\n", resp.Warning)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig of the cluster (default $KUBECONFIG or ~/.kube/config)")
+	cmd.Flags().StringVar(&kubeContext, "context", "", "kubeconfig context of the cluster (default the current context)")
+	cmd.Flags().StringVar(&environment, "environment", "", "environment of the cluster: dev, staging or prod")
+	cmd.Flags().StringVar(&prometheusURL, "prometheus-url", "", "URL of the cluster's Prometheus")
+	cmd.Flags().StringToStringVar(&labels, "label", nil, "labels of the cluster, e.g. --label team=platform")
+	return cmd
+}
+
+// readKubeconfig reads the kubeconfig at path or, without one, the first file
+// of $KUBECONFIG or ~/.kube/config
+func readKubeconfig(path string) (string, error) {
+	if path == "" {
+		path = defaultKubeconfigPath()
+	}
+	if path == "" {
+		return "", fmt.Errorf("no kubeconfig found, use --kubeconfig")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/api"
+
+	"github.com/spf13/cobra"
+)
+
+func newDeployCommand(opts *options) *cobra.Command {
+	var clusterID uint
+	var kubeconfig string
+	var scoped, skipPreflight bool
+	cmd := &cobra.Command{
+		Use:   "deploy PLAN_FILE",
+		Short: "Deploy a plan saved with aictl query -o",
+		Long: "Deploy a plan saved with aictl query -o. The plan is deployed as the\n" +
+			"server stored it; the file names the plan by its id.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if clusterID == 0 {
+				return fmt.Errorf("--cluster is required")
+			}
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read plan: %w", err)
+			}
+			plan, err := agent.DecodePlan(data)
+			if err != nil {
+				return err
+			}
+			if plan.ID == "" {
+				return fmt.Errorf("%s has no plan id", args[0])
+			}
+			config, err := readKubeconfig(kubeconfig)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Deploying plan %s (%s) to cluster %d...\n", plan.ID, plan.Name, clusterID)
+			resp, err := c.Deploy(cmd.Context(), api.DeployRequest{
+				PlanID:            plan.ID,
+				ClusterID:         clusterID,
+				KubeConfig:        config,
+				ScopedCredentials: scoped,
+				SkipPreflight:     skipPreflight,
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(out, "Deployment %s %s: %s\n", resp.ExecutionID, resp.Status, resp.Message)
+			for _, diagnosis := range resp.Diagnoses {
+				fmt.Fprintf(out, "  [%s] %s\n      %s\n", diagnosis.StepID, diagnosis.Title, diagnosis.Remediation)
+			}
+			if resp.Status != "completed" {
+				return fmt.Errorf("deployment %s %s, see aictl deployments logs %s", resp.ExecutionID, resp.Status, resp.ExecutionID)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&clusterID, "cluster", 0, "ID of the cluster to deploy to")
+	cmd.Flags().StringVar(&kubeconfig, "kubeconfig", "", "kubeconfig to deploy with (default $KUBECONFIG or ~/.kube/config)")
+	cmd.Flags().BoolVar(&scoped, "scoped", false, "deploy as a ServiceAccount limited to the plan's resources")
+	cmd.Flags().BoolVar(&skipPreflight, "skip-preflight", false, "deploy without preflight checks")
+	return cmd
+}
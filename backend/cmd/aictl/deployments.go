@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"grafana-ai-agent-platform/backend/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+func newDeploymentsCommand(opts *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deployments",
+		Short: "Inspect deployments",
+	}
+	cmd.AddCommand(newDeploymentsLogsCommand(opts))
+	return cmd
+}
+
+func newDeploymentsLogsCommand(opts *options) *cobra.Command {
+	var follow bool
+	cmd := &cobra.Command{
+		Use:   "logs EXECUTION_ID",
+		Short: "Print the logs of a deployment",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			printLine := func(line client.LogLine) error {
+				if line.StepID == "" {
+					fmt.Fprintln(out, line.Text)
+				} else {
+					fmt.Fprintf(out, "[%s] %s\n", line.StepID, line.Text)
+				}
+				return nil
+			}
+
+			if !follow {
+				status, err := c.GetDeployment(cmd.Context(), args[0])
+				if err != nil {
+					return err
+				}
+				if status.Execution == nil {
+					return nil
+				}
+				for _, text := range status.Execution.Logs {
+					printLine(client.LogLine{Text: text})
+				}
+				for _, step := range status.Execution.Steps {
+					for _, text := range step.Logs {
+						printLine(client.LogLine{StepID: step.StepID, Text: text})
+					}
+					if step.Error != "" {
+						printLine(client.LogLine{StepID: step.StepID, Text: "error: " + step.Error})
+					}
+				}
+				return nil
+			}
+
+			final, err := c.StreamLogs(cmd.Context(), args[0], printLine)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Deployment %s %s\n", final.ID, final.Status)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing logs until the deployment finishes")
+	return cmd
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// defaultKubeconfigPath is the kubeconfig kubectl uses, or empty without one
+func defaultKubeconfigPath() string {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 && paths[0] != "" {
+		return paths[0]
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kube", "config")
+}
@@ -0,0 +1,70 @@
+// Command aictl is the platform's command line client. It authenticates with
+// an API key created with POST /api/api-keys:
+//
+//	export AICTL_SERVER=https://platform.example.com AICTL_API_KEY=aik_...
+//	aictl query "deploy a monitoring stack" --cluster 3 -o plan.json
+//	aictl deploy plan.json --cluster 3
+//	aictl deployments logs -f exec-1700000000000000000
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"grafana-ai-agent-platform/backend/pkg/client"
+
+	"github.com/spf13/cobra"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := newRootCommand().ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// options are the flags every command shares
+type options struct {
+	server string
+	apiKey string
+}
+
+// client returns a client of the configured server
+func (o *options) client() (*client.Client, error) {
+	if o.apiKey == "" {
+		return nil, fmt.Errorf("an API key is required, set AICTL_API_KEY or --api-key")
+	}
+	return client.New(o.server, client.WithAPIKey(o.apiKey)), nil
+}
+
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+	root := &cobra.Command{
+		Use:          "aictl",
+		Short:        "Command line client of the Grafana AI agent platform",
+		SilenceUsage: true,
+	}
+	root.PersistentFlags().StringVar(&opts.server, "server", envOr("AICTL_SERVER", "http://localhost:8080"), "URL of the platform (AICTL_SERVER)")
+	root.PersistentFlags().StringVar(&opts.apiKey, "api-key", os.Getenv("AICTL_API_KEY"), "API key to authenticate with (AICTL_API_KEY)")
+
+	root.AddCommand(
+		newQueryCommand(opts),
+		newClustersCommand(opts),
+		newDeployCommand(opts),
+		newDeploymentsCommand(opts),
+	)
+	return root
+}
+
+// envOr returns an environment variable, or fallback when it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
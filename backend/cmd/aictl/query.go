@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"grafana-ai-agent-platform/backend/pkg/api"
+
+	"github.com/spf13/cobra"
+)
+
+func newQueryCommand(opts *options) *cobra.Command {
+	var clusterID uint
+	var model, format, output string
+	var bypassCache bool
+	cmd := &cobra.Command{
+		Use:   "query QUESTION",
+		Short: "Ask the agent a question, e.g. to plan a deployment",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := opts.client()
+			if err != nil {
+				return err
+			}
+			req := api.QueryRequest{Query: args[0], Model: model, BypassCache: bypassCache, Format: format}
+			if clusterID != 0 {
+				req.ClusterID = &clusterID
+			}
+			resp, err := c.QueryAgent(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintln(out, resp.Response)
+			plan := resp.DeploymentPlan
+			if plan == nil {
+				return nil
+			}
+			// Machine-readable answers stay alone on stdout
+			if format == "json" || format == "yaml-manifests-only" {
+				out = cmd.ErrOrStderr()
+			}
+			fmt.Fprintf(out, "\nPlan %s: %s (%d steps)\n", plan.ID, plan.Name, len(plan.Steps))
+			for i, step := range plan.Steps {
+				fmt.Fprintf(out, "  %d. %s\n", i+1, step.Name)
+			}
+			for _, risk := range plan.Risks {
+				fmt.Fprintf(out, "  Risk: %s\n", risk)
+			}
+			if output == "" {
+				fmt.Fprintf(out, "\nSave it with -o plan.json to deploy it with aictl deploy\n")
+				return nil
+			}
+			encoded, err := json.MarshalIndent(plan, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to encode plan: %w", err)
+			}
+			if err := os.WriteFile(output, append(encoded, '\n'), 0o644); err != nil {
+				return fmt.Errorf("failed to write plan: %w", err)
+			}
+			fmt.Fprintf(out, "\nPlan written to %s\n", output)
+			return nil
+		},
+	}
+	cmd.Flags().UintVar(&clusterID, "cluster", 0, "ID of the cluster the question is about")
+	cmd.Flags().StringVar(&model, "model", "", "model to answer with instead of the configured one")
+	cmd.Flags().StringVar(&format, "format", "", "format of the answer: markdown, plain, json or yaml-manifests-only")
+	cmd.Flags().BoolVar(&bypassCache, "no-cache", false, "ask the model again even when a cached answer exists")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "file to write the deployment plan to")
+	return cmd
+}
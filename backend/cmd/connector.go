@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/tunnel"
+
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// connectorMinBackoff and connectorMaxBackoff bound the wait between
+	// attempts to reach the platform
+	connectorMinBackoff = time.Second
+	connectorMaxBackoff = time.Minute
+)
+
+// runConnector runs the in-cluster connector: it dials out to the platform at
+// CONNECTOR_SERVER_URL with CONNECTOR_TOKEN and serves the platform's API
+// requests with its ServiceAccount, reconnecting until it's stopped. It
+// returns the exit code.
+func runConnector() int {
+	serverURL, token := os.Getenv("CONNECTOR_SERVER_URL"), os.Getenv("CONNECTOR_TOKEN")
+	if serverURL == "" || token == "" {
+		fmt.Fprintln(os.Stderr, "CONNECTOR_SERVER_URL and CONNECTOR_TOKEN are required")
+		return 2
+	}
+	handler, err := apiServerProxy()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	backoff := connectorMinBackoff
+	for ctx.Err() == nil {
+		dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		conn, err := tunnel.Dial(dialCtx, serverURL, token)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to connect to %s, retrying in %s: %v", serverURL, backoff, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, connectorMaxBackoff)
+			continue
+		}
+
+		log.Printf("Connected to %s", serverURL)
+		backoff = connectorMinBackoff
+		served := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-served:
+			}
+		}()
+		tunnel.Serve(conn, handler)
+		close(served)
+		log.Printf("Disconnected from %s", serverURL)
+	}
+	return 0
+}
+
+// apiServerProxy forwards requests to the cluster's API server, authenticated
+// as the connector's ServiceAccount
+func apiServerProxy() (http.Handler, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("the connector must run in a cluster: %w", err)
+	}
+	transport, err := rest.TransportFor(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API server transport: %w", err)
+	}
+	target, err := url.Parse(config.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid API server address: %w", err)
+	}
+
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = target.Host
+			// The ServiceAccount's token is set by the transport
+			req.Header.Del("Authorization")
+		},
+		Transport:     transport,
+		FlushInterval: -1,
+	}, nil
+}
@@ -1,23 +1,43 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"time"
 
 	"grafana-ai-agent-platform/backend/internal/agent"
 	"grafana-ai-agent-platform/backend/internal/config"
-	"grafana-ai-agent-platform/backend/internal/handlers"
-	"grafana-ai-agent-platform/backend/internal/middleware"
+	"grafana-ai-agent-platform/backend/internal/server"
 	"grafana-ai-agent-platform/backend/pkg/database"
-
-	"github.com/gin-gonic/gin"
+	"grafana-ai-agent-platform/backend/pkg/tracing"
 )
 
 func main() {
+	// The in-cluster connector runs from the same image and needs no configuration
+	if len(os.Args) > 1 && os.Args[1] == "connector" {
+		os.Exit(runConnector())
+	}
+
 	// Load configuration
 	cfg := config.LoadConfig()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		log.Printf("Tracing disabled: %v", err)
+	} else {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			shutdownTracing(ctx)
+		}()
+	}
+
 	// Initialize database
 	db, err := database.NewDatabase(cfg)
 	if err != nil {
@@ -25,73 +45,12 @@ func main() {
 	}
 	defer db.Close()
 
-	// Initialize AI agent
-	aiAgent := agent.NewAIAgent(&agent.Config{
-		OpenAIAPIKey:     cfg.OpenAI.APIKey,
-		OpenRouterAPIKey: cfg.OpenRouter.APIKey,
-		Model:            "deepseek/deepseek-chat-v3.1:free",
-		UseOpenRouter:    true, // Use OpenRouter instead of OpenAI
-	})
-
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, cfg)
-	kubernetesHandler := handlers.NewKubernetesHandler(db)
-	agentHandler := handlers.NewAgentHandler(db, aiAgent)
-
-	// Setup Gin router
-	router := gin.Default()
-
-	// Add CORS middleware
-	router.Use(middleware.CORSMiddleware())
-
-	// Health check endpoint
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "kubernetes-ai-agent-platform",
-		})
-	})
-
-	// API routes
-	api := router.Group("/api")
-	{
-		// Authentication routes
-		auth := api.Group("/auth")
-		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
-			auth.POST("/logout", authHandler.Logout)
-		}
-
-		// Protected routes
-		protected := api.Group("")
-		protected.Use(middleware.AuthMiddleware(cfg.JWT.Secret))
-		{
-			// User profile
-			protected.GET("/profile", authHandler.GetProfile)
-
-			// Kubernetes routes
-			kubernetes := protected.Group("/kubernetes")
-			{
-				kubernetes.POST("/validate", kubernetesHandler.ValidateCluster)
-				kubernetes.POST("/clusters", kubernetesHandler.AddCluster)
-				kubernetes.GET("/clusters", kubernetesHandler.GetClusters)
-				kubernetes.DELETE("/clusters/:id", kubernetesHandler.DeleteCluster)
-				kubernetes.GET("/clusters/:id/resources", kubernetesHandler.GetClusterResources)
-				kubernetes.POST("/clusters/:id/refresh", kubernetesHandler.RefreshClusterStatus)
-			}
-
-			// AI Agent routes
-			agent := protected.Group("/agent")
-			{
-				agent.POST("/query", agentHandler.QueryAgent)
-				agent.POST("/deploy", agentHandler.DeployStack)
-				agent.GET("/queries", agentHandler.GetQueryHistory)
-				agent.GET("/deployments", agentHandler.GetDeploymentHistory)
-			}
-		}
+	if len(os.Args) > 1 && os.Args[1] == "worker" {
+		os.Exit(runWorker(cfg, db, newAIAgent(cfg)))
 	}
 
+	router := server.NewRouter(cfg, db, newAIAgent(cfg))
+
 	// Start server
 	serverAddr := fmt.Sprintf("0.0.0.0:%s", cfg.Server.Port)
 	log.Printf("Server starting on %s", serverAddr)
@@ -100,3 +59,28 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// newAIAgent creates the AI agent with the configured models
+func newAIAgent(cfg *config.Config) *agent.AIAgent {
+	modelPrices, err := agent.LoadModelPrices(cfg.LLM.ModelPricesFile)
+	if err != nil {
+		log.Printf("Failed to load model prices, completions are not priced: %v", err)
+	}
+	return agent.NewAIAgent(&agent.Config{
+		OpenAIAPIKey:      cfg.OpenAI.APIKey,
+		OpenRouterAPIKey:  cfg.OpenRouter.APIKey,
+		OllamaURL:         cfg.Ollama.URL,
+		Provider:          cfg.LLM.Provider,
+		Offline:           cfg.Offline.Enabled,
+		Model:             cfg.LLM.Model,
+		Fallbacks:         cfg.LLM.FallbackModels,
+		Selectable:        cfg.LLM.SelectableModels,
+		ModelPrices:       modelPrices,
+		EmbeddingModel:    cfg.Knowledge.EmbeddingModel,
+		RequestTimeout:    cfg.LLM.RequestTimeout,
+		MaxPromptChars:    cfg.LLM.MaxPromptChars,
+		MaxResponseTokens: cfg.LLM.MaxResponseTokens,
+		CircuitThreshold:  cfg.LLM.CircuitThreshold,
+		CircuitCooldown:   cfg.LLM.CircuitCooldown,
+	})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"gorm.io/gorm/logger"
+)
+
+const migrateUsage = `Usage: main migrate <command> [--allow-destructive]
+
+Commands:
+  status        List migrations and when they were applied
+  up [id]       Apply pending migrations, up to and including id
+  down [n]      Roll back the last n migrations (default 1); drops data
+`
+
+// runMigrate runs the migrate subcommand and returns the exit code
+func runMigrate(cfg *config.Config, args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	allowDestructive := flags.Bool("allow-destructive", false, "apply destructive migrations and allow rollbacks")
+	flags.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+
+	// Flags may follow the command and its argument
+	var positional []string
+	for len(args) > 0 {
+		if err := flags.Parse(args); err != nil {
+			return 2
+		}
+		args = flags.Args()
+		if len(args) > 0 {
+			positional = append(positional, args[0])
+			args = args[1:]
+		}
+	}
+	if len(positional) == 0 || len(positional) > 2 {
+		flags.Usage()
+		return 2
+	}
+
+	db, err := database.Connect(cfg.Database, logger.Warn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch positional[0] {
+	case "status":
+		statuses, err := database.MigrationStatuses(db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			destructive := ""
+			if status.Destructive {
+				destructive = " [destructive]"
+			}
+			fmt.Printf("%-40s %-30s %s%s\n", status.ID, applied, status.Description, destructive)
+		}
+	case "up":
+		opts := database.MigrateOptions{AllowDestructive: *allowDestructive}
+		if len(positional) == 2 {
+			opts.Target = positional[1]
+		}
+		applied, err := database.Migrate(db, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		} else {
+			fmt.Printf("Applied %s\n", strings.Join(applied, ", "))
+		}
+	case "down":
+		steps := 1
+		if len(positional) == 2 {
+			if steps, err = strconv.Atoi(positional[1]); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of migrations %q\n", positional[1])
+				return 2
+			}
+		}
+		reverted, err := database.Rollback(db, steps, *allowDestructive)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No applied migrations")
+		} else {
+			fmt.Printf("Rolled back %s\n", strings.Join(reverted, ", "))
+		}
+	default:
+		flags.Usage()
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/server"
+	"grafana-ai-agent-platform/backend/pkg/database"
+)
+
+// runWorker runs a deployment worker without the API until it is interrupted,
+// then waits for the jobs it runs, and returns the exit code
+func runWorker(cfg *config.Config, db *database.Database, aiAgent *agent.AIAgent) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stopWorkers, err := server.StartWorkers(cfg, db, aiAgent)
+	if err != nil {
+		log.Printf("Failed to start deployment worker: %v", err)
+		return 1
+	}
+	log.Printf("Deployment worker running %d jobs at once", cfg.Workers.Concurrency)
+
+	<-ctx.Done()
+	log.Printf("Deployment worker stopping once its jobs finished")
+	stopWorkers()
+	return 0
+}
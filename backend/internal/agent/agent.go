@@ -2,53 +2,200 @@ package agent
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
+	"grafana-ai-agent-platform/backend/pkg/tracing"
+
 	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // AIAgent handles AI-powered Kubernetes operations
 type AIAgent struct {
-	client *openai.Client
-	cfg    *Config
+	client LLMProvider
+	// defaultProvider names the provider of client
+	defaultProvider string
+	// providers serve models prefixed with their name
+	providers map[string]LLMProvider
+	// embedder is nil when the provider has no embedding API
+	embedder EmbeddingProvider
+	cfg      *Config
+	onUsage  []func(Usage)
+	breaker  *circuitBreaker
+}
+
+// Usage is the token usage and latency of one completion
+type Usage struct {
+	Model            string
+	Provider         string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Duration         time.Duration
+	// Cost is priced with the configured model prices, 0 when unpriced
+	Cost float64
+	// Error is set when the completion failed
+	Error string
+	// UserID is the user the completion was made for, 0 for background work
+	UserID uint
+}
+
+// LLMProvider is the chat completion API the agent talks to. The OpenAI and
+// OpenRouter clients satisfy it; tests can inject a fake.
+type LLMProvider interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
 }
 
 // Config holds AI agent configuration
 type Config struct {
 	OpenAIAPIKey     string
 	OpenRouterAPIKey string
-	Model            string
-	UseOpenRouter    bool
+	// OllamaURL is a local Ollama server, serving "ollama:" models
+	OllamaURL string
+	// Provider serves models without a provider prefix: openai (default),
+	// openrouter or ollama
+	Provider string
+	// Offline leaves out the providers outside the network, OpenAI and
+	// OpenRouter; only Ollama serves models
+	Offline bool
+	Model   string
+	// Fallbacks are tried in order when a model is rate limited or fails with
+	// a server error. "openai:", "openrouter:" and "ollama:" prefixes pick the
+	// provider; other models use the default one.
+	Fallbacks []string
+	// Selectable are models queries may select besides Model and Fallbacks
+	Selectable []string
+	// ModelPrices price completions per million tokens, by model as configured
+	ModelPrices map[string]ModelPrice
+	// EmbeddingModel embeds knowledge base documents and queries
+	EmbeddingModel string
+	// RequestTimeout bounds each completion attempt; a model that times out
+	// falls back like a failing one. 0 waits as long as the caller does.
+	RequestTimeout time.Duration
+	// MaxPromptChars bounds the prompt of queries: cluster information is
+	// summarized, then truncated, to fit. 0 is unlimited.
+	MaxPromptChars int
+	// MaxResponseTokens bounds replies, 4000 when 0
+	MaxResponseTokens int
+	// CircuitThreshold consecutive failures or timeouts of a model stop its
+	// completions for CircuitCooldown. 0 disables circuit breaking.
+	CircuitThreshold int
+	CircuitCooldown  time.Duration
 }
 
+// defaultMaxResponseTokens bounds replies when no limit is configured
+const defaultMaxResponseTokens = 4000
+
+// ErrPromptTooLarge fails queries whose prompt exceeds the configured limit
+// even without cluster information
+var ErrPromptTooLarge = errors.New("prompt exceeds the maximum size")
+
 // NewAIAgent creates a new AI agent instance
 func NewAIAgent(cfg *Config) *AIAgent {
-	var client *openai.Client
+	// Configure OpenRouter, OpenAI and Ollama clients
+	// Provider requests show up in the traces of the queries they answer
+	httpClient := &http.Client{Transport: tracing.WrapTransport("llm")(http.DefaultTransport)}
+	clientConfig := openai.DefaultConfig(cfg.OpenRouterAPIKey)
+	clientConfig.BaseURL = "https://openrouter.ai/api/v1"
+	clientConfig.HTTPClient = httpClient
+	openRouter := openai.NewClientWithConfig(clientConfig)
+	openAIConfig := openai.DefaultConfig(cfg.OpenAIAPIKey)
+	openAIConfig.HTTPClient = httpClient
+	openAI := openai.NewClientWithConfig(openAIConfig)
+	var ollama *openai.Client
+	if cfg.OllamaURL != "" {
+		// Ollama needs no key, but the client sends one
+		ollamaConfig := openai.DefaultConfig("ollama")
+		ollamaConfig.BaseURL = strings.TrimRight(cfg.OllamaURL, "/") + "/v1"
+		ollamaConfig.HTTPClient = httpClient
+		ollama = openai.NewClientWithConfig(ollamaConfig)
+	}
 
-	if cfg.UseOpenRouter {
-		// Configure OpenRouter client
-		clientConfig := openai.DefaultConfig(cfg.OpenRouterAPIKey)
-		clientConfig.BaseURL = "https://openrouter.ai/api/v1"
-		client = openai.NewClientWithConfig(clientConfig)
-	} else {
-		// Use OpenAI client
-		client = openai.NewClient(cfg.OpenAIAPIKey)
+	var agent *AIAgent
+	switch {
+	case cfg.Provider == ProviderOllama && ollama != nil:
+		agent = NewAIAgentWithProvider(cfg, ollama)
+		agent.defaultProvider = ProviderOllama
+	case cfg.Provider == ProviderOllama || cfg.Offline:
+		agent = NewAIAgentWithProvider(cfg, unavailableProvider{offline: cfg.Offline})
+		agent.defaultProvider = cfg.Provider
+	case cfg.Provider == ProviderOpenRouter:
+		agent = NewAIAgentWithProvider(cfg, openRouter)
+		agent.defaultProvider = ProviderOpenRouter
+	default:
+		agent = NewAIAgentWithProvider(cfg, openAI)
 	}
 
+	// Fallbacks may name models of any provider that is configured
+	if ollama != nil {
+		agent.providers[ProviderOllama] = ollama
+	}
+	if cfg.Offline {
+		return agent
+	}
+	if cfg.OpenAIAPIKey != "" {
+		agent.providers[ProviderOpenAI] = openAI
+	}
+	if cfg.OpenRouterAPIKey != "" {
+		agent.providers[ProviderOpenRouter] = openRouter
+	}
+	if cfg.Provider == ProviderOpenRouter && cfg.OpenAIAPIKey != "" {
+		// Prefer OpenAI's embedding API when a key is configured
+		agent.embedder = openAI
+	}
+	return agent
+}
+
+// NewAIAgentWithProvider creates an AI agent backed by the given provider
+func NewAIAgentWithProvider(cfg *Config, provider LLMProvider) *AIAgent {
+	embedder, _ := provider.(EmbeddingProvider)
 	return &AIAgent{
-		client: client,
-		cfg:    cfg,
+		client:          provider,
+		defaultProvider: ProviderOpenAI,
+		providers:       map[string]LLMProvider{},
+		embedder:        embedder,
+		cfg:             cfg,
+		breaker:         newCircuitBreaker(cfg.CircuitThreshold, cfg.CircuitCooldown),
 	}
 }
 
+// OnUsage registers fn to be called after every completion, e.g. to record
+// token usage. Register hooks before the agent serves requests.
+func (a *AIAgent) OnUsage(fn func(Usage)) {
+	a.onUsage = append(a.onUsage, fn)
+}
+
 // QueryRequest represents a user query
 type QueryRequest struct {
-	Query       string `json:"query"`
-	ClusterID   *uint  `json:"cluster_id,omitempty"`
-	ClusterName string `json:"cluster_name,omitempty"`
-	ClusterInfo string `json:"cluster_info,omitempty"`
+	Query       string           `json:"query"`
+	ClusterID   *uint            `json:"cluster_id,omitempty"`
+	ClusterName string           `json:"cluster_name,omitempty"`
+	ClusterInfo string           `json:"cluster_info,omitempty"`
+	Analysis    *ClusterAnalysis `json:"cluster_analysis,omitempty"`
+	// Namespace is the namespace the user works in, which questions and plans
+	// that name no namespace are about
+	Namespace string `json:"namespace,omitempty"`
+	// Knowledge are runbook passages retrieved for the query
+	Knowledge []KnowledgeExcerpt `json:"knowledge,omitempty"`
+	// PastQueries are the team's earlier queries most similar to this one
+	PastQueries []PastQuery `json:"past_queries,omitempty"`
+	// Examples are past answers the team rated helpful, shown as examples
+	Examples []PastQuery `json:"examples,omitempty"`
+	// Templates are the stack templates of the user's organization, preferred
+	// over the catalog's curated ones
+	Templates []StackProfile `json:"templates,omitempty"`
+	// Model answers the query instead of the configured model
+	Model string `json:"model,omitempty"`
+	// PlanRequested asks for a deployment plan following the plan schema
+	// along with the answer
+	PlanRequested bool `json:"plan_requested,omitempty"`
+	// Format is the format of the answer, one of AnswerFormats; Markdown when empty
+	Format string `json:"format,omitempty"`
 }
 
 // QueryResponse represents the AI response
@@ -56,12 +203,26 @@ type QueryResponse struct {
 	Response        string           `json:"response"`
 	DeploymentPlan  *DeploymentPlan  `json:"deployment_plan,omitempty"`
 	ClusterAnalysis *ClusterAnalysis `json:"cluster_analysis,omitempty"`
-	Status          string           `json:"status"`
-	Timestamp       time.Time        `json:"timestamp"`
+	// PlanErrors are the schema violations of a requested plan the model
+	// failed to produce correctly, in which case DeploymentPlan is nil
+	PlanErrors []string `json:"plan_errors,omitempty"`
+	Status     string   `json:"status"`
+	// Model answered the query, a fallback when the requested one failed
+	Model string `json:"model"`
+	// Provider served Model
+	Provider string `json:"provider"`
+	// LatencyMs is how long the providers took, over every model and attempt tried
+	LatencyMs int64 `json:"latency_ms"`
+	// ContextTruncated reports whether the cluster information was shortened
+	// to fit the prompt limit
+	ContextTruncated bool      `json:"context_truncated,omitempty"`
+	Timestamp        time.Time `json:"timestamp"`
 }
 
-// DeploymentPlan represents a deployment strategy
+// DeploymentPlan represents a deployment strategy. Its JSON form is described
+// by the plan schema of SchemaVersion.
 type DeploymentPlan struct {
+	SchemaVersion  string           `json:"schema_version"`
 	ID             string           `json:"id"`
 	Name           string           `json:"name"`
 	Description    string           `json:"description"`
@@ -71,6 +232,34 @@ type DeploymentPlan struct {
 	ResourceImpact ResourceImpact   `json:"resource_impact"`
 	Prerequisites  []string         `json:"prerequisites"`
 	Risks          []string         `json:"risks"`
+	// SecurityReport is the latest vulnerability scan of the images the plan runs
+	SecurityReport *SecurityReport `json:"security_report,omitempty"`
+	// Template is the catalog template the plan was created from, name@version
+	Template string `json:"template,omitempty"`
+	// RequiredApprovals is how many different reviewers must approve the plan,
+	// as its organization's template requires
+	RequiredApprovals int `json:"required_approvals,omitempty"`
+	// Overlays are merged into the charts' values when the plan deploys to a
+	// cluster of their environment, keyed by dev, staging or prod
+	Overlays map[string]*ValueOverlay `json:"overlays,omitempty"`
+	// Warnings report what the platform changed when the plan was last
+	// saved, such as credentials replaced with secret references. They are
+	// not stored.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// ValueOverlay holds the values an environment changes, such as small
+// requests in dev and replicas in prod
+type ValueOverlay struct {
+	// Values are merged into every chart's values
+	Values map[string]interface{} `json:"values,omitempty"`
+	// ChartValues are merged into the values of the named chart only
+	ChartValues map[string]map[string]interface{} `json:"chart_values,omitempty"`
+}
+
+// IsEmpty reports whether the overlay changes nothing
+func (o *ValueOverlay) IsEmpty() bool {
+	return o == nil || (len(o.Values) == 0 && len(o.ChartValues) == 0)
 }
 
 // HelmChart represents a Helm chart to be deployed
@@ -78,9 +267,13 @@ type HelmChart struct {
 	Name        string                 `json:"name"`
 	Repository  string                 `json:"repository"`
 	Version     string                 `json:"version"`
+	ReleaseName string                 `json:"release_name,omitempty"` // defaults to the chart name
+	Namespace   string                 `json:"namespace,omitempty"`
 	Values      map[string]interface{} `json:"values"`
 	Description string                 `json:"description"`
 	URL         string                 `json:"url"`
+	// ChartID is the Artifact Hub package the chart was found as
+	ChartID string `json:"chart_id,omitempty"`
 }
 
 // DeploymentStep represents a deployment step
@@ -90,11 +283,49 @@ type DeploymentStep struct {
 	Description string     `json:"description"`
 	Chart       *HelmChart `json:"chart,omitempty"`
 	Command     string     `json:"command,omitempty"`
-	Status      string     `json:"status"` // pending, running, completed, failed
-	Logs        []string   `json:"logs"`
-	StartTime   *time.Time `json:"start_time,omitempty"`
-	EndTime     *time.Time `json:"end_time,omitempty"`
-	Error       string     `json:"error,omitempty"`
+	// Manifest is raw Kubernetes YAML applied with server-side apply
+	Manifest  string `json:"manifest,omitempty"`
+	Namespace string `json:"namespace,omitempty"` // default namespace for Manifest objects
+	Action    string `json:"action,omitempty"`    // install (default) or upgrade
+	// Atomic rolls a chart back to its previous revision, or uninstalls it, when
+	// the install or upgrade fails
+	Atomic bool `json:"atomic,omitempty"`
+	// HistoryMax limits the revisions Helm keeps of the release, 0 keeps Helm's default
+	HistoryMax int          `json:"history_max,omitempty"`
+	Retry      *RetryPolicy `json:"retry,omitempty"`
+	// DependsOn names the steps that must complete before this one starts.
+	// Steps of plans that declare no dependencies run in order.
+	DependsOn []string   `json:"depends_on,omitempty"`
+	Status    string     `json:"status"` // pending, running, completed, failed
+	Logs      []string   `json:"logs"`
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// RetryPolicy controls how often a failed step is retried and how long to wait between attempts
+type RetryPolicy struct {
+	MaxAttempts           int `json:"max_attempts"`
+	InitialBackoffSeconds int `json:"initial_backoff_seconds"`
+	MaxBackoffSeconds     int `json:"max_backoff_seconds"`
+}
+
+// DefaultRetryPolicy runs a step once, as steps without a policy always did
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1, InitialBackoffSeconds: 10, MaxBackoffSeconds: 300}
+}
+
+// Backoff returns the wait before the given retry, doubling from the initial backoff
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := time.Duration(p.InitialBackoffSeconds) * time.Second
+	limit := time.Duration(p.MaxBackoffSeconds) * time.Second
+	for i := 1; i < retry && (limit == 0 || backoff < limit); i++ {
+		backoff *= 2
+	}
+	if limit > 0 && backoff > limit {
+		backoff = limit
+	}
+	return backoff
 }
 
 // ResourceImpact represents the impact on cluster resources
@@ -103,12 +334,66 @@ type ResourceImpact struct {
 	Memory  string `json:"memory"`
 	Storage string `json:"storage"`
 	Nodes   int    `json:"nodes"`
+	// EstimatedMonthlyCost prices the requested CPU, memory and storage
+	EstimatedMonthlyCost float64 `json:"estimated_monthly_cost,omitempty"`
+	Currency             string  `json:"currency,omitempty"`
 }
 
+// Vulnerability severities, from least to most severe
+const (
+	SeverityUnknown  = "UNKNOWN"
+	SeverityLow      = "LOW"
+	SeverityMedium   = "MEDIUM"
+	SeverityHigh     = "HIGH"
+	SeverityCritical = "CRITICAL"
+)
+
+// SecurityReport lists the known vulnerabilities of the images a plan runs
+type SecurityReport struct {
+	Scanner   string         `json:"scanner"`
+	ScannedAt time.Time      `json:"scanned_at"`
+	Summary   map[string]int `json:"summary"` // severity -> number of vulnerabilities
+	Images    []ImageScan    `json:"images"`
+}
+
+// ImageScan is the scan of an image a chart's templates reference
+type ImageScan struct {
+	Image           string          `json:"image"`
+	Chart           string          `json:"chart"`
+	Summary         map[string]int  `json:"summary"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+	Error           string          `json:"error,omitempty"`
+}
+
+// Vulnerability is a CVE found in a package of an image
+type Vulnerability struct {
+	ID               string `json:"id"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Severity         string `json:"severity"`
+	Title            string `json:"title,omitempty"`
+	URL              string `json:"url,omitempty"`
+}
+
+// Cluster environments
+const (
+	EnvironmentDev     = "dev"
+	EnvironmentStaging = "staging"
+	EnvironmentProd    = "prod"
+)
+
+// Environments are the environments clusters are classified in, in the order
+// deployments are promoted through them
+var Environments = []string{EnvironmentDev, EnvironmentStaging, EnvironmentProd}
+
 // ClusterAnalysis represents cluster information and capabilities
 type ClusterAnalysis struct {
-	ClusterID      uint                `json:"cluster_id"`
-	ClusterName    string              `json:"cluster_name"`
+	ClusterID   uint   `json:"cluster_id"`
+	ClusterName string `json:"cluster_name"`
+	// Environment and Labels are how the cluster is classified on the platform
+	Environment    string              `json:"environment,omitempty"`
+	Labels         map[string]string   `json:"labels,omitempty"`
 	Version        string              `json:"version"`
 	Nodes          []NodeInfo          `json:"nodes"`
 	Resources      ClusterResources    `json:"resources"`
@@ -116,18 +401,161 @@ type ClusterAnalysis struct {
 	StorageClasses []string            `json:"storage_classes"`
 	NetworkPolicy  string              `json:"network_policy"`
 	Security       SecurityInfo        `json:"security"`
+	Policies       []PolicySummary     `json:"policies"`
+	ServiceMesh    *ServiceMesh        `json:"service_mesh,omitempty"`
+	ClusterAPI     *ClusterAPI         `json:"cluster_api,omitempty"`
+	// NamespaceLimits lists the namespaces with ResourceQuotas or LimitRanges
+	NamespaceLimits []NamespaceLimits `json:"namespace_limits,omitempty"`
+	// Namespaces, the default storage class and the custom resources the
+	// cluster serves let plans be simulated against a snapshot of it
+	Namespaces          []string         `json:"namespaces,omitempty"`
+	DefaultStorageClass string           `json:"default_storage_class,omitempty"`
+	CustomResources     []CustomResource `json:"custom_resources,omitempty"`
+	// Ingress is how the cluster routes HTTP(S) traffic to services
+	Ingress *IngressSupport `json:"ingress,omitempty"`
+	// Usage is what the cluster's pods request, tracked to forecast capacity
+	Usage *ResourceUsage `json:"usage,omitempty"`
+}
+
+// ResourceUsage sums the requests of the pods scheduled on a cluster's nodes
+// that haven't finished
+type ResourceUsage struct {
+	Pods   int    `json:"pods"`
+	CPU    string `json:"cpu"`
+	Memory string `json:"memory"`
+	// Storage is requested ephemeral storage, like the nodes' storage resources
+	Storage string `json:"storage"`
+}
+
+// IngressSupport lists the ingress classes, Gateway API gateways and
+// cert-manager issuers charts can be exposed through
+type IngressSupport struct {
+	// Classes are the cluster's IngressClasses, or the classes its Ingresses
+	// name when it has none
+	Classes      []string `json:"classes,omitempty"`
+	DefaultClass string   `json:"default_class,omitempty"`
+	// GatewayAPI is the Gateway API version the cluster serves, empty without it
+	GatewayAPI string    `json:"gateway_api,omitempty"`
+	Gateways   []Gateway `json:"gateways,omitempty"`
+	// CertManager reports whether cert-manager's CRDs are installed
+	CertManager    bool     `json:"cert_manager"`
+	ClusterIssuers []string `json:"cluster_issuers,omitempty"`
+}
+
+// Gateway is a Gateway API gateway routes can attach to
+type Gateway struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Class     string `json:"class,omitempty"`
+}
+
+// IngressClass is the class Ingresses of charts are given: the default
+// class, else the only or first one
+func (i *IngressSupport) IngressClass() string {
+	if i == nil {
+		return ""
+	}
+	if i.DefaultClass != "" {
+		return i.DefaultClass
+	}
+	if len(i.Classes) > 0 {
+		return i.Classes[0]
+	}
+	return ""
+}
+
+// CustomResource is a kind a CustomResourceDefinition of the cluster serves
+type CustomResource struct {
+	Group      string   `json:"group"`
+	Kind       string   `json:"kind"`
+	Plural     string   `json:"plural"`
+	Namespaced bool     `json:"namespaced"`
+	Versions   []string `json:"versions"`
+}
+
+// NamespaceLimits are the ResourceQuotas and LimitRanges constraining what a
+// namespace runs. Resources are keyed as quotas name them, e.g. requests.cpu,
+// and container limits by cpu and memory.
+type NamespaceLimits struct {
+	Namespace string `json:"namespace"`
+	// QuotaRemaining is what the namespace's unscoped quotas still allow, the
+	// least any of them leaves per resource
+	QuotaRemaining map[string]string `json:"quota_remaining,omitempty"`
+	// Quotas names the quota leaving the least room for each resource
+	Quotas map[string]string `json:"quotas,omitempty"`
+	// Container min, max, defaults and max limit/request ratio of the
+	// namespace's LimitRanges
+	ContainerMin            map[string]string `json:"container_min,omitempty"`
+	ContainerMax            map[string]string `json:"container_max,omitempty"`
+	ContainerDefaultRequest map[string]string `json:"container_default_request,omitempty"`
+	ContainerDefaultLimit   map[string]string `json:"container_default_limit,omitempty"`
+	MaxLimitRequestRatio    map[string]string `json:"max_limit_request_ratio,omitempty"`
+}
+
+// ServiceMesh describes a service mesh detected in the cluster
+type ServiceMesh struct {
+	Type      string `json:"type"` // istio or linkerd
+	Version   string `json:"version"`
+	Namespace string `json:"namespace"`
+	// MTLSMode is the mesh-wide mTLS mode: STRICT, PERMISSIVE or DISABLE
+	MTLSMode           string   `json:"mtls_mode"`
+	InjectedNamespaces []string `json:"injected_namespaces"`
+}
+
+// ClusterAPI describes a Cluster API management cluster and the workload
+// clusters it manages
+type ClusterAPI struct {
+	APIVersion string        `json:"api_version"`
+	Clusters   []CAPICluster `json:"clusters"`
+}
+
+// CAPICluster is a workload cluster managed through Cluster API
+type CAPICluster struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// Phase is Pending, Provisioning, Provisioned, Deleting, Failed or Unknown
+	Phase                  string `json:"phase"`
+	InfrastructureProvider string `json:"infrastructure_provider,omitempty"` // kind of the infrastructure ref, e.g. AWSCluster
+	ControlPlaneProvider   string `json:"control_plane_provider,omitempty"`  // kind of the control plane ref, e.g. KubeadmControlPlane
+	InfrastructureReady    bool   `json:"infrastructure_ready"`
+	ControlPlaneReady      bool   `json:"control_plane_ready"`
+	// DesiredVersion is the Kubernetes version the topology or control plane asks for
+	DesiredVersion string `json:"desired_version,omitempty"`
+	// ControlPlaneVersion is the version the control plane reports running
+	ControlPlaneVersion string `json:"control_plane_version,omitempty"`
+	// MachineVersions counts machines per Kubernetes version
+	MachineVersions map[string]int `json:"machine_versions,omitempty"`
+	Machines        int            `json:"machines"`
+	ReadyMachines   int            `json:"ready_machines"`
+	Upgrading       bool           `json:"upgrading"`
+	// Conditions lists conditions that are not True, as "Type: reason"
+	Conditions []string `json:"conditions,omitempty"`
 }
 
 // NodeInfo represents information about a cluster node
 type NodeInfo struct {
-	Name        string            `json:"name"`
-	Role        string            `json:"role"`
-	Status      string            `json:"status"`
-	CPU         ResourceInfo      `json:"cpu"`
-	Memory      ResourceInfo      `json:"memory"`
-	Storage     ResourceInfo      `json:"storage"`
-	Labels      map[string]string `json:"labels"`
-	Annotations map[string]string `json:"annotations"`
+	Name    string       `json:"name"`
+	Role    string       `json:"role"`
+	Status  string       `json:"status"`
+	CPU     ResourceInfo `json:"cpu"`
+	Memory  ResourceInfo `json:"memory"`
+	Storage ResourceInfo `json:"storage"`
+	// Platform details from the kubelet, used to match images to nodes
+	Architecture     string            `json:"architecture"`
+	OperatingSystem  string            `json:"operating_system"`
+	OSImage          string            `json:"os_image"`
+	KernelVersion    string            `json:"kernel_version"`
+	ContainerRuntime string            `json:"container_runtime"`
+	Labels           map[string]string `json:"labels"`
+	Annotations      map[string]string `json:"annotations"`
+	Taints           []NodeTaint       `json:"taints,omitempty"`
+}
+
+// NodeTaint is a taint on a node
+type NodeTaint struct {
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Effect string `json:"effect"`
 }
 
 // ResourceInfo represents resource information
@@ -164,57 +592,378 @@ type SecurityInfo struct {
 	PodSecurityPolicy bool `json:"pod_security_policy"`
 	NetworkPolicy     bool `json:"network_policy"`
 	SecretsEnabled    bool `json:"secrets_enabled"`
+	// Permissions is what the cluster's stored credential may do
+	Permissions *CredentialPermissions `json:"permissions,omitempty"`
+}
+
+// CredentialPermissions is what a cluster credential may do in every
+// namespace, probed with SelfSubjectAccessReviews
+type CredentialPermissions struct {
+	ClusterAdmin      bool `json:"cluster_admin"`
+	CreateDeployments bool `json:"create_deployments"`
+	CreateNamespaces  bool `json:"create_namespaces"`
+	ManageSecrets     bool `json:"manage_secrets"`
+	ManageCRDs        bool `json:"manage_crds"`
+	ManageRBAC        bool `json:"manage_rbac"`
+	ManageWebhooks    bool `json:"manage_webhooks"`
+	// Checks are the reviewed actions, with the authorizer's reason when denied
+	Checks []PermissionProbe `json:"checks"`
+}
+
+// PermissionProbe is an action reviewed to probe a credential's permissions
+type PermissionProbe struct {
+	Capability string `json:"capability"`
+	Verb       string `json:"verb"`
+	Group      string `json:"group,omitempty"`
+	Resource   string `json:"resource"`
+	Allowed    bool   `json:"allowed"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Missing lists the capabilities the credential lacks
+func (p *CredentialPermissions) Missing() []string {
+	if p == nil || p.ClusterAdmin {
+		return nil
+	}
+	var missing []string
+	for _, check := range p.Checks {
+		if !check.Allowed && check.Capability != "cluster_admin" {
+			missing = append(missing, check.Capability)
+		}
+	}
+	return missing
+}
+
+// PolicySummary summarizes an admission policy enforced on the cluster
+type PolicySummary struct {
+	Engine      string   `json:"engine"` // kyverno, gatekeeper
+	Kind        string   `json:"kind"`
+	Name        string   `json:"name"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Action      string   `json:"action"` // enforce, audit, deny, dryrun, warn
+	Targets     []string `json:"targets"`
+	Constraints []string `json:"constraints"`
+}
+
+// Enforced reports whether violating the policy blocks admission
+func (p PolicySummary) Enforced() bool {
+	action := strings.ToLower(p.Action)
+	return action == "enforce" || action == "deny" || action == ""
 }
 
 // Query handles user queries and generates responses
 func (a *AIAgent) Query(ctx context.Context, req *QueryRequest) (*QueryResponse, error) {
 	// Build the system prompt based on the query type
 	systemPrompt := a.buildSystemPrompt(req)
+	if req.PlanRequested {
+		systemPrompt += planPromptSection
+	}
+	systemPrompt += formatPromptSection(req.Format)
 
 	// Create the user message
 	userMessage := fmt.Sprintf("Query: %s", req.Query)
-	if req.ClusterInfo != "" {
-		userMessage += fmt.Sprintf("\n\nCluster Information:\n%s", req.ClusterInfo)
-	}
-
-	// Call OpenAI API
-	resp, err := a.client.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model: a.cfg.Model,
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role:    openai.ChatMessageRoleSystem,
-					Content: systemPrompt,
-				},
-				{
-					Role:    openai.ChatMessageRoleUser,
-					Content: userMessage,
-				},
+	clusterInfo, truncated, err := a.fitPrompt(systemPrompt, userMessage, req.ClusterInfo)
+	if err != nil {
+		return nil, err
+	}
+	if clusterInfo != "" {
+		userMessage += fmt.Sprintf("\n\nCluster Information:\n%s", clusterInfo)
+	}
+
+	ctx = WithModel(ctx, req.Model)
+	var response *QueryResponse
+	if req.PlanRequested {
+		response, err = a.queryPlan(ctx, systemPrompt, userMessage)
+	} else {
+		var reply *completion
+		if reply, err = a.complete(ctx, systemPrompt, userMessage); err == nil {
+			response = reply.queryResponse(reply.content)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.Response, err = FormatAnswer(response.Response, req.Format); err != nil {
+		return nil, err
+	}
+	response.ContextTruncated = truncated
+	return response, nil
+}
+
+// fitPrompt returns the cluster information that fits the prompt limit along
+// with the system prompt and user message, and whether it was shortened
+func (a *AIAgent) fitPrompt(systemPrompt, userMessage, clusterInfo string) (string, bool, error) {
+	limit := a.cfg.MaxPromptChars
+	if limit <= 0 {
+		return clusterInfo, false, nil
+	}
+	remaining := limit - len(systemPrompt) - len(userMessage)
+	if remaining < 0 {
+		return "", false, fmt.Errorf("%w of %d characters", ErrPromptTooLarge, limit)
+	}
+	if clusterInfo == "" {
+		return "", false, nil
+	}
+	const header = len("\n\nCluster Information:\n")
+	fitted := fitClusterInfo(clusterInfo, remaining-header)
+	return fitted, fitted != clusterInfo, nil
+}
+
+// queryPlan answers a query with a deployment plan in JSON mode. A plan that
+// violates the schema is sent back once with the violations; if the second
+// one is invalid too the answer comes without a plan.
+func (a *AIAgent) queryPlan(ctx context.Context, systemPrompt, userMessage string) (*QueryResponse, error) {
+	format, err := planAnswerFormat()
+	if err != nil {
+		return nil, err
+	}
+	ctx = withResponseFormat(ctx, format)
+
+	var (
+		answer     planAnswer
+		reply      *completion
+		latency    time.Duration
+		violations []string
+	)
+	for attempt := 0; attempt < 2; attempt++ {
+		message := userMessage
+		if len(violations) > 0 {
+			message += "\n\nYour previous deployment plan did not match the schema:\n- " + strings.Join(violations, "\n- ") + "\nAnswer again with a corrected plan."
+		}
+		reply, err = a.complete(ctx, systemPrompt, message)
+		if err != nil {
+			return nil, err
+		}
+		latency += reply.latency
+		reply.latency = latency
+
+		answer = planAnswer{}
+		if err := json.Unmarshal([]byte(ExtractJSONBlock(reply.content)), &answer); err != nil {
+			// Without a parsable answer there is nothing to correct, so keep
+			// the reply as the answer
+			response := reply.queryResponse(reply.content)
+			response.PlanErrors = []string{fmt.Sprintf("the answer is not valid JSON: %v", err)}
+			return response, nil
+		}
+
+		var plan *DeploymentPlan
+		plan, violations = parsePlan(answer.DeploymentPlan)
+		if len(violations) == 0 {
+			response := reply.queryResponse(answer.Answer)
+			response.DeploymentPlan = plan
+			return response, nil
+		}
+	}
+
+	response := reply.queryResponse(answer.Answer)
+	response.PlanErrors = violations
+	return response, nil
+}
+
+// parsePlan validates a generated plan and decodes it, or returns the schema
+// violations and problems with its step dependencies
+func parsePlan(data json.RawMessage) (*DeploymentPlan, []string) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, []string{"/deployment_plan: missing"}
+	}
+	if err := ValidatePlan(data); err != nil {
+		var validationErr *PlanValidationError
+		if errors.As(err, &validationErr) {
+			return nil, validationErr.Errors
+		}
+		return nil, []string{err.Error()}
+	}
+	var plan DeploymentPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, []string{err.Error()}
+	}
+	if _, err := StepDependencies(plan.Steps); err != nil {
+		return nil, []string{"/steps: " + err.Error()}
+	}
+	plan.SchemaVersion = PlanSchemaVersion
+	return &plan, nil
+}
+
+// planPromptSection tells the model how to answer queries that want a plan
+const planPromptSection = `
+
+Respond with a JSON object with two fields: "answer", your answer to the query in Markdown, and "deployment_plan", a deployment plan following the DeploymentPlan schema ` + PlanSchemaVersion + `:
+- Each step installs one chart (with "chart" set to the chart's name, repository URL, version and values), applies a "manifest", or runs a "command"; steps run in order unless they set "depends_on" to the IDs of the steps they need, which lets independent steps run in parallel.
+- "charts" lists the charts of the steps; "values" only holds values that differ from the chart defaults.
+- Release names and namespaces are lowercase DNS labels.`
+
+// Complete sends a single system/user exchange to the model and returns the
+// reply. Rate limited and failing models fall back along the configured chain.
+func (a *AIAgent) Complete(ctx context.Context, systemPrompt, userMessage string) (string, error) {
+	reply, err := a.complete(ctx, systemPrompt, userMessage)
+	if err != nil {
+		return "", err
+	}
+	return reply.content, nil
+}
+
+// completion is a reply with the model and provider that gave it
+type completion struct {
+	content  string
+	model    string
+	provider string
+	// latency adds up the time spent on every model tried
+	latency time.Duration
+}
+
+// queryResponse is a completed query response answered by the completion
+func (c *completion) queryResponse(answer string) *QueryResponse {
+	return &QueryResponse{
+		Response:  answer,
+		Status:    "completed",
+		Model:     c.model,
+		Provider:  c.provider,
+		LatencyMs: c.latency.Milliseconds(),
+		Timestamp: time.Now(),
+	}
+}
+
+// complete returns the reply of the first model of the chain that answers.
+// Models whose circuit is open are skipped; when every one is, the error
+// wraps ErrCircuitOpen.
+func (a *AIAgent) complete(ctx context.Context, systemPrompt, userMessage string) (*completion, error) {
+	var failures []string
+	var latency time.Duration
+	allOpen := true
+	for _, model := range a.modelChain(ctx) {
+		reply, err := a.completeWith(ctx, model, systemPrompt, userMessage)
+		latency += reply.latency
+		if err == nil {
+			reply.latency = latency
+			return reply, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", model, err))
+		allOpen = allOpen && errors.Is(err, ErrCircuitOpen)
+		if !retryable(err) || ctx.Err() != nil {
+			break
+		}
+	}
+	if allOpen {
+		return nil, fmt.Errorf("failed to create chat completion: %w: %s", ErrCircuitOpen, strings.Join(failures, "; "))
+	}
+	return nil, fmt.Errorf("failed to create chat completion: %s", strings.Join(failures, "; "))
+}
+
+// completeWith sends the exchange to one model, within the request timeout.
+// The reply carries the latency also when the completion failed.
+func (a *AIAgent) completeWith(ctx context.Context, model, systemPrompt, userMessage string) (reply *completion, err error) {
+	reply = &completion{model: model}
+	provider, providerName, name, err := a.providerFor(model)
+	if err != nil {
+		return reply, err
+	}
+	reply.provider = providerName
+	if err := a.breaker.allow(model); err != nil {
+		return reply, err
+	}
+	defer func() { a.breaker.record(model, err) }()
+
+	ctx, span := tracing.Start(ctx, "llm.chat_completion",
+		attribute.String("gen_ai.system", providerName),
+		attribute.String("gen_ai.request.model", name),
+	)
+	defer func() { tracing.End(span, err) }()
+	if a.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.RequestTimeout)
+		defer cancel()
+	}
+	maxTokens := a.cfg.MaxResponseTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultMaxResponseTokens
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model: name,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: systemPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: userMessage,
 			},
-			Temperature: 0.7,
-			MaxTokens:   4000,
 		},
+		Temperature: 0.7,
+		MaxTokens:   maxTokens,
+	}
+	request.ResponseFormat, _ = ctx.Value(responseFormatKey{}).(*openai.ChatCompletionResponseFormat)
+
+	started := time.Now()
+	resp, err := provider.CreateChatCompletion(ctx, request)
+	// Models without structured outputs still follow the prompt's JSON
+	// instructions, and the reply is validated either way
+	if err != nil && request.ResponseFormat != nil && unsupportedResponseFormat(err) {
+		request.ResponseFormat = nil
+		resp, err = provider.CreateChatCompletion(ctx, request)
+	}
+	usage := Usage{
+		Model:            model,
+		Provider:         providerName,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+		TotalTokens:      resp.Usage.TotalTokens,
+		Duration:         time.Since(started),
+		Cost:             a.completionCost(model, resp.Usage),
+	}
+	if err != nil {
+		usage.Error = err.Error()
+	}
+	reply.latency = usage.Duration
+	a.logUsage(ctx, usage)
+	span.SetAttributes(
+		attribute.Int("gen_ai.usage.input_tokens", usage.PromptTokens),
+		attribute.Int("gen_ai.usage.output_tokens", usage.CompletionTokens),
+		attribute.Int("gen_ai.usage.total_tokens", usage.TotalTokens),
+		attribute.Float64("gen_ai.usage.cost", usage.Cost),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create chat completion: %w", err)
+		if a.cfg.RequestTimeout > 0 && ctx.Err() == context.DeadlineExceeded {
+			return reply, fmt.Errorf("no reply within %s: %w", a.cfg.RequestTimeout, context.DeadlineExceeded)
+		}
+		return reply, err
 	}
 
-	// Parse the response
-	response := resp.Choices[0].Message.Content
+	if len(resp.Choices) == 0 {
+		return reply, fmt.Errorf("model returned no choices")
+	}
 
-	// Try to extract structured data from the response
-	deploymentPlan, clusterAnalysis := a.extractStructuredData(response)
+	reply.content = resp.Choices[0].Message.Content
+	return reply, nil
+}
 
-	return &QueryResponse{
-		Response:        response,
-		DeploymentPlan:  deploymentPlan,
-		ClusterAnalysis: clusterAnalysis,
-		Status:          "completed",
-		Timestamp:       time.Now(),
-	}, nil
+// ExtractJSONBlock returns the first JSON object in a model response, stripping
+// markdown code fences and surrounding prose
+func ExtractJSONBlock(response string) string {
+	if start := strings.Index(response, "```"); start != -1 {
+		rest := response[start+3:]
+		if newline := strings.Index(rest, "\n"); newline != -1 {
+			rest = rest[newline+1:]
+		}
+		if end := strings.Index(rest, "```"); end != -1 {
+			return strings.TrimSpace(rest[:end])
+		}
+	}
+
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start == -1 || end <= start {
+		return ""
+	}
+	return response[start : end+1]
 }
 
+// PromptVersion identifies the system prompt buildSystemPrompt writes. Queries
+// record it, so feedback on answers is compared per version; change it with
+// the prompt. v1 had no rated examples.
+const PromptVersion = "v2"
+
 // buildSystemPrompt creates a system prompt based on the query type
 func (a *AIAgent) buildSystemPrompt(req *QueryRequest) string {
 	basePrompt := `You are an expert Kubernetes and DevOps engineer AI assistant. Your role is to help users deploy and manage applications on Kubernetes clusters.
@@ -250,7 +999,10 @@ SPECIFIC INSTRUCTIONS FOR MONITORING STACKS:
 - Provide ingress configuration for web access`
 	}
 
-	if strings.Contains(strings.ToLower(req.Query), "elk") || strings.Contains(strings.ToLower(req.Query), "logging") {
+	profile := MatchStackProfile(req.Query, req.Templates)
+	if profile != nil {
+		basePrompt += stackProfilePromptSection(profile)
+	} else if strings.Contains(strings.ToLower(req.Query), "elk") || strings.Contains(strings.ToLower(req.Query), "logging") {
 		basePrompt += `
 
 SPECIFIC INSTRUCTIONS FOR LOGGING STACKS:
@@ -261,16 +1013,52 @@ SPECIFIC INSTRUCTIONS FOR LOGGING STACKS:
 - Include persistent storage and backup strategies`
 	}
 
+	if req.Analysis != nil {
+		basePrompt += policyPromptSection(req.Analysis.Policies)
+		basePrompt += permissionsPromptSection(req.Analysis.Security.Permissions)
+	}
+	basePrompt += namespacePromptSection(req.Namespace)
+	basePrompt += knowledgePromptSection(req.Knowledge)
+	basePrompt += pastQueriesPromptSection(req.PastQueries)
+	basePrompt += examplesPromptSection(req.Examples)
+
 	return basePrompt
 }
 
-// extractStructuredData attempts to extract structured data from AI response
-func (a *AIAgent) extractStructuredData(response string) (*DeploymentPlan, *ClusterAnalysis) {
-	// Look for JSON blocks in the response
-	// This is a simple extraction - in production, you might want more sophisticated parsing
+// namespacePromptSection tells the model which namespace the user works in
+func namespacePromptSection(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\nWORKING NAMESPACE:\nThe user works in the %q namespace. Answer questions that name no namespace about it, and deploy into it unless the user asks for another one.", namespace)
+}
 
-	// For now, return nil as we'll implement this in the deployment handler
-	return nil, nil
+// policyPromptSection instructs the model to respect enforced admission policies
+func policyPromptSection(policies []PolicySummary) string {
+	var lines []string
+	for _, policy := range policies {
+		if !policy.Enforced() {
+			continue
+		}
+		for _, constraint := range policy.Constraints {
+			lines = append(lines, fmt.Sprintf("- [%s %s] %s", policy.Engine, policy.Name, constraint))
+		}
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+
+	return "\n\nCLUSTER ADMISSION POLICIES (ENFORCED):\nThe target cluster rejects resources that violate these policies. Never propose Helm values, manifests, or commands that would violate them:\n" + strings.Join(lines, "\n")
+}
+
+// permissionsPromptSection tells the model what the platform's credential on
+// the cluster may not do, so plans don't need it
+func permissionsPromptSection(permissions *CredentialPermissions) string {
+	missing := permissions.Missing()
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\n\nCLUSTER CREDENTIAL PERMISSIONS:\nThe platform deploys with a credential that is not cluster-admin and lacks: %s. Don't plan steps that need these permissions; list what a cluster administrator must do first under prerequisites instead.", strings.Join(missing, ", "))
 }
 
 // DeployStack executes a deployment plan
@@ -317,22 +1105,97 @@ func (a *AIAgent) DeployStack(ctx context.Context, plan *DeploymentPlan) (*Deplo
 
 // DeploymentExecution represents the execution of a deployment plan
 type DeploymentExecution struct {
-	ID        string                    `json:"id"`
-	PlanID    string                    `json:"plan_id"`
-	Status    string                    `json:"status"` // running, completed, failed, aborted
-	StartTime time.Time                 `json:"start_time"`
-	EndTime   *time.Time                `json:"end_time,omitempty"`
-	Steps     []DeploymentStepExecution `json:"steps"`
-	Logs      []string                  `json:"logs"`
-	Error     string                    `json:"error,omitempty"`
+	ID         string                    `json:"id"`
+	PlanID     string                    `json:"plan_id"`
+	Status     string                    `json:"status"` // running, completed, failed, aborted, uninstalled
+	StartTime  time.Time                 `json:"start_time"`
+	EndTime    *time.Time                `json:"end_time,omitempty"`
+	Steps      []DeploymentStepExecution `json:"steps"`
+	PostDeploy []PostDeployResult        `json:"post_deploy,omitempty"`
+	Logs       []string                  `json:"logs"`
+	Error      string                    `json:"error,omitempty"`
+	Resumes    int                       `json:"resumes"`
+	// Action is uninstall for executions that removed an earlier deployment,
+	// named by Uninstalls
+	Action     string `json:"action,omitempty"`
+	Uninstalls string `json:"uninstalls,omitempty"`
+	// SBOM lists what a completed deployment installed
+	SBOM *SBOM `json:"sbom,omitempty"`
 }
 
 // DeploymentStepExecution represents the execution of a deployment step
 type DeploymentStepExecution struct {
-	StepID    string     `json:"step_id"`
-	Status    string     `json:"status"` // pending, running, completed, failed
-	StartTime *time.Time `json:"start_time,omitempty"`
-	EndTime   *time.Time `json:"end_time,omitempty"`
-	Logs      []string   `json:"logs"`
-	Error     string     `json:"error,omitempty"`
+	StepID    string      `json:"step_id"`
+	Status    string      `json:"status"` // pending, running, completed, failed, aborted, skipped, uninstalled
+	StartTime *time.Time  `json:"start_time,omitempty"`
+	EndTime   *time.Time  `json:"end_time,omitempty"`
+	Logs      []string    `json:"logs"`
+	Error     string      `json:"error,omitempty"`
+	Attempts  int         `json:"attempts"`
+	Retry     RetryPolicy `json:"retry"`
+	// DependsOn are the steps this one waited for
+	DependsOn []string `json:"depends_on,omitempty"`
+	// ExistingRelease marks a chart step that upgraded a release which existed
+	// before the deployment, so uninstalling the deployment leaves it in place
+	ExistingRelease bool `json:"existing_release,omitempty"`
+	// Diagnosis explains a failed step and how to fix it
+	Diagnosis *FailureDiagnosis `json:"diagnosis,omitempty"`
+}
+
+// FailureDiagnosis is a suggested remediation for a failed step
+type FailureDiagnosis struct {
+	StepID      string `json:"step_id"`
+	Signature   string `json:"signature"`
+	Title       string `json:"title"`
+	Remediation string `json:"remediation"`
+	// Source is "known_issue" for a recorded fix, "builtin" for a common failure, or "llm"
+	Source       string `json:"source"`
+	KnownIssueID uint   `json:"known_issue_id,omitempty"`
+}
+
+// PostDeployResult represents the outcome of a post-deploy step run after a chart install
+type PostDeployResult struct {
+	Name    string            `json:"name"`
+	StepID  string            `json:"step_id"`
+	Status  string            `json:"status"` // completed, failed, skipped
+	Outputs map[string]string `json:"outputs,omitempty"`
+	Logs    []string          `json:"logs"`
+	// Artifacts holds larger captured output, such as test pod logs
+	Artifacts []ExecutionArtifact `json:"artifacts,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// ExecutionArtifact is named output captured while executing a deployment
+type ExecutionArtifact struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+}
+
+// SBOM is the software bill of materials of a deployment: the charts it
+// installed and the container images their pods run
+type SBOM struct {
+	GeneratedAt time.Time   `json:"generated_at"`
+	Charts      []SBOMChart `json:"charts"`
+	Images      []SBOMImage `json:"images"`
+	// Warnings name the releases whose versions or images couldn't be read
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// SBOMChart is a chart release a deployment installed
+type SBOMChart struct {
+	StepID     string `json:"step_id"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	AppVersion string `json:"app_version,omitempty"`
+	Repository string `json:"repository,omitempty"`
+	Release    string `json:"release"`
+	Namespace  string `json:"namespace"`
+}
+
+// SBOMImage is a container image run by the pods of a deployment's releases
+type SBOMImage struct {
+	Image string `json:"image"`
+	// Digest is the repository digest the image was pulled by, e.g. sha256:...
+	Digest   string   `json:"digest,omitempty"`
+	Releases []string `json:"releases"`
 }
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Answer formats queries ask for
+const (
+	FormatMarkdown = "markdown"
+	FormatPlain    = "plain"
+	FormatJSON     = "json"
+	// FormatYAMLManifests answers with Kubernetes manifests only
+	FormatYAMLManifests = "yaml-manifests-only"
+)
+
+// AnswerFormats are the formats answers can be asked in, Markdown by default
+var AnswerFormats = []string{FormatMarkdown, FormatPlain, FormatJSON, FormatYAMLManifests}
+
+// ErrNoManifests fails answers asked as manifests that hold none
+var ErrNoManifests = errors.New("the answer holds no Kubernetes manifests")
+
+var (
+	codeFence    = regexp.MustCompile("(?m)^\\s*```[\\w-]*\\s*$")
+	fencedBlock  = regexp.MustCompile("(?s)```([\\w-]*)[ \\t]*\\n(.*?)```")
+	heading      = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	emphasis     = regexp.MustCompile(`(\*\*|__)(.+?)(\*\*|__)`)
+	inlineCode   = regexp.MustCompile("`([^`\n]+)`")
+	markdownLink = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	bulletItem   = regexp.MustCompile(`(?m)^(\s*)[*+]\s+`)
+	// rules are table header separators and horizontal rules
+	rule          = regexp.MustCompile(`(?m)^[ \t|:-]*-{3,}[ \t|:-]*$\n?`)
+	documentStart = regexp.MustCompile(`(?m)^---\s*$`)
+)
+
+// formatPromptSection tells the model how to format its answer. Markdown, the
+// default, needs no instructions.
+func formatPromptSection(format string) string {
+	var instructions string
+	switch format {
+	case FormatPlain:
+		instructions = "Answer in plain text without Markdown: no headings, emphasis, tables, links or code fences. Put commands and values on lines of their own."
+	case FormatJSON:
+		instructions = `Answer with a single JSON object and nothing else: no prose around it, no Markdown and no code fences. Pick fields that fit the question, with "summary" holding a one-sentence answer.`
+	case FormatYAMLManifests:
+		instructions = "Answer only with Kubernetes manifests in YAML, documents separated by lines of ---, each with apiVersion, kind and metadata. No prose, Markdown or code fences; explain in YAML comments if you must."
+	default:
+		return ""
+	}
+	return "\n\nANSWER FORMAT:\n" + instructions + ` This overrides any other instruction about formatting, including for the "answer" field of JSON responses.`
+}
+
+// FormatAnswer brings an answer into the format it was asked in, as models
+// don't always keep to the instructions: plain answers lose their Markdown,
+// JSON answers that don't parse are wrapped as {"answer": ...}, and manifest
+// answers keep only the documents with an apiVersion and kind.
+func FormatAnswer(answer, format string) (string, error) {
+	switch format {
+	case FormatPlain:
+		return plainAnswer(answer), nil
+	case FormatJSON:
+		return jsonAnswer(answer)
+	case FormatYAMLManifests:
+		return manifestAnswer(answer)
+	}
+	return answer, nil
+}
+
+// plainAnswer strips the Markdown of an answer, keeping code blocks' contents
+// and links' URLs
+func plainAnswer(answer string) string {
+	answer = codeFence.ReplaceAllString(answer, "")
+	answer = rule.ReplaceAllString(answer, "")
+	answer = heading.ReplaceAllString(answer, "")
+	answer = emphasis.ReplaceAllString(answer, "$2")
+	answer = inlineCode.ReplaceAllString(answer, "$1")
+	answer = markdownLink.ReplaceAllString(answer, "$1 ($2)")
+	answer = bulletItem.ReplaceAllString(answer, "$1- ")
+	return strings.TrimSpace(answer)
+}
+
+// jsonAnswer returns the JSON document of an answer, or the answer wrapped in one
+func jsonAnswer(answer string) (string, error) {
+	answer = strings.TrimSpace(answer)
+	for _, candidate := range []string{answer, ExtractJSONBlock(answer)} {
+		if candidate != "" && json.Valid([]byte(candidate)) {
+			return candidate, nil
+		}
+	}
+	wrapped, err := json.Marshal(map[string]string{"answer": plainAnswer(answer)})
+	if err != nil {
+		return "", err
+	}
+	return string(wrapped), nil
+}
+
+// manifestAnswer returns the Kubernetes manifests of an answer as one
+// multi-document YAML stream, from its code blocks when it has any
+func manifestAnswer(answer string) (string, error) {
+	sources := []string{answer}
+	if blocks := fencedBlock.FindAllStringSubmatch(answer, -1); len(blocks) > 0 {
+		sources = sources[:0]
+		for _, block := range blocks {
+			if language := strings.ToLower(block[1]); language == "" || language == "yaml" || language == "yml" {
+				sources = append(sources, block[2])
+			}
+		}
+	}
+
+	var documents []string
+	for _, source := range sources {
+		for _, document := range documentStart.Split(source, -1) {
+			document = strings.TrimSpace(document)
+			var object struct {
+				APIVersion string `json:"apiVersion"`
+				Kind       string `json:"kind"`
+			}
+			if document == "" || yaml.Unmarshal([]byte(document), &object) != nil {
+				continue
+			}
+			if object.APIVersion != "" && object.Kind != "" {
+				documents = append(documents, document)
+			}
+		}
+	}
+	if len(documents) == 0 {
+		return "", ErrNoManifests
+	}
+	return strings.Join(documents, "\n---\n") + "\n", nil
+}
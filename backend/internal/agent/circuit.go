@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen fails completions of a model whose circuit is open after
+// repeated failures, without calling its provider
+var ErrCircuitOpen = errors.New("circuit open after repeated failures")
+
+// circuitBreaker stops calling models that keep failing or timing out. After
+// threshold consecutive failures a model's circuit opens for cooldown; then a
+// single completion probes the model, closing the circuit when it succeeds.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the failure state of one model
+type circuit struct {
+	failures int
+	openedAt time.Time
+	// probing is set while the completion probing an open circuit runs
+	probing bool
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, circuits: map[string]*circuit{}}
+}
+
+// allow returns ErrCircuitOpen when completions of model must not be sent
+func (b *circuitBreaker) allow(model string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.circuits[model]
+	if !ok || state.failures < b.threshold {
+		return nil
+	}
+	reopen := state.openedAt.Add(b.cooldown)
+	if time.Now().Before(reopen) || state.probing {
+		return fmt.Errorf("%w, retrying after %s", ErrCircuitOpen, reopen.Format(time.RFC3339))
+	}
+	state.probing = true
+	return nil
+}
+
+// record updates the circuit of model with the outcome of a completion.
+// Only provider failures count: rejected requests say nothing about its health.
+func (b *circuitBreaker) record(model string, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state, ok := b.circuits[model]
+	if !ok {
+		state = &circuit{}
+		b.circuits[model] = state
+	}
+	state.probing = false
+	// Abandoned completions don't tell either way
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err == nil || !providerFailure(err) {
+		state.failures = 0
+		return
+	}
+	state.failures++
+	if state.failures >= b.threshold {
+		state.openedAt = time.Now()
+	}
+}
+
+// providerFailure reports whether a completion failed because its provider is
+// down, overloaded or too slow
+func providerFailure(err error) bool {
+	if errors.Is(err, errNoProvider) || errors.Is(err, ErrLLMUnavailable) || errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	return retryable(err)
+}
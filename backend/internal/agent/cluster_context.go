@@ -0,0 +1,235 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Production reports whether the cluster is classified as a production cluster
+func (a *ClusterAnalysis) Production() bool {
+	return a.Environment == EnvironmentProd
+}
+
+// Summary renders the analysis as plain text suitable for prompt context
+func (a *ClusterAnalysis) Summary() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Cluster: %s (ID %d)\n", a.ClusterName, a.ClusterID)
+	if a.Environment != "" {
+		fmt.Fprintf(&b, "Environment: %s\n", a.Environment)
+	}
+	if a.Production() {
+		b.WriteString("Production cluster: prefer stable chart versions, multiple replicas, PodDisruptionBudgets, persistence and conservative resource requests equal to limits; deployments need an approved plan\n")
+	}
+	if len(a.Labels) > 0 {
+		labels := make([]string, 0, len(a.Labels))
+		for key, value := range a.Labels {
+			labels = append(labels, key+"="+value)
+		}
+		sort.Strings(labels)
+		fmt.Fprintf(&b, "Labels: %s\n", strings.Join(labels, ", "))
+	}
+	fmt.Fprintf(&b, "Version: %s\n", a.Version)
+	fmt.Fprintf(&b, "Nodes: %d\n", len(a.Nodes))
+	for _, node := range a.Nodes {
+		fmt.Fprintf(&b, "  - %s (%s, %s, %s/%s): cpu %s, memory %s allocatable\n", node.Name, node.Role, node.Status,
+			node.OperatingSystem, node.Architecture, node.CPU.Allocatable, node.Memory.Allocatable)
+		for _, taint := range node.Taints {
+			fmt.Fprintf(&b, "      taint %s\n", taint)
+		}
+	}
+	if windows := a.WindowsNodes(); len(windows) > 0 && len(windows) < len(a.Nodes) {
+		fmt.Fprintf(&b, "Mixed-OS cluster: %d Windows node(s): %s\n", len(windows), strings.Join(windows, ", "))
+	}
+	fmt.Fprintf(&b, "Resources: cpu %s/%s, memory %s/%s (allocatable/total)\n",
+		a.Resources.AvailableCPU, a.Resources.TotalCPU, a.Resources.AvailableMemory, a.Resources.TotalMemory)
+	if a.Usage != nil {
+		fmt.Fprintf(&b, "Requested by %d pods: cpu %s, memory %s\n", a.Usage.Pods, a.Usage.CPU, a.Usage.Memory)
+	}
+
+	if len(a.StorageClasses) > 0 {
+		fmt.Fprintf(&b, "Storage classes: %s\n", strings.Join(a.StorageClasses, ", "))
+	} else {
+		b.WriteString("Storage classes: none\n")
+	}
+
+	fmt.Fprintf(&b, "Capabilities: ingress=%t, load_balancer=%t, persistent_volumes=%t, rbac=%t, network_policy=%t\n",
+		a.Capabilities.IngressAvailable, a.Capabilities.LoadBalancer, a.Capabilities.PersistentVolume,
+		a.Capabilities.RBACEnabled, a.Capabilities.NetworkPolicy)
+
+	if ingress := a.Ingress; ingress != nil {
+		if len(ingress.Classes) > 0 {
+			fmt.Fprintf(&b, "Ingress classes: %s (default: %s)\n", strings.Join(ingress.Classes, ", "), ingress.IngressClass())
+		}
+		if ingress.GatewayAPI != "" {
+			gateways := make([]string, len(ingress.Gateways))
+			for i, gateway := range ingress.Gateways {
+				gateways[i] = gateway.Namespace + "/" + gateway.Name
+			}
+			fmt.Fprintf(&b, "Gateway API %s, gateways: %s\n", ingress.GatewayAPI, strings.Join(gateways, ", "))
+		}
+		if ingress.CertManager {
+			fmt.Fprintf(&b, "cert-manager installed, ClusterIssuers: %s\n", strings.Join(ingress.ClusterIssuers, ", "))
+		}
+	}
+
+	if a.ServiceMesh != nil {
+		fmt.Fprintf(&b, "Service Mesh: %s %s in %s (mTLS: %s, injected namespaces: %s)\n",
+			a.ServiceMesh.Type, a.ServiceMesh.Version, a.ServiceMesh.Namespace, a.ServiceMesh.MTLSMode,
+			strings.Join(a.ServiceMesh.InjectedNamespaces, ","))
+	}
+
+	if a.ClusterAPI != nil {
+		fmt.Fprintf(&b, "Cluster API management cluster (%s), %d workload cluster(s):\n", a.ClusterAPI.APIVersion, len(a.ClusterAPI.Clusters))
+		for _, cluster := range a.ClusterAPI.Clusters {
+			fmt.Fprintf(&b, "  - %s/%s: phase %s, control plane ready=%t, infrastructure ready=%t, %d/%d machines ready",
+				cluster.Namespace, cluster.Name, cluster.Phase, cluster.ControlPlaneReady, cluster.InfrastructureReady,
+				cluster.ReadyMachines, cluster.Machines)
+			if cluster.InfrastructureProvider != "" {
+				fmt.Fprintf(&b, ", infrastructure %s", cluster.InfrastructureProvider)
+			}
+			if cluster.DesiredVersion != "" {
+				fmt.Fprintf(&b, ", desired version %s", cluster.DesiredVersion)
+			}
+			if cluster.ControlPlaneVersion != "" {
+				fmt.Fprintf(&b, ", control plane at %s", cluster.ControlPlaneVersion)
+			}
+			if len(cluster.MachineVersions) > 0 {
+				versions := make([]string, 0, len(cluster.MachineVersions))
+				for version, count := range cluster.MachineVersions {
+					versions = append(versions, fmt.Sprintf("%s x%d", version, count))
+				}
+				sort.Strings(versions)
+				fmt.Fprintf(&b, ", machines at %s", strings.Join(versions, ", "))
+			}
+			if cluster.Upgrading {
+				b.WriteString(", UPGRADE IN PROGRESS")
+			}
+			if len(cluster.Conditions) > 0 {
+				fmt.Fprintf(&b, ", not ready: %s", strings.Join(cluster.Conditions, "; "))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(a.Policies) > 0 {
+		b.WriteString("Admission Policies:\n")
+		for _, policy := range a.Policies {
+			fmt.Fprintf(&b, "  - %s %s %s (action: %s, targets: %s)\n", policy.Engine, policy.Kind, policy.Name, policy.Action, strings.Join(policy.Targets, ","))
+			for _, constraint := range policy.Constraints {
+				fmt.Fprintf(&b, "      * %s\n", constraint)
+			}
+		}
+	}
+
+	if len(a.NamespaceLimits) > 0 {
+		b.WriteString("Namespace limits (resources of generated values must fit these):\n")
+		for _, limits := range a.NamespaceLimits {
+			fmt.Fprintf(&b, "  - %s:", limits.Namespace)
+			if len(limits.QuotaRemaining) > 0 {
+				fmt.Fprintf(&b, " quota remaining %s;", formatResourceMap(limits.QuotaRemaining))
+			}
+			if len(limits.ContainerMin) > 0 {
+				fmt.Fprintf(&b, " container min %s;", formatResourceMap(limits.ContainerMin))
+			}
+			if len(limits.ContainerMax) > 0 {
+				fmt.Fprintf(&b, " container max %s;", formatResourceMap(limits.ContainerMax))
+			}
+			if len(limits.MaxLimitRequestRatio) > 0 {
+				fmt.Fprintf(&b, " max limit/request ratio %s;", formatResourceMap(limits.MaxLimitRequestRatio))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+// NamespaceLimitsOf returns the quotas and LimitRanges of a namespace, or nil
+// when it has none
+func (a *ClusterAnalysis) NamespaceLimitsOf(namespace string) *NamespaceLimits {
+	for i := range a.NamespaceLimits {
+		if a.NamespaceLimits[i].Namespace == namespace {
+			return &a.NamespaceLimits[i]
+		}
+	}
+	return nil
+}
+
+// formatResourceMap lists resources as "name=value" in name order
+func formatResourceMap(resources map[string]string) string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		names[i] = name + "=" + resources[name]
+	}
+	return strings.Join(names, " ")
+}
+
+// WindowsNodes returns the names of the cluster's Windows nodes
+func (a *ClusterAnalysis) WindowsNodes() []string {
+	var names []string
+	for _, node := range a.Nodes {
+		if node.IsWindows() {
+			names = append(names, node.Name)
+		}
+	}
+	return names
+}
+
+// IsWindows reports whether the node runs Windows, from the kubelet's report or
+// the well-known OS label
+func (n NodeInfo) IsWindows() bool {
+	return strings.EqualFold(n.OperatingSystem, "windows") || strings.EqualFold(n.Labels["kubernetes.io/os"], "windows")
+}
+
+func (t NodeTaint) String() string {
+	if t.Value == "" {
+		return fmt.Sprintf("%s:%s", t.Key, t.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect)
+}
+
+// fitClusterInfo shortens cluster information to at most limit characters.
+// Detail lines, indented below the line they belong to, are summarized as a
+// count first; what still doesn't fit is cut at a line boundary.
+func fitClusterInfo(info string, limit int) string {
+	if len(info) <= limit {
+		return info
+	}
+
+	var summarized []string
+	omitted := 0
+	for _, line := range strings.Split(info, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			omitted++
+			continue
+		}
+		if omitted > 0 {
+			summarized = append(summarized, fmt.Sprintf("  ... %d detail lines omitted", omitted))
+			omitted = 0
+		}
+		summarized = append(summarized, line)
+	}
+	if omitted > 0 {
+		summarized = append(summarized, fmt.Sprintf("  ... %d detail lines omitted", omitted))
+	}
+	info = strings.Join(summarized, "\n")
+	if len(info) <= limit {
+		return info
+	}
+
+	const marker = "\n... cluster information truncated"
+	if limit <= len(marker) {
+		return ""
+	}
+	cut := strings.LastIndex(info[:limit-len(marker)], "\n")
+	if cut <= 0 {
+		return ""
+	}
+	return info[:cut] + marker
+}
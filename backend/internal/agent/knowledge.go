@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/tracing"
+
+	"github.com/sashabaranov/go-openai"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultEmbeddingModel embeds knowledge base chunks when none is configured
+const defaultEmbeddingModel = "text-embedding-3-small"
+
+// ErrEmbeddingsUnavailable is returned by Embed when the provider has no embedding API
+var ErrEmbeddingsUnavailable = errors.New("the LLM provider has no embedding API")
+
+// EmbeddingProvider is the embedding API knowledge base documents are indexed
+// with. The OpenAI client satisfies it.
+type EmbeddingProvider interface {
+	CreateEmbeddings(ctx context.Context, conv openai.EmbeddingRequestConverter) (openai.EmbeddingResponse, error)
+}
+
+// KnowledgeExcerpt is a runbook passage retrieved for a query
+type KnowledgeExcerpt struct {
+	Source  string `json:"source"`
+	Content string `json:"content"`
+}
+
+// PastQuery is an earlier answered query of the team resembling a new one
+type PastQuery struct {
+	Query    string    `json:"query"`
+	Response string    `json:"response"`
+	Cluster  string    `json:"cluster,omitempty"`
+	AskedAt  time.Time `json:"asked_at"`
+}
+
+// pastQueryResponseChars bounds each past response in the prompt
+const pastQueryResponseChars = 1200
+
+// Embed returns the embedding of each text, in order
+func (a *AIAgent) Embed(ctx context.Context, texts []string) (embeddings [][]float32, err error) {
+	if a.embedder == nil {
+		return nil, ErrEmbeddingsUnavailable
+	}
+	model := a.cfg.EmbeddingModel
+	if model == "" {
+		model = defaultEmbeddingModel
+	}
+	ctx, span := tracing.Start(ctx, "llm.embeddings",
+		attribute.String("gen_ai.request.model", model),
+		attribute.Int("gen_ai.request.inputs", len(texts)),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	started := time.Now()
+	resp, err := a.embedder.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+		Input: texts,
+		Model: openai.EmbeddingModel(model),
+	})
+	span.SetAttributes(attribute.Int("gen_ai.usage.input_tokens", resp.Usage.PromptTokens))
+	usage := Usage{
+		Model:        model,
+		PromptTokens: resp.Usage.PromptTokens,
+		TotalTokens:  resp.Usage.TotalTokens,
+		Duration:     time.Since(started),
+	}
+	if err != nil {
+		usage.Error = err.Error()
+	}
+	a.reportUsage(ctx, usage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embeddings: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+
+	embeddings = make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
+
+// knowledgePromptSection grounds the answer in the organization's runbooks
+func knowledgePromptSection(excerpts []KnowledgeExcerpt) string {
+	if len(excerpts) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\nORGANIZATION RUNBOOKS:\nThese excerpts of the organization's runbooks and SOPs may be relevant. Follow their practices where they apply, prefer them over generic advice, and name the runbook you rely on:\n")
+	for _, excerpt := range excerpts {
+		fmt.Fprintf(&b, "\n--- %s ---\n%s\n", excerpt.Source, strings.TrimSpace(excerpt.Content))
+	}
+	return b.String()
+}
+
+// pastQueriesPromptSection keeps answers consistent with how the team solved
+// similar questions before
+func pastQueriesPromptSection(queries []PastQuery) string {
+	if len(queries) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\nSIMILAR PAST QUERIES:\nThe team asked these similar questions before. Keep the answer consistent with what was advised then where it still applies, and point it out (e.g. \"a similar issue on cluster X was solved last month by ...\"):\n")
+	for _, query := range queries {
+		where := ""
+		if query.Cluster != "" {
+			where = " on cluster " + query.Cluster
+		}
+		response := strings.TrimSpace(query.Response)
+		if len(response) > pastQueryResponseChars {
+			response = strings.TrimSpace(strings.ToValidUTF8(response[:pastQueryResponseChars], "")) + " [...]"
+		}
+		fmt.Fprintf(&b, "\n--- Asked%s on %s ---\nQ: %s\nA: %s\n", where, query.AskedAt.Format("2006-01-02"), strings.TrimSpace(query.Query), response)
+	}
+	return b.String()
+}
+
+// examplesPromptSection shows answers the team rated helpful, as examples of
+// the structure and level of detail they expect
+func examplesPromptSection(examples []PastQuery) string {
+	if len(examples) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n\nANSWERS RATED HELPFUL:\nThe team rated these answers to earlier questions helpful. Follow their structure and level of detail; their content may not apply to this question:\n")
+	for _, example := range examples {
+		response := strings.TrimSpace(example.Response)
+		if len(response) > pastQueryResponseChars {
+			response = strings.TrimSpace(strings.ToValidUTF8(response[:pastQueryResponseChars], "")) + " [...]"
+		}
+		fmt.Fprintf(&b, "\n--- Example ---\nQ: %s\nA: %s\n", strings.TrimSpace(example.Query), response)
+	}
+	return b.String()
+}
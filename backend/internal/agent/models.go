@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Providers a model may be prefixed with, e.g. "openai:gpt-4o"
+const (
+	ProviderOpenAI     = "openai"
+	ProviderOpenRouter = "openrouter"
+	ProviderOllama     = "ollama"
+)
+
+// errNoProvider fails models of providers without an API key, which the
+// chain skips
+var errNoProvider = errors.New("provider has no API key configured")
+
+// ErrLLMUnavailable fails completions when no configured provider may serve
+// the model, as in offline mode without an Ollama server
+var ErrLLMUnavailable = errors.New("no LLM provider is available")
+
+// unavailableProvider is the default provider when the configured one can't
+// serve models
+type unavailableProvider struct {
+	offline bool
+}
+
+func (p unavailableProvider) CreateChatCompletion(context.Context, openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return openai.ChatCompletionResponse{}, p.err()
+}
+
+// err says why the provider can't serve models
+func (p unavailableProvider) err() error {
+	if p.offline {
+		return fmt.Errorf("%w: offline mode only reaches a local Ollama server, set LLM_PROVIDER=ollama and OLLAMA_URL", ErrLLMUnavailable)
+	}
+	return fmt.Errorf("%w: the ollama provider needs OLLAMA_URL", ErrLLMUnavailable)
+}
+
+// Available returns why the default provider can't serve models, or nil
+func (a *AIAgent) Available() error {
+	if provider, ok := a.client.(unavailableProvider); ok {
+		return provider.err()
+	}
+	return nil
+}
+
+// Embeds reports whether the agent has an embedding API
+func (a *AIAgent) Embeds() bool {
+	return a.embedder != nil
+}
+
+// ModelPrice is the price of a model per million tokens
+type ModelPrice struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+}
+
+// LoadModelPrices reads a JSON file of prices per million tokens by model,
+// e.g. {"openai:gpt-4o": {"prompt": 2.5, "completion": 10}}. An empty path
+// prices nothing.
+func LoadModelPrices(path string) (map[string]ModelPrice, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model prices: %w", err)
+	}
+	var prices map[string]ModelPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("failed to decode model prices: %w", err)
+	}
+	return prices, nil
+}
+
+// modelKey scopes the model of completions to a context
+type modelKey struct{}
+
+// WithModel makes the agent's completions under ctx start with model instead
+// of the configured one, falling back along the configured chain
+func WithModel(ctx context.Context, model string) context.Context {
+	if model == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, modelKey{}, model)
+}
+
+// Models returns the models queries may select: the configured model and its
+// fallbacks, then the other selectable models
+func (a *AIAgent) Models() []string {
+	models := []string{}
+	seen := make(map[string]bool)
+	for _, model := range append(append([]string{a.cfg.Model}, a.cfg.Fallbacks...), a.cfg.Selectable...) {
+		if model != "" && !seen[model] {
+			seen[model] = true
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// AllowsModel reports whether queries may select a model
+func (a *AIAgent) AllowsModel(model string) bool {
+	for _, allowed := range a.Models() {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+// modelChain returns the models a completion tries in order: the context's
+// model or the configured one, then the fallbacks
+func (a *AIAgent) modelChain(ctx context.Context) []string {
+	first, _ := ctx.Value(modelKey{}).(string)
+	if first == "" {
+		first = a.cfg.Model
+	}
+	chain := []string{first}
+	for _, model := range a.cfg.Fallbacks {
+		if model != first {
+			chain = append(chain, model)
+		}
+	}
+	return chain
+}
+
+// providerFor returns the provider serving a model and the model's name there
+func (a *AIAgent) providerFor(model string) (LLMProvider, string, string, error) {
+	if name, ok := strings.CutPrefix(model, ProviderOpenAI+":"); ok {
+		provider, ok := a.providers[ProviderOpenAI]
+		if !ok {
+			return nil, "", "", fmt.Errorf("%s: %w", ProviderOpenAI, errNoProvider)
+		}
+		return provider, ProviderOpenAI, name, nil
+	}
+	if name, ok := strings.CutPrefix(model, ProviderOpenRouter+":"); ok {
+		provider, ok := a.providers[ProviderOpenRouter]
+		if !ok {
+			return nil, "", "", fmt.Errorf("%s: %w", ProviderOpenRouter, errNoProvider)
+		}
+		return provider, ProviderOpenRouter, name, nil
+	}
+	if name, ok := strings.CutPrefix(model, ProviderOllama+":"); ok {
+		provider, ok := a.providers[ProviderOllama]
+		if !ok {
+			return nil, "", "", fmt.Errorf("%s: %w", ProviderOllama, errNoProvider)
+		}
+		return provider, ProviderOllama, name, nil
+	}
+	return a.client, a.defaultProvider, model, nil
+}
+
+// retryable reports whether a failed completion should move on to the next
+// model: rate limits, server errors, timeouts, open circuits and unreachable,
+// unconfigured or unavailable providers
+func retryable(err error) bool {
+	if errors.Is(err, errNoProvider) || errors.Is(err, ErrLLMUnavailable) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode >= 500
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode == http.StatusTooManyRequests || requestErr.HTTPStatusCode >= 500 || requestErr.HTTPStatusCode == 0
+	}
+	return false
+}
+
+// unsupportedResponseFormat reports whether a completion was rejected because
+// the model doesn't support the requested response format
+func unsupportedResponseFormat(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(apiErr.Message), "response_format")
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(requestErr.Error()), "response_format")
+	}
+	return false
+}
+
+// completionCost prices a completion, or returns 0 for models without a price
+func (a *AIAgent) completionCost(model string, usage openai.Usage) float64 {
+	price, ok := a.cfg.ModelPrices[model]
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
+
+// logUsage logs the model, latency and cost of a completion and reports it
+func (a *AIAgent) logUsage(ctx context.Context, usage Usage) {
+	if usage.Error != "" {
+		log.Printf("LLM %s via %s failed after %s: %s", usage.Model, usage.Provider, usage.Duration.Round(time.Millisecond), usage.Error)
+	} else {
+		log.Printf("LLM %s via %s: %d tokens in %s, cost %.6f", usage.Model, usage.Provider, usage.TotalTokens, usage.Duration.Round(time.Millisecond), usage.Cost)
+	}
+	a.reportUsage(ctx, usage)
+}
+
+// userKey scopes the user completions are made for to a context
+type userKey struct{}
+
+// WithUser attributes the agent's completions under ctx to a user, e.g. to
+// account LLM spend per organization
+func WithUser(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, userKey{}, userID)
+}
+
+// reportUsage passes the usage of a completion made under ctx to the usage hooks
+func (a *AIAgent) reportUsage(ctx context.Context, usage Usage) {
+	usage.UserID, _ = ctx.Value(userKey{}).(uint)
+	for _, fn := range a.onUsage {
+		fn(usage)
+	}
+}
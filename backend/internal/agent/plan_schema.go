@@ -0,0 +1,233 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/sashabaranov/go-openai"
+)
+
+// PlanSchemaVersion is the version of the DeploymentPlan JSON Schema plans are
+// generated and stored with
+const PlanSchemaVersion = "v1"
+
+//go:embed schemas/*.json
+var planSchemaFiles embed.FS
+
+// planSchemaFile maps each supported schema version to its file
+var planSchemaFile = map[string]string{
+	"v1": "schemas/deployment_plan.v1.json",
+}
+
+// planUpgrades bring a stored plan of one version to the next, by the version
+// they upgrade from. Plans stored before plans were versioned have none and
+// are v1 plans without the field.
+var planUpgrades = map[string]func(plan map[string]interface{}) error{
+	"": func(plan map[string]interface{}) error {
+		plan["schema_version"] = "v1"
+		return nil
+	},
+}
+
+var (
+	compilePlanSchema sync.Once
+	planSchema        *jsonschema.Schema
+	planSchemaErr     error
+)
+
+// PlanValidationError lists every way a plan violates the schema, each as the
+// JSON pointer of the offending value and what is wrong with it
+type PlanValidationError struct {
+	Errors []string
+}
+
+func (e *PlanValidationError) Error() string {
+	return "plan does not match the deployment plan schema " + PlanSchemaVersion + ": " + strings.Join(e.Errors, "; ")
+}
+
+// PlanSchemaVersions returns the schema versions stored plans may have
+func PlanSchemaVersions() []string {
+	versions := make([]string, 0, len(planSchemaFile))
+	for version := range planSchemaFile {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// PlanSchema returns the JSON Schema of a plan version
+func PlanSchema(version string) ([]byte, error) {
+	file, ok := planSchemaFile[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported plan schema version %q, supported versions are %s", version, strings.Join(PlanSchemaVersions(), ", "))
+	}
+	return planSchemaFiles.ReadFile(file)
+}
+
+// ValidatePlan checks an encoded plan against the current schema. Violations
+// are returned as a *PlanValidationError.
+func ValidatePlan(data []byte) error {
+	compilePlanSchema.Do(func() {
+		var schema []byte
+		if schema, planSchemaErr = PlanSchema(PlanSchemaVersion); planSchemaErr != nil {
+			return
+		}
+		compiler := jsonschema.NewCompiler()
+		compiler.Draft = jsonschema.Draft2020
+		if planSchemaErr = compiler.AddResource(planSchemaFile[PlanSchemaVersion], bytes.NewReader(schema)); planSchemaErr != nil {
+			return
+		}
+		planSchema, planSchemaErr = compiler.Compile(planSchemaFile[PlanSchemaVersion])
+	})
+	if planSchemaErr != nil {
+		return fmt.Errorf("failed to compile the plan schema: %w", planSchemaErr)
+	}
+
+	var plan interface{}
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return &PlanValidationError{Errors: []string{fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+	err := planSchema.Validate(plan)
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return err
+	}
+	return &PlanValidationError{Errors: SchemaViolations(validationErr)}
+}
+
+// SchemaViolations flattens a validation error into its leaves, which name
+// the actual problems rather than the subschemas that failed because of them
+func SchemaViolations(err *jsonschema.ValidationError) []string {
+	var violations []string
+	seen := make(map[string]bool)
+	var walk func(*jsonschema.ValidationError)
+	walk = func(err *jsonschema.ValidationError) {
+		if len(err.Causes) == 0 {
+			location := err.InstanceLocation
+			if location == "" {
+				location = "/"
+			}
+			violation := location + ": " + err.Message
+			if !seen[violation] {
+				seen[violation] = true
+				violations = append(violations, violation)
+			}
+			return
+		}
+		for _, cause := range err.Causes {
+			walk(cause)
+		}
+	}
+	walk(err)
+	return violations
+}
+
+// DecodePlan decodes a stored plan of any supported schema version, upgrading
+// older versions to the current one. Plans of versions this build doesn't know,
+// e.g. stored by a newer one, are refused rather than decoded partially.
+func DecodePlan(data []byte) (*DeploymentPlan, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+
+	for {
+		version, _ := raw["schema_version"].(string)
+		if version == PlanSchemaVersion {
+			break
+		}
+		upgrade, ok := planUpgrades[version]
+		if !ok {
+			return nil, fmt.Errorf("plan has schema version %q, this server supports %s", version, strings.Join(PlanSchemaVersions(), ", "))
+		}
+		if err := upgrade(raw); err != nil {
+			return nil, fmt.Errorf("failed to upgrade plan from schema version %q: %w", version, err)
+		}
+		if next, _ := raw["schema_version"].(string); next == version {
+			return nil, fmt.Errorf("upgrading plan from schema version %q left its version unchanged", version)
+		}
+	}
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upgraded plan: %w", err)
+	}
+	var plan DeploymentPlan
+	if err := json.Unmarshal(upgraded, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode plan: %w", err)
+	}
+	return &plan, nil
+}
+
+// planAnswer is what queries asking for a deployment plan are answered with
+type planAnswer struct {
+	Answer         string          `json:"answer"`
+	DeploymentPlan json.RawMessage `json:"deployment_plan"`
+}
+
+// planAnswerFormat asks for a planAnswer whose plan follows the current plan
+// schema. Plans have free-form chart values, which strict mode can't express.
+// Security reports come from scans, templates and their approvals from the
+// catalog, overlays from users and warnings from the platform, so none of
+// them is asked for.
+func planAnswerFormat() (*openai.ChatCompletionResponseFormat, error) {
+	schema, err := PlanSchema(PlanSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	var plan map[string]interface{}
+	if err := json.Unmarshal(schema, &plan); err != nil {
+		return nil, fmt.Errorf("failed to decode the plan schema: %w", err)
+	}
+	definitions := plan["$defs"]
+	delete(plan, "$schema")
+	delete(plan, "$id")
+	delete(plan, "$defs")
+	if properties, ok := plan["properties"].(map[string]interface{}); ok {
+		delete(properties, "security_report")
+		delete(properties, "template")
+		delete(properties, "required_approvals")
+		delete(properties, "overlays")
+		delete(properties, "warnings")
+	}
+
+	envelope, err := json.Marshal(map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"answer", "deployment_plan"},
+		"properties": map[string]interface{}{
+			"answer":          map[string]interface{}{"type": "string", "description": "The answer to the query in Markdown"},
+			"deployment_plan": plan,
+		},
+		"$defs": definitions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the answer schema: %w", err)
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:        "deployment_answer",
+			Description: "An answer with a deployment plan following the DeploymentPlan schema " + PlanSchemaVersion,
+			Schema:      json.RawMessage(envelope),
+		},
+	}, nil
+}
+
+// responseFormatKey scopes a response format to the completions of a context
+type responseFormatKey struct{}
+
+// withResponseFormat makes completions under ctx request the given format
+func withResponseFormat(ctx context.Context, format *openai.ChatCompletionResponseFormat) context.Context {
+	return context.WithValue(ctx, responseFormatKey{}, format)
+}
@@ -0,0 +1,406 @@
+package agent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StackProfile is a stack the agent deploys from a curated chart list instead
+// of a chart search, like "deploy loki logging". The profiles make up the
+// stack catalog, each a versioned template of charts and their values.
+type StackProfile struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// Category groups the profile in the catalog, one of CatalogCategories
+	Category string `json:"category"`
+	// Version is the version of the template, raised whenever its charts or
+	// values change
+	Version string `json:"version"`
+	// Keywords name the stack in queries; any of them selects the profile
+	Keywords []string `json:"keywords"`
+	// Instructions are added to the system prompt of queries about the stack
+	Instructions string         `json:"-"`
+	Namespace    string         `json:"namespace"`
+	Charts       []ProfileChart `json:"charts"`
+	// Datasource is the Grafana datasource the stack serves, provisioned into
+	// the cluster's Grafana once the stack is deployed
+	Datasource *ProfileDatasource `json:"datasource,omitempty"`
+	// Organization is the organization that published the template; the
+	// platform's curated templates have none
+	Organization string `json:"organization,omitempty"`
+	// MandatoryValues are values by chart name that plans of the stack always
+	// have, merged last so nothing overrides them
+	MandatoryValues map[string]map[string]interface{} `json:"mandatory_values,omitempty"`
+	// RequiredApprovals is how many different reviewers must approve plans of
+	// the stack before they deploy
+	RequiredApprovals int `json:"required_approvals,omitempty"`
+}
+
+// Template names the profile and its version, as plans created from it record
+func (p *StackProfile) Template() string {
+	return p.Name + "@" + p.Version
+}
+
+// ProfileChart is a chart of a stack profile, pinned to a version tested with
+// the profile's values
+type ProfileChart struct {
+	Name        string                 `json:"name"`
+	Repository  string                 `json:"repository"`
+	Version     string                 `json:"version"`
+	ReleaseName string                 `json:"release_name"`
+	Description string                 `json:"description"`
+	Values      map[string]interface{} `json:"values"`
+	// DependsOn names the releases installed before this chart
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// ProfileDatasource is a Grafana datasource served by a stack profile
+type ProfileDatasource struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Chart is the release serving the datasource at URL
+	Chart string `json:"chart"`
+	URL   string `json:"url"`
+}
+
+// Catalog categories
+const (
+	CategoryMonitoring  = "monitoring"
+	CategoryLogging     = "logging"
+	CategoryTracing     = "tracing"
+	CategoryCI          = "ci"
+	CategoryServiceMesh = "service-mesh"
+)
+
+// CatalogCategories are the categories of the stack catalog, in the order it
+// lists them
+var CatalogCategories = []string{CategoryMonitoring, CategoryLogging, CategoryTracing, CategoryCI, CategoryServiceMesh}
+
+// grafanaChartRepository hosts the Grafana, Loki and Promtail charts
+const grafanaChartRepository = "https://grafana.github.io/helm-charts"
+
+// lokiNamespace is where the Loki profile installs its charts
+const lokiNamespace = "logging"
+
+// lokiGatewayURL is the in-cluster URL of the gateway of the Loki release
+var lokiGatewayURL = fmt.Sprintf("http://loki-gateway.%s.svc.cluster.local", lokiNamespace)
+
+// tracingNamespace is where the Tempo profile installs its chart
+const tracingNamespace = "tracing"
+
+// tempoURL is the in-cluster URL of the query frontend of the Tempo release
+var tempoURL = fmt.Sprintf("http://tempo.%s.svc.cluster.local:3100", tracingNamespace)
+
+// istioChartRepository hosts the Istio charts
+const istioChartRepository = "https://istio-release.storage.googleapis.com/charts"
+
+// StackProfiles are the named stacks the agent recognizes. Queries naming
+// several stacks get the first one listed.
+var StackProfiles = []StackProfile{
+	{
+		Name:        "loki",
+		Title:       "Loki Logging",
+		Description: "Loki in single binary mode storing logs on a persistent volume, with Promtail shipping the logs of every pod and a Loki datasource in Grafana",
+		Category:    CategoryLogging,
+		Version:     "1.0.0",
+		Keywords:    []string{"loki", "promtail"},
+		Instructions: `
+- Deploy Loki in single binary mode with filesystem storage on a persistent volume, it needs no object storage
+- Ship pod logs with Promtail running as a DaemonSet, pushing to the Loki gateway
+- Reuse the cluster's Grafana and add Loki as a datasource; only install Grafana when the cluster has none
+- Disable Loki's self-monitoring, canary and Helm test, they need the Grafana Agent operator
+- Query logs with LogQL in Grafana Explore, e.g. {namespace="default"} |= "error"`,
+		Namespace: lokiNamespace,
+		Charts: []ProfileChart{
+			{
+				Name:        "loki",
+				Repository:  grafanaChartRepository,
+				Version:     "5.47.2",
+				ReleaseName: "loki",
+				Description: "Loki log aggregation in single binary mode",
+				Values: map[string]interface{}{
+					"loki": map[string]interface{}{
+						"auth_enabled": false,
+						"commonConfig": map[string]interface{}{"replication_factor": 1},
+						"storage":      map[string]interface{}{"type": "filesystem"},
+					},
+					"singleBinary": map[string]interface{}{
+						"replicas":    1,
+						"persistence": map[string]interface{}{"enabled": true, "size": "10Gi"},
+					},
+					"monitoring": map[string]interface{}{
+						"selfMonitoring": map[string]interface{}{
+							"enabled":      false,
+							"grafanaAgent": map[string]interface{}{"installOperator": false},
+						},
+						"lokiCanary": map[string]interface{}{"enabled": false},
+					},
+					"test": map[string]interface{}{"enabled": false},
+				},
+			},
+			{
+				Name:        "promtail",
+				Repository:  grafanaChartRepository,
+				Version:     "6.15.5",
+				ReleaseName: "promtail",
+				Description: "Promtail shipping the logs of every pod to Loki",
+				Values: map[string]interface{}{
+					"config": map[string]interface{}{
+						"clients": []interface{}{
+							map[string]interface{}{"url": lokiGatewayURL + "/loki/api/v1/push"},
+						},
+					},
+				},
+				DependsOn: []string{"loki"},
+			},
+		},
+		Datasource: &ProfileDatasource{Name: "Loki", Type: "loki", Chart: "loki", URL: lokiGatewayURL},
+	},
+	{
+		Name:        "tempo",
+		Title:       "Tempo Tracing",
+		Description: "Grafana Tempo in monolithic mode receiving OTLP traces, storing them on a persistent volume for three days, with a Tempo datasource in Grafana",
+		Category:    CategoryTracing,
+		Version:     "1.0.0",
+		Keywords:    []string{"tempo", "tracing", "distributed traces"},
+		Instructions: `
+- Deploy Tempo in monolithic mode with local storage on a persistent volume, it needs no object storage
+- Receive traces over OTLP on gRPC port 4317 and HTTP port 4318; point OpenTelemetry SDKs and collectors at the tempo service
+- Keep traces for 72 hours
+- Reuse the cluster's Grafana and add Tempo as a datasource; only install Grafana when the cluster has none
+- Search traces with TraceQL in Grafana Explore, e.g. {resource.service.name="checkout" && duration > 500ms}`,
+		Namespace: tracingNamespace,
+		Charts: []ProfileChart{
+			{
+				Name:        "tempo",
+				Repository:  grafanaChartRepository,
+				Version:     "1.10.1",
+				ReleaseName: "tempo",
+				Description: "Tempo trace storage in monolithic mode",
+				Values: map[string]interface{}{
+					"tempo": map[string]interface{}{
+						"retention": "72h",
+						"receivers": map[string]interface{}{
+							"otlp": map[string]interface{}{
+								"protocols": map[string]interface{}{
+									"grpc": map[string]interface{}{"endpoint": "0.0.0.0:4317"},
+									"http": map[string]interface{}{"endpoint": "0.0.0.0:4318"},
+								},
+							},
+						},
+					},
+					"persistence": map[string]interface{}{"enabled": true, "size": "10Gi"},
+				},
+			},
+		},
+		Datasource: &ProfileDatasource{Name: "Tempo", Type: "tempo", Chart: "tempo", URL: tempoURL},
+	},
+	{
+		Name:        "kube-prometheus",
+		Title:       "Prometheus Monitoring",
+		Description: "kube-prometheus-stack: the Prometheus Operator with Prometheus, Alertmanager, node exporter, kube-state-metrics and Grafana with the Kubernetes dashboards, keeping metrics for 15 days",
+		Category:    CategoryMonitoring,
+		Version:     "1.0.0",
+		Keywords:    []string{"kube-prometheus", "prometheus", "monitoring stack", "alertmanager"},
+		Instructions: `
+- Deploy kube-prometheus-stack, which runs the Prometheus Operator, Prometheus, Alertmanager, node exporter, kube-state-metrics and Grafana
+- Let Prometheus pick up the ServiceMonitors and PodMonitors of every release, not only those labeled for this one
+- Keep metrics for 15 days on a 50Gi persistent volume, and Alertmanager state on a 5Gi one
+- Grafana comes with the Prometheus datasource and the Kubernetes dashboards provisioned
+- Add alerting rules as PrometheusRule objects and scrape targets as ServiceMonitors`,
+		Namespace: "monitoring",
+		Charts: []ProfileChart{
+			{
+				Name:        "kube-prometheus-stack",
+				Repository:  "https://prometheus-community.github.io/helm-charts",
+				Version:     "58.7.2",
+				ReleaseName: "kube-prometheus-stack",
+				Description: "Prometheus Operator, Prometheus, Alertmanager and Grafana",
+				Values: map[string]interface{}{
+					"prometheus": map[string]interface{}{
+						"prometheusSpec": map[string]interface{}{
+							"retention": "15d",
+							"serviceMonitorSelectorNilUsesHelmValues": false,
+							"podMonitorSelectorNilUsesHelmValues":     false,
+							"ruleSelectorNilUsesHelmValues":           false,
+							"storageSpec":                             volumeClaimTemplate("50Gi"),
+						},
+					},
+					"alertmanager": map[string]interface{}{
+						"alertmanagerSpec": map[string]interface{}{
+							"storage": volumeClaimTemplate("5Gi"),
+						},
+					},
+					"grafana": map[string]interface{}{
+						"persistence":              map[string]interface{}{"enabled": true, "size": "5Gi"},
+						"defaultDashboardsEnabled": true,
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        "istio",
+		Title:       "Istio Service Mesh",
+		Description: "Istio's CRDs and istiod control plane with autoscaling, access logging to stdout and sidecar injection for labeled namespaces",
+		Category:    CategoryServiceMesh,
+		Version:     "1.0.0",
+		Keywords:    []string{"istio", "service mesh", "service-mesh"},
+		Instructions: `
+- Install Istio's base chart with its CRDs first, then istiod in istio-system
+- Enable sidecar injection per namespace with the istio-injection=enabled label, workloads need a restart to get sidecars
+- Turn on strict mTLS with a PeerAuthentication once every workload of a namespace has a sidecar
+- Access logs go to the sidecars' stdout
+- Install an ingress gateway separately only when traffic enters through the mesh`,
+		Namespace: "istio-system",
+		Charts: []ProfileChart{
+			{
+				Name:        "base",
+				Repository:  istioChartRepository,
+				Version:     "1.22.3",
+				ReleaseName: "istio-base",
+				Description: "Istio CRDs and cluster roles",
+				Values: map[string]interface{}{
+					"defaultRevision": "default",
+				},
+			},
+			{
+				Name:        "istiod",
+				Repository:  istioChartRepository,
+				Version:     "1.22.3",
+				ReleaseName: "istiod",
+				Description: "Istio control plane",
+				Values: map[string]interface{}{
+					"pilot": map[string]interface{}{
+						"autoscaleEnabled": true,
+						"resources": map[string]interface{}{
+							"requests": map[string]interface{}{"cpu": "200m", "memory": "512Mi"},
+						},
+					},
+					"meshConfig": map[string]interface{}{"accessLogFile": "/dev/stdout"},
+				},
+				DependsOn: []string{"istio-base"},
+			},
+		},
+	},
+	{
+		Name:        "jenkins",
+		Title:       "Jenkins CI",
+		Description: "Jenkins controller with configuration as code, persistent job history and build agents started as pods on demand",
+		Category:    CategoryCI,
+		Version:     "1.0.0",
+		Keywords:    []string{"jenkins", "ci/cd", "ci pipeline", "continuous integration"},
+		Instructions: `
+- Deploy the Jenkins controller from the official chart, configured as code (JCasC) so its setup survives restarts
+- Run builds on Kubernetes agent pods started on demand, never on the controller
+- Keep job history and plugins on an 8Gi persistent volume
+- Read the generated admin password from the jenkins secret, and add credentials as Kubernetes secrets rather than through the UI`,
+		Namespace: "ci",
+		Charts: []ProfileChart{
+			{
+				Name:        "jenkins",
+				Repository:  "https://charts.jenkins.io",
+				Version:     "5.1.18",
+				ReleaseName: "jenkins",
+				Description: "Jenkins controller with Kubernetes build agents",
+				Values: map[string]interface{}{
+					"controller": map[string]interface{}{
+						"numExecutors": 0,
+						"JCasC":        map[string]interface{}{"defaultConfig": true},
+						"resources": map[string]interface{}{
+							"requests": map[string]interface{}{"cpu": "500m", "memory": "1Gi"},
+							"limits":   map[string]interface{}{"cpu": "2", "memory": "4Gi"},
+						},
+					},
+					"agent":       map[string]interface{}{"enabled": true},
+					"persistence": map[string]interface{}{"enabled": true, "size": "8Gi"},
+				},
+			},
+		},
+	},
+}
+
+// volumeClaimTemplate is the storage spec of Prometheus Operator resources
+// claiming a ReadWriteOnce volume of size
+func volumeClaimTemplate(size string) map[string]interface{} {
+	return map[string]interface{}{
+		"volumeClaimTemplate": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"accessModes": []interface{}{"ReadWriteOnce"},
+				"resources": map[string]interface{}{
+					"requests": map[string]interface{}{"storage": size},
+				},
+			},
+		},
+	}
+}
+
+// CatalogTemplates returns the stack profiles of a catalog category, or all
+// of them without one
+func CatalogTemplates(category string) []StackProfile {
+	templates := []StackProfile{}
+	for _, profile := range StackProfiles {
+		if category == "" || profile.Category == category {
+			templates = append(templates, profile)
+		}
+	}
+	return templates
+}
+
+// CatalogTemplate returns the stack profile of a catalog template, or nil
+func CatalogTemplate(name string) *StackProfile {
+	for i := range StackProfiles {
+		if StackProfiles[i].Name == name {
+			return &StackProfiles[i]
+		}
+	}
+	return nil
+}
+
+// MatchStackProfile returns the profile of the stack a query names, or nil.
+// The organization's templates are matched before the curated profiles.
+func MatchStackProfile(query string, templates []StackProfile) *StackProfile {
+	query = strings.ToLower(query)
+	for _, profiles := range [][]StackProfile{templates, StackProfiles} {
+		for i := range profiles {
+			for _, keyword := range profiles[i].Keywords {
+				if strings.Contains(query, strings.ToLower(keyword)) {
+					return &profiles[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// stackProfilePromptSection tells the model how the platform deploys a named
+// stack, so its answer matches the plan built from the profile
+func stackProfilePromptSection(profile *StackProfile) string {
+	var charts []string
+	for _, chart := range profile.Charts {
+		charts = append(charts, fmt.Sprintf("- %s %s from %s (release %s in namespace %s)", chart.Name, chart.Version, chart.Repository, chart.ReleaseName, profile.Namespace))
+	}
+	source := "its catalog template"
+	if profile.Organization != "" {
+		source = fmt.Sprintf("the template %s publishes", profile.Organization)
+	}
+	section := fmt.Sprintf(`
+
+SPECIFIC INSTRUCTIONS FOR THE %s STACK:
+The platform deploys this stack from version %s of %s, with these curated charts:
+%s%s`, strings.ToUpper(profile.Title), profile.Version, source, strings.Join(charts, "\n"), profile.Instructions)
+	if len(profile.MandatoryValues) > 0 {
+		charts := make([]string, 0, len(profile.MandatoryValues))
+		for chart := range profile.MandatoryValues {
+			charts = append(charts, chart)
+		}
+		sort.Strings(charts)
+		section += "\n- The organization requires values on these charts that can't be changed: " + strings.Join(charts, ", ")
+	}
+	if profile.RequiredApprovals > 1 {
+		section += fmt.Sprintf("\n- Plans of this stack need %d approvals before they deploy", profile.RequiredApprovals)
+	}
+	return section
+}
@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StepGraph is the dependency graph of a deployment's steps, for display
+type StepGraph struct {
+	Nodes []StepGraphNode `json:"nodes"`
+	Edges []StepGraphEdge `json:"edges"`
+}
+
+// StepGraphNode is a step of a StepGraph. Level is the length of the longest
+// chain of dependencies leading to the step; steps of a level can run together.
+type StepGraphNode struct {
+	StepID    string   `json:"step_id"`
+	Status    string   `json:"status,omitempty"`
+	DependsOn []string `json:"depends_on"`
+	Level     int      `json:"level"`
+}
+
+// StepGraphEdge says step To waits for step From
+type StepGraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// StepDependencies returns the indexes of the steps each step of a plan waits
+// for. Plans that declare no dependencies run their steps in order, each
+// waiting for the one before it. Unknown steps and cycles are errors.
+func StepDependencies(steps []DeploymentStep) ([][]int, error) {
+	ids := make([]string, len(steps))
+	dependsOn := make([][]string, len(steps))
+	for i, step := range steps {
+		ids[i] = step.ID
+		dependsOn[i] = step.DependsOn
+	}
+	return dependencyIndexes(ids, dependsOn)
+}
+
+// Graph returns the dependency graph of an execution's steps and their state
+func (e *DeploymentExecution) Graph() (*StepGraph, error) {
+	ids := make([]string, len(e.Steps))
+	dependsOn := make([][]string, len(e.Steps))
+	for i, step := range e.Steps {
+		ids[i] = step.StepID
+		dependsOn[i] = step.DependsOn
+	}
+	dependencies, err := dependencyIndexes(ids, dependsOn)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &StepGraph{Nodes: make([]StepGraphNode, len(e.Steps)), Edges: []StepGraphEdge{}}
+	levels := dependencyLevels(dependencies)
+	for i, step := range e.Steps {
+		node := StepGraphNode{StepID: step.StepID, Status: step.Status, DependsOn: []string{}, Level: levels[i]}
+		for _, dependency := range dependencies[i] {
+			node.DependsOn = append(node.DependsOn, ids[dependency])
+			graph.Edges = append(graph.Edges, StepGraphEdge{From: ids[dependency], To: step.StepID})
+		}
+		graph.Nodes[i] = node
+	}
+	return graph, nil
+}
+
+// dependencyIndexes resolves the step IDs each step depends on to indexes
+func dependencyIndexes(ids []string, dependsOn [][]string) ([][]int, error) {
+	dependencies := make([][]int, len(ids))
+	declared := false
+	for _, names := range dependsOn {
+		declared = declared || len(names) > 0
+	}
+	if !declared {
+		for i := 1; i < len(ids); i++ {
+			dependencies[i] = []int{i - 1}
+		}
+		return dependencies, nil
+	}
+
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		if _, ok := index[id]; ok {
+			return nil, fmt.Errorf("several steps have ID %s", id)
+		}
+		index[id] = i
+	}
+	for i, names := range dependsOn {
+		seen := make(map[int]bool, len(names))
+		for _, name := range names {
+			dependency, ok := index[name]
+			switch {
+			case !ok:
+				return nil, fmt.Errorf("step %s depends on unknown step %s", ids[i], name)
+			case dependency == i:
+				return nil, fmt.Errorf("step %s depends on itself", ids[i])
+			case seen[dependency]:
+				continue
+			}
+			seen[dependency] = true
+			dependencies[i] = append(dependencies[i], dependency)
+		}
+	}
+
+	if cycle := dependencyCycle(ids, dependencies); cycle != nil {
+		return nil, fmt.Errorf("steps depend on each other in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+	return dependencies, nil
+}
+
+// dependencyCycle returns the steps of a dependency cycle, the first repeated
+// at the end, or nil when the graph has none
+func dependencyCycle(ids []string, dependencies [][]int) []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(ids))
+	var path []int
+	var visit func(int) []string
+	visit = func(i int) []string {
+		state[i] = visiting
+		path = append(path, i)
+		for _, dependency := range dependencies[i] {
+			switch state[dependency] {
+			case visiting:
+				var cycle []string
+				for j := len(path) - 1; j >= 0; j-- {
+					cycle = append([]string{ids[path[j]]}, cycle...)
+					if path[j] == dependency {
+						break
+					}
+				}
+				return append(cycle, ids[dependency])
+			case unvisited:
+				if cycle := visit(dependency); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range ids {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+// dependencyLevels returns the level of each step of an acyclic graph
+func dependencyLevels(dependencies [][]int) []int {
+	levels := make([]int, len(dependencies))
+	done := make([]bool, len(dependencies))
+	var level func(int) int
+	level = func(i int) int {
+		if done[i] {
+			return levels[i]
+		}
+		for _, dependency := range dependencies[i] {
+			if l := level(dependency) + 1; l > levels[i] {
+				levels[i] = l
+			}
+		}
+		done[i] = true
+		return levels[i]
+	}
+	for i := range dependencies {
+		level(i)
+	}
+	return levels
+}
@@ -3,28 +3,66 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	Server     ServerConfig
-	Database   DatabaseConfig
-	JWT        JWTConfig
-	OpenAI     OpenAIConfig
-	OpenRouter OpenRouterConfig
+	Server      ServerConfig
+	Database    DatabaseConfig
+	JWT         JWTConfig
+	OpenAI      OpenAIConfig
+	OpenRouter  OpenRouterConfig
+	Ollama      OllamaConfig
+	ArtifactHub ArtifactHubConfig
+	Offline     OfflineConfig
+	Admin       AdminConfig
+	LLM         LLMConfig
+	CORS        CORSConfig
+	Watch       WatchConfig
+	Scheduler   SchedulerConfig
+	SMTP        SMTPConfig
+	Analytics   AnalyticsConfig
+	Knowledge   KnowledgeConfig
+	Health      HealthConfig
+	Cost        CostConfig
+	Secrets     SecretsConfig
+	QueryCache  QueryCacheConfig
+	Deployment  DeploymentConfig
+	Workers     WorkersConfig
+	Connector   ConnectorConfig
+	Tracing     TracingConfig
+	Slack       SlackConfig
 }
 
 type ServerConfig struct {
 	Port string
 	Host string
+	// Environment is production or development
+	Environment string
+}
+
+// Production reports whether the server runs in production
+func (c ServerConfig) Production() bool {
+	return c.Environment == "production"
 }
 
 type DatabaseConfig struct {
+	// Driver is postgres, mysql or sqlite
+	Driver   string
 	Host     string
 	Port     string
 	User     string
 	Password string
 	DBName   string
 	SSLMode  string
+	// Path is the database file of the sqlite driver
+	Path string
+	// AutoMigrate applies pending schema migrations at startup. Destructive
+	// migrations are never applied at startup in production.
+	AutoMigrate bool
+	// ReplicaDSNs are read replicas that serve history and analytics queries
+	ReplicaDSNs []string
 }
 
 type JWTConfig struct {
@@ -39,19 +77,240 @@ type OpenRouterConfig struct {
 	APIKey string
 }
 
+// OllamaConfig is a local Ollama server serving models through its
+// OpenAI-compatible API
+type OllamaConfig struct {
+	URL string
+}
+
+type ArtifactHubConfig struct {
+	URL string
+}
+
+// OfflineConfig runs the platform in networks without internet access
+type OfflineConfig struct {
+	// Enabled blocks every call to services outside the network: OpenAI,
+	// OpenRouter, Artifact Hub, chart repositories and image registries are
+	// only reached on AllowedHosts
+	Enabled bool
+	// AllowedHosts are the hosts inside the network calls may still reach,
+	// e.g. an internal Artifact Hub or registry
+	AllowedHosts []string
+	// ChartMirrors maps chart repository URLs to the internal mirrors helm
+	// pulls their charts from, offline or not
+	ChartMirrors map[string]string
+}
+
+// LLMConfig selects the models the agent uses and bounds load on the
+// LLM-backed endpoints
+type LLMConfig struct {
+	// Provider serves models without a provider prefix: openrouter, openai or ollama
+	Provider string
+	Model    string
+	// FallbackModels are tried in order when a model is rate limited or fails
+	// with a server error; "openai:" and "openrouter:" prefixes pick the provider
+	FallbackModels []string
+	// SelectableModels may be selected per query besides Model and the fallbacks
+	SelectableModels []string
+	// ModelPricesFile is a JSON file of prices per million tokens, by model
+	ModelPricesFile string
+	MaxConcurrent   int
+	MaxQueue        int
+	QueueTimeout    time.Duration
+	// RequestTimeout bounds each completion attempt, MaxPromptChars the
+	// prompt of queries and MaxResponseTokens the replies
+	RequestTimeout    time.Duration
+	MaxPromptChars    int
+	MaxResponseTokens int
+	// CircuitThreshold consecutive failures of a model stop its completions
+	// for CircuitCooldown; 0 disables circuit breaking
+	CircuitThreshold int
+	CircuitCooldown  time.Duration
+}
+
+// CORSConfig controls which browser origins may call the API
+type CORSConfig struct {
+	// AllowedOrigins may contain "*" wildcards, e.g. https://*.example.com
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration
+}
+
+// WatchConfig controls the built-in cluster alerting that runs without Prometheus
+type WatchConfig struct {
+	Enabled           bool
+	Interval          time.Duration
+	PVCPendingAfter   time.Duration
+	CrashLoopRestarts int
+	// Events keeps an informer cache of each cluster's events instead of listing them per request
+	Events bool
+}
+
+// HealthConfig controls the background connectivity checks of stored clusters
+type HealthConfig struct {
+	Enabled  bool
+	Interval time.Duration
+	// FailureThreshold consecutive failed checks mark a cluster inactive
+	FailureThreshold int
+	// Retention is how long check history is kept
+	Retention time.Duration
+}
+
+// SchedulerConfig controls the runner of scheduled deployments
+type SchedulerConfig struct {
+	Enabled bool
+	// Interval is how often due schedules are checked
+	Interval time.Duration
+}
+
+// SMTPConfig is the mail server email notification channels send through
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// AnalyticsConfig selects the optional sink for high-volume analytical data:
+// platform events, cluster metrics snapshots and LLM token usage
+type AnalyticsConfig struct {
+	// Sink is clickhouse or timescaledb; empty keeps analytics off
+	Sink string
+	DSN  string
+	// BatchSize rows are written at once, and pending rows at least every FlushInterval
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// KnowledgeConfig controls the runbook knowledge base queries are grounded in
+type KnowledgeConfig struct {
+	// EmbeddingModel embeds documents and queries. Changing it requires
+	// re-uploading the documents, as embeddings of different models don't compare.
+	EmbeddingModel string
+	// TopK runbook passages are added to each agent query
+	TopK int
+}
+
+// CostConfig prices the resources plans request, per month
+type CostConfig struct {
+	Currency       string
+	CPUCoreMonth   float64
+	MemoryGBMonth  float64
+	StorageGBMonth float64
+	// PriceSheetFile is a JSON file of pricing per cloud provider, used on
+	// clusters detected to run on that provider
+	PriceSheetFile string
+}
+
+// QueryCacheConfig controls the cache of agent answers
+type QueryCacheConfig struct {
+	// TTL is how long answers are reused; 0 disables the cache
+	TTL time.Duration
+	// Size bounds the entries of the in-memory cache
+	Size int
+	// RedisURL keeps the cache in Redis, shared by replicas, instead of in memory
+	RedisURL string
+}
+
+// SecretsConfig configures the stores secret references in chart values
+// resolve against besides the target cluster's Kubernetes Secrets
+type SecretsConfig struct {
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+	// SOPSDir holds the SOPS-encrypted files ref+sops:// references name
+	SOPSDir string
+}
+
+// DeploymentConfig controls how deployment plans are executed
+type DeploymentConfig struct {
+	// StepConcurrency limits the steps of a deployment that run at once, when
+	// the plan's step dependencies let them run in parallel
+	StepConcurrency int
+	// LockTTL is how long a deployment's cluster namespace locks last unless
+	// the deployment refreshes them, should its replica stop
+	LockTTL time.Duration
+	// LockWait is how long a deployment waits for namespaces another one is
+	// deploying to; 0 rejects it right away
+	LockWait time.Duration
+	// LockRedisURL keeps the locks in Redis; in the database when empty
+	LockRedisURL string
+}
+
+// WorkersConfig controls the workers running queued deployments
+type WorkersConfig struct {
+	// Embedded runs workers in the API process too; disable it to run them
+	// only with the worker command
+	Embedded bool
+	// Concurrency is how many jobs a worker runs at once
+	Concurrency int
+	// PollInterval is how often idle workers look for queued jobs
+	PollInterval time.Duration
+	// HeartbeatInterval is how often workers report that they are alive
+	HeartbeatInterval time.Duration
+	// DeadAfter is how long after its last heartbeat a worker's jobs are requeued
+	DeadAfter time.Duration
+	// MaxAttempts is how many workers may start a job before it fails
+	MaxAttempts int
+}
+
+// ConnectorConfig controls clusters onboarded with the in-cluster connector
+type ConnectorConfig struct {
+	// PublicURL is the platform URL connectors dial out to; by default the URL
+	// the manifest was requested on
+	PublicURL string
+	// ProxyAddr is the loopback address the kubeconfigs of connector clusters
+	// point at, proxied through the connectors' tunnels
+	ProxyAddr string
+	// Image runs the connector, the backend image by default
+	Image string
+}
+
+// SlackConfig configures the Slack app the /k8s-agent slash command comes from
+type SlackConfig struct {
+	// SigningSecret verifies the app's requests; the integration is off without it
+	SigningSecret string
+}
+
+// TracingConfig controls the OpenTelemetry traces of the backend
+type TracingConfig struct {
+	// Endpoint is the OTLP/HTTP collector spans are exported to; tracing is
+	// disabled without one
+	Endpoint    string
+	ServiceName string
+	// SampleRatio is the share of traces started by the backend that are
+	// recorded, from 0 to 1
+	SampleRatio float64
+}
+
+type AdminConfig struct {
+	// Emails of users allowed to use the /api/admin endpoints
+	Emails []string
+}
+
 func LoadConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
-			Host: getEnv("HOST", "localhost"),
+			Port:        getEnv("PORT", "8080"),
+			Host:        getEnv("HOST", "localhost"),
+			Environment: getEnv("APP_ENV", "development"),
 		},
 		Database: DatabaseConfig{
-			Host:     getEnv("DB_HOST", "localhost"),
-			Port:     getEnv("DB_PORT", "5432"),
-			User:     getEnv("DB_USER", "postgres"),
-			Password: getEnv("DB_PASSWORD", "password"),
-			DBName:   getEnv("DB_NAME", "kubernetes_ai_platform"),
-			SSLMode:  getEnv("DB_SSLMODE", "disable"),
+			Driver:      getEnv("DB_DRIVER", "postgres"),
+			Host:        getEnv("DB_HOST", "localhost"),
+			Port:        getEnv("DB_PORT", defaultDatabasePort(getEnv("DB_DRIVER", "postgres"))),
+			User:        getEnv("DB_USER", "postgres"),
+			Password:    getEnv("DB_PASSWORD", "password"),
+			DBName:      getEnv("DB_NAME", "kubernetes_ai_platform"),
+			SSLMode:     getEnv("DB_SSLMODE", "disable"),
+			Path:        getEnv("DB_PATH", "grafana-ai-agent-platform.db"),
+			AutoMigrate: getEnvAsBool("DB_AUTO_MIGRATE", true),
+			// Semicolon-separated, since key/value DSNs may not contain semicolons but do contain spaces
+			ReplicaDSNs: getEnvAsListSep("DB_REPLICA_DSNS", ";"),
 		},
 		JWT: JWTConfig{
 			Secret: getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
@@ -62,9 +321,135 @@ func LoadConfig() *Config {
 		OpenRouter: OpenRouterConfig{
 			APIKey: getEnv("OPENROUTER_KEY", ""),
 		},
+		Ollama: OllamaConfig{
+			URL: getEnv("OLLAMA_URL", ""),
+		},
+		ArtifactHub: ArtifactHubConfig{
+			URL: getEnv("ARTIFACT_HUB_URL", "https://artifacthub.io"),
+		},
+		Offline: OfflineConfig{
+			Enabled:      getEnvAsBool("OFFLINE_MODE", false),
+			AllowedHosts: getEnvAsList("OFFLINE_ALLOWED_HOSTS"),
+			ChartMirrors: getEnvAsMap("CHART_REPO_MIRRORS"),
+		},
+		Admin: AdminConfig{
+			Emails: getEnvAsList("ADMIN_EMAILS"),
+		},
+		LLM: LLMConfig{
+			Provider:          getEnv("LLM_PROVIDER", "openrouter"),
+			Model:             getEnv("LLM_MODEL", "deepseek/deepseek-chat-v3.1:free"),
+			FallbackModels:    getEnvAsList("LLM_FALLBACK_MODELS"),
+			SelectableModels:  getEnvAsList("LLM_SELECTABLE_MODELS"),
+			ModelPricesFile:   getEnv("LLM_MODEL_PRICES_FILE", ""),
+			MaxConcurrent:     getEnvAsInt("LLM_MAX_CONCURRENT", 8),
+			MaxQueue:          getEnvAsInt("LLM_MAX_QUEUE", 32),
+			QueueTimeout:      time.Duration(getEnvAsInt("LLM_QUEUE_TIMEOUT_SECONDS", 30)) * time.Second,
+			RequestTimeout:    time.Duration(getEnvAsInt("LLM_REQUEST_TIMEOUT_SECONDS", 120)) * time.Second,
+			MaxPromptChars:    getEnvAsInt("LLM_MAX_PROMPT_CHARS", 60000),
+			MaxResponseTokens: getEnvAsInt("LLM_MAX_RESPONSE_TOKENS", 4000),
+			CircuitThreshold:  getEnvAsInt("LLM_CIRCUIT_FAILURE_THRESHOLD", 5),
+			CircuitCooldown:   time.Duration(getEnvAsInt("LLM_CIRCUIT_COOLDOWN_SECONDS", 30)) * time.Second,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: getEnvAsListDefault("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000"}),
+			AllowedMethods: getEnvAsListDefault("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+			AllowedHeaders: getEnvAsListDefault("CORS_ALLOWED_HEADERS", []string{
+				"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization",
+				"Accept", "Origin", "Cache-Control", "X-Requested-With",
+			}),
+			AllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", true),
+			MaxAge:           time.Duration(getEnvAsInt("CORS_MAX_AGE_SECONDS", 600)) * time.Second,
+		},
+		Watch: WatchConfig{
+			Enabled:           getEnvAsBool("CLUSTER_WATCH_ENABLED", true),
+			Interval:          time.Duration(getEnvAsInt("CLUSTER_WATCH_INTERVAL_SECONDS", 30)) * time.Second,
+			PVCPendingAfter:   time.Duration(getEnvAsInt("ALERT_PVC_PENDING_MINUTES", 10)) * time.Minute,
+			CrashLoopRestarts: getEnvAsInt("ALERT_CRASHLOOP_RESTARTS", 5),
+			Events:            getEnvAsBool("CLUSTER_WATCH_EVENTS", false),
+		},
+		Health: HealthConfig{
+			Enabled:          getEnvAsBool("CLUSTER_HEALTH_ENABLED", true),
+			Interval:         time.Duration(getEnvAsInt("CLUSTER_HEALTH_INTERVAL_SECONDS", 60)) * time.Second,
+			FailureThreshold: getEnvAsInt("CLUSTER_HEALTH_FAILURE_THRESHOLD", 3),
+			Retention:        time.Duration(getEnvAsInt("CLUSTER_HEALTH_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:  getEnvAsBool("SCHEDULER_ENABLED", true),
+			Interval: time.Duration(getEnvAsInt("SCHEDULER_INTERVAL_SECONDS", 30)) * time.Second,
+		},
+		SMTP: SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnvAsInt("SMTP_PORT", 587),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", "noreply@localhost"),
+		},
+		Analytics: AnalyticsConfig{
+			Sink:          getEnv("ANALYTICS_SINK", ""),
+			DSN:           getEnv("ANALYTICS_DSN", ""),
+			BatchSize:     getEnvAsInt("ANALYTICS_BATCH_SIZE", 500),
+			FlushInterval: time.Duration(getEnvAsInt("ANALYTICS_FLUSH_SECONDS", 10)) * time.Second,
+		},
+		Knowledge: KnowledgeConfig{
+			EmbeddingModel: getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+			TopK:           getEnvAsInt("KNOWLEDGE_TOP_K", 4),
+		},
+		Cost: CostConfig{
+			Currency:       getEnv("COST_CURRENCY", "USD"),
+			CPUCoreMonth:   getEnvAsFloat("COST_CPU_CORE_MONTH", 23),
+			MemoryGBMonth:  getEnvAsFloat("COST_MEMORY_GB_MONTH", 3),
+			StorageGBMonth: getEnvAsFloat("COST_STORAGE_GB_MONTH", 0.1),
+			PriceSheetFile: getEnv("COST_PRICE_SHEET_FILE", ""),
+		},
+		QueryCache: QueryCacheConfig{
+			TTL:      time.Duration(getEnvAsInt("QUERY_CACHE_TTL_SECONDS", 300)) * time.Second,
+			Size:     getEnvAsInt("QUERY_CACHE_SIZE", 1000),
+			RedisURL: getEnv("REDIS_URL", ""),
+		},
+		Secrets: SecretsConfig{
+			VaultAddr:      getEnv("VAULT_ADDR", ""),
+			VaultToken:     getEnv("VAULT_TOKEN", ""),
+			VaultNamespace: getEnv("VAULT_NAMESPACE", ""),
+			SOPSDir:        getEnv("SOPS_SECRETS_DIR", ""),
+		},
+		Deployment: DeploymentConfig{
+			StepConcurrency: getEnvAsInt("DEPLOYMENT_STEP_CONCURRENCY", 4),
+			LockTTL:         time.Duration(getEnvAsInt("DEPLOYMENT_LOCK_TTL_SECONDS", 60)) * time.Second,
+			LockWait:        time.Duration(getEnvAsInt("DEPLOYMENT_LOCK_WAIT_SECONDS", 0)) * time.Second,
+			LockRedisURL:    getEnv("REDIS_URL", ""),
+		},
+		Workers: WorkersConfig{
+			Embedded:          getEnvAsBool("WORKERS_EMBEDDED", true),
+			Concurrency:       getEnvAsInt("WORKER_CONCURRENCY", 4),
+			PollInterval:      time.Duration(getEnvAsInt("WORKER_POLL_INTERVAL_SECONDS", 1)) * time.Second,
+			HeartbeatInterval: time.Duration(getEnvAsInt("WORKER_HEARTBEAT_SECONDS", 10)) * time.Second,
+			DeadAfter:         time.Duration(getEnvAsInt("WORKER_DEAD_AFTER_SECONDS", 60)) * time.Second,
+			MaxAttempts:       getEnvAsInt("WORKER_MAX_ATTEMPTS", 3),
+		},
+		Connector: ConnectorConfig{
+			PublicURL: getEnv("CONNECTOR_PUBLIC_URL", ""),
+			ProxyAddr: getEnv("CONNECTOR_PROXY_ADDR", "127.0.0.1:8081"),
+			Image:     getEnv("CONNECTOR_IMAGE", "grafana-ai-agent-platform/backend:latest"),
+		},
+		Slack: SlackConfig{
+			SigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+		},
+		Tracing: TracingConfig{
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "grafana-ai-agent-platform"),
+			SampleRatio: getEnvAsFloat("TRACING_SAMPLE_RATIO", 1),
+		},
 	}
 }
 
+// defaultDatabasePort returns the port a database driver listens on by default
+func defaultDatabasePort(driver string) string {
+	if driver == "mysql" {
+		return "3306"
+	}
+	return "5432"
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -80,3 +465,53 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsListDefault(key string, defaultValue []string) []string {
+	if values := getEnvAsList(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
+func getEnvAsList(key string) []string {
+	return getEnvAsListSep(key, ",")
+}
+
+func getEnvAsListSep(key, sep string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), sep) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvAsMap reads comma-separated key=value pairs
+func getEnvAsMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getEnvAsList(key) {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,237 @@
+package e2e
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// FakeChart is a chart served by the fake Artifact Hub and its Helm repository
+type FakeChart struct {
+	Name        string
+	Version     string
+	AppVersion  string
+	Description string
+	// Templates maps template file names to their contents
+	Templates map[string]string
+}
+
+// DefaultChart installs a single ConfigMap, so it becomes ready on clusters
+// without controllers or nodes
+func DefaultChart() FakeChart {
+	return FakeChart{
+		Name:        "e2e-app",
+		Version:     "0.1.0",
+		AppVersion:  "1.0.0",
+		Description: "Chart used by the e2e suite",
+		Templates: map[string]string{
+			"configmap.yaml": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{ .Release.Name }}-config
+  labels:
+    app.kubernetes.io/name: {{ .Chart.Name }}
+    app.kubernetes.io/instance: {{ .Release.Name }}
+data:
+  release: {{ .Release.Name | quote }}
+  version: {{ .Chart.AppVersion | quote }}
+`,
+		},
+	}
+}
+
+// FakeArtifactHub serves the Artifact Hub search and package APIs together with
+// a Helm repository for the same charts, so plans created from its search results
+// can be installed
+type FakeArtifactHub struct {
+	Server *httptest.Server
+	charts []FakeChart
+}
+
+// NewFakeArtifactHub starts a fake Artifact Hub serving the given charts
+func NewFakeArtifactHub(charts ...FakeChart) *FakeArtifactHub {
+	hub := &FakeArtifactHub{charts: charts}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/packages/search", hub.search)
+	mux.HandleFunc("/api/v1/packages/", hub.pkg)
+	mux.HandleFunc("/charts/index.yaml", hub.index)
+	mux.HandleFunc("/charts/", hub.archive)
+	hub.Server = httptest.NewServer(mux)
+
+	return hub
+}
+
+// URL is the Artifact Hub base URL to configure the Helm service with
+func (h *FakeArtifactHub) URL() string {
+	return h.Server.URL
+}
+
+// RepositoryURL is the Helm repository serving the charts
+func (h *FakeArtifactHub) RepositoryURL() string {
+	return h.Server.URL + "/charts"
+}
+
+// Close shuts the server down
+func (h *FakeArtifactHub) Close() {
+	h.Server.Close()
+}
+
+func (h *FakeArtifactHub) packageJSON(chart FakeChart) map[string]interface{} {
+	return map[string]interface{}{
+		"package_id":  "e2e-" + chart.Name,
+		"name":        chart.Name,
+		"version":     chart.Version,
+		"app_version": chart.AppVersion,
+		"description": chart.Description,
+		"deprecated":  false,
+		"repository": map[string]interface{}{
+			"name":               "e2e",
+			"url":                h.RepositoryURL(),
+			"official":           true,
+			"verified_publisher": true,
+		},
+	}
+}
+
+// search returns every chart; the platform ranks and trims results itself
+func (h *FakeArtifactHub) search(w http.ResponseWriter, r *http.Request) {
+	packages := make([]map[string]interface{}, 0, len(h.charts))
+	for _, chart := range h.charts {
+		packages = append(packages, h.packageJSON(chart))
+	}
+	writeJSON(w, map[string]interface{}{"packages": packages})
+}
+
+// pkg serves a package at /{id}, a version of it at /{id}/{version} and the
+// version's default values at /{id}/{version}/values
+func (h *FakeArtifactHub) pkg(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/packages/"), "/")
+	for _, chart := range h.charts {
+		if "e2e-"+chart.Name != parts[0] || (len(parts) > 1 && parts[1] != chart.Version) {
+			continue
+		}
+		switch {
+		case len(parts) <= 2:
+			details := h.packageJSON(chart)
+			details["readme"] = "# " + chart.Name
+			details["values_schema"] = map[string]interface{}{}
+			writeJSON(w, details)
+		case len(parts) == 3 && parts[2] == "values":
+			w.Header().Set("Content-Type", "application/x-yaml")
+			w.Write([]byte("{}\n"))
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func (h *FakeArtifactHub) index(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	entries := make(map[string][]map[string]interface{})
+	for _, chart := range h.charts {
+		entries[chart.Name] = append(entries[chart.Name], map[string]interface{}{
+			"apiVersion":  "v2",
+			"name":        chart.Name,
+			"version":     chart.Version,
+			"appVersion":  chart.AppVersion,
+			"description": chart.Description,
+			"created":     now,
+			"urls":        []string{fmt.Sprintf("%s/%s-%s.tgz", h.RepositoryURL(), chart.Name, chart.Version)},
+		})
+	}
+
+	index, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"entries":    entries,
+		"generated":  now,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-yaml")
+	w.Write(index)
+}
+
+func (h *FakeArtifactHub) archive(w http.ResponseWriter, r *http.Request) {
+	file := strings.TrimPrefix(r.URL.Path, "/charts/")
+	for _, chart := range h.charts {
+		if file != fmt.Sprintf("%s-%s.tgz", chart.Name, chart.Version) {
+			continue
+		}
+		archive, err := packageChart(chart)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Write(archive)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// packageChart builds the chart archive helm pull expects
+func packageChart(chart FakeChart) ([]byte, error) {
+	chartYAML, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion":  "v2",
+		"name":        chart.Name,
+		"version":     chart.Version,
+		"appVersion":  chart.AppVersion,
+		"description": chart.Description,
+		"type":        "application",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		"Chart.yaml":  chartYAML,
+		"values.yaml": []byte("{}\n"),
+	}
+	for name, content := range chart.Templates {
+		files["templates/"+name] = []byte(content)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		header := &tar.Header{
+			Name:    chart.Name + "/" + name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(content); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
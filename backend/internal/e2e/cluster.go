@@ -0,0 +1,53 @@
+package e2e
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// Cluster is an envtest control plane (etcd and kube-apiserver, no nodes or
+// controllers) the platform can be pointed at like a real cluster
+type Cluster struct {
+	env        *envtest.Environment
+	Kubeconfig string
+	Clientset  *kubernetes.Clientset
+}
+
+// StartCluster starts a control plane from the binaries in KUBEBUILDER_ASSETS
+func StartCluster() (*Cluster, error) {
+	env := &envtest.Environment{}
+	config, err := env.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start envtest control plane (is KUBEBUILDER_ASSETS set?): %w", err)
+	}
+
+	cluster := &Cluster{env: env}
+
+	// The platform takes kubeconfigs, so mint an admin user and export its kubeconfig
+	user, err := env.ControlPlane.AddUser(envtest.User{Name: "e2e-admin", Groups: []string{"system:masters"}}, config)
+	if err != nil {
+		cluster.Stop()
+		return nil, fmt.Errorf("failed to create envtest user: %w", err)
+	}
+	kubeconfig, err := user.KubeConfig()
+	if err != nil {
+		cluster.Stop()
+		return nil, fmt.Errorf("failed to build kubeconfig: %w", err)
+	}
+	cluster.Kubeconfig = string(kubeconfig)
+
+	cluster.Clientset, err = kubernetes.NewForConfig(user.Config())
+	if err != nil {
+		cluster.Stop()
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	return cluster, nil
+}
+
+// Stop shuts the control plane down
+func (c *Cluster) Stop() error {
+	return c.env.Stop()
+}
@@ -0,0 +1,252 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/server"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// platform is the API running against a fake LLM and a fake Artifact Hub, on
+// a SQLite database, with a registered user
+type platform struct {
+	t       *testing.T
+	baseURL string
+	client  *http.Client
+	token   string
+	llm     *FakeLLMProvider
+	chart   FakeChart
+	// hubRepository is the Helm repository of the fake Artifact Hub
+	hubRepository string
+}
+
+// startPlatform starts the API and a deployment worker, stopped when the test ends
+func startPlatform(t *testing.T) *platform {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	chart := DefaultChart()
+	hub := NewFakeArtifactHub(chart)
+	t.Cleanup(hub.Close)
+
+	cfg := config.LoadConfig()
+	cfg.ArtifactHub.URL = hub.URL()
+	cfg.Database = config.DatabaseConfig{
+		Driver:      database.DriverSQLite,
+		Path:        filepath.Join(t.TempDir(), "platform.db"),
+		AutoMigrate: true,
+	}
+	// The test runs the worker itself so it can stop it before the database closes
+	cfg.Workers.Embedded = false
+
+	db, err := database.NewDatabase(cfg)
+	if err != nil {
+		t.Fatalf("connect to database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	llm := NewFakeLLMProvider()
+	llm.Replies["deploy "+chart.Name] = PlanReply(chart, hub.RepositoryURL())
+	aiAgent := agent.NewAIAgentWithProvider(&agent.Config{Model: "e2e"}, llm)
+
+	api := httptest.NewServer(server.NewRouter(cfg, db, aiAgent))
+	t.Cleanup(api.Close)
+	stopWorkers, err := server.StartWorkers(cfg, db, aiAgent)
+	if err != nil {
+		t.Fatalf("start workers: %v", err)
+	}
+	t.Cleanup(stopWorkers)
+
+	p := &platform{t: t, baseURL: api.URL + "/api", client: &http.Client{Timeout: 5 * time.Minute}, llm: llm, chart: chart, hubRepository: hub.RepositoryURL()}
+	p.register()
+	return p
+}
+
+func (p *platform) register() {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	p.do(http.MethodPost, "/auth/register", map[string]string{
+		"email":      "e2e@example.com",
+		"password":   "e2e-password",
+		"first_name": "E2E",
+		"last_name":  "Suite",
+	}, http.StatusCreated, &resp)
+	if resp.Token == "" {
+		p.t.Fatal("no token in register response")
+	}
+	p.token = resp.Token
+}
+
+// queryPlan asks for a deployment of the fake chart and returns the plan
+func (p *platform) queryPlan(clusterID *uint) *agent.DeploymentPlan {
+	var resp struct {
+		DeploymentPlan *agent.DeploymentPlan `json:"deployment_plan"`
+		PlanErrors     []string              `json:"plan_errors"`
+	}
+	body := map[string]interface{}{"query": "deploy " + p.chart.Name}
+	if clusterID != nil {
+		body["cluster_id"] = *clusterID
+	}
+	p.do(http.MethodPost, "/agent/query", body, http.StatusOK, &resp)
+	if len(resp.PlanErrors) > 0 {
+		p.t.Fatalf("the model's plan was rejected: %v", resp.PlanErrors)
+	}
+	if resp.DeploymentPlan == nil || len(resp.DeploymentPlan.Steps) == 0 {
+		p.t.Fatal("no deployment plan in response")
+	}
+	return resp.DeploymentPlan
+}
+
+// do sends an authenticated JSON request, checks its status and decodes the
+// response into out
+func (p *platform) do(method, path string, body interface{}, wantStatus int, out interface{}) {
+	p.t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		p.t.Fatalf("encode request: %v", err)
+	}
+	req, err := http.NewRequest(method, p.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		p.t.Fatalf("create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		p.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		p.t.Fatalf("read response of %s %s: %v", method, path, err)
+	}
+	if resp.StatusCode != wantStatus {
+		p.t.Fatalf("%s %s returned %d, want %d: %s", method, path, resp.StatusCode, wantStatus, respBody)
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			p.t.Fatalf("decode response of %s %s: %v", method, path, err)
+		}
+	}
+}
+
+// TestQueryPlansDeployment checks that a deployment query turns the model's
+// JSON answer into a stored plan installing the chart it names
+func TestQueryPlansDeployment(t *testing.T) {
+	p := startPlatform(t)
+
+	plan := p.queryPlan(nil)
+	chart := plan.Steps[0].Chart
+	if chart == nil || chart.Name != p.chart.Name {
+		t.Fatalf("plan does not install %s: %+v", p.chart.Name, plan.Steps[0])
+	}
+	if len(p.llm.Requests()) == 0 {
+		t.Fatal("the agent never called the LLM provider")
+	}
+
+	if chart.Repository != p.hubRepository {
+		t.Fatalf("plan installs %s from %s, want %s", chart.Name, chart.Repository, p.hubRepository)
+	}
+
+	// The plan was stored for the user, with no edits yet
+	var edits struct {
+		Total int `json:"total"`
+	}
+	p.do(http.MethodGet, fmt.Sprintf("/agent/plans/%s/edits", url.PathEscape(plan.ID)), nil, http.StatusOK, &edits)
+	if edits.Total != 0 {
+		t.Fatalf("new plan has %d edits", edits.Total)
+	}
+}
+
+// TestDeployToCluster deploys a plan to an envtest control plane with helm
+// and checks the chart's resources exist. It needs helm on PATH and
+// KUBEBUILDER_ASSETS; see `make e2e`.
+func TestDeployToCluster(t *testing.T) {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		t.Skip("KUBEBUILDER_ASSETS is not set, run `make e2e`")
+	}
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skipf("helm is not on PATH: %v", err)
+	}
+	cluster, err := StartCluster()
+	if err != nil {
+		t.Fatalf("start cluster: %v", err)
+	}
+	t.Cleanup(func() { cluster.Stop() })
+	p := startPlatform(t)
+
+	var added struct {
+		Cluster struct {
+			ID       uint `json:"id"`
+			IsActive bool `json:"is_active"`
+		} `json:"cluster"`
+	}
+	p.do(http.MethodPost, "/kubernetes/clusters", map[string]string{
+		"name":        "e2e",
+		"kube_config": cluster.Kubeconfig,
+	}, http.StatusCreated, &added)
+	if !added.Cluster.IsActive {
+		t.Fatalf("cluster %d was added as inactive", added.Cluster.ID)
+	}
+	clusterID := added.Cluster.ID
+
+	plan := p.queryPlan(&clusterID)
+
+	var tested struct {
+		Passed bool `json:"passed"`
+	}
+	p.do(http.MethodPost, fmt.Sprintf("/agent/plans/%s/test", url.PathEscape(plan.ID)), map[string]interface{}{"cluster_id": clusterID}, http.StatusOK, &tested)
+	if !tested.Passed {
+		t.Fatalf("plan %s failed the dry-run", plan.ID)
+	}
+
+	var deployed struct {
+		ExecutionID string `json:"execution_id"`
+		Status      string `json:"status"`
+		Message     string `json:"message"`
+	}
+	p.do(http.MethodPost, "/agent/deploy", map[string]interface{}{
+		"plan_id":     plan.ID,
+		"cluster_id":  clusterID,
+		"kube_config": cluster.Kubeconfig,
+	}, http.StatusOK, &deployed)
+	if deployed.Status != "completed" {
+		t.Fatalf("deployment %s finished with status %s: %s", deployed.ExecutionID, deployed.Status, deployed.Message)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	configMaps, err := cluster.Clientset.CoreV1().ConfigMaps("").List(ctx, metav1.ListOptions{
+		LabelSelector: "app.kubernetes.io/name=" + p.chart.Name,
+	})
+	if err != nil {
+		t.Fatalf("list ConfigMaps: %v", err)
+	}
+	if len(configMaps.Items) == 0 {
+		t.Fatalf("no %s ConfigMap found on the cluster", p.chart.Name)
+	}
+
+	// Only failed or aborted deployments can be retried
+	p.do(http.MethodPost, fmt.Sprintf("/agent/deployments/%s/retry", url.PathEscape(deployed.ExecutionID)), map[string]interface{}{}, http.StatusConflict, nil)
+}
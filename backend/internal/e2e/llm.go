@@ -0,0 +1,100 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// FakeLLMProvider answers chat completions with canned replies so flows that
+// call the AI agent run without an LLM API
+type FakeLLMProvider struct {
+	// Replies maps a substring of the last user message to the reply returned for it
+	Replies map[string]string
+	// DefaultReply is returned when no entry in Replies matches
+	DefaultReply string
+
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+}
+
+// NewFakeLLMProvider creates a fake provider with a generic default reply
+func NewFakeLLMProvider() *FakeLLMProvider {
+	return &FakeLLMProvider{
+		Replies:      make(map[string]string),
+		DefaultReply: "This is a canned response from the e2e fake LLM provider.",
+	}
+}
+
+// CreateChatCompletion records the request and returns the matching canned reply
+func (p *FakeLLMProvider) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+
+	var prompt string
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == openai.ChatMessageRoleUser {
+			prompt = req.Messages[i].Content
+			break
+		}
+	}
+
+	reply := p.DefaultReply
+	for match, canned := range p.Replies {
+		if strings.Contains(prompt, match) {
+			reply = canned
+			break
+		}
+	}
+
+	return openai.ChatCompletionResponse{
+		ID:      "e2e-completion",
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{
+				Index:        0,
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply},
+				FinishReason: openai.FinishReasonStop,
+			},
+		},
+	}, nil
+}
+
+// Requests returns the chat completion requests received so far
+func (p *FakeLLMProvider) Requests() []openai.ChatCompletionRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]openai.ChatCompletionRequest(nil), p.requests...)
+}
+
+// PlanReply is the JSON answer a model gives a deployment query, with a plan
+// installing chart from repository
+func PlanReply(chart FakeChart, repository string) string {
+	step := map[string]interface{}{
+		"name":       chart.Name,
+		"repository": repository,
+		"version":    chart.Version,
+		"namespace":  "e2e",
+	}
+	reply, _ := json.Marshal(map[string]interface{}{
+		"answer": "Deploying " + chart.Name + " into the e2e namespace.",
+		"deployment_plan": map[string]interface{}{
+			"name":        "Deploy " + chart.Name,
+			"description": chart.Description,
+			"charts":      []interface{}{step},
+			"steps": []interface{}{map[string]interface{}{
+				"id":    "install-" + chart.Name,
+				"name":  "Install " + chart.Name,
+				"chart": step,
+			}},
+		},
+	})
+	return string(reply)
+}
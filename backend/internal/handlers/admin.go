@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler serves the data of the platform operators' dashboard and lets
+// them deactivate users and refresh cluster statuses
+type AdminHandler struct {
+	db         *database.Database
+	kubernetes *KubernetesHandler
+	health     config.HealthConfig
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(db *database.Database, kubernetesHandler *KubernetesHandler, health config.HealthConfig) *AdminHandler {
+	return &AdminHandler{
+		db:         db,
+		kubernetes: kubernetesHandler,
+		health:     health,
+	}
+}
+
+// RecordLLMSpend returns an agent usage hook storing each completion's tokens
+// and cost with the user it was made for and their organization
+func RecordLLMSpend(db *database.Database) func(agent.Usage) {
+	return func(usage agent.Usage) {
+		record := models.LLMUsageRecord{
+			UserID:           usage.UserID,
+			Model:            usage.Model,
+			Provider:         usage.Provider,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			TotalTokens:      usage.TotalTokens,
+			Cost:             usage.Cost,
+			DurationMs:       usage.Duration.Milliseconds(),
+			Failed:           usage.Error != "",
+		}
+		if usage.UserID != 0 {
+			var user models.User
+			if err := db.DB.Select("organization_id").First(&user, usage.UserID).Error; err == nil {
+				record.OrganizationID = user.OrganizationID
+			}
+		}
+		if err := db.DB.Create(&record).Error; err != nil {
+			fmt.Printf("Failed to record LLM usage: %v\n", err)
+		}
+	}
+}
+
+// PlatformOverview counts the platform's users, clusters and deployments
+type PlatformOverview struct {
+	Users         UserCounts       `json:"users"`
+	Organizations int64            `json:"organizations"`
+	Clusters      StatusCounts     `json:"clusters"`
+	Deployments   StatusCounts     `json:"deployments"`
+	Operations    map[string]int64 `json:"operations_by_status"`
+}
+
+// UserCounts counts the platform's users
+type UserCounts struct {
+	Total       int64 `json:"total"`
+	Active      int64 `json:"active"`
+	Deactivated int64 `json:"deactivated"`
+}
+
+// StatusCounts counts records by status
+type StatusCounts struct {
+	Total    int64            `json:"total"`
+	ByStatus map[string]int64 `json:"by_status"`
+}
+
+// GetOverview returns the totals of users, organizations, clusters,
+// deployments by status and operations by status
+func (h *AdminHandler) GetOverview(c *gin.Context) {
+	var overview PlatformOverview
+	reader := h.db.Reader()
+	if err := reader.Model(&models.User{}).Count(&overview.Users.Total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count users: %v", err)})
+		return
+	}
+	if err := reader.Model(&models.User{}).Where("deactivated_at IS NOT NULL").Count(&overview.Users.Deactivated).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count users: %v", err)})
+		return
+	}
+	overview.Users.Active = overview.Users.Total - overview.Users.Deactivated
+	if err := reader.Model(&models.Organization{}).Count(&overview.Organizations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count organizations: %v", err)})
+		return
+	}
+
+	var err error
+	if overview.Clusters, err = h.countByStatus(&models.KubernetesCluster{}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count clusters: %v", err)})
+		return
+	}
+	if overview.Deployments, err = h.countByStatus(&models.Deployment{}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count deployments: %v", err)})
+		return
+	}
+	operations, err := h.countByStatus(&models.Operation{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count operations: %v", err)})
+		return
+	}
+	overview.Operations = operations.ByStatus
+
+	c.JSON(http.StatusOK, overview)
+}
+
+// countByStatus counts the rows of a model's table by their status column
+func (h *AdminHandler) countByStatus(model interface{}) (StatusCounts, error) {
+	var groups []struct {
+		Status string
+		Count  int64
+	}
+	if err := h.db.Reader().Model(model).Select("status, COUNT(*) AS count").Group("status").Scan(&groups).Error; err != nil {
+		return StatusCounts{}, err
+	}
+	counts := StatusCounts{ByStatus: make(map[string]int64, len(groups))}
+	for _, group := range groups {
+		counts.Total += group.Count
+		counts.ByStatus[group.Status] += group.Count
+	}
+	return counts, nil
+}
+
+// OrganizationLLMSpend is the LLM usage of one organization's members.
+// Completions of users outside organizations and of background work have no
+// organization.
+type OrganizationLLMSpend struct {
+	OrganizationID   *uint   `json:"organization_id"`
+	Name             string  `json:"name,omitempty"`
+	Completions      int64   `json:"completions"`
+	Failures         int64   `json:"failures"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// LLMSpendResponse is the LLM usage per organization over a period
+type LLMSpendResponse struct {
+	Since         time.Time              `json:"since"`
+	TotalCost     float64                `json:"total_cost"`
+	TotalTokens   int64                  `json:"total_tokens"`
+	Organizations []OrganizationLLMSpend `json:"organizations"`
+}
+
+// GetLLMSpend returns the LLM tokens and cost per organization, most
+// expensive first. Accepts ?days= (default 30).
+func (h *AdminHandler) GetLLMSpend(c *gin.Context) {
+	since, ok := adminPeriod(c, "30")
+	if !ok {
+		return
+	}
+
+	var spend []OrganizationLLMSpend
+	err := h.db.Reader().Model(&models.LLMUsageRecord{}).
+		Select(`llm_usage_records.organization_id, COALESCE(organizations.name, '') AS name, COUNT(*) AS completions,
+			SUM(CASE WHEN llm_usage_records.failed THEN 1 ELSE 0 END) AS failures,
+			SUM(llm_usage_records.prompt_tokens) AS prompt_tokens,
+			SUM(llm_usage_records.completion_tokens) AS completion_tokens,
+			SUM(llm_usage_records.total_tokens) AS total_tokens,
+			SUM(llm_usage_records.cost) AS cost`).
+		Joins("LEFT JOIN organizations ON organizations.id = llm_usage_records.organization_id").
+		Where("llm_usage_records.created_at >= ?", since).
+		Group("llm_usage_records.organization_id, organizations.name").
+		Order("cost DESC").
+		Scan(&spend).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load LLM usage: %v", err)})
+		return
+	}
+
+	response := LLMSpendResponse{Since: since, Organizations: spend}
+	for _, organization := range spend {
+		response.TotalCost += organization.Cost
+		response.TotalTokens += organization.TotalTokens
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ErrorRate is the share of attempts that failed
+type ErrorRate struct {
+	Total  int64   `json:"total"`
+	Failed int64   `json:"failed"`
+	Rate   float64 `json:"rate"`
+}
+
+func newErrorRate(total, failed int64) ErrorRate {
+	rate := ErrorRate{Total: total, Failed: failed}
+	if total > 0 {
+		rate.Rate = float64(failed) / float64(total)
+	}
+	return rate
+}
+
+// ErrorRatesResponse reports how often the platform's work failed over a period
+type ErrorRatesResponse struct {
+	Since time.Time `json:"since"`
+	// Deployments counts finished deployments
+	Deployments    ErrorRate `json:"deployments"`
+	ChartInstalls  ErrorRate `json:"chart_installs"`
+	LLMCompletions ErrorRate `json:"llm_completions"`
+	Operations     ErrorRate `json:"operations"`
+	// ClusterHealthChecks counts the checks that didn't reach their cluster
+	ClusterHealthChecks ErrorRate `json:"cluster_health_checks"`
+}
+
+// GetErrorRates returns the failure rates of deployments, chart installs, LLM
+// completions, background operations and cluster health checks. Accepts
+// ?days= (default 7).
+func (h *AdminHandler) GetErrorRates(c *gin.Context) {
+	since, ok := adminPeriod(c, "7")
+	if !ok {
+		return
+	}
+
+	response := ErrorRatesResponse{Since: since}
+	for _, source := range []struct {
+		rate  *ErrorRate
+		model interface{}
+		// since bounds the period, finished selects the attempts that ended
+		since    string
+		finished []interface{}
+		failed   []interface{}
+	}{
+		{&response.Deployments, &models.Deployment{}, "started_at >= ?",
+			[]interface{}{"status <> ?", "running"}, []interface{}{"status = ?", "failed"}},
+		{&response.ChartInstalls, &models.DeploymentStepMetric{}, "started_at >= ?",
+			nil, []interface{}{"status = ?", "failed"}},
+		{&response.LLMCompletions, &models.LLMUsageRecord{}, "created_at >= ?",
+			nil, []interface{}{"failed = ?", true}},
+		{&response.Operations, &models.Operation{}, "created_at >= ?",
+			[]interface{}{"status IN ?", []string{models.OperationSucceeded, models.OperationFailed}},
+			[]interface{}{"status = ?", models.OperationFailed}},
+		{&response.ClusterHealthChecks, &models.ClusterHealthCheck{}, "checked_at >= ?",
+			nil, []interface{}{"reachable = ?", false}},
+	} {
+		finished := h.db.Reader().Model(source.model).Where(source.since, since)
+		if source.finished != nil {
+			finished = finished.Where(source.finished[0], source.finished[1:]...)
+		}
+		var total, failed int64
+		if err := finished.Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count errors: %v", err)})
+			return
+		}
+		err := h.db.Reader().Model(source.model).Where(source.since, since).
+			Where(source.failed[0], source.failed[1:]...).Count(&failed).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count errors: %v", err)})
+			return
+		}
+		*source.rate = newErrorRate(total, failed)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// PromptVersionFeedback is the feedback on the answers of one prompt version
+type PromptVersionFeedback struct {
+	PromptVersion string `json:"prompt_version"`
+	// Queries counts the answered queries, Rated those with feedback
+	Queries   int64 `json:"queries"`
+	Rated     int64 `json:"rated"`
+	Helpful   int64 `json:"helpful"`
+	Unhelpful int64 `json:"unhelpful"`
+	// Accuracy is the share of rated answers rated helpful
+	Accuracy float64 `json:"accuracy"`
+	// RatedShare is the share of answers that got feedback
+	RatedShare float64 `json:"rated_share"`
+}
+
+// AnswerFeedbackResponse is the feedback on the agent's answers over a period
+type AnswerFeedbackResponse struct {
+	Since          time.Time               `json:"since"`
+	PromptVersions []PromptVersionFeedback `json:"prompt_versions"`
+}
+
+// GetAnswerFeedback returns how the agent's answers were rated per prompt
+// version, newest version first. Accepts ?days= (default 30).
+func (h *AdminHandler) GetAnswerFeedback(c *gin.Context) {
+	since, ok := adminPeriod(c, "30")
+	if !ok {
+		return
+	}
+
+	versions := []PromptVersionFeedback{}
+	err := h.db.Reader().Model(&models.AgentQuery{}).
+		Select(`prompt_version, COUNT(*) AS queries,
+			SUM(CASE WHEN rating IS NOT NULL THEN 1 ELSE 0 END) AS rated,
+			SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END) AS helpful,
+			SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END) AS unhelpful`).
+		Where("created_at >= ? AND status <> ?", since, queryStatusFailed).
+		Group("prompt_version").
+		Order("prompt_version DESC").
+		Scan(&versions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load answer feedback: %v", err)})
+		return
+	}
+	for i := range versions {
+		if versions[i].Rated > 0 {
+			versions[i].Accuracy = float64(versions[i].Helpful) / float64(versions[i].Rated)
+		}
+		if versions[i].Queries > 0 {
+			versions[i].RatedShare = float64(versions[i].Rated) / float64(versions[i].Queries)
+		}
+	}
+
+	c.JSON(http.StatusOK, AnswerFeedbackResponse{Since: since, PromptVersions: versions})
+}
+
+// ListUsers returns the platform's users, newest first. Accepts ?email= to
+// filter by address, ?deactivated=true|false and the list parameters
+// (sortable by created_at, email and role).
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	params := parseListParams(c, "-created_at")
+	query := h.db.Reader().Model(&models.User{})
+	if email := c.Query("email"); email != "" {
+		query = query.Where("LOWER(email) LIKE LOWER(?)", "%"+email+"%")
+	}
+	switch c.Query("deactivated") {
+	case "true":
+		query = query.Where("deactivated_at IS NOT NULL")
+	case "false":
+		query = query.Where("deactivated_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count users: %v", err)})
+		return
+	}
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at", "email": "email", "role": "role"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var users []models.User
+	if err := page.Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load users: %v", err)})
+		return
+	}
+
+	responses := make([]models.UserResponse, len(users))
+	for i, user := range users {
+		responses[i] = models.UserResponse{
+			ID:             user.ID,
+			Email:          user.Email,
+			FirstName:      user.FirstName,
+			LastName:       user.LastName,
+			OrganizationID: user.OrganizationID,
+			Role:           user.Role,
+			DeactivatedAt:  user.DeactivatedAt,
+			CreatedAt:      user.CreatedAt,
+		}
+	}
+	respondWithList(c, params, total, "users", responses)
+}
+
+// DeactivateUser stops a user from signing in and rejects their tokens.
+// Admins can't deactivate themselves.
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	h.setUserDeactivated(c, true)
+}
+
+// ReactivateUser lets a deactivated user sign in again
+func (h *AdminHandler) ReactivateUser(c *gin.Context) {
+	h.setUserDeactivated(c, false)
+}
+
+func (h *AdminHandler) setUserDeactivated(c *gin.Context, deactivate bool) {
+	adminID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if deactivate && uint(id) == adminID.(uint) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't deactivate your own account"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var deactivatedAt *time.Time
+	if deactivate {
+		// Deactivating again keeps the original time
+		if user.DeactivatedAt != nil {
+			c.JSON(http.StatusOK, gin.H{"user_id": user.ID, "deactivated_at": user.DeactivatedAt})
+			return
+		}
+		now := time.Now()
+		deactivatedAt = &now
+	}
+	if err := h.db.DB.Model(&user).Update("deactivated_at", deactivatedAt).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update user: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": user.ID, "deactivated_at": deactivatedAt})
+}
+
+// RefreshClustersRequest selects the clusters whose status is refreshed
+type RefreshClustersRequest struct {
+	// ClusterIDs are the clusters to check, every cluster when empty
+	ClusterIDs []uint `json:"cluster_ids,omitempty"`
+}
+
+// ClusterRefresh is the status of a cluster after a forced health check
+type ClusterRefresh struct {
+	ClusterID uint                      `json:"cluster_id"`
+	Name      string                    `json:"name"`
+	Status    string                    `json:"status"`
+	Check     models.ClusterHealthCheck `json:"check"`
+}
+
+// RefreshClusterStatuses checks the connectivity of clusters right away,
+// updating their status as the health monitor would, and returns the outcomes
+func (h *AdminHandler) RefreshClusterStatuses(c *gin.Context) {
+	var req RefreshClustersRequest
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	checks, err := h.kubernetes.refreshClusterHealth(req.ClusterIDs, h.health.FailureThreshold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to check clusters: %v", err)})
+		return
+	}
+	if len(checks) == 0 {
+		c.JSON(http.StatusOK, gin.H{"clusters": []ClusterRefresh{}})
+		return
+	}
+
+	ids := make([]uint, len(checks))
+	for i, check := range checks {
+		ids[i] = check.ClusterID
+	}
+	var clusters []models.KubernetesCluster
+	if err := h.db.DB.Select("id", "name", "status").Where("id IN ?", ids).Find(&clusters).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load clusters: %v", err)})
+		return
+	}
+	byID := make(map[uint]models.KubernetesCluster, len(clusters))
+	for _, cluster := range clusters {
+		byID[cluster.ID] = cluster
+	}
+
+	refreshed := make([]ClusterRefresh, len(checks))
+	for i, check := range checks {
+		cluster := byID[check.ClusterID]
+		refreshed[i] = ClusterRefresh{ClusterID: check.ClusterID, Name: cluster.Name, Status: cluster.Status, Check: check}
+	}
+	c.JSON(http.StatusOK, gin.H{"clusters": refreshed})
+}
+
+// adminPeriod parses ?days= into the start of the reported period, writing a
+// 400 response when it isn't a positive integer
+func adminPeriod(c *gin.Context, defaultDays string) (time.Time, bool) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", defaultDays))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive integer"})
+		return time.Time{}, false
+	}
+	return time.Now().Add(-time.Duration(days) * 24 * time.Hour), true
+}
@@ -2,15 +2,23 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
 	"grafana-ai-agent-platform/backend/internal/services"
 	"grafana-ai-agent-platform/backend/pkg/database"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // AgentHandler handles AI agent operations
@@ -20,13 +28,51 @@ type AgentHandler struct {
 	clusterAnalyzer    *services.ClusterAnalyzerService
 	helmService        *services.HelmService
 	deploymentExecutor *services.DeploymentExecutorService
+	planTester         *services.PlanTesterService
+	preflight          *services.PreflightService
+	policyEngine       *services.PolicyEngineService
+	// queryCache is nil when query caching is disabled
+	queryCache         *services.QueryCache
+	dashboardGenerator *services.DashboardGeneratorService
+	promqlGenerator    *services.PromQLGeneratorService
+	alertRules         *services.AlertRuleGeneratorService
+	failureAnalyzer    *services.FailureAnalyzerService
+	runbookGenerator   *services.RunbookGeneratorService
+	planValues         *services.PlanValuesService
+	troubleshooter     *services.TroubleshooterService
+	licenseChecker     *services.LicenseCheckerService
+	securityScanner    *services.SecurityScannerService
+	events             *services.EventsService
+	scopedAccess       *services.ScopedAccessService
+	operations         *OperationHandler
+	bus                *services.EventBus
+	// grafanaKeys encrypts the API keys of registered Grafana instances
+	grafanaKeys *services.Sealer
+	// knowledgeBase is nil when the knowledge base is disabled
+	knowledgeBase *services.KnowledgeBaseService
+	// costEstimator is nil when cost estimates are disabled
+	costEstimator *services.CostEstimatorService
+	// deploymentLocks is nil when deployments don't lock their namespaces
+	deploymentLocks *services.DeploymentLocker
+	// workers run the deployments queued as jobs
+	workers *WorkerHandler
 }
 
-// NewAgentHandler creates a new agent handler
-func NewAgentHandler(db *database.Database, aiAgent *agent.AIAgent) *AgentHandler {
-	helmService := services.NewHelmService()
+// NewAgentHandler creates a new agent handler. The API keys of Grafana
+// instances are encrypted with a key derived from secret.
+func NewAgentHandler(db *database.Database, aiAgent *agent.AIAgent, helmService *services.HelmService, events *services.EventsService, operations *OperationHandler, bus *services.EventBus, secret string) *AgentHandler {
 	deploymentExecutor := services.NewDeploymentExecutorService(helmService)
+	deploymentExecutor.RegisterPostDeployStep(services.NewHelmTestStep())
+	deploymentExecutor.RegisterPostDeployStep(services.NewGrafanaProvisionerService())
+	deploymentExecutor.RegisterPostDeployStep(services.NewProfileDatasourceStep())
+	deploymentExecutor.WatchAbortRequests(abortRequestCheck(db))
 	clusterAnalyzer := services.NewClusterAnalyzerService()
+	planTester := services.NewPlanTesterService(deploymentExecutor)
+	preflight := services.NewPreflightService(helmService, deploymentExecutor)
+	policyEngine := services.NewPolicyEngineService(deploymentExecutor)
+	dashboardGenerator := services.NewDashboardGeneratorService(aiAgent)
+	promqlGenerator := services.NewPromQLGeneratorService(aiAgent)
+	failureAnalyzer := services.NewFailureAnalyzerService(aiAgent)
 
 	return &AgentHandler{
 		db:                 db,
@@ -34,55 +80,304 @@ func NewAgentHandler(db *database.Database, aiAgent *agent.AIAgent) *AgentHandle
 		clusterAnalyzer:    clusterAnalyzer,
 		helmService:        helmService,
 		deploymentExecutor: deploymentExecutor,
+		planTester:         planTester,
+		preflight:          preflight,
+		policyEngine:       policyEngine,
+		dashboardGenerator: dashboardGenerator,
+		promqlGenerator:    promqlGenerator,
+		alertRules:         services.NewAlertRuleGeneratorService(aiAgent),
+		failureAnalyzer:    failureAnalyzer,
+		runbookGenerator:   services.NewRunbookGeneratorService(aiAgent),
+		planValues:         services.NewPlanValuesService(aiAgent, helmService),
+		troubleshooter:     services.NewTroubleshooterService(aiAgent),
+		licenseChecker:     services.NewLicenseCheckerService(helmService, deploymentExecutor),
+		securityScanner:    services.NewSecurityScannerService(deploymentExecutor),
+		events:             events,
+		scopedAccess:       services.NewScopedAccessService(deploymentExecutor),
+		operations:         operations,
+		bus:                bus,
+		grafanaKeys:        services.NewSealer(secret, "grafana-api-keys"),
 	}
 }
 
-// QueryRequest represents a user query to the AI agent
-type QueryRequest struct {
-	Query     string `json:"query" binding:"required"`
+// EnableQueryCache answers repeated queries from the cache
+func (h *AgentHandler) EnableQueryCache(cache *services.QueryCache) {
+	h.queryCache = cache
+}
+
+// EnableSecretBackends lets chart values reference secrets in Vault and
+// SOPS-encrypted files, besides Kubernetes Secrets
+func (h *AgentHandler) EnableSecretBackends(backends services.SecretBackends) {
+	h.deploymentExecutor.UseSecretBackends(backends)
+}
+
+// LimitStepConcurrency bounds how many independent steps of a deployment run at once
+func (h *AgentHandler) LimitStepConcurrency(limit int) {
+	h.deploymentExecutor.SetStepConcurrency(limit)
+}
+
+// GetModels lists the models queries may select, the default first
+func (h *AgentHandler) GetModels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"models": h.aiAgent.Models()})
+}
+
+// GetPlanSchema serves the JSON Schema of deployment plans, of the version in
+// ?version= or the one plans are generated with. Stored plans of every listed
+// version are upgraded when they are read.
+func (h *AgentHandler) GetPlanSchema(c *gin.Context) {
+	version := c.DefaultQuery("version", agent.PlanSchemaVersion)
+	schema, err := agent.PlanSchema(version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "versions": agent.PlanSchemaVersions(), "current": agent.PlanSchemaVersion})
+		return
+	}
+	c.Header("X-Plan-Schema-Version", version)
+	c.Data(http.StatusOK, "application/schema+json", schema)
+}
+
+// queryStatusFailed is the history status of queries that failed. Answered
+// queries have the agent's status, completed.
+const queryStatusFailed = "failed"
+
+// QueryHistoryEntry is a past query in the history list
+type QueryHistoryEntry struct {
+	ID        uint   `json:"id"`
 	ClusterID *uint  `json:"cluster_id,omitempty"`
+	Query     string `json:"query"`
+	Response  string `json:"response"`
+	Status    string `json:"status"`
+	// Rating and FeedbackComment are the feedback given on the answer
+	Rating          *int      `json:"rating,omitempty"`
+	FeedbackComment string    `json:"feedback_comment,omitempty"`
+	PromptVersion   string    `json:"prompt_version,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// RetryDeploymentRequest represents a request to resume a failed deployment
+type RetryDeploymentRequest struct {
+	// KubeConfig defaults to the stored kubeconfig of the deployment's cluster
+	KubeConfig string `json:"kube_config,omitempty"`
+	// Retry overrides the retry policy of the given step IDs
+	Retry map[string]agent.RetryPolicy `json:"retry,omitempty"`
+	// ScopedCredentials runs the remaining steps as an ephemeral ServiceAccount
+	ScopedCredentials bool `json:"scoped_credentials,omitempty"`
+}
+
+// TestPlanRequest represents a plan test request
+type TestPlanRequest struct {
+	ClusterID *uint `json:"cluster_id,omitempty"`
+}
+
+// PreflightRequest represents a plan preflight request
+type PreflightRequest struct {
+	ClusterID        *uint `json:"cluster_id,omitempty"`
+	ApplyAdjustments bool  `json:"apply_adjustments"`
+}
+
+// PreflightResponse wraps a preflight report with the adjustments applied to the plan
+type PreflightResponse struct {
+	Report             *services.PreflightReport `json:"report"`
+	AppliedAdjustments int                       `json:"applied_adjustments"`
+	Plan               *agent.DeploymentPlan     `json:"plan,omitempty"`
+}
+
+// GenerateDashboardRequest represents a dashboard generation request
+type GenerateDashboardRequest struct {
+	Description       string                       `json:"description" binding:"required"`
+	ClusterID         *uint                        `json:"cluster_id,omitempty"`
+	Datasource        services.DashboardDatasource `json:"datasource"`
+	Push              bool                         `json:"push"`
+	GrafanaInstanceID *uint                        `json:"grafana_instance_id,omitempty"`
+	// ServiceMesh builds the dashboard from the telemetry of the cluster's mesh
+	ServiceMesh bool `json:"service_mesh,omitempty"`
+}
+
+// GenerateDashboardResponse represents a generated dashboard and its push outcome
+type GenerateDashboardResponse struct {
+	*services.GeneratedDashboard
+	Pushed bool   `json:"pushed"`
+	URL    string `json:"url,omitempty"`
+}
+
+// PromQLRequest asks for a PromQL query answering a metric question
+type PromQLRequest struct {
+	Question  string `json:"question" binding:"required"`
+	ClusterID uint   `json:"cluster_id" binding:"required"`
+	// Range and Step apply to range queries, e.g. "1h" and "1m"
+	Range   string `json:"range,omitempty"`
+	Step    string `json:"step,omitempty"`
+	Execute *bool  `json:"execute,omitempty"`
+}
+
+// PromQLResponse returns the generated query together with its results
+type PromQLResponse struct {
+	*services.GeneratedPromQL
+	Executed bool                       `json:"executed"`
+	Result   *services.PrometheusResult `json:"result,omitempty"`
+	Error    string                     `json:"error,omitempty"`
+}
+
+// TroubleshootRequest asks for a diagnosis of a namespace or one of its workloads
+type TroubleshootRequest struct {
+	ClusterID uint   `json:"cluster_id" binding:"required"`
+	Namespace string `json:"namespace" binding:"required"`
+	// Workload is a deployment, statefulset or daemonset name, or a pod name prefix
+	Workload string `json:"workload,omitempty"`
+	// Question describes the symptoms the user sees
+	Question string `json:"question,omitempty"`
 }
 
-// QueryResponse represents the AI agent response
-type QueryResponse struct {
-	Response        string                 `json:"response"`
-	DeploymentPlan  *agent.DeploymentPlan  `json:"deployment_plan,omitempty"`
-	ClusterAnalysis *agent.ClusterAnalysis `json:"cluster_analysis,omitempty"`
-	Status          string                 `json:"status"`
-	Timestamp       string                 `json:"timestamp"`
+// TroubleshootResponse returns the collected evidence and the diagnosis
+type TroubleshootResponse struct {
+	Evidence *services.TroubleshootEvidence `json:"evidence"`
+	Report   *services.TroubleshootReport   `json:"report,omitempty"`
+	// Actions are remediations that run with one request, for organization
+	// admins and operators
+	Actions []SuggestedAction `json:"actions,omitempty"`
+	Error   string            `json:"error,omitempty"`
 }
 
-// DeployRequest represents a deployment request
-type DeployRequest struct {
-	PlanID     string `json:"plan_id" binding:"required"`
-	ClusterID  uint   `json:"cluster_id" binding:"required"`
-	KubeConfig string `json:"kube_config" binding:"required"`
+// SuggestedAction is a workload action with the request that runs it
+type SuggestedAction struct {
+	services.WorkloadAction
+	Method string `json:"method"`
+	Path   string `json:"path"`
 }
 
-// DeployResponse represents a deployment response
-type DeployResponse struct {
-	ExecutionID string `json:"execution_id"`
-	Status      string `json:"status"`
-	Message     string `json:"message"`
+// OutdatedReleasesResponse lists releases with newer chart versions available
+type OutdatedReleasesResponse struct {
+	ClusterID  uint                      `json:"cluster_id"`
+	Checked    int                       `json:"checked"`
+	Outdated   []services.ReleaseUpgrade `json:"outdated"`
+	Unresolved []services.ReleaseUpgrade `json:"unresolved"`
+	Plan       *agent.DeploymentPlan     `json:"plan,omitempty"`
 }
 
-// QueryAgent handles AI agent queries
+// QueryAgent handles AI agent queries. With ?async=true the query runs as a
+// plan generation operation.
 func (h *AgentHandler) QueryAgent(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var req QueryRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Model != "" && !h.aiAgent.AllowsModel(req.Model) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown model %s", req.Model), "models": h.aiAgent.Models()})
+		return
+	}
+	if err := validateNamespace(req.Namespace); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Queries naming no cluster are about the session's context
+	queryContext, err := h.queryContext(c, userID.(uint), &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load context: %v", err)})
+		return
+	}
+
+	if wantsAsync(c) {
+		var target string
+		if req.ClusterID != nil {
+			target = fmt.Sprintf("cluster/%d", *req.ClusterID)
+		}
+		operation, err := h.operations.Start(userID.(uint), models.OperationPlanGeneration, target, func(ctx context.Context) (interface{}, error) {
+			response, _, err := h.answerQuery(ctx, userID.(uint), req)
+			if response != nil {
+				response.Context = queryContext
+			}
+			return response, err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithOperation(c, operation)
+		return
+	}
+
+	response, status, err := h.answerQuery(c.Request.Context(), userID.(uint), req)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	response.Context = queryContext
+
+	c.JSON(http.StatusOK, response)
+}
+
+// answerQuery asks the AI agent, with the cluster's context when one is given,
+// and stores a deployment plan for deployment requests. Every query is saved to
+// the history, failed ones with their error. Errors come with the HTTP status
+// to answer them with.
+func (h *AgentHandler) answerQuery(ctx context.Context, userID uint, req QueryRequest) (*QueryResponse, int, error) {
+	response, status, err := h.answer(ctx, userID, req)
+	if err != nil {
+		h.saveQuery(userID, req, QueryResponse{Response: err.Error(), Status: queryStatusFailed})
+		return nil, status, err
+	}
+	response.QueryID = h.saveQuery(userID, req, *response)
+	return response, status, nil
+}
+
+// answer answers a query for answerQuery
+func (h *AgentHandler) answer(ctx context.Context, userID uint, req QueryRequest) (*QueryResponse, int, error) {
+	// Every completion of the query, plan values included, uses the selected model
+	ctx = agent.WithModel(ctx, req.Model)
 
 	// Get cluster information if cluster ID is provided
-	var clusterInfo string
+	var clusterInfo, snapshot, warnings string
+	var clusterAnalysis *agent.ClusterAnalysis
 	if req.ClusterID != nil {
-		cluster, err := h.getClusterInfo(*req.ClusterID)
+		services.ReportProgress(ctx, 0, "Analyzing cluster")
+		info, analysis, err := h.getClusterContext(ctx, *req.ClusterID, userID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to get cluster info: %v", err)})
-			return
+			return nil, http.StatusBadRequest, fmt.Errorf("Failed to get cluster info: %v", err)
+		}
+		clusterInfo = info
+		clusterAnalysis = analysis
+		snapshot = clusterInfo
+		if analysis != nil {
+			snapshot = latestSnapshotHash(h.db, *req.ClusterID)
+		}
+
+		// "Why is X failing" questions get the cluster's recent warnings
+		if target, ok := services.FailureQueryTarget(req.Query); ok {
+			if warnings = h.getClusterWarnings(ctx, *req.ClusterID, userID, target); warnings != "" {
+				clusterInfo += "\n\n" + warnings
+			}
 		}
-		clusterInfo = cluster
+	}
+
+	// Identical questions about an unchanged cluster are answered from the cache
+	var cacheKey string
+	if h.queryCache != nil {
+		var clusterID string
+		if req.ClusterID != nil {
+			clusterID = strconv.FormatUint(uint64(*req.ClusterID), 10)
+		}
+		cacheKey = services.QueryCacheKey(req.Query, strconv.FormatUint(uint64(userID), 10), req.Model, clusterID, req.Namespace, snapshot, warnings, req.Format, strconv.FormatBool(req.PlanRequested))
+		var cached QueryResponse
+		if !req.BypassCache && h.queryCache.Get(ctx, cacheKey, &cached) {
+			cached.Cache = services.CacheHit
+			return &cached, http.StatusOK, nil
+		}
+	}
+
+	// Ground the answer in the organization's runbooks and the team's past queries
+	embedding := h.embedQuestion(ctx, req.Query)
+	knowledge := h.knowledgeExcerpts(ctx, userID, embedding)
+	similar := h.pastQueries(ctx, userID, embedding)
+	examples := h.ratedExamples(ctx, userID, req.ClusterID, embedding, similar)
+	templates, err := loadOrgTemplates(h.db, userID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to load stack templates: %v", err)
 	}
 
 	// Create AI agent request
@@ -90,215 +385,1474 @@ func (h *AgentHandler) QueryAgent(c *gin.Context) {
 		Query:       req.Query,
 		ClusterID:   req.ClusterID,
 		ClusterInfo: clusterInfo,
+		Analysis:    clusterAnalysis,
+		Namespace:   req.Namespace,
+		Knowledge:   knowledge,
+		PastQueries: pastQueryContext(similar),
+		Examples:    pastQueryContext(examples),
+		Templates:   templates,
+		Model:       req.Model,
+		// Deployment requests get a plan from the model along with the answer
+		PlanRequested: req.PlanRequested || h.isDeploymentQuery(req.Query),
+		Format:        req.Format,
 	}
 
 	// Query the AI agent
-	ctx := context.Background()
+	services.ReportProgress(ctx, 30, "Querying the AI agent")
 	aiResp, err := h.aiAgent.Query(ctx, aiReq)
+	if errors.Is(err, agent.ErrPromptTooLarge) {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("AI agent query failed: %v", err)
+	}
+	if errors.Is(err, agent.ErrCircuitOpen) || errors.Is(err, agent.ErrLLMUnavailable) {
+		return nil, http.StatusServiceUnavailable, fmt.Errorf("AI agent query failed: %v", err)
+	}
+	if errors.Is(err, agent.ErrNoManifests) {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("AI agent query failed: %v", err)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("AI agent query failed: %v", err)})
-		return
+		return nil, http.StatusInternalServerError, fmt.Errorf("AI agent query failed: %v", err)
 	}
 
 	// If this is a deployment request, create a deployment plan
 	var deploymentPlan *agent.DeploymentPlan
-	if h.isDeploymentQuery(req.Query) {
-		plan, err := h.createDeploymentPlan(req.Query, req.ClusterID, clusterInfo)
+	if aiReq.PlanRequested {
+		services.ReportProgress(ctx, 70, "Generating deployment plan")
+		policy, err := loadValuePolicy(h.db, userID, req.ClusterID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to create deployment plan: %v", err)})
-			return
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to load value policy: %v", err)
+		}
+		if len(aiResp.PlanErrors) > 0 {
+			fmt.Printf("Model plan for %q rejected, searching charts instead: %s\n", req.Query, strings.Join(aiResp.PlanErrors, "; "))
+		}
+		plan, err := h.createDeploymentPlan(ctx, userID, req.ClusterID, req.Query, aiResp.DeploymentPlan, templates, clusterAnalysis, policy)
+		var fitErr *services.NamespaceFitError
+		if errors.As(err, &fitErr) {
+			return nil, http.StatusUnprocessableEntity, fmt.Errorf("Failed to create deployment plan: %v", err)
+		}
+		if reason := unavailable(err); reason != nil {
+			return nil, http.StatusServiceUnavailable, fmt.Errorf("Failed to create deployment plan: %v", reason)
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to create deployment plan: %v", err)
+		}
+		if err := h.savePlan(userID, req, plan); err != nil {
+			return nil, http.StatusInternalServerError, fmt.Errorf("Failed to save deployment plan: %v", err)
 		}
 		deploymentPlan = plan
 	}
 
 	// Create response
+	format := req.Format
+	if format == "" {
+		format = agent.FormatMarkdown
+	}
 	response := QueryResponse{
-		Response:        aiResp.Response,
-		DeploymentPlan:  deploymentPlan,
-		ClusterAnalysis: aiResp.ClusterAnalysis,
-		Status:          aiResp.Status,
-		Timestamp:       aiResp.Timestamp.Format("2006-01-02T15:04:05Z"),
+		Response:         aiResp.Response,
+		Format:           format,
+		DeploymentPlan:   deploymentPlan,
+		ClusterAnalysis:  clusterAnalysis,
+		PlanErrors:       aiResp.PlanErrors,
+		Sources:          knowledgeSources(knowledge),
+		SimilarQueries:   similar,
+		Status:           aiResp.Status,
+		Model:            aiResp.Model,
+		Provider:         aiResp.Provider,
+		LatencyMs:        aiResp.LatencyMs,
+		ContextTruncated: aiResp.ContextTruncated,
+		Timestamp:        aiResp.Timestamp.Format("2006-01-02T15:04:05Z"),
+	}
+	if h.queryCache != nil {
+		response.Cache = services.CacheMiss
+		h.queryCache.Set(ctx, cacheKey, response)
 	}
 
-	// Save query to database
-	h.saveQuery(c, req, response)
-
-	c.JSON(http.StatusOK, response)
+	return &response, http.StatusOK, nil
 }
 
-// DeployStack handles stack deployment requests
+// DeployStack handles stack deployment requests. The deployment is queued for
+// the deployment workers; with ?async=true it is followed as an operation.
 func (h *AgentHandler) DeployStack(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var req DeployRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Get the deployment plan (in production, this would come from storage)
-	plan, err := h.getDeploymentPlan(req.PlanID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+	plan, _, status, body := h.loadDeployablePlan(userID.(uint), req)
+	if body != nil {
+		c.JSON(status, body)
 		return
 	}
 
-	// Execute the deployment
-	ctx := context.Background()
-	execution, err := h.deploymentExecutor.ExecuteDeployment(ctx, plan, req.KubeConfig)
+	h.workers.Submit(c, userID.(uint), req.ClusterID, models.JobDeploy, "plan/"+plan.ID, deployJob{Request: req})
+}
+
+// loadDeployablePlan loads the stored plan a deploy request deploys, or returns
+// the status and body a request whose plan can't be deployed is answered with
+func (h *AgentHandler) loadDeployablePlan(userID uint, req DeployRequest) (*agent.DeploymentPlan, *models.DeploymentPlanRecord, int, gin.H) {
+	plan, record, err := h.getDeploymentPlan(req.PlanID, userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Deployment execution failed: %v", err)})
-		return
+		return nil, nil, http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)}
 	}
+	if err := h.planDeployableTo(record, req.ClusterID, userID); err != nil {
+		return nil, nil, http.StatusForbidden, gin.H{"error": err.Error(), "comment": record.ReviewComment}
+	}
+	return plan, record, 0, nil
+}
 
-	// Save deployment to database
-	h.saveDeployment(c, req, execution)
-
-	response := DeployResponse{
+// deployPlan merges the cluster environment's value overlays into a plan,
+// enforces the organization's policies on it, locks the namespaces it deploys
+// to, runs the preflight checks and deploys it
+func (h *AgentHandler) deployPlan(ctx context.Context, userID uint, plan *agent.DeploymentPlan, record *models.DeploymentPlanRecord, req DeployRequest) (*DeployResponse, error) {
+	if err := h.applyEnvironmentOverlays(userID, req.ClusterID, plan); err != nil {
+		return nil, err
+	}
+	services.ReportProgress(ctx, 0, "Checking organization policies")
+	if err := h.enforceChartRules(userID, plan); err != nil {
+		return nil, err
+	}
+	if err := h.enforcePolicies(ctx, userID, plan); err != nil {
+		return nil, err
+	}
+	if err := h.enforceSecurityPolicy(ctx, userID, plan, record); err != nil {
+		return nil, err
+	}
+	if err := h.enforceValuesSchema(plan); err != nil {
+		return nil, err
+	}
+	ctx, release, err := h.lockDeployment(ctx, userID, req.ClusterID, plan)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if !req.SkipPreflight {
+		services.ReportProgress(ctx, 0, "Running preflight checks")
+		if err := h.runPreflight(ctx, userID, req.ClusterID, plan, req.KubeConfig); err != nil {
+			return nil, err
+		}
+	}
+	execution, err := h.executePlan(ctx, userID, req.ClusterID, plan, req.KubeConfig, req.ScopedCredentials)
+	if err != nil {
+		return nil, fmt.Errorf("Deployment execution failed: %v", err)
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("deployment %s was cancelled, retry it to continue", execution.ID)
+	}
+	return &DeployResponse{
 		ExecutionID: execution.ID,
 		Status:      execution.Status,
 		Message:     "Deployment started successfully",
+		PostDeploy:  execution.PostDeploy,
+		Diagnoses:   executionDiagnoses(execution),
+	}, nil
+}
+
+// deployErrorResponse returns the status and body a deployment that failed
+// with err is answered with
+func deployErrorResponse(err error) (int, gin.H) {
+	var preflightErr *PreflightFailedError
+	if errors.As(err, &preflightErr) {
+		return http.StatusPreconditionFailed, gin.H{"error": err.Error(), "preflight": preflightErr.Report}
+	}
+	var lockedErr *services.DeploymentLockedError
+	if errors.As(err, &lockedErr) {
+		return http.StatusConflict, gin.H{"error": err.Error(), "locks": lockedErr.Locks}
+	}
+	var blockedErr *ChartBlockedError
+	if errors.As(err, &blockedErr) {
+		return http.StatusForbidden, gin.H{"error": err.Error(), "blocked_charts": blockedErr.Charts}
+	}
+	var policyErr *PolicyViolationError
+	if errors.As(err, &policyErr) {
+		return http.StatusForbidden, gin.H{"error": err.Error(), "policy": policyErr.Evaluation}
+	}
+	var securityErr *SecurityViolationError
+	if errors.As(err, &securityErr) {
+		return http.StatusForbidden, gin.H{"error": err.Error(), "security": securityErr.Report}
+	}
+	var valuesErr *ValuesValidationError
+	if errors.As(err, &valuesErr) {
+		return http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "values": valuesErr.Validations}
 	}
+	return http.StatusInternalServerError, gin.H{"error": err.Error()}
+}
 
-	c.JSON(http.StatusOK, response)
+// executePlan runs a plan, optionally as a ServiceAccount scoped to it, then
+// diagnoses failed steps and stores the execution
+func (h *AgentHandler) executePlan(ctx context.Context, userID, clusterID uint, plan *agent.DeploymentPlan, kubeconfig string, scoped bool) (*agent.DeploymentExecution, error) {
+	ctx = h.trackExecution(h.withGrafanaEndpoints(withRegistryCredentials(ctx, h.db, userID), userID, clusterID), userID, clusterID, plan)
+	run := func(kubeconfig string) (*agent.DeploymentExecution, error) {
+		return h.deploymentExecutor.ExecuteDeployment(ctx, plan, kubeconfig)
+	}
+	var execution *agent.DeploymentExecution
+	var err error
+	if scoped {
+		execution, err = h.scopedAccess.RunScoped(ctx, kubeconfig, plan, run)
+	} else {
+		execution, err = run(kubeconfig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	diagnoseFailures(ctx, h.db, h.failureAnalyzer, plan, execution)
+	recordSBOM(ctx, kubeconfig, plan, execution)
+
+	// Save deployment to database
+	if err := h.saveDeployment(userID, clusterID, plan, execution); err != nil {
+		fmt.Printf("Failed to save deployment execution %s: %v\n", execution.ID, err)
+	}
+	h.registerGrafanaInstances(userID, clusterID, execution)
+	h.writeRunbookInBackground(userID, execution, plan)
+	h.publishDeployment(userID, clusterID, plan, execution)
+	return execution, nil
 }
 
-// GetQueryHistory returns the history of AI agent queries
-func (h *AgentHandler) GetQueryHistory(c *gin.Context) {
+// PreflightFailedError stops a deployment whose preflight checks failed
+type PreflightFailedError struct {
+	Report *services.PreflightReport
+}
+
+func (e *PreflightFailedError) Error() string {
+	return "preflight checks failed: " + strings.Join(e.Report.Cluster.Failures, "; ")
+}
+
+// runPreflight checks that the cluster has the capacity, storage classes and
+// CRDs a plan needs and that the kubeconfig may create its objects, so a
+// deployment fails before its first step instead of midway
+func (h *AgentHandler) runPreflight(ctx context.Context, userID, clusterID uint, plan *agent.DeploymentPlan, kubeconfig string) error {
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	readiness, err := h.preflight.CheckClusterReadiness(withRegistryCredentials(ctx, h.db, userID), client, plan)
+	if err != nil {
+		return fmt.Errorf("preflight checks failed to run: %w", err)
+	}
+	if readiness.Passed() {
+		return nil
+	}
+	return &PreflightFailedError{Report: &services.PreflightReport{
+		PlanID:    plan.ID,
+		ClusterID: clusterID,
+		Passed:    false,
+		Cluster:   readiness,
+		CheckedAt: time.Now(),
+	}}
+}
+
+// planDeployable returns why a stored plan may not be deployed, or nil
+func planDeployable(record *models.DeploymentPlanRecord) error {
+	switch record.Status {
+	case models.PlanStatusPendingApproval:
+		return fmt.Errorf("deployment plan is waiting for approval by an operator or admin")
+	case models.PlanStatusRejected:
+		return fmt.Errorf("deployment plan was rejected")
+	}
+	return nil
+}
+
+// planDeployableTo returns why a stored plan may not be deployed to one of
+// the user's clusters, or nil. Production clusters only take approved plans,
+// and a cluster that can't be looked up takes none.
+func (h *AgentHandler) planDeployableTo(record *models.DeploymentPlanRecord, clusterID, userID uint) error {
+	if err := planDeployable(record); err != nil {
+		return err
+	}
+	if record.Status == models.PlanStatusApproved {
+		return nil
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Select("environment").Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
+		return fmt.Errorf("cluster not found: %w", err)
+	}
+	if cluster.Environment == agent.EnvironmentProd {
+		return fmt.Errorf("deployments to production clusters need a plan approved by an organization operator or admin")
+	}
+	return nil
+}
+
+// RetryDeployment resumes a failed or aborted deployment, running the steps
+// that didn't complete. The retry is queued for the deployment workers; with
+// ?async=true it is followed as an operation.
+func (h *AgentHandler) RetryDeployment(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// Get queries from database (implement this based on your database schema)
-	// TODO: Implement actual database query using userID
-	queries := []map[string]interface{}{
-		{
-			"id":        1,
-			"user_id":   userID,
-			"query":     "Install Grafana and Prometheus stack",
-			"response":  "AI response here",
-			"timestamp": "2025-08-17T09:00:00Z",
-		},
+	var req RetryDeploymentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	target, status, err := h.prepareRetry(userID.(uint), c.Param("id"), req, false)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.workers.Submit(c, userID.(uint), target.record.ClusterID, models.JobRetryDeployment, "deployment/"+target.execution.ID, retryJob{ExecutionID: target.execution.ID, Request: req})
+}
+
+// retryTarget is a failed or aborted deployment to resume, with its plan and
+// the kubeconfig it resumes with
+type retryTarget struct {
+	execution  *agent.DeploymentExecution
+	record     *models.DeploymentExecutionRecord
+	plan       *agent.DeploymentPlan
+	planRecord *models.DeploymentPlanRecord
+	kubeconfig string
+}
+
+// prepareRetry loads the deployment a retry resumes, with the retry policies
+// of the request applied to its steps, or returns the status and error a
+// retry of a deployment that can't be resumed is answered with. Interrupted
+// retries resume deployments still running, whose worker stopped responding.
+func (h *AgentHandler) prepareRetry(userID uint, executionID string, req RetryDeploymentRequest, interrupted bool) (*retryTarget, int, error) {
+	execution, record, err := h.getDeploymentExecution(executionID, userID)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	if interrupted && execution.Status == "running" {
+		execution.Status = "failed"
+		execution.Error = "Interrupted when its worker stopped responding"
+	}
+	if execution.Status != "failed" && execution.Status != "aborted" {
+		return nil, http.StatusConflict, fmt.Errorf("Only failed or aborted deployments can be retried, deployment is %s", execution.Status)
+	}
+
+	plan, planRecord, err := h.getDeploymentPlan(execution.PlanID, userID)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Deployment plan not found: %v", err)
+	}
+
+	kubeconfig := req.KubeConfig
+	if kubeconfig == "" {
+		var cluster models.KubernetesCluster
+		if err := h.db.DB.Where("id = ? AND user_id = ?", record.ClusterID, userID).First(&cluster).Error; err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("Cluster not found, provide kube_config to retry")
+		}
+		kubeconfig = cluster.KubeConfig
+	}
+
+	for i := range execution.Steps {
+		if policy, ok := req.Retry[execution.Steps[i].StepID]; ok {
+			execution.Steps[i].Retry = policy
+		}
+	}
+	return &retryTarget{execution: execution, record: record, plan: plan, planRecord: planRecord, kubeconfig: kubeconfig}, http.StatusOK, nil
+}
+
+// resumeDeployment enforces the organization's policies on a deployment's
+// plan again and runs the steps that didn't complete
+func (h *AgentHandler) resumeDeployment(ctx context.Context, userID uint, target *retryTarget, scoped bool) (*DeployResponse, int, error) {
+	execution, record, plan := target.execution, target.record, target.plan
+	if err := h.enforceChartRules(userID, plan); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	if err := h.enforcePolicies(ctx, userID, plan); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	if err := h.enforceSecurityPolicy(ctx, userID, plan, target.planRecord); err != nil {
+		return nil, http.StatusForbidden, err
+	}
+	if err := h.enforceValuesSchema(plan); err != nil {
+		return nil, http.StatusUnprocessableEntity, err
+	}
+	ctx, release, err := h.lockDeployment(ctx, userID, record.ClusterID, plan)
+	if err != nil {
+		return nil, http.StatusConflict, err
+	}
+	defer release()
+	// An earlier abort request would abort the resumed deployment right away
+	if err := h.db.DB.Model(record).Updates(map[string]interface{}{"abort_requested": false, "abort_cleanup": false}).Error; err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to clear abort request: %v", err)
+	}
+	ctx = h.trackExecution(h.withGrafanaEndpoints(withRegistryCredentials(ctx, h.db, userID), userID, record.ClusterID), userID, record.ClusterID, plan)
+	run := func(kubeconfig string) (*agent.DeploymentExecution, error) {
+		return h.deploymentExecutor.ResumeDeployment(ctx, execution, plan, kubeconfig)
+	}
+	if scoped {
+		execution, err = h.scopedAccess.RunScoped(ctx, target.kubeconfig, plan, run)
+	} else {
+		execution, err = run(target.kubeconfig)
+	}
+	if err != nil {
+		return nil, http.StatusConflict, fmt.Errorf("Failed to resume deployment: %v", err)
+	}
+	diagnoseFailures(ctx, h.db, h.failureAnalyzer, plan, execution)
+	recordSBOM(ctx, target.kubeconfig, plan, execution)
+
+	if err := h.saveDeployment(userID, record.ClusterID, plan, execution); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Failed to save deployment: %v", err)
+	}
+	h.registerGrafanaInstances(userID, record.ClusterID, execution)
+	h.writeRunbookInBackground(userID, execution, plan)
+	h.publishDeployment(userID, record.ClusterID, plan, execution)
+	if ctx.Err() != nil {
+		return nil, http.StatusConflict, fmt.Errorf("deployment %s was cancelled, retry it to continue", execution.ID)
 	}
 
-	c.JSON(http.StatusOK, queries)
+	return &DeployResponse{
+		ExecutionID: execution.ID,
+		Status:      execution.Status,
+		Message:     "Deployment resumed",
+		PostDeploy:  execution.PostDeploy,
+		Diagnoses:   executionDiagnoses(execution),
+	}, http.StatusOK, nil
 }
 
-// GetDeploymentHistory returns the history of deployments
-func (h *AgentHandler) GetDeploymentHistory(c *gin.Context) {
+// GetOutdatedReleases compares installed Helm releases with Artifact Hub and,
+// when propose_plan=true, stores an upgrade plan for the outdated ones
+func (h *AgentHandler) GetOutdatedReleases(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// Get deployments from database (implement this based on your database schema)
-	// TODO: Implement actual database query using userID
-	deployments := []map[string]interface{}{
-		{
-			"id":         1,
-			"user_id":    userID,
-			"plan_id":    "plan-1",
-			"status":     "completed",
-			"start_time": "2025-08-17T09:00:00Z",
-			"end_time":   "2025-08-17T09:15:00Z",
-		},
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
 	}
 
-	c.JSON(http.StatusOK, deployments)
-}
-
-// Helper methods
+	upgrades, err := h.helmService.CheckUpgrades(c.Request.Context(), cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to check releases: %v", err)})
+		return
+	}
 
-// isDeploymentQuery checks if a query is requesting a deployment
-func (h *AgentHandler) isDeploymentQuery(query string) bool {
-	deploymentKeywords := []string{
-		"install", "deploy", "setup", "create", "add", "enable",
-		"grafana", "prometheus", "elk", "elasticsearch", "kibana",
-		"monitoring", "logging", "observability",
+	response := OutdatedReleasesResponse{
+		ClusterID:  cluster.ID,
+		Checked:    len(upgrades),
+		Outdated:   []services.ReleaseUpgrade{},
+		Unresolved: []services.ReleaseUpgrade{},
+	}
+	for _, upgrade := range upgrades {
+		if upgrade.Error != "" {
+			response.Unresolved = append(response.Unresolved, upgrade)
+		} else if upgrade.Outdated {
+			response.Outdated = append(response.Outdated, upgrade)
+		}
 	}
 
-	queryLower := strings.ToLower(query)
-	for _, keyword := range deploymentKeywords {
-		if strings.Contains(queryLower, keyword) {
-			return true
+	if c.Query("propose_plan") == "true" && len(response.Outdated) > 0 {
+		plan := h.helmService.CreateUpgradePlan(cluster.Name, response.Outdated)
+		estimatePlanTime(h.db, plan)
+		req := QueryRequest{Query: "Upgrade outdated Helm releases", ClusterID: &cluster.ID}
+		if err := h.savePlan(userID.(uint), req, plan); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save upgrade plan: %v", err)})
+			return
 		}
+		response.Plan = plan
 	}
-	return false
+
+	c.JSON(http.StatusOK, response)
 }
 
-// createDeploymentPlan creates a deployment plan for the given query
-func (h *AgentHandler) createDeploymentPlan(query string, clusterID *uint, clusterInfo string) (*agent.DeploymentPlan, error) {
-	// Analyze cluster if cluster ID is provided
-	var clusterAnalysis *agent.ClusterAnalysis
-	if clusterID != nil && clusterInfo != "" {
-		// Parse cluster info and create analysis
-		// This is a simplified version - in production, you'd want more sophisticated parsing
-		clusterAnalysis = &agent.ClusterAnalysis{
-			ClusterName: fmt.Sprintf("cluster-%d", *clusterID),
-			Version:     "v1.28.0",
-			Capabilities: agent.ClusterCapabilities{
-				HelmInstalled:    true,
-				IngressAvailable: true,
-				LoadBalancer:     true,
-				PersistentVolume: true,
-				RBACEnabled:      true,
-				NetworkPolicy:    true,
-			},
+// TestPlan renders a stored plan and dry-runs it against the target cluster
+func (h *AgentHandler) TestPlan(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req TestPlanRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 	}
 
-	// Create deployment plan using Helm service
-	plan, err := h.helmService.CreateDeploymentPlan(query, clusterAnalysis)
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create deployment plan: %w", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
 	}
 
-	return plan, nil
-}
+	cluster, err := h.getPlanCluster(record, req.ClusterID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-// getDeploymentPlan retrieves a deployment plan (placeholder implementation)
-func (h *AgentHandler) getDeploymentPlan(planID string) (*agent.DeploymentPlan, error) {
-	// In production, this would retrieve the plan from storage
-	// For now, return a placeholder plan
-	return &agent.DeploymentPlan{
-		ID:          planID,
-		Name:        "Sample Deployment Plan",
-		Description: "A sample deployment plan",
-		Charts: []agent.HelmChart{
-			{
-				Name:        "prometheus",
-				Repository:  "prometheus-community",
-				Version:     "25.0.0",
-				Description: "Prometheus monitoring stack",
-			},
-		},
-		Steps: []agent.DeploymentStep{
-			{
-				ID:          "step-1",
-				Name:        "Deploy Prometheus",
-				Description: "Deploy Prometheus monitoring stack",
-				Status:      "pending",
-			},
-		},
-	}, nil
-}
+	ctx := withRegistryCredentials(c.Request.Context(), h.db, userID.(uint))
+	report, err := h.planTester.TestPlan(ctx, plan, cluster.ID, cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Plan test failed: %v", err)})
+		return
+	}
 
-// getClusterInfo retrieves cluster information
-func (h *AgentHandler) getClusterInfo(clusterID uint) (string, error) {
-	// In production, this would retrieve cluster info from the database
-	// For now, return placeholder info
-	return fmt.Sprintf("Cluster ID: %d\nVersion: v1.28.0\nNodes: 3\nResources: Available", clusterID), nil
+	c.JSON(http.StatusOK, report)
 }
 
-// saveQuery saves a query to the database
-func (h *AgentHandler) saveQuery(c *gin.Context, req QueryRequest, resp QueryResponse) {
-	// Implement database save logic here
-	// This would save the query and response for history tracking
-}
+// PreflightPlan runs preflight checks for a stored plan against the target cluster
+func (h *AgentHandler) PreflightPlan(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req PreflightRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	cluster, err := h.getPlanCluster(record, req.ClusterID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return
+	}
+
+	report := &services.PreflightReport{
+		PlanID:    plan.ID,
+		ClusterID: cluster.ID,
+		Passed:    true,
+		CheckedAt: time.Now(),
+	}
+
+	ctx := withRegistryCredentials(c.Request.Context(), h.db, userID.(uint))
+	admission, err := h.preflight.CheckAdmissionCompatibility(ctx, client, plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Admission compatibility check failed: %v", err)})
+		return
+	}
+	report.Admission = admission
+	for _, probe := range admission.Probes {
+		if !probe.Accepted {
+			report.Passed = false
+		}
+	}
+
+	architecture, err := h.preflight.CheckArchitectureCompatibility(ctx, client, plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Architecture compatibility check failed: %v", err)})
+		return
+	}
+	report.Architecture = architecture
+	for _, image := range architecture.Images {
+		if len(image.Missing) > 0 {
+			report.Passed = false
+		}
+	}
+
+	policy, err := loadValuePolicy(h.db, userID.(uint), &cluster.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load value policy: %v", err)})
+		return
+	}
+	quotas, err := h.preflight.CheckQuotaCompatibility(ctx, client, plan, policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Quota check failed: %v", err)})
+		return
+	}
+	report.Quotas = quotas
+	for _, namespace := range quotas.Namespaces {
+		if len(namespace.Shortfalls) > 0 {
+			report.Passed = false
+		}
+	}
+
+	readiness, err := h.preflight.CheckClusterReadiness(ctx, client, plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Cluster readiness check failed: %v", err)})
+		return
+	}
+	report.Cluster = readiness
+	if !readiness.Passed() {
+		report.Passed = false
+	}
+
+	// Warn when the cluster changed since the plan was generated against it
+	if _, analysis, err := h.getClusterContext(c.Request.Context(), cluster.ID, userID.(uint)); err == nil && analysis != nil {
+		report.Drift = planDrift(h.db, record, analysis)
+	}
+
+	adjustments := append(admission.Adjustments, architecture.Adjustments...)
+	adjustments = append(adjustments, quotas.Adjustments...)
+
+	response := PreflightResponse{Report: report}
+	if req.ApplyAdjustments && len(adjustments) > 0 {
+		response.AppliedAdjustments = h.preflight.ApplyAdjustments(plan, adjustments)
+		if response.AppliedAdjustments > 0 {
+			if err := h.updatePlan(record, plan); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save adjusted plan: %v", err)})
+				return
+			}
+			response.Plan = plan
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GenerateDashboard produces Grafana dashboard JSON from a description and optionally pushes it
+func (h *AgentHandler) GenerateDashboard(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req GenerateDashboardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var clusterInfo string
+	var mesh *agent.ServiceMesh
+	if req.ClusterID != nil {
+		info, analysis, err := h.getClusterContext(c.Request.Context(), *req.ClusterID, userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to get cluster info: %v", err)})
+			return
+		}
+		clusterInfo = info
+		if analysis != nil {
+			mesh = analysis.ServiceMesh
+		}
+	}
+
+	if req.ServiceMesh && mesh == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service mesh dashboards require a cluster_id with a detected Istio or Linkerd mesh"})
+		return
+	}
+	if !req.ServiceMesh {
+		mesh = nil
+	}
+
+	generated, err := h.dashboardGenerator.Generate(c.Request.Context(), req.Description, req.Datasource, clusterInfo, mesh)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Dashboard generation failed: %v", err)})
+		return
+	}
+
+	response := GenerateDashboardResponse{GeneratedDashboard: generated}
+	if !req.Push {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	if !generated.Valid {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":     "Generated dashboard failed validation and was not pushed",
+			"dashboard": generated.Dashboard,
+			"errors":    generated.Errors,
+		})
+		return
+	}
+
+	instance, cluster, err := h.getGrafanaInstance(userID.(uint), req.GrafanaInstanceID, req.ClusterID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	apiKey, err := h.grafanaAPIKey(instance)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	grafana, closeGrafana, err := services.ConnectGrafana(c.Request.Context(), services.GrafanaEndpoint{
+		ExternalURL: instance.ExternalURL,
+		Namespace:   instance.Namespace,
+		Service:     instance.ServiceName,
+		Port:        instance.Port,
+		APIKey:      apiKey,
+	}, cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to connect to Grafana: %v", err)})
+		return
+	}
+	defer closeGrafana()
+
+	url, err := grafana.SaveDashboard(c.Request.Context(), generated.Dashboard)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to push dashboard: %v", err)})
+		return
+	}
+
+	response.Pushed = true
+	response.URL = url
+	c.JSON(http.StatusOK, response)
+}
+
+// GeneratePromQL translates a metric question into PromQL and runs it against
+// the cluster's Prometheus so the answer can be checked against real data
+func (h *AgentHandler) GeneratePromQL(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req PromQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	queryRange := time.Hour
+	if req.Range != "" {
+		parsed, err := time.ParseDuration(req.Range)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid range: %s", req.Range)})
+			return
+		}
+		queryRange = parsed
+	}
+	step := queryRange / 60
+	if req.Step != "" {
+		parsed, err := time.ParseDuration(req.Step)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid step: %s", req.Step)})
+			return
+		}
+		step = parsed
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	clusterInfo, _, err := h.getClusterContext(c.Request.Context(), cluster.ID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to get cluster info: %v", err)})
+		return
+	}
+
+	generated, err := h.promqlGenerator.Generate(c.Request.Context(), req.Question, clusterInfo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("PromQL generation failed: %v", err)})
+		return
+	}
+
+	response := PromQLResponse{GeneratedPromQL: generated}
+	if req.Execute != nil && !*req.Execute {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	prometheus, closePrometheus, err := services.ConnectPrometheus(c.Request.Context(), cluster.PrometheusURL, cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to connect to Prometheus: %v", err), "query": generated.Query})
+		return
+	}
+	defer closePrometheus()
+
+	now := time.Now()
+	var result *services.PrometheusResult
+	if generated.QueryType == "range" {
+		result, err = prometheus.QueryRange(c.Request.Context(), generated.Query, now.Add(-queryRange), now, step)
+	} else {
+		result, err = prometheus.Query(c.Request.Context(), generated.Query, now)
+	}
+
+	// Query errors are part of the answer: they show the generated PromQL is wrong
+	if apiErr, ok := err.(*services.PrometheusAPIError); ok {
+		response.Error = apiErr.Error()
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to query Prometheus: %v", err), "query": generated.Query})
+		return
+	}
+
+	response.Executed = true
+	response.Result = result
+	c.JSON(http.StatusOK, response)
+}
+
+// Troubleshoot gathers pod statuses, events, logs and node pressure for a
+// namespace or workload and asks the model for a root cause and remediation
+func (h *AgentHandler) Troubleshoot(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req TroubleshootRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return
+	}
+
+	evidence, err := h.troubleshooter.Gather(c.Request.Context(), client, req.Namespace, req.Workload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to gather evidence: %v", err)})
+		return
+	}
+
+	// The evidence is useful on its own, so a failed diagnosis still returns it
+	response := TroubleshootResponse{Evidence: evidence}
+	for _, action := range services.SuggestActions(evidence) {
+		response.Actions = append(response.Actions, SuggestedAction{
+			WorkloadAction: action,
+			Method:         http.MethodPost,
+			Path: fmt.Sprintf("/api/kubernetes/clusters/%d/workloads/%s/%s/%s?namespace=%s",
+				cluster.ID, strings.ToLower(action.Kind), action.Name, action.Action, url.QueryEscape(action.Namespace)),
+		})
+	}
+	report, err := h.troubleshooter.Diagnose(c.Request.Context(), evidence, req.Question)
+	if err != nil {
+		response.Error = fmt.Sprintf("Diagnosis unavailable: %v", err)
+	} else {
+		response.Report = report
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetQueryHistory returns the user's past queries, newest first. Accepts
+// ?cluster_id=, ?status=, ?since= and ?until= (RFC 3339 times or dates), ?q=
+// to search the text of queries and responses, plus the list parameters
+// (sortable by created_at and status).
+func (h *AgentHandler) GetQueryHistory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := parseListParams(c, "-created_at")
+	query := h.db.Reader().Model(&models.AgentQuery{}).Where("user_id = ?", userID)
+	if clusterID := c.Query("cluster_id"); clusterID != "" {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	for _, bound := range []struct{ param, condition string }{
+		{"since", "created_at >= ?"},
+		{"until", "created_at < ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := historyTime(value, bound.param == "until")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be an RFC 3339 time or a date like 2006-01-02", bound.param)})
+			return
+		}
+		query = query.Where(bound.condition, at)
+	}
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		query = searchQueries(query, search)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count query history"})
+		return
+	}
+
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at", "status": "status"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var records []models.AgentQuery
+	if err := page.Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch query history"})
+		return
+	}
+
+	queries := make([]QueryHistoryEntry, 0, len(records))
+	for _, record := range records {
+		queries = append(queries, QueryHistoryEntry{
+			ID:              record.ID,
+			ClusterID:       record.ClusterID,
+			Query:           record.Query,
+			Response:        record.Response,
+			Status:          record.Status,
+			Rating:          record.Rating,
+			FeedbackComment: record.FeedbackComment,
+			PromptVersion:   record.PromptVersion,
+			CreatedAt:       record.CreatedAt,
+		})
+	}
+
+	respondWithList(c, params, total, "queries", queries)
+}
+
+// searchQueries keeps the queries whose query or response text matches search.
+// PostgreSQL matches the words of search with its full-text search, which the
+// agent_queries search index serves; other databases match it as a substring.
+func searchQueries(query *gorm.DB, search string) *gorm.DB {
+	if query.Dialector.Name() == database.DriverPostgres {
+		return query.Where(database.QuerySearchDocument+" @@ websearch_to_tsquery('english', ?)", search)
+	}
+	pattern := "%" + strings.ToLower(search) + "%"
+	return query.Where("(LOWER(query) LIKE ? OR LOWER(response) LIKE ?)", pattern, pattern)
+}
+
+// historyTime parses an RFC 3339 time or a date. A date ending a range
+// includes its whole day.
+func historyTime(value string, end bool) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// Helper methods
+
+// isDeploymentQuery checks if a query is requesting a deployment
+func (h *AgentHandler) isDeploymentQuery(query string) bool {
+	deploymentKeywords := []string{
+		"install", "deploy", "setup", "create", "add", "enable",
+		"grafana", "prometheus", "elk", "elasticsearch", "kibana", "loki", "promtail",
+		"monitoring", "logging", "observability",
+	}
+
+	queryLower := strings.ToLower(query)
+	for _, keyword := range deploymentKeywords {
+		if strings.Contains(queryLower, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// createDeploymentPlan completes the plan the model generated for the query,
+// or creates one from a chart search when the model's plan was invalid. Named
+// stacks are always deployed from their profile's curated charts, preferring
+// the organization's templates; a template's mandatory values win over every
+// other value and its required approvals carry over to the plan.
+func (h *AgentHandler) createDeploymentPlan(ctx context.Context, userID uint, clusterID *uint, query string, generated *agent.DeploymentPlan, templates []agent.StackProfile, clusterAnalysis *agent.ClusterAnalysis, policy *services.ValuePolicy) (*agent.DeploymentPlan, error) {
+	rules, err := loadChartRules(h.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart rules: %w", err)
+	}
+	plan := generated
+	if profile := agent.MatchStackProfile(query, templates); profile != nil {
+		if len(profile.MandatoryValues) > 0 {
+			policy = services.MergeValuePolicies(policy, &services.ValuePolicy{ChartValues: profile.MandatoryValues})
+		}
+		if plan, err = h.helmService.CreateProfilePlan(profile, h.existingGrafana(userID, clusterID), clusterAnalysis, policy); err != nil {
+			return nil, fmt.Errorf("failed to create %s deployment plan: %w", profile.Name, err)
+		}
+		plan.RequiredApprovals = profile.RequiredApprovals
+	} else if plan != nil {
+		if err := h.helmService.PrepareGeneratedPlan(plan, clusterAnalysis, policy); err != nil {
+			return nil, fmt.Errorf("failed to prepare deployment plan: %w", err)
+		}
+	} else {
+		chartPolicy, err := loadChartPolicy(h.db, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chart policy: %w", err)
+		}
+		if plan, err = h.helmService.CreateDeploymentPlan(query, clusterAnalysis, policy, chartPolicy, rules); err != nil {
+			return nil, fmt.Errorf("failed to create deployment plan: %w", err)
+		}
+	}
+	// Searched charts are already allowed; the model's and curated ones are checked
+	for _, blocked := range rules.CheckPlan(plan) {
+		plan.Risks = append(plan.Risks, fmt.Sprintf("Step %s can't be deployed until its chart is replaced: %s", blocked.StepID, blocked))
+	}
+	h.tailorPlanValues(ctx, query, plan, clusterAnalysis, policy)
+	// Serve the charts on the organization's hostnames, over HTTPS when asked
+	ingressPolicy, err := loadIngressPolicy(h.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ingress policy: %w", err)
+	}
+	h.helmService.ExposePlan(plan, clusterAnalysis, ingressPolicy, services.WantsHTTPS(query))
+	// Keys the charts don't have would do nothing; they're dropped
+	h.helmService.ValidatePlanValues(plan)
+	// Values are final once they fit the namespaces' quotas and LimitRanges
+	if err := h.helmService.FitNamespaceLimits(plan, clusterAnalysis, policy); err != nil {
+		return nil, err
+	}
+	h.estimatePlanCost(ctx, plan, clusterAnalysis)
+	estimatePlanTime(h.db, plan)
+	// Warn when the plan brings the cluster's forecast exhaustion near
+	forecastPlanCapacity(h.db, plan, clusterAnalysis)
+	if clusterAnalysis != nil && clusterAnalysis.Production() {
+		plan.Risks = append(plan.Risks, fmt.Sprintf("%s is a production cluster: containers request what they may use and the plan must be approved before it deploys", clusterAnalysis.ClusterName))
+	}
+
+	return plan, nil
+}
+
+// tailorPlanValues sets the values the request calls for on each chart, from
+// the chart's documented values. Charts keep their generated values when this
+// fails, so failures are only logged.
+func (h *AgentHandler) tailorPlanValues(ctx context.Context, query string, plan *agent.DeploymentPlan, clusterAnalysis *agent.ClusterAnalysis, policy *services.ValuePolicy) {
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		services.ReportProgress(ctx, 75, fmt.Sprintf("Tailoring values of %s", step.Chart.Name))
+		tailored, err := h.planValues.TailorValues(ctx, query, step.Chart, clusterAnalysis)
+		if err != nil {
+			fmt.Printf("Failed to tailor values of chart %s: %v\n", step.Chart.Name, err)
+			continue
+		}
+		if len(tailored.Dropped) > 0 {
+			fmt.Printf("Dropped values the chart %s does not document: %s\n", step.Chart.Name, strings.Join(tailored.Dropped, ", "))
+		}
+		if len(tailored.Overrides) == 0 {
+			continue
+		}
+
+		// Regenerate so cluster settings, best practices and the value policy still win
+		values, err := h.helmService.GenerateValues(step.Chart, clusterAnalysis, tailored.Overrides, policy)
+		if err != nil {
+			fmt.Printf("Failed to regenerate values of chart %s: %v\n", step.Chart.Name, err)
+			continue
+		}
+		// The plan's chart list shares the step's values map
+		for key, value := range values {
+			step.Chart.Values[key] = value
+		}
+	}
+}
+
+// getDeploymentPlan retrieves a stored deployment plan owned by the user
+func (h *AgentHandler) getDeploymentPlan(planID string, userID uint) (*agent.DeploymentPlan, *models.DeploymentPlanRecord, error) {
+	var record models.DeploymentPlanRecord
+	if err := h.db.DB.Where("id = ? AND user_id = ?", planID, userID).First(&record).Error; err != nil {
+		return nil, nil, err
+	}
+
+	plan, err := agent.DecodePlan([]byte(record.Plan))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return plan, &record, nil
+}
+
+// savePlan stores a generated deployment plan so it can be tested and deployed
+// later. Plans of organization members wait for approval before deployment.
+func (h *AgentHandler) savePlan(userID uint, req QueryRequest, plan *agent.DeploymentPlan) error {
+	encoded, err := encodePlan(plan)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+
+	record := models.DeploymentPlanRecord{
+		ID:             plan.ID,
+		UserID:         userID,
+		OrganizationID: user.OrganizationID,
+		ClusterID:      req.ClusterID,
+		Query:          req.Query,
+		Name:           plan.Name,
+		Plan:           string(encoded),
+		Status:         models.PlanStatusDraft,
+		// Templates requiring approvals only come from organizations
+		RequiredApprovals: plan.RequiredApprovals,
+	}
+	if user.OrganizationID != nil {
+		record.Status = models.PlanStatusPendingApproval
+	}
+
+	if err := h.db.DB.Create(&record).Error; err != nil {
+		return err
+	}
+	event := services.Event{
+		Type:     services.EventPlanCreated,
+		UserID:   userID,
+		Severity: services.SeverityInfo,
+		Resource: plan.ID,
+		Title:    fmt.Sprintf("Plan %s created", plan.Name),
+		Message:  fmt.Sprintf("%s generated a %d-step plan (%s): %s", user.Email, len(plan.Steps), record.Status, req.Query),
+	}
+	if req.ClusterID != nil {
+		event.ClusterID = *req.ClusterID
+	}
+	h.bus.Publish(event)
+	if record.Status == models.PlanStatusPendingApproval {
+		h.requestApproval(&record, fmt.Sprintf("%s asked to deploy %s: %s", user.Email, plan.Name, req.Query))
+	}
+	return nil
+}
+
+// updatePlan persists changes made to a stored deployment plan. An approved
+// plan that changes needs to be approved again, by as many reviewers as it
+// requires.
+func (h *AgentHandler) updatePlan(record *models.DeploymentPlanRecord, plan *agent.DeploymentPlan) error {
+	encoded, err := encodePlan(plan)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{"plan": string(encoded)}
+	reapprove := record.Status == models.PlanStatusApproved
+	if reapprove {
+		updates["status"] = models.PlanStatusPendingApproval
+		updates["reviewed_by"] = nil
+		updates["reviewed_at"] = nil
+		updates["review_comment"] = ""
+	}
+	if err := h.db.DB.Model(record).Updates(updates).Error; err != nil {
+		return err
+	}
+	// Approvals were given to the plan as it was
+	if err := h.db.DB.Where("plan_id = ?", record.ID).Delete(&models.PlanApproval{}).Error; err != nil {
+		return err
+	}
+	if reapprove {
+		h.requestApproval(record, fmt.Sprintf("Approved plan %s changed and needs to be approved again", record.Name))
+	}
+	return nil
+}
+
+// encodePlan encodes a plan to be stored. Plaintext credentials never reach
+// the database: they are replaced with references to generated secrets, and
+// the plan warns about each value replaced, which callers should point at an
+// existing secret reference instead.
+func encodePlan(plan *agent.DeploymentPlan) ([]byte, error) {
+	plan.Warnings = nil
+	scrubbed := services.ScrubPlanSecrets(plan)
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	for _, path := range scrubbed {
+		plan.Warnings = append(plan.Warnings, fmt.Sprintf("%s held a plaintext credential and now references a generated random value; set it to a %s secret reference to keep a value of your own", path, services.SecretRefPrefix))
+	}
+	return encoded, nil
+}
+
+// requestApproval notifies the plan's organization that a plan waits for approval
+func (h *AgentHandler) requestApproval(record *models.DeploymentPlanRecord, message string) {
+	if record.OrganizationID == nil {
+		return
+	}
+	h.bus.Publish(services.Event{
+		Type:           services.EventPlanApprovalRequested,
+		OrganizationID: *record.OrganizationID,
+		Severity:       services.SeverityInfo,
+		Resource:       record.ID,
+		Title:          fmt.Sprintf("Plan %s needs approval", record.Name),
+		Message:        message,
+	})
+}
+
+// publishDeployment announces a finished deployment on the event bus
+func (h *AgentHandler) publishDeployment(userID, clusterID uint, plan *agent.DeploymentPlan, execution *agent.DeploymentExecution) {
+	event := services.Event{
+		UserID:    userID,
+		ClusterID: clusterID,
+		Resource:  execution.ID,
+	}
+	switch execution.Status {
+	case "completed":
+		event.Type = services.EventDeploymentCompleted
+		event.Severity = services.SeverityInfo
+		event.Title = fmt.Sprintf("Deployment of %s completed", plan.Name)
+		event.Message = fmt.Sprintf("All %d steps of %s completed", len(execution.Steps), execution.ID)
+	case "failed":
+		event.Type = services.EventDeploymentFailed
+		event.Severity = services.SeverityCritical
+		event.Title = fmt.Sprintf("Deployment of %s failed", plan.Name)
+		event.Message = execution.Error
+	case "aborted":
+		event.Type = services.EventDeploymentAborted
+		event.Severity = services.SeverityWarning
+		event.Title = fmt.Sprintf("Deployment of %s aborted", plan.Name)
+		event.Message = fmt.Sprintf("%s was aborted, %d of %d steps completed", execution.ID, completedSteps(execution), len(execution.Steps))
+	default:
+		return
+	}
+	h.bus.Publish(event)
+}
+
+// getPlanCluster resolves the cluster a plan targets, preferring an explicit override
+func (h *AgentHandler) getPlanCluster(record *models.DeploymentPlanRecord, override *uint, userID uint) (*models.KubernetesCluster, error) {
+	clusterID := record.ClusterID
+	if override != nil {
+		clusterID = override
+	}
+	if clusterID == nil {
+		return nil, fmt.Errorf("cluster_id is required for plans without a target cluster")
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", *clusterID, userID).First(&cluster).Error; err != nil {
+		return nil, fmt.Errorf("cluster not found")
+	}
+
+	return &cluster, nil
+}
+
+// getGrafanaInstance resolves a connected Grafana instance by ID, or the most
+// recently connected instance on the given cluster
+func (h *AgentHandler) getGrafanaInstance(userID uint, instanceID, clusterID *uint) (*models.GrafanaInstance, *models.KubernetesCluster, error) {
+	var instance models.GrafanaInstance
+	query := h.db.DB.Where("user_id = ?", userID)
+	switch {
+	case instanceID != nil:
+		query = query.Where("id = ?", *instanceID)
+	case clusterID != nil:
+		query = query.Where("cluster_id = ?", *clusterID).Order("created_at DESC")
+	default:
+		return nil, nil, fmt.Errorf("grafana_instance_id or cluster_id is required to push a dashboard")
+	}
+	if err := query.First(&instance).Error; err != nil {
+		return nil, nil, fmt.Errorf("no connected Grafana instance found")
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", instance.ClusterID, userID).First(&cluster).Error; err != nil {
+		return nil, nil, fmt.Errorf("cluster not found")
+	}
+
+	return &instance, &cluster, nil
+}
+
+// existingGrafana names the Grafana registered last for the cluster, or is
+// empty when it has none
+func (h *AgentHandler) existingGrafana(userID uint, clusterID *uint) string {
+	if clusterID == nil {
+		return ""
+	}
+	var instance models.GrafanaInstance
+	if err := h.db.Reader().Where("user_id = ? AND cluster_id = ?", userID, *clusterID).Order("created_at DESC").First(&instance).Error; err != nil {
+		return ""
+	}
+	return instance.Name
+}
+
+// withGrafanaEndpoints returns a context whose deployments add stack profile
+// datasources to the Grafana instances registered for the cluster
+func (h *AgentHandler) withGrafanaEndpoints(ctx context.Context, userID, clusterID uint) context.Context {
+	var instances []models.GrafanaInstance
+	if err := h.db.DB.Where("user_id = ? AND cluster_id = ?", userID, clusterID).Find(&instances).Error; err != nil {
+		fmt.Printf("Failed to load Grafana instances of cluster %d: %v\n", clusterID, err)
+		return ctx
+	}
+	endpoints := make([]services.GrafanaEndpoint, 0, len(instances))
+	for i := range instances {
+		apiKey, err := h.grafanaAPIKey(&instances[i])
+		if err != nil {
+			fmt.Printf("Skipping Grafana instance %d: %v\n", instances[i].ID, err)
+			continue
+		}
+		endpoints = append(endpoints, services.GrafanaEndpoint{
+			ExternalURL: instances[i].ExternalURL,
+			Namespace:   instances[i].Namespace,
+			Service:     instances[i].ServiceName,
+			Port:        instances[i].Port,
+			APIKey:      apiKey,
+		})
+	}
+	return services.WithGrafanaEndpoints(ctx, endpoints)
+}
+
+// registerGrafanaInstances records Grafana instances provisioned during a deployment
+func (h *AgentHandler) registerGrafanaInstances(userID, clusterID uint, execution *agent.DeploymentExecution) {
+	for _, result := range execution.PostDeploy {
+		if result.Name != "grafana-provisioning" || result.Status != "completed" {
+			continue
+		}
+
+		port, _ := strconv.Atoi(result.Outputs["port"])
+		apiKey, err := h.grafanaKeys.Seal([]byte(result.Outputs["api_key"]), grafanaKeyRecord(userID, clusterID))
+		if err != nil {
+			fmt.Printf("Failed to encrypt the API key of Grafana %s: %v\n", result.Outputs["service"], err)
+			continue
+		}
+		instance := models.GrafanaInstance{
+			UserID:      userID,
+			ClusterID:   clusterID,
+			Name:        result.Outputs["service"],
+			URL:         result.Outputs["url"],
+			Namespace:   result.Outputs["namespace"],
+			ServiceName: result.Outputs["service"],
+			Port:        int32(port),
+			APIKey:      apiKey,
+		}
+		h.db.DB.Create(&instance)
+	}
+}
+
+// grafanaKeyRecord is what the API key of a Grafana instance is sealed for,
+// so it can't be moved to another user's or cluster's instance
+func grafanaKeyRecord(userID, clusterID uint) string {
+	return fmt.Sprintf("grafana/%d/%d", userID, clusterID)
+}
+
+// grafanaAPIKey decrypts the API key of a Grafana instance. Keys stored before
+// they were encrypted are encrypted in place.
+func (h *AgentHandler) grafanaAPIKey(instance *models.GrafanaInstance) (string, error) {
+	record := grafanaKeyRecord(instance.UserID, instance.ClusterID)
+	apiKey, err := h.grafanaKeys.Open(instance.APIKey, record)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt the API key of Grafana %s, was it stored with another JWT_SECRET? %w", instance.Name, err)
+	}
+	if instance.APIKey != "" && !services.IsSealed(instance.APIKey) {
+		if sealed, err := h.grafanaKeys.Seal([]byte(apiKey), record); err == nil {
+			h.db.DB.Model(instance).Update("api_key", sealed)
+		}
+	}
+	return apiKey, nil
+}
+
+// getClusterContext loads a stored cluster and analyzes it live, returning the
+// prompt context and the analysis. Unreachable clusters degrade to the stored
+// metadata so queries still work.
+func (h *AgentHandler) getClusterContext(ctx context.Context, clusterID, userID uint) (string, *agent.ClusterAnalysis, error) {
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
+		return "", nil, fmt.Errorf("cluster not found")
+	}
+
+	analysis, err := h.clusterAnalyzer.AnalyzeCluster(ctx, cluster.KubeConfig)
+	if err != nil {
+		info := fmt.Sprintf("Cluster: %s (ID %d)\nVersion: %s\nStatus: %s\nLive analysis unavailable: %v",
+			cluster.Name, cluster.ID, cluster.Version, cluster.Status, err)
+		if cluster.Environment != "" {
+			info += "\nEnvironment: " + cluster.Environment
+		}
+		return info, nil, nil
+	}
+	describeCluster(analysis, &cluster)
+	if err := recordClusterSnapshot(h.db, userID, analysis); err != nil {
+		fmt.Printf("Failed to store snapshot of cluster %d: %v\n", cluster.ID, err)
+	}
+
+	info := analysis.Summary()
+	// The agent warns about plans that bring exhaustion near
+	if forecast, err := loadCapacityForecast(h.db, cluster.ID, time.Now().AddDate(0, 0, -defaultForecastDays)); err == nil && forecast.Samples > 0 {
+		info += "\nCapacity forecast:\n"
+		for _, resource := range forecast.Resources {
+			info += fmt.Sprintf("- %s: %.1f%% requested, %s\n", resource.Resource, resource.Utilization, resource.Trend)
+		}
+		for _, warning := range forecast.Warnings {
+			info += "- " + warning + "\n"
+		}
+	}
+	return info, analysis, nil
+}
+
+// getClusterWarnings summarizes the last hour of warning events about the queried
+// object, or about the whole cluster when none of them match it
+func (h *AgentHandler) getClusterWarnings(ctx context.Context, clusterID, userID uint, target string) string {
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
+		return ""
+	}
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		return ""
+	}
+
+	since := time.Now().Add(-defaultEventsWindow)
+	summary, err := h.events.Collect(ctx, cluster.ID, client, "", target, since)
+	if err == nil && target != "" && len(summary.Warnings) == 0 {
+		summary, err = h.events.Collect(ctx, cluster.ID, client, "", "", since)
+	}
+	if err != nil {
+		fmt.Printf("Failed to collect events of cluster %d: %v\n", cluster.ID, err)
+		return ""
+	}
+	return summary.Text()
+}
+
+// saveQuery saves a query to the database and embeds answered ones for
+// similar query search
+func (h *AgentHandler) saveQuery(userID uint, req QueryRequest, resp QueryResponse) uint {
+	record := models.AgentQuery{
+		UserID:        userID,
+		ClusterID:     req.ClusterID,
+		Query:         req.Query,
+		Response:      resp.Response,
+		Status:        resp.Status,
+		PromptVersion: agent.PromptVersion,
+	}
+	if err := h.db.DB.Create(&record).Error; err != nil {
+		fmt.Printf("Failed to save query history: %v\n", err)
+		return 0
+	}
+	h.embedQueryInBackground(record, resp)
+	return record.ID
+}
+
+// saveDeployment saves a deployment execution to the database, replacing any earlier state,
+// and records its chart steps for analytics
+func (h *AgentHandler) saveDeployment(userID, clusterID uint, plan *agent.DeploymentPlan, execution *agent.DeploymentExecution) error {
+	if err := saveExecution(h.db, userID, clusterID, execution, -1); err != nil {
+		return err
+	}
+
+	if err := recordChartRuns(h.db, userID, clusterID, plan, execution); err != nil {
+		fmt.Printf("Failed to record metrics for deployment %s: %v\n", execution.ID, err)
+	}
+	return nil
+}
+
+// getDeploymentExecution loads a stored execution owned by the user
+func (h *AgentHandler) getDeploymentExecution(executionID string, userID uint) (*agent.DeploymentExecution, *models.DeploymentExecutionRecord, error) {
+	var record models.DeploymentExecutionRecord
+	if err := h.db.DB.Where("id = ? AND user_id = ?", executionID, userID).First(&record).Error; err != nil {
+		return nil, nil, fmt.Errorf("deployment not found")
+	}
+
+	var execution agent.DeploymentExecution
+	if err := json.Unmarshal([]byte(record.Execution), &execution); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode stored execution: %w", err)
+	}
 
-// saveDeployment saves a deployment to the database
-func (h *AgentHandler) saveDeployment(c *gin.Context, req DeployRequest, execution *agent.DeploymentExecution) {
-	// Implement database save logic here
-	// This would save the deployment execution for history tracking
+	return &execution, &record, nil
 }
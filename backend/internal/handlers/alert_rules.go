@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GenerateAlertRulesRequest asks for alerting rules guarding the SLOs of a deployed stack
+type GenerateAlertRulesRequest struct {
+	// ExecutionID is the deployment of the stack
+	ExecutionID string `json:"execution_id" binding:"required"`
+	// SLOs describe the objectives in English, e.g. "99.9% of requests succeed over 30 days"
+	SLOs []string `json:"slos" binding:"required,min=1"`
+	// Format is prometheus_rule (default) or grafana
+	Format string `json:"format,omitempty"`
+	// Namespace receives the rules, by default the namespace of the stack's first chart
+	Namespace string `json:"namespace,omitempty"`
+	// Labels are added to the PrometheusRule, e.g. the release label the
+	// Prometheus Operator's rule selector matches
+	Labels map[string]string `json:"labels,omitempty"`
+	// DatasourceUID is the Prometheus datasource Grafana rules query, "prometheus" by default
+	DatasourceUID string `json:"datasource_uid,omitempty"`
+	// CreatePlan saves a deployment plan applying the rules, deployed with POST /api/agent/deploy
+	CreatePlan bool `json:"create_plan,omitempty"`
+}
+
+// GenerateAlertRulesResponse returns the generated rules and the plan applying them
+type GenerateAlertRulesResponse struct {
+	*services.GeneratedAlertRules
+	PlanID string `json:"plan_id,omitempty"`
+}
+
+// GenerateAlertRules writes alerting rules for the SLOs of a deployed stack,
+// validates their PromQL against the cluster's Prometheus and optionally
+// saves a plan applying them to the cluster
+func (h *AgentHandler) GenerateAlertRules(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req GenerateAlertRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Format == "" {
+		req.Format = services.AlertFormatPrometheusRule
+	}
+	if req.Format != services.AlertFormatPrometheusRule && req.Format != services.AlertFormatGrafana {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be prometheus_rule or grafana"})
+		return
+	}
+	if req.DatasourceUID == "" {
+		req.DatasourceUID = "prometheus"
+	}
+
+	execution, record, err := h.getDeploymentExecution(req.ExecutionID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	plan, _, err := h.getDeploymentPlan(execution.PlanID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", record.ClusterID, userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	namespace := req.Namespace
+	if namespace == "" && len(plan.Charts) > 0 {
+		namespace = plan.Charts[0].Namespace
+	}
+	if namespace == "" {
+		namespace = "monitoring"
+	}
+
+	clusterInfo, _, err := h.getClusterContext(c.Request.Context(), cluster.ID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to get cluster info: %v", err)})
+		return
+	}
+
+	generated, err := h.alertRules.Generate(c.Request.Context(), plan, req.SLOs, clusterInfo, namespace, req.Format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Alert rule generation failed: %v", err)})
+		return
+	}
+
+	prometheus, closePrometheus, err := services.ConnectPrometheus(c.Request.Context(), cluster.PrometheusURL, cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to connect to Prometheus: %v", err), "rules": generated.Rules})
+		return
+	}
+	defer closePrometheus()
+	if err := h.alertRules.Validate(c.Request.Context(), prometheus, generated); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to query Prometheus: %v", err), "rules": generated.Rules})
+		return
+	}
+
+	if err := h.alertRules.Render(generated, req.Labels, req.DatasourceUID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := GenerateAlertRulesResponse{GeneratedAlertRules: generated}
+	if !req.CreatePlan {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	// Rules Prometheus rejects would never fire, they aren't applied
+	if !generated.Valid() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Generated rules failed PromQL validation and no plan was created",
+			"rules": generated.Rules,
+		})
+		return
+	}
+
+	rulesPlan := services.AlertRulesPlan(generated, plan.Name)
+	query := QueryRequest{
+		Query:     fmt.Sprintf("Alerting rules for %s: %s", plan.Name, strings.Join(req.SLOs, "; ")),
+		ClusterID: &cluster.ID,
+	}
+	if err := h.savePlan(userID.(uint), query, rulesPlan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save plan: %v", err)})
+		return
+	}
+
+	response.PlanID = rulesPlan.ID
+	c.JSON(http.StatusOK, response)
+}
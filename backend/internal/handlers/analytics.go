@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// estimateHistoryWindow is how far back install durations feed plan estimates
+const estimateHistoryWindow = 90 * 24 * time.Hour
+
+// AnalyticsHandler serves platform-wide analytics to administrators
+type AnalyticsHandler struct {
+	db *database.Database
+}
+
+// NewAnalyticsHandler creates a new analytics handler
+func NewAnalyticsHandler(db *database.Database) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		db: db,
+	}
+}
+
+// DeploymentAnalyticsResponse summarizes chart install history
+type DeploymentAnalyticsResponse struct {
+	Since       time.Time             `json:"since"`
+	Runs        int                   `json:"runs"`
+	Failures    int                   `json:"failures"`
+	FailureRate float64               `json:"failure_rate"`
+	Charts      []services.ChartStats `json:"charts"`
+}
+
+// GetDeploymentAnalytics reports per-chart install durations, failure rates and
+// common failure signatures. Accepts ?days= (default 30) and ?chart=.
+func (h *AnalyticsHandler) GetDeploymentAnalytics(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive integer"})
+		return
+	}
+	since := time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+
+	var chartNames []string
+	if chart := c.Query("chart"); chart != "" {
+		chartNames = []string{chart}
+	}
+
+	runs, err := loadChartRuns(h.db, chartNames, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load deployment metrics: %v", err)})
+		return
+	}
+
+	response := DeploymentAnalyticsResponse{
+		Since:  since,
+		Runs:   len(runs),
+		Charts: services.SummarizeChartRuns(runs),
+	}
+	for _, chart := range response.Charts {
+		response.Failures += chart.Failures
+	}
+	if response.Runs > 0 {
+		response.FailureRate = float64(response.Failures) / float64(response.Runs)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// recordChartRuns stores the finished chart steps of an execution, replacing
+// what an earlier attempt of the same execution recorded
+func recordChartRuns(db *database.Database, userID, clusterID uint, plan *agent.DeploymentPlan, execution *agent.DeploymentExecution) error {
+	runs := services.ChartRuns(plan, execution)
+
+	metrics := make([]models.DeploymentStepMetric, 0, len(runs))
+	for _, run := range runs {
+		metrics = append(metrics, models.DeploymentStepMetric{
+			ExecutionID:     execution.ID,
+			StepID:          run.StepID,
+			UserID:          userID,
+			ClusterID:       clusterID,
+			Chart:           run.Chart,
+			ChartVersion:    run.ChartVersion,
+			Action:          run.Action,
+			Status:          run.Status,
+			DurationSeconds: run.Duration.Seconds(),
+			Attempts:        run.Attempts,
+			Error:           run.Error,
+			Signature:       run.Signature,
+			StartedAt:       run.StartedAt,
+		})
+	}
+
+	if err := db.DB.Where("execution_id = ?", execution.ID).Delete(&models.DeploymentStepMetric{}).Error; err != nil {
+		return err
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+	return db.DB.Create(&metrics).Error
+}
+
+// loadChartRuns reads recorded chart steps since the given time, optionally
+// limited to some charts
+func loadChartRuns(db *database.Database, charts []string, since time.Time) ([]services.ChartRun, error) {
+	query := db.Reader().Where("started_at >= ?", since)
+	if len(charts) > 0 {
+		query = query.Where("chart IN ?", charts)
+	}
+
+	var metrics []models.DeploymentStepMetric
+	if err := query.Find(&metrics).Error; err != nil {
+		return nil, err
+	}
+
+	runs := make([]services.ChartRun, 0, len(metrics))
+	for _, metric := range metrics {
+		runs = append(runs, services.ChartRun{
+			StepID:       metric.StepID,
+			Chart:        metric.Chart,
+			ChartVersion: metric.ChartVersion,
+			Action:       metric.Action,
+			Status:       metric.Status,
+			Duration:     time.Duration(metric.DurationSeconds * float64(time.Second)),
+			Attempts:     metric.Attempts,
+			Error:        metric.Error,
+			Signature:    metric.Signature,
+			StartedAt:    metric.StartedAt,
+		})
+	}
+	return runs, nil
+}
+
+// estimatePlanTime replaces a plan's estimated time with one based on the
+// install history of its charts, when there is any
+func estimatePlanTime(db *database.Database, plan *agent.DeploymentPlan) {
+	var charts []string
+	for _, step := range plan.Steps {
+		if step.Chart != nil {
+			charts = append(charts, step.Chart.Name)
+		}
+	}
+	if len(charts) == 0 {
+		return
+	}
+
+	runs, err := loadChartRuns(db, charts, time.Now().Add(-estimateHistoryWindow))
+	if err != nil {
+		fmt.Printf("Failed to load install history for plan %s: %v\n", plan.ID, err)
+		return
+	}
+
+	stats := make(map[string]services.ChartStats)
+	for _, chart := range services.SummarizeChartRuns(runs) {
+		stats[chart.Chart] = chart
+	}
+	if estimate, ok := services.EstimateDeploymentTime(plan, stats); ok {
+		plan.EstimatedTime = estimate
+	}
+}
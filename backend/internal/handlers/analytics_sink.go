@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/analytics"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// RecordEventAnalytics writes every event published on the bus to the
+// analytics sink, until the bus subscription is cancelled
+func RecordEventAnalytics(db *database.Database, bus *services.EventBus) func() {
+	events, cancel := bus.Subscribe(1024)
+	go func() {
+		for event := range events {
+			db.Analytics.Record(analytics.TableEvents, analytics.Row{
+				"time":            event.Timestamp.UTC(),
+				"type":            event.Type,
+				"user_id":         event.UserID,
+				"organization_id": event.OrganizationID,
+				"cluster_id":      event.ClusterID,
+				"severity":        event.Severity,
+				"rule":            event.Rule,
+				"resource":        event.Resource,
+				"title":           event.Title,
+			})
+		}
+	}()
+	return cancel
+}
+
+// RecordLLMUsage returns an agent usage hook writing each completion's token
+// usage to the analytics sink
+func RecordLLMUsage(db *database.Database) func(agent.Usage) {
+	return func(usage agent.Usage) {
+		db.Analytics.Record(analytics.TableLLMUsage, analytics.Row{
+			"model":             usage.Model,
+			"prompt_tokens":     usage.PromptTokens,
+			"completion_tokens": usage.CompletionTokens,
+			"total_tokens":      usage.TotalTokens,
+			"duration_ms":       usage.Duration.Milliseconds(),
+			"error":             usage.Error,
+			"provider":          usage.Provider,
+			"cost":              usage.Cost,
+		})
+	}
+}
+
+// recordClusterMetrics writes the capacity of an analyzed cluster to the
+// analytics sink. Unlike snapshots, which are only kept when the cluster
+// drifted, every analysis is recorded.
+func recordClusterMetrics(db *database.Database, userID uint, analysis *agent.ClusterAnalysis) {
+	if db.Analytics == nil {
+		return
+	}
+
+	ready := 0
+	for _, node := range analysis.Nodes {
+		if node.Status == "Ready" {
+			ready++
+		}
+	}
+	db.Analytics.Record(analytics.TableClusterMetrics, analytics.Row{
+		"time":                   time.Now().UTC(),
+		"cluster_id":             analysis.ClusterID,
+		"user_id":                userID,
+		"version":                analysis.Version,
+		"nodes":                  len(analysis.Nodes),
+		"ready_nodes":            ready,
+		"cpu_cores":              quantityValue(analysis.Resources.TotalCPU),
+		"memory_bytes":           quantityValue(analysis.Resources.TotalMemory),
+		"available_cpu_cores":    quantityValue(analysis.Resources.AvailableCPU),
+		"available_memory_bytes": quantityValue(analysis.Resources.AvailableMemory),
+		"policies":               len(analysis.Policies),
+	})
+}
+
+// quantityValue parses a Kubernetes quantity such as 3500m or 16Gi, or returns
+// 0 when it doesn't parse
+func quantityValue(value string) float64 {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0
+	}
+	return quantity.AsApproximateFloat64()
+}
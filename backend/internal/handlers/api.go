@@ -0,0 +1,23 @@
+package handlers
+
+import "grafana-ai-agent-platform/backend/pkg/api"
+
+// Request and response bodies shared with the Go client live in pkg/api
+type (
+	LoginRequest             = api.LoginRequest
+	AuthResponse             = api.AuthResponse
+	QueryRequest             = api.QueryRequest
+	QueryResponse            = api.QueryResponse
+	DeployRequest            = api.DeployRequest
+	DeployResponse           = api.DeployResponse
+	SimilarQuery             = api.SimilarQuery
+	SetContextRequest        = api.SetContextRequest
+	ConversationContext      = api.ConversationContext
+	DeploymentStatusResponse = api.DeploymentStatusResponse
+	AddClusterRequest        = api.AddClusterRequest
+	ClusterAuthRequest       = api.ClusterAuthRequest
+	CreateAPIKeyRequest      = api.CreateAPIKeyRequest
+	CreateAPIKeyResponse     = api.CreateAPIKeyResponse
+	AddClusterResponse       = api.AddClusterResponse
+	AddClustersResponse      = api.AddClustersResponse
+)
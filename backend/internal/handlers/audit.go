@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditLog lists the organization's audited actions, newest first. Accepts
+// ?cluster_id=, ?user_id=, ?action=, plus the list parameters (sortable by
+// created_at and action).
+func (h *OrganizationHandler) GetAuditLog(c *gin.Context) {
+	params := parseListParams(c, "-created_at")
+	query := h.db.Reader().Model(&models.AuditLog{}).Where("organization_id = ?", c.GetUint("organization_id"))
+	if clusterID := c.Query("cluster_id"); clusterID != "" {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count audit log"})
+		return
+	}
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at", "action": "action"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var entries []models.AuditLog
+	if err := page.Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	respondWithList(c, params, total, "entries", entries)
+}
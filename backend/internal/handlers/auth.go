@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type Claims struct {
@@ -36,16 +37,8 @@ type RegisterRequest struct {
 	Password  string `json:"password" binding:"required,min=6"`
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
-}
-
-type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
-}
-
-type AuthResponse struct {
-	Token string              `json:"token"`
-	User  models.UserResponse `json:"user"`
+	// Organization creates a new organization with the user as its admin
+	Organization string `json:"organization,omitempty"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -77,7 +70,18 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		LastName:  req.LastName,
 	}
 
-	if err := h.db.DB.Create(&user).Error; err != nil {
+	err = h.db.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Organization != "" {
+			org := models.Organization{Name: req.Organization}
+			if err := tx.Create(&org).Error; err != nil {
+				return err
+			}
+			user.OrganizationID = &org.ID
+			user.Role = models.RoleAdmin
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -92,11 +96,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	response := AuthResponse{
 		Token: token,
 		User: models.UserResponse{
-			ID:        user.ID,
-			Email:     user.Email,
-			FirstName: user.FirstName,
-			LastName:  user.LastName,
-			CreatedAt: user.CreatedAt,
+			ID:             user.ID,
+			Email:          user.Email,
+			FirstName:      user.FirstName,
+			LastName:       user.LastName,
+			OrganizationID: user.OrganizationID,
+			Role:           user.Role,
+			CreatedAt:      user.CreatedAt,
 		},
 	}
 
@@ -122,6 +128,10 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	if user.DeactivatedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+		return
+	}
 
 	// Generate JWT token
 	token, err := h.generateToken(user.ID, user.Email)
@@ -133,11 +143,13 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	response := AuthResponse{
 		Token: token,
 		User: models.UserResponse{
-			ID:        user.ID,
-			Email:     user.Email,
-			FirstName: user.FirstName,
-			LastName:  user.LastName,
-			CreatedAt: user.CreatedAt,
+			ID:             user.ID,
+			Email:          user.Email,
+			FirstName:      user.FirstName,
+			LastName:       user.LastName,
+			OrganizationID: user.OrganizationID,
+			Role:           user.Role,
+			CreatedAt:      user.CreatedAt,
 		},
 	}
 
@@ -182,11 +194,13 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	}
 
 	response := models.UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		FirstName: user.FirstName,
-		LastName:  user.LastName,
-		CreatedAt: user.CreatedAt,
+		ID:             user.ID,
+		Email:          user.Email,
+		FirstName:      user.FirstName,
+		LastName:       user.LastName,
+		OrganizationID: user.OrganizationID,
+		Role:           user.Role,
+		CreatedAt:      user.CreatedAt,
 	}
 
 	c.JSON(http.StatusOK, response)
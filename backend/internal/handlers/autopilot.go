@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// autopilotTimeout bounds choosing and applying one remediation
+const autopilotTimeout = 2 * time.Minute
+
+// autopilotRunner remediates the watch alerts of clusters that opted into
+// autopilot, one remediation per workload at a time
+type autopilotRunner struct {
+	db        *database.Database
+	bus       *services.EventBus
+	autopilot *services.AutopilotService
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+// RunAutopilot remediates OOMKilled and ImagePullBackOff alerts raised by the
+// cluster watches of clusters whose autopilot policy is enabled. Every
+// remediation, applied or not, is recorded in the audit log and applied ones
+// are published as autopilot events. It returns a function that stops it.
+func RunAutopilot(db *database.Database, bus *services.EventBus, autopilot *services.AutopilotService) func() {
+	runner := &autopilotRunner{
+		db:        db,
+		bus:       bus,
+		autopilot: autopilot,
+		inFlight:  make(map[string]bool),
+	}
+	events, cancel := bus.Subscribe(64)
+	go func() {
+		for event := range events {
+			if event.Type != services.EventClusterAlert || !autopilotRule(event.Rule) {
+				continue
+			}
+			go runner.remediate(event)
+		}
+	}()
+	return cancel
+}
+
+func autopilotRule(rule string) bool {
+	for _, autopilotRule := range services.AutopilotRules {
+		if rule == autopilotRule {
+			return true
+		}
+	}
+	return false
+}
+
+// remediate asks for and applies a remediation of an alert, unless the
+// workload was remediated within the policy's cooldown
+func (r *autopilotRunner) remediate(event services.Event) {
+	var cluster models.KubernetesCluster
+	if err := r.db.DB.Where("id = ? AND is_active = ?", event.ClusterID, true).First(&cluster).Error; err != nil {
+		return
+	}
+	policy, err := decodeAutopilotPolicy(&cluster)
+	if err != nil {
+		fmt.Printf("Failed to load autopilot policy: %v\n", err)
+		return
+	}
+	if policy == nil || !policy.Enabled {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), autopilotTimeout)
+	defer cancel()
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		fmt.Printf("Failed to connect to cluster %d for autopilot: %v\n", cluster.ID, err)
+		return
+	}
+	target, pod, err := r.autopilot.Target(ctx, client, event)
+	if err != nil {
+		fmt.Printf("Failed to find the workload of %s on cluster %d for autopilot: %v\n", event.Resource, cluster.ID, err)
+		return
+	}
+	if !policy.Covers(target.Namespace) {
+		return
+	}
+
+	key := fmt.Sprintf("%d/%s", cluster.ID, target.Resource())
+	r.mu.Lock()
+	if r.inFlight[key] {
+		r.mu.Unlock()
+		return
+	}
+	r.inFlight[key] = true
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.inFlight, key)
+		r.mu.Unlock()
+	}()
+
+	var recent int64
+	if err := r.db.DB.Model(&models.AuditLog{}).
+		Where("cluster_id = ? AND resource = ? AND action LIKE ? AND created_at > ?", cluster.ID, target.Resource(), "autopilot.%", time.Now().Add(-policy.Cooldown())).
+		Count(&recent).Error; err != nil || recent > 0 {
+		return
+	}
+
+	decision, err := r.autopilot.Decide(ctx, event, target, pod, policy)
+	if err != nil {
+		fmt.Printf("Failed to choose an autopilot remediation for %s on cluster %d: %v\n", target.Resource(), cluster.ID, err)
+		return
+	}
+
+	var applyErr error
+	if decision.Rejected == "" {
+		applyErr = r.autopilot.Apply(ctx, client, target, decision)
+	}
+	r.record(&cluster, target, decision, applyErr)
+}
+
+// record writes a remediation to the audit log and publishes the ones that
+// were attempted or rejected
+func (r *autopilotRunner) record(cluster *models.KubernetesCluster, target *services.AutopilotTarget, decision *services.AutopilotDecision, applyErr error) {
+	entry := models.AuditLog{
+		UserID:    cluster.UserID,
+		ClusterID: cluster.ID,
+		Action:    models.AuditAutopilotNone,
+		Resource:  target.Resource(),
+		Result:    models.AuditSucceeded,
+	}
+	switch decision.Action {
+	case services.AutopilotRestart:
+		entry.Action = models.AuditAutopilotRestart
+	case services.AutopilotIncreaseLimits:
+		entry.Action = models.AuditAutopilotIncreaseLimits
+	}
+	var user models.User
+	if err := r.db.DB.First(&user, cluster.UserID).Error; err == nil {
+		entry.OrganizationID = user.OrganizationID
+	}
+	if details, err := json.Marshal(gin.H{"target": target, "decision": decision}); err == nil {
+		entry.Details = string(details)
+	}
+	switch {
+	case decision.Rejected != "":
+		entry.Result = models.AuditRejected
+		entry.Error = decision.Rejected
+	case applyErr != nil:
+		entry.Result = models.AuditFailed
+		entry.Error = applyErr.Error()
+	}
+	if err := r.db.DB.Create(&entry).Error; err != nil {
+		fmt.Printf("Failed to record %s of %s on cluster %d: %v\n", entry.Action, entry.Resource, cluster.ID, err)
+	}
+
+	if decision.Action == services.AutopilotNone {
+		return
+	}
+	event := services.Event{
+		Type:      services.EventAutopilotAction,
+		UserID:    cluster.UserID,
+		ClusterID: cluster.ID,
+		Severity:  services.SeverityInfo,
+		Rule:      decision.Rule,
+		Resource:  target.Resource(),
+		Message:   decision.Reason,
+	}
+	switch entry.Result {
+	case models.AuditRejected:
+		event.Severity = services.SeverityWarning
+		event.Title = fmt.Sprintf("Autopilot didn't %s %s on %s", decision.Action, target.Resource(), cluster.Name)
+		event.Message = decision.Rejected
+	case models.AuditFailed:
+		event.Severity = services.SeverityWarning
+		event.Title = fmt.Sprintf("Autopilot failed to %s %s on %s", decision.Action, target.Resource(), cluster.Name)
+		event.Message = entry.Error
+	default:
+		event.Title = fmt.Sprintf("Autopilot applied %s to %s on %s", decision.Action, target.Resource(), cluster.Name)
+	}
+	r.bus.Publish(event)
+}
+
+// GetClusterAutopilot returns the autopilot policy of a cluster
+func (h *KubernetesHandler) GetClusterAutopilot(c *gin.Context) {
+	cluster, ok := h.userCluster(c)
+	if !ok {
+		return
+	}
+	policy, err := decodeAutopilotPolicy(cluster)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if policy == nil {
+		policy = &services.AutopilotPolicy{Actions: []string{}}
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "watching": h.watcher != nil})
+}
+
+// SetClusterAutopilot replaces the autopilot policy of a cluster
+func (h *KubernetesHandler) SetClusterAutopilot(c *gin.Context) {
+	var policy services.AutopilotPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cluster, ok := h.userCluster(c)
+	if !ok {
+		return
+	}
+
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid policy: %v", err)})
+		return
+	}
+	if err := h.db.DB.Model(cluster).Update("autopilot", string(encoded)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save autopilot policy"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "watching": h.watcher != nil})
+}
+
+// GetAutopilotActions lists the remediations autopilot chose for a cluster,
+// newest first. Accepts the list parameters (sortable by created_at and action).
+func (h *KubernetesHandler) GetAutopilotActions(c *gin.Context) {
+	cluster, ok := h.userCluster(c)
+	if !ok {
+		return
+	}
+
+	params := parseListParams(c, "-created_at")
+	query := h.db.Reader().Model(&models.AuditLog{}).Where("cluster_id = ? AND action LIKE ?", cluster.ID, "autopilot.%")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count autopilot actions"})
+		return
+	}
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at", "action": "action"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var entries []models.AuditLog
+	if err := page.Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch autopilot actions"})
+		return
+	}
+	respondWithList(c, params, total, "actions", entries)
+}
+
+// userCluster loads the user's cluster named by the path, responding with the
+// error when it can't
+func (h *KubernetesHandler) userCluster(c *gin.Context) (*models.KubernetesCluster, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return nil, false
+	}
+	return &cluster, true
+}
+
+func decodeAutopilotPolicy(cluster *models.KubernetesCluster) (*services.AutopilotPolicy, error) {
+	if cluster.Autopilot == "" {
+		return nil, nil
+	}
+	var policy services.AutopilotPolicy
+	if err := json.Unmarshal([]byte(cluster.Autopilot), &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode autopilot policy of cluster %d: %w", cluster.ID, err)
+	}
+	return &policy, nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Capability states
+const (
+	CapabilityAvailable   = "available"
+	CapabilityLimited     = "limited"
+	CapabilityUnavailable = "unavailable"
+)
+
+// Capability is a feature of the platform and whether this deployment offers it
+type Capability struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Status is available, limited or unavailable
+	Status string `json:"status"`
+	// Reason says why the capability is limited or unavailable and how to restore it
+	Reason string `json:"reason,omitempty"`
+}
+
+// Capabilities are the features this deployment offers, as the network and
+// the configured providers allow
+type Capabilities struct {
+	Offline      bool         `json:"offline"`
+	LLMProvider  string       `json:"llm_provider"`
+	Capabilities []Capability `json:"capabilities"`
+}
+
+// CapabilitiesHandler reports the features offline mode or missing providers
+// disable, so clients can explain them rather than fail
+type CapabilitiesHandler struct {
+	capabilities Capabilities
+}
+
+// NewCapabilitiesHandler creates a new capabilities handler
+func NewCapabilitiesHandler(capabilities Capabilities) *CapabilitiesHandler {
+	return &CapabilitiesHandler{capabilities: capabilities}
+}
+
+// GetCapabilities lists the platform's capabilities and their status
+func (h *CapabilitiesHandler) GetCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, h.capabilities)
+}
+
+// unavailable returns the error of a capability offline mode or a missing
+// provider disables that err stems from, answered with 503, or nil
+func unavailable(err error) error {
+	var offline *services.OfflineError
+	if errors.As(err, &offline) {
+		return offline
+	}
+	if errors.Is(err, agent.ErrLLMUnavailable) || errors.Is(err, agent.ErrEmbeddingsUnavailable) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CAPIClusterEntry is a Cluster API workload cluster with its registration in the platform
+type CAPIClusterEntry struct {
+	agent.CAPICluster
+	RegisteredClusterID *uint `json:"registered_cluster_id,omitempty"`
+}
+
+// RegisterCAPIClusterRequest optionally overrides the name of a registered workload cluster
+type RegisterCAPIClusterRequest struct {
+	Name          string `json:"name,omitempty"`
+	PrometheusURL string `json:"prometheus_url,omitempty"`
+}
+
+// GetCAPIClusters lists the workload clusters a Cluster API management cluster
+// manages, with the ID they are registered under if they are
+func (h *KubernetesHandler) GetCAPIClusters(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	capi, err := h.clusterAnalyzer.AnalyzeClusterAPI(c.Request.Context(), cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to query Cluster API: %v", err)})
+		return
+	}
+	if capi == nil {
+		c.JSON(http.StatusOK, gin.H{"management_cluster": false, "clusters": []CAPIClusterEntry{}})
+		return
+	}
+
+	var registered []models.KubernetesCluster
+	if err := h.db.DB.Where("management_cluster_id = ? AND user_id = ?", cluster.ID, userID).Find(&registered).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load registered clusters: %v", err)})
+		return
+	}
+	registeredIDs := make(map[string]uint, len(registered))
+	for _, workload := range registered {
+		registeredIDs[workload.CAPIRef] = workload.ID
+	}
+
+	entries := make([]CAPIClusterEntry, 0, len(capi.Clusters))
+	for _, workload := range capi.Clusters {
+		entry := CAPIClusterEntry{CAPICluster: workload}
+		if id, ok := registeredIDs[workload.Namespace+"/"+workload.Name]; ok {
+			entry.RegisteredClusterID = &id
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"management_cluster": true,
+		"api_version":        capi.APIVersion,
+		"clusters":           entries,
+	})
+}
+
+// RegisterCAPICluster adds a Cluster API workload cluster to the platform using
+// the kubeconfig Cluster API stores in the <name>-kubeconfig secret
+func (h *KubernetesHandler) RegisterCAPICluster(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req RegisterCAPIClusterRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var management models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&management).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	namespace, name := c.Param("namespace"), c.Param("name")
+	ref := namespace + "/" + name
+
+	var existing models.KubernetesCluster
+	if err := h.db.DB.Where("management_cluster_id = ? AND capi_ref = ? AND user_id = ?", management.ID, ref, userID).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Workload cluster is already registered", "cluster": existing})
+		return
+	}
+
+	client, err := kubernetes.NewKubernetesClient(management.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return
+	}
+	secret, err := client.GetSecretData(namespace, name+"-kubeconfig")
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to read the workload cluster's kubeconfig: %v", err)})
+		return
+	}
+	kubeconfig := secret["value"]
+	if err := kubernetes.ValidateKubeconfigFormat(kubeconfig); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Invalid kubeconfig in secret %s/%s-kubeconfig: %v", namespace, name, err)})
+		return
+	}
+
+	if req.Name == "" {
+		req.Name = name
+	}
+	cluster, workloadClient := newClusterRecord(userID.(uint), req.Name, kubeconfig, req.PrometheusURL)
+	cluster.ManagementClusterID = &management.ID
+	cluster.CAPIRef = ref
+
+	if err := h.db.DB.Create(&cluster).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cluster"})
+		return
+	}
+	if cluster.IsActive {
+		h.watch(&cluster, workloadClient)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": fmt.Sprintf("Workload cluster %s registered", ref),
+		"cluster": cluster,
+	})
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	// templateName matches the names of stack templates and the namespaces
+	// they install to
+	templateName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	// pinnedVersion matches an exact chart version, which ranges and latest aren't
+	pinnedVersion = regexp.MustCompile(`^v?\d+\.\d+\.\d+([-+][0-9A-Za-z.+-]+)?$`)
+)
+
+// maxRequiredApprovals is the most approvals a template may require of its plans
+const maxRequiredApprovals = 5
+
+// CatalogHandler serves the stack catalog: the curated templates of charts and
+// values the agent plans named stacks from, and those organizations publish
+type CatalogHandler struct {
+	db *database.Database
+}
+
+// NewCatalogHandler creates a new catalog handler
+func NewCatalogHandler(db *database.Database) *CatalogHandler {
+	return &CatalogHandler{db: db}
+}
+
+// PublishTemplateRequest publishes a stack template of the organization.
+// Charts are pinned to exact versions; MandatoryValues are values by chart
+// name plans can't override.
+type PublishTemplateRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Title       string   `json:"title" binding:"required"`
+	Description string   `json:"description"`
+	Category    string   `json:"category" binding:"required"`
+	Version     string   `json:"version" binding:"required,max=64"`
+	Keywords    []string `json:"keywords" binding:"required,min=1"`
+	// Instructions are added to the prompt of queries about the stack, one per line
+	Instructions      string                            `json:"instructions"`
+	Namespace         string                            `json:"namespace" binding:"required"`
+	Charts            []agent.ProfileChart              `json:"charts" binding:"required,min=1"`
+	MandatoryValues   map[string]map[string]interface{} `json:"mandatory_values"`
+	RequiredApprovals int                               `json:"required_approvals" binding:"min=0"`
+}
+
+// profile validates the request and returns the template it publishes
+func (r *PublishTemplateRequest) profile() (*agent.StackProfile, error) {
+	if !templateName.MatchString(r.Name) {
+		return nil, fmt.Errorf("name must be a lowercase DNS label")
+	}
+	if !slices.Contains(agent.CatalogCategories, r.Category) {
+		return nil, fmt.Errorf("category must be one of %s", strings.Join(agent.CatalogCategories, ", "))
+	}
+	if !templateName.MatchString(r.Namespace) {
+		return nil, fmt.Errorf("namespace must be a lowercase DNS label")
+	}
+	if r.RequiredApprovals > maxRequiredApprovals {
+		return nil, fmt.Errorf("required_approvals must be at most %d", maxRequiredApprovals)
+	}
+
+	profile := &agent.StackProfile{
+		Name:              r.Name,
+		Title:             strings.TrimSpace(r.Title),
+		Description:       strings.TrimSpace(r.Description),
+		Category:          r.Category,
+		Version:           strings.TrimSpace(r.Version),
+		Namespace:         r.Namespace,
+		MandatoryValues:   r.MandatoryValues,
+		RequiredApprovals: r.RequiredApprovals,
+	}
+	for _, keyword := range r.Keywords {
+		// Short keywords would match words of unrelated queries
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if len(keyword) < 3 {
+			return nil, fmt.Errorf("keywords must have at least 3 characters")
+		}
+		profile.Keywords = append(profile.Keywords, keyword)
+	}
+	for _, line := range strings.Split(r.Instructions, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "-") {
+			line = "- " + line
+		}
+		profile.Instructions += "\n" + line
+	}
+
+	releases := make(map[string]bool, len(r.Charts))
+	charts := make(map[string]bool, len(r.Charts))
+	for _, chart := range r.Charts {
+		if chart.Name == "" || chart.Repository == "" {
+			return nil, fmt.Errorf("charts need a name and a repository")
+		}
+		if !pinnedVersion.MatchString(chart.Version) {
+			return nil, fmt.Errorf("chart %s must be pinned to an exact version, not %q", chart.Name, chart.Version)
+		}
+		if chart.ReleaseName == "" {
+			chart.ReleaseName = chart.Name
+		}
+		if releases[chart.ReleaseName] {
+			return nil, fmt.Errorf("release %s is installed by two charts", chart.ReleaseName)
+		}
+		// Charts install in order, after the releases they depend on
+		for _, release := range chart.DependsOn {
+			if !releases[release] {
+				return nil, fmt.Errorf("chart %s depends on release %s, which no chart listed before it installs", chart.Name, release)
+			}
+		}
+		if chart.Values == nil {
+			chart.Values = map[string]interface{}{}
+		}
+		releases[chart.ReleaseName] = true
+		charts[chart.Name] = true
+		profile.Charts = append(profile.Charts, chart)
+	}
+	for chart := range r.MandatoryValues {
+		if !charts[chart] {
+			return nil, fmt.Errorf("mandatory values are set for chart %s, which the template doesn't install", chart)
+		}
+	}
+	return profile, nil
+}
+
+// GetCatalog lists the catalog's templates with their charts and values, the
+// organization's first. Accepts ?category=.
+func (h *CatalogHandler) GetCatalog(c *gin.Context) {
+	category := c.Query("category")
+	if category != "" && !slices.Contains(agent.CatalogCategories, category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("category must be one of %s", strings.Join(agent.CatalogCategories, ", "))})
+		return
+	}
+
+	orgTemplates, err := loadOrgTemplates(h.db, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization templates"})
+		return
+	}
+	templates := []agent.StackProfile{}
+	for _, template := range orgTemplates {
+		if category == "" || template.Category == category {
+			templates = append(templates, template)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"categories": agent.CatalogCategories,
+		"templates":  append(templates, agent.CatalogTemplates(category)...),
+	})
+}
+
+// GetCatalogTemplate returns a template of the catalog
+func (h *CatalogHandler) GetCatalogTemplate(c *gin.Context) {
+	orgTemplates, err := loadOrgTemplates(h.db, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch organization templates"})
+		return
+	}
+	for _, template := range orgTemplates {
+		if template.Name == c.Param("name") {
+			c.JSON(http.StatusOK, template)
+			return
+		}
+	}
+
+	template := agent.CatalogTemplate(c.Param("name"))
+	if template == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// PublishTemplate publishes a stack template of the organization into the
+// catalog, or a new version of one it published
+func (h *CatalogHandler) PublishTemplate(c *gin.Context) {
+	var req PublishTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	profile, err := req.profile()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Catalog lookups by name must stay unambiguous
+	if agent.CatalogTemplate(profile.Name) != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The catalog already has a template named %s", profile.Name)})
+		return
+	}
+	encoded, err := json.Marshal(profile)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid template: %v", err)})
+		return
+	}
+
+	orgID := c.GetUint("organization_id")
+	var record models.OrgStackTemplate
+	err = h.db.DB.Where("organization_id = ? AND name = ?", orgID, profile.Name).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch templates"})
+		return
+	}
+	status := http.StatusCreated
+	if err == nil {
+		if record.Version == profile.Version {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Version %s of template %s is already published, raise the version to change it", profile.Version, profile.Name)})
+			return
+		}
+		status = http.StatusOK
+	}
+
+	record.OrganizationID = orgID
+	record.Name = profile.Name
+	record.Category = profile.Category
+	record.Version = profile.Version
+	record.Template = string(encoded)
+	record.Instructions = profile.Instructions
+	record.RequiredApprovals = profile.RequiredApprovals
+	record.UpdatedBy = c.GetUint("user_id")
+	if err := h.db.DB.Save(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save template"})
+		return
+	}
+
+	var org models.Organization
+	if err := h.db.DB.Select("name").First(&org, orgID).Error; err == nil {
+		profile.Organization = org.Name
+	}
+	c.JSON(status, profile)
+}
+
+// DeleteTemplate removes the organization's template :name from the catalog
+func (h *CatalogHandler) DeleteTemplate(c *gin.Context) {
+	result := h.db.DB.Where("organization_id = ? AND name = ?", c.GetUint("organization_id"), c.Param("name")).Delete(&models.OrgStackTemplate{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted"})
+}
+
+// loadOrgTemplates returns the stack templates the user's organization
+// published, or none when the user has no organization
+func loadOrgTemplates(db *database.Database, userID uint) ([]agent.StackProfile, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+	var org models.Organization
+	if err := db.DB.Select("id", "name").First(&org, *user.OrganizationID).Error; err != nil {
+		return nil, err
+	}
+
+	var records []models.OrgStackTemplate
+	if err := db.DB.Where("organization_id = ?", *user.OrganizationID).Order("name").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	templates := make([]agent.StackProfile, 0, len(records))
+	for _, record := range records {
+		var template agent.StackProfile
+		if err := json.Unmarshal([]byte(record.Template), &template); err != nil {
+			return nil, fmt.Errorf("failed to decode template %s: %w", record.Name, err)
+		}
+		template.Instructions = record.Instructions
+		template.Organization = org.Name
+		templates = append(templates, template)
+	}
+	return templates, nil
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+	"grafana-ai-agent-platform/backend/pkg/tunnel"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultConnectorNamespace   = "grafana-ai-agent"
+	defaultConnectorClusterRole = "cluster-admin"
+	// connectorTokenPrefix marks connector tokens, e.g. in secret scanners
+	connectorTokenPrefix = "gac_"
+)
+
+// CreateConnectorClusterRequest onboards a cluster through an in-cluster
+// connector instead of a kubeconfig
+type CreateConnectorClusterRequest struct {
+	Name          string `json:"name" binding:"required"`
+	PrometheusURL string `json:"prometheus_url,omitempty"`
+	// Namespace the connector is installed in, grafana-ai-agent by default
+	Namespace string `json:"namespace,omitempty"`
+	// ClusterRole bound to the connector, cluster-admin by default. Deploying
+	// charts needs broad rights; a narrower role limits what the platform can do.
+	ClusterRole string `json:"cluster_role,omitempty"`
+}
+
+// ConnectorManifestResponse returns a connector's install manifest, which
+// holds its token and is only returned once
+type ConnectorManifestResponse struct {
+	Cluster   models.KubernetesCluster `json:"cluster"`
+	Connector models.ClusterConnector  `json:"connector"`
+	Manifest  string                   `json:"manifest"`
+	Message   string                   `json:"message"`
+}
+
+// EnableConnectors lets clusters be onboarded through in-cluster connectors
+// that dial out to publicURL, running image. An empty publicURL uses the URL
+// manifests are requested on.
+func (h *KubernetesHandler) EnableConnectors(connectors *services.ConnectorManager, publicURL, image string) {
+	h.connectors = connectors
+	h.connectorURL = publicURL
+	h.connectorImage = image
+}
+
+// CreateConnectorCluster adds a cluster that is reached through an in-cluster
+// connector, and returns the manifest installing it. The cluster is pending
+// until the connector connects.
+func (h *KubernetesHandler) CreateConnectorCluster(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if h.connectors == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "In-cluster connectors are not enabled"})
+		return
+	}
+
+	var req CreateConnectorClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Namespace == "" {
+		req.Namespace = defaultConnectorNamespace
+	}
+	if req.ClusterRole == "" {
+		req.ClusterRole = defaultConnectorClusterRole
+	}
+
+	token, err := newConnectorToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	proxyToken, err := newConnectorToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	cluster := models.KubernetesCluster{
+		UserID:        userID.(uint),
+		Name:          req.Name,
+		AuthMode:      kubernetes.AuthModeConnector,
+		ClusterURL:    "connector",
+		PrometheusURL: req.PrometheusURL,
+		Version:       "unknown",
+		Status:        "pending",
+		IsActive:      false,
+	}
+	connector := models.ClusterConnector{
+		Namespace:   req.Namespace,
+		ClusterRole: req.ClusterRole,
+		TokenHash:   hashConnectorToken(token),
+		ProxyToken:  proxyToken,
+	}
+	err = h.db.DB.Transaction(func(tx *gorm.DB) error {
+		// The kubeconfig names the cluster's ID, known once it's created
+		cluster.KubeConfig = "pending"
+		if err := tx.Create(&cluster).Error; err != nil {
+			return err
+		}
+		kubeconfig, err := kubernetes.ConnectorKubeconfig(kubernetes.ConnectorProxyPlaceholder, nil, cluster.ID, proxyToken)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&cluster).Update("kube_config", kubeconfig).Error; err != nil {
+			return err
+		}
+		cluster.KubeConfig, err = h.connectors.Kubeconfig(kubeconfig)
+		if err != nil {
+			return err
+		}
+		connector.ClusterID = cluster.ID
+		return tx.Create(&connector).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cluster"})
+		return
+	}
+
+	manifest, err := h.connectorManifest(c, &connector, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, ConnectorManifestResponse{
+		Cluster:   cluster,
+		Connector: connector,
+		Manifest:  manifest,
+		Message:   "Install the connector with kubectl apply -f on the cluster. The manifest holds the connector's token and isn't shown again.",
+	})
+}
+
+// RotateConnectorManifest issues a new token for a cluster's connector and
+// returns the manifest installing it. The old token stops working and a
+// connected connector is disconnected.
+func (h *KubernetesHandler) RotateConnectorManifest(c *gin.Context) {
+	cluster, connector, ok := h.clusterConnector(c)
+	if !ok {
+		return
+	}
+
+	token, err := newConnectorToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.db.DB.Model(connector).Update("token_hash", hashConnectorToken(token)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate connector token"})
+		return
+	}
+	h.connectors.Disconnect(cluster.ID)
+
+	manifest, err := h.connectorManifest(c, connector, token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ConnectorManifestResponse{
+		Cluster:   *cluster,
+		Connector: *connector,
+		Manifest:  manifest,
+		Message:   "Apply the manifest with kubectl apply -f to reconnect the connector with its new token. The manifest isn't shown again.",
+	})
+}
+
+// GetClusterConnector returns a cluster's connector and whether it's connected
+func (h *KubernetesHandler) GetClusterConnector(c *gin.Context) {
+	cluster, connector, ok := h.clusterConnector(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"connector": connector,
+		"connected": h.connectors.Connected(cluster.ID),
+		"status":    cluster.Status,
+	})
+}
+
+// ConnectConnector upgrades a connector's request to the tunnel the platform
+// reaches its cluster through, and holds it until it closes. Connectors
+// authenticate with the token of their manifest.
+func (h *KubernetesHandler) ConnectConnector(c *gin.Context) {
+	if h.connectors == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "In-cluster connectors are not enabled"})
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !strings.HasPrefix(token, connectorTokenPrefix) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Connector token required"})
+		return
+	}
+
+	var connector models.ClusterConnector
+	if err := h.db.DB.Where("token_hash = ?", hashConnectorToken(token)).First(&connector).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid connector token"})
+		return
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.First(&cluster, connector.ClusterID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid connector token"})
+		return
+	}
+
+	client, err := tunnel.Accept(c.Writer, c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.connectors.Attach(cluster.ID, connector.ProxyToken, client)
+	h.connectorConnected(&cluster, &connector, c.ClientIP())
+
+	<-client.Done()
+	h.connectors.Detach(cluster.ID, client)
+	h.connectorDisconnected(&cluster, &connector)
+}
+
+// connectorConnected checks the cluster through the tunnel and starts
+// watching it. Its stored kubeconfig names no proxy, so it's left as it is.
+func (h *KubernetesHandler) connectorConnected(cluster *models.KubernetesCluster, connector *models.ClusterConnector, remoteAddr string) {
+	now := time.Now()
+	if err := h.db.DB.Model(connector).Updates(map[string]interface{}{"connected_at": now, "remote_addr": remoteAddr}).Error; err != nil {
+		fmt.Printf("Failed to record connection of cluster %d's connector: %v\n", cluster.ID, err)
+	}
+
+	kubeconfig, err := h.connectors.Kubeconfig(cluster.KubeConfig)
+	if err != nil {
+		fmt.Printf("Failed to build kubeconfig of cluster %d: %v\n", cluster.ID, err)
+		return
+	}
+	updates := map[string]interface{}{"status": "inactive", "is_active": false}
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	active := false
+	if err == nil {
+		if info, err := client.ValidateCluster(); err == nil && info.IsValid {
+			active = true
+			updates["status"], updates["is_active"], updates["version"] = "active", true, info.Version
+		}
+	}
+	if err := h.db.DB.Model(cluster).Updates(updates).Error; err != nil {
+		fmt.Printf("Failed to update cluster %d after its connector connected: %v\n", cluster.ID, err)
+		return
+	}
+	if active {
+		h.watch(cluster, client)
+	}
+}
+
+// connectorDisconnected marks a cluster disconnected, unless its connector
+// already reconnected
+func (h *KubernetesHandler) connectorDisconnected(cluster *models.KubernetesCluster, connector *models.ClusterConnector) {
+	if err := h.db.DB.Model(connector).Update("disconnected_at", time.Now()).Error; err != nil {
+		fmt.Printf("Failed to record disconnection of cluster %d's connector: %v\n", cluster.ID, err)
+	}
+	if h.connectors.Connected(cluster.ID) {
+		return
+	}
+	h.unwatch(cluster.ID)
+	if err := h.db.DB.Model(cluster).Updates(map[string]interface{}{"status": "disconnected", "is_active": false}).Error; err != nil {
+		fmt.Printf("Failed to update cluster %d after its connector disconnected: %v\n", cluster.ID, err)
+	}
+}
+
+// clusterConnector loads the user's cluster and its connector, responding
+// with the error when it can't
+func (h *KubernetesHandler) clusterConnector(c *gin.Context) (*models.KubernetesCluster, *models.ClusterConnector, bool) {
+	if h.connectors == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "In-cluster connectors are not enabled"})
+		return nil, nil, false
+	}
+	cluster, ok := h.userCluster(c)
+	if !ok {
+		return nil, nil, false
+	}
+	var connector models.ClusterConnector
+	if err := h.db.DB.Where("cluster_id = ?", cluster.ID).First(&connector).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster was not onboarded with a connector"})
+		return nil, nil, false
+	}
+	return cluster, &connector, true
+}
+
+// connectorManifest renders the manifest installing a connector with a token
+func (h *KubernetesHandler) connectorManifest(c *gin.Context, connector *models.ClusterConnector, token string) (string, error) {
+	serverURL := h.connectorURL
+	if serverURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		serverURL = scheme + "://" + c.Request.Host
+	}
+	return kubernetes.ConnectorManifest(kubernetes.ConnectorManifestOptions{
+		Namespace:   connector.Namespace,
+		ServerURL:   serverURL,
+		Token:       token,
+		Image:       h.connectorImage,
+		ClusterRole: connector.ClusterRole,
+	})
+}
+
+// newConnectorToken returns a random connector token
+func newConnectorToken() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate connector token: %w", err)
+	}
+	return connectorTokenPrefix + hex.EncodeToString(secret), nil
+}
+
+func hashConnectorToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
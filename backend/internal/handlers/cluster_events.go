@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultEventsWindow is how far back warning summaries look by default
+const defaultEventsWindow = time.Hour
+
+// GetClusterEvents summarizes a cluster's recent warning events. Supports
+// ?namespace=, ?object= (substring of the object name) and ?since_minutes=.
+func (h *KubernetesHandler) GetClusterEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	window := defaultEventsWindow
+	if value := c.Query("since_minutes"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since_minutes must be a positive integer"})
+			return
+		}
+		window = time.Duration(minutes) * time.Minute
+	}
+
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return
+	}
+
+	summary, err := h.events.Collect(c.Request.Context(), cluster.ID, client, c.Query("namespace"), c.Query("object"), time.Now().Add(-window))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to collect events: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
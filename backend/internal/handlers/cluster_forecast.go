@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultForecastDays is how many days of snapshots forecasts fit their trends through
+const defaultForecastDays = 30
+
+// GetClusterForecast projects when the requests of a cluster's pods will
+// exhaust its CPU, memory and ephemeral storage, from a linear trend through
+// the usage of its snapshots. ?days= sets how many days of snapshots are used
+// (30 by default) and ?plan_id= adds how a plan brings exhaustion forward.
+func (h *KubernetesHandler) GetClusterForecast(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	days := defaultForecastDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a number from 1 to 365"})
+			return
+		}
+		days = parsed
+	}
+
+	var plan *agent.DeploymentPlan
+	if planID := c.Query("plan_id"); planID != "" {
+		var record models.DeploymentPlanRecord
+		if err := h.db.DB.Where("id = ? AND user_id = ?", planID, userID).First(&record).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deployment plan not found"})
+			return
+		}
+		decoded, err := agent.DecodePlan([]byte(record.Plan))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to decode plan: %v", err)})
+			return
+		}
+		plan = decoded
+	}
+
+	forecast, err := loadCapacityForecast(h.db, cluster.ID, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to forecast capacity: %v", err)})
+		return
+	}
+	if plan != nil {
+		forecast.PlanWarnings = forecast.ForecastPlan(plan.ResourceImpact)
+	}
+	c.JSON(http.StatusOK, forecast)
+}
+
+// loadCapacityForecast forecasts a cluster's capacity from the usage of its
+// snapshots taken since the given time
+func loadCapacityForecast(db *database.Database, clusterID uint, since time.Time) (*services.CapacityForecast, error) {
+	var snapshots []models.ClusterSnapshot
+	if err := db.DB.Where("cluster_id = ? AND created_at >= ?", clusterID, since).Order("created_at ASC").Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to load cluster snapshots: %w", err)
+	}
+
+	samples := make([]services.CapacitySample, 0, len(snapshots))
+	for i := range snapshots {
+		analysis, err := decodeSnapshot(&snapshots[i])
+		if err != nil {
+			fmt.Printf("Skipping snapshot in capacity forecast: %v\n", err)
+			continue
+		}
+		if sample, ok := services.NewCapacitySample(snapshots[i].CreatedAt, analysis); ok {
+			samples = append(samples, sample)
+		}
+	}
+	return services.ForecastCapacity(clusterID, samples), nil
+}
+
+// forecastPlanCapacity adds to a plan's risks when its requests would exhaust
+// the cluster within the forecast horizon. Forecasts that fail are skipped.
+func forecastPlanCapacity(db *database.Database, plan *agent.DeploymentPlan, clusterAnalysis *agent.ClusterAnalysis) {
+	if clusterAnalysis == nil || clusterAnalysis.ClusterID == 0 {
+		return
+	}
+	forecast, err := loadCapacityForecast(db, clusterAnalysis.ClusterID, time.Now().AddDate(0, 0, -defaultForecastDays))
+	if err != nil {
+		fmt.Printf("Failed to forecast capacity of cluster %d: %v\n", clusterAnalysis.ClusterID, err)
+		return
+	}
+	plan.Risks = append(plan.Risks, forecast.ForecastPlan(plan.ResourceImpact)...)
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// healthCheckWorkers bounds the clusters checked at once
+const healthCheckWorkers = 8
+
+// ClusterHealthHistory is a cluster's connectivity over a period, for uptime charts
+type ClusterHealthHistory struct {
+	ClusterID uint                        `json:"cluster_id"`
+	Since     time.Time                   `json:"since"`
+	Checks    []models.ClusterHealthCheck `json:"checks"`
+	// UptimePercent is the share of checks that reached the cluster
+	UptimePercent    float64 `json:"uptime_percent"`
+	AverageLatencyMs int64   `json:"average_latency_ms"`
+}
+
+// StartHealthMonitor checks the connectivity of every stored cluster each
+// interval, keeping their status and version current and recording the
+// outcome for uptime history
+func (h *KubernetesHandler) StartHealthMonitor(cfg config.HealthConfig) {
+	var running atomic.Bool
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			// Skip a round while clusters that hang are still being checked
+			if !running.CompareAndSwap(false, true) {
+				continue
+			}
+			h.checkClusterHealth(now, cfg)
+			h.pruneHealthChecks(now.Add(-cfg.Retention))
+			running.Store(false)
+		}
+	}()
+}
+
+// checkClusterHealth claims the clusters due for a check and checks them. The
+// claim sets health_checked_at first, so several API replicas never check a
+// cluster twice in one interval.
+func (h *KubernetesHandler) checkClusterHealth(now time.Time, cfg config.HealthConfig) {
+	var clusters []models.KubernetesCluster
+	if err := h.db.DB.Where("health_checked_at IS NULL OR health_checked_at <= ?", now.Add(-cfg.Interval/2)).
+		Find(&clusters).Error; err != nil {
+		fmt.Printf("Failed to load clusters to check: %v\n", err)
+		return
+	}
+
+	claimed := make([]models.KubernetesCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		claim := h.db.DB.Model(&models.KubernetesCluster{}).Where("id = ?", cluster.ID)
+		if cluster.HealthCheckedAt == nil {
+			claim = claim.Where("health_checked_at IS NULL")
+		} else {
+			claim = claim.Where("health_checked_at = ?", *cluster.HealthCheckedAt)
+		}
+		result := claim.Update("health_checked_at", now)
+		if result.Error != nil {
+			fmt.Printf("Failed to claim the health check of cluster %d: %v\n", cluster.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue // another replica checks it
+		}
+		claimed = append(claimed, cluster)
+	}
+	h.checkClusters(claimed, cfg.FailureThreshold)
+}
+
+// refreshClusterHealth checks the given clusters, or every cluster without
+// IDs, right away instead of at their next scheduled check
+func (h *KubernetesHandler) refreshClusterHealth(clusterIDs []uint, failureThreshold int) ([]models.ClusterHealthCheck, error) {
+	query := h.db.DB.Model(&models.KubernetesCluster{})
+	if len(clusterIDs) > 0 {
+		query = query.Where("id IN ?", clusterIDs)
+	}
+	var clusters []models.KubernetesCluster
+	if err := query.Find(&clusters).Error; err != nil {
+		return nil, err
+	}
+	// The health monitor skips the clusters checked now in its next round
+	ids := make([]uint, len(clusters))
+	for i, cluster := range clusters {
+		ids[i] = cluster.ID
+	}
+	if len(ids) > 0 {
+		if err := h.db.DB.Model(&models.KubernetesCluster{}).Where("id IN ?", ids).Update("health_checked_at", time.Now()).Error; err != nil {
+			return nil, err
+		}
+	}
+	return h.checkClusters(clusters, failureThreshold), nil
+}
+
+// checkClusters checks clusters concurrently and returns the outcomes in order
+func (h *KubernetesHandler) checkClusters(clusters []models.KubernetesCluster, failureThreshold int) []models.ClusterHealthCheck {
+	checks := make([]models.ClusterHealthCheck, len(clusters))
+	workers := make(chan struct{}, healthCheckWorkers)
+	var wg sync.WaitGroup
+	for i := range clusters {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			checks[i] = h.checkCluster(&clusters[i], failureThreshold)
+		}(i)
+	}
+	wg.Wait()
+	return checks
+}
+
+// checkCluster validates a cluster's connection and records the outcome. A
+// reachable cluster becomes active again at once; an active one becomes
+// inactive after failureThreshold consecutive failed checks.
+func (h *KubernetesHandler) checkCluster(cluster *models.KubernetesCluster, failureThreshold int) models.ClusterHealthCheck {
+	check := models.ClusterHealthCheck{ClusterID: cluster.ID, CheckedAt: time.Now()}
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err == nil {
+		var clusterInfo *kubernetes.ClusterInfo
+		clusterInfo, err = client.ValidateCluster()
+		if err == nil && !clusterInfo.IsValid {
+			err = fmt.Errorf("%s", clusterInfo.Error)
+		}
+		if err == nil {
+			check.Reachable = true
+			check.Version = clusterInfo.Version
+		}
+	}
+	check.LatencyMs = time.Since(check.CheckedAt).Milliseconds()
+	if err != nil {
+		check.Error = err.Error()
+	}
+
+	if err := h.db.DB.Create(&check).Error; err != nil {
+		fmt.Printf("Failed to record the health check of cluster %d: %v\n", cluster.ID, err)
+	}
+
+	switch {
+	case check.Reachable:
+		updates := map[string]interface{}{"status": "active", "is_active": true, "version": check.Version}
+		if err := h.db.DB.Model(cluster).Updates(updates).Error; err != nil {
+			fmt.Printf("Failed to update the status of cluster %d: %v\n", cluster.ID, err)
+			return check
+		}
+		if cluster.Status != "active" {
+			h.watch(cluster, client)
+		}
+	case cluster.IsActive && h.consecutiveHealthFailures(cluster.ID, failureThreshold):
+		updates := map[string]interface{}{"status": "inactive", "is_active": false}
+		if err := h.db.DB.Model(cluster).Updates(updates).Error; err != nil {
+			fmt.Printf("Failed to update the status of cluster %d: %v\n", cluster.ID, err)
+			return check
+		}
+		h.unwatch(cluster.ID)
+		// Watched clusters already raised the alert when their pings failed
+		if h.watcher == nil {
+			h.bus.Publish(services.Event{
+				Type:      services.EventClusterUnreachable,
+				UserID:    cluster.UserID,
+				ClusterID: cluster.ID,
+				Severity:  services.SeverityCritical,
+				Rule:      services.RuleUnreachable,
+				Resource:  "apiserver",
+				Title:     fmt.Sprintf("Cluster %s unreachable", cluster.Name),
+				Message:   fmt.Sprintf("%d health checks in a row failed, the cluster is inactive: %s", failureThreshold, check.Error),
+			})
+		}
+	}
+	return check
+}
+
+// consecutiveHealthFailures reports whether the latest threshold checks of a
+// cluster all failed
+func (h *KubernetesHandler) consecutiveHealthFailures(clusterID uint, threshold int) bool {
+	if threshold < 1 {
+		threshold = 1
+	}
+	var checks []models.ClusterHealthCheck
+	if err := h.db.DB.Select("reachable").Where("cluster_id = ?", clusterID).
+		Order("checked_at DESC").Limit(threshold).Find(&checks).Error; err != nil {
+		fmt.Printf("Failed to load health checks of cluster %d: %v\n", clusterID, err)
+		return false
+	}
+	if len(checks) < threshold {
+		return false
+	}
+	for _, check := range checks {
+		if check.Reachable {
+			return false
+		}
+	}
+	return true
+}
+
+// pruneHealthChecks deletes the check history older than the retention period
+func (h *KubernetesHandler) pruneHealthChecks(before time.Time) {
+	if err := h.db.DB.Where("checked_at < ?", before).Delete(&models.ClusterHealthCheck{}).Error; err != nil {
+		fmt.Printf("Failed to prune cluster health checks: %v\n", err)
+	}
+}
+
+// GetClusterHealthHistory returns a cluster's connectivity checks, oldest first,
+// with its uptime over the period. ?since= is a duration like 24h (the
+// default) or an RFC 3339 time.
+func (h *KubernetesHandler) GetClusterHealthHistory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	if value := c.Query("since"); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+			since = time.Now().Add(-duration)
+		} else if at, err := time.Parse(time.RFC3339, value); err == nil {
+			since = at
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a duration like 24h or an RFC 3339 time"})
+			return
+		}
+	}
+
+	history := ClusterHealthHistory{ClusterID: cluster.ID, Since: since, Checks: []models.ClusterHealthCheck{}}
+	if err := h.db.Reader().Where("cluster_id = ? AND checked_at >= ?", cluster.ID, since).
+		Order("checked_at ASC").Find(&history.Checks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load health history: %v", err)})
+		return
+	}
+
+	var reachable, latency int64
+	for _, check := range history.Checks {
+		if check.Reachable {
+			reachable++
+			latency += check.LatencyMs
+		}
+	}
+	if len(history.Checks) > 0 {
+		history.UptimePercent = float64(reachable) * 100 / float64(len(history.Checks))
+	}
+	if reachable > 0 {
+		history.AverageLatencyMs = latency / reachable
+	}
+
+	c.JSON(http.StatusOK, history)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClusterReport exports a health report of the cluster for stakeholders:
+// nodes, capacity, capabilities, security posture, installed stacks and the
+// agent's recommendations. ?format= is markdown (default) or pdf. With
+// ?async=true the report is written as an operation whose result is the file.
+func (h *KubernetesHandler) GetClusterReport(c *gin.Context) {
+	cluster, ok := h.userCluster(c)
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "markdown")
+	if format != "markdown" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be markdown or pdf"})
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	if wantsAsync(c) {
+		operation, err := h.operations.Start(userID, models.OperationExport, fmt.Sprintf("cluster/%d", cluster.ID), func(ctx context.Context) (interface{}, error) {
+			return h.exportClusterReport(ctx, userID, cluster, format)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithOperation(c, operation)
+		return
+	}
+
+	output, err := h.exportClusterReport(c.Request.Context(), userID, cluster, format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", output.Filename))
+	c.Data(http.StatusOK, output.ContentType, output.Data)
+}
+
+// exportClusterReport analyzes a cluster, recording the snapshot, and renders
+// its report in format
+func (h *KubernetesHandler) exportClusterReport(ctx context.Context, userID uint, cluster *models.KubernetesCluster, format string) (*OperationOutput, error) {
+	services.ReportProgress(ctx, 0, fmt.Sprintf("Analyzing cluster %s", cluster.Name))
+	analysis, err := h.clusterAnalyzer.AnalyzeCluster(ctx, cluster.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze cluster: %w", err)
+	}
+	describeCluster(analysis, cluster)
+	if err := recordClusterSnapshot(h.db, userID, analysis); err != nil {
+		fmt.Printf("Failed to store snapshot of cluster %d: %v\n", cluster.ID, err)
+	}
+
+	report := h.reports.Generate(ctx, analysis, cluster.KubeConfig)
+	services.ReportProgress(ctx, 90, "Rendering report")
+	filename := fmt.Sprintf("cluster-report-%d-%s", cluster.ID, report.GeneratedAt.Format("2006-01-02"))
+	if format == "pdf" {
+		data, err := report.PDF()
+		if err != nil {
+			return nil, err
+		}
+		return &OperationOutput{ContentType: "application/pdf", Filename: filename + ".pdf", Data: data}, nil
+	}
+	return &OperationOutput{
+		ContentType: "text/markdown; charset=utf-8",
+		Filename:    filename + ".md",
+		Data:        []byte(report.Markdown()),
+	}, nil
+}
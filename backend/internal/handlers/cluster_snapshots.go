@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClusterDrift diffs the two latest drift snapshots of a cluster. With
+// ?plan_id= it diffs the snapshot the plan was generated against with the latest
+// one, and ?refresh=true analyzes the cluster first.
+func (h *KubernetesHandler) GetClusterDrift(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	if c.Query("refresh") == "true" {
+		analysis, err := h.clusterAnalyzer.AnalyzeCluster(c.Request.Context(), cluster.KubeConfig)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to analyze cluster: %v", err)})
+			return
+		}
+		describeCluster(analysis, &cluster)
+		if err := recordClusterSnapshot(h.db, cluster.UserID, analysis); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store cluster snapshot: %v", err)})
+			return
+		}
+	}
+
+	var snapshots []models.ClusterSnapshot
+	if err := h.db.DB.Where("cluster_id = ? AND usage_sample = ?", cluster.ID, false).Order("created_at DESC").Limit(2).Find(&snapshots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load cluster snapshots: %v", err)})
+		return
+	}
+	if len(snapshots) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No snapshots recorded for this cluster yet, use ?refresh=true to take one"})
+		return
+	}
+	latest := snapshots[0]
+
+	var baseline *models.ClusterSnapshot
+	if planID := c.Query("plan_id"); planID != "" {
+		var plan models.DeploymentPlanRecord
+		if err := h.db.DB.Where("id = ? AND user_id = ?", planID, userID).First(&plan).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deployment plan not found"})
+			return
+		}
+		baseline, _ = snapshotAt(h.db, cluster.ID, plan.CreatedAt)
+		if baseline == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No snapshot of this cluster predates the plan"})
+			return
+		}
+	} else if len(snapshots) > 1 {
+		baseline = &snapshots[1]
+	}
+
+	if baseline == nil || baseline.ID == latest.ID {
+		c.JSON(http.StatusOK, &services.ClusterDrift{From: latest.CreatedAt, To: latest.CreatedAt, Warnings: []string{}})
+		return
+	}
+
+	drift, err := diffSnapshots(baseline, &latest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, drift)
+}
+
+// recordClusterSnapshot stores an analysis when it drifted from the latest
+// snapshot, so consecutive drift snapshots always differ. Analyses that didn't
+// drift are still stored as usage samples every UsageSampleInterval, which
+// capacity forecasts fit their trends through.
+func recordClusterSnapshot(db *database.Database, userID uint, analysis *agent.ClusterAnalysis) error {
+	recordClusterMetrics(db, userID, analysis)
+
+	var usageSample bool
+	var latest models.ClusterSnapshot
+	if err := db.DB.Where("cluster_id = ?", analysis.ClusterID).Order("created_at DESC").First(&latest).Error; err == nil {
+		previous, err := decodeSnapshot(&latest)
+		if err == nil && !services.DiffClusterAnalyses(previous, analysis, latest.CreatedAt, time.Now()).Drifted {
+			if analysis.Usage == nil || time.Since(latest.CreatedAt) < services.UsageSampleInterval {
+				return nil
+			}
+			usageSample = true
+		}
+	}
+
+	encoded, err := json.Marshal(analysis)
+	if err != nil {
+		return fmt.Errorf("failed to encode cluster analysis: %w", err)
+	}
+	return db.DB.Create(&models.ClusterSnapshot{
+		ClusterID:   analysis.ClusterID,
+		UserID:      userID,
+		Analysis:    string(encoded),
+		UsageSample: usageSample,
+	}).Error
+}
+
+// latestSnapshotHash identifies the cluster's state by its latest drift
+// snapshot, which only changes when the cluster drifted
+func latestSnapshotHash(db *database.Database, clusterID uint) string {
+	var latest models.ClusterSnapshot
+	if err := db.DB.Where("cluster_id = ? AND usage_sample = ?", clusterID, false).Order("created_at DESC").First(&latest).Error; err != nil {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(latest.Analysis))
+	return hex.EncodeToString(hash[:])
+}
+
+// snapshotAt returns the snapshot describing the cluster at the given time
+func snapshotAt(db *database.Database, clusterID uint, at time.Time) (*models.ClusterSnapshot, error) {
+	var snapshot models.ClusterSnapshot
+	if err := db.DB.Where("cluster_id = ? AND created_at <= ?", clusterID, at).Order("created_at DESC").First(&snapshot).Error; err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// planDrift reports how the cluster changed since the plan was generated, or
+// nil when no snapshot predates the plan
+func planDrift(db *database.Database, record *models.DeploymentPlanRecord, analysis *agent.ClusterAnalysis) *services.ClusterDrift {
+	baseline, err := snapshotAt(db, analysis.ClusterID, record.CreatedAt)
+	if err != nil {
+		return nil
+	}
+	previous, err := decodeSnapshot(baseline)
+	if err != nil {
+		fmt.Printf("Failed to decode snapshot %d: %v\n", baseline.ID, err)
+		return nil
+	}
+	return services.DiffClusterAnalyses(previous, analysis, baseline.CreatedAt, time.Now())
+}
+
+func diffSnapshots(from, to *models.ClusterSnapshot) (*services.ClusterDrift, error) {
+	previous, err := decodeSnapshot(from)
+	if err != nil {
+		return nil, err
+	}
+	current, err := decodeSnapshot(to)
+	if err != nil {
+		return nil, err
+	}
+	return services.DiffClusterAnalyses(previous, current, from.CreatedAt, to.CreatedAt), nil
+}
+
+func decodeSnapshot(snapshot *models.ClusterSnapshot) (*agent.ClusterAnalysis, error) {
+	var analysis agent.ClusterAnalysis
+	if err := json.Unmarshal([]byte(snapshot.Analysis), &analysis); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot %d: %w", snapshot.ID, err)
+	}
+	return &analysis, nil
+}
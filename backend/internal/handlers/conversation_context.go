@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// SetContext sets the cluster, and optionally the namespace, that the queries
+// of the caller's session are about when they don't name a cluster. The
+// context lasts as long as the login token, or the API key, it was set with.
+func (h *AgentHandler) SetContext(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req SetContextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := validateNamespace(req.Namespace); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", req.ClusterID, userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	record := models.ConversationContext{
+		SessionID: sessionID,
+		UserID:    userID.(uint),
+		ClusterID: cluster.ID,
+		Namespace: req.Namespace,
+	}
+	if expiresAt, ok := c.Get("session_expires_at"); ok {
+		expires := expiresAt.(time.Time)
+		record.ExpiresAt = &expires
+	}
+	err := h.db.DB.Transaction(func(tx *gorm.DB) error {
+		// Contexts of expired logins can't be used anymore
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.ConversationContext{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "session_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "cluster_id", "namespace", "expires_at", "updated_at"}),
+		}).Create(&record).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save context: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, ConversationContext{
+		ClusterID:   cluster.ID,
+		ClusterName: cluster.Name,
+		Namespace:   record.Namespace,
+		FromSession: true,
+	})
+}
+
+// GetContext returns the context of the caller's session
+func (h *AgentHandler) GetContext(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	session, err := h.sessionContext(userID.(uint), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load context: %v", err)})
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No context set"})
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// ClearContext removes the context of the caller's session, so queries are
+// about no cluster unless they name one
+func (h *AgentHandler) ClearContext(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	err := h.db.DB.Where("session_id = ? AND user_id = ?", c.GetString("session_id"), userID).Delete(&models.ConversationContext{}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to clear context: %v", err)})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Context cleared"})
+}
+
+// sessionContext returns the context of a session, nil when none is set, its
+// login expired or its cluster was removed
+func (h *AgentHandler) sessionContext(userID uint, sessionID string) (*ConversationContext, error) {
+	if sessionID == "" {
+		return nil, nil
+	}
+	var record models.ConversationContext
+	err := h.db.DB.Preload("Cluster").
+		Where("session_id = ? AND user_id = ?", sessionID, userID).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Cluster.ID == 0 || record.Cluster.UserID != userID {
+		return nil, nil
+	}
+	return &ConversationContext{
+		ClusterID:   record.ClusterID,
+		ClusterName: record.Cluster.Name,
+		Namespace:   record.Namespace,
+		FromSession: true,
+	}, nil
+}
+
+// queryContext fills in the cluster and namespace of a query that names no
+// cluster from the session's context, and returns the context the query is
+// about, nil when it is about no cluster
+func (h *AgentHandler) queryContext(c *gin.Context, userID uint, req *QueryRequest) (*ConversationContext, error) {
+	if req.ClusterID == nil {
+		session, err := h.sessionContext(userID, c.GetString("session_id"))
+		if err != nil || session == nil {
+			return nil, err
+		}
+		req.ClusterID = &session.ClusterID
+		if req.Namespace == "" {
+			req.Namespace = session.Namespace
+		} else {
+			session.Namespace = req.Namespace
+		}
+		return session, nil
+	}
+
+	// Unknown clusters fail when the query loads the cluster's information
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", *req.ClusterID, userID).First(&cluster).Error; err != nil {
+		return nil, nil
+	}
+	return &ConversationContext{
+		ClusterID:   cluster.ID,
+		ClusterName: cluster.Name,
+		Namespace:   req.Namespace,
+	}, nil
+}
+
+// validateNamespace checks that a namespace, when given, is a valid Kubernetes
+// namespace name
+func validateNamespace(namespace string) error {
+	if namespace == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, "; "))
+	}
+	return nil
+}
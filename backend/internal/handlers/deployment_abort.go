@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AbortDeploymentRequest selects whether an aborted deployment is cleaned up
+type AbortDeploymentRequest struct {
+	// Cleanup uninstalls the releases the deployment installed, except those
+	// that existed before it
+	Cleanup bool `json:"cleanup"`
+}
+
+// AbortDeployment stops a running deployment: its running steps are stopped,
+// killing their Helm operations, and steps that didn't start are skipped. The
+// deployment ends as aborted and can be resumed with retry. A deployment
+// running on another replica is aborted by it within a few seconds.
+func (h *AgentHandler) AbortDeployment(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req AbortDeploymentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	execution, record, err := h.getDeploymentExecution(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if execution.Status != "running" {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only running deployments can be aborted, deployment is %s", execution.Status)})
+		return
+	}
+
+	// Stored for the replica running the deployment, which may be another one
+	if err := h.db.DB.Model(record).Updates(map[string]interface{}{"abort_requested": true, "abort_cleanup": req.Cleanup}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to request abort: %v", err)})
+		return
+	}
+	if err := h.deploymentExecutor.AbortDeployment(execution.ID, req.Cleanup); err != nil && !errors.Is(err, services.ErrDeploymentNotRunning) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to abort deployment: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"execution_id": execution.ID,
+		"status":       "aborting",
+		"cleanup":      req.Cleanup,
+		"message":      "Deployment is being aborted, follow it with GET /api/agent/deployments/" + execution.ID,
+	})
+}
+
+// abortRequestCheck reports the abort requests stored for deployments
+func abortRequestCheck(db *database.Database) services.AbortRequestCheck {
+	return func(executionID string) (bool, bool) {
+		var record models.DeploymentExecutionRecord
+		if err := db.DB.Select("abort_requested", "abort_cleanup").Where("id = ?", executionID).First(&record).Error; err != nil {
+			return false, false
+		}
+		return record.AbortRequested, record.AbortCleanup
+	}
+}
+
+// completedSteps counts the completed steps of an execution
+func completedSteps(execution *agent.DeploymentExecution) int {
+	completed := 0
+	for _, step := range execution.Steps {
+		if step.Status == "completed" {
+			completed++
+		}
+	}
+	return completed
+}
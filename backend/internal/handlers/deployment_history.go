@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeploymentHistoryEntry is a past deployment in the history list. Its ID is
+// the ID of the deployment's execution.
+type DeploymentHistoryEntry struct {
+	ID              string     `json:"id"`
+	ClusterID       uint       `json:"cluster_id"`
+	PlanID          string     `json:"plan_id"`
+	StackName       string     `json:"stack_name"`
+	Status          string     `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	StartedAt       time.Time  `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	DurationSeconds float64    `json:"duration_seconds,omitempty"`
+	AbortRequested  bool       `json:"abort_requested"`
+	CompletedSteps  int        `json:"completed_steps"`
+	TotalSteps      int        `json:"total_steps"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// DeploymentStats summarizes the deployments matching the history filters
+type DeploymentStats struct {
+	Total    int64            `json:"total"`
+	Running  int64            `json:"running"`
+	ByStatus map[string]int64 `json:"by_status"`
+	// SuccessRate is the share of finished deployments that completed, from 0
+	// to 1. Uninstalled deployments completed before they were removed.
+	SuccessRate float64 `json:"success_rate"`
+	// AverageDurationSeconds is the average duration of finished deployments
+	AverageDurationSeconds float64 `json:"average_duration_seconds"`
+}
+
+// GetDeploymentHistory returns the user's deployments, newest first. Accepts
+// ?cluster_id=, ?status=, ?stack_name= (part of the name, in any case),
+// ?since= and ?until= (RFC 3339 times or dates), plus the list parameters
+// (sortable by started_at, finished_at, duration_seconds, stack_name and status).
+func (h *AgentHandler) GetDeploymentHistory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := parseListParams(c, "-started_at")
+	query, err := h.deploymentHistory(c, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count deployment history"})
+		return
+	}
+
+	page, err := params.paginate(query, map[string]string{
+		"started_at":       "deployments.started_at",
+		"finished_at":      "deployments.finished_at",
+		"duration_seconds": "deployments.duration_seconds",
+		"stack_name":       "deployments.stack_name",
+		"status":           "deployments.status",
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var rows []struct {
+		models.Deployment
+		AbortRequested bool
+	}
+	err = page.Select("deployments.*, deployment_execution_records.abort_requested").Scan(&rows).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deployment history"})
+		return
+	}
+
+	executionIDs := make([]string, 0, len(rows))
+	for _, row := range rows {
+		executionIDs = append(executionIDs, row.ExecutionID)
+	}
+	var counts []struct {
+		ExecutionID string
+		Total       int
+		Completed   int
+	}
+	if len(executionIDs) > 0 {
+		err := h.db.Reader().Model(&models.DeploymentStepRecord{}).
+			Select("execution_id, COUNT(*) AS total, SUM(CASE WHEN status = 'completed' THEN 1 ELSE 0 END) AS completed").
+			Where("execution_id IN ?", executionIDs).Group("execution_id").Scan(&counts).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deployment steps"})
+			return
+		}
+	}
+	steps := make(map[string][2]int, len(counts))
+	for _, count := range counts {
+		steps[count.ExecutionID] = [2]int{count.Completed, count.Total}
+	}
+
+	deployments := make([]DeploymentHistoryEntry, 0, len(rows))
+	for _, row := range rows {
+		deployments = append(deployments, DeploymentHistoryEntry{
+			ID:              row.ExecutionID,
+			ClusterID:       row.ClusterID,
+			PlanID:          row.PlanID,
+			StackName:       row.StackName,
+			Status:          row.Status,
+			Error:           row.Error,
+			StartedAt:       row.StartedAt,
+			FinishedAt:      row.FinishedAt,
+			DurationSeconds: row.DurationSeconds,
+			AbortRequested:  row.AbortRequested,
+			CompletedSteps:  steps[row.ExecutionID][0],
+			TotalSteps:      steps[row.ExecutionID][1],
+			CreatedAt:       row.CreatedAt,
+			UpdatedAt:       row.UpdatedAt,
+		})
+	}
+
+	respondWithList(c, params, total, "deployments", deployments)
+}
+
+// GetDeploymentStats reports the success rate and average duration of the
+// user's deployments. Accepts the filters of GetDeploymentHistory.
+func (h *AgentHandler) GetDeploymentStats(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query, err := h.deploymentHistory(c, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var groups []struct {
+		Status   string
+		Count    int64
+		Timed    int64
+		Duration float64
+	}
+	err = query.Select("deployments.status, COUNT(*) AS count, COUNT(deployments.finished_at) AS timed, SUM(deployments.duration_seconds) AS duration").
+		Group("deployments.status").Scan(&groups).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load deployment stats: %v", err)})
+		return
+	}
+
+	stats := DeploymentStats{ByStatus: make(map[string]int64, len(groups))}
+	var finished, succeeded, timed int64
+	var duration float64
+	for _, group := range groups {
+		stats.Total += group.Count
+		stats.ByStatus[group.Status] = group.Count
+		if group.Status == "running" {
+			stats.Running += group.Count
+			continue
+		}
+		finished += group.Count
+		if group.Status == "completed" || group.Status == "uninstalled" {
+			succeeded += group.Count
+		}
+		timed += group.Timed
+		duration += group.Duration
+	}
+	if finished > 0 {
+		stats.SuccessRate = float64(succeeded) / float64(finished)
+	}
+	if timed > 0 {
+		stats.AverageDurationSeconds = duration / float64(timed)
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// deploymentHistory selects the user's deployments whose execution is stored,
+// filtered by the request's query parameters
+func (h *AgentHandler) deploymentHistory(c *gin.Context, userID uint) (*gorm.DB, error) {
+	query := h.db.Reader().Model(&models.Deployment{}).
+		Joins("JOIN deployment_execution_records ON deployment_execution_records.id = deployments.execution_id AND deployment_execution_records.deleted_at IS NULL").
+		Where("deployments.user_id = ?", userID)
+	if clusterID := c.Query("cluster_id"); clusterID != "" {
+		query = query.Where("deployments.cluster_id = ?", clusterID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("deployments.status = ?", status)
+	}
+	if stackName := strings.TrimSpace(c.Query("stack_name")); stackName != "" {
+		query = query.Where("LOWER(deployments.stack_name) LIKE ?", "%"+strings.ToLower(stackName)+"%")
+	}
+	for _, bound := range []struct{ param, condition string }{
+		{"since", "deployments.started_at >= ?"},
+		{"until", "deployments.started_at < ?"},
+	} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		at, err := historyTime(value, bound.param == "until")
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an RFC 3339 time or a date like 2006-01-02", bound.param)
+		}
+		query = query.Where(bound.condition, at)
+	}
+	return query, nil
+}
+
+// saveDeploymentSummary stores the history entry of a deployment execution,
+// named after its plan
+func saveDeploymentSummary(tx *gorm.DB, userID, clusterID uint, execution *agent.DeploymentExecution) error {
+	var names []string
+	if err := tx.Model(&models.DeploymentPlanRecord{}).Where("id = ?", execution.PlanID).Pluck("name", &names).Error; err != nil {
+		return err
+	}
+
+	deployment := models.Deployment{
+		UserID:      userID,
+		ClusterID:   clusterID,
+		StackName:   execution.PlanID,
+		Status:      execution.Status,
+		Error:       execution.Error,
+		ExecutionID: execution.ID,
+		PlanID:      execution.PlanID,
+		StartedAt:   execution.StartTime,
+		FinishedAt:  execution.EndTime,
+	}
+	if len(names) > 0 && names[0] != "" {
+		deployment.StackName = names[0]
+	}
+	if execution.EndTime != nil {
+		deployment.DurationSeconds = execution.EndTime.Sub(execution.StartTime).Seconds()
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "execution_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "error", "started_at", "finished_at", "duration_seconds", "updated_at"}),
+	}).Create(&deployment).Error
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/logger"
+)
+
+// connectTestDatabase opens a migrated SQLite database
+func connectTestDatabase(t *testing.T) *database.Database {
+	t.Helper()
+	conn, err := database.Connect(config.DatabaseConfig{
+		Driver: database.DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "platform.db"),
+	}, logger.Silent)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if _, err := database.Migrate(conn, database.MigrateOptions{AllowDestructive: true}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return &database.Database{DB: conn}
+}
+
+// TestFailedDeploymentIsTimed runs a plan whose only step fails and checks
+// that its history entry has a finish time and counts towards the average
+// duration
+func TestFailedDeploymentIsTimed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := connectTestDatabase(t)
+	conn := db.DB
+	handler := &AgentHandler{db: db}
+
+	user := models.User{Email: "dev@example.com", Password: "-"}
+	if err := conn.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	cluster := models.KubernetesCluster{UserID: user.ID, Name: "unreachable", KubeConfig: "not a kubeconfig"}
+	if err := conn.Create(&cluster).Error; err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	userID, clusterID := user.ID, cluster.ID
+
+	plan := &agent.DeploymentPlan{
+		ID:   "plan-failing",
+		Name: "failing",
+		Steps: []agent.DeploymentStep{{
+			ID:          "configmap",
+			Description: "Apply a ConfigMap to a cluster that can't be reached",
+			Manifest:    "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: test\n",
+		}},
+	}
+	ctx := services.WithExecutionObserver(context.Background(), func(execution *agent.DeploymentExecution, step int) {
+		if err := saveExecution(db, userID, clusterID, execution, step); err != nil {
+			t.Errorf("save execution: %v", err)
+		}
+	})
+	execution, err := services.NewDeploymentExecutorService(nil).ExecuteDeployment(ctx, plan, cluster.KubeConfig)
+	if err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if execution.Status != "failed" {
+		t.Fatalf("execution status = %s, want failed", execution.Status)
+	}
+
+	var deployment models.Deployment
+	if err := conn.Where("execution_id = ?", execution.ID).First(&deployment).Error; err != nil {
+		t.Fatalf("load deployment: %v", err)
+	}
+	if deployment.FinishedAt == nil {
+		t.Fatal("failed deployment has no finished_at")
+	}
+	if deployment.DurationSeconds <= 0 {
+		t.Fatalf("failed deployment duration = %v, want > 0", deployment.DurationSeconds)
+	}
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/agent/deployments/stats", nil)
+	c.Set("user_id", userID)
+	handler.GetDeploymentStats(c)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("stats answered %d: %s", recorder.Code, recorder.Body)
+	}
+	var stats DeploymentStats
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.ByStatus["failed"] != 1 {
+		t.Fatalf("failed deployments = %d, want 1", stats.ByStatus["failed"])
+	}
+	if stats.AverageDurationSeconds != deployment.DurationSeconds {
+		t.Fatalf("average duration = %v, want the failed deployment's %v", stats.AverageDurationSeconds, deployment.DurationSeconds)
+	}
+}
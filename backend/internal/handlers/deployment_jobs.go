@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deployJob is the payload of deploy jobs
+type deployJob struct {
+	Request DeployRequest `json:"request"`
+}
+
+// retryJob is the payload of jobs resuming a deployment
+type retryJob struct {
+	ExecutionID string                 `json:"execution_id"`
+	Request     RetryDeploymentRequest `json:"request"`
+}
+
+// scheduleJob is the payload of jobs running a scheduled deployment
+type scheduleJob struct {
+	ScheduleID uint `json:"schedule_id"`
+}
+
+// RunJobsOn queues deployments, retries and scheduled runs as jobs the
+// workers run
+func (h *AgentHandler) RunJobsOn(workers *WorkerHandler) {
+	h.workers = workers
+	workers.Register(models.JobDeploy, h.runDeployJob)
+	workers.Register(models.JobRetryDeployment, h.runRetryJob)
+	workers.Register(models.JobSchedule, h.runScheduleJob)
+}
+
+// runDeployJob deploys the plan of a deploy request. The plan is checked again
+// since it may have changed while the job was queued. Later attempts resume
+// the deployment an earlier one started.
+func (h *AgentHandler) runDeployJob(ctx context.Context, job *models.Job) (int, interface{}, error) {
+	var payload deployJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return http.StatusInternalServerError, nil, fmt.Errorf("invalid deploy job: %w", err)
+	}
+	payload.Request.KubeConfig = h.jobKubeconfig(job, payload.Request.KubeConfig)
+
+	if job.ExecutionID != "" {
+		return h.resumeJobExecution(ctx, job, payload.Request.KubeConfig, payload.Request.ScopedCredentials)
+	}
+	plan, record, status, body := h.loadDeployablePlan(job.UserID, payload.Request)
+	if body != nil {
+		return status, body, fmt.Errorf("%v", body["error"])
+	}
+	response, err := h.deployPlan(ctx, job.UserID, plan, record, payload.Request)
+	if err != nil {
+		status, body := deployErrorResponse(err)
+		return status, body, err
+	}
+	return http.StatusOK, response, nil
+}
+
+// runRetryJob resumes a failed or aborted deployment, or the one an earlier
+// attempt was resuming
+func (h *AgentHandler) runRetryJob(ctx context.Context, job *models.Job) (int, interface{}, error) {
+	var payload retryJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return http.StatusInternalServerError, nil, fmt.Errorf("invalid retry job: %w", err)
+	}
+	if payload.Request.KubeConfig != "" {
+		payload.Request.KubeConfig = h.jobKubeconfig(job, payload.Request.KubeConfig)
+	}
+
+	target, status, err := h.prepareRetry(job.UserID, payload.ExecutionID, payload.Request, job.Attempts > 1)
+	if err != nil {
+		return status, nil, err
+	}
+	response, status, err := h.resumeDeployment(ctx, job.UserID, target, payload.Request.ScopedCredentials)
+	if err != nil {
+		return status, nil, err
+	}
+	return status, response, nil
+}
+
+// runScheduleJob runs a scheduled deployment the scheduler claimed, or
+// resumes the run an earlier attempt started
+func (h *AgentHandler) runScheduleJob(ctx context.Context, job *models.Job) (int, interface{}, error) {
+	var payload scheduleJob
+	if err := json.Unmarshal([]byte(job.Payload), &payload); err != nil {
+		return http.StatusInternalServerError, nil, fmt.Errorf("invalid schedule job: %w", err)
+	}
+
+	var schedule models.ScheduledDeployment
+	if err := h.db.DB.First(&schedule, payload.ScheduleID).Error; err != nil {
+		return http.StatusNotFound, nil, fmt.Errorf("schedule %d not found", payload.ScheduleID)
+	}
+	if job.ExecutionID != "" {
+		status, body, err := h.resumeJobExecution(ctx, job, "", schedule.ScopedCredentials)
+		execution, _, loadErr := h.getDeploymentExecution(job.ExecutionID, job.UserID)
+		if err == nil {
+			err = loadErr
+		}
+		h.recordScheduleRun(schedule.ID, execution, err)
+		if err != nil {
+			return status, body, err
+		}
+		return http.StatusOK, gin.H{"execution_id": execution.ID, "status": execution.Status}, nil
+	}
+	execution, err := h.runSchedule(ctx, schedule)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusOK, gin.H{"execution_id": execution.ID, "status": execution.Status}, nil
+}
+
+// jobKubeconfig returns the kubeconfig a job deploys with. The kubeconfig of a
+// connector cluster is resolved again by the replica running the job, as the
+// one queued with it points at the proxy of the replica that resolved it.
+func (h *AgentHandler) jobKubeconfig(job *models.Job, kubeconfig string) string {
+	if job.ConnectorClusterID == nil {
+		return kubeconfig
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ?", *job.ConnectorClusterID).First(&cluster).Error; err != nil {
+		return kubeconfig
+	}
+	return cluster.KubeConfig
+}
+
+// resumeJobExecution resumes the deployment an earlier attempt of a job
+// started from the steps that didn't complete, with kubeconfig or the stored
+// one of its cluster
+func (h *AgentHandler) resumeJobExecution(ctx context.Context, job *models.Job, kubeconfig string, scoped bool) (int, interface{}, error) {
+	execution, _, err := h.getDeploymentExecution(job.ExecutionID, job.UserID)
+	if err != nil {
+		return http.StatusNotFound, nil, err
+	}
+	// The earlier attempt's worker stopped responding after the deployment completed
+	if execution.Status == "completed" {
+		return http.StatusOK, &DeployResponse{
+			ExecutionID: execution.ID,
+			Status:      execution.Status,
+			Message:     "Deployment completed",
+			PostDeploy:  execution.PostDeploy,
+			Diagnoses:   executionDiagnoses(execution),
+		}, nil
+	}
+
+	target, status, err := h.prepareRetry(job.UserID, job.ExecutionID, RetryDeploymentRequest{KubeConfig: kubeconfig}, true)
+	if err != nil {
+		return status, nil, err
+	}
+	response, status, err := h.resumeDeployment(ctx, job.UserID, target, scoped)
+	if err != nil {
+		return status, nil, err
+	}
+	return status, response, nil
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EnableDeploymentLocks keeps two deployments from running on the same
+// cluster namespace at once
+func (h *AgentHandler) EnableDeploymentLocks(locks *services.DeploymentLocker) {
+	h.deploymentLocks = locks
+}
+
+// GetDeploymentLocks lists the namespaces of ?cluster_id= that deployments
+// hold, with the deployment and user holding each
+func (h *AgentHandler) GetDeploymentLocks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	clusterID, err := strconv.ParseUint(c.Query("cluster_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cluster_id is required"})
+		return
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	locks := []services.DeploymentLock{}
+	if h.deploymentLocks != nil {
+		held, err := h.deploymentLocks.Locks(c.Request.Context(), cluster.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to fetch deployment locks: %v", err)})
+			return
+		}
+		locks = append(locks, held...)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cluster_id": cluster.ID, "locks": locks})
+}
+
+// lockDeployment locks the cluster namespaces a plan deploys to, returning a
+// context carrying the locks, which the deployment records once it started,
+// and a function releasing them. Namespaces another deployment holds fail
+// with a services.DeploymentLockedError.
+func (h *AgentHandler) lockDeployment(ctx context.Context, userID, clusterID uint, plan *agent.DeploymentPlan) (context.Context, func(), error) {
+	namespaces := services.PlanNamespaces(plan)
+	if h.deploymentLocks == nil || len(namespaces) == 0 {
+		return ctx, func() {}, nil
+	}
+	services.ReportProgress(ctx, 0, "Locking the namespaces of the deployment")
+	lease, err := h.deploymentLocks.Lock(ctx, clusterID, namespaces, userID, plan.ID)
+	if err != nil {
+		return ctx, nil, err
+	}
+	return services.WithDeploymentLease(ctx, lease), lease.Release, nil
+}
+
+// executionLocks returns the locks a running deployment holds
+func (h *AgentHandler) executionLocks(ctx context.Context, clusterID uint, executionID string) []services.DeploymentLock {
+	if h.deploymentLocks == nil {
+		return nil
+	}
+	held, err := h.deploymentLocks.Locks(ctx, clusterID)
+	if err != nil {
+		fmt.Printf("Failed to fetch deployment locks of cluster %d: %v\n", clusterID, err)
+		return nil
+	}
+	var locks []services.DeploymentLock
+	for _, lock := range held {
+		if lock.ExecutionID == executionID {
+			locks = append(locks, lock)
+		}
+	}
+	return locks
+}
+
+// databaseLockStore keeps deployment locks in the database every API replica
+// and worker process shares, for deployments without Redis
+type databaseLockStore struct {
+	db *database.Database
+}
+
+// NewDeploymentLockStore creates a deployment lock store in the database
+func NewDeploymentLockStore(db *database.Database) services.DeploymentLockStore {
+	return &databaseLockStore{db: db}
+}
+
+func (s *databaseLockStore) Acquire(ctx context.Context, key string, lock services.DeploymentLock, ttl time.Duration) (*services.DeploymentLock, error) {
+	encoded, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+	var holder *services.DeploymentLock
+	err = s.db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Locks whose deployment stopped refreshing them are free
+		if err := tx.Where("id = ? AND expires_at <= ?", key, now).Delete(&models.DeploymentLockRecord{}).Error; err != nil {
+			return err
+		}
+		record := models.DeploymentLockRecord{ID: key, Owner: lock.Owner(), Holder: string(encoded), ExpiresAt: now.Add(ttl)}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+
+		var held models.DeploymentLockRecord
+		if err := tx.Where("id = ?", key).First(&held).Error; err != nil {
+			return err
+		}
+		holder = &services.DeploymentLock{}
+		if err := json.Unmarshal([]byte(held.Holder), holder); err != nil {
+			return fmt.Errorf("failed to decode lock %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holder, nil
+}
+
+func (s *databaseLockStore) Refresh(ctx context.Context, key string, lock services.DeploymentLock, ttl time.Duration) error {
+	encoded, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	result := s.db.DB.WithContext(ctx).Model(&models.DeploymentLockRecord{}).Where("id = ? AND owner = ?", key, lock.Owner()).Updates(map[string]interface{}{
+		"holder":     string(encoded),
+		"expires_at": time.Now().Add(ttl),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("lock %s was lost", key)
+	}
+	return nil
+}
+
+func (s *databaseLockStore) Release(ctx context.Context, key, owner string) error {
+	return s.db.DB.WithContext(ctx).Where("id = ? AND owner = ?", key, owner).Delete(&models.DeploymentLockRecord{}).Error
+}
+
+func (s *databaseLockStore) List(ctx context.Context, prefix string) ([]services.DeploymentLock, error) {
+	var records []models.DeploymentLockRecord
+	if err := s.db.DB.WithContext(ctx).Where("id LIKE ? AND expires_at > ?", prefix+"%", time.Now()).Order("id").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	locks := make([]services.DeploymentLock, 0, len(records))
+	for _, record := range records {
+		var lock services.DeploymentLock
+		if err := json.Unmarshal([]byte(record.Holder), &lock); err != nil {
+			return nil, fmt.Errorf("failed to decode lock %s: %w", record.ID, err)
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/services"
+)
+
+// TestDatabaseLockStoreExcludesDeployments locks a namespace in the database
+// and checks that a second deployment to it is rejected until the first
+// releases it
+func TestDatabaseLockStoreExcludesDeployments(t *testing.T) {
+	locker := services.NewDeploymentLocker(NewDeploymentLockStore(connectTestDatabase(t)), time.Minute, 0)
+	ctx := context.Background()
+
+	first, err := locker.Lock(ctx, 1, []string{"monitoring"}, 1, "plan-first")
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+
+	_, err = locker.Lock(ctx, 1, []string{"apps", "monitoring"}, 2, "plan-second")
+	var locked *services.DeploymentLockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("second lock returned %v, want a DeploymentLockedError", err)
+	}
+	if len(locked.Locks) != 1 || locked.Locks[0].PlanID != "plan-first" {
+		t.Fatalf("second lock names holders %+v, want plan-first", locked.Locks)
+	}
+	// Locking is all or none, so the free namespace wasn't kept either
+	held, err := locker.Locks(ctx, 1)
+	if err != nil {
+		t.Fatalf("list locks: %v", err)
+	}
+	if len(held) != 1 || held[0].Namespace != "monitoring" {
+		t.Fatalf("cluster holds %+v, want only monitoring", held)
+	}
+
+	// Other clusters' namespaces are independent
+	other, err := locker.Lock(ctx, 2, []string{"monitoring"}, 2, "plan-other")
+	if err != nil {
+		t.Fatalf("lock another cluster: %v", err)
+	}
+	other.Release()
+
+	first.Release()
+	second, err := locker.Lock(ctx, 1, []string{"apps", "monitoring"}, 2, "plan-second")
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	second.Release()
+}
+
+// TestDatabaseLockStoreTakesOverExpiredLocks checks that the lock of a
+// deployment that stopped refreshing it, like one on a crashed replica, is
+// taken over once it expired
+func TestDatabaseLockStoreTakesOverExpiredLocks(t *testing.T) {
+	store := NewDeploymentLockStore(connectTestDatabase(t))
+	ctx := context.Background()
+
+	crashed := services.DeploymentLock{ClusterID: 1, Namespace: "monitoring", PlanID: "plan-crashed"}
+	if holder, err := store.Acquire(ctx, "1/monitoring", crashed, time.Millisecond); err != nil || holder != nil {
+		t.Fatalf("acquire returned holder %+v and %v", holder, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	locker := services.NewDeploymentLocker(store, time.Minute, 0)
+	lease, err := locker.Lock(ctx, 1, []string{"monitoring"}, 1, "plan-next")
+	if err != nil {
+		t.Fatalf("lock over an expired lock: %v", err)
+	}
+	defer lease.Release()
+	locks := lease.Locks()
+	if len(locks) != 1 || locks[0].PlanID != "plan-next" {
+		t.Fatalf("lease holds %+v, want plan-next", locks)
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeploymentStepStatus is the state of one step of a deployment execution
+type DeploymentStepStatus struct {
+	StepID     string     `json:"step_id"`
+	Position   int        `json:"position"`
+	Status     string     `json:"status"`
+	Attempts   int        `json:"attempts"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Logs       []string   `json:"logs"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// GetDeployment returns the state of a deployment execution. Running
+// deployments are stored as each step starts and ends, on any replica.
+func (h *AgentHandler) GetDeployment(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	execution, record, err := h.getDeploymentExecution(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := DeploymentStatusResponse{
+		ID:           record.ID,
+		ClusterID:    record.ClusterID,
+		PlanID:       record.PlanID,
+		Status:       execution.Status,
+		TotalSteps:   len(execution.Steps),
+		RunningSteps: []string{},
+		Execution:    execution,
+		CreatedAt:    record.CreatedAt,
+		UpdatedAt:    record.UpdatedAt,
+	}
+	for _, step := range execution.Steps {
+		switch step.Status {
+		case "completed":
+			response.CompletedSteps++
+		case "running":
+			if response.CurrentStep == "" {
+				response.CurrentStep = step.StepID
+			}
+			response.RunningSteps = append(response.RunningSteps, step.StepID)
+		}
+	}
+	if graph, err := execution.Graph(); err == nil {
+		response.Graph = graph
+	} else {
+		fmt.Printf("Failed to build step graph of %s: %v\n", record.ID, err)
+	}
+	response.Locks = h.executionLocks(c.Request.Context(), record.ClusterID, record.ID)
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDeploymentSteps returns the state of each step of a deployment execution
+// in plan order
+func (h *AgentHandler) GetDeploymentSteps(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	execution, record, err := h.getDeploymentExecution(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	var records []models.DeploymentStepRecord
+	if err := h.db.DB.Where("execution_id = ?", record.ID).Order("position").Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deployment steps"})
+		return
+	}
+
+	steps := make([]DeploymentStepStatus, 0, len(execution.Steps))
+	for _, step := range records {
+		logs := []string{}
+		if step.Logs != "" {
+			if err := json.Unmarshal([]byte(step.Logs), &logs); err != nil {
+				fmt.Printf("Failed to decode logs of step %s of %s: %v\n", step.StepID, record.ID, err)
+			}
+		}
+		steps = append(steps, DeploymentStepStatus{
+			StepID:     step.StepID,
+			Position:   step.Position,
+			Status:     step.Status,
+			Attempts:   step.Attempts,
+			StartedAt:  step.StartedAt,
+			FinishedAt: step.FinishedAt,
+			Error:      step.Error,
+			Logs:       logs,
+			UpdatedAt:  step.UpdatedAt,
+		})
+	}
+	// Executions stored before steps had records of their own only have them
+	// in the execution
+	if len(records) == 0 {
+		for i, step := range execution.Steps {
+			steps = append(steps, DeploymentStepStatus{
+				StepID:     step.StepID,
+				Position:   i,
+				Status:     step.Status,
+				Attempts:   step.Attempts,
+				StartedAt:  step.StartTime,
+				FinishedAt: step.EndTime,
+				Error:      step.Error,
+				Logs:       step.Logs,
+				UpdatedAt:  record.UpdatedAt,
+			})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"execution_id": record.ID, "status": execution.Status, "steps": steps})
+}
+
+// trackExecution returns a context whose deployments are stored as they
+// progress, so their state can be followed while they run, and announced on
+// the event bus when they start. Jobs record the deployment they started.
+func (h *AgentHandler) trackExecution(ctx context.Context, userID, clusterID uint, plan *agent.DeploymentPlan) context.Context {
+	var started sync.Once
+	return services.WithExecutionObserver(ctx, func(execution *agent.DeploymentExecution, step int) {
+		if err := saveExecution(h.db, userID, clusterID, execution, step); err != nil {
+			fmt.Printf("Failed to store progress of deployment %s: %v\n", execution.ID, err)
+		}
+		started.Do(func() {
+			if lease := services.DeploymentLeaseFrom(ctx); lease != nil {
+				lease.Attach(execution.ID)
+			}
+			if job := jobFrom(ctx); job != nil {
+				recordJobExecution(h.db, job, execution.ID)
+			}
+			message := fmt.Sprintf("%s runs the %d steps of plan %s", execution.ID, len(execution.Steps), plan.ID)
+			if execution.Resumes > 0 {
+				message = fmt.Sprintf("%s resumes the %d steps of plan %s that didn't complete", execution.ID, len(execution.Steps)-completedSteps(execution), plan.ID)
+			}
+			h.bus.Publish(services.Event{
+				Type:      services.EventDeploymentStarted,
+				UserID:    userID,
+				ClusterID: clusterID,
+				Severity:  services.SeverityInfo,
+				Resource:  execution.ID,
+				Title:     fmt.Sprintf("Deployment of %s started", plan.Name),
+				Message:   message,
+			})
+		})
+	})
+}
+
+// saveExecution stores an execution together with one of its steps, or all of
+// them when step is -1, and the deployment history entry of deployments in a
+// single transaction
+func saveExecution(db *database.Database, userID, clusterID uint, execution *agent.DeploymentExecution, step int) error {
+	encoded, err := json.Marshal(execution)
+	if err != nil {
+		return fmt.Errorf("failed to encode execution: %w", err)
+	}
+
+	steps := make([]models.DeploymentStepRecord, 0, len(execution.Steps))
+	for i, stepExec := range execution.Steps {
+		if step != -1 && i != step {
+			continue
+		}
+		logs, err := json.Marshal(stepExec.Logs)
+		if err != nil {
+			return fmt.Errorf("failed to encode logs of step %s: %w", stepExec.StepID, err)
+		}
+		steps = append(steps, models.DeploymentStepRecord{
+			ExecutionID: execution.ID,
+			StepID:      stepExec.StepID,
+			Position:    i,
+			Status:      stepExec.Status,
+			Attempts:    stepExec.Attempts,
+			StartedAt:   stepExec.StartTime,
+			FinishedAt:  stepExec.EndTime,
+			Error:       stepExec.Error,
+			Logs:        string(logs),
+		})
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		record := models.DeploymentExecutionRecord{
+			ID:        execution.ID,
+			UserID:    userID,
+			ClusterID: clusterID,
+			PlanID:    execution.PlanID,
+			Status:    execution.Status,
+			Execution: string(encoded),
+		}
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"status", "execution", "updated_at"}),
+		}).Create(&record).Error
+		if err != nil {
+			return err
+		}
+		if execution.Action != "uninstall" {
+			if err := saveDeploymentSummary(tx, userID, clusterID, execution); err != nil {
+				return err
+			}
+		}
+		if len(steps) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "execution_id"}, {Name: "step_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"position", "status", "attempts", "started_at", "finished_at", "error", "logs", "updated_at"}),
+		}).Create(&steps).Error
+	})
+}
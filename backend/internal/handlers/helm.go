@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HelmHandler serves chart lookups for the plan editor
+type HelmHandler struct {
+	db          *database.Database
+	helmService *services.HelmService
+}
+
+// NewHelmHandler creates a new Helm handler
+func NewHelmHandler(db *database.Database, helmService *services.HelmService) *HelmHandler {
+	return &HelmHandler{
+		db:          db,
+		helmService: helmService,
+	}
+}
+
+// ValueSuggestRequest asks for the keys valid at a partial values path
+type ValueSuggestRequest struct {
+	// ChartID is the Artifact Hub package ID, as returned by chart search
+	ChartID string `json:"chart_id" binding:"required"`
+	Version string `json:"version,omitempty"`
+	// Path is the dotted path typed so far, e.g. "resources.lim"; empty lists the top-level keys
+	Path string `json:"path"`
+}
+
+// SuggestValues returns the keys, types, defaults and docs valid at a values
+// path, so the plan editor can autocomplete values instead of free-text YAML
+func (h *HelmHandler) SuggestValues(c *gin.Context) {
+	var req ValueSuggestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	suggestions, err := h.helmService.SuggestValues(req.ChartID, req.Version, req.Path)
+	if reason := unavailable(err); reason != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Failed to load chart values: %v", reason)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to load chart values: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, suggestions)
+}
+
+// HelmRegistryRequest adds or updates the credentials of an OCI registry
+type HelmRegistryRequest struct {
+	// Host is the registry host of oci:// chart references, e.g. ghcr.io
+	Host     string `json:"host" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	// Password may be a token; on update an empty password keeps the stored one
+	Password string `json:"password"`
+}
+
+// GetRegistries lists the organization's OCI registries, without their passwords
+func (h *HelmHandler) GetRegistries(c *gin.Context) {
+	var registries []models.HelmRegistry
+	if err := h.db.DB.Where("organization_id = ?", c.GetUint("organization_id")).Order("host ASC").Find(&registries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load registries: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"registries": registries})
+}
+
+// CreateRegistry stores the credentials of an OCI registry after checking
+// that helm can log in with them
+func (h *HelmHandler) CreateRegistry(c *gin.Context) {
+	var req HelmRegistryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is required"})
+		return
+	}
+
+	registry := models.HelmRegistry{OrganizationID: c.GetUint("organization_id")}
+	h.saveRegistry(c, &registry, req)
+}
+
+// UpdateRegistry replaces the credentials of an OCI registry
+func (h *HelmHandler) UpdateRegistry(c *gin.Context) {
+	var registry models.HelmRegistry
+	if err := h.db.DB.Where("id = ? AND organization_id = ?", c.Param("id"), c.GetUint("organization_id")).First(&registry).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registry not found"})
+		return
+	}
+
+	var req HelmRegistryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.saveRegistry(c, &registry, req)
+}
+
+// DeleteRegistry removes the credentials of an OCI registry
+func (h *HelmHandler) DeleteRegistry(c *gin.Context) {
+	result := h.db.DB.Where("id = ? AND organization_id = ?", c.Param("id"), c.GetUint("organization_id")).Delete(&models.HelmRegistry{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete registry: %v", result.Error)})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Registry not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Registry deleted"})
+}
+
+// saveRegistry validates a request by logging in, then stores it on registry
+func (h *HelmHandler) saveRegistry(c *gin.Context, registry *models.HelmRegistry, req HelmRegistryRequest) {
+	host := services.OCIRegistryHost(strings.TrimSpace(req.Host))
+	if host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "host is required"})
+		return
+	}
+	var existing int64
+	h.db.DB.Model(&models.HelmRegistry{}).
+		Where("organization_id = ? AND host = ? AND id <> ?", registry.OrganizationID, host, registry.ID).
+		Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Registry %s already exists", host)})
+		return
+	}
+	password := req.Password
+	if password == "" {
+		password = registry.Password
+	}
+
+	credential := services.RegistryCredential{Host: host, Username: req.Username, Password: password}
+	if err := h.helmService.CheckRegistryLogin(c.Request.Context(), credential); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Registry login failed: %v", err)})
+		return
+	}
+
+	registry.Host = host
+	registry.Username = req.Username
+	registry.Password = password
+	registry.UpdatedBy = c.GetUint("user_id")
+	if err := h.db.DB.Save(registry).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save registry: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, registry)
+}
+
+// withRegistryCredentials returns a context whose helm commands log into the
+// OCI registries of the user's organization
+func withRegistryCredentials(ctx context.Context, db *database.Database, userID uint) context.Context {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil || user.OrganizationID == nil {
+		return ctx
+	}
+
+	var registries []models.HelmRegistry
+	if err := db.DB.Where("organization_id = ?", *user.OrganizationID).Find(&registries).Error; err != nil {
+		fmt.Printf("Failed to load registries of organization %d: %v\n", *user.OrganizationID, err)
+		return ctx
+	}
+	credentials := make([]services.RegistryCredential, 0, len(registries))
+	for _, registry := range registries {
+		credentials = append(credentials, services.RegistryCredential{
+			Host:     registry.Host,
+			Username: registry.Username,
+			Password: registry.Password,
+		})
+	}
+	return services.WithRegistryCredentials(ctx, credentials)
+}
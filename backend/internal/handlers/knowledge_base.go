@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxKnowledgeDocumentSize bounds uploaded runbooks
+const maxKnowledgeDocumentSize = 1 << 20
+
+// knowledgeDocumentExtensions are the file types the knowledge base indexes
+var knowledgeDocumentExtensions = map[string]bool{".md": true, ".markdown": true, ".txt": true}
+
+// KnowledgeDocumentRequest adds a document to the knowledge base as JSON
+// instead of a file upload
+type KnowledgeDocumentRequest struct {
+	Title   string `json:"title" binding:"required"`
+	Content string `json:"content" binding:"required"`
+}
+
+// KnowledgeSearchRequest searches the knowledge base
+type KnowledgeSearchRequest struct {
+	Query string `json:"query" binding:"required"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+// KnowledgeSearchResult is a passage matching a search, most similar first
+type KnowledgeSearchResult struct {
+	DocumentID uint   `json:"document_id"`
+	Title      string `json:"title"`
+	Index      int    `json:"index"`
+	Content    string `json:"content"`
+	// Similarity is the cosine similarity to the query, 1 being identical
+	Similarity float64 `json:"similarity"`
+}
+
+// EnableKnowledgeBase grounds agent queries in the runbooks users upload
+func (h *AgentHandler) EnableKnowledgeBase(knowledgeBase *services.KnowledgeBaseService) {
+	h.knowledgeBase = knowledgeBase
+}
+
+// knowledgeBaseEnabled answers 503 when the knowledge base is disabled
+func (h *AgentHandler) knowledgeBaseEnabled(c *gin.Context) bool {
+	if h.knowledgeBase == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The knowledge base is disabled: it needs the pgvector extension in the database"})
+		return false
+	}
+	return true
+}
+
+// UploadKnowledgeDocument adds a runbook to the knowledge base, as a Markdown or
+// text file in the multipart field "file" or as JSON. The document is chunked
+// and embedded before the response, or as an operation with ?async=true.
+func (h *AgentHandler) UploadKnowledgeDocument(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if !h.knowledgeBaseEnabled(c) {
+		return
+	}
+
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	document := models.KnowledgeDocument{
+		UserID:         user.ID,
+		OrganizationID: user.OrganizationID,
+		Status:         models.KnowledgeStatusIndexing,
+	}
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A document is required in the file field"})
+			return
+		}
+		extension := strings.ToLower(filepath.Ext(file.Filename))
+		if !knowledgeDocumentExtensions[extension] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only Markdown and text documents are supported"})
+			return
+		}
+		if file.Size > maxKnowledgeDocumentSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Documents may be at most %d bytes", maxKnowledgeDocumentSize)})
+			return
+		}
+		reader, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to read document: %v", err)})
+			return
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to read document: %v", err)})
+			return
+		}
+		document.Filename = filepath.Base(file.Filename)
+		document.Content = string(content)
+		document.Title = c.PostForm("title")
+		if document.Title == "" {
+			document.Title = strings.TrimSuffix(document.Filename, filepath.Ext(document.Filename))
+		}
+	} else {
+		var req KnowledgeDocumentRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(req.Content) > maxKnowledgeDocumentSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Documents may be at most %d bytes", maxKnowledgeDocumentSize)})
+			return
+		}
+		document.Title = req.Title
+		document.Content = req.Content
+	}
+	if !utf8.ValidString(document.Content) || strings.TrimSpace(document.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Documents must be non-empty UTF-8 text"})
+		return
+	}
+
+	if err := h.db.DB.Create(&document).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save document: %v", err)})
+		return
+	}
+
+	if wantsAsync(c) {
+		operation, err := h.operations.Start(user.ID, models.OperationKnowledgeIndex, fmt.Sprintf("knowledge/%d", document.ID), func(ctx context.Context) (interface{}, error) {
+			return h.indexKnowledgeDocument(ctx, &document)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithOperation(c, operation)
+		return
+	}
+
+	if _, err := h.indexKnowledgeDocument(c.Request.Context(), &document); err != nil {
+		if reason := unavailable(err); reason != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Failed to index document: %v", reason)})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to index document: %v", err)})
+		return
+	}
+	document.Content = ""
+	c.JSON(http.StatusCreated, document)
+}
+
+// indexKnowledgeDocument embeds a document's chunks and stores them, recording
+// the outcome on the document
+func (h *AgentHandler) indexKnowledgeDocument(ctx context.Context, document *models.KnowledgeDocument) (*models.KnowledgeDocument, error) {
+	chunks, err := h.knowledgeBase.Index(ctx, document.Content)
+	if err != nil {
+		h.db.DB.Model(document).Updates(map[string]interface{}{"status": models.KnowledgeStatusFailed, "error": err.Error()})
+		return nil, err
+	}
+
+	records := make([]models.KnowledgeChunk, len(chunks))
+	for i, chunk := range chunks {
+		records[i] = models.KnowledgeChunk{
+			DocumentID:     document.ID,
+			UserID:         document.UserID,
+			OrganizationID: document.OrganizationID,
+			Index:          chunk.Index,
+			Content:        chunk.Content,
+			Embedding:      models.Vector(chunk.Embedding),
+		}
+	}
+	err = h.db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.CreateInBatches(records, 100).Error; err != nil {
+			return err
+		}
+		return tx.Model(document).Updates(map[string]interface{}{
+			"status": models.KnowledgeStatusReady,
+			"chunks": len(records),
+			"error":  "",
+		}).Error
+	})
+	if err != nil {
+		h.db.DB.Model(document).Updates(map[string]interface{}{"status": models.KnowledgeStatusFailed, "error": err.Error()})
+		return nil, fmt.Errorf("failed to store chunks: %w", err)
+	}
+
+	document.Content = ""
+	return document, nil
+}
+
+// GetKnowledgeDocuments lists the knowledge base documents of the user's
+// organization, or the user's own outside an organization, with the list
+// parameters (sortable by created_at, title and status)
+func (h *AgentHandler) GetKnowledgeDocuments(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	params := parseListParams(c, "-created_at")
+	query := knowledgeScope(h.db.Reader().Model(&models.KnowledgeDocument{}), user)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count documents: %v", err)})
+		return
+	}
+
+	page, err := params.paginate(query.Omit("content"), map[string]string{"created_at": "created_at", "title": "title", "status": "status"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	documents := []models.KnowledgeDocument{}
+	if err := page.Find(&documents).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load documents: %v", err)})
+		return
+	}
+
+	respondWithList(c, params, total, "", documents)
+}
+
+// DeleteKnowledgeDocument removes a document and its chunks. Organization
+// admins may delete any document of the organization.
+func (h *AgentHandler) DeleteKnowledgeDocument(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var document models.KnowledgeDocument
+	if err := knowledgeScope(h.db.DB, user).Omit("content").First(&document, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+	if document.UserID != user.ID && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the uploader or an organization admin can delete this document"})
+		return
+	}
+
+	err := h.db.DB.Transaction(func(tx *gorm.DB) error {
+		if h.db.VectorSearch {
+			if err := tx.Where("document_id = ?", document.ID).Delete(&models.KnowledgeChunk{}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&document).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete document: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Document deleted"})
+}
+
+// SearchKnowledge returns the knowledge base passages most similar to a query
+func (h *AgentHandler) SearchKnowledge(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if !h.knowledgeBaseEnabled(c) {
+		return
+	}
+
+	var req KnowledgeSearchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit <= 0 || req.Limit > 50 {
+		req.Limit = 10
+	}
+
+	embedding, err := h.knowledgeBase.EmbedQuery(c.Request.Context(), req.Query)
+	if reason := unavailable(err); reason != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Failed to search the knowledge base: %v", reason)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to search the knowledge base: %v", err)})
+		return
+	}
+	results, err := h.searchKnowledge(c.Request.Context(), userID.(uint), embedding, req.Limit)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to search the knowledge base: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// searchKnowledge returns the passages of the documents visible to the user
+// nearest to the embedding of a query
+func (h *AgentHandler) searchKnowledge(ctx context.Context, userID uint, embedding []float32, limit int) ([]KnowledgeSearchResult, error) {
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	// Cosine distance; the query embedding must come from the model the chunks were embedded with
+	scope, args := "c.user_id = ?", []interface{}{models.Vector(embedding), user.ID}
+	if user.OrganizationID != nil {
+		scope, args = "c.organization_id = ?", []interface{}{models.Vector(embedding), *user.OrganizationID}
+	}
+	results := []KnowledgeSearchResult{}
+	err := h.db.Reader().WithContext(ctx).Raw(`SELECT c.document_id, d.title, c."index", c.content, 1 - (c.embedding <=> ?) AS similarity
+		FROM knowledge_chunks c
+		JOIN knowledge_documents d ON d.id = c.document_id AND d.deleted_at IS NULL
+		WHERE `+scope+`
+		ORDER BY similarity DESC
+		LIMIT ?`, append(args, limit)...).Scan(&results).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	return results, nil
+}
+
+// embedQuestion embeds a query to retrieve the runbook passages and past
+// queries its answer is grounded in. Both only add context, so it returns nil,
+// logging failures, when the query can't be embedded.
+func (h *AgentHandler) embedQuestion(ctx context.Context, query string) []float32 {
+	if h.knowledgeBase == nil {
+		return nil
+	}
+	embedding, err := h.knowledgeBase.EmbedQuery(ctx, query)
+	if err != nil {
+		fmt.Printf("Failed to embed query: %v\n", err)
+		return nil
+	}
+	return embedding
+}
+
+// knowledgeExcerpts retrieves the runbook passages nearest to the embedding of
+// a query. The knowledge base only adds context, so failures are logged and skipped.
+func (h *AgentHandler) knowledgeExcerpts(ctx context.Context, userID uint, embedding []float32) []agent.KnowledgeExcerpt {
+	if embedding == nil {
+		return nil
+	}
+	results, err := h.searchKnowledge(ctx, userID, embedding, h.knowledgeBase.TopK())
+	if err != nil {
+		fmt.Printf("Failed to search the knowledge base: %v\n", err)
+		return nil
+	}
+
+	excerpts := make([]agent.KnowledgeExcerpt, 0, len(results))
+	for _, result := range results {
+		excerpts = append(excerpts, agent.KnowledgeExcerpt{Source: result.Title, Content: result.Content})
+	}
+	return excerpts
+}
+
+// knowledgeSources lists the distinct runbooks excerpts were taken from
+func knowledgeSources(excerpts []agent.KnowledgeExcerpt) []string {
+	var sources []string
+	seen := map[string]bool{}
+	for _, excerpt := range excerpts {
+		if !seen[excerpt.Source] {
+			seen[excerpt.Source] = true
+			sources = append(sources, excerpt.Source)
+		}
+	}
+	return sources
+}
+
+// knowledgeScope limits a query to the documents of the user's organization,
+// or to the user's own outside an organization
+func knowledgeScope(db *gorm.DB, user models.User) *gorm.DB {
+	if user.OrganizationID != nil {
+		return db.Where("organization_id = ?", *user.OrganizationID)
+	}
+	return db.Where("user_id = ?", user.ID)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// KnownIssueRequest creates or updates a known issue. Either Signature or
+// ErrorMessage is required; an error message is normalized into a signature.
+type KnownIssueRequest struct {
+	Signature    string `json:"signature"`
+	ErrorMessage string `json:"error_message"`
+	Chart        string `json:"chart"`
+	Title        string `json:"title" binding:"required"`
+	Remediation  string `json:"remediation" binding:"required"`
+}
+
+// GetFailureClusters groups recent step failures by normalized error and links
+// each group to its known issue. Accepts ?days= (default 30).
+func (h *AnalyticsHandler) GetFailureClusters(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive integer"})
+		return
+	}
+
+	runs, err := loadChartRuns(h.db, nil, time.Now().Add(-time.Duration(days)*24*time.Hour))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load deployment metrics: %v", err)})
+		return
+	}
+	issues, err := loadKnownIssues(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load known issues: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clusters": services.ClusterFailures(runs, issues)})
+}
+
+// GetKnownIssues lists the known issues
+func (h *AnalyticsHandler) GetKnownIssues(c *gin.Context) {
+	var issues []models.KnownIssue
+	if err := h.db.Reader().Order("occurrences DESC, id").Find(&issues).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch known issues"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"known_issues": issues})
+}
+
+// CreateKnownIssue records a remediation for a failure signature
+func (h *AnalyticsHandler) CreateKnownIssue(c *gin.Context) {
+	var req KnownIssueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	signature := knownIssueSignature(req)
+	if signature == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "signature or error_message is required"})
+		return
+	}
+
+	issue := models.KnownIssue{
+		Signature:   signature,
+		Chart:       req.Chart,
+		Title:       req.Title,
+		Remediation: req.Remediation,
+		Source:      "manual",
+	}
+	if err := h.db.DB.Create(&issue).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save known issue"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, issue)
+}
+
+// UpdateKnownIssue edits a known issue. Editing an issue the model proposed marks it manual.
+func (h *AnalyticsHandler) UpdateKnownIssue(c *gin.Context) {
+	var issue models.KnownIssue
+	if err := h.db.DB.First(&issue, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Known issue not found"})
+		return
+	}
+
+	var req KnownIssueRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if signature := knownIssueSignature(req); signature != "" {
+		issue.Signature = signature
+	}
+	issue.Chart = req.Chart
+	issue.Title = req.Title
+	issue.Remediation = req.Remediation
+	issue.Source = "manual"
+
+	if err := h.db.DB.Save(&issue).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update known issue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, issue)
+}
+
+// DeleteKnownIssue removes a known issue
+func (h *AnalyticsHandler) DeleteKnownIssue(c *gin.Context) {
+	result := h.db.DB.Delete(&models.KnownIssue{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete known issue"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Known issue not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Known issue deleted"})
+}
+
+func knownIssueSignature(req KnownIssueRequest) string {
+	if req.Signature != "" {
+		return strings.TrimSpace(req.Signature)
+	}
+	return services.FailureSignature(req.ErrorMessage)
+}
+
+// loadKnownIssues reads known issues in the form the matcher uses
+func loadKnownIssues(db *database.Database) ([]services.KnownIssue, error) {
+	var records []models.KnownIssue
+	if err := db.DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	issues := make([]services.KnownIssue, 0, len(records))
+	for _, record := range records {
+		issues = append(issues, services.KnownIssue{
+			ID:          record.ID,
+			Signature:   record.Signature,
+			Chart:       record.Chart,
+			Title:       record.Title,
+			Remediation: record.Remediation,
+		})
+	}
+	return issues, nil
+}
+
+// diagnoseFailures attaches a diagnosis to every failed chart step. Known issues
+// answer immediately; failures nothing matches go to the model once and its answer
+// is kept as a known issue for the next occurrence.
+func diagnoseFailures(ctx context.Context, db *database.Database, analyzer *services.FailureAnalyzerService, plan *agent.DeploymentPlan, execution *agent.DeploymentExecution) {
+	if execution.Status != "failed" {
+		return
+	}
+
+	issues, err := loadKnownIssues(db)
+	if err != nil {
+		fmt.Printf("Failed to load known issues: %v\n", err)
+	}
+
+	charts := make(map[string]string, len(plan.Steps))
+	for _, step := range plan.Steps {
+		if step.Chart != nil {
+			charts[step.ID] = step.Chart.Name
+		}
+	}
+
+	for i := range execution.Steps {
+		stepExec := &execution.Steps[i]
+		if stepExec.Status != "failed" || stepExec.Error == "" {
+			continue
+		}
+		chart := charts[stepExec.StepID]
+
+		diagnosis := services.MatchKnownIssue(chart, stepExec.Error, issues)
+		if diagnosis == nil {
+			diagnosis, err = analyzer.Diagnose(ctx, chart, stepExec.Error, stepExec.Logs)
+			if err != nil {
+				fmt.Printf("Failed to diagnose step %s: %v\n", stepExec.StepID, err)
+				continue
+			}
+
+			issue := models.KnownIssue{
+				Signature:   diagnosis.Signature,
+				Chart:       chart,
+				Title:       diagnosis.Title,
+				Remediation: diagnosis.Remediation,
+				Source:      "llm",
+			}
+			if err := db.DB.Create(&issue).Error; err != nil {
+				fmt.Printf("Failed to save known issue: %v\n", err)
+			} else {
+				diagnosis.KnownIssueID = issue.ID
+				issues = append(issues, services.KnownIssue{
+					ID:          issue.ID,
+					Signature:   issue.Signature,
+					Chart:       issue.Chart,
+					Title:       issue.Title,
+					Remediation: issue.Remediation,
+				})
+			}
+		}
+
+		if diagnosis.KnownIssueID != 0 {
+			now := time.Now()
+			db.DB.Model(&models.KnownIssue{}).Where("id = ?", diagnosis.KnownIssueID).Updates(map[string]interface{}{
+				"occurrences": gorm.Expr("occurrences + 1"),
+				"last_seen":   now,
+			})
+		}
+		diagnosis.StepID = stepExec.StepID
+		stepExec.Diagnosis = diagnosis
+	}
+}
+
+// executionDiagnoses collects the diagnoses of an execution's failed steps
+func executionDiagnoses(execution *agent.DeploymentExecution) []agent.FailureDiagnosis {
+	var diagnoses []agent.FailureDiagnosis
+	for _, step := range execution.Steps {
+		if step.Diagnosis != nil {
+			diagnoses = append(diagnoses, *step.Diagnosis)
+		}
+	}
+	return diagnoses
+}
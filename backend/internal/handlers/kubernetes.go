@@ -1,33 +1,142 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 
+	"grafana-ai-agent-platform/backend/internal/agent"
 	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
 	"grafana-ai-agent-platform/backend/pkg/database"
 	"grafana-ai-agent-platform/backend/pkg/kubernetes"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 type KubernetesHandler struct {
-	db *database.Database
+	db              *database.Database
+	bus             *services.EventBus
+	watcher         *services.ClusterWatchService
+	events          *services.EventsService
+	clusterAnalyzer *services.ClusterAnalyzerService
+	operations      *OperationHandler
+	reports         *services.ClusterReportService
+	// connectors is nil when clusters can't be onboarded with a connector
+	connectors     *services.ConnectorManager
+	connectorURL   string
+	connectorImage string
 }
 
-func NewKubernetesHandler(db *database.Database) *KubernetesHandler {
+// NewKubernetesHandler creates a new Kubernetes handler. watcher may be nil when
+// cluster watches are disabled.
+func NewKubernetesHandler(db *database.Database, bus *services.EventBus, watcher *services.ClusterWatchService, events *services.EventsService, operations *OperationHandler, reports *services.ClusterReportService) *KubernetesHandler {
 	return &KubernetesHandler{
-		db: db,
+		db:              db,
+		bus:             bus,
+		watcher:         watcher,
+		events:          events,
+		clusterAnalyzer: services.NewClusterAnalyzerService(),
+		operations:      operations,
+		reports:         reports,
 	}
 }
 
-type AddClusterRequest struct {
-	Name       string `json:"name" binding:"required"`
-	KubeConfig string `json:"kube_config" binding:"required"`
+// StartClusterWatches begins watching every active cluster
+func (h *KubernetesHandler) StartClusterWatches() {
+	var clusters []models.KubernetesCluster
+	if err := h.db.DB.Where("is_active = ?", true).Find(&clusters).Error; err != nil {
+		fmt.Printf("Failed to load clusters to watch: %v\n", err)
+		return
+	}
+	for _, cluster := range clusters {
+		client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+		if err != nil {
+			fmt.Printf("Failed to watch cluster %d: %v\n", cluster.ID, err)
+			continue
+		}
+		h.watch(&cluster, client)
+	}
+}
+
+// watch starts the alert and event watches of a cluster
+func (h *KubernetesHandler) watch(cluster *models.KubernetesCluster, client *kubernetes.KubernetesClient) {
+	if h.watcher != nil {
+		h.watcher.Watch(cluster.ID, cluster.UserID, client)
+	}
+	h.events.Watch(cluster.ID, client)
+}
+
+// unwatch stops the alert and event watches of a cluster
+func (h *KubernetesHandler) unwatch(clusterID uint) {
+	if h.watcher != nil {
+		h.watcher.Unwatch(clusterID)
+	}
+	h.events.Unwatch(clusterID)
+}
+
+// GetClusterAlerts returns the watch alerts currently firing for a cluster
+func (h *KubernetesHandler) GetClusterAlerts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	if h.watcher == nil {
+		c.JSON(http.StatusOK, gin.H{"watching": false, "alerts": []services.Event{}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"watching": true, "alerts": h.watcher.ActiveAlerts(cluster.ID)})
+}
+
+// clusterAuth returns the requested authentication, defaulting to a kubeconfig
+func clusterAuth(r ClusterAuthRequest) kubernetes.ClusterAuth {
+	mode := r.AuthMode
+	if mode == "" {
+		mode = kubernetes.AuthModeKubeconfig
+	}
+	return kubernetes.ClusterAuth{
+		Mode:                  mode,
+		KubeConfig:            r.KubeConfig,
+		Server:                r.Server,
+		Token:                 r.Token,
+		CACert:                r.CACert,
+		InsecureSkipTLSVerify: r.InsecureSkipTLSVerify,
+		Impersonate:           r.Impersonate,
+		ImpersonateGroups:     r.ImpersonateGroups,
+	}
+}
+
+type UpdateClusterRequest struct {
+	Name          *string `json:"name,omitempty"`
+	PrometheusURL *string `json:"prometheus_url,omitempty"`
+	// Environment is dev, staging or prod; empty unclassifies the cluster
+	Environment *string `json:"environment,omitempty"`
+	// Labels replace the cluster's labels; an empty object removes them
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 type ValidateClusterRequest struct {
-	KubeConfig string `json:"kube_config" binding:"required"`
+	ClusterAuthRequest
+	// Context is the kubeconfig context to validate instead of its current one
+	Context string `json:"context,omitempty"`
+}
+
+// SetClusterContextRequest picks the kubeconfig context of a stored cluster
+type SetClusterContextRequest struct {
+	Context string `json:"context" binding:"required"`
 }
 
 func (h *KubernetesHandler) ValidateCluster(c *gin.Context) {
@@ -37,30 +146,33 @@ func (h *KubernetesHandler) ValidateCluster(c *gin.Context) {
 		return
 	}
 
+	auth := clusterAuth(req.ClusterAuthRequest)
+
 	// Log the request for debugging
-	fmt.Printf("Validating kubeconfig for user, length: %d\n", len(req.KubeConfig))
+	fmt.Printf("Validating %s cluster credentials for user, kubeconfig length: %d\n", auth.Mode, len(req.KubeConfig))
 
-	// Basic validation
-	if req.KubeConfig == "" {
+	// Validate the credentials of the auth mode first
+	kubeconfig, err := auth.Kubeconfig()
+	if err != nil {
+		fmt.Printf("Cluster credentials validation failed: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"is_valid": false,
-			"error":    "Kubeconfig is empty",
+			"error":    fmt.Sprintf("Invalid cluster credentials: %v", err),
 		})
 		return
 	}
 
-	// Validate kubeconfig format first
-	if err := kubernetes.ValidateKubeconfigFormat(req.KubeConfig); err != nil {
-		fmt.Printf("Kubeconfig format validation failed: %v\n", err)
+	kubeconfig, kubeconfigInfo, err := selectContext(kubeconfig, req.Context)
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"is_valid": false,
-			"error":    fmt.Sprintf("Invalid kubeconfig format: %v", err),
+			"error":    fmt.Sprintf("Invalid cluster credentials: %v", err),
 		})
 		return
 	}
 
 	// Create Kubernetes client
-	client, err := kubernetes.NewKubernetesClient(req.KubeConfig)
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
 	if err != nil {
 		fmt.Printf("Failed to create Kubernetes client: %v\n", err)
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -80,6 +192,17 @@ func (h *KubernetesHandler) ValidateCluster(c *gin.Context) {
 		})
 		return
 	}
+	clusterInfo.Kubeconfig = kubeconfigInfo
+
+	// Check the cluster authenticates the expected ServiceAccount or impersonated user
+	if clusterInfo.IsValid {
+		identity, err := client.VerifyIdentity(c.Request.Context(), auth)
+		clusterInfo.Identity = identity
+		if err != nil {
+			clusterInfo.IsValid = false
+			clusterInfo.Error = err.Error()
+		}
+	}
 
 	c.JSON(http.StatusOK, clusterInfo)
 }
@@ -97,77 +220,264 @@ func (h *KubernetesHandler) AddCluster(c *gin.Context) {
 		return
 	}
 
-	// Validate kubeconfig format first
-	if err := kubernetes.ValidateKubeconfigFormat(req.KubeConfig); err != nil {
+	if err := validateClusterClassification(req.Environment, req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Validate the credentials of the auth mode first
+	auth := clusterAuth(req.ClusterAuthRequest)
+	kubeconfig, err := auth.Kubeconfig()
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"error": fmt.Sprintf("Invalid kubeconfig format: %v", err),
+			"error": fmt.Sprintf("Invalid cluster credentials: %v", err),
 		})
 		return
 	}
 
-	// Try to create Kubernetes client and validate cluster
-	var clusterInfo *kubernetes.ClusterInfo
-	var clusterURL string
-	var status string
-	var isActive bool
-	var version string
+	contexts := req.Contexts
+	switch {
+	case len(contexts) > 0 && req.Context != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set either context or contexts"})
+		return
+	case len(contexts) > 1 && strings.TrimSpace(req.Name) != "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Clusters added for several contexts are named after their cluster; leave name empty"})
+		return
+	case len(contexts) == 0:
+		contexts = []string{req.Context}
+	}
 
-	client, err := kubernetes.NewKubernetesClient(req.KubeConfig)
-	if err != nil {
-		// Cluster creation failed, but we'll save it as inactive
-		status = "inactive"
-		isActive = false
-		version = "unknown"
-		clusterURL = "unknown"
-	} else {
-		// Try to validate the cluster
-		clusterInfo, err = client.ValidateCluster()
+	// Connect through every context before storing any of them
+	type addedCluster struct {
+		record models.KubernetesCluster
+		client *kubernetes.KubernetesClient
+	}
+	added := make([]addedCluster, 0, len(contexts))
+	names := map[string]bool{}
+	for _, contextName := range contexts {
+		contextKubeconfig, kubeconfigInfo, err := selectContext(kubeconfig, contextName)
 		if err != nil {
-			// Cluster validation failed, mark as inactive
-			status = "inactive"
-			isActive = false
-			version = "unknown"
-			clusterURL = "unknown"
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid cluster credentials: %v", err)})
+			return
+		}
+		name := strings.TrimSpace(req.Name)
+		if name == "" {
+			name = kubeconfigInfo.DefaultName
+		}
+		// Contexts of the same cluster, e.g. for different users, keep their own names
+		if names[name] {
+			name = kubeconfigInfo.CurrentContext
+		}
+		names[name] = true
+
+		cluster, client := newClusterRecord(userID.(uint), name, contextKubeconfig, req.PrometheusURL)
+		cluster.AuthMode = auth.Mode
+		cluster.Environment = req.Environment
+		cluster.Labels = req.Labels
+
+		// Reachable clusters must authenticate the expected ServiceAccount or impersonated user
+		if cluster.IsActive {
+			if _, err := client.VerifyIdentity(c.Request.Context(), auth); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid cluster credentials of context %s: %v", cluster.Context, err)})
+				return
+			}
+		}
+		added = append(added, addedCluster{record: cluster, client: client})
+	}
+
+	err = h.db.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range added {
+			if err := tx.Create(&added[i].record).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cluster"})
+		return
+	}
+
+	responses := make([]AddClusterResponse, 0, len(added))
+	for i := range added {
+		cluster := &added[i].record
+		if cluster.IsActive {
+			h.watch(cluster, added[i].client)
+		}
+
+		// Return appropriate response based on cluster status
+		if cluster.IsActive {
+			responses = append(responses, AddClusterResponse{
+				Message: "Cluster added successfully",
+				Cluster: *cluster,
+			})
 		} else {
-			// Cluster is working
-			status = "active"
-			isActive = true
-			version = clusterInfo.Version
-			clusterURL = clusterInfo.ServerURL
+			responses = append(responses, AddClusterResponse{
+				Message: "Cluster added but marked as inactive due to connection issues",
+				Cluster: *cluster,
+				Warning: "Cluster could not be reached. Use the refresh button to retry connection.",
+			})
 		}
 	}
 
-	// Create cluster record
-	cluster := models.KubernetesCluster{
-		UserID:     userID.(uint),
-		Name:       req.Name,
-		KubeConfig: req.KubeConfig,
-		ClusterURL: clusterURL,
-		Version:    version,
-		Status:     status,
-		IsActive:   isActive,
+	if len(req.Contexts) > 0 {
+		c.JSON(http.StatusCreated, AddClustersResponse{Clusters: responses})
+		return
 	}
+	c.JSON(http.StatusCreated, responses[0])
+}
 
-	if err := h.db.DB.Create(&cluster).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cluster"})
+// KubeconfigContextStatus is a context of a kubeconfig, with the name a
+// cluster added for it gets and, when validated, whether it can be reached
+type KubeconfigContextStatus struct {
+	kubernetes.KubeconfigContext
+	Current     bool   `json:"current"`
+	DefaultName string `json:"default_name"`
+	// Validated contexts report whether the cluster answered and its version
+	IsValid *bool  `json:"is_valid,omitempty"`
+	Version string `json:"version,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ListKubeconfigContextsRequest is a kubeconfig whose contexts to list
+type ListKubeconfigContextsRequest struct {
+	ClusterAuthRequest
+	// Validate connects to the cluster of every context
+	Validate bool `json:"validate,omitempty"`
+}
+
+// ListKubeconfigContexts lists the contexts of a kubeconfig, so clusters can
+// be added for the ones picked
+func (h *KubernetesHandler) ListKubeconfigContexts(c *gin.Context) {
+	var req ListKubeconfigContextsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Return appropriate response based on cluster status
-	if isActive {
-		c.JSON(http.StatusCreated, gin.H{
-			"message": "Cluster added successfully",
-			"cluster": cluster,
-		})
-	} else {
-		c.JSON(http.StatusCreated, gin.H{
-			"message": "Cluster added but marked as inactive due to connection issues",
-			"cluster": cluster,
-			"warning": "Cluster could not be reached. Use the refresh button to retry connection.",
+	kubeconfig, err := clusterAuth(req.ClusterAuthRequest).Kubeconfig()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid cluster credentials: %v", err)})
+		return
+	}
+	info, err := kubernetes.ExtractClusterInfo(kubeconfig)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid cluster credentials: %v", err)})
+		return
+	}
+
+	contexts := make([]KubeconfigContextStatus, len(info.Contexts))
+	var wg sync.WaitGroup
+	for i, entry := range info.Contexts {
+		contexts[i] = KubeconfigContextStatus{
+			KubeconfigContext: entry,
+			Current:           entry.Name == info.CurrentContext,
+			DefaultName:       entry.DefaultName,
+		}
+		if !req.Validate {
+			continue
+		}
+		wg.Add(1)
+		go func(status *KubeconfigContextStatus) {
+			defer wg.Done()
+			valid := false
+			status.IsValid = &valid
+			client, err := kubernetes.NewKubernetesClientForContext(kubeconfig, status.Name)
+			if err != nil {
+				status.Error = err.Error()
+				return
+			}
+			clusterInfo, err := client.ValidateCluster()
+			if err != nil {
+				status.Error = err.Error()
+				return
+			}
+			valid = clusterInfo.IsValid
+			status.Version, status.Error = clusterInfo.Version, clusterInfo.Error
+		}(&contexts[i])
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, gin.H{"current_context": info.CurrentContext, "contexts": contexts})
+}
+
+// newClusterRecord connects to a cluster and returns its record, marked inactive
+// when the cluster cannot be reached. The client is nil when connecting failed.
+func newClusterRecord(userID uint, name, kubeconfig, prometheusURL string) (models.KubernetesCluster, *kubernetes.KubernetesClient) {
+	cluster := models.KubernetesCluster{
+		UserID:        userID,
+		Name:          name,
+		KubeConfig:    kubeconfig,
+		ClusterURL:    "unknown",
+		PrometheusURL: prometheusURL,
+		Version:       "unknown",
+		Status:        "inactive",
+		IsActive:      false,
+	}
+	if info, err := kubernetes.ExtractClusterInfo(kubeconfig); err == nil {
+		cluster.Context = info.CurrentContext
+		cluster.Contexts = kubeContexts(info)
+	}
+
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return cluster, nil
+	}
+	clusterInfo, err := client.ValidateCluster()
+	if err != nil || !clusterInfo.IsValid {
+		return cluster, client
+	}
+
+	// Cluster is working
+	cluster.Status = "active"
+	cluster.IsActive = true
+	cluster.Version = clusterInfo.Version
+	cluster.ClusterURL = clusterInfo.ServerURL
+	return cluster, client
+}
+
+// selectContext makes a context of the kubeconfig current, unless none is
+// given, and describes the kubeconfig
+func selectContext(kubeconfig, contextName string) (string, *kubernetes.KubeconfigInfo, error) {
+	if contextName != "" {
+		switched, err := kubernetes.UseContext(kubeconfig, contextName)
+		if err != nil {
+			return "", nil, err
+		}
+		kubeconfig = switched
+	}
+	info, err := kubernetes.ExtractClusterInfo(kubeconfig)
+	if err != nil {
+		return "", nil, err
+	}
+	return kubeconfig, info, nil
+}
+
+// kubeContexts are the stored contexts of a kubeconfig
+func kubeContexts(info *kubernetes.KubeconfigInfo) models.KubeContexts {
+	contexts := make(models.KubeContexts, 0, len(info.Contexts))
+	for _, context := range info.Contexts {
+		contexts = append(contexts, models.KubeContext{
+			Name:      context.Name,
+			Cluster:   context.Cluster,
+			Server:    context.Server,
+			User:      context.User,
+			Namespace: context.Namespace,
 		})
 	}
+	return contexts
+}
+
+// describeCluster sets what the platform knows of a cluster on its analysis
+func describeCluster(analysis *agent.ClusterAnalysis, cluster *models.KubernetesCluster) {
+	analysis.ClusterID = cluster.ID
+	analysis.ClusterName = cluster.Name
+	analysis.Environment = cluster.Environment
+	analysis.Labels = cluster.Labels
 }
 
+// GetClusters lists the user's clusters (?environment=, ?label=key[=value])
+// with the list parameters, sortable by any field
 func (h *KubernetesHandler) GetClusters(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -175,25 +485,196 @@ func (h *KubernetesHandler) GetClusters(c *gin.Context) {
 		return
 	}
 
+	query := h.db.Reader().Where("user_id = ?", userID)
+	if environment := c.Query("environment"); environment != "" {
+		query = query.Where("environment = ?", environment)
+	}
 	var clusters []models.KubernetesCluster
-	if err := h.db.DB.Where("user_id = ?", userID).Find(&clusters).Error; err != nil {
+	if err := query.Find(&clusters).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch clusters"})
 		return
 	}
 
 	// Don't return kubeconfig in response for security
-	var safeClusters []models.ClusterStatus
+	safeClusters := make([]models.ClusterStatus, 0, len(clusters))
 	for _, cluster := range clusters {
-		safeClusters = append(safeClusters, models.ClusterStatus{
-			ID:       cluster.ID,
-			Name:     cluster.Name,
-			Status:   cluster.Status,
-			IsActive: cluster.IsActive,
-			Version:  cluster.Version,
-		})
+		if !matchesLabelSelectors(cluster.Labels, c.QueryArray("label")) {
+			continue
+		}
+		safeClusters = append(safeClusters, clusterStatus(&cluster))
+	}
+
+	// Labels are matched after loading, so the clusters are paged in memory
+	params := parseListParams(c, "id")
+	page, err := pageSlice(params, safeClusters)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondWithList(c, params, int64(len(safeClusters)), "", page)
+}
+
+// clusterStatus is the response describing a cluster, without its kubeconfig
+func clusterStatus(cluster *models.KubernetesCluster) models.ClusterStatus {
+	return models.ClusterStatus{
+		ID:          cluster.ID,
+		Name:        cluster.Name,
+		Status:      cluster.Status,
+		IsActive:    cluster.IsActive,
+		Version:     cluster.Version,
+		Environment: cluster.Environment,
+		Labels:      cluster.Labels,
+		Context:     cluster.Context,
+	}
+}
+
+// matchesLabelSelectors reports whether labels match every selector, either
+// key=value or a bare key the labels must have
+func matchesLabelSelectors(labels models.Labels, selectors []string) bool {
+	for _, selector := range selectors {
+		key, value, hasValue := strings.Cut(selector, "=")
+		actual, ok := labels[key]
+		if !ok || (hasValue && actual != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateClusterClassification checks a cluster's environment and that its
+// labels follow the syntax of Kubernetes labels
+func validateClusterClassification(environment string, labels map[string]string) error {
+	switch environment {
+	case "", agent.EnvironmentDev, agent.EnvironmentStaging, agent.EnvironmentProd:
+	default:
+		return fmt.Errorf("environment must be dev, staging or prod")
+	}
+	for key, value := range labels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, strings.Join(errs, "; "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value of label %s: %s", key, strings.Join(errs, "; "))
+		}
+	}
+	return nil
+}
+
+func (h *KubernetesHandler) UpdateCluster(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	clusterID := c.Param("id")
+	if clusterID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cluster ID required"})
+		return
+	}
+
+	var req UpdateClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", clusterID, userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		if *req.Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cluster name cannot be empty"})
+			return
+		}
+		updates["name"] = *req.Name
+	}
+	if req.PrometheusURL != nil {
+		updates["prometheus_url"] = *req.PrometheusURL
+	}
+	environment := cluster.Environment
+	if req.Environment != nil {
+		environment = *req.Environment
+		updates["environment"] = environment
+	}
+	if err := validateClusterClassification(environment, req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Labels != nil {
+		updates["labels"] = models.Labels(req.Labels)
+	}
+
+	if len(updates) > 0 {
+		if err := h.db.DB.Model(&cluster).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cluster"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, clusterStatus(&cluster))
+}
+
+// SetClusterContext switches a stored cluster to another context of its
+// kubeconfig. The cluster is connected to again through the context and its
+// watches restarted.
+func (h *KubernetesHandler) SetClusterContext(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req SetClusterContextRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	if cluster.AuthMode == kubernetes.AuthModeConnector {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Clusters reached through a connector have no other context"})
+		return
+	}
+
+	kubeconfig, _, err := selectContext(cluster.KubeConfig, req.Context)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switched, client := newClusterRecord(cluster.UserID, cluster.Name, kubeconfig, cluster.PrometheusURL)
+	err = h.db.DB.Model(&cluster).Updates(map[string]interface{}{
+		"kube_config": switched.KubeConfig,
+		"context":     switched.Context,
+		"contexts":    switched.Contexts,
+		"cluster_url": switched.ClusterURL,
+		"version":     switched.Version,
+		"status":      switched.Status,
+		"is_active":   switched.IsActive,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cluster"})
+		return
 	}
 
-	c.JSON(http.StatusOK, safeClusters)
+	cluster.KubeConfig, cluster.Context, cluster.Contexts = switched.KubeConfig, switched.Context, switched.Contexts
+	cluster.ClusterURL, cluster.Version = switched.ClusterURL, switched.Version
+	cluster.Status, cluster.IsActive = switched.Status, switched.IsActive
+
+	h.unwatch(cluster.ID)
+	if cluster.IsActive {
+		h.watch(&cluster, client)
+	}
+	c.JSON(http.StatusOK, clusterStatus(&cluster))
 }
 
 func (h *KubernetesHandler) DeleteCluster(c *gin.Context) {
@@ -210,10 +691,22 @@ func (h *KubernetesHandler) DeleteCluster(c *gin.Context) {
 	}
 
 	// Delete cluster (soft delete)
-	if err := h.db.DB.Where("id = ? AND user_id = ?", clusterID, userID).Delete(&models.KubernetesCluster{}).Error; err != nil {
+	result := h.db.DB.Where("id = ? AND user_id = ?", clusterID, userID).Delete(&models.KubernetesCluster{})
+	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cluster"})
 		return
 	}
+	if result.RowsAffected > 0 {
+		if id, err := strconv.ParseUint(clusterID, 10, 32); err == nil {
+			h.unwatch(uint(id))
+			if err := h.db.DB.Where("cluster_id = ?", id).Delete(&models.ClusterConnector{}).Error; err != nil {
+				fmt.Printf("Failed to delete connector of cluster %d: %v\n", id, err)
+			}
+			if h.connectors != nil {
+				h.connectors.Disconnect(uint(id))
+			}
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Cluster deleted successfully"})
 }
@@ -283,6 +776,7 @@ func (h *KubernetesHandler) RefreshClusterStatus(c *gin.Context) {
 			"status":    "inactive",
 			"is_active": false,
 		})
+		h.unwatch(cluster.ID)
 		c.JSON(http.StatusOK, gin.H{
 			"message":   "Cluster status updated",
 			"status":    "inactive",
@@ -300,6 +794,7 @@ func (h *KubernetesHandler) RefreshClusterStatus(c *gin.Context) {
 			"status":    "inactive",
 			"is_active": false,
 		})
+		h.unwatch(cluster.ID)
 		c.JSON(http.StatusOK, gin.H{
 			"message":   "Cluster status updated",
 			"status":    "inactive",
@@ -315,6 +810,7 @@ func (h *KubernetesHandler) RefreshClusterStatus(c *gin.Context) {
 		"is_active": true,
 		"version":   clusterInfo.Version,
 	})
+	h.watch(&cluster, client)
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Cluster status updated",
@@ -323,3 +819,40 @@ func (h *KubernetesHandler) RefreshClusterStatus(c *gin.Context) {
 		"version":   clusterInfo.Version,
 	})
 }
+
+// AnalyzeCluster starts a live analysis of a cluster as an operation. Its result
+// is the cluster analysis, which is also recorded as a snapshot.
+func (h *KubernetesHandler) AnalyzeCluster(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	operation, err := h.operations.Start(userID.(uint), models.OperationClusterAnalysis, fmt.Sprintf("cluster/%d", cluster.ID), func(ctx context.Context) (interface{}, error) {
+		services.ReportProgress(ctx, 0, fmt.Sprintf("Analyzing cluster %s", cluster.Name))
+		analysis, err := h.clusterAnalyzer.AnalyzeCluster(ctx, cluster.KubeConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to analyze cluster: %w", err)
+		}
+		describeCluster(analysis, &cluster)
+
+		services.ReportProgress(ctx, 90, "Recording cluster snapshot")
+		if err := recordClusterSnapshot(h.db, userID.(uint), analysis); err != nil {
+			fmt.Printf("Failed to store snapshot of cluster %d: %v\n", cluster.ID, err)
+		}
+		return analysis, nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondWithOperation(c, operation)
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckPlanLicenses collects the licenses of a plan's charts and images, checks
+// them against the organization's license policy and stores the report on the plan
+func (h *AgentHandler) CheckPlanLicenses(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	report, err := h.checkPlanLicenses(c.Request.Context(), userID.(uint), plan, record)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetChangeRequest exports a plan as a Markdown change request with its license
+// summary. The stored license report is used unless ?refresh_licenses=true.
+// With ?async=true the export runs as an operation whose result is the file.
+func (h *AgentHandler) GetChangeRequest(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	refresh := c.Query("refresh_licenses") == "true"
+
+	if wantsAsync(c) {
+		operation, err := h.operations.Start(userID.(uint), models.OperationExport, "plan/"+plan.ID, func(ctx context.Context) (interface{}, error) {
+			return h.exportChangeRequest(ctx, userID.(uint), plan, record, refresh)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithOperation(c, operation)
+		return
+	}
+
+	output, err := h.exportChangeRequest(c.Request.Context(), userID.(uint), plan, record, refresh)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", output.Filename))
+	c.Data(http.StatusOK, output.ContentType, output.Data)
+}
+
+// exportChangeRequest renders a plan's change request, checking its licenses
+// first when there is no stored report or refresh is set
+func (h *AgentHandler) exportChangeRequest(ctx context.Context, userID uint, plan *agent.DeploymentPlan, record *models.DeploymentPlanRecord, refresh bool) (*OperationOutput, error) {
+	var report *services.LicenseReport
+	if record.LicenseReport != "" && !refresh {
+		report = &services.LicenseReport{}
+		if err := json.Unmarshal([]byte(record.LicenseReport), report); err != nil {
+			return nil, fmt.Errorf("Failed to decode license report: %v", err)
+		}
+	} else {
+		services.ReportProgress(ctx, 0, "Checking licenses")
+		var err error
+		report, err = h.checkPlanLicenses(ctx, userID, plan, record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &OperationOutput{
+		ContentType: "text/markdown; charset=utf-8",
+		Filename:    fmt.Sprintf("change-request-%s.md", plan.ID),
+		Data:        []byte(services.ChangeRequest(plan, h.changeRequestInfo(userID, record), report)),
+	}, nil
+}
+
+// changeRequestInfo describes who asked for a plan and its target cluster
+func (h *AgentHandler) changeRequestInfo(userID uint, record *models.DeploymentPlanRecord) services.ChangeRequestInfo {
+	info := services.ChangeRequestInfo{Query: record.Query, CreatedAt: record.CreatedAt}
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err == nil {
+		info.RequestedBy = user.Email
+	}
+	if record.ClusterID != nil {
+		var cluster models.KubernetesCluster
+		if err := h.db.DB.Where("id = ? AND user_id = ?", *record.ClusterID, userID).First(&cluster).Error; err == nil {
+			info.Cluster = cluster.Name
+		}
+	}
+	return info
+}
+
+// checkPlanLicenses runs the license check and stores the report on the plan record
+func (h *AgentHandler) checkPlanLicenses(ctx context.Context, userID uint, plan *agent.DeploymentPlan, record *models.DeploymentPlanRecord) (*services.LicenseReport, error) {
+	policy, err := loadLicensePolicy(h.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load license policy: %w", err)
+	}
+
+	report := h.licenseChecker.CheckPlan(withRegistryCredentials(ctx, h.db, userID), plan, policy)
+
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode license report: %w", err)
+	}
+	if err := h.db.DB.Model(record).Update("license_report", string(encoded)).Error; err != nil {
+		fmt.Printf("Failed to store license report of plan %s: %v\n", plan.ID, err)
+	}
+	return report, nil
+}
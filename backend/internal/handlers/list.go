@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// List endpoints share one convention: ?limit= (default 50, at most 200) and
+// ?offset= select a page, ?sort= orders by a field, descending with a leading
+// "-", and ?fields= keeps a comma-separated set of fields of each item.
+// Responses carry the number of matching items in X-Total-Count and links to
+// the first, previous, next and last pages in Link.
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// listParams is the page, order and fields a list request asks for
+type listParams struct {
+	Limit  int
+	Offset int
+	// Sort is the field to order by, in descending order with Desc
+	Sort   string
+	Desc   bool
+	Fields []string
+}
+
+// parseListParams reads the list query parameters, ordering by defaultSort
+// (e.g. "-created_at") without ?sort=. Invalid limits and offsets fall back
+// to their defaults.
+func parseListParams(c *gin.Context, defaultSort string) *listParams {
+	params := &listParams{Limit: defaultListLimit}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 {
+		params.Limit = min(limit, maxListLimit)
+	}
+	if offset, err := strconv.Atoi(c.Query("offset")); err == nil && offset > 0 {
+		params.Offset = offset
+	}
+
+	sortField := c.DefaultQuery("sort", defaultSort)
+	params.Sort, params.Desc = strings.TrimPrefix(sortField, "-"), strings.HasPrefix(sortField, "-")
+
+	for _, field := range strings.Split(c.Query("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			params.Fields = append(params.Fields, field)
+		}
+	}
+	return params
+}
+
+// paginate orders and pages a query. columns maps the fields lists may be
+// sorted by to their columns; sorting by any other field is an error.
+func (p *listParams) paginate(query *gorm.DB, columns map[string]string) (*gorm.DB, error) {
+	if p.Sort != "" {
+		column, ok := columns[p.Sort]
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %q, sortable fields are %s", p.Sort, strings.Join(sortedKeys(columns), ", "))
+		}
+		if p.Desc {
+			column += " DESC"
+		}
+		query = query.Order(column)
+	}
+	return query.Limit(p.Limit).Offset(p.Offset), nil
+}
+
+// pageSlice orders items in memory by the JSON field of ?sort= and returns
+// the requested page of them
+func pageSlice[T any](p *listParams, items []T) ([]T, error) {
+	if p.Sort != "" && len(items) > 1 {
+		if err := validateListFields(reflect.TypeOf(items).Elem(), []string{p.Sort}); err != nil {
+			return nil, err
+		}
+		keys := make([]interface{}, len(items))
+		for i, item := range items {
+			var fields map[string]interface{}
+			encoded, err := json.Marshal(item)
+			if err == nil {
+				err = json.Unmarshal(encoded, &fields)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to sort items: %w", err)
+			}
+			keys[i] = fields[p.Sort]
+		}
+		order := make([]int, len(items))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			if p.Desc {
+				return lessListValue(keys[order[j]], keys[order[i]])
+			}
+			return lessListValue(keys[order[i]], keys[order[j]])
+		})
+		sorted := make([]T, len(items))
+		for i, index := range order {
+			sorted[i] = items[index]
+		}
+		items = sorted
+	}
+
+	start := min(p.Offset, len(items))
+	end := min(start+p.Limit, len(items))
+	return items[start:end], nil
+}
+
+// lessListValue orders decoded JSON values of one field; missing values first
+func lessListValue(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil:
+		return b != nil
+	case float64:
+		b, ok := b.(float64)
+		return ok && a < b
+	case bool:
+		b, ok := b.(bool)
+		return ok && !a && b
+	default:
+		return fmt.Sprint(a) < fmt.Sprint(b)
+	}
+}
+
+// respondWithList writes a page of items with the X-Total-Count and Link
+// headers, keeping only the fields of ?fields=. With a key the items are
+// wrapped in an object along with total, limit and offset.
+func respondWithList(c *gin.Context, p *listParams, total int64, key string, items interface{}) {
+	var body interface{} = items
+	if len(p.Fields) > 0 {
+		if err := validateListFields(reflect.TypeOf(items).Elem(), p.Fields); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		selected, err := selectListFields(items, p.Fields)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		body = selected
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.Header("Link", listLinks(c, p, total))
+	if key == "" {
+		c.JSON(http.StatusOK, body)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{key: body, "total": total, "limit": p.Limit, "offset": p.Offset})
+}
+
+// listLinks links the first, previous, next and last pages of a list
+func listLinks(c *gin.Context, p *listParams, total int64) string {
+	var links []string
+	link := func(rel string, offset int) {
+		target := *c.Request.URL
+		query := target.Query()
+		query.Set("limit", strconv.Itoa(p.Limit))
+		query.Set("offset", strconv.Itoa(offset))
+		target.RawQuery = query.Encode()
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", target.RequestURI(), rel))
+	}
+
+	link("first", 0)
+	if p.Offset > 0 {
+		link("prev", max(p.Offset-p.Limit, 0))
+	}
+	if int64(p.Offset+p.Limit) < total {
+		link("next", p.Offset+p.Limit)
+	}
+	last := 0
+	if total > 0 {
+		last = int((total-1)/int64(p.Limit)) * p.Limit
+	}
+	link("last", last)
+	return strings.Join(links, ", ")
+}
+
+// selectListFields keeps the given JSON fields of each item
+func selectListFields(items interface{}, fields []string) ([]map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode items: %w", err)
+	}
+	var decoded []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to select fields: %w", err)
+	}
+
+	selected := make([]map[string]json.RawMessage, len(decoded))
+	for i, item := range decoded {
+		selected[i] = make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := item[field]; ok {
+				selected[i][field] = value
+			}
+		}
+	}
+	return selected, nil
+}
+
+// validateListFields checks that the items of a list have every field.
+// Items that aren't structs aren't checked.
+func validateListFields(itemType reflect.Type, fields []string) error {
+	for itemType.Kind() == reflect.Pointer {
+		itemType = itemType.Elem()
+	}
+	if itemType.Kind() != reflect.Struct {
+		return nil
+	}
+	known := make(map[string]bool)
+	collectJSONFields(itemType, known)
+	for _, field := range fields {
+		if !known[field] {
+			return fmt.Errorf("unknown field %q, fields are %s", field, strings.Join(sortedKeys(known), ", "))
+		}
+	}
+	return nil
+}
+
+// collectJSONFields adds the JSON names of a struct's fields, including the
+// fields of embedded structs
+func collectJSONFields(structType reflect.Type, known map[string]bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag := field.Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectJSONFields(embedded, known)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		known[name] = true
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClusterNamespaces lists the namespaces of a cluster with the list
+// parameters, sortable by any field
+func (h *KubernetesHandler) GetClusterNamespaces(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return
+	}
+
+	namespaces, err := client.ListNamespaces(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	params := parseListParams(c, "name")
+	page, err := pageSlice(params, namespaces)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	respondWithList(c, params, int64(len(namespaces)), "namespaces", page)
+}
+
+// GetNamespaceWorkloads lists the Deployments, StatefulSets, Services,
+// Ingresses and PersistentVolumeClaims of a cluster's namespace
+func (h *KubernetesHandler) GetNamespaceWorkloads(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return
+	}
+
+	// Listing a namespace that doesn't exist returns nothing rather than an
+	// error, so check it first
+	namespace := c.Param("ns")
+	found, err := client.NamespaceExists(c.Request.Context(), namespace)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Namespace %s not found", namespace)})
+		return
+	}
+
+	workloads, err := client.ListNamespaceWorkloads(c.Request.Context(), namespace)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, workloads)
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// notificationTimeout bounds the delivery of one event to one channel, its
+// retries included
+const notificationTimeout = 2 * time.Minute
+
+// NotificationChannelRequest creates or replaces a notification channel. On
+// update an empty url or secret keeps the stored one.
+type NotificationChannelRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Type       string   `json:"type" binding:"required"` // slack, email, webhook
+	URL        string   `json:"url,omitempty"`
+	Recipients []string `json:"recipients,omitempty"`
+	Secret     string   `json:"secret,omitempty"`
+	// Events limits the channel to these event types; empty delivers all
+	Events   []string `json:"events,omitempty"`
+	Template string   `json:"template,omitempty"`
+	Enabled  *bool    `json:"enabled,omitempty"`
+	// Organization creates a channel for the whole organization (admin)
+	Organization bool `json:"organization,omitempty"`
+}
+
+// DeliverNotifications sends every event published on the bus to the enabled
+// channels of its user and of their organization, until the bus subscription
+// is cancelled
+func DeliverNotifications(db *database.Database, bus *services.EventBus, notifier *services.NotifierService) func() {
+	events, cancel := bus.Subscribe(256)
+	go func() {
+		for event := range events {
+			go deliverNotification(db, notifier, event)
+		}
+	}()
+	return cancel
+}
+
+// deliverNotification sends an event to the channels subscribed to it and
+// records how delivery went on each
+func deliverNotification(db *database.Database, notifier *services.NotifierService, event services.Event) {
+	orgID := event.OrganizationID
+	if orgID == 0 && event.UserID != 0 {
+		var user models.User
+		if err := db.DB.First(&user, event.UserID).Error; err == nil && user.OrganizationID != nil {
+			orgID = *user.OrganizationID
+		}
+	}
+
+	query := db.DB.Where("enabled = ?", true)
+	switch {
+	case event.UserID != 0 && orgID != 0:
+		query = query.Where("(organization_id IS NULL AND user_id = ?) OR organization_id = ?", event.UserID, orgID)
+	case event.UserID != 0:
+		query = query.Where("organization_id IS NULL AND user_id = ?", event.UserID)
+	case orgID != 0:
+		query = query.Where("organization_id = ?", orgID)
+	default:
+		return
+	}
+
+	var channels []models.NotificationChannel
+	if err := query.Find(&channels).Error; err != nil {
+		fmt.Printf("Failed to load notification channels for %s event: %v\n", event.Type, err)
+		return
+	}
+	for _, channel := range channels {
+		if !channelWantsEvent(&channel, event.Type) {
+			continue
+		}
+		if err := sendToChannel(db, notifier, &channel, event); err != nil {
+			fmt.Printf("Failed to deliver %s event to notification channel %d: %v\n", event.Type, channel.ID, err)
+		}
+	}
+}
+
+// sendToChannel delivers an event to a channel and records the outcome on it
+func sendToChannel(db *database.Database, notifier *services.NotifierService, channel *models.NotificationChannel, event services.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+
+	err := notifier.Send(ctx, channelTarget(channel), event)
+	updates := map[string]interface{}{"last_error": ""}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	} else {
+		updates["last_sent_at"] = time.Now()
+	}
+	if updateErr := db.DB.Model(channel).Updates(updates).Error; updateErr != nil {
+		fmt.Printf("Failed to update notification channel %d: %v\n", channel.ID, updateErr)
+	}
+	return err
+}
+
+// channelWantsEvent reports whether a channel subscribed to an event type
+func channelWantsEvent(channel *models.NotificationChannel, eventType string) bool {
+	if channel.Events == "" {
+		return true
+	}
+	for _, subscribed := range strings.Split(channel.Events, ",") {
+		if subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// channelTarget returns where and how a channel delivers
+func channelTarget(channel *models.NotificationChannel) services.NotificationTarget {
+	target := services.NotificationTarget{
+		Type:     channel.Type,
+		URL:      channel.URL,
+		Secret:   channel.Secret,
+		Template: channel.Template,
+	}
+	if channel.Recipients != "" {
+		target.Recipients = strings.Split(channel.Recipients, ",")
+	}
+	return target
+}
+
+// GetChannels lists the user's notification channels and their organization's
+func (h *NotificationHandler) GetChannels(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	query := h.db.DB.Where("organization_id IS NULL AND user_id = ?", user.ID)
+	if user.OrganizationID != nil {
+		query = h.db.DB.Where("(organization_id IS NULL AND user_id = ?) OR organization_id = ?", user.ID, *user.OrganizationID)
+	}
+	var channels []models.NotificationChannel
+	if err := query.Order("created_at ASC").Find(&channels).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load notification channels: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channels":    channels,
+		"event_types": services.NotificationEventTypes,
+	})
+}
+
+// CreateChannel adds a Slack, email or webhook channel for the user or, with
+// "organization": true, for their organization
+func (h *NotificationHandler) CreateChannel(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	channel := models.NotificationChannel{UserID: user.ID, Enabled: true}
+	if req.Organization {
+		if user.OrganizationID == nil || user.Role != models.RoleAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can add organization channels"})
+			return
+		}
+		channel.OrganizationID = user.OrganizationID
+	}
+	if err := applyChannelRequest(h.notifier, &channel, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.DB.Create(&channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save notification channel: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, channel)
+}
+
+// UpdateChannel replaces a channel's settings
+func (h *NotificationHandler) UpdateChannel(c *gin.Context) {
+	channel, ok := h.editableChannel(c)
+	if !ok {
+		return
+	}
+
+	var req NotificationChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := applyChannelRequest(h.notifier, channel, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.DB.Save(channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save notification channel: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, channel)
+}
+
+// DeleteChannel removes a channel
+func (h *NotificationHandler) DeleteChannel(c *gin.Context) {
+	channel, ok := h.editableChannel(c)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DB.Delete(channel).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete notification channel: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification channel deleted"})
+}
+
+// TestChannel sends a test notification through a channel
+func (h *NotificationHandler) TestChannel(c *gin.Context) {
+	channel, ok := h.editableChannel(c)
+	if !ok {
+		return
+	}
+
+	event := services.Event{
+		Type:      "test",
+		UserID:    channel.UserID,
+		Severity:  services.SeverityInfo,
+		Title:     fmt.Sprintf("Test notification for %s", channel.Name),
+		Message:   "This channel receives notifications from the Kubernetes AI Agent Platform.",
+		Timestamp: time.Now(),
+	}
+	if err := sendToChannel(h.db, h.notifier, channel, event); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to send test notification: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test notification sent"})
+}
+
+// applyChannelRequest validates a request and copies it onto a channel
+func applyChannelRequest(notifier *services.NotifierService, channel *models.NotificationChannel, req NotificationChannelRequest) error {
+	known := make(map[string]bool, len(services.NotificationEventTypes))
+	for _, eventType := range services.NotificationEventTypes {
+		known[eventType] = true
+	}
+	for _, eventType := range req.Events {
+		if !known[eventType] {
+			return fmt.Errorf("unknown event type %q, expected one of %s", eventType, strings.Join(services.NotificationEventTypes, ", "))
+		}
+	}
+
+	recipients := make([]string, 0, len(req.Recipients))
+	for _, recipient := range req.Recipients {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+
+	updated := *channel
+	updated.Name = req.Name
+	updated.Type = req.Type
+	updated.Recipients = strings.Join(recipients, ",")
+	updated.Events = strings.Join(req.Events, ",")
+	updated.Template = req.Template
+	if req.URL != "" || req.Type != channel.Type {
+		updated.URL = req.URL
+	}
+	if req.Secret != "" || req.Type != channel.Type {
+		updated.Secret = req.Secret
+	}
+	if req.Enabled != nil {
+		updated.Enabled = *req.Enabled
+	}
+
+	if err := notifier.Validate(channelTarget(&updated)); err != nil {
+		return err
+	}
+	*channel = updated
+	return nil
+}
+
+// editableChannel loads the channel named in the path if the user may change
+// it: their own channels, and their organization's when they are its admin
+func (h *NotificationHandler) editableChannel(c *gin.Context) (*models.NotificationChannel, bool) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return nil, false
+	}
+
+	query := h.db.DB.Where("id = ?", c.Param("id"))
+	if user.OrganizationID != nil {
+		query = query.Where("(organization_id IS NULL AND user_id = ?) OR organization_id = ?", user.ID, *user.OrganizationID)
+	} else {
+		query = query.Where("organization_id IS NULL AND user_id = ?", user.ID)
+	}
+	var channel models.NotificationChannel
+	if err := query.First(&channel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification channel not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load notification channel: %v", err)})
+		return nil, false
+	}
+	if channel.OrganizationID != nil && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only organization admins can change organization channels"})
+		return nil, false
+	}
+	return &channel, true
+}
+
+// currentUser loads the authenticated user
+func (h *NotificationHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
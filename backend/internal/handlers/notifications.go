@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationHandler serves the notifications raised for the current user and
+// manages their notification channels
+type NotificationHandler struct {
+	db       *database.Database
+	notifier *services.NotifierService
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(db *database.Database, notifier *services.NotifierService) *NotificationHandler {
+	return &NotificationHandler{
+		db:       db,
+		notifier: notifier,
+	}
+}
+
+// RecordNotifications stores every event published on the bus as a notification
+// for its user, until the bus subscription is cancelled
+func RecordNotifications(db *database.Database, bus *services.EventBus) func() {
+	events, cancel := bus.Subscribe(256)
+	go func() {
+		for event := range events {
+			// Organization events only go to the organization's channels
+			if event.UserID == 0 || services.ChannelOnlyEvents[event.Type] {
+				continue
+			}
+			notification := models.Notification{
+				UserID:    event.UserID,
+				Type:      event.Type,
+				Severity:  event.Severity,
+				Rule:      event.Rule,
+				Resource:  event.Resource,
+				Title:     event.Title,
+				Message:   event.Message,
+				CreatedAt: event.Timestamp,
+			}
+			if event.ClusterID != 0 {
+				clusterID := event.ClusterID
+				notification.ClusterID = &clusterID
+			}
+			if err := db.DB.Create(&notification).Error; err != nil {
+				fmt.Printf("Failed to store %s notification for user %d: %v\n", event.Type, event.UserID, err)
+			}
+		}
+	}()
+	return cancel
+}
+
+// GetNotifications lists the user's notifications, newest first. Accepts
+// ?unread=true, ?cluster_id= and the list parameters (sortable by created_at,
+// severity and type).
+func (h *NotificationHandler) GetNotifications(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := parseListParams(c, "-created_at")
+	query := h.db.Reader().Model(&models.Notification{}).Where("user_id = ?", userID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	if clusterID := c.Query("cluster_id"); clusterID != "" {
+		query = query.Where("cluster_id = ?", clusterID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count notifications: %v", err)})
+		return
+	}
+
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at", "severity": "severity", "type": "type"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var notifications []models.Notification
+	if err := page.Find(&notifications).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load notifications: %v", err)})
+		return
+	}
+
+	respondWithList(c, params, total, "notifications", notifications)
+}
+
+// MarkNotificationRead marks one of the user's notifications as read
+func (h *NotificationHandler) MarkNotificationRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := h.db.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ? AND read_at IS NULL", c.Param("id"), userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update notification: %v", result.Error)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead marks all of the user's notifications as read
+func (h *NotificationHandler) MarkAllNotificationsRead(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := h.db.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update notifications: %v", result.Error)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"updated": result.RowsAffected})
+}
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OperationOutput is the result of operations producing a file, which is
+// downloaded as is rather than encoded as JSON
+type OperationOutput struct {
+	ContentType string
+	Filename    string
+	Data        []byte
+}
+
+// OperationWork is the work of an operation. It should stop when ctx is
+// cancelled and may report progress with services.ReportProgress.
+type OperationWork func(ctx context.Context) (interface{}, error)
+
+// OperationHandler runs long-running requests in the background as operations
+// users can poll, cancel and fetch the result of
+type OperationHandler struct {
+	db      *database.Database
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc // operations running in this process
+}
+
+// NewOperationHandler creates a new operation handler
+func NewOperationHandler(db *database.Database) *OperationHandler {
+	return &OperationHandler{
+		db:      db,
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// Start records an operation and runs its work in the background
+func (h *OperationHandler) Start(userID uint, kind, target string, work OperationWork) (*models.Operation, error) {
+	operation, err := h.create(userID, kind, target)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.mu.Lock()
+	h.cancels[operation.ID] = cancel
+	h.mu.Unlock()
+
+	go h.run(agent.WithUser(ctx, userID), operation.ID, work)
+	return operation, nil
+}
+
+// create records a pending operation
+func (h *OperationHandler) create(userID uint, kind, target string) (*models.Operation, error) {
+	operation := &models.Operation{
+		ID:     fmt.Sprintf("op-%d", time.Now().UnixNano()),
+		UserID: userID,
+		Type:   kind,
+		Target: target,
+		Status: models.OperationPending,
+	}
+	if err := h.db.DB.Create(operation).Error; err != nil {
+		return nil, fmt.Errorf("failed to create operation: %w", err)
+	}
+	return operation, nil
+}
+
+// execute runs the work of an operation recorded earlier, e.g. by a request
+// whose job a worker picked up, until it finished
+func (h *OperationHandler) execute(userID uint, id string, work OperationWork) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h.mu.Lock()
+	h.cancels[id] = cancel
+	h.mu.Unlock()
+
+	h.run(agent.WithUser(ctx, userID), id, work)
+}
+
+// run executes an operation's work and stores its outcome
+func (h *OperationHandler) run(ctx context.Context, id string, work OperationWork) {
+	defer func() {
+		h.mu.Lock()
+		cancel := h.cancels[id]
+		delete(h.cancels, id)
+		h.mu.Unlock()
+		cancel()
+	}()
+
+	h.update(id, map[string]interface{}{"status": models.OperationRunning, "started_at": time.Now()})
+	ctx = services.WithProgress(ctx, func(percent int, message string) {
+		h.update(id, map[string]interface{}{"progress": percent, "message": message})
+		// The operation may have been cancelled through another replica
+		var operation models.Operation
+		if err := h.db.DB.Select("cancel_requested").Where("id = ?", id).First(&operation).Error; err == nil && operation.CancelRequested {
+			h.cancel(id)
+		}
+	})
+
+	result, err := runOperationWork(ctx, work)
+
+	updates := map[string]interface{}{"finished_at": time.Now()}
+	switch {
+	case err != nil && ctx.Err() != nil:
+		updates["status"] = models.OperationCancelled
+		updates["error"] = err.Error()
+	case err != nil:
+		updates["status"] = models.OperationFailed
+		updates["error"] = err.Error()
+	default:
+		updates["status"] = models.OperationSucceeded
+		updates["progress"] = 100
+		updates["message"] = ""
+		if output, ok := result.(*OperationOutput); ok {
+			updates["result"] = string(output.Data)
+			updates["result_type"] = output.ContentType
+			updates["result_name"] = output.Filename
+		} else if encoded, err := json.Marshal(result); err != nil {
+			updates["status"] = models.OperationFailed
+			updates["error"] = fmt.Sprintf("failed to encode result: %v", err)
+		} else {
+			updates["result"] = string(encoded)
+			updates["result_type"] = "application/json"
+		}
+	}
+	h.update(id, updates)
+}
+
+// runOperationWork runs work, turning a panic into an error so the operation
+// doesn't stay running forever
+func runOperationWork(ctx context.Context, work OperationWork) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("operation panicked: %v", r)
+		}
+	}()
+	return work(ctx)
+}
+
+// update stores changes to an operation
+func (h *OperationHandler) update(id string, updates map[string]interface{}) {
+	if err := h.db.DB.Model(&models.Operation{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		fmt.Printf("Failed to update operation %s: %v\n", id, err)
+	}
+}
+
+// cancel stops an operation running in this process
+func (h *OperationHandler) cancel(id string) {
+	h.mu.Lock()
+	cancel, ok := h.cancels[id]
+	h.mu.Unlock()
+	if ok {
+		cancel()
+	}
+}
+
+// GetOperations lists the user's operations, newest first, optionally filtered
+// by ?type= and ?status=. Accepts the list parameters (sortable by created_at,
+// finished_at, type and status).
+func (h *OperationHandler) GetOperations(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := h.db.DB.Model(&models.Operation{}).Where("user_id = ?", userID)
+	if kind := c.Query("type"); kind != "" {
+		query = query.Where("type = ?", kind)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	params := parseListParams(c, "-created_at")
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count operations: %v", err)})
+		return
+	}
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at", "finished_at": "finished_at", "type": "type", "status": "status"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var operations []models.Operation
+	if err := page.Find(&operations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load operations: %v", err)})
+		return
+	}
+
+	respondWithList(c, params, total, "operations", operations)
+}
+
+// GetOperation returns the status and progress of an operation
+func (h *OperationHandler) GetOperation(c *gin.Context) {
+	operation, ok := h.loadOperation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, operation)
+}
+
+// CancelOperation asks a running operation to stop. Operations stop at their
+// next safe point, e.g. deployments after the step that is running.
+func (h *OperationHandler) CancelOperation(c *gin.Context) {
+	operation, ok := h.loadOperation(c)
+	if !ok {
+		return
+	}
+	if operation.Finished() {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Operation already %s", operation.Status)})
+		return
+	}
+
+	if err := h.db.DB.Model(operation).Update("cancel_requested", true).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to cancel operation: %v", err)})
+		return
+	}
+	operation.CancelRequested = true
+	h.cancel(operation.ID)
+
+	c.JSON(http.StatusAccepted, operation)
+}
+
+// GetOperationResult returns the result of a succeeded operation: JSON, or the
+// exported file as an attachment
+func (h *OperationHandler) GetOperationResult(c *gin.Context) {
+	operation, ok := h.loadOperation(c)
+	if !ok {
+		return
+	}
+	if operation.Status != models.OperationSucceeded {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Operation is %s, it has no result", operation.Status), "operation": operation})
+		return
+	}
+
+	if operation.ResultName != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", operation.ResultName))
+	}
+	c.Data(http.StatusOK, operation.ResultType, []byte(operation.Result))
+}
+
+// loadOperation loads the user's operation named in the path, responding with
+// an error when there is none
+func (h *OperationHandler) loadOperation(c *gin.Context) (*models.Operation, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	var operation models.Operation
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&operation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Operation not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load operation: %v", err)})
+		return nil, false
+	}
+	return &operation, true
+}
+
+// wantsAsync reports whether the request asked to run as an operation with ?async=true
+func wantsAsync(c *gin.Context) bool {
+	return c.Query("async") == "true"
+}
+
+// respondWithOperation answers 202 with a started operation and where to poll it
+func respondWithOperation(c *gin.Context, operation *models.Operation) {
+	c.Header("Location", "/api/operations/"+operation.ID)
+	c.JSON(http.StatusAccepted, operation)
+}
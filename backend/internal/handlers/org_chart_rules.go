@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChartBlockedError stops a deployment whose plan has charts the
+// organization's chart rules block
+type ChartBlockedError struct {
+	Charts []services.BlockedChart
+}
+
+func (e *ChartBlockedError) Error() string {
+	reasons := make([]string, 0, len(e.Charts))
+	for _, chart := range e.Charts {
+		reasons = append(reasons, chart.String())
+	}
+	return "plan has charts the organization doesn't allow, replace them before deploying: " + strings.Join(reasons, "; ")
+}
+
+// GetChartRules lists the charts and repositories the organization allows
+// or blocks
+func (h *OrganizationHandler) GetChartRules(c *gin.Context) {
+	var rules []models.OrgChartRule
+	if err := h.db.DB.Where("organization_id = ?", c.GetUint("organization_id")).Order("action, repository, chart").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chart rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// CreateChartRule allows or blocks a chart, a repository or a chart of a
+// repository in the organization's plans
+func (h *OrganizationHandler) CreateChartRule(c *gin.Context) {
+	var rule services.ChartRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record := models.OrgChartRule{
+		OrganizationID: c.GetUint("organization_id"),
+		Action:         rule.Action,
+		Repository:     rule.Repository,
+		Chart:          rule.Chart,
+		Reason:         rule.Reason,
+		UpdatedBy:      c.GetUint("user_id"),
+	}
+	var existing int64
+	if err := h.db.DB.Model(&models.OrgChartRule{}).
+		Where("organization_id = ? AND action = ? AND repository = ? AND chart = ?", record.OrganizationID, record.Action, record.Repository, record.Chart).
+		Count(&existing).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chart rules"})
+		return
+	}
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "The chart rule already exists"})
+		return
+	}
+
+	if err := h.db.DB.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chart rule"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, record)
+}
+
+// DeleteChartRule deletes the chart rule :id
+func (h *OrganizationHandler) DeleteChartRule(c *gin.Context) {
+	result := h.db.DB.Where("id = ? AND organization_id = ?", c.Param("id"), c.GetUint("organization_id")).Delete(&models.OrgChartRule{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete chart rule"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chart rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Chart rule deleted"})
+}
+
+// loadChartRules returns the chart rules of the user's organization, or none
+// when the user has no organization
+func loadChartRules(db *database.Database, userID uint) (services.ChartRules, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+
+	var records []models.OrgChartRule
+	if err := db.DB.Where("organization_id = ?", *user.OrganizationID).Find(&records).Error; err != nil {
+		return nil, err
+	}
+	rules := make(services.ChartRules, 0, len(records))
+	for _, record := range records {
+		rules = append(rules, services.ChartRule{
+			Action:     record.Action,
+			Repository: record.Repository,
+			Chart:      record.Chart,
+			Reason:     record.Reason,
+		})
+	}
+	return rules, nil
+}
+
+// enforceChartRules returns a ChartBlockedError when the plan has charts the
+// organization's chart rules block
+func (h *AgentHandler) enforceChartRules(userID uint, plan *agent.DeploymentPlan) error {
+	rules, err := loadChartRules(h.db, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load chart rules: %w", err)
+	}
+	if blocked := rules.CheckPlan(plan); len(blocked) > 0 {
+		return &ChartBlockedError{Charts: blocked}
+	}
+	return nil
+}
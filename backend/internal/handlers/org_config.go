@@ -0,0 +1,894 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"sigs.k8s.io/yaml"
+)
+
+// Declarative configuration document identifiers
+const (
+	OrgConfigAPIVersion = "platform/v1"
+	OrgConfigKind       = "OrganizationConfig"
+)
+
+// maxOrgConfigSize bounds an applied configuration document
+const maxOrgConfigSize = 4 << 20
+
+// Config change actions
+const (
+	ConfigCreate = "create"
+	ConfigUpdate = "update"
+	ConfigDelete = "delete"
+)
+
+var (
+	errInvalidConfig = errors.New("invalid configuration")
+	errDryRun        = errors.New("dry run")
+)
+
+// OrgConfig is an organization's platform configuration as one declarative
+// document. Sections left out are not touched on apply. Secrets (kubeconfigs,
+// channel URLs and secrets, registry passwords) are never exported; apply
+// accepts them to create entries or rotate their credentials.
+type OrgConfig struct {
+	APIVersion           string                   `json:"api_version"`
+	Kind                 string                   `json:"kind"`
+	Name                 string                   `json:"name"`
+	Members              []OrgConfigMember        `json:"members,omitempty"`
+	Clusters             []OrgConfigCluster       `json:"clusters,omitempty"`
+	LicensePolicy        *services.LicensePolicy  `json:"license_policy,omitempty"`
+	SecurityPolicy       *services.SecurityPolicy `json:"security_policy,omitempty"`
+	ValuePolicies        *OrgConfigValuePolicies  `json:"value_policies,omitempty"`
+	HelmRegistries       []OrgConfigRegistry      `json:"helm_registries,omitempty"`
+	NotificationChannels []OrgConfigChannel       `json:"notification_channels,omitempty"`
+}
+
+// OrgConfigMember is a registered user and their role in the organization
+type OrgConfigMember struct {
+	Email string `json:"email"`
+	Role  string `json:"role,omitempty"`
+}
+
+// OrgConfigCluster is a cluster registered by a member
+type OrgConfigCluster struct {
+	Name string `json:"name"`
+	// Owner is the email of the member the cluster belongs to; defaults to the user applying
+	Owner         string `json:"owner,omitempty"`
+	PrometheusURL string `json:"prometheus_url,omitempty"`
+	// Environment is dev, staging or prod
+	Environment string            `json:"environment,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// KubeConfig registers the cluster or rotates its credentials; never exported
+	KubeConfig string `json:"kube_config,omitempty"`
+}
+
+// OrgConfigValuePolicies are the organization default value policy and the
+// overrides of clusters, keyed by cluster name, or "owner/name" when members
+// share a cluster name
+type OrgConfigValuePolicies struct {
+	Default  *services.ValuePolicy            `json:"default,omitempty"`
+	Clusters map[string]*services.ValuePolicy `json:"clusters,omitempty"`
+}
+
+// OrgConfigRegistry is an OCI registry charts are pulled from
+type OrgConfigRegistry struct {
+	Host     string `json:"host"`
+	Username string `json:"username"`
+	// Password is required to add a registry; never exported
+	Password string `json:"password,omitempty"`
+}
+
+// OrgConfigChannel is an organization notification channel, identified by name
+type OrgConfigChannel struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	Recipients []string `json:"recipients,omitempty"`
+	Events     []string `json:"events,omitempty"`
+	Template   string   `json:"template,omitempty"`
+	Enabled    *bool    `json:"enabled,omitempty"`
+	// URL and Secret are required as the channel type needs them; never exported
+	URL    string `json:"url,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// ConfigChange is one change applying a configuration makes
+type ConfigChange struct {
+	Section string `json:"section"`
+	Name    string `json:"name"`
+	Action  string `json:"action"`
+}
+
+// ApplyConfigResponse lists what applying a configuration changed, or would
+// change on a dry run
+type ApplyConfigResponse struct {
+	DryRun    bool           `json:"dry_run"`
+	Changes   []ConfigChange `json:"changes"`
+	Unchanged int            `json:"unchanged"`
+}
+
+// ExportConfig returns the organization's configuration as a declarative
+// document, YAML unless ?format=json, that ApplyConfig accepts back
+func (h *OrganizationHandler) ExportConfig(c *gin.Context) {
+	config, err := h.exportOrgConfig(c.GetUint("organization_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to export configuration: %v", err)})
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, config)
+		return
+	}
+	encoded, err := yaml.Marshal(config)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to encode configuration: %v", err)})
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml", encoded)
+}
+
+// ApplyConfig validates a YAML or JSON configuration document and reconciles
+// the organization with it in one transaction. ?dry_run=true reports the
+// changes without making them; ?prune=true also deletes entries of the
+// document's sections that it doesn't list.
+func (h *OrganizationHandler) ApplyConfig(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxOrgConfigSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to read configuration: %v", err)})
+		return
+	}
+	var config OrgConfig
+	if err := yaml.UnmarshalStrict(body, &config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid configuration: %v", err)})
+		return
+	}
+	if config.APIVersion != OrgConfigAPIVersion || config.Kind != OrgConfigKind {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Configuration must have api_version %s and kind %s", OrgConfigAPIVersion, OrgConfigKind)})
+		return
+	}
+
+	apply := &orgConfigApply{
+		orgID:    c.GetUint("organization_id"),
+		userID:   c.GetUint("user_id"),
+		prune:    c.Query("prune") == "true",
+		notifier: h.notifier,
+	}
+	dryRun := c.Query("dry_run") == "true"
+	err = h.db.DB.Transaction(func(tx *gorm.DB) error {
+		apply.tx = tx
+		if err := apply.reconcile(&config); err != nil {
+			return err
+		}
+		if len(apply.errors) > 0 {
+			return errInvalidConfig
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, errInvalidConfig):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Configuration is invalid", "errors": apply.errors})
+		return
+	case err != nil && !errors.Is(err, errDryRun):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to apply configuration: %v", err)})
+		return
+	}
+
+	if !dryRun {
+		for _, cluster := range apply.watch {
+			h.clusters.unwatch(cluster.record.ID)
+			if cluster.client != nil {
+				h.clusters.watch(cluster.record, cluster.client)
+			}
+		}
+		for _, clusterID := range apply.unwatch {
+			h.clusters.unwatch(clusterID)
+		}
+	}
+
+	c.JSON(http.StatusOK, ApplyConfigResponse{DryRun: dryRun, Changes: apply.changes, Unchanged: apply.unchanged})
+}
+
+// exportOrgConfig builds the configuration document of an organization
+func (h *OrganizationHandler) exportOrgConfig(orgID uint) (*OrgConfig, error) {
+	var org models.Organization
+	if err := h.db.DB.First(&org, orgID).Error; err != nil {
+		return nil, err
+	}
+	config := &OrgConfig{APIVersion: OrgConfigAPIVersion, Kind: OrgConfigKind, Name: org.Name}
+
+	var members []models.User
+	if err := h.db.DB.Where("organization_id = ?", orgID).Order("email ASC").Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		config.Members = append(config.Members, OrgConfigMember{Email: member.Email, Role: member.Role})
+	}
+
+	clusters, err := loadOrgClusters(h.db.DB, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for _, cluster := range clusters {
+		config.Clusters = append(config.Clusters, OrgConfigCluster{
+			Name:          cluster.Name,
+			Owner:         cluster.User.Email,
+			PrometheusURL: cluster.PrometheusURL,
+			Environment:   cluster.Environment,
+			Labels:        cluster.Labels,
+		})
+	}
+
+	policy, err := decodeLicensePolicy(&org)
+	if err != nil {
+		return nil, err
+	}
+	config.LicensePolicy = policy
+
+	securityPolicy, err := decodeSecurityPolicy(&org)
+	if err != nil {
+		return nil, err
+	}
+	config.SecurityPolicy = securityPolicy
+
+	var policies []models.OrgValuePolicy
+	if err := h.db.DB.Where("organization_id = ?", orgID).Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	for _, record := range policies {
+		policy, err := decodeValuePolicy(record)
+		if err != nil {
+			return nil, err
+		}
+		if config.ValuePolicies == nil {
+			config.ValuePolicies = &OrgConfigValuePolicies{}
+		}
+		if record.ClusterID == nil {
+			config.ValuePolicies.Default = policy
+			continue
+		}
+		for _, cluster := range clusters {
+			if cluster.ID == *record.ClusterID {
+				if config.ValuePolicies.Clusters == nil {
+					config.ValuePolicies.Clusters = map[string]*services.ValuePolicy{}
+				}
+				config.ValuePolicies.Clusters[clusterKey(clusters, cluster)] = policy
+			}
+		}
+	}
+
+	var registries []models.HelmRegistry
+	if err := h.db.DB.Where("organization_id = ?", orgID).Order("host ASC").Find(&registries).Error; err != nil {
+		return nil, err
+	}
+	for _, registry := range registries {
+		config.HelmRegistries = append(config.HelmRegistries, OrgConfigRegistry{Host: registry.Host, Username: registry.Username})
+	}
+
+	var channels []models.NotificationChannel
+	if err := h.db.DB.Where("organization_id = ?", orgID).Order("name ASC").Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		enabled := channel.Enabled
+		entry := OrgConfigChannel{Name: channel.Name, Type: channel.Type, Template: channel.Template, Enabled: &enabled}
+		if channel.Recipients != "" {
+			entry.Recipients = strings.Split(channel.Recipients, ",")
+		}
+		if channel.Events != "" {
+			entry.Events = strings.Split(channel.Events, ",")
+		}
+		config.NotificationChannels = append(config.NotificationChannels, entry)
+	}
+	return config, nil
+}
+
+// loadOrgClusters returns the clusters of an organization's members with their owners
+func loadOrgClusters(db *gorm.DB, orgID uint) ([]models.KubernetesCluster, error) {
+	var clusters []models.KubernetesCluster
+	err := db.Preload("User").
+		Joins("JOIN users ON users.id = kubernetes_clusters.user_id").
+		Where("users.organization_id = ?", orgID).
+		Order("kubernetes_clusters.name ASC").
+		Find(&clusters).Error
+	return clusters, err
+}
+
+// clusterKey names a cluster in value policies: its name, or "owner/name"
+// when another member has a cluster of the same name
+func clusterKey(clusters []models.KubernetesCluster, cluster models.KubernetesCluster) string {
+	for _, other := range clusters {
+		if other.ID != cluster.ID && other.Name == cluster.Name {
+			return cluster.User.Email + "/" + cluster.Name
+		}
+	}
+	return cluster.Name
+}
+
+// watchedCluster is a cluster whose watches restart once the apply commits
+type watchedCluster struct {
+	record *models.KubernetesCluster
+	client *kubernetes.KubernetesClient
+}
+
+// orgConfigApply reconciles an organization with a configuration document
+// inside a transaction, collecting validation errors and the changes made
+type orgConfigApply struct {
+	tx       *gorm.DB
+	orgID    uint
+	userID   uint
+	prune    bool
+	notifier *services.NotifierService
+
+	changes   []ConfigChange
+	unchanged int
+	errors    []string
+	watch     []watchedCluster
+	unwatch   []uint
+}
+
+func (a *orgConfigApply) invalid(format string, args ...interface{}) {
+	a.errors = append(a.errors, fmt.Sprintf(format, args...))
+}
+
+func (a *orgConfigApply) changed(section, name, action string) {
+	a.changes = append(a.changes, ConfigChange{Section: section, Name: name, Action: action})
+}
+
+// reconcile applies every section of the document. Clusters come before value
+// policies, so overrides may name clusters the document registers.
+func (a *orgConfigApply) reconcile(config *OrgConfig) error {
+	steps := []func(*OrgConfig) error{
+		a.reconcileOrganization,
+		a.reconcileMembers,
+		a.reconcileClusters,
+		a.reconcileValuePolicies,
+		a.reconcileRegistries,
+		a.reconcileChannels,
+	}
+	for _, step := range steps {
+		if err := step(config); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileOrganization applies the name, license policy and security policy
+func (a *orgConfigApply) reconcileOrganization(config *OrgConfig) error {
+	var org models.Organization
+	if err := a.tx.First(&org, a.orgID).Error; err != nil {
+		return err
+	}
+
+	if config.Name != "" && config.Name != org.Name {
+		if err := a.tx.Model(&org).Update("name", config.Name).Error; err != nil {
+			return err
+		}
+		a.changed("organization", config.Name, ConfigUpdate)
+	}
+
+	if config.LicensePolicy != nil {
+		current, err := decodeLicensePolicy(&org)
+		if err != nil {
+			return err
+		}
+		if current != nil && reflect.DeepEqual(current, config.LicensePolicy) {
+			a.unchanged++
+		} else {
+			encoded, err := json.Marshal(config.LicensePolicy)
+			if err != nil {
+				return err
+			}
+			if err := a.tx.Model(&org).Update("license_policy", string(encoded)).Error; err != nil {
+				return err
+			}
+			a.changed("license_policy", org.Name, ConfigUpdate)
+		}
+	}
+
+	if config.SecurityPolicy != nil {
+		if err := config.SecurityPolicy.Validate(); err != nil {
+			a.invalid("security_policy: %v", err)
+			return nil
+		}
+		current, err := decodeSecurityPolicy(&org)
+		if err != nil {
+			return err
+		}
+		if current != nil && reflect.DeepEqual(current, config.SecurityPolicy) {
+			a.unchanged++
+			return nil
+		}
+		encoded, err := json.Marshal(config.SecurityPolicy)
+		if err != nil {
+			return err
+		}
+		if err := a.tx.Model(&org).Update("security_policy", string(encoded)).Error; err != nil {
+			return err
+		}
+		a.changed("security_policy", org.Name, ConfigUpdate)
+	}
+	return nil
+}
+
+// reconcileMembers adds registered users to the organization and sets their roles
+func (a *orgConfigApply) reconcileMembers(config *OrgConfig) error {
+	if config.Members == nil {
+		return nil
+	}
+
+	listed := map[string]bool{}
+	for _, entry := range config.Members {
+		role := entry.Role
+		if role == "" {
+			role = models.RoleMember
+		}
+		if role != models.RoleAdmin && role != models.RoleOperator && role != models.RoleMember {
+			a.invalid("member %s: role must be admin, operator or member", entry.Email)
+			continue
+		}
+		listed[strings.ToLower(entry.Email)] = true
+
+		var user models.User
+		if err := a.tx.Where("LOWER(email) = ?", strings.ToLower(entry.Email)).First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				a.invalid("member %s: no registered user has this email", entry.Email)
+				continue
+			}
+			return err
+		}
+
+		switch {
+		case user.OrganizationID == nil:
+			if err := a.tx.Model(&user).Updates(map[string]interface{}{"organization_id": a.orgID, "role": role}).Error; err != nil {
+				return err
+			}
+			a.changed("members", user.Email, ConfigCreate)
+		case *user.OrganizationID != a.orgID:
+			a.invalid("member %s: the user belongs to another organization", entry.Email)
+		case user.Role != role:
+			if user.ID == a.userID {
+				a.invalid("member %s: you can't change your own role", entry.Email)
+				continue
+			}
+			if err := a.tx.Model(&user).Update("role", role).Error; err != nil {
+				return err
+			}
+			a.changed("members", user.Email, ConfigUpdate)
+		default:
+			a.unchanged++
+		}
+	}
+	if !a.prune {
+		return nil
+	}
+	var members []models.User
+	if err := a.tx.Where("organization_id = ?", a.orgID).Find(&members).Error; err != nil {
+		return err
+	}
+	for _, member := range members {
+		if listed[strings.ToLower(member.Email)] {
+			continue
+		}
+		if member.ID == a.userID {
+			a.invalid("members: you can't remove yourself from the organization")
+			continue
+		}
+		if err := a.tx.Model(&member).Updates(map[string]interface{}{"organization_id": nil, "role": models.RoleMember}).Error; err != nil {
+			return err
+		}
+		a.changed("members", member.Email, ConfigDelete)
+	}
+	return nil
+}
+
+// reconcileClusters registers clusters and updates their settings. Removing
+// clusters needs ?prune=true.
+func (a *orgConfigApply) reconcileClusters(config *OrgConfig) error {
+	if config.Clusters == nil {
+		return nil
+	}
+
+	var applier models.User
+	if err := a.tx.First(&applier, a.userID).Error; err != nil {
+		return err
+	}
+	existing, err := loadOrgClusters(a.tx, a.orgID)
+	if err != nil {
+		return err
+	}
+
+	listed := map[uint]bool{}
+	for _, entry := range config.Clusters {
+		owner := entry.Owner
+		if owner == "" {
+			owner = applier.Email
+		}
+		name := owner + "/" + entry.Name
+		if entry.Name == "" {
+			a.invalid("clusters: every cluster needs a name")
+			continue
+		}
+		if err := validateClusterClassification(entry.Environment, entry.Labels); err != nil {
+			a.invalid("cluster %s: %v", name, err)
+			continue
+		}
+
+		var current *models.KubernetesCluster
+		for i := range existing {
+			if existing[i].Name == entry.Name && strings.EqualFold(existing[i].User.Email, owner) {
+				current = &existing[i]
+			}
+		}
+
+		if current == nil {
+			var user models.User
+			if err := a.tx.Where("LOWER(email) = ? AND organization_id = ?", strings.ToLower(owner), a.orgID).First(&user).Error; err != nil {
+				a.invalid("cluster %s: the owner is not a member of the organization", name)
+				continue
+			}
+			if entry.KubeConfig == "" {
+				a.invalid("cluster %s: kube_config is required to register a cluster", name)
+				continue
+			}
+			if err := kubernetes.ValidateKubeconfigFormat(entry.KubeConfig); err != nil {
+				a.invalid("cluster %s: invalid kubeconfig: %v", name, err)
+				continue
+			}
+			cluster, client := newClusterRecord(user.ID, entry.Name, entry.KubeConfig, entry.PrometheusURL)
+			cluster.Environment = entry.Environment
+			cluster.Labels = entry.Labels
+			if err := a.tx.Create(&cluster).Error; err != nil {
+				return err
+			}
+			cluster.User = user
+			existing = append(existing, cluster)
+			listed[cluster.ID] = true
+			a.watch = append(a.watch, watchedCluster{record: &cluster, client: client})
+			a.changed("clusters", name, ConfigCreate)
+			continue
+		}
+
+		listed[current.ID] = true
+		updates := map[string]interface{}{}
+		if entry.PrometheusURL != current.PrometheusURL {
+			updates["prometheus_url"] = entry.PrometheusURL
+		}
+		if entry.Environment != current.Environment {
+			updates["environment"] = entry.Environment
+		}
+		if !maps.Equal(entry.Labels, current.Labels) {
+			updates["labels"] = models.Labels(entry.Labels)
+		}
+		if entry.KubeConfig != "" && entry.KubeConfig != current.KubeConfig {
+			if err := kubernetes.ValidateKubeconfigFormat(entry.KubeConfig); err != nil {
+				a.invalid("cluster %s: invalid kubeconfig: %v", name, err)
+				continue
+			}
+			rotated, client := newClusterRecord(current.UserID, current.Name, entry.KubeConfig, entry.PrometheusURL)
+			updates["kube_config"] = rotated.KubeConfig
+			updates["context"] = rotated.Context
+			updates["contexts"] = rotated.Contexts
+			updates["auth_mode"] = kubernetes.AuthModeKubeconfig
+			updates["cluster_url"] = rotated.ClusterURL
+			updates["version"] = rotated.Version
+			updates["status"] = rotated.Status
+			updates["is_active"] = rotated.IsActive
+			record := *current
+			record.KubeConfig = rotated.KubeConfig
+			a.watch = append(a.watch, watchedCluster{record: &record, client: client})
+		}
+		if len(updates) == 0 {
+			a.unchanged++
+			continue
+		}
+		if err := a.tx.Model(current).Updates(updates).Error; err != nil {
+			return err
+		}
+		a.changed("clusters", name, ConfigUpdate)
+	}
+
+	if !a.prune {
+		return nil
+	}
+	for _, cluster := range existing {
+		if listed[cluster.ID] {
+			continue
+		}
+		if err := a.tx.Delete(&models.KubernetesCluster{}, cluster.ID).Error; err != nil {
+			return err
+		}
+		a.unwatch = append(a.unwatch, cluster.ID)
+		a.changed("clusters", cluster.User.Email+"/"+cluster.Name, ConfigDelete)
+	}
+	return nil
+}
+
+// reconcileValuePolicies sets the default value policy and cluster overrides
+func (a *orgConfigApply) reconcileValuePolicies(config *OrgConfig) error {
+	if config.ValuePolicies == nil {
+		return nil
+	}
+
+	clusters, err := loadOrgClusters(a.tx, a.orgID)
+	if err != nil {
+		return err
+	}
+	var records []models.OrgValuePolicy
+	if err := a.tx.Where("organization_id = ?", a.orgID).Find(&records).Error; err != nil {
+		return err
+	}
+
+	desired := map[uint]*services.ValuePolicy{}
+	names := map[uint]string{0: "default"}
+	if config.ValuePolicies.Default != nil {
+		desired[0] = config.ValuePolicies.Default
+	}
+	keys := make([]string, 0, len(config.ValuePolicies.Clusters))
+	for key := range config.ValuePolicies.Clusters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		cluster, err := resolveClusterKey(clusters, key)
+		if err != nil {
+			a.invalid("value policy %s: %v", key, err)
+			continue
+		}
+		desired[cluster.ID] = config.ValuePolicies.Clusters[key]
+		names[cluster.ID] = key
+	}
+
+	stored := map[uint]models.OrgValuePolicy{}
+	for _, record := range records {
+		var clusterID uint
+		if record.ClusterID != nil {
+			clusterID = *record.ClusterID
+		}
+		stored[clusterID] = record
+	}
+
+	ids := make([]uint, 0, len(desired))
+	for clusterID := range desired {
+		ids = append(ids, clusterID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, clusterID := range ids {
+		encoded, err := json.Marshal(desired[clusterID])
+		if err != nil {
+			return err
+		}
+		record, exists := stored[clusterID]
+		if exists && sameJSON(record.Policy, encoded) {
+			a.unchanged++
+			continue
+		}
+
+		record.OrganizationID = a.orgID
+		record.Policy = string(encoded)
+		record.UpdatedBy = a.userID
+		if clusterID != 0 {
+			id := clusterID
+			record.ClusterID = &id
+		}
+		if err := a.tx.Save(&record).Error; err != nil {
+			return err
+		}
+		action := ConfigUpdate
+		if !exists {
+			action = ConfigCreate
+		}
+		a.changed("value_policies", names[clusterID], action)
+	}
+
+	if !a.prune {
+		return nil
+	}
+	for _, record := range records {
+		var clusterID uint
+		if record.ClusterID != nil {
+			clusterID = *record.ClusterID
+		}
+		if _, ok := desired[clusterID]; ok {
+			continue
+		}
+		if err := a.tx.Delete(&record).Error; err != nil {
+			return err
+		}
+		name := "default"
+		for _, cluster := range clusters {
+			if cluster.ID == clusterID {
+				name = clusterKey(clusters, cluster)
+			}
+		}
+		a.changed("value_policies", name, ConfigDelete)
+	}
+	return nil
+}
+
+// resolveClusterKey finds the cluster a value policy key names
+func resolveClusterKey(clusters []models.KubernetesCluster, key string) (*models.KubernetesCluster, error) {
+	var matches []*models.KubernetesCluster
+	for i := range clusters {
+		if clusters[i].Name == key || strings.EqualFold(clusters[i].User.Email+"/"+clusters[i].Name, key) {
+			matches = append(matches, &clusters[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no cluster of the organization has this name")
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("several members have a cluster of this name, use owner/name")
+}
+
+// sameJSON reports whether a stored JSON document equals an encoded one
+func sameJSON(stored string, encoded []byte) bool {
+	var a, b interface{}
+	if json.Unmarshal([]byte(stored), &a) != nil || json.Unmarshal(encoded, &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// reconcileRegistries sets the OCI registry credentials
+func (a *orgConfigApply) reconcileRegistries(config *OrgConfig) error {
+	if config.HelmRegistries == nil {
+		return nil
+	}
+
+	var registries []models.HelmRegistry
+	if err := a.tx.Where("organization_id = ?", a.orgID).Find(&registries).Error; err != nil {
+		return err
+	}
+	stored := map[string]*models.HelmRegistry{}
+	for i := range registries {
+		stored[registries[i].Host] = &registries[i]
+	}
+
+	listed := map[string]bool{}
+	for _, entry := range config.HelmRegistries {
+		host := services.OCIRegistryHost(strings.TrimSpace(entry.Host))
+		if host == "" || entry.Username == "" {
+			a.invalid("helm registries: every registry needs a host and username")
+			continue
+		}
+		if listed[host] {
+			a.invalid("helm registry %s: listed twice", host)
+			continue
+		}
+		listed[host] = true
+
+		registry, exists := stored[host]
+		if !exists {
+			if entry.Password == "" {
+				a.invalid("helm registry %s: password is required to add a registry", host)
+				continue
+			}
+			registry = &models.HelmRegistry{OrganizationID: a.orgID, Host: host}
+		} else if registry.Username == entry.Username && (entry.Password == "" || entry.Password == registry.Password) {
+			a.unchanged++
+			continue
+		}
+
+		registry.Username = entry.Username
+		if entry.Password != "" {
+			registry.Password = entry.Password
+		}
+		registry.UpdatedBy = a.userID
+		if err := a.tx.Save(registry).Error; err != nil {
+			return err
+		}
+		action := ConfigUpdate
+		if !exists {
+			action = ConfigCreate
+		}
+		a.changed("helm_registries", host, action)
+	}
+
+	if !a.prune {
+		return nil
+	}
+	for i := range registries {
+		if listed[registries[i].Host] {
+			continue
+		}
+		if err := a.tx.Delete(&registries[i]).Error; err != nil {
+			return err
+		}
+		a.changed("helm_registries", registries[i].Host, ConfigDelete)
+	}
+	return nil
+}
+
+// reconcileChannels sets the organization's notification channels
+func (a *orgConfigApply) reconcileChannels(config *OrgConfig) error {
+	if config.NotificationChannels == nil {
+		return nil
+	}
+
+	var channels []models.NotificationChannel
+	if err := a.tx.Where("organization_id = ?", a.orgID).Find(&channels).Error; err != nil {
+		return err
+	}
+	stored := map[string]*models.NotificationChannel{}
+	for i := range channels {
+		stored[channels[i].Name] = &channels[i]
+	}
+
+	listed := map[string]bool{}
+	for _, entry := range config.NotificationChannels {
+		if entry.Name == "" || listed[entry.Name] {
+			a.invalid("notification channels: every channel needs a unique name")
+			continue
+		}
+		listed[entry.Name] = true
+
+		channel, exists := stored[entry.Name]
+		if !exists {
+			orgID := a.orgID
+			channel = &models.NotificationChannel{UserID: a.userID, OrganizationID: &orgID, Enabled: true}
+		}
+		before := *channel
+		err := applyChannelRequest(a.notifier, channel, NotificationChannelRequest{
+			Name:       entry.Name,
+			Type:       entry.Type,
+			URL:        entry.URL,
+			Recipients: entry.Recipients,
+			Secret:     entry.Secret,
+			Events:     entry.Events,
+			Template:   entry.Template,
+			Enabled:    entry.Enabled,
+		})
+		if err != nil {
+			a.invalid("notification channel %s: %v", entry.Name, err)
+			continue
+		}
+		if exists && reflect.DeepEqual(before, *channel) {
+			a.unchanged++
+			continue
+		}
+
+		if err := a.tx.Save(channel).Error; err != nil {
+			return err
+		}
+		action := ConfigUpdate
+		if !exists {
+			action = ConfigCreate
+		}
+		a.changed("notification_channels", entry.Name, action)
+	}
+
+	if !a.prune {
+		return nil
+	}
+	for i := range channels {
+		if listed[channels[i].Name] {
+			continue
+		}
+		if err := a.tx.Delete(&channels[i]).Error; err != nil {
+			return err
+		}
+		a.changed("notification_channels", channels[i].Name, ConfigDelete)
+	}
+	return nil
+}
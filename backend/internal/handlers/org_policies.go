@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// policyName matches the names policies are stored under
+var policyName = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// SetPolicyRequest creates or replaces a Rego policy
+type SetPolicyRequest struct {
+	Description string `json:"description"`
+	Module      string `json:"module" binding:"required"`
+	// Enabled defaults to true
+	Enabled *bool `json:"enabled"`
+}
+
+// GetPolicies lists the organization's Rego policies
+func (h *OrganizationHandler) GetPolicies(c *gin.Context) {
+	var policies []models.OrgPolicy
+	if err := h.db.DB.Where("organization_id = ?", c.GetUint("organization_id")).Order("name").Find(&policies).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch policies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"policies": policies})
+}
+
+// SetPolicy creates or replaces the policy named :name once its module
+// compiles with opa
+func (h *OrganizationHandler) SetPolicy(c *gin.Context) {
+	orgID := c.GetUint("organization_id")
+	name := c.Param("name")
+	if !policyName.MatchString(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Policy names are lowercase letters, digits and dashes"})
+		return
+	}
+
+	var req SetPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := services.ValidateRegoPolicy(c.Request.Context(), req.Module); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid policy: %v", err)})
+		return
+	}
+
+	var policy models.OrgPolicy
+	err := h.db.DB.Where("organization_id = ? AND name = ?", orgID, name).First(&policy).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch policy"})
+		return
+	}
+	policy.OrganizationID = orgID
+	policy.Name = name
+	policy.Description = req.Description
+	policy.Module = req.Module
+	policy.Enabled = req.Enabled == nil || *req.Enabled
+	policy.UpdatedBy = c.GetUint("user_id")
+
+	if err := h.db.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeletePolicy deletes the policy named :name
+func (h *OrganizationHandler) DeletePolicy(c *gin.Context) {
+	result := h.db.DB.Where("organization_id = ? AND name = ?", c.GetUint("organization_id"), c.Param("name")).Delete(&models.OrgPolicy{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete policy"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Policy deleted"})
+}
+
+// loadPolicies returns the enabled policies of the user's organization, or
+// none when the user has no organization
+func loadPolicies(db *database.Database, userID uint) ([]services.RegoPolicy, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+
+	var records []models.OrgPolicy
+	if err := db.DB.Where("organization_id = ? AND enabled = ?", *user.OrganizationID, true).Order("name").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	policies := make([]services.RegoPolicy, 0, len(records))
+	for _, record := range records {
+		policies = append(policies, services.RegoPolicy{Name: record.Name, Module: record.Module})
+	}
+	return policies, nil
+}
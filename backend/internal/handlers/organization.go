@@ -0,0 +1,658 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// OrganizationHandler manages organizations, their members and value policies
+type OrganizationHandler struct {
+	db       *database.Database
+	notifier *services.NotifierService
+	// clusters restarts the watches of clusters registered by applied configurations
+	clusters *KubernetesHandler
+}
+
+// NewOrganizationHandler creates a new organization handler
+func NewOrganizationHandler(db *database.Database, notifier *services.NotifierService, clusters *KubernetesHandler) *OrganizationHandler {
+	return &OrganizationHandler{
+		db:       db,
+		notifier: notifier,
+		clusters: clusters,
+	}
+}
+
+// CreateOrganizationRequest creates an organization for a user without one
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// AddMemberRequest adds an existing user to the organization
+type AddMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin operator member"`
+}
+
+// UpdateMemberRequest changes a member's role
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin operator member"`
+}
+
+// OrganizationResponse is an organization with its members
+type OrganizationResponse struct {
+	ID      uint                  `json:"id"`
+	Name    string                `json:"name"`
+	Members []models.UserResponse `json:"members"`
+}
+
+// ValuePoliciesResponse lists an organization's value policies
+type ValuePoliciesResponse struct {
+	Default  *services.ValuePolicy          `json:"default"`
+	Clusters map[uint]*services.ValuePolicy `json:"clusters"`
+	// Effective is the merged policy for the cluster given by ?cluster_id=
+	Effective *services.ValuePolicy `json:"effective,omitempty"`
+}
+
+// CreateOrganization creates an organization with the current user as its admin
+func (h *OrganizationHandler) CreateOrganization(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.OrganizationID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already belongs to an organization"})
+		return
+	}
+
+	org := models.Organization{Name: req.Name}
+	err := h.db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{"organization_id": org.ID, "role": models.RoleAdmin}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, org)
+}
+
+// GetOrganization returns the current user's organization and its members
+func (h *OrganizationHandler) GetOrganization(c *gin.Context) {
+	orgID := c.GetUint("organization_id")
+
+	var org models.Organization
+	if err := h.db.DB.Preload("Members").First(&org, orgID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	response := OrganizationResponse{ID: org.ID, Name: org.Name, Members: []models.UserResponse{}}
+	for _, member := range org.Members {
+		response.Members = append(response.Members, models.UserResponse{
+			ID:             member.ID,
+			Email:          member.Email,
+			FirstName:      member.FirstName,
+			LastName:       member.LastName,
+			OrganizationID: member.OrganizationID,
+			Role:           member.Role,
+			CreatedAt:      member.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// AddMember adds a registered user who has no organization yet
+func (h *OrganizationHandler) AddMember(c *gin.Context) {
+	orgID := c.GetUint("organization_id")
+
+	var req AddMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.RoleMember
+	}
+
+	var user models.User
+	if err := h.db.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.OrganizationID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already belongs to an organization"})
+		return
+	}
+
+	if err := h.db.DB.Model(&user).Updates(map[string]interface{}{"organization_id": orgID, "role": req.Role}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member added", "user_id": user.ID, "role": req.Role})
+}
+
+// UpdateMember changes a member's role, keeping at least one admin
+func (h *OrganizationHandler) UpdateMember(c *gin.Context) {
+	orgID := c.GetUint("organization_id")
+
+	var req UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var member models.User
+	if err := h.db.DB.Where("id = ? AND organization_id = ?", c.Param("id"), orgID).First(&member).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	if member.Role == models.RoleAdmin && req.Role != models.RoleAdmin {
+		var admins int64
+		h.db.DB.Model(&models.User{}).Where("organization_id = ? AND role = ?", orgID, models.RoleAdmin).Count(&admins)
+		if admins <= 1 {
+			c.JSON(http.StatusConflict, gin.H{"error": "An organization needs at least one admin"})
+			return
+		}
+	}
+
+	if err := h.db.DB.Model(&member).Update("role", req.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated", "user_id": member.ID, "role": req.Role})
+}
+
+// GetValuePolicies returns the organization default and per-cluster overrides.
+// With ?cluster_id= it also returns the merged policy for that cluster.
+func (h *OrganizationHandler) GetValuePolicies(c *gin.Context) {
+	orgID := c.GetUint("organization_id")
+
+	var records []models.OrgValuePolicy
+	if err := h.db.DB.Where("organization_id = ?", orgID).Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch value policies"})
+		return
+	}
+
+	response := ValuePoliciesResponse{Clusters: make(map[uint]*services.ValuePolicy)}
+	for _, record := range records {
+		policy, err := decodeValuePolicy(record)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if record.ClusterID == nil {
+			response.Default = policy
+		} else {
+			response.Clusters[*record.ClusterID] = policy
+		}
+	}
+
+	if clusterParam := c.Query("cluster_id"); clusterParam != "" {
+		clusterID, err := strconv.ParseUint(clusterParam, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster_id"})
+			return
+		}
+		response.Effective = services.MergeValuePolicies(response.Default, response.Clusters[uint(clusterID)])
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetDefaultValuePolicy replaces the organization-wide value policy
+func (h *OrganizationHandler) SetDefaultValuePolicy(c *gin.Context) {
+	h.setValuePolicy(c, nil)
+}
+
+// SetClusterValuePolicy replaces the value policy override for one cluster
+func (h *OrganizationHandler) SetClusterValuePolicy(c *gin.Context) {
+	clusterID, ok := h.orgCluster(c)
+	if !ok {
+		return
+	}
+	h.setValuePolicy(c, &clusterID)
+}
+
+// DeleteClusterValuePolicy removes a cluster's override so the default applies
+func (h *OrganizationHandler) DeleteClusterValuePolicy(c *gin.Context) {
+	clusterID, ok := h.orgCluster(c)
+	if !ok {
+		return
+	}
+
+	orgID := c.GetUint("organization_id")
+	if err := h.db.DB.Where("organization_id = ? AND cluster_id = ?", orgID, clusterID).Delete(&models.OrgValuePolicy{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete value policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cluster value policy deleted"})
+}
+
+func (h *OrganizationHandler) setValuePolicy(c *gin.Context, clusterID *uint) {
+	orgID := c.GetUint("organization_id")
+	userID := c.GetUint("user_id")
+
+	var policy services.ValuePolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid policy: %v", err)})
+		return
+	}
+
+	query := h.db.DB.Where("organization_id = ?", orgID)
+	if clusterID == nil {
+		query = query.Where("cluster_id IS NULL")
+	} else {
+		query = query.Where("cluster_id = ?", *clusterID)
+	}
+
+	var record models.OrgValuePolicy
+	err = query.First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch value policy"})
+		return
+	}
+	record.OrganizationID = orgID
+	record.ClusterID = clusterID
+	record.Policy = string(encoded)
+	record.UpdatedBy = userID
+
+	if err := h.db.DB.Save(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save value policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// orgCluster resolves the :cluster_id parameter to a cluster owned by a member of the organization
+func (h *OrganizationHandler) orgCluster(c *gin.Context) (uint, bool) {
+	orgID := c.GetUint("organization_id")
+
+	var cluster models.KubernetesCluster
+	err := h.db.DB.Joins("JOIN users ON users.id = kubernetes_clusters.user_id").
+		Where("kubernetes_clusters.id = ? AND users.organization_id = ?", c.Param("cluster_id"), orgID).
+		First(&cluster).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return 0, false
+	}
+	return cluster.ID, true
+}
+
+func decodeValuePolicy(record models.OrgValuePolicy) (*services.ValuePolicy, error) {
+	var policy services.ValuePolicy
+	if err := json.Unmarshal([]byte(record.Policy), &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode value policy %d: %w", record.ID, err)
+	}
+	return &policy, nil
+}
+
+// loadValuePolicy returns the value policy for plans a user generates for a
+// cluster: the organization default with the cluster's override applied
+func loadValuePolicy(db *database.Database, userID uint, clusterID *uint) (*services.ValuePolicy, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+
+	var records []models.OrgValuePolicy
+	query := db.DB.Where("organization_id = ?", *user.OrganizationID)
+	if clusterID != nil {
+		query = query.Where("cluster_id IS NULL OR cluster_id = ?", *clusterID)
+	} else {
+		query = query.Where("cluster_id IS NULL")
+	}
+	if err := query.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	var orgDefault, clusterOverride *services.ValuePolicy
+	for _, record := range records {
+		policy, err := decodeValuePolicy(record)
+		if err != nil {
+			return nil, err
+		}
+		if record.ClusterID == nil {
+			orgDefault = policy
+		} else {
+			clusterOverride = policy
+		}
+	}
+
+	return services.MergeValuePolicies(orgDefault, clusterOverride), nil
+}
+
+// GetLicensePolicy returns the licenses the organization accepts
+func (h *OrganizationHandler) GetLicensePolicy(c *gin.Context) {
+	var org models.Organization
+	if err := h.db.DB.First(&org, c.GetUint("organization_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	policy, err := decodeLicensePolicy(&org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if policy == nil {
+		policy = &services.LicensePolicy{}
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// SetLicensePolicy replaces the licenses the organization accepts
+func (h *OrganizationHandler) SetLicensePolicy(c *gin.Context) {
+	var policy services.LicensePolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid policy: %v", err)})
+		return
+	}
+
+	if err := h.db.DB.Model(&models.Organization{}).Where("id = ?", c.GetUint("organization_id")).
+		Update("license_policy", string(encoded)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save license policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func decodeLicensePolicy(org *models.Organization) (*services.LicensePolicy, error) {
+	if org.LicensePolicy == "" {
+		return nil, nil
+	}
+	var policy services.LicensePolicy
+	if err := json.Unmarshal([]byte(org.LicensePolicy), &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode license policy of organization %d: %w", org.ID, err)
+	}
+	return &policy, nil
+}
+
+// loadLicensePolicy returns the license policy of the user's organization, or
+// nil when the user has none
+func loadLicensePolicy(db *database.Database, userID uint) (*services.LicensePolicy, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+
+	var org models.Organization
+	if err := db.DB.First(&org, *user.OrganizationID).Error; err != nil {
+		return nil, err
+	}
+	return decodeLicensePolicy(&org)
+}
+
+// GetSecurityPolicy returns the vulnerabilities that block the organization's deployments
+func (h *OrganizationHandler) GetSecurityPolicy(c *gin.Context) {
+	var org models.Organization
+	if err := h.db.DB.First(&org, c.GetUint("organization_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	policy, err := decodeSecurityPolicy(&org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if policy == nil {
+		policy = &services.SecurityPolicy{}
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// SetSecurityPolicy replaces the vulnerabilities that block the organization's deployments
+func (h *OrganizationHandler) SetSecurityPolicy(c *gin.Context) {
+	var policy services.SecurityPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid policy: %v", err)})
+		return
+	}
+
+	if err := h.db.DB.Model(&models.Organization{}).Where("id = ?", c.GetUint("organization_id")).
+		Update("security_policy", string(encoded)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save security policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func decodeSecurityPolicy(org *models.Organization) (*services.SecurityPolicy, error) {
+	if org.SecurityPolicy == "" {
+		return nil, nil
+	}
+	var policy services.SecurityPolicy
+	if err := json.Unmarshal([]byte(org.SecurityPolicy), &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode security policy of organization %d: %w", org.ID, err)
+	}
+	return &policy, nil
+}
+
+// loadSecurityPolicy returns the security policy of the user's organization,
+// or nil when the user has none
+func loadSecurityPolicy(db *database.Database, userID uint) (*services.SecurityPolicy, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+
+	var org models.Organization
+	if err := db.DB.First(&org, *user.OrganizationID).Error; err != nil {
+		return nil, err
+	}
+	return decodeSecurityPolicy(&org)
+}
+
+// GetIngressPolicy returns the hostnames and certificate issuer the
+// organization's plans expose charts with
+func (h *OrganizationHandler) GetIngressPolicy(c *gin.Context) {
+	var org models.Organization
+	if err := h.db.DB.First(&org, c.GetUint("organization_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	policy, err := decodeIngressPolicy(&org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if policy == nil {
+		policy = &services.IngressPolicy{}
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// SetIngressPolicy replaces the hostnames and certificate issuer the
+// organization's plans expose charts with
+func (h *OrganizationHandler) SetIngressPolicy(c *gin.Context) {
+	var policy services.IngressPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid policy: %v", err)})
+		return
+	}
+
+	if err := h.db.DB.Model(&models.Organization{}).Where("id = ?", c.GetUint("organization_id")).
+		Update("ingress_policy", string(encoded)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save ingress policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func decodeIngressPolicy(org *models.Organization) (*services.IngressPolicy, error) {
+	if org.IngressPolicy == "" {
+		return nil, nil
+	}
+	var policy services.IngressPolicy
+	if err := json.Unmarshal([]byte(org.IngressPolicy), &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode ingress policy of organization %d: %w", org.ID, err)
+	}
+	return &policy, nil
+}
+
+// loadIngressPolicy returns the ingress policy of the user's organization,
+// or nil when the user has none
+func loadIngressPolicy(db *database.Database, userID uint) (*services.IngressPolicy, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+
+	var org models.Organization
+	if err := db.DB.First(&org, *user.OrganizationID).Error; err != nil {
+		return nil, err
+	}
+	return decodeIngressPolicy(&org)
+}
+
+// GetChartPolicy returns how the organization's plans rank the charts of a
+// chart search
+func (h *OrganizationHandler) GetChartPolicy(c *gin.Context) {
+	var org models.Organization
+	if err := h.db.DB.First(&org, c.GetUint("organization_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return
+	}
+
+	policy, err := decodeChartPolicy(&org)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if policy == nil {
+		policy = &services.ChartPolicy{}
+	}
+	c.JSON(http.StatusOK, gin.H{"policy": policy, "default_trusted_publishers": services.DefaultTrustedPublishers})
+}
+
+// SetChartPolicy replaces how the organization's plans rank the charts of a
+// chart search
+func (h *OrganizationHandler) SetChartPolicy(c *gin.Context) {
+	var policy services.ChartPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	encoded, err := json.Marshal(policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid policy: %v", err)})
+		return
+	}
+
+	if err := h.db.DB.Model(&models.Organization{}).Where("id = ?", c.GetUint("organization_id")).
+		Update("chart_policy", string(encoded)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save chart policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+func decodeChartPolicy(org *models.Organization) (*services.ChartPolicy, error) {
+	if org.ChartPolicy == "" {
+		return nil, nil
+	}
+	var policy services.ChartPolicy
+	if err := json.Unmarshal([]byte(org.ChartPolicy), &policy); err != nil {
+		return nil, fmt.Errorf("failed to decode chart policy of organization %d: %w", org.ID, err)
+	}
+	return &policy, nil
+}
+
+// loadChartPolicy returns the chart policy of the user's organization, or nil
+// when the user has none
+func loadChartPolicy(db *database.Database, userID uint) (*services.ChartPolicy, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+
+	var org models.Organization
+	if err := db.DB.First(&org, *user.OrganizationID).Error; err != nil {
+		return nil, err
+	}
+	return decodeChartPolicy(&org)
+}
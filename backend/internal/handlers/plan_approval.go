@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ReviewPlanRequest approves or rejects a plan with an optional comment
+type ReviewPlanRequest struct {
+	Comment string `json:"comment"`
+}
+
+// GetPendingPlans lists the organization's plans waiting for approval, oldest
+// first, with the list parameters (sortable by created_at)
+func (h *AgentHandler) GetPendingPlans(c *gin.Context) {
+	orgID := c.GetUint("organization_id")
+
+	params := parseListParams(c, "created_at")
+	query := h.db.DB.Model(&models.DeploymentPlanRecord{}).
+		Where("organization_id = ? AND status = ?", orgID, models.PlanStatusPendingApproval)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count plans: %v", err)})
+		return
+	}
+
+	page, err := params.paginate(query.Preload("User"), map[string]string{"created_at": "created_at"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var plans []models.DeploymentPlanRecord
+	if err := page.Find(&plans).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load plans: %v", err)})
+		return
+	}
+
+	respondWithList(c, params, total, "plans", plans)
+}
+
+// ApprovePlan allows a pending plan to be deployed
+func (h *AgentHandler) ApprovePlan(c *gin.Context) {
+	h.reviewPlan(c, models.PlanStatusApproved)
+}
+
+// RejectPlan blocks a pending plan from being deployed
+func (h *AgentHandler) RejectPlan(c *gin.Context) {
+	h.reviewPlan(c, models.PlanStatusRejected)
+}
+
+// reviewPlan records an operator's or admin's decision on a plan of their
+// organization. Users can't review their own plans. A plan whose template
+// requires several approvals is approved once that many reviewers approved
+// it; a single rejection rejects it.
+func (h *AgentHandler) reviewPlan(c *gin.Context, status string) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	orgID := c.GetUint("organization_id")
+
+	var req ReviewPlanRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var record models.DeploymentPlanRecord
+	if err := h.db.DB.Where("id = ? AND organization_id = ?", c.Param("id"), orgID).First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deployment plan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load plan: %v", err)})
+		return
+	}
+	if record.UserID == userID.(uint) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Plans must be reviewed by a different user than their author"})
+		return
+	}
+	if record.Status != models.PlanStatusPendingApproval {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Deployment plan is %s, not pending approval", record.Status)})
+		return
+	}
+
+	reviewer := userID.(uint)
+	// Plans needing several approvals stay pending until enough reviewers approved
+	var approvals []models.PlanApproval
+	if status == models.PlanStatusApproved && record.RequiredApprovals > 1 {
+		var err error
+		approvals, err = h.addApproval(&record, reviewer, req.Comment)
+		if errors.Is(err, errAlreadyApproved) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to record approval: %v", err)})
+			return
+		}
+		if len(approvals) < record.RequiredApprovals {
+			c.JSON(http.StatusOK, gin.H{"plan": record, "approvals": approvals})
+			return
+		}
+	}
+
+	now := time.Now()
+	// Only update the plan if it is still pending, in case another reviewer was faster
+	result := h.db.DB.Model(&record).Where("status = ?", models.PlanStatusPendingApproval).Updates(map[string]interface{}{
+		"status":         status,
+		"reviewed_by":    reviewer,
+		"reviewed_at":    now,
+		"review_comment": req.Comment,
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update plan: %v", result.Error)})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Deployment plan was reviewed by someone else"})
+		return
+	}
+
+	record.Status = status
+	record.ReviewedBy = &reviewer
+	record.ReviewedAt = &now
+	record.ReviewComment = req.Comment
+	if approvals != nil {
+		c.JSON(http.StatusOK, gin.H{"plan": record, "approvals": approvals})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"plan": record})
+}
+
+// errAlreadyApproved rejects a second approval of a plan by the same reviewer
+var errAlreadyApproved = errors.New("you already approved this plan, it needs approvals of other reviewers")
+
+// addApproval records a reviewer's approval of a plan needing several and
+// returns the plan's approvals so far
+func (h *AgentHandler) addApproval(record *models.DeploymentPlanRecord, reviewer uint, comment string) ([]models.PlanApproval, error) {
+	var approvals []models.PlanApproval
+	err := h.db.DB.Transaction(func(tx *gorm.DB) error {
+		var existing int64
+		if err := tx.Model(&models.PlanApproval{}).Where("plan_id = ? AND user_id = ?", record.ID, reviewer).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return errAlreadyApproved
+		}
+		if err := tx.Create(&models.PlanApproval{PlanID: record.ID, UserID: reviewer, Comment: comment}).Error; err != nil {
+			return err
+		}
+		return tx.Where("plan_id = ?", record.ID).Order("created_at").Find(&approvals).Error
+	})
+	return approvals, err
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestProductionClustersNeedApprovedPlans checks which stored plans may be
+// deployed to a user's development and production clusters
+func TestProductionClustersNeedApprovedPlans(t *testing.T) {
+	db := connectTestDatabase(t)
+	handler := &AgentHandler{db: db}
+
+	user := models.User{Email: "dev@example.com", Password: "-"}
+	other := models.User{Email: "ops@example.com", Password: "-"}
+	for _, u := range []*models.User{&user, &other} {
+		if err := db.DB.Create(u).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	dev := models.KubernetesCluster{UserID: user.ID, Name: "dev", KubeConfig: "-", Environment: agent.EnvironmentDev}
+	prod := models.KubernetesCluster{UserID: user.ID, Name: "prod", KubeConfig: "-", Environment: agent.EnvironmentProd}
+	for _, cluster := range []*models.KubernetesCluster{&dev, &prod} {
+		if err := db.DB.Create(cluster).Error; err != nil {
+			t.Fatalf("create cluster: %v", err)
+		}
+	}
+
+	draft := &models.DeploymentPlanRecord{ID: "plan-draft", UserID: user.ID, Status: models.PlanStatusDraft}
+	if err := handler.planDeployableTo(draft, dev.ID, user.ID); err != nil {
+		t.Fatalf("draft plan can't be deployed to a development cluster: %v", err)
+	}
+	if err := handler.planDeployableTo(draft, prod.ID, user.ID); err == nil {
+		t.Fatal("draft plan can be deployed to a production cluster")
+	}
+	if err := handler.planDeployableTo(draft, dev.ID, other.ID); err == nil {
+		t.Fatal("plan can be deployed to another user's cluster")
+	}
+
+	approved := &models.DeploymentPlanRecord{ID: "plan-approved", UserID: user.ID, Status: models.PlanStatusApproved}
+	if err := handler.planDeployableTo(approved, prod.ID, user.ID); err != nil {
+		t.Fatalf("approved plan can't be deployed to a production cluster: %v", err)
+	}
+
+	for _, status := range []string{models.PlanStatusPendingApproval, models.PlanStatusRejected} {
+		record := &models.DeploymentPlanRecord{ID: "plan-" + status, UserID: user.ID, Status: status}
+		if err := handler.planDeployableTo(record, dev.ID, user.ID); err == nil {
+			t.Fatalf("%s plan can be deployed", status)
+		}
+	}
+}
+
+// TestPlanAuthorsCantApproveTheirPlans reviews a pending plan as its author,
+// then as another member of the organization
+func TestPlanAuthorsCantApproveTheirPlans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := connectTestDatabase(t)
+	handler := &AgentHandler{db: db}
+
+	organization := models.Organization{Name: "platform"}
+	if err := db.DB.Create(&organization).Error; err != nil {
+		t.Fatalf("create organization: %v", err)
+	}
+	author := models.User{Email: "dev@example.com", Password: "-"}
+	reviewer := models.User{Email: "ops@example.com", Password: "-"}
+	for _, u := range []*models.User{&author, &reviewer} {
+		if err := db.DB.Create(u).Error; err != nil {
+			t.Fatalf("create user: %v", err)
+		}
+	}
+	record := models.DeploymentPlanRecord{
+		ID:             "plan-pending",
+		UserID:         author.ID,
+		OrganizationID: &organization.ID,
+		Plan:           "{}",
+		Status:         models.PlanStatusPendingApproval,
+	}
+	if err := db.DB.Create(&record).Error; err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+
+	review := func(userID uint) int {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/agent/plans/"+record.ID+"/approve", nil)
+		c.Params = gin.Params{{Key: "id", Value: record.ID}}
+		c.Set("user_id", userID)
+		c.Set("organization_id", organization.ID)
+		handler.reviewPlan(c, models.PlanStatusApproved)
+		return recorder.Code
+	}
+
+	if status := review(author.ID); status != http.StatusForbidden {
+		t.Fatalf("author's approval returned %d, want %d", status, http.StatusForbidden)
+	}
+	if status := review(reviewer.ID); status != http.StatusOK {
+		t.Fatalf("reviewer's approval returned %d, want %d", status, http.StatusOK)
+	}
+	var stored models.DeploymentPlanRecord
+	if err := db.DB.Where("id = ?", record.ID).First(&stored).Error; err != nil {
+		t.Fatalf("load plan: %v", err)
+	}
+	if stored.Status != models.PlanStatusApproved || stored.ReviewedBy == nil || *stored.ReviewedBy != reviewer.ID {
+		t.Fatalf("plan is %s, reviewed by %v, want approved by %d", stored.Status, stored.ReviewedBy, reviewer.ID)
+	}
+	// A reviewed plan isn't reviewed again
+	if status := review(reviewer.ID); status != http.StatusConflict {
+		t.Fatalf("second approval returned %d, want %d", status, http.StatusConflict)
+	}
+}
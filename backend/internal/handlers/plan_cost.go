@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnableCostEstimates prices the resources of generated plans
+func (h *AgentHandler) EnableCostEstimates(pricing services.Pricing, priceSheets map[string]services.Pricing) {
+	h.costEstimator = services.NewCostEstimatorService(h.deploymentExecutor, pricing, priceSheets)
+}
+
+// estimatePlanCost sets a plan's resource impact and projected monthly cost
+// from the requests of its charts
+func (h *AgentHandler) estimatePlanCost(ctx context.Context, plan *agent.DeploymentPlan, clusterAnalysis *agent.ClusterAnalysis) {
+	if h.costEstimator == nil {
+		return
+	}
+	services.ReportProgress(ctx, 85, "Estimating the plan's cost")
+	cost := h.costEstimator.EstimatePlanCost(ctx, plan, services.CostTargetFromAnalysis(clusterAnalysis))
+	cost.ApplyToImpact(&plan.ResourceImpact)
+}
+
+// GetPlanCost returns the projected monthly cost of a stored plan per chart.
+// The plan's cluster, or ?cluster_id=, selects the provider's price sheet and
+// the node count DaemonSets are priced for; ?provider= names a sheet directly.
+func (h *AgentHandler) GetPlanCost(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if h.costEstimator == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Cost estimates are disabled"})
+		return
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	target := services.CostTarget{Nodes: 1}
+	var override *uint
+	if value := c.Query("cluster_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cluster_id must be a number"})
+			return
+		}
+		clusterID := uint(id)
+		override = &clusterID
+	}
+	if override != nil || record.ClusterID != nil {
+		cluster, err := h.getPlanCluster(record, override, userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		target = clusterCostTarget(c.Request.Context(), cluster)
+	}
+	if provider := c.Query("provider"); provider != "" {
+		target.Provider = provider
+	}
+
+	ctx := withRegistryCredentials(c.Request.Context(), h.db, userID.(uint))
+	c.JSON(http.StatusOK, h.costEstimator.EstimatePlanCost(ctx, plan, target))
+}
+
+// clusterCostTarget reads the provider and Linux node count of a cluster. An
+// unreachable cluster is priced with the default pricing on one node.
+func clusterCostTarget(ctx context.Context, cluster *models.KubernetesCluster) services.CostTarget {
+	target := services.CostTarget{Nodes: 1}
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		fmt.Printf("Failed to connect to cluster %d for cost estimates: %v\n", cluster.ID, err)
+		return target
+	}
+	nodes, err := client.ListNodes(ctx)
+	if err != nil {
+		fmt.Printf("Failed to list nodes of cluster %d for cost estimates: %v\n", cluster.ID, err)
+		return target
+	}
+
+	var linux int64
+	for _, node := range nodes {
+		if target.Provider == "" {
+			target.Provider = services.CloudProvider(node.Spec.ProviderID, node.Labels)
+		}
+		if node.Status.NodeInfo.OperatingSystem != "windows" && !node.Spec.Unschedulable {
+			linux++
+		}
+	}
+	if linux > 0 {
+		target.Nodes = linux
+	}
+	return target
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EditPlanRequest lists edits applied to a plan together, in order
+type EditPlanRequest struct {
+	Edits   []services.PlanEdit `json:"edits" binding:"required,min=1"`
+	Comment string              `json:"comment"`
+}
+
+// PlanEdit is an entry of a plan's edit history
+type PlanEdit struct {
+	models.PlanEditRecord
+	Edits []services.PlanEdit `json:"edits"`
+}
+
+// EditPlan applies structured edits to one of the user's plans: changing a
+// chart's version, setting or removing a values key, removing a step or
+// moving it. Edits apply all together or not at all. Edited charts are
+// checked against Artifact Hub, and approved plans need approval again.
+func (h *AgentHandler) EditPlan(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req EditPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	// Running deployments resume and report against the plan's steps
+	var running int64
+	if err := h.db.DB.Model(&models.DeploymentExecutionRecord{}).Where("plan_id = ? AND status = ?", plan.ID, "running").Count(&running).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to check deployments of plan: %v", err)})
+		return
+	}
+	if running > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Deployment plan is being deployed and can't be edited until the deployment finishes"})
+		return
+	}
+
+	if err := services.ApplyPlanEdits(plan, req.Edits); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if problems := h.helmService.ValidatePlanEdits(plan, req.Edits); len(problems) > 0 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Edited plan is invalid", "problems": problems})
+		return
+	}
+	// Scans of the previous images and charts no longer apply
+	plan.SecurityReport = nil
+
+	encoded, err := json.Marshal(req.Edits)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid edits: %v", err)})
+		return
+	}
+	if err := h.updatePlan(record, plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save plan: %v", err)})
+		return
+	}
+	if err := h.db.DB.Model(record).Update("license_report", "").Error; err != nil {
+		fmt.Printf("Failed to clear license report of plan %s: %v\n", plan.ID, err)
+	}
+	edit := models.PlanEditRecord{
+		PlanID:  plan.ID,
+		UserID:  userID.(uint),
+		Edits:   string(encoded),
+		Comment: req.Comment,
+	}
+	if err := h.db.DB.Create(&edit).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Plan was edited but its edit history couldn't be saved: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan":   plan,
+		"status": record.Status,
+		"edit":   PlanEdit{PlanEditRecord: edit, Edits: req.Edits},
+	})
+}
+
+// GetPlanEdits returns the edit history of one of the user's plans, oldest
+// first, with the list parameters (sortable by created_at)
+func (h *AgentHandler) GetPlanEdits(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, _, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	params := parseListParams(c, "created_at")
+	query := h.db.Reader().Model(&models.PlanEditRecord{}).Where("plan_id = ?", plan.ID)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count plan edits: %v", err)})
+		return
+	}
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var records []models.PlanEditRecord
+	if err := page.Find(&records).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load plan edits: %v", err)})
+		return
+	}
+
+	edits := make([]PlanEdit, len(records))
+	for i, record := range records {
+		edits[i] = PlanEdit{PlanEditRecord: record}
+		if err := json.Unmarshal([]byte(record.Edits), &edits[i].Edits); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to decode edit %d: %v", record.ID, err)})
+			return
+		}
+	}
+	respondWithList(c, params, total, "edits", edits)
+}
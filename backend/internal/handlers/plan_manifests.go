@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPlanManifests renders every chart of a plan with its generated values,
+// along with the plan's raw manifests, so the YAML each step applies can be
+// reviewed and diffed before deploying. ?step_id= renders one step,
+// ?include_crds=true adds the CRDs of charts and ?format=yaml downloads all
+// steps as one YAML stream instead of JSON per step.
+func (h *AgentHandler) GetPlanManifests(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, _, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown format %q, use json or yaml", format)})
+		return
+	}
+
+	if stepID := c.Query("step_id"); stepID != "" {
+		var selected []agent.DeploymentStep
+		for _, step := range plan.Steps {
+			if step.ID == stepID {
+				selected = append(selected, step)
+			}
+		}
+		if len(selected) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Plan has no step %s", stepID)})
+			return
+		}
+		plan.Steps = selected
+	}
+
+	ctx := withRegistryCredentials(c.Request.Context(), h.db, userID.(uint))
+	manifests := h.deploymentExecutor.RenderPlanManifests(ctx, plan, c.Query("include_crds") == "true")
+	if manifests == nil {
+		manifests = []services.StepManifest{}
+	}
+
+	if format == "yaml" {
+		for _, manifest := range manifests {
+			if manifest.Error != "" {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Failed to render step %s: %s", manifest.StepID, manifest.Error)})
+				return
+			}
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=manifests-%s.yaml", plan.ID))
+		c.Data(http.StatusOK, "application/yaml", []byte(services.JoinStepManifests(manifests)))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan_id": plan.ID,
+		"steps":   manifests,
+	})
+}
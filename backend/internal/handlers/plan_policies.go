@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PolicyViolationError stops a deployment whose plan fails the organization's policies
+type PolicyViolationError struct {
+	Evaluation *services.PolicyEvaluation
+}
+
+func (e *PolicyViolationError) Error() string {
+	var reasons []string
+	for _, violation := range e.Evaluation.Violations {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", violation.Policy, violation.Message))
+	}
+	reasons = append(reasons, e.Evaluation.Errors...)
+	return "plan violates organization policies: " + strings.Join(reasons, "; ")
+}
+
+// GetPlanPolicies evaluates a plan and its rendered manifests against the
+// organization's policies without deploying it
+func (h *AgentHandler) GetPlanPolicies(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, _, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	evaluation, err := h.evaluatePolicies(c.Request.Context(), userID.(uint), plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, evaluation)
+}
+
+// enforcePolicies returns a PolicyViolationError when the plan fails the
+// organization's policies. Policies can't be skipped.
+func (h *AgentHandler) enforcePolicies(ctx context.Context, userID uint, plan *agent.DeploymentPlan) error {
+	evaluation, err := h.evaluatePolicies(ctx, userID, plan)
+	if err != nil {
+		return err
+	}
+	if !evaluation.Passed {
+		return &PolicyViolationError{Evaluation: evaluation}
+	}
+	return nil
+}
+
+func (h *AgentHandler) evaluatePolicies(ctx context.Context, userID uint, plan *agent.DeploymentPlan) (*services.PolicyEvaluation, error) {
+	policies, err := loadPolicies(h.db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load policies: %w", err)
+	}
+	evaluation, err := h.policyEngine.EvaluatePlan(withRegistryCredentials(ctx, h.db, userID), plan, policies)
+	if err != nil {
+		return nil, fmt.Errorf("policy evaluation failed: %w", err)
+	}
+	return evaluation, nil
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SimulatePlanRequest picks the cluster whose latest snapshot a plan is simulated against
+type SimulatePlanRequest struct {
+	ClusterID *uint `json:"cluster_id,omitempty"`
+}
+
+// SimulatePlan executes a stored plan against an in-memory cluster rebuilt from
+// the latest snapshot of the target cluster, reporting the objects it would
+// create and the preflight checks that would fail. The cluster itself is
+// never contacted.
+func (h *AgentHandler) SimulatePlan(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req SimulatePlanRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	cluster, err := h.getPlanCluster(record, req.ClusterID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var snapshot models.ClusterSnapshot
+	if err := h.db.DB.Where("cluster_id = ?", cluster.ID).Order("created_at DESC").First(&snapshot).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No snapshots recorded for this cluster yet, analyze it first"})
+		return
+	}
+	analysis, err := decodeSnapshot(&snapshot)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	analysis.ClusterID = cluster.ID
+
+	policy, err := loadValuePolicy(h.db, userID.(uint), &cluster.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load value policy: %v", err)})
+		return
+	}
+
+	ctx := withRegistryCredentials(c.Request.Context(), h.db, userID.(uint))
+	simulation, err := h.preflight.SimulatePlan(ctx, plan, analysis, snapshot.CreatedAt, policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Plan simulation failed: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, simulation)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultLogTailLines = 500
+	// maxLogBytes caps non-streaming responses
+	maxLogBytes = 10 << 20
+)
+
+// GetPodLogs returns a container's logs. Supports ?container=, ?tail_lines=,
+// ?since= (a duration like 15m or an RFC 3339 time), ?previous=true and
+// ?timestamps=true. With ?follow=true the logs are streamed as plain text until
+// the client disconnects or the container stops.
+func (h *KubernetesHandler) GetPodLogs(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	options, err := podLogOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return
+	}
+
+	namespace, pod := c.Param("ns"), c.Param("pod")
+	stream, err := client.StreamPodLogs(c.Request.Context(), namespace, pod, options)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer stream.Close()
+
+	if !options.Follow {
+		logs, err := io.ReadAll(stream)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to read logs: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"namespace": namespace,
+			"pod":       pod,
+			"container": options.Container,
+			"logs":      string(logs),
+			"truncated": int64(len(logs)) >= maxLogBytes,
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	reader := bufio.NewReader(stream)
+	c.Stream(func(w io.Writer) bool {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if _, writeErr := w.Write(line); writeErr != nil {
+				return false
+			}
+		}
+		return err == nil
+	})
+}
+
+// podLogOptions reads the log options from the query string
+func podLogOptions(c *gin.Context) (*corev1.PodLogOptions, error) {
+	options := &corev1.PodLogOptions{
+		Container:  c.Query("container"),
+		Follow:     c.Query("follow") == "true",
+		Previous:   c.Query("previous") == "true",
+		Timestamps: c.Query("timestamps") == "true",
+	}
+	if options.Follow && options.Previous {
+		return nil, fmt.Errorf("follow and previous cannot be combined")
+	}
+
+	tail := int64(defaultLogTailLines)
+	if value := c.Query("tail_lines"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("tail_lines must be a non-negative integer")
+		}
+		tail = parsed
+	}
+	// tail_lines=0 returns the whole log
+	if tail > 0 {
+		options.TailLines = &tail
+	}
+
+	if value := c.Query("since"); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+			seconds := int64(duration.Seconds())
+			if seconds < 1 {
+				seconds = 1
+			}
+			options.SinceSeconds = &seconds
+		} else if at, err := time.Parse(time.RFC3339, value); err == nil {
+			since := metav1.NewTime(at)
+			options.SinceTime = &since
+		} else {
+			return nil, fmt.Errorf("since must be a duration like 15m or an RFC 3339 time")
+		}
+	}
+
+	if !options.Follow {
+		limit := int64(maxLogBytes)
+		options.LimitBytes = &limit
+	}
+	return options, nil
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// exampleLimit answers rated helpful at most are added to a query's prompt
+	// as examples
+	exampleLimit = 2
+	// exampleMinSimilarity is the cosine similarity rated answers need to be
+	// added as examples. They show the style of a good answer rather than
+	// ground it, so it's lower than that of past queries.
+	exampleMinSimilarity = 0.3
+)
+
+// QueryFeedbackRequest rates the answer to a query
+type QueryFeedbackRequest struct {
+	// Rating is up for a helpful answer or down for an unhelpful one
+	Rating  string `json:"rating" binding:"required,oneof=up down"`
+	Comment string `json:"comment" binding:"max=2000"`
+}
+
+// RateQuery records the user's feedback on the answer to one of their
+// queries. Rating it again replaces the feedback.
+func (h *AgentHandler) RateQuery(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req QueryFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var record models.AgentQuery
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&record).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Query not found"})
+		return
+	}
+	if record.Status == queryStatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Failed queries have no answer to rate"})
+		return
+	}
+
+	rating := 1
+	if req.Rating == "down" {
+		rating = -1
+	}
+	now := time.Now()
+	err := h.db.DB.Model(&record).Updates(map[string]interface{}{
+		"rating":           rating,
+		"feedback_comment": strings.TrimSpace(req.Comment),
+		"rated_at":         now,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feedback"})
+		return
+	}
+
+	c.JSON(http.StatusOK, QueryHistoryEntry{
+		ID:              record.ID,
+		ClusterID:       record.ClusterID,
+		Query:           record.Query,
+		Response:        record.Response,
+		Status:          record.Status,
+		Rating:          &rating,
+		FeedbackComment: strings.TrimSpace(req.Comment),
+		PromptVersion:   record.PromptVersion,
+		CreatedAt:       record.CreatedAt,
+	})
+}
+
+// ratedExamples picks answers of the team rated helpful to show the model as
+// examples: the nearest to the embedding of a query, or without one the
+// latest, preferring those about the query's cluster. Answers already added
+// as past queries are skipped. Examples only steer the answer, so failures
+// are logged and skipped.
+func (h *AgentHandler) ratedExamples(ctx context.Context, userID uint, clusterID *uint, embedding []float32, exclude []SimilarQuery) []SimilarQuery {
+	var candidates []SimilarQuery
+	var err error
+	if embedding != nil {
+		candidates, err = h.searchSimilarQueries(ctx, userID, embedding, nil, exampleLimit+len(exclude), true)
+	} else {
+		candidates, err = h.latestRatedQueries(ctx, userID, clusterID, exampleLimit+len(exclude))
+	}
+	if err != nil {
+		fmt.Printf("Failed to load rated answers: %v\n", err)
+		return nil
+	}
+
+	skip := make(map[uint]bool, len(exclude))
+	for _, query := range exclude {
+		skip[query.QueryID] = true
+	}
+	var examples []SimilarQuery
+	for _, query := range candidates {
+		if skip[query.QueryID] || (embedding != nil && query.Similarity < exampleMinSimilarity) {
+			continue
+		}
+		examples = append(examples, query)
+		if len(examples) == exampleLimit {
+			break
+		}
+	}
+	return examples
+}
+
+// latestRatedQueries returns the latest answers rated helpful visible to the
+// user, those about the cluster first
+func (h *AgentHandler) latestRatedQueries(ctx context.Context, userID uint, clusterID *uint, limit int) ([]SimilarQuery, error) {
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	query := h.db.Reader().WithContext(ctx).Table("agent_queries AS q").
+		Select("q.id AS query_id, q.user_id, q.cluster_id, k.name AS cluster_name, q.query, q.response, q.created_at").
+		Joins("LEFT JOIN kubernetes_clusters k ON k.id = q.cluster_id").
+		Where("q.deleted_at IS NULL AND q.rating > 0")
+	if user.OrganizationID != nil {
+		query = query.Joins("JOIN users u ON u.id = q.user_id").Where("u.organization_id = ?", *user.OrganizationID)
+	} else {
+		query = query.Where("q.user_id = ?", user.ID)
+	}
+	if clusterID != nil {
+		query = query.Order(clause.OrderBy{Expression: clause.Expr{SQL: "CASE WHEN q.cluster_id = ? THEN 0 ELSE 1 END", Vars: []interface{}{*clusterID}}})
+	}
+
+	queries := []SimilarQuery{}
+	if err := query.Order("q.rated_at DESC").Limit(limit).Scan(&queries).Error; err != nil {
+		return nil, fmt.Errorf("failed to query rated answers: %w", err)
+	}
+	return queries, nil
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpdateRunbookRequest replaces the content of a runbook with a new version
+type UpdateRunbookRequest struct {
+	Content string `json:"content" binding:"required"`
+	Title   string `json:"title,omitempty"`
+}
+
+// RunbookVersionEntry is a runbook version in the version list
+type RunbookVersionEntry struct {
+	Version   int       `json:"version"`
+	Title     string    `json:"title"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetRunbook returns the latest runbook of a deployment, or ?version=
+func (h *AgentHandler) GetRunbook(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query := h.db.DB.Where("execution_id = ? AND user_id = ?", c.Param("id"), userID)
+	if version := c.Query("version"); version != "" {
+		number, err := strconv.Atoi(version)
+		if err != nil || number <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+			return
+		}
+		query = query.Where("version = ?", number)
+	}
+
+	var runbook models.Runbook
+	if err := query.Order("version DESC").First(&runbook).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Runbook not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, runbook)
+}
+
+// GetRunbookVersions lists the versions of a deployment's runbook, newest first
+func (h *AgentHandler) GetRunbookVersions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var runbooks []models.Runbook
+	if err := h.db.Reader().Select("version", "title", "source", "created_at").
+		Where("execution_id = ? AND user_id = ?", c.Param("id"), userID).
+		Order("version DESC").Find(&runbooks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load runbook versions: %v", err)})
+		return
+	}
+
+	versions := make([]RunbookVersionEntry, 0, len(runbooks))
+	for _, runbook := range runbooks {
+		versions = append(versions, RunbookVersionEntry{
+			Version:   runbook.Version,
+			Title:     runbook.Title,
+			Source:    runbook.Source,
+			CreatedAt: runbook.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"execution_id": c.Param("id"), "versions": versions})
+}
+
+// UpdateRunbook stores user edits as a new runbook version
+func (h *AgentHandler) UpdateRunbook(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req UpdateRunbookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Runbook content cannot be empty"})
+		return
+	}
+
+	_, record, err := h.getDeploymentExecution(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	title := req.Title
+	if title == "" {
+		var latest models.Runbook
+		if err := h.db.DB.Where("execution_id = ?", record.ID).Order("version DESC").First(&latest).Error; err == nil {
+			title = latest.Title
+		}
+	}
+
+	runbook, err := saveRunbookVersion(h.db, models.Runbook{
+		ExecutionID: record.ID,
+		UserID:      record.UserID,
+		ClusterID:   record.ClusterID,
+		PlanID:      record.PlanID,
+		Title:       title,
+		Content:     req.Content,
+		Source:      services.RunbookSourceUser,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save runbook: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, runbook)
+}
+
+// RegenerateRunbook asks the agent for a fresh runbook, stored as a new version
+func (h *AgentHandler) RegenerateRunbook(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	execution, record, err := h.getDeploymentExecution(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	plan, _, err := h.getDeploymentPlan(execution.PlanID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	runbook, err := h.writeRunbook(c.Request.Context(), record, plan)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate runbook: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, runbook)
+}
+
+// writeRunbook generates a runbook for a deployment and stores it as a new
+// version. A template runbook is stored when the model is unavailable.
+func (h *AgentHandler) writeRunbook(ctx context.Context, record *models.DeploymentExecutionRecord, plan *agent.DeploymentPlan) (*models.Runbook, error) {
+	issues, err := loadKnownIssues(h.db)
+	if err != nil {
+		fmt.Printf("Failed to load known issues for runbook of %s: %v\n", record.ID, err)
+	}
+
+	source := services.RunbookSourceAgent
+	content, err := h.runbookGenerator.Generate(ctx, plan, issues)
+	if err != nil {
+		fmt.Printf("Failed to generate runbook for %s, using template: %v\n", record.ID, err)
+		source = services.RunbookSourceTemplate
+		content = h.runbookGenerator.TemplateRunbook(plan, issues)
+	}
+
+	return saveRunbookVersion(h.db, models.Runbook{
+		ExecutionID: record.ID,
+		UserID:      record.UserID,
+		ClusterID:   record.ClusterID,
+		PlanID:      record.PlanID,
+		Title:       fmt.Sprintf("Runbook: %s", plan.Name),
+		Content:     content,
+		Source:      source,
+	})
+}
+
+// writeRunbookInBackground writes the first runbook of a completed deployment
+// without holding up the deploy response
+func (h *AgentHandler) writeRunbookInBackground(userID uint, execution *agent.DeploymentExecution, plan *agent.DeploymentPlan) {
+	if execution.Status != "completed" {
+		return
+	}
+	go func() {
+		var record models.DeploymentExecutionRecord
+		if err := h.db.DB.Where("id = ? AND user_id = ?", execution.ID, userID).First(&record).Error; err != nil {
+			fmt.Printf("Failed to load deployment %s for runbook: %v\n", execution.ID, err)
+			return
+		}
+		if _, err := h.writeRunbook(context.Background(), &record, plan); err != nil {
+			fmt.Printf("Failed to save runbook for %s: %v\n", execution.ID, err)
+		}
+	}()
+}
+
+// saveRunbookVersion stores a runbook as the next version of its deployment's runbook
+func saveRunbookVersion(db *database.Database, runbook models.Runbook) (*models.Runbook, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var latest models.Runbook
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("execution_id = ?", runbook.ExecutionID).
+			Order("version DESC").First(&latest).Error
+		switch {
+		case err == nil:
+			runbook.Version = latest.Version + 1
+		case err == gorm.ErrRecordNotFound:
+			runbook.Version = 1
+		default:
+			return err
+		}
+		return tx.Create(&runbook).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &runbook, nil
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDeploymentSBOM downloads the software bill of materials of a completed
+// deployment as SPDX (?format=spdx, the default) or CycloneDX
+// (?format=cyclonedx) JSON
+func (h *AgentHandler) GetDeploymentSBOM(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	execution, _, err := h.getDeploymentExecution(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if execution.SBOM == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment %s has no SBOM, only completed deployments get one", execution.ID)})
+		return
+	}
+
+	stackName := execution.PlanID
+	if plan, _, err := h.getDeploymentPlan(execution.PlanID, userID.(uint)); err == nil && plan.Name != "" {
+		stackName = plan.Name
+	}
+	format := c.DefaultQuery("format", services.SBOMFormatSPDX)
+	data, contentType, err := services.RenderSBOM(execution.SBOM, execution.ID, stackName, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	extension := "spdx.json"
+	if format == services.SBOMFormatCycloneDX {
+		extension = "cdx.json"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=sbom-%s.%s", execution.ID, extension))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// recordSBOM stores the SBOM of a completed deployment on its execution before
+// it is saved. The SBOM only documents the deployment, so failures are logged.
+func recordSBOM(ctx context.Context, kubeconfig string, plan *agent.DeploymentPlan, execution *agent.DeploymentExecution) {
+	if execution.Status != "completed" {
+		return
+	}
+	sbom, err := services.GenerateSBOM(ctx, kubeconfig, plan, execution)
+	if err != nil {
+		fmt.Printf("Failed to generate SBOM of deployment %s: %v\n", execution.ID, err)
+		return
+	}
+	execution.SBOM = sbom
+}
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultScheduleWindow is how late a scheduled run may start by default
+const defaultScheduleWindow = 60
+
+// CreateScheduleRequest schedules a stored plan once at run_at, or on a cron schedule
+type CreateScheduleRequest struct {
+	PlanID string `json:"plan_id" binding:"required"`
+	// ClusterID defaults to the plan's cluster
+	ClusterID *uint      `json:"cluster_id,omitempty"`
+	Cron      string     `json:"cron,omitempty"`
+	RunAt     *time.Time `json:"run_at,omitempty"`
+	// Timezone is the IANA zone the cron expression is evaluated in, default UTC
+	Timezone          string `json:"timezone,omitempty"`
+	WindowMinutes     int    `json:"window_minutes,omitempty" binding:"omitempty,min=1"`
+	ScopedCredentials bool   `json:"scoped_credentials,omitempty"`
+}
+
+// CreateSchedule schedules a plan to be deployed with the stored kubeconfig of its cluster
+func (h *AgentHandler) CreateSchedule(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req CreateScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Cron == "") == (req.RunAt == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either cron or run_at"})
+		return
+	}
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if req.WindowMinutes == 0 {
+		req.WindowMinutes = defaultScheduleWindow
+	}
+
+	_, record, err := h.getDeploymentPlan(req.PlanID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	if record.Status == models.PlanStatusRejected {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Deployment plan was rejected", "comment": record.ReviewComment})
+		return
+	}
+	cluster, err := h.getPlanCluster(record, req.ClusterID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := models.ScheduledDeployment{
+		UserID:            userID.(uint),
+		PlanID:            record.ID,
+		ClusterID:         cluster.ID,
+		Cron:              req.Cron,
+		Timezone:          req.Timezone,
+		RunAt:             req.RunAt,
+		WindowMinutes:     req.WindowMinutes,
+		ScopedCredentials: req.ScopedCredentials,
+		Status:            models.ScheduleStatusActive,
+	}
+	next, err := nextScheduledRun(&schedule, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if next == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The schedule never runs after now"})
+		return
+	}
+	schedule.NextRunAt = next
+
+	if err := h.db.DB.Create(&schedule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save schedule: %v", err)})
+		return
+	}
+
+	response := gin.H{"schedule": schedule}
+	if err := h.planDeployableTo(record, schedule.ClusterID, schedule.UserID); err != nil {
+		response["warning"] = fmt.Sprintf("Runs are skipped while the %s", err)
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetSchedules lists the user's scheduled deployments (?status=, ?plan_id=)
+// with the list parameters, sortable by created_at, next_run_at and status
+func (h *AgentHandler) GetSchedules(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	params := parseListParams(c, "-created_at")
+	query := h.db.DB.Model(&models.ScheduledDeployment{}).Where("user_id = ?", userID)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if planID := c.Query("plan_id"); planID != "" {
+		query = query.Where("plan_id = ?", planID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count schedules: %v", err)})
+		return
+	}
+
+	page, err := params.paginate(query, map[string]string{"created_at": "created_at", "next_run_at": "next_run_at", "status": "status"})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var schedules []models.ScheduledDeployment
+	if err := page.Find(&schedules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load schedules: %v", err)})
+		return
+	}
+
+	respondWithList(c, params, total, "schedules", schedules)
+}
+
+// PauseSchedule stops an active schedule from running until it is resumed
+func (h *AgentHandler) PauseSchedule(c *gin.Context) {
+	h.setScheduleStatus(c, models.ScheduleStatusPaused, models.ScheduleStatusActive)
+}
+
+// ResumeSchedule reactivates a paused schedule from its next run after now
+func (h *AgentHandler) ResumeSchedule(c *gin.Context) {
+	h.setScheduleStatus(c, models.ScheduleStatusActive, models.ScheduleStatusPaused)
+}
+
+// CancelSchedule permanently stops a schedule
+func (h *AgentHandler) CancelSchedule(c *gin.Context) {
+	h.setScheduleStatus(c, models.ScheduleStatusCancelled, models.ScheduleStatusActive, models.ScheduleStatusPaused)
+}
+
+// setScheduleStatus moves a schedule of the user to a status, if it is in one of from
+func (h *AgentHandler) setScheduleStatus(c *gin.Context, status string, from ...string) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var schedule models.ScheduledDeployment
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&schedule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	allowed := false
+	for _, current := range from {
+		if schedule.Status == current {
+			allowed = true
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Schedule is %s", schedule.Status)})
+		return
+	}
+
+	// Only active schedules have a next run; resumed ones skip what they missed
+	var next *time.Time
+	if status == models.ScheduleStatusActive {
+		var err error
+		if next, err = nextScheduledRun(&schedule, time.Now()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if next == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "The schedule has no run left after now"})
+			return
+		}
+	}
+
+	result := h.db.DB.Model(&schedule).Where("status = ?", schedule.Status).Updates(map[string]interface{}{
+		"status":      status,
+		"next_run_at": next,
+	})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update schedule: %v", result.Error)})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Schedule changed concurrently, try again"})
+		return
+	}
+
+	schedule.Status = status
+	schedule.NextRunAt = next
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+// StartScheduler runs due scheduled deployments every interval
+func (h *AgentHandler) StartScheduler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			h.runDueSchedules(now)
+		}
+	}()
+}
+
+// runDueSchedules claims the schedules whose run is due and starts them. The
+// claim advances next_run_at first, so several API replicas never run a
+// schedule twice.
+func (h *AgentHandler) runDueSchedules(now time.Time) {
+	var due []models.ScheduledDeployment
+	if err := h.db.DB.Where("status = ? AND next_run_at <= ?", models.ScheduleStatusActive, now).Find(&due).Error; err != nil {
+		fmt.Printf("Failed to load due schedules: %v\n", err)
+		return
+	}
+
+	for _, schedule := range due {
+		scheduledAt := *schedule.NextRunAt
+		next, err := nextScheduledRun(&schedule, now)
+		if err != nil {
+			fmt.Printf("Failed to compute the next run of schedule %d: %v\n", schedule.ID, err)
+			continue
+		}
+		status := models.ScheduleStatusActive
+		if next == nil {
+			status = models.ScheduleStatusCompleted
+		}
+
+		late := now.Sub(scheduledAt)
+		lastStatus := "running"
+		lastError := ""
+		if late > time.Duration(schedule.WindowMinutes)*time.Minute {
+			lastStatus = "skipped"
+			lastError = fmt.Sprintf("Missed the run at %s by %s", scheduledAt.UTC().Format(time.RFC3339), late.Round(time.Second))
+		}
+
+		result := h.db.DB.Model(&models.ScheduledDeployment{}).
+			Where("id = ? AND status = ? AND next_run_at = ?", schedule.ID, models.ScheduleStatusActive, scheduledAt).
+			Updates(map[string]interface{}{
+				"status":      status,
+				"next_run_at": next,
+				"last_run_at": now,
+				"last_status": lastStatus,
+				"last_error":  lastError,
+			})
+		if result.Error != nil {
+			fmt.Printf("Failed to claim schedule %d: %v\n", schedule.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 || lastStatus == "skipped" {
+			continue
+		}
+
+		if _, _, err := h.workers.Enqueue(schedule.UserID, schedule.ClusterID, models.JobSchedule, fmt.Sprintf("schedule/%d", schedule.ID), scheduleJob{ScheduleID: schedule.ID}, false); err != nil {
+			fmt.Printf("Failed to queue run of schedule %d: %v\n", schedule.ID, err)
+			h.recordScheduleRun(schedule.ID, nil, err)
+		}
+	}
+}
+
+// runSchedule deploys a schedule's plan and records the outcome on the schedule
+func (h *AgentHandler) runSchedule(ctx context.Context, schedule models.ScheduledDeployment) (*agent.DeploymentExecution, error) {
+	execution, err := h.executeSchedule(ctx, schedule)
+	h.recordScheduleRun(schedule.ID, execution, err)
+	return execution, err
+}
+
+// recordScheduleRun records the outcome of a run on its schedule
+func (h *AgentHandler) recordScheduleRun(scheduleID uint, execution *agent.DeploymentExecution, err error) {
+	updates := map[string]interface{}{"last_error": ""}
+	if err != nil {
+		updates["last_status"] = "failed"
+		updates["last_error"] = err.Error()
+	} else {
+		updates["last_status"] = execution.Status
+		updates["last_execution_id"] = execution.ID
+		if execution.Status == "failed" {
+			updates["last_error"] = execution.Error
+		}
+	}
+
+	if err := h.db.DB.Model(&models.ScheduledDeployment{}).Where("id = ?", scheduleID).Updates(updates).Error; err != nil {
+		fmt.Printf("Failed to record run of schedule %d: %v\n", scheduleID, err)
+	}
+}
+
+// executeSchedule deploys a schedule's plan with its cluster's stored kubeconfig
+func (h *AgentHandler) executeSchedule(ctx context.Context, schedule models.ScheduledDeployment) (*agent.DeploymentExecution, error) {
+	plan, record, err := h.getDeploymentPlan(schedule.PlanID, schedule.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("deployment plan not found: %w", err)
+	}
+	if err := h.planDeployableTo(record, schedule.ClusterID, schedule.UserID); err != nil {
+		return nil, err
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", schedule.ClusterID, schedule.UserID).First(&cluster).Error; err != nil {
+		return nil, fmt.Errorf("cluster not found")
+	}
+
+	// Recurring runs find the releases of earlier runs installed
+	if schedule.Cron != "" {
+		upgradeInPlace(plan)
+	}
+	if err := h.applyEnvironmentOverlays(schedule.UserID, cluster.ID, plan); err != nil {
+		return nil, err
+	}
+	if err := h.enforceChartRules(schedule.UserID, plan); err != nil {
+		return nil, err
+	}
+	if err := h.enforcePolicies(ctx, schedule.UserID, plan); err != nil {
+		return nil, err
+	}
+	if err := h.enforceSecurityPolicy(ctx, schedule.UserID, plan, record); err != nil {
+		return nil, err
+	}
+	if err := h.enforceValuesSchema(plan); err != nil {
+		return nil, err
+	}
+	ctx, release, err := h.lockDeployment(ctx, schedule.UserID, cluster.ID, plan)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	if err := h.runPreflight(ctx, schedule.UserID, cluster.ID, plan, cluster.KubeConfig); err != nil {
+		return nil, err
+	}
+	return h.executePlan(ctx, schedule.UserID, cluster.ID, plan, cluster.KubeConfig, schedule.ScopedCredentials)
+}
+
+// upgradeInPlace turns chart installs into upgrades, which install releases
+// that don't exist yet and upgrade those that do
+func upgradeInPlace(plan *agent.DeploymentPlan) {
+	for i := range plan.Steps {
+		if plan.Steps[i].Chart != nil && plan.Steps[i].Action != "upgrade" {
+			plan.Steps[i].Action = "upgrade"
+		}
+	}
+}
+
+// nextScheduledRun returns the schedule's first run after now, or nil when it
+// has none left
+func nextScheduledRun(schedule *models.ScheduledDeployment, now time.Time) (*time.Time, error) {
+	if schedule.Cron == "" {
+		if schedule.RunAt == nil || !schedule.RunAt.After(now) {
+			return nil, nil
+		}
+		runAt := *schedule.RunAt
+		return &runAt, nil
+	}
+
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", schedule.Timezone, err)
+	}
+	cron, err := services.ParseCronSchedule(schedule.Cron, location)
+	if err != nil {
+		return nil, err
+	}
+	next := cron.Next(now)
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SecurityScanResponse is a plan's vulnerability scan checked against the
+// organization's security policy
+type SecurityScanResponse struct {
+	PlanID     string                `json:"plan_id"`
+	Report     *agent.SecurityReport `json:"report"`
+	Blocked    bool                  `json:"blocked"`
+	Violations []string              `json:"violations"`
+}
+
+// SecurityViolationError stops a deployment whose images have vulnerabilities
+// the organization's security policy doesn't accept
+type SecurityViolationError struct {
+	Report     *agent.SecurityReport
+	Violations []string
+}
+
+func (e *SecurityViolationError) Error() string {
+	return "plan violates the organization's security policy: " + strings.Join(e.Violations, "; ")
+}
+
+// ScanPlanSecurity scans the images of a plan's charts for vulnerabilities with
+// Trivy and stores the report on the plan. With ?async=true the scan runs as
+// an operation.
+func (h *AgentHandler) ScanPlanSecurity(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	scan := func(ctx context.Context) (*SecurityScanResponse, error) {
+		policy, err := loadSecurityPolicy(h.db, userID.(uint))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load security policy: %w", err)
+		}
+		report, err := h.scanPlanSecurity(ctx, userID.(uint), plan, record)
+		if err != nil {
+			return nil, err
+		}
+		violations := policy.Violations(report)
+		if violations == nil {
+			violations = []string{}
+		}
+		return &SecurityScanResponse{
+			PlanID:     plan.ID,
+			Report:     report,
+			Blocked:    len(violations) > 0,
+			Violations: violations,
+		}, nil
+	}
+
+	if wantsAsync(c) {
+		operation, err := h.operations.Start(userID.(uint), models.OperationSecurityScan, "plan/"+plan.ID, func(ctx context.Context) (interface{}, error) {
+			return scan(ctx)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithOperation(c, operation)
+		return
+	}
+
+	response, err := scan(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// enforceSecurityPolicy scans the plan before it's deployed when the
+// organization's security policy sets a severity to block, and returns a
+// SecurityViolationError when it does. A scan that can't run blocks too.
+func (h *AgentHandler) enforceSecurityPolicy(ctx context.Context, userID uint, plan *agent.DeploymentPlan, record *models.DeploymentPlanRecord) error {
+	policy, err := loadSecurityPolicy(h.db, userID)
+	if err != nil {
+		return fmt.Errorf("failed to load security policy: %w", err)
+	}
+	if !policy.Enforced() {
+		return nil
+	}
+
+	services.ReportProgress(ctx, 0, "Scanning images for vulnerabilities")
+	report, err := h.scanPlanSecurity(ctx, userID, plan, record)
+	if err != nil {
+		return fmt.Errorf("vulnerability scan failed: %w", err)
+	}
+	if violations := policy.Violations(report); len(violations) > 0 {
+		return &SecurityViolationError{Report: report, Violations: violations}
+	}
+	return nil
+}
+
+// scanPlanSecurity scans the plan and stores the report on it. Storing a report
+// doesn't change what the plan deploys, so approved plans stay approved.
+func (h *AgentHandler) scanPlanSecurity(ctx context.Context, userID uint, plan *agent.DeploymentPlan, record *models.DeploymentPlanRecord) (*agent.SecurityReport, error) {
+	report, err := h.securityScanner.ScanPlan(withRegistryCredentials(ctx, h.db, userID), plan)
+	if err != nil {
+		return nil, err
+	}
+	plan.SecurityReport = report
+
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plan: %w", err)
+	}
+	if err := h.db.DB.Model(record).Update("plan", string(encoded)).Error; err != nil {
+		fmt.Printf("Failed to store security report of plan %s: %v\n", plan.ID, err)
+	}
+	return report, nil
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// pastQueryLimit past queries at most are added to a query's prompt
+	pastQueryLimit = 3
+	// pastQueryMinSimilarity is the cosine similarity past queries need to be
+	// added to a prompt, so unrelated ones don't steer the answer
+	pastQueryMinSimilarity = 0.5
+)
+
+// GetSimilarQueries returns the answered queries of the user's organization,
+// or the user's own outside an organization, most similar to ?q=. Accepts
+// ?cluster_id= and ?limit= (default 5, at most 50).
+func (h *AgentHandler) GetSimilarQueries(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	if !h.knowledgeBaseEnabled(c) {
+		return
+	}
+
+	search := strings.TrimSpace(c.Query("q"))
+	if search == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 || limit > 50 {
+		limit = 5
+	}
+	var clusterID *uint
+	if value := c.Query("cluster_id"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster ID"})
+			return
+		}
+		id := uint(parsed)
+		clusterID = &id
+	}
+
+	embedding, err := h.knowledgeBase.EmbedQuery(c.Request.Context(), search)
+	if reason := unavailable(err); reason != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": fmt.Sprintf("Failed to search past queries: %v", reason)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Failed to search past queries: %v", err)})
+		return
+	}
+	queries, err := h.searchSimilarQueries(c.Request.Context(), userID.(uint), embedding, clusterID, limit, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to search past queries: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"queries": queries})
+}
+
+// searchSimilarQueries returns the answered queries visible to the user
+// nearest to the embedding of a query, optionally only those about a cluster
+// or those rated helpful. Answers rated unhelpful are left out.
+func (h *AgentHandler) searchSimilarQueries(ctx context.Context, userID uint, embedding []float32, clusterID *uint, limit int, helpfulOnly bool) ([]SimilarQuery, error) {
+	var user models.User
+	if err := h.db.DB.First(&user, userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	// Cosine distance, like knowledge base searches
+	scope, args := "e.user_id = ?", []interface{}{models.Vector(embedding), user.ID}
+	if user.OrganizationID != nil {
+		scope, args = "e.organization_id = ?", []interface{}{models.Vector(embedding), *user.OrganizationID}
+	}
+	if clusterID != nil {
+		scope += " AND q.cluster_id = ?"
+		args = append(args, *clusterID)
+	}
+	if helpfulOnly {
+		scope += " AND q.rating > 0"
+	} else {
+		scope += " AND (q.rating IS NULL OR q.rating > 0)"
+	}
+	queries := []SimilarQuery{}
+	err := h.db.Reader().WithContext(ctx).Raw(`SELECT q.id AS query_id, q.user_id, q.cluster_id, k.name AS cluster_name, q.query, q.response, q.created_at,
+			1 - (e.embedding <=> ?) AS similarity
+		FROM query_embeddings e
+		JOIN agent_queries q ON q.id = e.query_id AND q.deleted_at IS NULL
+		LEFT JOIN kubernetes_clusters k ON k.id = q.cluster_id
+		WHERE `+scope+`
+		ORDER BY similarity DESC
+		LIMIT ?`, append(args, limit)...).Scan(&queries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embeddings: %w", err)
+	}
+	return queries, nil
+}
+
+// pastQueries retrieves the team's past queries close enough to the embedding
+// of a query to ground its answer in. They only add context, so failures are
+// logged and skipped.
+func (h *AgentHandler) pastQueries(ctx context.Context, userID uint, embedding []float32) []SimilarQuery {
+	if embedding == nil {
+		return nil
+	}
+	queries, err := h.searchSimilarQueries(ctx, userID, embedding, nil, pastQueryLimit, false)
+	if err != nil {
+		fmt.Printf("Failed to search past queries: %v\n", err)
+		return nil
+	}
+
+	var similar []SimilarQuery
+	for _, query := range queries {
+		if query.Similarity >= pastQueryMinSimilarity {
+			similar = append(similar, query)
+		}
+	}
+	return similar
+}
+
+// pastQueryContext is the prompt context of past queries
+func pastQueryContext(queries []SimilarQuery) []agent.PastQuery {
+	var past []agent.PastQuery
+	for _, query := range queries {
+		past = append(past, agent.PastQuery{
+			Query:    query.Query,
+			Response: query.Response,
+			Cluster:  query.ClusterName,
+			AskedAt:  query.CreatedAt,
+		})
+	}
+	return past
+}
+
+// embedQueryInBackground embeds an answered query so later queries of the
+// team can find it. Failed queries and answers from the cache aren't embedded.
+func (h *AgentHandler) embedQueryInBackground(record models.AgentQuery, resp QueryResponse) {
+	if h.knowledgeBase == nil || resp.Status == queryStatusFailed || resp.Cache == services.CacheHit {
+		return
+	}
+	go func() {
+		var user models.User
+		if err := h.db.DB.First(&user, record.UserID).Error; err != nil {
+			fmt.Printf("Failed to load user of query %d: %v\n", record.ID, err)
+			return
+		}
+		embedding, err := h.knowledgeBase.EmbedAnsweredQuery(context.Background(), record.Query, record.Response)
+		if err != nil {
+			fmt.Printf("Failed to embed query %d: %v\n", record.ID, err)
+			return
+		}
+		err = h.db.DB.Create(&models.QueryEmbedding{
+			QueryID:        record.ID,
+			UserID:         record.UserID,
+			OrganizationID: user.OrganizationID,
+			Embedding:      models.Vector(embedding),
+		}).Error
+		if err != nil {
+			fmt.Printf("Failed to save embedding of query %d: %v\n", record.ID, err)
+		}
+	}()
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// slackLinkCodeTTL is how long a Slack link code can be entered
+const slackLinkCodeTTL = 10 * time.Minute
+
+// slackQueryTimeout bounds a query asked from Slack; answers are posted to
+// response URLs Slack accepts for 30 minutes
+const slackQueryTimeout = 10 * time.Minute
+
+// slackDeployTimeout is how long a deployment started from Slack is followed
+const slackDeployTimeout = 25 * time.Minute
+
+// slackButtonValueLimit is the most characters a button's value holds
+const slackButtonValueLimit = 2000
+
+const slackUsage = "*Usage*\n" +
+	"`/k8s-agent link` - link your platform account\n" +
+	"`/k8s-agent use <cluster>` - ask about one of your clusters\n" +
+	"`/k8s-agent <question>` - ask the agent, e.g. `/k8s-agent deploy a monitoring stack with prometheus`"
+
+// SlackHandler serves the Slack app: the /k8s-agent slash command and the
+// buttons of its answers. Commands run as the platform user the Slack user
+// linked their account to.
+type SlackHandler struct {
+	db            *database.Database
+	agents        *AgentHandler
+	responder     *services.SlackResponder
+	signingSecret string
+}
+
+// NewSlackHandler creates a new Slack handler; without a signing secret the
+// integration is off
+func NewSlackHandler(db *database.Database, agents *AgentHandler, signingSecret string) *SlackHandler {
+	return &SlackHandler{
+		db:            db,
+		agents:        agents,
+		responder:     services.NewSlackResponder(),
+		signingSecret: signingSecret,
+	}
+}
+
+// LinkSlackAccountRequest links the Slack account a link code was given to
+type LinkSlackAccountRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// slackInteraction is the payload of a button clicked in a message
+type slackInteraction struct {
+	Type string `json:"type"`
+	User struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"user"`
+	Team struct {
+		ID string `json:"id"`
+	} `json:"team"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	ResponseURL string `json:"response_url"`
+}
+
+// verifiedForm checks that a request comes from the Slack app and returns its
+// form, answering the request when it doesn't
+func (h *SlackHandler) verifiedForm(c *gin.Context) (neturl.Values, bool) {
+	if h.signingSecret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The Slack integration is not configured, set SLACK_SIGNING_SECRET"})
+		return nil, false
+	}
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read request"})
+		return nil, false
+	}
+	if err := services.VerifySlackRequest(h.signingSecret, c.GetHeader("X-Slack-Request-Timestamp"), c.GetHeader("X-Slack-Signature"), body, time.Now()); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	form, err := neturl.ParseQuery(string(body))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form"})
+		return nil, false
+	}
+	return form, true
+}
+
+// HandleCommand answers the /k8s-agent slash command. Questions are
+// acknowledged at once, as Slack waits 3 seconds, and answered in the
+// channel once the agent replies.
+func (h *SlackHandler) HandleCommand(c *gin.Context) {
+	form, ok := h.verifiedForm(c)
+	if !ok {
+		return
+	}
+	teamID, slackUserID := form.Get("team_id"), form.Get("user_id")
+	text := strings.TrimSpace(form.Get("text"))
+	command, argument, _ := strings.Cut(text, " ")
+	argument = strings.TrimSpace(argument)
+
+	switch strings.ToLower(command) {
+	case "", "help":
+		c.JSON(http.StatusOK, slackText(slackUsage))
+		return
+	case "link":
+		code, err := h.startLink(teamID, slackUserID, form.Get("user_name"))
+		if err != nil {
+			c.JSON(http.StatusOK, slackText(fmt.Sprintf("Failed to create a link code: %v", err)))
+			return
+		}
+		c.JSON(http.StatusOK, slackText(fmt.Sprintf("Enter the code `%s` on the platform within %d minutes to link your account (`POST /api/integrations/slack/link`).", code, int(slackLinkCodeTTL.Minutes()))))
+		return
+	}
+
+	account, err := h.linkedAccount(teamID, slackUserID)
+	if err != nil {
+		c.JSON(http.StatusOK, slackText(err.Error()))
+		return
+	}
+	if strings.ToLower(command) == "use" {
+		c.JSON(http.StatusOK, slackText(h.useCluster(account, argument)))
+		return
+	}
+
+	go h.answer(account, text, false, form.Get("response_url"))
+	c.JSON(http.StatusOK, slackText(fmt.Sprintf("Asking the agent: _%s_", text)))
+}
+
+// HandleInteraction runs the actions of the buttons below the agent's answers:
+// creating a plan for a question, and deploying a plan. Slack only needs the
+// request acknowledged; results are posted to the response URL.
+func (h *SlackHandler) HandleInteraction(c *gin.Context) {
+	form, ok := h.verifiedForm(c)
+	if !ok {
+		return
+	}
+	var interaction slackInteraction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		return
+	}
+	c.Status(http.StatusOK)
+	if interaction.Type != "block_actions" || len(interaction.Actions) == 0 {
+		return
+	}
+
+	go func() {
+		account, err := h.linkedAccount(interaction.Team.ID, interaction.User.ID)
+		if err != nil {
+			h.respond(interaction.ResponseURL, slackText(err.Error()))
+			return
+		}
+		action := interaction.Actions[0]
+		switch action.ActionID {
+		case services.SlackActionCreatePlan:
+			h.answer(account, action.Value, true, interaction.ResponseURL)
+		case services.SlackActionDeployPlan:
+			h.deploy(account, action.Value, interaction.ResponseURL)
+		}
+	}()
+}
+
+// startLink gives the Slack user a new link code, replacing any pending one
+func (h *SlackHandler) startLink(teamID, slackUserID, userName string) (string, error) {
+	code, hash, err := services.GenerateSlackLinkCode()
+	if err != nil {
+		return "", err
+	}
+	var account models.SlackAccount
+	err = h.db.DB.Where("team_id = ? AND slack_user_id = ?", teamID, slackUserID).First(&account).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	expires := time.Now().Add(slackLinkCodeTTL)
+	account.TeamID = teamID
+	account.SlackUserID = slackUserID
+	account.SlackUserName = userName
+	account.LinkCodeHash = hash
+	account.LinkCodeExpiresAt = &expires
+	if err := h.db.DB.Save(&account).Error; err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// linkedAccount returns the Slack user's account, or an error telling them to
+// link it. Accounts linked to a deactivated user count as unlinked, the same
+// as ActiveUserMiddleware turns their API requests away.
+func (h *SlackHandler) linkedAccount(teamID, slackUserID string) (*models.SlackAccount, error) {
+	var account models.SlackAccount
+	err := h.db.DB.Joins("JOIN users ON users.id = slack_accounts.user_id AND users.deactivated_at IS NULL AND users.deleted_at IS NULL").
+		Where("slack_accounts.team_id = ? AND slack_accounts.slack_user_id = ?", teamID, slackUserID).
+		First(&account).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("Your Slack account isn't linked to an active platform account, run `/k8s-agent link` first")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to look up your account: %v", err)
+	}
+	return &account, nil
+}
+
+// useCluster sets the cluster the account's questions are about, by name
+func (h *SlackHandler) useCluster(account *models.SlackAccount, name string) string {
+	if name == "" {
+		return "Name one of your clusters: `/k8s-agent use <cluster>`"
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("user_id = ? AND name = ?", *account.UserID, name).First(&cluster).Error; err != nil {
+		return fmt.Sprintf("You have no cluster named %s", name)
+	}
+	if err := h.db.DB.Model(account).Update("cluster_id", cluster.ID).Error; err != nil {
+		return fmt.Sprintf("Failed to select cluster %s: %v", name, err)
+	}
+	return fmt.Sprintf("Questions are now about cluster *%s*", cluster.Name)
+}
+
+// answer asks the agent a question as the account's user and posts the answer
+// to the channel, with a button creating a plan, or deploying the plan the
+// answer came with
+func (h *SlackHandler) answer(account *models.SlackAccount, query string, planRequested bool, responseURL string) {
+	ctx, cancel := context.WithTimeout(context.Background(), slackQueryTimeout)
+	defer cancel()
+
+	req := QueryRequest{
+		Query:         query,
+		ClusterID:     account.ClusterID,
+		Format:        agent.FormatPlain,
+		PlanRequested: planRequested,
+	}
+	response, _, err := h.agents.answerQuery(ctx, *account.UserID, req)
+	if err != nil {
+		h.respond(responseURL, slackText(fmt.Sprintf("The agent failed to answer _%s_: %v", query, err)))
+		return
+	}
+
+	message := services.SlackMessage{
+		ResponseType: "in_channel",
+		Text:         response.Response,
+		Blocks: []services.SlackBlock{
+			services.SlackContext(fmt.Sprintf("<@%s> asked: %s", account.SlackUserID, query)),
+			services.SlackSection(response.Response),
+		},
+	}
+	plan := response.DeploymentPlan
+	switch {
+	case plan != nil:
+		summary := fmt.Sprintf("*Plan %s* (`%s`), %d steps", plan.Name, plan.ID, len(plan.Steps))
+		for _, risk := range plan.Risks {
+			summary += "\n• " + risk
+		}
+		deploy := services.SlackButton("Deploy (with approval)", services.SlackActionDeployPlan, plan.ID)
+		deploy.Style = "primary"
+		deploy.Confirm = services.SlackConfirm("Deploy plan", fmt.Sprintf("Deploy *%s* to the plan's cluster? Plans waiting for approval only deploy once an operator or admin approves them.", plan.Name), "Deploy")
+		message.Blocks = append(message.Blocks,
+			services.SlackSection(summary),
+			services.SlackBlock{Type: "actions", Elements: []services.SlackElement{deploy}},
+		)
+	case len(query) <= slackButtonValueLimit:
+		message.Blocks = append(message.Blocks, services.SlackBlock{
+			Type:     "actions",
+			Elements: []services.SlackElement{services.SlackButton("Create plan", services.SlackActionCreatePlan, query)},
+		})
+	}
+	h.respond(responseURL, message)
+}
+
+// deploy queues the deployment of a plan to its cluster as the account's user
+// and posts how it went. Plans that need approval are not deployed.
+func (h *SlackHandler) deploy(account *models.SlackAccount, planID, responseURL string) {
+	userID := *account.UserID
+	plan, record, err := h.agents.getDeploymentPlan(planID, userID)
+	if err != nil {
+		h.respond(responseURL, slackText(fmt.Sprintf("Plan %s not found", planID)))
+		return
+	}
+	if record.ClusterID == nil {
+		h.respond(responseURL, slackText(fmt.Sprintf("Plan *%s* has no target cluster, deploy it from the platform", plan.Name)))
+		return
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", *record.ClusterID, userID).First(&cluster).Error; err != nil {
+		h.respond(responseURL, slackText(fmt.Sprintf("The cluster of plan *%s* was not found", plan.Name)))
+		return
+	}
+	if err := h.agents.planDeployableTo(record, cluster.ID, userID); err != nil {
+		h.respond(responseURL, slackText(fmt.Sprintf("Plan *%s* can't deploy yet: %v", plan.Name, err)))
+		return
+	}
+
+	request := DeployRequest{PlanID: plan.ID, ClusterID: cluster.ID, KubeConfig: cluster.KubeConfig}
+	job, _, err := h.agents.workers.Enqueue(userID, cluster.ID, models.JobDeploy, "plan/"+plan.ID, deployJob{Request: request}, false)
+	if err != nil {
+		h.respond(responseURL, slackText(fmt.Sprintf("Failed to start the deployment of *%s*: %v", plan.Name, err)))
+		return
+	}
+	h.respond(responseURL, services.SlackMessage{
+		ResponseType: "in_channel",
+		Text:         fmt.Sprintf("<@%s> is deploying *%s* to *%s*", account.SlackUserID, plan.Name, cluster.Name),
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), slackDeployTimeout)
+	defer cancel()
+	jobID := job.ID
+	job, err = h.agents.workers.wait(ctx, jobID)
+	if err != nil {
+		h.respond(responseURL, slackText(fmt.Sprintf("Stopped following the deployment of *%s*, see job %s on the platform: %v", plan.Name, jobID, err)))
+		return
+	}
+	var result DeployResponse
+	var text string
+	if job.ResponseStatus == http.StatusOK && json.Unmarshal([]byte(job.Response), &result) == nil {
+		text = fmt.Sprintf("Deployment %s of *%s* to *%s*: %s", result.ExecutionID, plan.Name, cluster.Name, result.Status)
+	} else {
+		text = fmt.Sprintf("Deployment of *%s* to *%s* failed: %s", plan.Name, cluster.Name, job.Error)
+	}
+	h.respond(responseURL, services.SlackMessage{ResponseType: "in_channel", Text: text})
+}
+
+// respond posts a message to a response URL, logging failures since the
+// request it answers was already acknowledged
+func (h *SlackHandler) respond(responseURL string, message services.SlackMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := h.responder.Respond(ctx, responseURL, message); err != nil {
+		fmt.Printf("Failed to answer Slack: %v\n", err)
+	}
+}
+
+// slackText returns an ephemeral message of mrkdwn text
+func slackText(text string) services.SlackMessage {
+	return services.SlackMessage{ResponseType: "ephemeral", Text: text}
+}
+
+// LinkSlackAccount links the Slack account a link code was given to with
+// /k8s-agent link to the user
+func (h *SlackHandler) LinkSlackAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req LinkSlackAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var account models.SlackAccount
+	hash := services.HashSlackLinkCode(strings.ToUpper(strings.TrimSpace(req.Code)))
+	err := h.db.DB.Where("link_code_hash = ? AND link_code_expires_at > ?", hash, time.Now()).First(&account).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired link code, run /k8s-agent link again"})
+		return
+	}
+	now := time.Now()
+	uid := userID.(uint)
+	account.UserID = &uid
+	account.ClusterID = nil
+	account.LinkCodeHash = ""
+	account.LinkCodeExpiresAt = nil
+	account.LinkedAt = &now
+	if err := h.db.DB.Save(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link Slack account"})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// GetSlackAccounts lists the Slack accounts linked to the user
+func (h *SlackHandler) GetSlackAccounts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var accounts []models.SlackAccount
+	if err := h.db.DB.Where("user_id = ?", userID).Order("linked_at DESC").Find(&accounts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch Slack accounts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// DeleteSlackAccount unlinks a Slack account from the user
+func (h *SlackHandler) DeleteSlackAccount(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	result := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).Delete(&models.SlackAccount{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlink Slack account"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Slack account not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Slack account unlinked"})
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTerraformExport exports a plan as a zipped Terraform/OpenTofu module of
+// helm_release resources, for teams deploying through their own IaC pipelines
+func (h *AgentHandler) GetTerraformExport(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	archive, err := services.TerraformExport(plan, h.changeRequestInfo(userID.(uint), record))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("Failed to export plan: %v", err)})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=terraform-%s.zip", plan.ID))
+	c.Data(http.StatusOK, "application/zip", archive)
+}
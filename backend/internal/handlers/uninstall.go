@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// UninstallResponse reports the execution that removed a deployment
+type UninstallResponse struct {
+	ExecutionID string                     `json:"execution_id"`
+	Uninstalls  string                     `json:"uninstalls"`
+	Status      string                     `json:"status"`
+	Execution   *agent.DeploymentExecution `json:"execution"`
+}
+
+// UninstallDeployment removes the Helm releases a deployment installed with its
+// cluster's stored kubeconfig. ?delete_pvcs=true also deletes the volume claims
+// the releases leave behind and ?delete_namespaces=true namespaces left empty.
+// The removal is recorded as an execution of its own. With ?async=true it runs
+// as an operation.
+func (h *AgentHandler) UninstallDeployment(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	execution, record, err := h.getDeploymentExecution(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	switch {
+	case execution.Action == "uninstall":
+		c.JSON(http.StatusConflict, gin.H{"error": "Uninstall executions can't be uninstalled"})
+		return
+	case execution.Status == "running" || execution.Status == "uninstalled":
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Deployment is %s", execution.Status)})
+		return
+	}
+
+	plan, _, err := h.getDeploymentPlan(execution.PlanID, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", record.ClusterID, userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	options := services.UninstallOptions{
+		DeletePVCs:       c.Query("delete_pvcs") == "true",
+		DeleteNamespaces: c.Query("delete_namespaces") == "true",
+	}
+
+	uninstall := func(ctx context.Context) (*UninstallResponse, error) {
+		removal, err := h.deploymentExecutor.UninstallDeployment(ctx, execution, plan, cluster.KubeConfig, options)
+		if err != nil {
+			return nil, fmt.Errorf("Uninstall failed: %v", err)
+		}
+		if err := h.saveUninstall(userID.(uint), record, execution, removal); err != nil {
+			return nil, fmt.Errorf("Failed to save uninstall: %v", err)
+		}
+		return &UninstallResponse{
+			ExecutionID: removal.ID,
+			Uninstalls:  execution.ID,
+			Status:      removal.Status,
+			Execution:   removal,
+		}, nil
+	}
+
+	if wantsAsync(c) {
+		operation, err := h.operations.Start(userID.(uint), models.OperationUninstall, "deployment/"+execution.ID, func(ctx context.Context) (interface{}, error) {
+			return uninstall(ctx)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		respondWithOperation(c, operation)
+		return
+	}
+
+	response, err := uninstall(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// saveUninstall stores the uninstall execution and, when it removed every
+// release, marks the deployment it removed uninstalled
+func (h *AgentHandler) saveUninstall(userID uint, record *models.DeploymentExecutionRecord, deployment, removal *agent.DeploymentExecution) error {
+	if err := saveExecution(h.db, userID, record.ClusterID, removal, -1); err != nil {
+		return err
+	}
+
+	if removal.Status != "completed" {
+		return nil
+	}
+	deployment.Status = "uninstalled"
+	deployment.Logs = append(deployment.Logs, fmt.Sprintf("Uninstalled by %s", removal.ID))
+	encoded, err := json.Marshal(deployment)
+	if err != nil {
+		return fmt.Errorf("failed to encode execution: %w", err)
+	}
+	return h.db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(record).Updates(map[string]interface{}{"status": deployment.Status, "execution": string(encoded)}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Deployment{}).Where("execution_id = ?", record.ID).Update("status", deployment.Status).Error
+	})
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PlanOverlayResponse shows what a plan deploys with to clusters of an
+// environment: the overlays in the order they are merged and the charts with
+// the values they end up with
+type PlanOverlayResponse struct {
+	Environment  string              `json:"environment"`
+	Organization *agent.ValueOverlay `json:"organization,omitempty"`
+	Plan         *agent.ValueOverlay `json:"plan,omitempty"`
+	Charts       []agent.HelmChart   `json:"charts"`
+}
+
+// environmentParam returns the :environment parameter, answering 400 when it
+// isn't an environment
+func environmentParam(c *gin.Context) (string, bool) {
+	environment := c.Param("environment")
+	if !slices.Contains(agent.Environments, environment) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("environment must be one of %s", strings.Join(agent.Environments, ", "))})
+		return "", false
+	}
+	return environment, true
+}
+
+// GetValueOverlays returns the organization's value overlays by environment
+func (h *OrganizationHandler) GetValueOverlays(c *gin.Context) {
+	overlays, err := loadOrgValueOverlays(h.db, c.GetUint("organization_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"overlays": overlays})
+}
+
+// SetValueOverlay replaces the organization's value overlay of an environment
+func (h *OrganizationHandler) SetValueOverlay(c *gin.Context) {
+	environment, ok := environmentParam(c)
+	if !ok {
+		return
+	}
+	var overlay agent.ValueOverlay
+	if err := c.ShouldBindJSON(&overlay); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	encoded, err := json.Marshal(overlay)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid overlay: %v", err)})
+		return
+	}
+
+	orgID := c.GetUint("organization_id")
+	var record models.OrgValueOverlay
+	err = h.db.DB.Where("organization_id = ? AND environment = ?", orgID, environment).First(&record).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch value overlay"})
+		return
+	}
+	record.OrganizationID = orgID
+	record.Environment = environment
+	record.Overlay = string(encoded)
+	record.UpdatedBy = c.GetUint("user_id")
+	if err := h.db.DB.Save(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save value overlay"})
+		return
+	}
+
+	c.JSON(http.StatusOK, overlay)
+}
+
+// DeleteValueOverlay removes the organization's value overlay of an environment
+func (h *OrganizationHandler) DeleteValueOverlay(c *gin.Context) {
+	environment, ok := environmentParam(c)
+	if !ok {
+		return
+	}
+	result := h.db.DB.Where("organization_id = ? AND environment = ?", c.GetUint("organization_id"), environment).Delete(&models.OrgValueOverlay{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete value overlay"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Value overlay not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Value overlay deleted"})
+}
+
+// GetPlanOverlay returns the overlays a plan deploys with to clusters of an
+// environment and the values its charts get, with the value policy of the
+// plan's cluster or ?cluster_id=
+func (h *AgentHandler) GetPlanOverlay(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	environment, ok := environmentParam(c)
+	if !ok {
+		return
+	}
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	clusterID := record.ClusterID
+	if param := c.Query("cluster_id"); param != "" {
+		id, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster_id"})
+			return
+		}
+		override := uint(id)
+		cluster, err := h.getPlanCluster(record, &override, userID.(uint))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		clusterID = &cluster.ID
+	}
+
+	orgOverlay, err := loadOrgValueOverlay(h.db, userID.(uint), environment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load value overlays: %v", err)})
+		return
+	}
+	policy, err := loadValuePolicy(h.db, userID.(uint), clusterID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load value policy: %v", err)})
+		return
+	}
+	h.helmService.ApplyValueOverlays(plan, environmentOverlays(orgOverlay, plan, environment), policy)
+
+	c.JSON(http.StatusOK, PlanOverlayResponse{
+		Environment:  environment,
+		Organization: orgOverlay,
+		Plan:         plan.Overlays[environment],
+		Charts:       plan.Charts,
+	})
+}
+
+// SetPlanOverlay replaces the values a plan changes when it deploys to
+// clusters of an environment. An approved plan needs to be approved again.
+func (h *AgentHandler) SetPlanOverlay(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	environment, ok := environmentParam(c)
+	if !ok {
+		return
+	}
+	var overlay agent.ValueOverlay
+	if err := c.ShouldBindJSON(&overlay); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	for chart := range overlay.ChartValues {
+		if !slices.ContainsFunc(plan.Charts, func(planChart agent.HelmChart) bool { return planChart.Name == chart }) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Values are set for chart %s, which the plan doesn't install", chart)})
+			return
+		}
+	}
+
+	if plan.Overlays == nil {
+		plan.Overlays = make(map[string]*agent.ValueOverlay)
+	}
+	plan.Overlays[environment] = &overlay
+	if err := h.updatePlan(record, plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save plan: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// DeletePlanOverlay removes a plan's overlay of an environment
+func (h *AgentHandler) DeletePlanOverlay(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	environment, ok := environmentParam(c)
+	if !ok {
+		return
+	}
+	plan, record, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+	if _, ok := plan.Overlays[environment]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Value overlay not found"})
+		return
+	}
+
+	delete(plan.Overlays, environment)
+	if err := h.updatePlan(record, plan); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save plan: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// applyEnvironmentOverlays merges the overlays of the cluster's environment
+// into the plan about to deploy to it: the organization's, then the plan's.
+// Plans deploy unchanged to unclassified clusters.
+func (h *AgentHandler) applyEnvironmentOverlays(userID, clusterID uint, plan *agent.DeploymentPlan) error {
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Select("id", "environment").First(&cluster, clusterID).Error; err != nil || cluster.Environment == "" {
+		return nil
+	}
+	orgOverlay, err := loadOrgValueOverlay(h.db, userID, cluster.Environment)
+	if err != nil {
+		return fmt.Errorf("failed to load value overlays: %w", err)
+	}
+	overlays := environmentOverlays(orgOverlay, plan, cluster.Environment)
+	if len(overlays) == 0 {
+		return nil
+	}
+	policy, err := loadValuePolicy(h.db, userID, &cluster.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load value policy: %w", err)
+	}
+	h.helmService.ApplyValueOverlays(plan, overlays, policy)
+	return nil
+}
+
+// environmentOverlays returns the overlays of an environment in the order
+// they are merged, the organization's before the plan's
+func environmentOverlays(orgOverlay *agent.ValueOverlay, plan *agent.DeploymentPlan, environment string) []*agent.ValueOverlay {
+	var overlays []*agent.ValueOverlay
+	for _, overlay := range []*agent.ValueOverlay{orgOverlay, plan.Overlays[environment]} {
+		if !overlay.IsEmpty() {
+			overlays = append(overlays, overlay)
+		}
+	}
+	return overlays
+}
+
+// loadOrgValueOverlays returns an organization's value overlays by environment
+func loadOrgValueOverlays(db *database.Database, orgID uint) (map[string]*agent.ValueOverlay, error) {
+	var records []models.OrgValueOverlay
+	if err := db.DB.Where("organization_id = ?", orgID).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch value overlays: %w", err)
+	}
+	overlays := make(map[string]*agent.ValueOverlay, len(records))
+	for _, record := range records {
+		var overlay agent.ValueOverlay
+		if err := json.Unmarshal([]byte(record.Overlay), &overlay); err != nil {
+			return nil, fmt.Errorf("failed to decode value overlay %s: %w", record.Environment, err)
+		}
+		overlays[record.Environment] = &overlay
+	}
+	return overlays, nil
+}
+
+// loadOrgValueOverlay returns the value overlay the user's organization set
+// for an environment, or nil
+func loadOrgValueOverlay(db *database.Database, userID uint, environment string) (*agent.ValueOverlay, error) {
+	var user models.User
+	if err := db.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	if user.OrganizationID == nil {
+		return nil, nil
+	}
+	overlays, err := loadOrgValueOverlays(db, *user.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	return overlays[environment], nil
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StepValuesDiff is the values diff of one chart step of a plan
+type StepValuesDiff struct {
+	StepID string `json:"step_id"`
+	*services.ValuesDiff
+	Error string `json:"error,omitempty"`
+}
+
+// GetPlanValuesDiff shows which default values of each chart the plan's
+// generated values override, so AI customizations can be reviewed before
+// deploying. ?step_id= limits the diff to one step.
+func (h *AgentHandler) GetPlanValuesDiff(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	plan, _, err := h.getDeploymentPlan(c.Param("id"), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Deployment plan not found: %v", err)})
+		return
+	}
+
+	ctx := withRegistryCredentials(c.Request.Context(), h.db, userID.(uint))
+	stepID := c.Query("step_id")
+	diffs := []StepValuesDiff{}
+	for _, step := range plan.Steps {
+		if step.Chart == nil || (stepID != "" && step.ID != stepID) {
+			continue
+		}
+		entry := StepValuesDiff{StepID: step.ID}
+		diff, err := h.helmService.DiffValues(ctx, step.Chart)
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.ValuesDiff = diff
+		}
+		diffs = append(diffs, entry)
+	}
+	if stepID != "" && len(diffs) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Plan has no chart step %s", stepID)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan_id": plan.ID,
+		"charts":  diffs,
+	})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/services"
+)
+
+// ValuesValidationError is returned when chart values of a plan violate the
+// chart's values.schema.json
+type ValuesValidationError struct {
+	Validations []services.ValuesValidation
+}
+
+func (e *ValuesValidationError) Error() string {
+	var reasons []string
+	for _, validation := range e.Validations {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", validation.Chart, strings.Join(validation.Violations, "; ")))
+	}
+	return "chart values violate the charts' values schemas: " + strings.Join(reasons, "; ")
+}
+
+// enforceValuesSchema returns a ValuesValidationError when the values of a
+// chart of the plan violate its values.schema.json, before Helm refuses them
+// midway through the deployment. Charts whose schema can't be fetched aren't
+// checked.
+func (h *AgentHandler) enforceValuesSchema(plan *agent.DeploymentPlan) error {
+	var invalid []services.ValuesValidation
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		validation, err := h.helmService.ValidateValues(step.Chart, false)
+		if err != nil {
+			fmt.Printf("Failed to validate values of chart %s: %v\n", step.Chart.Name, err)
+			continue
+		}
+		if validation != nil && !validation.Valid() {
+			invalid = append(invalid, *validation)
+		}
+	}
+	if len(invalid) > 0 {
+		return &ValuesValidationError{Validations: invalid}
+	}
+	return nil
+}
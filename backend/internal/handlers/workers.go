@@ -0,0 +1,616 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// jobWaitInterval is how often a request waiting for its job checks on it
+const jobWaitInterval = 500 * time.Millisecond
+
+// workerRetention is how long stopped and dead workers stay listed
+const workerRetention = 24 * time.Hour
+
+// Worker statuses
+const (
+	WorkerAlive   = "alive"
+	WorkerDead    = "dead"
+	WorkerStopped = "stopped"
+)
+
+// JobRunner runs a job and returns the HTTP status and body its request is
+// answered with, and the error that failed it
+type JobRunner func(ctx context.Context, job *models.Job) (int, interface{}, error)
+
+// WorkerHandler queues deployments as jobs in the database and runs them on
+// workers that pull them, in API replicas and in worker processes, so the API
+// and the workers scale independently. Jobs of workers that stop heartbeating
+// are requeued for the others.
+type WorkerHandler struct {
+	db         *database.Database
+	operations *OperationHandler
+	cfg        config.WorkersConfig
+	runners    map[string]JobRunner
+	// payloads encrypts job payloads, which hold the kubeconfigs of deploy
+	// requests, while they are queued and running
+	payloads *services.Sealer
+	// connectors holds the tunnels of the connector clusters whose jobs the
+	// workers of this process claim, nil in worker processes
+	connectors *services.ConnectorManager
+}
+
+// NewWorkerHandler creates a new worker handler. Job payloads are encrypted
+// with a key derived from secret, which the API replicas and worker processes
+// share.
+func NewWorkerHandler(db *database.Database, operations *OperationHandler, cfg config.WorkersConfig, secret string) *WorkerHandler {
+	return &WorkerHandler{
+		db:         db,
+		operations: operations,
+		cfg:        cfg,
+		runners:    make(map[string]JobRunner),
+		payloads:   services.NewSealer(secret, "job-payloads"),
+	}
+}
+
+// ClaimConnectorJobs lets the workers of this process claim the jobs of
+// clusters whose in-cluster connector is connected to it. Other workers can't
+// reach those clusters.
+func (h *WorkerHandler) ClaimConnectorJobs(connectors *services.ConnectorManager) {
+	h.connectors = connectors
+}
+
+// Register sets the runner of a kind of jobs
+func (h *WorkerHandler) Register(kind string, runner JobRunner) {
+	h.runners[kind] = runner
+}
+
+// Submit queues a job for a request deploying to a cluster. With ?async=true
+// it answers 202 with an operation following the job, otherwise it waits for
+// the job and answers with its response.
+func (h *WorkerHandler) Submit(c *gin.Context, userID, clusterID uint, kind, target string, payload interface{}) {
+	job, operation, err := h.Enqueue(userID, clusterID, kind, target, payload, wantsAsync(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if operation != nil {
+		respondWithOperation(c, operation)
+		return
+	}
+
+	job, err = h.wait(c.Request.Context(), job.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to wait for job %s: %v", job.ID, err)})
+		return
+	}
+	c.Data(job.ResponseStatus, "application/json; charset=utf-8", []byte(job.Response))
+}
+
+// Enqueue queues a job deploying to a cluster, with an operation following it
+// when async
+func (h *WorkerHandler) Enqueue(userID, clusterID uint, kind, target string, payload interface{}, async bool) (*models.Job, *models.Operation, error) {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Select("id", "auth_mode").Where("id = ?", clusterID).First(&cluster).Error; err != nil {
+		return nil, nil, fmt.Errorf("cluster %d not found", clusterID)
+	}
+
+	var operation *models.Operation
+	if async {
+		operation, err = h.operations.create(userID, models.OperationDeployment, target)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	id := "job-" + uuid.NewString()
+	sealed, err := h.sealPayload(id, encoded)
+	if err != nil {
+		return nil, nil, err
+	}
+	job := &models.Job{
+		ID:      id,
+		Kind:    kind,
+		UserID:  userID,
+		Payload: sealed,
+		Status:  models.JobQueued,
+	}
+	if operation != nil {
+		job.OperationID = operation.ID
+	}
+	if cluster.AuthMode == kubernetes.AuthModeConnector {
+		job.ConnectorClusterID = &cluster.ID
+	}
+	if err := h.db.DB.Create(job).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to queue job: %w", err)
+	}
+	return job, operation, nil
+}
+
+// sealPayload encrypts the payload of a job, bound to its ID so it can't be
+// moved to another job
+func (h *WorkerHandler) sealPayload(id string, payload []byte) (string, error) {
+	sealed, err := h.payloads.Seal(payload, id)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt job: %w", err)
+	}
+	return sealed, nil
+}
+
+// openPayload decrypts the payload of a job. Jobs queued before payloads
+// were encrypted are returned as they are.
+func (h *WorkerHandler) openPayload(job *models.Job) (string, error) {
+	payload, err := h.payloads.Open(job.Payload, job.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt job %s, was it queued with another JWT_SECRET? %w", job.ID, err)
+	}
+	return payload, nil
+}
+
+// wait polls a job until it finished or ctx is done
+func (h *WorkerHandler) wait(ctx context.Context, id string) (*models.Job, error) {
+	ticker := time.NewTicker(jobWaitInterval)
+	defer ticker.Stop()
+	for {
+		var job models.Job
+		if err := h.db.DB.Where("id = ?", id).First(&job).Error; err != nil {
+			return &job, err
+		}
+		if job.Finished() {
+			return &job, nil
+		}
+		select {
+		case <-ctx.Done():
+			return &job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WorkerStatus is a worker with whether it is alive
+type WorkerStatus struct {
+	models.Worker
+	Status string `json:"status"`
+}
+
+// GetWorkers lists the workers, alive ones first, with the jobs queued and running
+func (h *WorkerHandler) GetWorkers(c *gin.Context) {
+	var workers []models.Worker
+	if err := h.db.DB.Order("heartbeat_at DESC").Find(&workers).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to load workers: %v", err)})
+		return
+	}
+
+	cutoff := time.Now().Add(-h.cfg.DeadAfter)
+	statuses := make([]WorkerStatus, 0, len(workers))
+	alive := 0
+	for _, worker := range workers {
+		status := WorkerAlive
+		switch {
+		case worker.StoppedAt != nil:
+			status = WorkerStopped
+		case worker.HeartbeatAt.Before(cutoff):
+			status = WorkerDead
+		default:
+			alive++
+		}
+		statuses = append(statuses, WorkerStatus{Worker: worker, Status: status})
+	}
+
+	jobs := map[string]int64{models.JobQueued: 0, models.JobRunning: 0}
+	for status := range jobs {
+		var count int64
+		if err := h.db.DB.Model(&models.Job{}).Where("status = ?", status).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to count jobs: %v", err)})
+			return
+		}
+		jobs[status] = count
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workers": statuses, "alive": alive, "jobs": jobs})
+}
+
+// StartWorkers runs a worker taking jobs from the queue in the background. The
+// returned function stops it once the jobs it runs finished.
+func (h *WorkerHandler) StartWorkers() (func(), error) {
+	w, err := h.newWorker()
+	if err != nil {
+		return nil, err
+	}
+
+	var loops sync.WaitGroup
+	for i := 0; i < h.cfg.Concurrency; i++ {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			w.runJobs()
+		}()
+	}
+	heartbeats := make(chan struct{})
+	go func() {
+		defer close(heartbeats)
+		w.heartbeat()
+	}()
+
+	return func() {
+		close(w.stop)
+		loops.Wait()
+		<-heartbeats
+		now := time.Now()
+		if err := h.db.DB.Model(&models.Worker{}).Where("id = ?", w.id).Updates(map[string]interface{}{"stopped_at": now, "heartbeat_at": now, "running_jobs": 0}).Error; err != nil {
+			fmt.Printf("Failed to record that worker %s stopped: %v\n", w.id, err)
+		}
+	}, nil
+}
+
+// jobWorker is a worker of this process, running up to its concurrency jobs
+type jobWorker struct {
+	*WorkerHandler
+	id   string
+	stop chan struct{}
+
+	mu        sync.Mutex
+	running   int
+	succeeded int
+	failed    int
+}
+
+// newWorker registers a worker of this process
+func (h *WorkerHandler) newWorker() (*jobWorker, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate worker ID: %w", err)
+	}
+
+	now := time.Now()
+	record := models.Worker{
+		ID:          hostname + "-" + hex.EncodeToString(suffix),
+		Hostname:    hostname,
+		Concurrency: h.cfg.Concurrency,
+		StartedAt:   now,
+		HeartbeatAt: now,
+	}
+	if err := h.db.DB.Create(&record).Error; err != nil {
+		return nil, fmt.Errorf("failed to register worker: %w", err)
+	}
+	return &jobWorker{WorkerHandler: h, id: record.ID, stop: make(chan struct{})}, nil
+}
+
+// runJobs runs queued jobs one at a time until the worker stops
+func (w *jobWorker) runJobs() {
+	for {
+		select {
+		case <-w.stop:
+			return
+		default:
+		}
+
+		job, err := w.claim()
+		if err != nil {
+			fmt.Printf("Worker %s failed to claim a job: %v\n", w.id, err)
+		}
+		if job == nil {
+			select {
+			case <-w.stop:
+				return
+			case <-time.After(w.cfg.PollInterval):
+			}
+			continue
+		}
+		w.execute(job)
+	}
+}
+
+// claim takes the oldest queued job this worker can run, or returns nil when
+// none is queued. Other workers skip the row being claimed rather than waiting
+// for it, except on SQLite, whose single writer claims one job at a time
+// anyway. Jobs of connector clusters wait for a worker of the API replica
+// holding the connector's tunnel.
+func (w *jobWorker) claim() (*models.Job, error) {
+	var connected []uint
+	if w.connectors != nil {
+		connected = w.connectors.ConnectedClusters()
+	}
+	var job models.Job
+	err := w.db.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Where("status = ?", models.JobQueued).Order("created_at")
+		if len(connected) > 0 {
+			query = query.Where("connector_cluster_id IS NULL OR connector_cluster_id IN ?", connected)
+		} else {
+			query = query.Where("connector_cluster_id IS NULL")
+		}
+		if tx.Dialector.Name() != database.DriverSQLite {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+		if err := query.First(&job).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.Job{}).Where("id = ? AND status = ?", job.ID, models.JobQueued).Updates(map[string]interface{}{
+			"status":     models.JobRunning,
+			"worker_id":  w.id,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"started_at": now,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		job.Status = models.JobRunning
+		job.WorkerID = w.id
+		job.Attempts++
+		job.StartedAt = &now
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// execute runs a claimed job, through its operation when it has one, and
+// stores its response
+func (w *jobWorker) execute(job *models.Job) {
+	w.mu.Lock()
+	w.running++
+	w.mu.Unlock()
+
+	status, body, err := w.runJob(job)
+	if err != nil && body == nil {
+		body = gin.H{"error": err.Error()}
+	}
+	switch {
+	case status != 0:
+	case err != nil:
+		status = http.StatusInternalServerError
+	default:
+		status = http.StatusOK
+	}
+	encoded, encodeErr := json.Marshal(body)
+	if encodeErr != nil {
+		status = http.StatusInternalServerError
+		encoded, _ = json.Marshal(gin.H{"error": fmt.Sprintf("failed to encode response: %v", encodeErr)})
+	}
+
+	updates := map[string]interface{}{
+		"status":          models.JobSucceeded,
+		"response_status": status,
+		"response":        string(encoded),
+		"finished_at":     time.Now(),
+		// Finished jobs don't need their payloads, which may hold kubeconfigs
+		"payload": "",
+	}
+	if err != nil {
+		updates["status"] = models.JobFailed
+		updates["error"] = err.Error()
+	}
+	// A job requeued while this worker seemed dead belongs to a later attempt now
+	result := w.owned(job).Updates(updates)
+	if result.Error != nil {
+		fmt.Printf("Failed to store the outcome of job %s: %v\n", job.ID, result.Error)
+	}
+
+	w.mu.Lock()
+	w.running--
+	if err != nil {
+		w.failed++
+	} else {
+		w.succeeded++
+	}
+	w.mu.Unlock()
+}
+
+// runJob runs a job with its runner and returns its status, body and error
+func (w *jobWorker) runJob(job *models.Job) (int, interface{}, error) {
+	runner, ok := w.runners[job.Kind]
+	if !ok {
+		return http.StatusInternalServerError, nil, fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+	payload, err := w.openPayload(job)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	job.Payload = payload
+
+	var status int
+	var body interface{}
+	var runErr error
+	finished := false
+	work := func(ctx context.Context) (interface{}, error) {
+		ctx, release := w.fence(withJob(ctx, job), job)
+		defer release()
+		status, body, runErr = runner(ctx, job)
+		finished = true
+		if runErr != nil {
+			return nil, runErr
+		}
+		return body, nil
+	}
+
+	if job.OperationID == "" {
+		runOperationWork(agent.WithUser(context.Background(), job.UserID), work)
+	} else {
+		var operation models.Operation
+		if err := w.db.DB.Select("cancel_requested").Where("id = ?", job.OperationID).First(&operation).Error; err == nil && operation.CancelRequested {
+			w.operations.update(job.OperationID, map[string]interface{}{"status": models.OperationCancelled, "error": "cancelled before it started", "finished_at": time.Now()})
+			return http.StatusConflict, nil, fmt.Errorf("job %s was cancelled before it started", job.ID)
+		}
+		w.operations.execute(job.UserID, job.OperationID, work)
+	}
+	if !finished {
+		return http.StatusInternalServerError, nil, fmt.Errorf("job %s panicked", job.ID)
+	}
+	return status, body, runErr
+}
+
+// owned queries a job while this worker's attempt at it is the latest one.
+// A worker that only seemed dead keeps running its jobs after they were
+// requeued; the attempt counter also tells it apart from a later attempt
+// that it claimed itself.
+func (w *jobWorker) owned(job *models.Job) *gorm.DB {
+	return w.db.DB.Model(&models.Job{}).Where("id = ? AND worker_id = ? AND attempts = ? AND status = ?", job.ID, w.id, job.Attempts, models.JobRunning)
+}
+
+// fence returns a context that is cancelled once the job was requeued for a
+// later attempt, so no more of its steps start on this worker. Steps already
+// running finish; the later attempt waits for the deployment's namespace
+// locks they hold.
+func (w *jobWorker) fence(ctx context.Context, job *models.Job) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			var owned int64
+			if err := w.owned(job).Count(&owned).Error; err != nil {
+				fmt.Printf("Worker %s failed to check job %s: %v\n", w.id, job.ID, err)
+				continue
+			}
+			if owned == 0 {
+				fmt.Printf("Worker %s stops job %s, which was requeued for another attempt\n", w.id, job.ID)
+				cancel()
+				return
+			}
+		}
+	}()
+	return ctx, func() {
+		close(done)
+		cancel()
+	}
+}
+
+// jobContextKey carries the job a worker runs
+type jobContextKey struct{}
+
+// withJob returns a context carrying the job it runs
+func withJob(ctx context.Context, job *models.Job) context.Context {
+	return context.WithValue(ctx, jobContextKey{}, job)
+}
+
+// jobFrom returns the job ctx runs, or nil
+func jobFrom(ctx context.Context) *models.Job {
+	job, _ := ctx.Value(jobContextKey{}).(*models.Job)
+	return job
+}
+
+// recordJobExecution records the deployment a job started, so a later
+// attempt resumes it
+func recordJobExecution(db *database.Database, job *models.Job, executionID string) {
+	if job.ExecutionID == executionID {
+		return
+	}
+	job.ExecutionID = executionID
+	if err := db.DB.Model(&models.Job{}).Where("id = ? AND attempts = ?", job.ID, job.Attempts).Update("execution_id", executionID).Error; err != nil {
+		fmt.Printf("Failed to record deployment %s of job %s: %v\n", executionID, job.ID, err)
+	}
+}
+
+// heartbeat reports that the worker is alive until it stops, and requeues the
+// jobs of workers that stopped heartbeating
+func (w *jobWorker) heartbeat() {
+	ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			w.mu.Lock()
+			updates := map[string]interface{}{
+				"heartbeat_at":   now,
+				"running_jobs":   w.running,
+				"jobs_succeeded": w.succeeded,
+				"jobs_failed":    w.failed,
+			}
+			w.mu.Unlock()
+			if err := w.db.DB.Model(&models.Worker{}).Where("id = ?", w.id).Updates(updates).Error; err != nil {
+				fmt.Printf("Worker %s failed to heartbeat: %v\n", w.id, err)
+			}
+			w.requeueOrphans(now)
+		}
+	}
+}
+
+// requeueOrphans requeues the running jobs of workers whose last heartbeat is
+// older than DeadAfter, or fails them once they reached MaxAttempts. Requeued
+// jobs that started a deployment resume it from the steps that didn't
+// complete.
+func (w *jobWorker) requeueOrphans(now time.Time) {
+	alive := w.db.DB.Model(&models.Worker{}).Select("id").Where("heartbeat_at >= ? AND stopped_at IS NULL", now.Add(-w.cfg.DeadAfter))
+	var orphans []models.Job
+	if err := w.db.DB.Where("status = ? AND worker_id NOT IN (?)", models.JobRunning, alive).Find(&orphans).Error; err != nil {
+		fmt.Printf("Failed to find the jobs of dead workers: %v\n", err)
+		return
+	}
+
+	for _, job := range orphans {
+		updates := map[string]interface{}{"status": models.JobQueued}
+		message := fmt.Sprintf("Requeued after worker %s stopped responding", job.WorkerID)
+		if job.Attempts >= w.cfg.MaxAttempts {
+			message = fmt.Sprintf("Failed after %d workers stopped responding while running it", job.Attempts)
+			updates = map[string]interface{}{
+				"status":          models.JobFailed,
+				"error":           message,
+				"response_status": http.StatusInternalServerError,
+				"response":        fmt.Sprintf(`{"error":%q}`, message),
+				"finished_at":     now,
+				"payload":         "",
+			}
+		}
+		result := w.db.DB.Model(&models.Job{}).Where("id = ? AND worker_id = ? AND status = ?", job.ID, job.WorkerID, models.JobRunning).Updates(updates)
+		if result.Error != nil {
+			fmt.Printf("Failed to requeue job %s: %v\n", job.ID, result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 || job.OperationID == "" {
+			continue
+		}
+		if updates["status"] == models.JobFailed {
+			w.operations.update(job.OperationID, map[string]interface{}{"status": models.OperationFailed, "error": message, "finished_at": now})
+		} else {
+			w.operations.update(job.OperationID, map[string]interface{}{"status": models.OperationPending, "message": message})
+		}
+	}
+
+	if err := w.db.DB.Where("heartbeat_at < ?", now.Add(-workerRetention)).Delete(&models.Worker{}).Error; err != nil {
+		fmt.Printf("Failed to remove old workers: %v\n", err)
+	}
+}
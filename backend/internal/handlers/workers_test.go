@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/database"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// newTestWorkers creates a worker handler on a migrated SQLite database, with
+// a user owning a cluster of authMode
+func newTestWorkers(t *testing.T, authMode string) (*WorkerHandler, *database.Database, models.KubernetesCluster) {
+	t.Helper()
+	db := connectTestDatabase(t)
+	user := models.User{Email: "dev@example.com", Password: "-"}
+	if err := db.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	cluster := models.KubernetesCluster{UserID: user.ID, Name: "dev", KubeConfig: "-", AuthMode: authMode}
+	if err := db.DB.Create(&cluster).Error; err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	workers := NewWorkerHandler(db, NewOperationHandler(db), config.WorkersConfig{
+		Concurrency:       1,
+		PollInterval:      time.Second,
+		HeartbeatInterval: time.Second,
+		DeadAfter:         time.Minute,
+		MaxAttempts:       2,
+	}, "test-secret")
+	return workers, db, cluster
+}
+
+// TestWorkerRunsQueuedJob queues a job and checks that a worker claims it,
+// hands its runner the decrypted payload and stores its response
+func TestWorkerRunsQueuedJob(t *testing.T) {
+	workers, db, cluster := newTestWorkers(t, kubernetes.AuthModeKubeconfig)
+	var payload map[string]string
+	workers.Register("deploy", func(ctx context.Context, job *models.Job) (int, interface{}, error) {
+		if jobFrom(ctx) != job {
+			t.Errorf("runner context does not carry job %s", job.ID)
+		}
+		return http.StatusOK, map[string]string{"deployed": "yes"}, json.Unmarshal([]byte(job.Payload), &payload)
+	})
+
+	queued, _, err := workers.Enqueue(cluster.UserID, cluster.ID, "deploy", "plan-1", map[string]string{"plan_id": "plan-1"}, false)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if queued.Payload == "" || queued.Payload == `{"plan_id":"plan-1"}` {
+		t.Fatalf("queued payload %q is not encrypted", queued.Payload)
+	}
+
+	worker, err := workers.newWorker()
+	if err != nil {
+		t.Fatalf("register worker: %v", err)
+	}
+	job, err := worker.claim()
+	if err != nil || job == nil {
+		t.Fatalf("claim returned %v and %v, want job %s", job, err, queued.ID)
+	}
+	if job.ID != queued.ID || job.Attempts != 1 || job.WorkerID != worker.id {
+		t.Fatalf("claimed %+v, want the first attempt at %s by %s", job, queued.ID, worker.id)
+	}
+	if again, err := worker.claim(); err != nil || again != nil {
+		t.Fatalf("second claim returned %v and %v, want no job", again, err)
+	}
+
+	worker.execute(job)
+	if payload["plan_id"] != "plan-1" {
+		t.Fatalf("runner got payload %v", payload)
+	}
+	var stored models.Job
+	if err := db.DB.Where("id = ?", job.ID).First(&stored).Error; err != nil {
+		t.Fatalf("load job: %v", err)
+	}
+	if stored.Status != models.JobSucceeded || stored.ResponseStatus != http.StatusOK || stored.Response != `{"deployed":"yes"}` {
+		t.Fatalf("stored job %+v, want a succeeded job with its response", stored)
+	}
+	if stored.Payload != "" {
+		t.Fatal("finished job kept its payload")
+	}
+}
+
+// TestDeadWorkersJobsAreRequeued stops the heartbeat of a worker running a
+// job and checks that the job is requeued, that the worker can no longer
+// store its outcome once another worker claimed it, and that it fails once it
+// reached MaxAttempts
+func TestDeadWorkersJobsAreRequeued(t *testing.T) {
+	workers, db, cluster := newTestWorkers(t, kubernetes.AuthModeKubeconfig)
+	queued, _, err := workers.Enqueue(cluster.UserID, cluster.ID, "deploy", "plan-1", map[string]string{}, false)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+
+	stale, err := workers.newWorker()
+	if err != nil {
+		t.Fatalf("register worker: %v", err)
+	}
+	first, err := stale.claim()
+	if err != nil || first == nil {
+		t.Fatalf("claim returned %v and %v", first, err)
+	}
+	if err := db.DB.Model(&models.Worker{}).Where("id = ?", stale.id).Update("heartbeat_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("age heartbeat: %v", err)
+	}
+
+	live, err := workers.newWorker()
+	if err != nil {
+		t.Fatalf("register worker: %v", err)
+	}
+	live.requeueOrphans(time.Now())
+	second, err := live.claim()
+	if err != nil || second == nil {
+		t.Fatalf("requeued job was not claimed: %v", err)
+	}
+	if second.ID != queued.ID || second.Attempts != 2 {
+		t.Fatalf("claimed %+v, want the second attempt at %s", second, queued.ID)
+	}
+
+	// The stale worker is fenced off the job the live worker now runs
+	if result := stale.owned(first).Update("response", "stale"); result.Error != nil || result.RowsAffected != 0 {
+		t.Fatalf("stale worker updated %d rows: %v", result.RowsAffected, result.Error)
+	}
+	var owned int64
+	if err := live.owned(second).Count(&owned).Error; err != nil || owned != 1 {
+		t.Fatalf("live worker owns %d jobs: %v", owned, err)
+	}
+
+	// The second attempt's worker dies too, which was the last attempt allowed
+	if err := db.DB.Model(&models.Worker{}).Where("id = ?", live.id).Update("heartbeat_at", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("age heartbeat: %v", err)
+	}
+	stale.requeueOrphans(time.Now())
+	var stored models.Job
+	if err := db.DB.Where("id = ?", queued.ID).First(&stored).Error; err != nil {
+		t.Fatalf("load job: %v", err)
+	}
+	if stored.Status != models.JobFailed || stored.ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("job is %s with status %d after its last attempt, want failed", stored.Status, stored.ResponseStatus)
+	}
+}
+
+// TestConnectorJobsWaitForTheirTunnel checks that workers of a process
+// without the connector's tunnel don't claim the jobs of its cluster
+func TestConnectorJobsWaitForTheirTunnel(t *testing.T) {
+	workers, _, cluster := newTestWorkers(t, kubernetes.AuthModeConnector)
+	queued, _, err := workers.Enqueue(cluster.UserID, cluster.ID, "deploy", "plan-1", map[string]string{}, false)
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	if queued.ConnectorClusterID == nil || *queued.ConnectorClusterID != cluster.ID {
+		t.Fatalf("job of a connector cluster has connector cluster %v", queued.ConnectorClusterID)
+	}
+
+	worker, err := workers.newWorker()
+	if err != nil {
+		t.Fatalf("register worker: %v", err)
+	}
+	if job, err := worker.claim(); err != nil || job != nil {
+		t.Fatalf("claim returned %v and %v, want no job", job, err)
+	}
+}
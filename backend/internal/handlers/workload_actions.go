@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ScaleWorkloadRequest sets the replicas of a deployment or statefulset
+type ScaleWorkloadRequest struct {
+	Replicas *int32 `json:"replicas" binding:"required,min=0"`
+}
+
+// WorkloadActionResponse reports a restart or scale
+type WorkloadActionResponse struct {
+	Kind        string     `json:"kind"`
+	Namespace   string     `json:"namespace"`
+	Name        string     `json:"name"`
+	RestartedAt *time.Time `json:"restarted_at,omitempty"`
+	// PreviousReplicas and Replicas are set by scales
+	PreviousReplicas *int32 `json:"previous_replicas,omitempty"`
+	Replicas         *int32 `json:"replicas,omitempty"`
+}
+
+// RestartWorkload rolls the pods of a deployment, statefulset or daemonset in
+// ?namespace= (default "default"), like kubectl rollout restart
+func (h *KubernetesHandler) RestartWorkload(c *gin.Context) {
+	cluster, client, kind, ok := h.workloadTarget(c)
+	if !ok {
+		return
+	}
+
+	response := WorkloadActionResponse{Kind: kind, Namespace: c.DefaultQuery("namespace", "default"), Name: c.Param("name")}
+	restartedAt, err := client.RestartWorkload(c.Request.Context(), kind, response.Namespace, response.Name)
+	if err == nil {
+		response.RestartedAt = &restartedAt
+	}
+	h.audit(c, cluster, models.AuditWorkloadRestart, response, err)
+	if err != nil {
+		c.JSON(workloadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ScaleWorkload sets the replicas of a deployment or statefulset in
+// ?namespace= (default "default")
+func (h *KubernetesHandler) ScaleWorkload(c *gin.Context) {
+	var req ScaleWorkloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cluster, client, kind, ok := h.workloadTarget(c)
+	if !ok {
+		return
+	}
+	if kind == kubernetes.KindDaemonSet {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "DaemonSets run a pod per node and cannot be scaled"})
+		return
+	}
+
+	response := WorkloadActionResponse{Kind: kind, Namespace: c.DefaultQuery("namespace", "default"), Name: c.Param("name"), Replicas: req.Replicas}
+	previous, err := client.ScaleWorkload(c.Request.Context(), kind, response.Namespace, response.Name, *req.Replicas)
+	if err == nil || previous != 0 {
+		response.PreviousReplicas = &previous
+	}
+	h.audit(c, cluster, models.AuditWorkloadScale, response, err)
+	if err != nil {
+		c.JSON(workloadErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// workloadTarget loads the user's cluster and connects to it, and parses the
+// workload kind. It responds with the error when something fails.
+func (h *KubernetesHandler) workloadTarget(c *gin.Context) (*models.KubernetesCluster, *kubernetes.KubernetesClient, string, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, nil, "", false
+	}
+
+	kind, err := kubernetes.ParseWorkloadKind(c.Param("kind"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, "", false
+	}
+
+	var cluster models.KubernetesCluster
+	if err := h.db.DB.Where("id = ? AND user_id = ?", c.Param("id"), userID).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return nil, nil, "", false
+	}
+
+	client, err := kubernetes.NewKubernetesClient(cluster.KubeConfig)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to cluster"})
+		return nil, nil, "", false
+	}
+	return &cluster, client, kind, true
+}
+
+// audit records a workload action and its outcome. A failure to record it is
+// logged rather than failing an action that already happened.
+func (h *KubernetesHandler) audit(c *gin.Context, cluster *models.KubernetesCluster, action string, response WorkloadActionResponse, actionErr error) {
+	entry := models.AuditLog{
+		UserID:    c.GetUint("user_id"),
+		ClusterID: cluster.ID,
+		Action:    action,
+		Resource:  fmt.Sprintf("%s/%s/%s", response.Kind, response.Namespace, response.Name),
+		Result:    models.AuditSucceeded,
+	}
+	if organizationID, ok := c.Get("organization_id"); ok {
+		id := organizationID.(uint)
+		entry.OrganizationID = &id
+	}
+	if details, err := json.Marshal(response); err == nil {
+		entry.Details = string(details)
+	}
+	if actionErr != nil {
+		entry.Result = models.AuditFailed
+		entry.Error = actionErr.Error()
+	}
+	if err := h.db.DB.Create(&entry).Error; err != nil {
+		fmt.Printf("Failed to record %s of %s on cluster %d: %v\n", action, entry.Resource, cluster.ID, err)
+	}
+}
+
+// workloadErrorStatus maps a failed action to the status returned for it
+func workloadErrorStatus(err error) int {
+	switch {
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsConflict(err):
+		return http.StatusConflict
+	case apierrors.IsInvalid(err):
+		return http.StatusBadRequest
+	}
+	return http.StatusBadGateway
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdmissionLimiter bounds how many requests run at once. Requests beyond the limit
+// wait in a bounded queue; when the queue is full or the wait times out they are
+// rejected with 503 and Retry-After instead of piling up.
+type AdmissionLimiter struct {
+	slots    chan struct{}
+	maxQueue int64
+	maxWait  time.Duration
+	queued   atomic.Int64
+}
+
+// NewAdmissionLimiter creates a limiter running at most maxConcurrent requests,
+// with up to maxQueue more waiting at most maxWait for a slot
+func NewAdmissionLimiter(maxConcurrent, maxQueue int, maxWait time.Duration) *AdmissionLimiter {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &AdmissionLimiter{
+		slots:    make(chan struct{}, maxConcurrent),
+		maxQueue: int64(maxQueue),
+		maxWait:  maxWait,
+	}
+}
+
+// Handler returns the middleware enforcing the limit
+func (l *AdmissionLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Fast path: a slot is free
+		select {
+		case l.slots <- struct{}{}:
+			defer func() { <-l.slots }()
+			c.Next()
+			return
+		default:
+		}
+
+		if l.queued.Add(1) > l.maxQueue {
+			l.queued.Add(-1)
+			l.reject(c, "Server is busy, too many requests queued")
+			return
+		}
+
+		timer := time.NewTimer(l.maxWait)
+		defer timer.Stop()
+
+		select {
+		case l.slots <- struct{}{}:
+			l.queued.Add(-1)
+			defer func() { <-l.slots }()
+			c.Next()
+		case <-timer.C:
+			l.queued.Add(-1)
+			l.reject(c, "Server is busy, timed out waiting for capacity")
+		case <-c.Request.Context().Done():
+			l.queued.Add(-1)
+			c.Abort()
+		}
+	}
+}
+
+// reject answers 503, suggesting a retry once the queue has had time to drain
+func (l *AdmissionLimiter) reject(c *gin.Context, message string) {
+	retryAfter := int(math.Ceil(l.maxWait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": message, "retry_after": retryAfter})
+	c.Abort()
+}
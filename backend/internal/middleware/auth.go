@@ -1,15 +1,26 @@
 package middleware
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// AuthMiddleware validates JWT tokens
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// apiKeyUseInterval is how often the last use of an API key is recorded
+const apiKeyUseInterval = time.Minute
+
+// AuthMiddleware validates JWT tokens and API keys
+func AuthMiddleware(jwtSecret string, db *database.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
 		if token == "" {
@@ -23,6 +34,18 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			token = token[7:]
 		}
 
+		if services.IsAPIKey(token) {
+			userID, ok := authenticateAPIKey(c, db, token)
+			if !ok {
+				return
+			}
+			c.Set("user_id", userID)
+			c.Set("session_id", services.SessionID(token))
+			c.Request = c.Request.WithContext(agent.WithUser(c.Request.Context(), userID))
+			c.Next()
+			return
+		}
+
 		// Validate JWT token
 		claims := jwt.MapClaims{}
 		parsedToken, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
@@ -68,23 +91,140 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 
 		// Set user ID in context
 		c.Set("user_id", userID)
+		// Conversation contexts are kept per login, until the token expires
+		c.Set("session_id", services.SessionID(token))
+		if expiresAt, err := claims.GetExpirationTime(); err == nil && expiresAt != nil {
+			c.Set("session_expires_at", expiresAt.Time)
+		}
+		// LLM spend of the request is accounted to the user
+		c.Request = c.Request.WithContext(agent.WithUser(c.Request.Context(), userID))
 		c.Next()
 	}
 }
 
-// CORSMiddleware handles Cross-Origin Resource Sharing
-func CORSMiddleware() gin.HandlerFunc {
+// authenticateAPIKey returns the user of an API key, or aborts the request
+// when the key is unknown or expired
+func authenticateAPIKey(c *gin.Context, db *database.Database, key string) (uint, bool) {
+	var apiKey models.APIKey
+	if err := db.DB.Where("key_hash = ?", services.HashAPIKey(key)).First(&apiKey).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return 0, false
+	}
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API key expired"})
+		c.Abort()
+		return 0, false
+	}
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyUseInterval {
+		if err := db.DB.Model(&apiKey).Update("last_used_at", now).Error; err != nil {
+			fmt.Printf("Failed to record use of API key %d: %v\n", apiKey.ID, err)
+		}
+	}
+	return apiKey.UserID, true
+}
+
+// ActiveUserMiddleware rejects the tokens of users deactivated by a platform
+// admin, which stay valid until they expire. It must run after AuthMiddleware.
+func ActiveUserMiddleware(db *database.Database) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
+		// Read from the primary, as a lagging replica would let a user who was
+		// just deactivated through
+		var deactivated int64
+		if err := db.DB.Model(&models.User{}).
+			Where("id = ? AND deactivated_at IS NOT NULL", userID).Count(&deactivated).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load user"})
+			c.Abort()
+			return
+		}
+		if deactivated > 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminMiddleware allows only users whose email is in adminEmails. It must run
+// after AuthMiddleware.
+func AdminMiddleware(db *database.Database, adminEmails []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
 			return
 		}
 
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		for _, email := range adminEmails {
+			if strings.EqualFold(email, user.Email) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		c.Abort()
+	}
+}
+
+// OrganizationMiddleware requires the user to belong to an organization and, when
+// roles are given, to hold one of them. It sets organization_id and org_role.
+// It must run after AuthMiddleware.
+func OrganizationMiddleware(db *database.Database, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := db.DB.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+		if user.OrganizationID == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "User does not belong to an organization"})
+			c.Abort()
+			return
+		}
+
+		if len(roles) > 0 {
+			allowed := false
+			for _, role := range roles {
+				if user.Role == role {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient organization role"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set("organization_id", *user.OrganizationID)
+		c.Set("org_role", user.Role)
 		c.Next()
 	}
 }
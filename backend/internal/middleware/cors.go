@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORSMiddleware handles Cross-Origin Resource Sharing. Allowed origins are
+// echoed back individually, since browsers reject a "*" origin on credentialed
+// requests; requests from other origins get no CORS headers.
+func CORSMiddleware(cfg config.CORSConfig) gin.HandlerFunc {
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		// Responses differ per origin, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
+		if preflight {
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+			c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" {
+			c.Next()
+			return
+		}
+		if !originAllowed(origin, cfg.AllowedOrigins) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		// Let browsers read the pagination headers of list responses
+		c.Header("Access-Control-Expose-Headers", "X-Total-Count, Link")
+		c.Next()
+	}
+}
+
+// originAllowed matches an origin against the allowlist. A "*" in a pattern
+// matches within a single path segment, so https://*.example.com matches
+// subdomains but not other schemes or paths.
+func originAllowed(origin string, allowed []string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		if pattern == "*" || pattern == origin {
+			return true
+		}
+		if strings.Contains(pattern, "*") {
+			if matched, err := path.Match(pattern, origin); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
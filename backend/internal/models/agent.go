@@ -7,32 +7,66 @@ import (
 )
 
 type AgentQuery struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	UserID    uint           `json:"user_id" gorm:"not null"`
-	ClusterID uint           `json:"cluster_id"`
-	Query     string         `json:"query" gorm:"type:text;not null"`
-	Response  string         `json:"response" gorm:"type:text"`
-	Status    string         `json:"status" gorm:"default:'pending'"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	UserID    uint   `json:"user_id" gorm:"not null;index"`
+	ClusterID *uint  `json:"cluster_id" gorm:"index"`
+	Query     string `json:"query" gorm:"type:text;not null"`
+	Response  string `json:"response" gorm:"type:text"`
+	Status    string `json:"status" gorm:"default:'pending'"`
+	// PromptVersion is the version of the system prompt the query was answered with
+	PromptVersion string `json:"prompt_version,omitempty" gorm:"size:32;index"`
+	// Rating is the asking user's feedback on the answer: 1 when it helped,
+	// -1 when it didn't, nil until rated
+	Rating          *int           `json:"rating,omitempty" gorm:"index"`
+	FeedbackComment string         `json:"feedback_comment,omitempty" gorm:"type:text"`
+	RatedAt         *time.Time     `json:"rated_at,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	User    User              `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	Cluster KubernetesCluster `json:"cluster,omitempty" gorm:"foreignKey:ClusterID"`
 }
 
+// ConversationContext is the cluster, and optionally namespace, that the
+// queries of a session are about when they don't name a cluster. A session is
+// a login token or an API key, identified by the SHA-256 hash of it.
+type ConversationContext struct {
+	ID        uint   `json:"-" gorm:"primaryKey"`
+	SessionID string `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	UserID    uint   `json:"user_id" gorm:"not null;index"`
+	ClusterID uint   `json:"cluster_id" gorm:"not null"`
+	Namespace string `json:"namespace,omitempty"`
+	// ExpiresAt is when the session's token expires, nil for API keys
+	ExpiresAt *time.Time `json:"expires_at,omitempty" gorm:"index"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Relationships
+	Cluster KubernetesCluster `json:"-" gorm:"foreignKey:ClusterID"`
+}
+
+// Deployment summarizes a deployment execution for the deployment history:
+// the stack it deployed, its outcome and how long it took
 type Deployment struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	UserID    uint           `json:"user_id" gorm:"not null"`
-	ClusterID uint           `json:"cluster_id" gorm:"not null"`
-	StackName string         `json:"stack_name" gorm:"not null"`
-	Status    string         `json:"status" gorm:"default:'pending'"`
-	Manifest  string         `json:"manifest" gorm:"type:text"`
-	Error     string         `json:"error" gorm:"type:text"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	UserID    uint   `json:"user_id" gorm:"not null;index"`
+	ClusterID uint   `json:"cluster_id" gorm:"not null;index"`
+	StackName string `json:"stack_name" gorm:"not null"`
+	Status    string `json:"status" gorm:"default:'pending'"`
+	Manifest  string `json:"manifest" gorm:"type:text"`
+	Error     string `json:"error" gorm:"type:text"`
+	// ExecutionID is the DeploymentExecutionRecord the deployment ran as
+	ExecutionID string     `json:"execution_id" gorm:"size:191;uniqueIndex"`
+	PlanID      string     `json:"plan_id" gorm:"index"`
+	StartedAt   time.Time  `json:"started_at" gorm:"index"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	// DurationSeconds is set once the deployment finished
+	DurationSeconds float64        `json:"duration_seconds"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	User    User              `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -49,3 +83,209 @@ type AgentResponse struct {
 	Status   string `json:"status"`
 	Error    string `json:"error,omitempty"`
 }
+
+// Deployment plan statuses. Plans of organization members wait for approval
+// by another operator or admin before they can be deployed.
+const (
+	PlanStatusDraft           = "draft"
+	PlanStatusPendingApproval = "pending_approval"
+	PlanStatusApproved        = "approved"
+	PlanStatusRejected        = "rejected"
+)
+
+type DeploymentPlanRecord struct {
+	ID             string `json:"id" gorm:"primaryKey"`
+	UserID         uint   `json:"user_id" gorm:"not null;index"`
+	OrganizationID *uint  `json:"organization_id" gorm:"index"`
+	ClusterID      *uint  `json:"cluster_id"`
+	Query          string `json:"query" gorm:"type:text"`
+	Name           string `json:"name"`
+	Plan           string `json:"plan" gorm:"type:text;not null"` // JSON-encoded agent.DeploymentPlan
+	Status         string `json:"status" gorm:"default:'draft'"`
+	// ReviewedBy is the user who approved or rejected the plan
+	ReviewedBy    *uint      `json:"reviewed_by"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	ReviewComment string     `json:"review_comment" gorm:"type:text"`
+	// RequiredApprovals is how many different reviewers must approve the plan;
+	// below two, the first approval is enough
+	RequiredApprovals int `json:"required_approvals"`
+	// LicenseReport is the latest JSON-encoded services.LicenseReport of the plan
+	LicenseReport string         `json:"-" gorm:"type:text"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relationships
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// PlanApproval is a reviewer's approval of a plan that needs several. The
+// approvals of a plan are dropped when it changes.
+type PlanApproval struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	PlanID    string    `json:"plan_id" gorm:"size:191;not null;uniqueIndex:idx_plan_approval_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_plan_approval_user"`
+	Comment   string    `json:"comment,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PlanEditRecord is a set of edits a user applied to a stored deployment plan
+type PlanEditRecord struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	PlanID string `json:"plan_id" gorm:"size:191;not null;index"`
+	UserID uint   `json:"user_id" gorm:"not null"`
+	// Edits is the JSON-encoded []services.PlanEdit applied, in order
+	Edits     string    `json:"-" gorm:"type:text;not null"`
+	Comment   string    `json:"comment,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DeploymentExecutionRecord struct {
+	ID        string         `json:"id" gorm:"primaryKey"`
+	UserID    uint           `json:"user_id" gorm:"not null;index"`
+	ClusterID uint           `json:"cluster_id" gorm:"not null"`
+	PlanID    string         `json:"plan_id" gorm:"index"`
+	Status    string         `json:"status" gorm:"default:'running'"`
+	Execution string         `json:"execution" gorm:"type:text;not null"` // JSON-encoded agent.DeploymentExecution
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// AbortRequested asks the replica running the deployment to abort it, and
+	// AbortCleanup to uninstall the releases it installed
+	AbortRequested bool `json:"abort_requested" gorm:"not null;default:false"`
+	AbortCleanup   bool `json:"abort_cleanup" gorm:"not null;default:false"`
+
+	// Relationships
+	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
+}
+
+// DeploymentLockRecord is a cluster namespace locked by a running deployment,
+// kept in the database when the replicas and workers share no Redis
+type DeploymentLockRecord struct {
+	// ID is the cluster ID and namespace, e.g. "3/monitoring"
+	ID    string `gorm:"primaryKey;size:191"`
+	Owner string `gorm:"size:64;not null"`
+	// Holder is the JSON-encoded services.DeploymentLock
+	Holder    string    `gorm:"type:text;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+// DeploymentStepRecord is the state of one step of a deployment execution,
+// updated as the step runs
+type DeploymentStepRecord struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	ExecutionID string     `json:"execution_id" gorm:"size:191;not null;uniqueIndex:idx_deployment_step_records_step"`
+	StepID      string     `json:"step_id" gorm:"size:191;not null;uniqueIndex:idx_deployment_step_records_step"`
+	Position    int        `json:"position"`
+	Status      string     `json:"status"` // pending, running, completed, failed, aborted, skipped, uninstalled
+	Attempts    int        `json:"attempts"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	Error       string     `json:"error" gorm:"type:text"`
+	Logs        string     `json:"-" gorm:"type:text"` // JSON-encoded []string
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// DeploymentStepMetric records how one chart install or upgrade went, for analytics
+type DeploymentStepMetric struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	ExecutionID     string    `json:"execution_id" gorm:"not null;index"`
+	StepID          string    `json:"step_id" gorm:"not null"`
+	UserID          uint      `json:"user_id" gorm:"not null;index"`
+	ClusterID       uint      `json:"cluster_id"`
+	Chart           string    `json:"chart" gorm:"not null;index"`
+	ChartVersion    string    `json:"chart_version"`
+	Action          string    `json:"action"`
+	Status          string    `json:"status"` // completed, failed
+	DurationSeconds float64   `json:"duration_seconds"`
+	Attempts        int       `json:"attempts"`
+	Error           string    `json:"error" gorm:"type:text"`
+	Signature       string    `json:"signature" gorm:"type:text"` // normalized error
+	StartedAt       time.Time `json:"started_at" gorm:"index"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// LLMUsageRecord is the token usage and cost of one completion, attributed to
+// the user it was made for and their organization at the time
+type LLMUsageRecord struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// UserID is 0 and OrganizationID nil for background work
+	UserID           uint      `json:"user_id" gorm:"index"`
+	OrganizationID   *uint     `json:"organization_id" gorm:"index"`
+	Model            string    `json:"model"`
+	Provider         string    `json:"provider"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	Cost             float64   `json:"cost"`
+	DurationMs       int64     `json:"duration_ms"`
+	Failed           bool      `json:"failed"`
+	CreatedAt        time.Time `json:"created_at" gorm:"index"`
+}
+
+// KnownIssue maps a failure signature to a remediation hint
+type KnownIssue struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Signature   string         `json:"signature" gorm:"type:text;not null;index:,length:191"`
+	Chart       string         `json:"chart" gorm:"index"` // empty applies to every chart
+	Title       string         `json:"title" gorm:"not null"`
+	Remediation string         `json:"remediation" gorm:"type:text;not null"`
+	Source      string         `json:"source" gorm:"default:'manual'"` // manual, llm
+	Occurrences int            `json:"occurrences"`
+	LastSeen    *time.Time     `json:"last_seen"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Runbook is one version of the operational runbook of a deployment. Edits add
+// a new version rather than changing an old one.
+type Runbook struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ExecutionID string    `json:"execution_id" gorm:"size:191;not null;uniqueIndex:idx_runbook_version"`
+	Version     int       `json:"version" gorm:"not null;uniqueIndex:idx_runbook_version"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	ClusterID   uint      `json:"cluster_id"`
+	PlanID      string    `json:"plan_id"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content" gorm:"type:text;not null"` // Markdown
+	Source      string    `json:"source"`                            // agent, template, user
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Scheduled deployment statuses
+const (
+	ScheduleStatusActive    = "active"
+	ScheduleStatusPaused    = "paused"
+	ScheduleStatusCancelled = "cancelled"
+	// ScheduleStatusCompleted is set on one-off schedules once they ran
+	ScheduleStatusCompleted = "completed"
+)
+
+// ScheduledDeployment executes a stored plan once at RunAt, or repeatedly on a
+// cron schedule
+type ScheduledDeployment struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	UserID    uint   `json:"user_id" gorm:"not null;index"`
+	PlanID    string `json:"plan_id" gorm:"not null;index"`
+	ClusterID uint   `json:"cluster_id" gorm:"not null"`
+	// Cron is a five-field cron expression; empty for a one-off run at RunAt
+	Cron     string     `json:"cron,omitempty"`
+	Timezone string     `json:"timezone" gorm:"default:'UTC'"`
+	RunAt    *time.Time `json:"run_at,omitempty"`
+	// WindowMinutes is how late a run may still start, e.g. after a restart.
+	// Runs missed by more are skipped.
+	WindowMinutes     int            `json:"window_minutes"`
+	ScopedCredentials bool           `json:"scoped_credentials"`
+	Status            string         `json:"status" gorm:"default:'active';index"`
+	NextRunAt         *time.Time     `json:"next_run_at,omitempty" gorm:"index"`
+	LastRunAt         *time.Time     `json:"last_run_at,omitempty"`
+	LastExecutionID   string         `json:"last_execution_id,omitempty"`
+	LastStatus        string         `json:"last_status,omitempty"` // running, completed, failed, skipped
+	LastError         string         `json:"last_error,omitempty" gorm:"type:text"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
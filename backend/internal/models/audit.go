@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Audited actions
+const (
+	AuditWorkloadRestart = "workload.restart"
+	AuditWorkloadScale   = "workload.scale"
+	// Autopilot actions are recorded under the cluster owner
+	AuditAutopilotRestart        = "autopilot.restart"
+	AuditAutopilotIncreaseLimits = "autopilot.increase_limits"
+	AuditAutopilotNone           = "autopilot.none"
+)
+
+// Audit results
+const (
+	AuditSucceeded = "succeeded"
+	AuditFailed    = "failed"
+	// AuditRejected is an autopilot remediation its policy didn't allow
+	AuditRejected = "rejected"
+)
+
+// AuditLog records a change a user or the cluster's autopilot made to a cluster
+// outside of deployments, whether it succeeded or not
+type AuditLog struct {
+	ID     uint `json:"id" gorm:"primaryKey"`
+	UserID uint `json:"user_id" gorm:"not null;index"`
+	// OrganizationID is the user's organization at the time of the action
+	OrganizationID *uint  `json:"organization_id,omitempty" gorm:"index"`
+	ClusterID      uint   `json:"cluster_id" gorm:"not null;index"`
+	Action         string `json:"action" gorm:"not null;index"`
+	// Resource is the object acted on, like Deployment/default/grafana
+	Resource string `json:"resource"`
+	// Details is the JSON-encoded request and outcome, e.g. the replica counts
+	Details   string    `json:"details,omitempty" gorm:"type:text"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
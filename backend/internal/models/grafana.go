@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type GrafanaInstance struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	UserID      uint           `json:"user_id" gorm:"not null;index"`
+	ClusterID   uint           `json:"cluster_id" gorm:"not null;index"`
+	Name        string         `json:"name"`
+	URL         string         `json:"url"`
+	ExternalURL string         `json:"external_url"`
+	Namespace   string         `json:"namespace"`
+	ServiceName string         `json:"service_name"`
+	Port        int32          `json:"port"`
+	APIKey      string         `json:"-" gorm:"type:text"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relationships
+	User    User              `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	Cluster KubernetesCluster `json:"cluster,omitempty" gorm:"foreignKey:ClusterID"`
+}
@@ -0,0 +1,123 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Knowledge base document statuses
+const (
+	KnowledgeStatusIndexing = "indexing"
+	KnowledgeStatusReady    = "ready"
+	KnowledgeStatusFailed   = "failed"
+)
+
+// KnowledgeDocument is a runbook or SOP uploaded to ground agent answers in
+// the organization's own practices
+type KnowledgeDocument struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	UserID         uint           `json:"user_id" gorm:"not null;index"`
+	OrganizationID *uint          `json:"organization_id" gorm:"index"`
+	Title          string         `json:"title" gorm:"not null"`
+	Filename       string         `json:"filename"`
+	Content        string         `json:"content,omitempty" gorm:"type:text;not null"` // Markdown or plain text
+	Chunks         int            `json:"chunks"`
+	Status         string         `json:"status" gorm:"default:'indexing'"`
+	Error          string         `json:"error,omitempty" gorm:"type:text"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// KnowledgeChunk is an embedded passage of a knowledge base document. The
+// table needs the pgvector extension and is migrated apart from the others.
+type KnowledgeChunk struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	DocumentID     uint      `json:"document_id" gorm:"not null;index"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	OrganizationID *uint     `json:"organization_id" gorm:"index"`
+	Index          int       `json:"index"`
+	Content        string    `json:"content" gorm:"type:text;not null"`
+	Embedding      Vector    `json:"-" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// QueryEmbedding is the embedding of an answered agent query and its response,
+// so later questions can be matched against the team's past ones. Like
+// KnowledgeChunk it needs pgvector, so its migration only creates it on
+// PostgreSQL servers that have the extension.
+type QueryEmbedding struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	QueryID        uint      `json:"query_id" gorm:"not null;uniqueIndex"`
+	UserID         uint      `json:"user_id" gorm:"not null;index"`
+	OrganizationID *uint     `json:"organization_id" gorm:"index"`
+	Embedding      Vector    `json:"-" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Vector is a pgvector column value
+type Vector []float32
+
+// GormDataType stores vectors without a fixed dimension, so the embedding model can be configured
+func (Vector) GormDataType() string {
+	return "vector"
+}
+
+// String formats the vector as a pgvector literal, e.g. [0.1,0.2]
+func (v Vector) String() string {
+	parts := make([]string, len(v))
+	for i, value := range v {
+		parts[i] = strconv.FormatFloat(float64(value), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// GormValue casts the literal, which would otherwise be sent as text
+func (v Vector) GormValue(ctx context.Context, db *gorm.DB) clause.Expr {
+	return clause.Expr{SQL: "?::vector", Vars: []interface{}{v.String()}}
+}
+
+// Value implements driver.Valuer
+func (v Vector) Value() (driver.Value, error) {
+	return v.String(), nil
+}
+
+// Scan implements sql.Scanner
+func (v *Vector) Scan(src interface{}) error {
+	var literal string
+	switch typed := src.(type) {
+	case string:
+		literal = typed
+	case []byte:
+		literal = string(typed)
+	case nil:
+		*v = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a vector", src)
+	}
+
+	literal = strings.Trim(strings.TrimSpace(literal), "[]")
+	if literal == "" {
+		*v = Vector{}
+		return nil
+	}
+	parts := strings.Split(literal, ",")
+	vector := make(Vector, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return fmt.Errorf("invalid vector element %q: %w", part, err)
+		}
+		vector[i] = float32(value)
+	}
+	*v = vector
+	return nil
+}
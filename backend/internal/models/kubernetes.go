@@ -1,28 +1,102 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
 type KubernetesCluster struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	UserID     uint           `json:"user_id" gorm:"not null"`
-	Name       string         `json:"name" gorm:"not null"`
-	KubeConfig string         `json:"kube_config" gorm:"type:text;not null"`
-	ClusterURL string         `json:"cluster_url"`
-	Version    string         `json:"version"`
-	Status     string         `json:"status" gorm:"default:'pending'"`
-	IsActive   bool           `json:"is_active" gorm:"default:true"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	UserID     uint   `json:"user_id" gorm:"not null"`
+	Name       string `json:"name" gorm:"not null"`
+	KubeConfig string `json:"kube_config" gorm:"type:text;not null"`
+	// AuthMode is how the stored kubeconfig was built: kubeconfig, token or service_account
+	AuthMode string `json:"auth_mode" gorm:"default:'kubeconfig'"`
+	// Context is the kubeconfig context the cluster is reached through, the
+	// kubeconfig's current context unless another one was picked
+	Context string `json:"context,omitempty"`
+	// Contexts lists every context of the stored kubeconfig
+	Contexts   KubeContexts `json:"contexts,omitempty"`
+	ClusterURL string       `json:"cluster_url"`
+	Version    string       `json:"version"`
+	// PrometheusURL overrides in-cluster Prometheus discovery for metric queries
+	PrometheusURL string `json:"prometheus_url"`
+	// Autopilot is the JSON-encoded services.AutopilotPolicy of automatic remediations
+	Autopilot string `json:"-" gorm:"type:text"`
+	// ManagementClusterID and CAPIRef ("namespace/name") link a workload cluster
+	// registered from a Cluster API management cluster to its Cluster object
+	ManagementClusterID *uint  `json:"management_cluster_id,omitempty" gorm:"index"`
+	CAPIRef             string `json:"capi_ref,omitempty"`
+	Status              string `json:"status" gorm:"default:'pending'"`
+	IsActive            bool   `json:"is_active" gorm:"default:true"`
+	// Environment is dev, staging or prod, empty when unclassified. Production
+	// clusters only take approved plans and get conservative resources.
+	Environment string `json:"environment" gorm:"size:16;index"`
+	// Labels tag the cluster, e.g. team=payments or region=eu-west-1
+	Labels Labels `json:"labels"`
+	// HealthCheckedAt is when the health monitor last claimed the cluster for a check
+	HealthCheckedAt *time.Time     `json:"health_checked_at,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	User User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// ResolveConnectorKubeconfig points the stored kubeconfig of a connector
+// cluster at this replica's proxy of connector tunnels. It is nil when the
+// replica serves no proxy.
+var ResolveConnectorKubeconfig func(stored string) (string, error)
+
+// AfterFind resolves the kubeconfig of connector clusters, which is stored
+// without a proxy as every replica serves its own
+func (c *KubernetesCluster) AfterFind(tx *gorm.DB) error {
+	if c.AuthMode != "connector" || ResolveConnectorKubeconfig == nil {
+		return nil
+	}
+	if kubeconfig, err := ResolveConnectorKubeconfig(c.KubeConfig); err == nil {
+		c.KubeConfig = kubeconfig
+	}
+	return nil
+}
+
+// ClusterConnector is the in-cluster connector a cluster was onboarded with
+// instead of a kubeconfig. The connector dials out to the platform, which
+// reaches the API server through that connection.
+type ClusterConnector struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	ClusterID   uint   `json:"cluster_id" gorm:"not null;uniqueIndex"`
+	Namespace   string `json:"namespace"`
+	ClusterRole string `json:"cluster_role"`
+	// TokenHash is the SHA-256 of the token the connector authenticates with;
+	// the token itself is only in the manifest
+	TokenHash string `json:"-" gorm:"not null;uniqueIndex"`
+	// ProxyToken authenticates the cluster's kubeconfig to the loopback proxy
+	ProxyToken     string     `json:"-" gorm:"not null"`
+	RemoteAddr     string     `json:"remote_addr,omitempty"`
+	ConnectedAt    *time.Time `json:"connected_at,omitempty"`
+	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ClusterHealthCheck is the outcome of one background connectivity check
+type ClusterHealthCheck struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ClusterID uint      `json:"cluster_id" gorm:"not null;index:idx_cluster_health,priority:1"`
+	Reachable bool      `json:"reachable"`
+	LatencyMs int64     `json:"latency_ms"`
+	Version   string    `json:"version,omitempty"`
+	Error     string    `json:"error,omitempty" gorm:"type:text"`
+	CheckedAt time.Time `json:"checked_at" gorm:"not null;index:idx_cluster_health,priority:2"`
+}
+
 type ClusterValidationResponse struct {
 	IsValid    bool   `json:"is_valid"`
 	Version    string `json:"version,omitempty"`
@@ -31,9 +105,119 @@ type ClusterValidationResponse struct {
 }
 
 type ClusterStatus struct {
-	ID       uint   `json:"id"`
-	Name     string `json:"name"`
-	Status   string `json:"status"`
-	IsActive bool   `json:"isActive"`
-	Version  string `json:"version"`
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	IsActive    bool   `json:"isActive"`
+	Version     string `json:"version"`
+	Environment string `json:"environment,omitempty"`
+	Labels      Labels `json:"labels,omitempty"`
+	Context     string `json:"context,omitempty"`
+}
+
+// Labels are key/value tags stored as a JSON object: JSONB on PostgreSQL,
+// JSON on MySQL and text elsewhere
+type Labels map[string]string
+
+// Value encodes the labels for the database
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Scan decodes labels read from the database
+func (l *Labels) Scan(value interface{}) error {
+	*l = nil
+	return scanJSON(value, l, "labels")
+}
+
+// GormDBDataType stores labels in the database's JSON type
+func (Labels) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	return jsonDataType(db)
+}
+
+// KubeContext is a context of a cluster's kubeconfig
+type KubeContext struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	Server    string `json:"server,omitempty"`
+	User      string `json:"user,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// KubeContexts are the contexts of a kubeconfig, stored as a JSON array like
+// labels
+type KubeContexts []KubeContext
+
+// Value encodes the contexts for the database
+func (k KubeContexts) Value() (driver.Value, error) {
+	if k == nil {
+		return "[]", nil
+	}
+	encoded, err := json.Marshal(k)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+// Scan decodes contexts read from the database
+func (k *KubeContexts) Scan(value interface{}) error {
+	*k = nil
+	return scanJSON(value, k, "kubeconfig contexts")
+}
+
+// GormDBDataType stores contexts in the database's JSON type
+func (KubeContexts) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	return jsonDataType(db)
+}
+
+// scanJSON decodes a JSON column into target, leaving it untouched when the
+// column is NULL or empty
+func scanJSON(value interface{}, target interface{}, name string) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into %s", value, name)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, target)
+}
+
+// jsonDataType is the database's JSON type: JSONB on PostgreSQL, JSON on
+// MySQL and text elsewhere
+func jsonDataType(db *gorm.DB) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return "jsonb"
+	case "mysql":
+		return "json"
+	}
+	return "text"
+}
+
+// ClusterSnapshot stores a cluster analysis so later analyses can be diffed against it
+type ClusterSnapshot struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	ClusterID uint   `json:"cluster_id" gorm:"not null;index"`
+	UserID    uint   `json:"user_id" gorm:"not null"`
+	Analysis  string `json:"analysis" gorm:"type:text;not null"` // JSON-encoded agent.ClusterAnalysis
+	// UsageSample marks snapshots taken only to track resource usage, which
+	// didn't drift from the snapshot before them
+	UsageSample bool      `json:"usage_sample" gorm:"not null;default:false"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification is a stored platform event shown to a user
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	ClusterID *uint      `json:"cluster_id,omitempty" gorm:"index"`
+	Type      string     `json:"type" gorm:"not null"`
+	Severity  string     `json:"severity"`
+	Rule      string     `json:"rule,omitempty"`
+	Resource  string     `json:"resource,omitempty"`
+	Title     string     `json:"title" gorm:"not null"`
+	Message   string     `json:"message" gorm:"type:text"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
+
+// NotificationChannel delivers a user's or, when OrganizationID is set, an
+// organization's events to Slack, email or a webhook
+type NotificationChannel struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	UserID         uint   `json:"user_id" gorm:"not null;index"` // creator
+	OrganizationID *uint  `json:"organization_id,omitempty" gorm:"index"`
+	Name           string `json:"name" gorm:"not null"`
+	Type           string `json:"type" gorm:"not null"` // slack, email, webhook
+	// URL is the Slack or webhook URL. Slack webhook URLs are credentials, so it
+	// is never returned.
+	URL        string `json:"-"`
+	Recipients string `json:"recipients,omitempty"` // comma-separated email addresses
+	Secret     string `json:"-"`
+	// Events is a comma-separated list of the event types delivered; empty for all
+	Events     string         `json:"events"`
+	Template   string         `json:"template,omitempty" gorm:"type:text"`
+	Enabled    bool           `json:"enabled"`
+	LastSentAt *time.Time     `json:"last_sent_at,omitempty"`
+	LastError  string         `json:"last_error,omitempty" gorm:"type:text"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// SlackAccount is a Slack user of a workspace and the platform user their
+// /k8s-agent commands run as. Accounts are created unlinked with a link code
+// the platform user enters; unlinking deletes them for good.
+type SlackAccount struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	TeamID        string `json:"team_id" gorm:"size:32;not null;uniqueIndex:idx_slack_account_user"`
+	SlackUserID   string `json:"slack_user_id" gorm:"size:32;not null;uniqueIndex:idx_slack_account_user"`
+	SlackUserName string `json:"slack_user_name"`
+	UserID        *uint  `json:"user_id,omitempty" gorm:"index"`
+	// ClusterID is the cluster the account's queries are about
+	ClusterID *uint `json:"cluster_id,omitempty"`
+	// LinkCodeHash is the hash of the pending link code, valid until LinkCodeExpiresAt
+	LinkCodeHash      string     `json:"-" gorm:"size:64;index"`
+	LinkCodeExpiresAt *time.Time `json:"-"`
+	LinkedAt          *time.Time `json:"linked_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,117 @@
+package models
+
+import "time"
+
+// Operation types
+const (
+	OperationClusterAnalysis = "cluster_analysis"
+	OperationPlanGeneration  = "plan_generation"
+	OperationDeployment      = "deployment"
+	OperationUninstall       = "uninstall"
+	OperationExport          = "export"
+	OperationKnowledgeIndex  = "knowledge_indexing"
+	OperationSecurityScan    = "security_scan"
+)
+
+// Operation statuses
+const (
+	OperationPending   = "pending"
+	OperationRunning   = "running"
+	OperationSucceeded = "succeeded"
+	OperationFailed    = "failed"
+	OperationCancelled = "cancelled"
+)
+
+// Operation tracks a long-running request running in the background, with its
+// progress and, once it succeeded, its result
+type Operation struct {
+	ID       string `json:"id" gorm:"primaryKey"`
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+	Type     string `json:"type" gorm:"not null;index"`
+	Target   string `json:"target,omitempty"` // e.g. the cluster or plan the operation works on
+	Status   string `json:"status" gorm:"default:'pending';index"`
+	Progress int    `json:"progress"` // 0-100
+	Message  string `json:"message,omitempty"`
+	// CancelRequested is set when a user cancels, so whichever replica runs the
+	// operation stops it
+	CancelRequested bool `json:"cancel_requested"`
+	// Result is the JSON-encoded result, or the exported file of exports
+	Result     string     `json:"-" gorm:"type:text"`
+	ResultType string     `json:"result_type,omitempty"` // content type of Result
+	ResultName string     `json:"result_name,omitempty"` // file name of exports
+	Error      string     `json:"error,omitempty" gorm:"type:text"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Finished reports whether the operation reached a final status
+func (o *Operation) Finished() bool {
+	return o.Status == OperationSucceeded || o.Status == OperationFailed || o.Status == OperationCancelled
+}
+
+// Job kinds
+const (
+	JobDeploy          = "deploy"
+	JobRetryDeployment = "retry_deployment"
+	JobSchedule        = "schedule"
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// Job is a deployment queued for the deployment workers. Requests waiting for
+// it are answered with its response; requests made with ?async=true follow it
+// through its operation.
+type Job struct {
+	ID          string `json:"id" gorm:"primaryKey"`
+	Kind        string `json:"kind" gorm:"not null;index"`
+	UserID      uint   `json:"user_id" gorm:"not null;index"`
+	OperationID string `json:"operation_id,omitempty" gorm:"index"`
+	Payload     string `json:"-" gorm:"type:text"` // JSON-encoded request
+	Status      string `json:"status" gorm:"default:'queued';index"`
+	// WorkerID is the worker running the job, or the last one that ran it
+	WorkerID string `json:"worker_id,omitempty" gorm:"index"`
+	// Attempts counts the workers that started the job; jobs of workers that
+	// stopped heartbeating are requeued until they reach the limit. Only the
+	// worker of the latest attempt may store the job's outcome.
+	Attempts int `json:"attempts"`
+	// ExecutionID is the deployment the job started, which later attempts
+	// resume rather than deploying again
+	ExecutionID string `json:"execution_id,omitempty"`
+	// ConnectorClusterID is the cluster of jobs deploying to a cluster onboarded
+	// with an in-cluster connector, which only the workers of the API replica
+	// holding its tunnel claim
+	ConnectorClusterID *uint      `json:"connector_cluster_id,omitempty" gorm:"index"`
+	ResponseStatus     int        `json:"response_status,omitempty"`
+	Response           string     `json:"-" gorm:"type:text"` // JSON-encoded response body
+	Error              string     `json:"error,omitempty" gorm:"type:text"`
+	StartedAt          *time.Time `json:"started_at,omitempty"`
+	FinishedAt         *time.Time `json:"finished_at,omitempty"`
+	CreatedAt          time.Time  `json:"created_at" gorm:"index"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// Finished reports whether the job reached a final status
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// Worker is a process running deployment jobs, alive while it heartbeats
+type Worker struct {
+	ID            string     `json:"id" gorm:"primaryKey"`
+	Hostname      string     `json:"hostname"`
+	Concurrency   int        `json:"concurrency"`
+	RunningJobs   int        `json:"running_jobs"`
+	JobsSucceeded int        `json:"jobs_succeeded"`
+	JobsFailed    int        `json:"jobs_failed"`
+	StartedAt     time.Time  `json:"started_at"`
+	HeartbeatAt   time.Time  `json:"heartbeat_at" gorm:"index"`
+	StoppedAt     *time.Time `json:"stopped_at,omitempty"`
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Organization roles
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleMember   = "member"
+)
+
+type Organization struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"not null"`
+	// LicensePolicy is the JSON-encoded services.LicensePolicy plans are checked against
+	LicensePolicy string `json:"-" gorm:"type:text"`
+	// SecurityPolicy is the JSON-encoded services.SecurityPolicy deployments are scanned against
+	SecurityPolicy string `json:"-" gorm:"type:text"`
+	// IngressPolicy is the JSON-encoded services.IngressPolicy plans expose charts with
+	IngressPolicy string `json:"-" gorm:"type:text"`
+	// ChartPolicy is the JSON-encoded services.ChartPolicy plans rank searched charts with
+	ChartPolicy string         `json:"-" gorm:"type:text"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Relationships
+	Members []User `json:"members,omitempty" gorm:"foreignKey:OrganizationID"`
+}
+
+// OrgValuePolicy holds values an organization requires in every generated chart.
+// A nil ClusterID is the organization default; otherwise it overrides the default
+// for that cluster.
+type OrgValuePolicy struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	OrganizationID uint           `json:"organization_id" gorm:"not null;index"`
+	ClusterID      *uint          `json:"cluster_id" gorm:"index"`
+	Policy         string         `json:"policy" gorm:"type:text;not null"` // JSON-encoded services.ValuePolicy
+	UpdatedBy      uint           `json:"updated_by"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// OrgValueOverlay holds the values an organization changes in plans deployed
+// to clusters of an environment, below its value policy. Overlays are deleted
+// for good.
+type OrgValueOverlay struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;uniqueIndex:idx_org_value_overlay_environment"`
+	Environment    string    `json:"environment" gorm:"size:16;not null;uniqueIndex:idx_org_value_overlay_environment"`
+	Overlay        string    `json:"overlay" gorm:"type:text;not null"` // JSON-encoded agent.ValueOverlay
+	UpdatedBy      uint      `json:"updated_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// OrgPolicy is a Rego policy every deployment plan of the organization must
+// pass. Policies are deleted for good, so the name can be used again.
+type OrgPolicy struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"not null;uniqueIndex:idx_org_policy_name"`
+	Name           string    `json:"name" gorm:"size:191;not null;uniqueIndex:idx_org_policy_name"`
+	Description    string    `json:"description"`
+	Module         string    `json:"module" gorm:"type:text;not null"` // Rego module defining deny
+	Enabled        bool      `json:"enabled"`
+	UpdatedBy      uint      `json:"updated_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// OrgChartRule allows or blocks charts in an organization's plans. Rules match
+// a repository, a chart in any repository, or a chart of a repository; once
+// any rule allows charts, charts no allow rule matches are blocked. Rules are
+// deleted for good.
+type OrgChartRule struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	OrganizationID uint   `json:"organization_id" gorm:"not null;index"`
+	Action         string `json:"action" gorm:"size:16;not null"` // allow, block
+	// Repository is an Artifact Hub repository name or a chart repository URL
+	Repository string    `json:"repository,omitempty"`
+	Chart      string    `json:"chart,omitempty"`
+	Reason     string    `json:"reason,omitempty" gorm:"type:text"`
+	UpdatedBy  uint      `json:"updated_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// HelmRegistry is an OCI registry an organization pulls charts from, with the
+// credentials helm logs in with. Registries are deleted for good, so the host
+// can be added again.
+type HelmRegistry struct {
+	ID             uint `json:"id" gorm:"primaryKey"`
+	OrganizationID uint `json:"organization_id" gorm:"not null;uniqueIndex:idx_helm_registry_host"`
+	// Host is the registry host of oci:// chart references, e.g. ghcr.io
+	Host      string    `json:"host" gorm:"size:191;not null;uniqueIndex:idx_helm_registry_host"`
+	Username  string    `json:"username"`
+	Password  string    `json:"-"`
+	UpdatedBy uint      `json:"updated_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// OrgStackTemplate is a stack template an organization publishes into the
+// stack catalog. Publishing a template under its name again replaces it with
+// the new version. Templates are deleted for good, so the name can be used
+// again.
+type OrgStackTemplate struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	OrganizationID uint   `json:"organization_id" gorm:"not null;uniqueIndex:idx_org_stack_template_name"`
+	Name           string `json:"name" gorm:"size:191;not null;uniqueIndex:idx_org_stack_template_name"`
+	Category       string `json:"category" gorm:"size:32;not null"`
+	Version        string `json:"version" gorm:"size:64;not null"`
+	// Template is the JSON-encoded agent.StackProfile plans are created from
+	Template string `json:"-" gorm:"type:text;not null"`
+	// Instructions are the template's prompt instructions, which the encoded
+	// profile leaves out
+	Instructions      string    `json:"-" gorm:"type:text"`
+	RequiredApprovals int       `json:"required_approvals"`
+	UpdatedBy         uint      `json:"updated_by"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
@@ -7,23 +7,46 @@ import (
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Email     string         `json:"email" gorm:"uniqueIndex;not null"`
-	Password  string         `json:"-" gorm:"not null"`
-	FirstName string         `json:"first_name"`
-	LastName  string         `json:"last_name"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	Email     string `json:"email" gorm:"size:191;uniqueIndex;not null"`
+	Password  string `json:"-" gorm:"not null"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	// OrganizationID is nil until the user creates or is added to an organization
+	OrganizationID *uint  `json:"organization_id" gorm:"index"`
+	Role           string `json:"role" gorm:"default:'member'"` // admin, operator, member
+	// DeactivatedAt is set when a platform admin deactivated the user, who
+	// can no longer sign in or use their tokens
+	DeactivatedAt *time.Time     `json:"deactivated_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	Clusters []KubernetesCluster `json:"clusters,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// APIKey authenticates a user's scripts and the aictl CLI instead of a JWT.
+// Only the SHA-256 hash of the key is stored; it is shown once when created.
+type APIKey struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	UserID uint   `json:"user_id" gorm:"not null;index"`
+	Name   string `json:"name" gorm:"not null"`
+	// Prefix is the start of the key, to tell keys apart
+	Prefix     string     `json:"prefix" gorm:"size:16;not null"`
+	KeyHash    string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
 type UserResponse struct {
-	ID        uint      `json:"id"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"first_name"`
-	LastName  string    `json:"last_name"`
-	CreatedAt time.Time `json:"created_at"`
+	ID             uint       `json:"id"`
+	Email          string     `json:"email"`
+	FirstName      string     `json:"first_name"`
+	LastName       string     `json:"last_name"`
+	OrganizationID *uint      `json:"organization_id,omitempty"`
+	Role           string     `json:"role,omitempty"`
+	DeactivatedAt  *time.Time `json:"deactivated_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
 }
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/handlers"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+)
+
+// newEventBus returns the event bus cluster watch alerts, deployments and
+// approval requests are published on, whose events are stored as
+// notifications and delivered to notification channels
+func newEventBus(cfg *config.Config, db *database.Database, aiAgent *agent.AIAgent) (*services.EventBus, *services.NotifierService) {
+	eventBus := services.NewEventBus()
+	handlers.RecordNotifications(db, eventBus)
+	notifier := services.NewNotifierService(services.SMTPConfig{
+		Host:     cfg.SMTP.Host,
+		Port:     cfg.SMTP.Port,
+		Username: cfg.SMTP.Username,
+		Password: cfg.SMTP.Password,
+		From:     cfg.SMTP.From,
+	})
+	handlers.DeliverNotifications(db, eventBus, notifier)
+	// Events, cluster metrics and LLM token usage also go to the analytics sink
+	// when one is configured
+	if db.Analytics != nil {
+		handlers.RecordEventAnalytics(db, eventBus)
+		aiAgent.OnUsage(handlers.RecordLLMUsage(db))
+	}
+	aiAgent.OnUsage(handlers.RecordLLMSpend(db))
+	return eventBus, notifier
+}
+
+// network is where the configuration lets the platform's calls go
+func network(cfg *config.Config) services.Network {
+	return services.Network{
+		Offline:      cfg.Offline.Enabled,
+		AllowedHosts: cfg.Offline.AllowedHosts,
+		ChartMirrors: cfg.Offline.ChartMirrors,
+	}
+}
+
+// capabilities reports the features the network and the configured providers
+// leave the platform
+func capabilities(cfg *config.Config, network services.Network, aiAgent *agent.AIAgent) handlers.Capabilities {
+	status := func(err error) (string, string) {
+		if err != nil {
+			return handlers.CapabilityUnavailable, err.Error()
+		}
+		return handlers.CapabilityAvailable, ""
+	}
+
+	llm := handlers.Capability{Name: "llm", Description: "Queries, deployment plans, dashboards, alert rules and troubleshooting"}
+	llm.Status, llm.Reason = status(aiAgent.Available())
+	embeddings := handlers.Capability{Name: "embeddings", Description: "Knowledge base search and similar past queries"}
+	var embedErr error
+	if !aiAgent.Embeds() {
+		embedErr = agent.ErrEmbeddingsUnavailable
+	}
+	embeddings.Status, embeddings.Reason = status(embedErr)
+	chartSearch := handlers.Capability{Name: "chart_search", Description: "Chart search and versions from Artifact Hub"}
+	chartSearch.Status, chartSearch.Reason = status(network.Check("Artifact Hub", cfg.ArtifactHub.URL))
+	images := handlers.Capability{Name: "image_inspection", Description: "Image licenses, signatures and vulnerabilities from their registries", Status: handlers.CapabilityAvailable}
+	repositories := handlers.Capability{Name: "chart_repositories", Description: "Pulling charts from their repositories", Status: handlers.CapabilityAvailable}
+	if network.Offline {
+		images.Status = handlers.CapabilityLimited
+		images.Reason = "Only registries inside the network or in OFFLINE_ALLOWED_HOSTS are inspected"
+		repositories.Status = handlers.CapabilityLimited
+		repositories.Reason = "Only charts of repositories inside the network, in OFFLINE_ALLOWED_HOSTS or mirrored with CHART_REPO_MIRRORS are pulled"
+		if mirrored := network.MirroredRepositories(); len(mirrored) > 0 {
+			repositories.Reason += "; mirrored: " + strings.Join(mirrored, ", ")
+		}
+	}
+
+	return handlers.Capabilities{
+		Offline:      network.Offline,
+		LLMProvider:  cfg.LLM.Provider,
+		Capabilities: []handlers.Capability{llm, embeddings, chartSearch, images, repositories},
+	}
+}
+
+// newAgentHandler creates the agent handler with the features the
+// configuration enables
+func newAgentHandler(cfg *config.Config, db *database.Database, aiAgent *agent.AIAgent, helmService *services.HelmService, eventsService *services.EventsService, operationHandler *handlers.OperationHandler, eventBus *services.EventBus) *handlers.AgentHandler {
+	agentHandler := handlers.NewAgentHandler(db, aiAgent, helmService, eventsService, operationHandler, eventBus, cfg.JWT.Secret)
+	if db.VectorSearch {
+		agentHandler.EnableKnowledgeBase(services.NewKnowledgeBaseService(aiAgent, cfg.Knowledge.TopK))
+	}
+
+	priceSheets, err := services.LoadPriceSheets(cfg.Cost.PriceSheetFile)
+	if err != nil {
+		fmt.Printf("Failed to load price sheets, using the default pricing: %v\n", err)
+	}
+	agentHandler.EnableCostEstimates(services.Pricing{
+		Currency:       cfg.Cost.Currency,
+		CPUCoreMonth:   cfg.Cost.CPUCoreMonth,
+		MemoryGBMonth:  cfg.Cost.MemoryGBMonth,
+		StorageGBMonth: cfg.Cost.StorageGBMonth,
+	}, priceSheets)
+	if cfg.QueryCache.TTL > 0 {
+		queryCache, err := services.NewQueryCache(cfg.QueryCache.Size, cfg.QueryCache.TTL, cfg.QueryCache.RedisURL)
+		if err != nil {
+			fmt.Printf("Query cache disabled: %v\n", err)
+		} else {
+			agentHandler.EnableQueryCache(queryCache)
+		}
+	}
+	agentHandler.EnableSecretBackends(services.SecretBackends{
+		VaultAddr:      cfg.Secrets.VaultAddr,
+		VaultToken:     cfg.Secrets.VaultToken,
+		VaultNamespace: cfg.Secrets.VaultNamespace,
+		SOPSDir:        cfg.Secrets.SOPSDir,
+	})
+	agentHandler.LimitStepConcurrency(cfg.Deployment.StepConcurrency)
+	// Locks are shared by every API replica and worker process: in Redis when
+	// configured, else in the database
+	lockStore := handlers.NewDeploymentLockStore(db)
+	if cfg.Deployment.LockRedisURL != "" {
+		redisLocks, err := services.NewRedisLockStore(cfg.Deployment.LockRedisURL)
+		if err != nil {
+			fmt.Printf("Deployment locks kept in the database: %v\n", err)
+		} else {
+			lockStore = redisLocks
+		}
+	}
+	agentHandler.EnableDeploymentLocks(services.NewDeploymentLocker(lockStore, cfg.Deployment.LockTTL, cfg.Deployment.LockWait))
+	return agentHandler
+}
+
+// StartWorkers runs a deployment worker without the API, for worker processes
+// scaled apart from the API replicas. The returned function stops it once the
+// jobs it runs finished.
+func StartWorkers(cfg *config.Config, db *database.Database, aiAgent *agent.AIAgent) (func(), error) {
+	eventBus, _ := newEventBus(cfg, db, aiAgent)
+	operationHandler := handlers.NewOperationHandler(db)
+	agentHandler := newAgentHandler(cfg, db, aiAgent, services.NewHelmService(cfg.ArtifactHub.URL, network(cfg)), services.NewEventsService(cfg.Watch.Events), operationHandler, eventBus)
+	workerHandler := handlers.NewWorkerHandler(db, operationHandler, cfg.Workers, cfg.JWT.Secret)
+	agentHandler.RunJobsOn(workerHandler)
+	return workerHandler.StartWorkers()
+}
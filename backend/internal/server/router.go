@@ -0,0 +1,370 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/handlers"
+	"grafana-ai-agent-platform/backend/internal/middleware"
+	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/internal/services"
+	"grafana-ai-agent-platform/backend/pkg/database"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// NewRouter wires the handlers and returns the API router
+func NewRouter(cfg *config.Config, db *database.Database, aiAgent *agent.AIAgent) *gin.Engine {
+	eventBus, notifier := newEventBus(cfg, db, aiAgent)
+	var clusterWatcher *services.ClusterWatchService
+	if cfg.Watch.Enabled {
+		clusterWatcher = services.NewClusterWatchService(eventBus, services.ClusterWatchOptions{
+			EvaluateInterval:  cfg.Watch.Interval,
+			PVCPendingAfter:   cfg.Watch.PVCPendingAfter,
+			CrashLoopRestarts: int32(cfg.Watch.CrashLoopRestarts),
+		})
+	}
+
+	// Initialize handlers
+	authHandler := handlers.NewAuthHandler(db, cfg)
+	eventsService := services.NewEventsService(cfg.Watch.Events)
+	operationHandler := handlers.NewOperationHandler(db)
+	kubernetesHandler := handlers.NewKubernetesHandler(db, eventBus, clusterWatcher, eventsService, operationHandler, services.NewClusterReportService(aiAgent))
+	helmService := services.NewHelmService(cfg.ArtifactHub.URL, network(cfg))
+	capabilitiesHandler := handlers.NewCapabilitiesHandler(capabilities(cfg, helmService.Network(), aiAgent))
+	agentHandler := newAgentHandler(cfg, db, aiAgent, helmService, eventsService, operationHandler, eventBus)
+	workerHandler := handlers.NewWorkerHandler(db, operationHandler, cfg.Workers, cfg.JWT.Secret)
+	agentHandler.RunJobsOn(workerHandler)
+	helmHandler := handlers.NewHelmHandler(db, helmService)
+	analyticsHandler := handlers.NewAnalyticsHandler(db)
+	adminHandler := handlers.NewAdminHandler(db, kubernetesHandler, cfg.Health)
+	catalogHandler := handlers.NewCatalogHandler(db)
+	organizationHandler := handlers.NewOrganizationHandler(db, notifier, kubernetesHandler)
+	notificationHandler := handlers.NewNotificationHandler(db, notifier)
+	slackHandler := handlers.NewSlackHandler(db, agentHandler, cfg.Slack.SigningSecret)
+
+	// Clusters onboarded with an in-cluster connector are reached through its
+	// tunnel, proxied on a loopback address their kubeconfigs are pointed at
+	// as they are loaded
+	connectors, err := services.NewConnectorManager(cfg.Connector.ProxyAddr)
+	if err != nil {
+		fmt.Printf("In-cluster connectors disabled: %v\n", err)
+	} else {
+		go func() {
+			if err := connectors.ServeProxy(); err != nil {
+				fmt.Printf("Connector proxy stopped, connector clusters are unreachable: %v\n", err)
+			}
+		}()
+		models.ResolveConnectorKubeconfig = connectors.Kubeconfig
+		kubernetesHandler.EnableConnectors(connectors, cfg.Connector.PublicURL, cfg.Connector.Image)
+		workerHandler.ClaimConnectorJobs(connectors)
+	}
+
+	if cfg.Workers.Embedded {
+		if _, err := workerHandler.StartWorkers(); err != nil {
+			fmt.Printf("Embedded deployment workers disabled: %v\n", err)
+		}
+	}
+
+	kubernetesHandler.StartClusterWatches()
+	handlers.RunAutopilot(db, eventBus, services.NewAutopilotService(aiAgent))
+	if cfg.Health.Enabled {
+		kubernetesHandler.StartHealthMonitor(cfg.Health)
+	}
+	if cfg.Scheduler.Enabled {
+		agentHandler.StartScheduler(cfg.Scheduler.Interval)
+	}
+
+	// LLM-backed endpoints share one admission limit
+	llmLimiter := middleware.NewAdmissionLimiter(cfg.LLM.MaxConcurrent, cfg.LLM.MaxQueue, cfg.LLM.QueueTimeout)
+
+	// Setup Gin router
+	router := gin.Default()
+
+	// Requests are traced, continuing the traces of callers that propagate one
+	router.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return r.URL.Path != "/health"
+	})))
+
+	// Add CORS middleware
+	router.Use(middleware.CORSMiddleware(cfg.CORS))
+
+	// Health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "healthy",
+			"service": "kubernetes-ai-agent-platform",
+		})
+	})
+
+	// API routes
+	api := router.Group("/api")
+	{
+		// Authentication routes
+		auth := api.Group("/auth")
+		{
+			auth.POST("/register", authHandler.Register)
+			auth.POST("/login", authHandler.Login)
+			auth.POST("/logout", authHandler.Logout)
+		}
+
+		// In-cluster connectors authenticate with their own token
+		api.GET("/connectors/connect", kubernetesHandler.ConnectConnector)
+
+		// The Slack app's requests are signed with its signing secret
+		api.POST("/integrations/slack/commands", slackHandler.HandleCommand)
+		api.POST("/integrations/slack/interactions", slackHandler.HandleInteraction)
+
+		// Protected routes
+		protected := api.Group("")
+		protected.Use(middleware.AuthMiddleware(cfg.JWT.Secret, db), middleware.ActiveUserMiddleware(db))
+		{
+			// User profile
+			protected.GET("/profile", authHandler.GetProfile)
+			// API keys authenticate scripts and the aictl CLI
+			protected.GET("/api-keys", authHandler.GetAPIKeys)
+			protected.POST("/api-keys", authHandler.CreateAPIKey)
+			protected.DELETE("/api-keys/:id", authHandler.DeleteAPIKey)
+
+			// Features offline mode or missing providers disable
+			protected.GET("/capabilities", capabilitiesHandler.GetCapabilities)
+
+			// Stack catalog
+			protected.GET("/catalog", catalogHandler.GetCatalog)
+			protected.GET("/catalog/:name", catalogHandler.GetCatalogTemplate)
+			catalogAdmin := protected.Group("/catalog/templates")
+			catalogAdmin.Use(middleware.OrganizationMiddleware(db, models.RoleAdmin))
+			{
+				catalogAdmin.POST("", catalogHandler.PublishTemplate)
+				catalogAdmin.DELETE("/:name", catalogHandler.DeleteTemplate)
+			}
+
+			// Kubernetes routes
+			kubernetes := protected.Group("/kubernetes")
+			{
+				kubernetes.POST("/validate", kubernetesHandler.ValidateCluster)
+				kubernetes.POST("/contexts", kubernetesHandler.ListKubeconfigContexts)
+				kubernetes.POST("/clusters", kubernetesHandler.AddCluster)
+				kubernetes.POST("/connectors", kubernetesHandler.CreateConnectorCluster)
+				kubernetes.GET("/clusters/:id/connector", kubernetesHandler.GetClusterConnector)
+				kubernetes.POST("/clusters/:id/connector/manifest", kubernetesHandler.RotateConnectorManifest)
+				kubernetes.GET("/clusters", kubernetesHandler.GetClusters)
+				kubernetes.PATCH("/clusters/:id", kubernetesHandler.UpdateCluster)
+				kubernetes.PUT("/clusters/:id/context", kubernetesHandler.SetClusterContext)
+				kubernetes.DELETE("/clusters/:id", kubernetesHandler.DeleteCluster)
+				kubernetes.GET("/clusters/:id/resources", kubernetesHandler.GetClusterResources)
+				kubernetes.POST("/clusters/:id/refresh", kubernetesHandler.RefreshClusterStatus)
+				kubernetes.POST("/clusters/:id/analyze", kubernetesHandler.AnalyzeCluster)
+				kubernetes.GET("/clusters/:id/releases/outdated", agentHandler.GetOutdatedReleases)
+				kubernetes.GET("/clusters/:id/alerts", kubernetesHandler.GetClusterAlerts)
+				kubernetes.GET("/clusters/:id/autopilot", kubernetesHandler.GetClusterAutopilot)
+				kubernetes.GET("/clusters/:id/autopilot/actions", kubernetesHandler.GetAutopilotActions)
+				kubernetes.GET("/clusters/:id/events", kubernetesHandler.GetClusterEvents)
+				kubernetes.GET("/clusters/:id/namespaces", kubernetesHandler.GetClusterNamespaces)
+				kubernetes.GET("/clusters/:id/namespaces/:ns/workloads", kubernetesHandler.GetNamespaceWorkloads)
+				kubernetes.GET("/clusters/:id/namespaces/:ns/pods/:pod/logs", kubernetesHandler.GetPodLogs)
+				kubernetes.GET("/clusters/:id/drift", kubernetesHandler.GetClusterDrift)
+				kubernetes.GET("/clusters/:id/forecast", kubernetesHandler.GetClusterForecast)
+				kubernetes.GET("/clusters/:id/report", kubernetesHandler.GetClusterReport)
+				kubernetes.GET("/clusters/:id/health/history", kubernetesHandler.GetClusterHealthHistory)
+				kubernetes.GET("/clusters/:id/capi/clusters", kubernetesHandler.GetCAPIClusters)
+				kubernetes.POST("/clusters/:id/capi/clusters/:namespace/:name/register", kubernetesHandler.RegisterCAPICluster)
+			}
+
+			// Remediation actions change workloads, so only organization
+			// admins and operators may run them
+			workloadActions := protected.Group("/kubernetes/clusters/:id/workloads")
+			workloadActions.Use(middleware.OrganizationMiddleware(db, models.RoleAdmin, models.RoleOperator))
+			{
+				workloadActions.POST("/:kind/:name/restart", kubernetesHandler.RestartWorkload)
+				workloadActions.POST("/:kind/:name/scale", kubernetesHandler.ScaleWorkload)
+			}
+			// Autopilot changes workloads on its own, so it's held to the same roles
+			autopilot := protected.Group("/kubernetes/clusters/:id/autopilot")
+			autopilot.Use(middleware.OrganizationMiddleware(db, models.RoleAdmin, models.RoleOperator))
+			{
+				autopilot.PUT("", kubernetesHandler.SetClusterAutopilot)
+			}
+
+			// Helm routes
+			helm := protected.Group("/helm")
+			{
+				helm.POST("/values/suggest", helmHandler.SuggestValues)
+			}
+			helmRegistries := protected.Group("/helm/registries")
+			helmRegistries.Use(middleware.OrganizationMiddleware(db))
+			{
+				helmRegistries.GET("", helmHandler.GetRegistries)
+			}
+			helmRegistriesAdmin := protected.Group("/helm/registries")
+			helmRegistriesAdmin.Use(middleware.OrganizationMiddleware(db, models.RoleAdmin))
+			{
+				helmRegistriesAdmin.POST("", helmHandler.CreateRegistry)
+				helmRegistriesAdmin.PUT("/:id", helmHandler.UpdateRegistry)
+				helmRegistriesAdmin.DELETE("/:id", helmHandler.DeleteRegistry)
+			}
+
+			// Operation routes
+			operations := protected.Group("/operations")
+			{
+				operations.GET("", operationHandler.GetOperations)
+				operations.GET("/:id", operationHandler.GetOperation)
+				operations.POST("/:id/cancel", operationHandler.CancelOperation)
+				operations.GET("/:id/result", operationHandler.GetOperationResult)
+			}
+
+			// Notification routes
+			notifications := protected.Group("/notifications")
+			{
+				notifications.GET("", notificationHandler.GetNotifications)
+				notifications.POST("/:id/read", notificationHandler.MarkNotificationRead)
+				notifications.POST("/read-all", notificationHandler.MarkAllNotificationsRead)
+				notifications.GET("/channels", notificationHandler.GetChannels)
+				notifications.POST("/channels", notificationHandler.CreateChannel)
+				notifications.PUT("/channels/:id", notificationHandler.UpdateChannel)
+				notifications.DELETE("/channels/:id", notificationHandler.DeleteChannel)
+				notifications.POST("/channels/:id/test", notificationHandler.TestChannel)
+			}
+
+			// Slack accounts linked with /k8s-agent link
+			slack := protected.Group("/integrations/slack")
+			{
+				slack.POST("/link", slackHandler.LinkSlackAccount)
+				slack.GET("/accounts", slackHandler.GetSlackAccounts)
+				slack.DELETE("/accounts/:id", slackHandler.DeleteSlackAccount)
+			}
+
+			// AI Agent routes
+			agent := protected.Group("/agent")
+			{
+				agent.POST("/query", llmLimiter.Handler(), agentHandler.QueryAgent)
+				agent.GET("/models", agentHandler.GetModels)
+				agent.POST("/context", agentHandler.SetContext)
+				agent.GET("/context", agentHandler.GetContext)
+				agent.DELETE("/context", agentHandler.ClearContext)
+				agent.POST("/deploy", agentHandler.DeployStack)
+				agent.POST("/deployments/:id/retry", agentHandler.RetryDeployment)
+				agent.POST("/deployments/:id/abort", agentHandler.AbortDeployment)
+				agent.GET("/deployments/locks", agentHandler.GetDeploymentLocks)
+				agent.GET("/deployments/:id", agentHandler.GetDeployment)
+				agent.GET("/deployments/:id/steps", agentHandler.GetDeploymentSteps)
+				agent.GET("/deployments/:id/sbom", agentHandler.GetDeploymentSBOM)
+				agent.DELETE("/deployments/:id", agentHandler.UninstallDeployment)
+				agent.GET("/deployments/:id/runbook", agentHandler.GetRunbook)
+				agent.GET("/deployments/:id/runbook/versions", agentHandler.GetRunbookVersions)
+				agent.PUT("/deployments/:id/runbook", agentHandler.UpdateRunbook)
+				agent.POST("/deployments/:id/runbook/regenerate", llmLimiter.Handler(), agentHandler.RegenerateRunbook)
+				agent.GET("/plans/schema", agentHandler.GetPlanSchema)
+				agent.POST("/plans/:id/test", agentHandler.TestPlan)
+				agent.POST("/plans/:id/preflight", agentHandler.PreflightPlan)
+				agent.POST("/plans/:id/simulate", agentHandler.SimulatePlan)
+				agent.POST("/plans/:id/licenses", agentHandler.CheckPlanLicenses)
+				agent.POST("/plans/:id/security-scan", agentHandler.ScanPlanSecurity)
+				agent.GET("/plans/:id/change-request", agentHandler.GetChangeRequest)
+				agent.GET("/plans/:id/terraform", agentHandler.GetTerraformExport)
+				agent.GET("/plans/:id/values-diff", agentHandler.GetPlanValuesDiff)
+				agent.GET("/plans/:id/cost", agentHandler.GetPlanCost)
+				agent.GET("/plans/:id/policies", agentHandler.GetPlanPolicies)
+				agent.GET("/plans/:id/manifests", agentHandler.GetPlanManifests)
+				agent.PATCH("/plans/:id", agentHandler.EditPlan)
+				agent.GET("/plans/:id/edits", agentHandler.GetPlanEdits)
+				agent.GET("/plans/:id/overlays/:environment", agentHandler.GetPlanOverlay)
+				agent.PUT("/plans/:id/overlays/:environment", agentHandler.SetPlanOverlay)
+				agent.DELETE("/plans/:id/overlays/:environment", agentHandler.DeletePlanOverlay)
+				agent.POST("/dashboards/generate", llmLimiter.Handler(), agentHandler.GenerateDashboard)
+				agent.POST("/promql", llmLimiter.Handler(), agentHandler.GeneratePromQL)
+				agent.POST("/alerts/generate", llmLimiter.Handler(), agentHandler.GenerateAlertRules)
+				agent.POST("/troubleshoot", llmLimiter.Handler(), agentHandler.Troubleshoot)
+				agent.GET("/queries", agentHandler.GetQueryHistory)
+				agent.GET("/queries/similar", agentHandler.GetSimilarQueries)
+				agent.POST("/queries/:id/feedback", agentHandler.RateQuery)
+				agent.GET("/deployments", agentHandler.GetDeploymentHistory)
+				agent.GET("/deployments/stats", agentHandler.GetDeploymentStats)
+				agent.POST("/schedules", agentHandler.CreateSchedule)
+				agent.GET("/schedules", agentHandler.GetSchedules)
+				agent.POST("/schedules/:id/pause", agentHandler.PauseSchedule)
+				agent.POST("/schedules/:id/resume", agentHandler.ResumeSchedule)
+				agent.POST("/schedules/:id/cancel", agentHandler.CancelSchedule)
+			}
+			// Runbook knowledge base agent queries are grounded in
+			knowledge := protected.Group("/knowledge")
+			{
+				knowledge.POST("/documents", agentHandler.UploadKnowledgeDocument)
+				knowledge.GET("/documents", agentHandler.GetKnowledgeDocuments)
+				knowledge.DELETE("/documents/:id", agentHandler.DeleteKnowledgeDocument)
+				knowledge.POST("/search", agentHandler.SearchKnowledge)
+			}
+			planReview := protected.Group("/agent/plans")
+			planReview.Use(middleware.OrganizationMiddleware(db, models.RoleAdmin, models.RoleOperator))
+			{
+				planReview.GET("/pending", agentHandler.GetPendingPlans)
+				planReview.POST("/:id/approve", agentHandler.ApprovePlan)
+				planReview.POST("/:id/reject", agentHandler.RejectPlan)
+			}
+
+			// Organization routes
+			protected.POST("/org", organizationHandler.CreateOrganization)
+			org := protected.Group("/org")
+			org.Use(middleware.OrganizationMiddleware(db))
+			{
+				org.GET("", organizationHandler.GetOrganization)
+				org.GET("/value-policies", organizationHandler.GetValuePolicies)
+				org.GET("/value-overlays", organizationHandler.GetValueOverlays)
+				org.GET("/license-policy", organizationHandler.GetLicensePolicy)
+				org.GET("/security-policy", organizationHandler.GetSecurityPolicy)
+				org.GET("/ingress-policy", organizationHandler.GetIngressPolicy)
+				org.GET("/chart-policy", organizationHandler.GetChartPolicy)
+				org.GET("/policies", organizationHandler.GetPolicies)
+				org.GET("/chart-rules", organizationHandler.GetChartRules)
+			}
+			orgAdmin := protected.Group("/org")
+			orgAdmin.Use(middleware.OrganizationMiddleware(db, models.RoleAdmin))
+			{
+				orgAdmin.POST("/members", organizationHandler.AddMember)
+				orgAdmin.PATCH("/members/:id", organizationHandler.UpdateMember)
+				orgAdmin.PUT("/value-policies", organizationHandler.SetDefaultValuePolicy)
+				orgAdmin.PUT("/value-policies/clusters/:cluster_id", organizationHandler.SetClusterValuePolicy)
+				orgAdmin.DELETE("/value-policies/clusters/:cluster_id", organizationHandler.DeleteClusterValuePolicy)
+				orgAdmin.PUT("/value-overlays/:environment", organizationHandler.SetValueOverlay)
+				orgAdmin.DELETE("/value-overlays/:environment", organizationHandler.DeleteValueOverlay)
+				orgAdmin.PUT("/license-policy", organizationHandler.SetLicensePolicy)
+				orgAdmin.PUT("/security-policy", organizationHandler.SetSecurityPolicy)
+				orgAdmin.PUT("/ingress-policy", organizationHandler.SetIngressPolicy)
+				orgAdmin.PUT("/chart-policy", organizationHandler.SetChartPolicy)
+				orgAdmin.PUT("/policies/:name", organizationHandler.SetPolicy)
+				orgAdmin.DELETE("/policies/:name", organizationHandler.DeletePolicy)
+				orgAdmin.POST("/chart-rules", organizationHandler.CreateChartRule)
+				orgAdmin.DELETE("/chart-rules/:id", organizationHandler.DeleteChartRule)
+				orgAdmin.GET("/config", organizationHandler.ExportConfig)
+				orgAdmin.POST("/config/apply", organizationHandler.ApplyConfig)
+				orgAdmin.GET("/audit-log", organizationHandler.GetAuditLog)
+			}
+
+			// Admin routes
+			admin := protected.Group("/admin")
+			admin.Use(middleware.AdminMiddleware(db, cfg.Admin.Emails))
+			{
+				admin.GET("/analytics/deployments", analyticsHandler.GetDeploymentAnalytics)
+				admin.GET("/analytics/failures", analyticsHandler.GetFailureClusters)
+				admin.GET("/known-issues", analyticsHandler.GetKnownIssues)
+				admin.POST("/known-issues", analyticsHandler.CreateKnownIssue)
+				admin.PUT("/known-issues/:id", analyticsHandler.UpdateKnownIssue)
+				admin.DELETE("/known-issues/:id", analyticsHandler.DeleteKnownIssue)
+				admin.GET("/overview", adminHandler.GetOverview)
+				admin.GET("/llm-spend", adminHandler.GetLLMSpend)
+				admin.GET("/error-rates", adminHandler.GetErrorRates)
+				admin.GET("/answer-feedback", adminHandler.GetAnswerFeedback)
+				admin.GET("/users", adminHandler.ListUsers)
+				admin.POST("/users/:id/deactivate", adminHandler.DeactivateUser)
+				admin.POST("/users/:id/reactivate", adminHandler.ReactivateUser)
+				admin.POST("/clusters/refresh", adminHandler.RefreshClusterStatuses)
+				admin.GET("/workers", workerHandler.GetWorkers)
+			}
+		}
+	}
+
+	return router
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Formats of generated alerting rules
+const (
+	// AlertFormatPrometheusRule renders PrometheusRule objects for the Prometheus Operator
+	AlertFormatPrometheusRule = "prometheus_rule"
+	// AlertFormatGrafana renders a ConfigMap of Grafana alert rules, loaded by
+	// the alerts sidecar of the Grafana chart
+	AlertFormatGrafana = "grafana"
+)
+
+// AlertRuleGeneratorService turns SLOs described in English into alerting
+// rules for a deployed stack
+type AlertRuleGeneratorService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewAlertRuleGeneratorService creates a new alert rule generator service
+func NewAlertRuleGeneratorService(aiAgent *agent.AIAgent) *AlertRuleGeneratorService {
+	return &AlertRuleGeneratorService{
+		aiAgent: aiAgent,
+	}
+}
+
+// GeneratedAlertRule is an alerting rule produced by the model for an SLO
+type GeneratedAlertRule struct {
+	Alert string `json:"alert"`
+	// Expr is the PromQL condition, the alert fires while it returns series
+	Expr        string `json:"expr"`
+	For         string `json:"for"`
+	Severity    string `json:"severity"`
+	Summary     string `json:"summary"`
+	Description string `json:"description"`
+	// SLO is the objective the rule guards
+	SLO string `json:"slo"`
+	// Valid reports whether Prometheus accepted Expr, Error holds its reason otherwise
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	// Firing reports whether Expr returns series now, so the alert would fire
+	Firing bool `json:"firing"`
+}
+
+// GeneratedAlertRules are the alerting rules of a stack with their rendered manifest
+type GeneratedAlertRules struct {
+	Name        string               `json:"name"`
+	Namespace   string               `json:"namespace"`
+	Format      string               `json:"format"`
+	Explanation string               `json:"explanation"`
+	Rules       []GeneratedAlertRule `json:"rules"`
+	// Validated reports whether the rules' PromQL was checked against Prometheus
+	Validated bool   `json:"validated"`
+	Manifest  string `json:"manifest"`
+}
+
+// Valid reports whether every rule was validated and accepted by Prometheus
+func (g *GeneratedAlertRules) Valid() bool {
+	if !g.Validated {
+		return false
+	}
+	for _, rule := range g.Rules {
+		if !rule.Valid {
+			return false
+		}
+	}
+	return true
+}
+
+const alertRulesSystemPrompt = `You are a site reliability engineer. Write Prometheus alerting rules for a stack deployed on Kubernetes, one or more rules for each service level objective (SLO) the user describes.
+
+Rules:
+- Respond with JSON only: {"explanation": "<two or three sentences>", "rules": [{"alert": "<CamelCase name>", "expr": "<PromQL>", "for": "<duration like 5m>", "severity": "warning" or "critical", "summary": "<one line>", "description": "<what is wrong and what to check>", "slo": "<the SLO the rule guards>"}]}.
+- expr is the full alert condition including its threshold, e.g. sum(rate(http_requests_total{code=~"5.."}[5m])) / sum(rate(http_requests_total[5m])) > 0.01.
+- Scope expressions to the stack's namespaces and releases with label matchers.
+- Use metrics exposed by kube-state-metrics, node-exporter, cAdvisor and the stack's own exporters.
+- Use rate() or increase() over counters, never raw counter values.
+- Prefer multi-window burn rate alerts for availability and latency objectives: critical for fast burn, warning for slow burn.`
+
+// Generate asks the model for alerting rules guarding the SLOs of the stack
+// deployed by plan, rendered in format into the namespace
+func (s *AlertRuleGeneratorService) Generate(ctx context.Context, plan *agent.DeploymentPlan, slos []string, clusterInfo, namespace, format string) (*GeneratedAlertRules, error) {
+	var userMessage strings.Builder
+	fmt.Fprintf(&userMessage, "Stack: %s\n", plan.Name)
+	for _, chart := range plan.Charts {
+		fmt.Fprintf(&userMessage, "- chart %s %s, release %s in namespace %s\n", chart.Name, chart.Version, chart.ReleaseName, chart.Namespace)
+	}
+	userMessage.WriteString("\nService level objectives:\n")
+	for _, slo := range slos {
+		fmt.Fprintf(&userMessage, "- %s\n", slo)
+	}
+	if clusterInfo != "" {
+		fmt.Fprintf(&userMessage, "\nCluster Information:\n%s", clusterInfo)
+	}
+
+	response, err := s.aiAgent.Complete(ctx, alertRulesSystemPrompt, userMessage.String())
+	if err != nil {
+		return nil, err
+	}
+
+	block := agent.ExtractJSONBlock(response)
+	if block == "" {
+		return nil, fmt.Errorf("model response did not contain alerting rules")
+	}
+
+	var generated GeneratedAlertRules
+	if err := json.Unmarshal([]byte(block), &generated); err != nil {
+		return nil, fmt.Errorf("model returned invalid alerting rules JSON: %w", err)
+	}
+	generated.Name = sanitizeName(plan.Name) + "-slo-alerts"
+	generated.Namespace = namespace
+	generated.Format = format
+	generated.Validated, generated.Manifest = false, ""
+
+	rules := generated.Rules[:0]
+	for _, rule := range generated.Rules {
+		rule.Expr = strings.TrimSpace(rule.Expr)
+		if rule.Alert == "" || rule.Expr == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(rule.For); err != nil {
+			rule.For = "5m"
+		}
+		if rule.Severity != "critical" {
+			rule.Severity = "warning"
+		}
+		rule.Valid, rule.Error, rule.Firing = false, "", false
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("model returned no alerting rules")
+	}
+	generated.Rules = rules
+
+	return &generated, nil
+}
+
+// Validate runs the expression of every rule against Prometheus. Expressions
+// Prometheus rejects are marked invalid with its error.
+func (s *AlertRuleGeneratorService) Validate(ctx context.Context, prometheus *PrometheusClient, generated *GeneratedAlertRules) error {
+	now := time.Now()
+	for i := range generated.Rules {
+		rule := &generated.Rules[i]
+		result, err := prometheus.Query(ctx, rule.Expr, now)
+		if apiErr, ok := err.(*PrometheusAPIError); ok {
+			rule.Error = apiErr.Error()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var series []json.RawMessage
+		if err := json.Unmarshal(result.Result, &series); err == nil {
+			rule.Firing = len(series) > 0
+		}
+		rule.Valid = true
+	}
+	generated.Validated = true
+	return nil
+}
+
+// Render renders the manifest of the rules in their format. labels are added
+// to the PrometheusRule so the Prometheus Operator's rule selector matches it;
+// datasourceUID is the Prometheus datasource Grafana rules query.
+func (s *AlertRuleGeneratorService) Render(generated *GeneratedAlertRules, labels map[string]string, datasourceUID string) error {
+	var manifest map[string]interface{}
+	var err error
+	switch generated.Format {
+	case AlertFormatGrafana:
+		manifest, err = grafanaAlertsConfigMap(generated, datasourceUID)
+	default:
+		manifest = prometheusRule(generated, labels)
+	}
+	if err != nil {
+		return err
+	}
+
+	encoded, err := yaml.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode alerting rules: %w", err)
+	}
+	generated.Manifest = string(encoded)
+	return nil
+}
+
+// prometheusRule renders the rules as a monitoring.coreos.com/v1 PrometheusRule
+func prometheusRule(generated *GeneratedAlertRules, labels map[string]string) map[string]interface{} {
+	rules := make([]interface{}, 0, len(generated.Rules))
+	for _, rule := range generated.Rules {
+		rules = append(rules, map[string]interface{}{
+			"alert":  rule.Alert,
+			"expr":   rule.Expr,
+			"for":    rule.For,
+			"labels": map[string]interface{}{"severity": rule.Severity},
+			"annotations": map[string]interface{}{
+				"summary":     rule.Summary,
+				"description": rule.Description,
+				"slo":         rule.SLO,
+			},
+		})
+	}
+
+	metadataLabels := map[string]interface{}{"app.kubernetes.io/managed-by": "grafana-ai-agent-platform"}
+	for key, value := range labels {
+		metadataLabels[key] = value
+	}
+	return map[string]interface{}{
+		"apiVersion": "monitoring.coreos.com/v1",
+		"kind":       "PrometheusRule",
+		"metadata": map[string]interface{}{
+			"name":      generated.Name,
+			"namespace": generated.Namespace,
+			"labels":    metadataLabels,
+		},
+		"spec": map[string]interface{}{
+			"groups": []interface{}{
+				map[string]interface{}{"name": generated.Name, "rules": rules},
+			},
+		},
+	}
+}
+
+// grafanaAlertsConfigMap renders the rules as a Grafana alerting provisioning
+// file in a ConfigMap labeled for the alerts sidecar of the Grafana chart
+func grafanaAlertsConfigMap(generated *GeneratedAlertRules, datasourceUID string) (map[string]interface{}, error) {
+	rules := make([]interface{}, 0, len(generated.Rules))
+	for i, rule := range generated.Rules {
+		rules = append(rules, map[string]interface{}{
+			// Grafana limits rule UIDs to 40 characters
+			"uid":       fmt.Sprintf("%.36s-%d", generated.Name, i+1),
+			"title":     rule.Alert,
+			"condition": "B",
+			"data": []interface{}{
+				map[string]interface{}{
+					"refId":             "A",
+					"relativeTimeRange": map[string]interface{}{"from": 600, "to": 0},
+					"datasourceUid":     datasourceUID,
+					"model":             map[string]interface{}{"refId": "A", "expr": rule.Expr, "instant": true},
+				},
+				// The expression filters to the series breaching the objective,
+				// any value it returns fires the alert
+				map[string]interface{}{
+					"refId":         "B",
+					"datasourceUid": "__expr__",
+					"model": map[string]interface{}{
+						"refId":      "B",
+						"type":       "threshold",
+						"expression": "A",
+						"conditions": []interface{}{
+							map[string]interface{}{"evaluator": map[string]interface{}{"type": "gt", "params": []interface{}{-1e308}}},
+						},
+					},
+				},
+			},
+			"noDataState":  "OK",
+			"execErrState": "Error",
+			"for":          rule.For,
+			"labels":       map[string]interface{}{"severity": rule.Severity},
+			"annotations": map[string]interface{}{
+				"summary":     rule.Summary,
+				"description": rule.Description,
+				"slo":         rule.SLO,
+			},
+		})
+	}
+
+	provisioning, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": 1,
+		"groups": []interface{}{
+			map[string]interface{}{
+				"orgId":    1,
+				"name":     generated.Name,
+				"folder":   "SLO Alerts",
+				"interval": "1m",
+				"rules":    rules,
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode Grafana alert rules: %w", err)
+	}
+
+	return map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name":      generated.Name,
+			"namespace": generated.Namespace,
+			"labels": map[string]interface{}{
+				"grafana_alert":                "1",
+				"app.kubernetes.io/managed-by": "grafana-ai-agent-platform",
+			},
+		},
+		"data": map[string]interface{}{
+			generated.Name + ".yaml": string(provisioning),
+		},
+	}, nil
+}
+
+// AlertRulesPlan wraps rendered alerting rules in a deployment plan applying
+// their manifest, so they go through the same review and deploy flow as stacks
+func AlertRulesPlan(generated *GeneratedAlertRules, stack string) *agent.DeploymentPlan {
+	prerequisite := "The Prometheus Operator's PrometheusRule CRD is installed, e.g. by kube-prometheus-stack"
+	if generated.Format == AlertFormatGrafana {
+		prerequisite = "Grafana runs the alerts sidecar watching the namespace, e.g. sidecar.alerts.enabled in the Grafana chart"
+	}
+	return &agent.DeploymentPlan{
+		ID:            fmt.Sprintf("plan-alerts-%d", time.Now().UnixNano()),
+		SchemaVersion: agent.PlanSchemaVersion,
+		Name:          fmt.Sprintf("Alerting rules for %s", stack),
+		Description:   generated.Explanation,
+		Steps: []agent.DeploymentStep{
+			{
+				ID:          "step-1",
+				Name:        fmt.Sprintf("Apply %s", generated.Name),
+				Description: fmt.Sprintf("Apply %d alerting rules guarding the SLOs of %s", len(generated.Rules), stack),
+				Manifest:    generated.Manifest,
+				Namespace:   generated.Namespace,
+				Status:      "pending",
+			},
+		},
+		Charts:        []agent.HelmChart{},
+		EstimatedTime: "1 minute",
+		Prerequisites: []string{prerequisite},
+		Risks:         []string{"New alerts may fire immediately and page on-call"},
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, so the auth middleware tells them from JWTs
+const APIKeyPrefix = "aik_"
+
+// apiKeyDisplayLength is how much of a key is kept to tell keys apart
+const apiKeyDisplayLength = 12
+
+// GenerateAPIKey returns a new random API key, the start of it that is
+// displayed, and the hash that is stored
+func GenerateAPIKey() (key, prefix, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key = APIKeyPrefix + hex.EncodeToString(secret)
+	return key, key[:apiKeyDisplayLength], HashAPIKey(key), nil
+}
+
+// HashAPIKey hashes an API key the way it is stored
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// SessionID identifies the session of a login token or API key, the hash of
+// the token, so the token itself is never stored
+func SessionID(token string) string {
+	return HashAPIKey(token)
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Autopilot remediations
+const (
+	AutopilotRestart        = "restart"
+	AutopilotIncreaseLimits = "increase_limits"
+	AutopilotNone           = "none"
+)
+
+// defaultAutopilotCooldown is how long a remediated workload is left alone
+// when the policy doesn't say
+const defaultAutopilotCooldown = 30 * time.Minute
+
+// AutopilotRules are the watch alerts autopilot remediates
+var AutopilotRules = []string{RuleOOMKilled, RuleImagePullBackOff}
+
+// AutopilotPolicy is a cluster's opt-in to automatic remediation and the
+// guard rails of what it may do
+type AutopilotPolicy struct {
+	Enabled bool `json:"enabled"`
+	// Actions are the remediations that may be applied: restart, increase_limits
+	Actions []string `json:"actions"`
+	// MaxMemoryLimit and MaxCPULimit cap the limits increase_limits may set,
+	// e.g. "2Gi" and "2". A resource without a cap is never increased.
+	MaxMemoryLimit string `json:"max_memory_limit,omitempty"`
+	MaxCPULimit    string `json:"max_cpu_limit,omitempty"`
+	// Namespaces limits autopilot to these namespaces, empty is all of them
+	Namespaces []string `json:"namespaces,omitempty"`
+	// CooldownMinutes is how long a workload is left alone after an action,
+	// 30 by default
+	CooldownMinutes int `json:"cooldown_minutes,omitempty"`
+}
+
+// Validate checks the policy's actions and caps
+func (p *AutopilotPolicy) Validate() error {
+	seen := make(map[string]bool, len(p.Actions))
+	actions := []string{}
+	for _, action := range p.Actions {
+		action = strings.ToLower(strings.TrimSpace(action))
+		if action != AutopilotRestart && action != AutopilotIncreaseLimits {
+			return fmt.Errorf("unknown action %q, use restart or increase_limits", action)
+		}
+		if !seen[action] {
+			seen[action] = true
+			actions = append(actions, action)
+		}
+	}
+	p.Actions = actions
+	if p.Enabled && len(p.Actions) == 0 {
+		return fmt.Errorf("an enabled autopilot needs at least one action")
+	}
+
+	for name, limit := range map[string]string{"max_memory_limit": p.MaxMemoryLimit, "max_cpu_limit": p.MaxCPULimit} {
+		if limit == "" {
+			continue
+		}
+		if quantity, err := resource.ParseQuantity(limit); err != nil || quantity.Sign() <= 0 {
+			return fmt.Errorf("%s %q is not a positive quantity", name, limit)
+		}
+	}
+	if seen[AutopilotIncreaseLimits] && p.MaxMemoryLimit == "" && p.MaxCPULimit == "" {
+		return fmt.Errorf("increase_limits needs max_memory_limit or max_cpu_limit")
+	}
+	if p.CooldownMinutes < 0 {
+		return fmt.Errorf("cooldown_minutes can't be negative")
+	}
+	return nil
+}
+
+// Covers reports whether autopilot is on for a namespace
+func (p *AutopilotPolicy) Covers(namespace string) bool {
+	if p == nil || !p.Enabled {
+		return false
+	}
+	if len(p.Namespaces) == 0 {
+		return true
+	}
+	for _, covered := range p.Namespaces {
+		if covered == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// Cooldown returns how long a remediated workload is left alone
+func (p *AutopilotPolicy) Cooldown() time.Duration {
+	if p.CooldownMinutes == 0 {
+		return defaultAutopilotCooldown
+	}
+	return time.Duration(p.CooldownMinutes) * time.Minute
+}
+
+// allows reports whether the policy whitelists an action
+func (p *AutopilotPolicy) allows(action string) bool {
+	for _, allowed := range p.Actions {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// limitCap returns the cap of a resource's limit, if the policy sets one
+func (p *AutopilotPolicy) limitCap(name corev1.ResourceName) (resource.Quantity, bool) {
+	limit := ""
+	switch name {
+	case corev1.ResourceMemory:
+		limit = p.MaxMemoryLimit
+	case corev1.ResourceCPU:
+		limit = p.MaxCPULimit
+	}
+	if limit == "" {
+		return resource.Quantity{}, false
+	}
+	quantity, err := resource.ParseQuantity(limit)
+	return quantity, err == nil
+}
+
+// AutopilotTarget is the workload running the pod an alert fired for
+type AutopilotTarget struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Pod       string `json:"pod"`
+}
+
+// Resource names the workload like audit log entries do
+func (t *AutopilotTarget) Resource() string {
+	return fmt.Sprintf("%s/%s/%s", t.Kind, t.Namespace, t.Name)
+}
+
+// AutopilotDecision is the remediation the model chose, after the policy's
+// guard rails. A rejected decision is recorded but not applied.
+type AutopilotDecision struct {
+	Rule   string `json:"rule"`
+	Action string `json:"action"`
+	// Container and Limits are set by increase_limits; Limits are capped by the policy
+	Container      string            `json:"container,omitempty"`
+	Limits         map[string]string `json:"limits,omitempty"`
+	PreviousLimits map[string]string `json:"previous_limits,omitempty"`
+	Reason         string            `json:"reason"`
+	// Rejected says why the model's remediation wasn't applied
+	Rejected string `json:"rejected,omitempty"`
+}
+
+// AutopilotService chooses and applies remediations for failing workloads of
+// clusters that opted into autopilot
+type AutopilotService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewAutopilotService creates a new autopilot service
+func NewAutopilotService(aiAgent *agent.AIAgent) *AutopilotService {
+	return &AutopilotService{
+		aiAgent: aiAgent,
+	}
+}
+
+const autopilotSystemPrompt = `You are a Kubernetes autopilot remediating a failing workload without a human in the loop. You are given the alert that fired, the pod's container states and resources, and the remediations you may apply.
+
+Respond with JSON only:
+{"action": "restart|increase_limits|none", "container": "<container name, for increase_limits>",
+ "limits": {"memory": "<new memory limit>", "cpu": "<new cpu limit>"}, "reason": "<one sentence>"}
+
+Rules:
+- Only choose an action from the allowed actions, otherwise answer none.
+- increase_limits is for containers killed for exceeding their memory limit; raise only the limits that were exceeded, at most to the caps, and usually by 25-100%.
+- restart only helps transient failures, e.g. an image pull that failed while the registry was unavailable. Answer none when the image name, tag or pull credentials are wrong.
+- Answer none when the evidence doesn't show the remediation will help.`
+
+// autopilotContainer describes a container of the failing pod to the model
+type autopilotContainer struct {
+	Name       string            `json:"name"`
+	Image      string            `json:"image"`
+	State      string            `json:"state,omitempty"`
+	LastReason string            `json:"last_termination_reason,omitempty"`
+	Restarts   int32             `json:"restarts"`
+	Requests   map[string]string `json:"requests,omitempty"`
+	Limits     map[string]string `json:"limits,omitempty"`
+}
+
+// Target resolves the workload running the pod an alert fired for
+func (s *AutopilotService) Target(ctx context.Context, client *kubernetes.KubernetesClient, event Event) (*AutopilotTarget, *corev1.Pod, error) {
+	parts := strings.SplitN(event.Resource, "/", 3)
+	if len(parts) != 3 || parts[0] != "pod" {
+		return nil, nil, fmt.Errorf("alert resource %q is not a pod", event.Resource)
+	}
+	pod, kind, name, err := client.PodWorkload(ctx, parts[1], parts[2])
+	if err != nil {
+		return nil, nil, err
+	}
+	return &AutopilotTarget{Kind: kind, Namespace: parts[1], Name: name, Pod: parts[2]}, pod, nil
+}
+
+// Decide asks the model for a remediation of an alert and checks it against
+// the policy. A remediation the policy doesn't allow comes back Rejected.
+func (s *AutopilotService) Decide(ctx context.Context, event Event, target *AutopilotTarget, pod *corev1.Pod, policy *AutopilotPolicy) (*AutopilotDecision, error) {
+	input := map[string]interface{}{
+		"alert":           map[string]string{"rule": event.Rule, "title": event.Title, "message": event.Message},
+		"workload":        target,
+		"containers":      autopilotContainers(pod),
+		"allowed_actions": policy.Actions,
+		"caps":            map[string]string{"memory": policy.MaxMemoryLimit, "cpu": policy.MaxCPULimit},
+	}
+	encoded, err := json.MarshalIndent(input, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	response, err := s.aiAgent.Complete(ctx, autopilotSystemPrompt, string(encoded))
+	if err != nil {
+		return nil, err
+	}
+	decision := &AutopilotDecision{}
+	if err := json.Unmarshal([]byte(agent.ExtractJSONBlock(response)), decision); err != nil {
+		return nil, fmt.Errorf("failed to parse remediation: %w", err)
+	}
+	decision.Rule = event.Rule
+	decision.Action = strings.ToLower(strings.TrimSpace(decision.Action))
+	if decision.Action == "" {
+		decision.Action = AutopilotNone
+	}
+	if err := guardDecision(decision, pod, policy); err != nil {
+		decision.Rejected = err.Error()
+	}
+	return decision, nil
+}
+
+// Apply runs a decision's remediation on the target workload
+func (s *AutopilotService) Apply(ctx context.Context, client *kubernetes.KubernetesClient, target *AutopilotTarget, decision *AutopilotDecision) error {
+	switch decision.Action {
+	case AutopilotRestart:
+		_, err := client.RestartWorkload(ctx, target.Kind, target.Namespace, target.Name)
+		return err
+	case AutopilotIncreaseLimits:
+		limits := make(corev1.ResourceList, len(decision.Limits))
+		for name, limit := range decision.Limits {
+			limits[corev1.ResourceName(name)] = resource.MustParse(limit)
+		}
+		previous, err := client.SetContainerLimits(ctx, target.Kind, target.Namespace, target.Name, decision.Container, limits)
+		decision.PreviousLimits = resourceStrings(previous)
+		return err
+	}
+	return nil
+}
+
+// guardDecision checks a remediation against the policy's whitelist and caps.
+// Limits above a cap are lowered to it; limits that wouldn't increase are
+// dropped.
+func guardDecision(decision *AutopilotDecision, pod *corev1.Pod, policy *AutopilotPolicy) error {
+	switch decision.Action {
+	case AutopilotNone:
+		return nil
+	case AutopilotRestart, AutopilotIncreaseLimits:
+		if !policy.allows(decision.Action) {
+			return fmt.Errorf("%s is not allowed by the cluster's autopilot policy", decision.Action)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", decision.Action)
+	}
+	if decision.Action == AutopilotRestart {
+		decision.Container, decision.Limits = "", nil
+		return nil
+	}
+
+	var container *corev1.Container
+	for _, containers := range [][]corev1.Container{pod.Spec.Containers, pod.Spec.InitContainers} {
+		for i := range containers {
+			if containers[i].Name == decision.Container {
+				container = &containers[i]
+			}
+		}
+	}
+	if container == nil {
+		return fmt.Errorf("pod %s has no container %q", pod.Name, decision.Container)
+	}
+
+	limits := make(map[string]string)
+	var skipped []string
+	for name, proposed := range decision.Limits {
+		resourceName := corev1.ResourceName(strings.ToLower(name))
+		limitCap, capped := policy.limitCap(resourceName)
+		if !capped {
+			skipped = append(skipped, fmt.Sprintf("%s has no cap", name))
+			continue
+		}
+		quantity, err := resource.ParseQuantity(proposed)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s limit %q is not a quantity", name, proposed))
+			continue
+		}
+		if quantity.Cmp(limitCap) > 0 {
+			quantity = limitCap
+		}
+		if current, ok := container.Resources.Limits[resourceName]; ok && quantity.Cmp(current) <= 0 {
+			skipped = append(skipped, fmt.Sprintf("%s limit %s is already at or above %s", name, current.String(), quantity.String()))
+			continue
+		}
+		limits[string(resourceName)] = quantity.String()
+	}
+	if len(limits) == 0 {
+		sort.Strings(skipped)
+		return fmt.Errorf("no limit can be increased: %s", strings.Join(skipped, "; "))
+	}
+	decision.Limits = limits
+	return nil
+}
+
+// autopilotContainers describes the containers of a pod with their state
+func autopilotContainers(pod *corev1.Pod) []autopilotContainer {
+	statuses := make(map[string]corev1.ContainerStatus)
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		statuses[status.Name] = status
+	}
+
+	var containers []autopilotContainer
+	for _, spec := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		container := autopilotContainer{
+			Name:     spec.Name,
+			Image:    spec.Image,
+			Requests: resourceStrings(spec.Resources.Requests),
+			Limits:   resourceStrings(spec.Resources.Limits),
+		}
+		if status, ok := statuses[spec.Name]; ok {
+			container.Restarts = status.RestartCount
+			switch {
+			case status.State.Waiting != nil:
+				container.State = "waiting: " + status.State.Waiting.Reason + " " + status.State.Waiting.Message
+			case status.State.Terminated != nil:
+				container.State = "terminated: " + status.State.Terminated.Reason
+			case status.State.Running != nil:
+				container.State = "running"
+			}
+			if status.LastTerminationState.Terminated != nil {
+				container.LastReason = status.LastTerminationState.Terminated.Reason
+			}
+		}
+		containers = append(containers, container)
+	}
+	return containers
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// UsageSampleInterval is how often a cluster is snapshotted while nothing
+// drifts, so its resource usage can be forecast
+const UsageSampleInterval = 6 * time.Hour
+
+// ForecastHorizon is how far ahead forecasts warn of exhausted capacity
+const ForecastHorizon = 90 * 24 * time.Hour
+
+// minForecastSpan is how much time the samples of a forecast must cover
+const minForecastSpan = 24 * time.Hour
+
+// Forecast trends
+const (
+	TrendGrowing   = "growing"
+	TrendStable    = "stable"
+	TrendShrinking = "shrinking"
+	TrendUnknown   = "unknown"
+)
+
+// CapacityForecast projects when the requests of a cluster's pods will exceed
+// its allocatable CPU, memory and ephemeral storage, from the usage of its
+// snapshots
+type CapacityForecast struct {
+	ClusterID uint               `json:"cluster_id"`
+	From      time.Time          `json:"from"`
+	To        time.Time          `json:"to"`
+	Samples   int                `json:"samples"`
+	Resources []ResourceForecast `json:"resources"`
+	Warnings  []string           `json:"warnings"`
+	// PlanWarnings are how a plan's requests bring the exhaustion forward
+	PlanWarnings []string `json:"plan_warnings,omitempty"`
+}
+
+// ResourceForecast is the trend of the requests of one resource. CPU is in
+// cores, memory and storage in bytes.
+type ResourceForecast struct {
+	Resource    string  `json:"resource"` // cpu, memory or storage
+	Capacity    float64 `json:"capacity"`
+	Requested   float64 `json:"requested"`
+	Utilization float64 `json:"utilization"` // percent of capacity
+	// GrowthPerDay is the slope of the least-squares line through the samples
+	GrowthPerDay float64 `json:"growth_per_day"`
+	Trend        string  `json:"trend"` // growing, stable, shrinking or unknown
+	// ExhaustedAt is when the requests reach capacity at that growth, unset
+	// unless they grow
+	ExhaustedAt *time.Time `json:"exhausted_at,omitempty"`
+	DaysLeft    *float64   `json:"days_left,omitempty"`
+}
+
+// CapacitySample is what a cluster's pods requested at a point in time, and
+// what its nodes had allocatable
+type CapacitySample struct {
+	At        time.Time
+	Requested map[string]float64
+	Capacity  map[string]float64
+}
+
+// forecastResources are the resources forecast, with how they're named in warnings
+var forecastResources = []struct {
+	name  string
+	label string
+}{
+	{"cpu", "CPU"},
+	{"memory", "memory"},
+	{"storage", "ephemeral storage"},
+}
+
+// NewCapacitySample reads the usage and capacity of an analysis. Analyses
+// taken before usage was recorded have none.
+func NewCapacitySample(at time.Time, analysis *agent.ClusterAnalysis) (CapacitySample, bool) {
+	if analysis.Usage == nil {
+		return CapacitySample{}, false
+	}
+	return CapacitySample{
+		At: at,
+		Requested: map[string]float64{
+			"cpu":     quantityAmount(analysis.Usage.CPU),
+			"memory":  quantityAmount(analysis.Usage.Memory),
+			"storage": quantityAmount(analysis.Usage.Storage),
+		},
+		Capacity: map[string]float64{
+			"cpu":     quantityAmount(analysis.Resources.AvailableCPU),
+			"memory":  quantityAmount(analysis.Resources.AvailableMemory),
+			"storage": quantityAmount(analysis.Resources.AvailableStorage),
+		},
+	}, true
+}
+
+// ForecastCapacity fits a line through the requests of each resource, oldest
+// sample first, and projects when it crosses the capacity of the latest
+// sample. Samples covering less than a day can't show a trend.
+func ForecastCapacity(clusterID uint, samples []CapacitySample) *CapacityForecast {
+	forecast := &CapacityForecast{ClusterID: clusterID, Samples: len(samples), Resources: []ResourceForecast{}, Warnings: []string{}}
+	if len(samples) == 0 {
+		forecast.Warnings = append(forecast.Warnings, "No usage has been recorded for this cluster yet, analyze it to take a sample")
+		return forecast
+	}
+	first, latest := samples[0], samples[len(samples)-1]
+	forecast.From, forecast.To = first.At, latest.At
+	enough := latest.At.Sub(first.At) >= minForecastSpan
+	if !enough {
+		forecast.Warnings = append(forecast.Warnings, "Usage samples cover less than a day, analyze the cluster over a few days to forecast its capacity")
+	}
+
+	for _, r := range forecastResources {
+		rf := ResourceForecast{Resource: r.name, Capacity: latest.Capacity[r.name], Requested: latest.Requested[r.name], Trend: TrendUnknown}
+		if rf.Capacity > 0 {
+			rf.Utilization = math.Round(rf.Requested/rf.Capacity*1000) / 10
+		}
+		if enough {
+			rf.GrowthPerDay = growthPerDay(samples, r.name)
+			rf.Trend = trend(rf.GrowthPerDay, rf.Capacity)
+		}
+
+		if rf.Capacity > 0 && rf.Requested >= rf.Capacity {
+			days := 0.0
+			exhausted := latest.At
+			rf.DaysLeft, rf.ExhaustedAt = &days, &exhausted
+			forecast.Warnings = append(forecast.Warnings, fmt.Sprintf("Pods already request all of the cluster's allocatable %s", r.label))
+		} else if rf.Trend == TrendGrowing && rf.Capacity > 0 {
+			days := (rf.Capacity - rf.Requested) / rf.GrowthPerDay
+			exhausted := latest.At.Add(time.Duration(days * float64(24*time.Hour)))
+			rf.DaysLeft, rf.ExhaustedAt = &days, &exhausted
+			if days <= ForecastHorizon.Hours()/24 {
+				forecast.Warnings = append(forecast.Warnings, fmt.Sprintf("Pod requests of %s will exceed the cluster's capacity in %s, around %s", r.label, approxDuration(days), exhausted.Format(time.DateOnly)))
+			}
+		}
+		forecast.Resources = append(forecast.Resources, rf)
+	}
+	return forecast
+}
+
+// ForecastPlan warns when a plan's CPU and memory requests would exhaust the
+// cluster now or within the forecast horizon at the current growth
+func (f *CapacityForecast) ForecastPlan(impact agent.ResourceImpact) []string {
+	planned := map[string]float64{"cpu": quantityAmount(impact.CPU), "memory": quantityAmount(impact.Memory)}
+	var warnings []string
+	for _, rf := range f.Resources {
+		label := resourceLabel(rf.Resource)
+		extra := planned[rf.Resource]
+		if extra <= 0 || rf.Capacity <= 0 {
+			continue
+		}
+		left := rf.Capacity - rf.Requested - extra
+		if left <= 0 {
+			warnings = append(warnings, fmt.Sprintf("This plan will exceed the cluster's %s capacity: pods request %.0f%% of it and the plan adds %.0f%%", label, rf.Utilization, extra/rf.Capacity*100))
+			continue
+		}
+		if rf.Trend != TrendGrowing {
+			continue
+		}
+		if days := left / rf.GrowthPerDay; days <= ForecastHorizon.Hours()/24 {
+			warnings = append(warnings, fmt.Sprintf("This plan will exceed the cluster's %s capacity in %s at the current growth of requests", label, approxDuration(days)))
+		}
+	}
+	return warnings
+}
+
+// growthPerDay is the slope, per day, of the least-squares line through the
+// requests of a resource
+func growthPerDay(samples []CapacitySample, name string) float64 {
+	origin := samples[0].At
+	var sumX, sumY, sumXY, sumXX float64
+	for _, sample := range samples {
+		x := sample.At.Sub(origin).Hours() / 24
+		y := sample.Requested[name]
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// trend classifies growth; requests changing by less than 1% of capacity a
+// month are stable
+func trend(growthPerDay, capacity float64) string {
+	switch {
+	case capacity <= 0:
+		return TrendUnknown
+	case math.Abs(growthPerDay*30) < capacity*0.01:
+		return TrendStable
+	case growthPerDay > 0:
+		return TrendGrowing
+	default:
+		return TrendShrinking
+	}
+}
+
+// approxDuration words a number of days, e.g. ~3 weeks
+func approxDuration(days float64) string {
+	switch {
+	case days < 1:
+		return "less than a day"
+	case days < 1.5:
+		return "~1 day"
+	case days < 14:
+		return fmt.Sprintf("~%d days", int(math.Round(days)))
+	case days < 60:
+		return fmt.Sprintf("~%d weeks", int(math.Round(days/7)))
+	default:
+		return fmt.Sprintf("~%d months", int(math.Round(days/30)))
+	}
+}
+
+func resourceLabel(name string) string {
+	for _, r := range forecastResources {
+		if r.name == name {
+			return r.label
+		}
+	}
+	return name
+}
+
+// quantityAmount parses a Kubernetes quantity such as 3500m or 16Gi as cores
+// or bytes, or returns 0 when it doesn't parse
+func quantityAmount(value string) float64 {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0
+	}
+	return quantity.AsApproximateFloat64()
+}
@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	capiGroupVersion = "cluster.x-k8s.io/v1beta1"
+	// capiClusterNameLabel links machines to their cluster
+	capiClusterNameLabel = "cluster.x-k8s.io/cluster-name"
+)
+
+var (
+	capiClusterGVR = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "clusters"}
+	capiMachineGVR = schema.GroupVersionResource{Group: "cluster.x-k8s.io", Version: "v1beta1", Resource: "machines"}
+)
+
+// AnalyzeClusterAPI lists the workload clusters of a Cluster API management
+// cluster. It returns nil when the cluster doesn't serve the Cluster API.
+func (s *ClusterAnalyzerService) AnalyzeClusterAPI(ctx context.Context, kubeconfig string) (*agent.ClusterAPI, error) {
+	config, err := kubernetes.RESTConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubeconfig: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery client: %w", err)
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	return s.analyzeClusterAPI(ctx, discoveryClient, dynamicClient), nil
+}
+
+// analyzeClusterAPI summarizes the Cluster API Clusters, their control planes
+// and machines, when the cluster is a management cluster
+func (s *ClusterAnalyzerService) analyzeClusterAPI(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface) *agent.ClusterAPI {
+	if !groupVersionServed(discoveryClient, capiGroupVersion) {
+		return nil
+	}
+
+	capi := &agent.ClusterAPI{APIVersion: capiGroupVersion, Clusters: []agent.CAPICluster{}}
+	clusters, err := dynamicClient.Resource(capiClusterGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return capi
+	}
+
+	machinesByCluster := make(map[string][]unstructured.Unstructured)
+	if machines, err := dynamicClient.Resource(capiMachineGVR).List(ctx, metav1.ListOptions{}); err == nil {
+		for _, machine := range machines.Items {
+			key := machine.GetNamespace() + "/" + machine.GetLabels()[capiClusterNameLabel]
+			machinesByCluster[key] = append(machinesByCluster[key], machine)
+		}
+	}
+
+	for _, item := range clusters.Items {
+		cluster := summarizeCAPICluster(item, machinesByCluster[item.GetNamespace()+"/"+item.GetName()])
+		if desired, current := s.controlPlaneVersions(ctx, dynamicClient, item); desired != "" || current != "" {
+			if cluster.DesiredVersion == "" {
+				cluster.DesiredVersion = desired
+			}
+			cluster.ControlPlaneVersion = current
+		}
+		cluster.Upgrading = capiUpgrading(&cluster)
+		capi.Clusters = append(capi.Clusters, cluster)
+	}
+
+	sort.Slice(capi.Clusters, func(i, j int) bool {
+		if capi.Clusters[i].Namespace != capi.Clusters[j].Namespace {
+			return capi.Clusters[i].Namespace < capi.Clusters[j].Namespace
+		}
+		return capi.Clusters[i].Name < capi.Clusters[j].Name
+	})
+	return capi
+}
+
+// summarizeCAPICluster reads a Cluster's status and counts its machines per version
+func summarizeCAPICluster(item unstructured.Unstructured, machines []unstructured.Unstructured) agent.CAPICluster {
+	phase, _, _ := unstructured.NestedString(item.Object, "status", "phase")
+	if phase == "" {
+		phase = "Unknown"
+	}
+	infrastructureReady, _, _ := unstructured.NestedBool(item.Object, "status", "infrastructureReady")
+	controlPlaneReady, _, _ := unstructured.NestedBool(item.Object, "status", "controlPlaneReady")
+	infrastructureKind, _, _ := unstructured.NestedString(item.Object, "spec", "infrastructureRef", "kind")
+	controlPlaneKind, _, _ := unstructured.NestedString(item.Object, "spec", "controlPlaneRef", "kind")
+	// Clusters created from a ClusterClass declare their version in the topology
+	topologyVersion, _, _ := unstructured.NestedString(item.Object, "spec", "topology", "version")
+
+	cluster := agent.CAPICluster{
+		Name:                   item.GetName(),
+		Namespace:              item.GetNamespace(),
+		Phase:                  phase,
+		InfrastructureProvider: infrastructureKind,
+		ControlPlaneProvider:   controlPlaneKind,
+		InfrastructureReady:    infrastructureReady,
+		ControlPlaneReady:      controlPlaneReady,
+		DesiredVersion:         topologyVersion,
+		MachineVersions:        make(map[string]int),
+		Machines:               len(machines),
+	}
+
+	for _, machine := range machines {
+		if version, _, _ := unstructured.NestedString(machine.Object, "spec", "version"); version != "" {
+			cluster.MachineVersions[version]++
+		}
+		machinePhase, _, _ := unstructured.NestedString(machine.Object, "status", "phase")
+		_, hasNode, _ := unstructured.NestedMap(machine.Object, "status", "nodeRef")
+		if machinePhase == "Running" && hasNode {
+			cluster.ReadyMachines++
+		}
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(item.Object, "status", "conditions")
+	for _, entry := range conditions {
+		condition, ok := entry.(map[string]interface{})
+		if !ok || condition["status"] == "True" {
+			continue
+		}
+		text := fmt.Sprintf("%v", condition["type"])
+		if reason, ok := condition["reason"].(string); ok && reason != "" {
+			text += ": " + reason
+		}
+		cluster.Conditions = append(cluster.Conditions, text)
+	}
+	return cluster
+}
+
+// controlPlaneVersions reads the desired and running Kubernetes version from the
+// control plane object a Cluster references, e.g. a KubeadmControlPlane
+func (s *ClusterAnalyzerService) controlPlaneVersions(ctx context.Context, dynamicClient dynamic.Interface, cluster unstructured.Unstructured) (string, string) {
+	ref, found, _ := unstructured.NestedStringMap(cluster.Object, "spec", "controlPlaneRef")
+	if !found || ref["kind"] == "" || ref["name"] == "" {
+		return "", ""
+	}
+	gv, err := schema.ParseGroupVersion(ref["apiVersion"])
+	if err != nil {
+		return "", ""
+	}
+	namespace := ref["namespace"]
+	if namespace == "" {
+		namespace = cluster.GetNamespace()
+	}
+
+	// Control plane providers follow the lower-case plural naming convention
+	gvr := gv.WithResource(strings.ToLower(ref["kind"]) + "s")
+	controlPlane, err := dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, ref["name"], metav1.GetOptions{})
+	if err != nil {
+		return "", ""
+	}
+	desired, _, _ := unstructured.NestedString(controlPlane.Object, "spec", "version")
+	current, _, _ := unstructured.NestedString(controlPlane.Object, "status", "version")
+	return desired, current
+}
+
+// capiUpgrading reports whether a cluster is between Kubernetes versions: its
+// control plane or machines don't all run the desired version yet
+func capiUpgrading(cluster *agent.CAPICluster) bool {
+	if len(cluster.MachineVersions) > 1 {
+		return true
+	}
+	if cluster.DesiredVersion == "" {
+		return false
+	}
+	if cluster.ControlPlaneVersion != "" && cluster.ControlPlaneVersion != cluster.DesiredVersion {
+		return true
+	}
+	for version := range cluster.MachineVersions {
+		if version != cluster.DesiredVersion {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// ChangeRequestInfo describes who asked for a plan and where it will run
+type ChangeRequestInfo struct {
+	Query       string
+	Cluster     string
+	RequestedBy string
+	CreatedAt   time.Time
+}
+
+// ChangeRequest renders a plan as a Markdown change request for review outside
+// the platform. The license section is omitted when no report is given.
+func ChangeRequest(plan *agent.DeploymentPlan, info ChangeRequestInfo, licenses *LicenseReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Change request: %s\n\n", plan.Name)
+
+	fmt.Fprintf(&b, "- **Plan:** %s\n", plan.ID)
+	if info.Cluster != "" {
+		fmt.Fprintf(&b, "- **Cluster:** %s\n", info.Cluster)
+	}
+	if info.RequestedBy != "" {
+		fmt.Fprintf(&b, "- **Requested by:** %s\n", info.RequestedBy)
+	}
+	if !info.CreatedAt.IsZero() {
+		fmt.Fprintf(&b, "- **Planned:** %s\n", info.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	if plan.EstimatedTime != "" {
+		fmt.Fprintf(&b, "- **Estimated duration:** %s\n", plan.EstimatedTime)
+	}
+	if info.Query != "" {
+		fmt.Fprintf(&b, "- **Request:** %s\n", info.Query)
+	}
+	if plan.Description != "" {
+		fmt.Fprintf(&b, "\n%s\n", plan.Description)
+	}
+
+	b.WriteString("\n## Changes\n\n| # | Step | Chart | Version | Namespace |\n|---|---|---|---|---|\n")
+	for i, step := range plan.Steps {
+		chart, version, namespace := "-", "-", step.Namespace
+		if step.Chart != nil {
+			chart, version, namespace = step.Chart.Name, step.Chart.Version, step.Chart.Namespace
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s |\n", i+1, step.Name, chart, version, namespace)
+	}
+
+	impact := plan.ResourceImpact
+	b.WriteString("\n## Resource impact\n\n")
+	fmt.Fprintf(&b, "- CPU: %s\n- Memory: %s\n- Storage: %s\n", valueOrDash(impact.CPU), valueOrDash(impact.Memory), valueOrDash(impact.Storage))
+	if impact.Nodes > 0 {
+		fmt.Fprintf(&b, "- Nodes: %d\n", impact.Nodes)
+	}
+	if impact.EstimatedMonthlyCost > 0 {
+		fmt.Fprintf(&b, "- Estimated monthly cost: %.2f %s\n", impact.EstimatedMonthlyCost, impact.Currency)
+	}
+
+	writeList(&b, "Prerequisites", plan.Prerequisites)
+	writeList(&b, "Risks", plan.Risks)
+
+	if licenses != nil {
+		fmt.Fprintf(&b, "\n## Licenses\n\nChecked %s.\n\n", licenses.CheckedAt.UTC().Format(time.RFC3339))
+		b.WriteString(licenses.Summary())
+	}
+
+	b.WriteString("\n## Rollback\n\n")
+	for i := len(plan.Steps) - 1; i >= 0; i-- {
+		step := plan.Steps[i]
+		if step.Chart == nil {
+			continue
+		}
+		namespace := step.Chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		if step.Action == "upgrade" {
+			fmt.Fprintf(&b, "- `helm -n %s rollback %s`\n", namespace, releaseName(step.Chart))
+		} else {
+			fmt.Fprintf(&b, "- `helm -n %s uninstall %s`\n", namespace, releaseName(step.Chart))
+		}
+	}
+
+	return b.String()
+}
+
+func writeList(b *strings.Builder, title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %s\n\n", title)
+	for _, item := range items {
+		fmt.Fprintf(b, "- %s\n", item)
+	}
+}
+
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// DefaultTrustedPublishers are the Artifact Hub repositories whose charts rank
+// like official ones, besides those an organization trusts
+var DefaultTrustedPublishers = []string{
+	"bitnami",
+	"prometheus-community",
+	"grafana",
+	"ingress-nginx",
+	"jetstack",
+	"elastic",
+	"hashicorp",
+	"argo",
+	"open-telemetry",
+	"kedacore",
+	"traefik",
+	"kyverno",
+}
+
+const (
+	// planChartLimit charts at most are planned from a chart search
+	planChartLimit = 3
+	// preferredChartScore ranks an organization's preferred charts before every other
+	preferredChartScore = 1000
+	// officialChartScore is added to charts of official repositories
+	officialChartScore = 300
+	// verifiedPublisherScore is added to charts of verified or trusted publishers
+	verifiedPublisherScore = 200
+	// chartNameScore is added to charts named like a word of the search
+	chartNameScore = 100
+	// chartStarsScore is added per power of ten of a chart's stars
+	chartStarsScore = 50
+	// deprecatedChartScore is added to deprecated charts the policy allows
+	deprecatedChartScore = -2000
+)
+
+// ChartPolicy is how an organization ranks the Artifact Hub charts plans are
+// built from. Publishers are repository names, charts "repository/chart" or a
+// chart name matching it in any repository. Charts are allowed and blocked
+// by the organization's ChartRules.
+type ChartPolicy struct {
+	// TrustedPublishers rank like official repositories, along with
+	// DefaultTrustedPublishers
+	TrustedPublishers []string `json:"trusted_publishers,omitempty"`
+	// PreferredCharts rank before every other chart
+	PreferredCharts []string `json:"preferred_charts,omitempty"`
+	// AllowDeprecated plans deprecated charts, after every other, instead of
+	// leaving them out
+	AllowDeprecated bool `json:"allow_deprecated,omitempty"`
+	// TrustedOnly plans charts of official, verified and trusted publishers
+	// and preferred charts only
+	TrustedOnly bool `json:"trusted_only,omitempty"`
+}
+
+// Validate trims and lowercases the policy's lists and checks that trusted
+// publishers are repository names
+func (p *ChartPolicy) Validate() error {
+	p.TrustedPublishers = normalizeChartRefs(p.TrustedPublishers)
+	p.PreferredCharts = normalizeChartRefs(p.PreferredCharts)
+
+	for _, publisher := range p.TrustedPublishers {
+		if strings.Contains(publisher, "/") {
+			return fmt.Errorf("trusted publisher %q must be a repository name", publisher)
+		}
+	}
+	return nil
+}
+
+// RankedChart is a chart search result with its rank and why it got it
+type RankedChart struct {
+	ChartSearchResult
+	Score   float64  `json:"score"`
+	Trusted bool     `json:"trusted"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// RankCharts orders the charts of a search best first for a query: preferred
+// charts, then official, verified and trusted publishers, charts named like
+// the query and popular ones. Deprecated charts are left out unless the policy
+// allows them, and each chart name is ranked once, from its best repository.
+// The number of charts left out is returned too.
+func RankCharts(charts []ChartSearchResult, query string, policy *ChartPolicy) ([]RankedChart, int) {
+	if policy == nil {
+		policy = &ChartPolicy{}
+	}
+	words := strings.Fields(strings.ToLower(query))
+
+	ranked := make([]RankedChart, 0, len(charts))
+	excluded := 0
+	for _, chart := range charts {
+		candidate, ok := rankChart(chart, words, policy)
+		if !ok {
+			excluded++
+			continue
+		}
+		ranked = append(ranked, candidate)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+
+	// Mirrors of a chart in other repositories rank below the best one
+	seen := map[string]bool{}
+	unique := ranked[:0]
+	for _, chart := range ranked {
+		name := strings.ToLower(chart.Name)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, chart)
+	}
+	return unique, excluded
+}
+
+// rankChart scores a chart, or reports that the policy leaves it out
+func rankChart(chart ChartSearchResult, words []string, policy *ChartPolicy) (RankedChart, bool) {
+	publisher := strings.ToLower(chart.Provider)
+	ref := publisher + "/" + strings.ToLower(chart.Name)
+	if chart.Deprecated && !policy.AllowDeprecated {
+		return RankedChart{}, false
+	}
+
+	ranked := RankedChart{ChartSearchResult: chart}
+	preferred := matchesChartRef(policy.PreferredCharts, ref)
+	if preferred {
+		ranked.Score += preferredChartScore
+		ranked.Reasons = append(ranked.Reasons, "preferred by the organization")
+	}
+	if chart.Official {
+		ranked.Score += officialChartScore
+		ranked.Reasons = append(ranked.Reasons, "official")
+	}
+	switch {
+	case chart.VerifiedPublisher:
+		ranked.Score += verifiedPublisherScore
+		ranked.Reasons = append(ranked.Reasons, "verified publisher")
+	case containsString(DefaultTrustedPublishers, publisher) || containsString(policy.TrustedPublishers, publisher):
+		ranked.Score += verifiedPublisherScore
+		ranked.Reasons = append(ranked.Reasons, "trusted publisher")
+	}
+	ranked.Trusted = preferred || len(ranked.Reasons) > 0
+	if policy.TrustedOnly && !ranked.Trusted {
+		return RankedChart{}, false
+	}
+
+	if containsString(words, strings.ToLower(chart.Name)) {
+		ranked.Score += chartNameScore
+	}
+	if chart.Stars > 0 {
+		ranked.Score += chartStarsScore * math.Log10(float64(chart.Stars)+1)
+		ranked.Reasons = append(ranked.Reasons, fmt.Sprintf("%d stars", chart.Stars))
+	}
+	if chart.Deprecated {
+		ranked.Score += deprecatedChartScore
+		ranked.Reasons = append(ranked.Reasons, "deprecated")
+	}
+	return ranked, true
+}
+
+// matchesChartRef reports whether a "repository/chart" reference is listed,
+// itself or by its chart name alone
+func matchesChartRef(refs []string, ref string) bool {
+	_, name, _ := strings.Cut(ref, "/")
+	for _, listed := range refs {
+		if listed == ref || listed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeChartRefs trims and lowercases references, dropping empty ones
+func normalizeChartRefs(refs []string) []string {
+	normalized := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if ref = strings.ToLower(strings.TrimSpace(ref)); ref != "" {
+			normalized = append(normalized, ref)
+		}
+	}
+	return normalized
+}
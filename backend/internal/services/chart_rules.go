@@ -0,0 +1,154 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// Chart rule actions
+const (
+	ChartRuleAllow = "allow"
+	ChartRuleBlock = "block"
+)
+
+// artifactHubPackagePrefix starts the Artifact Hub URL of chart packages,
+// followed by the repository and chart names
+const artifactHubPackagePrefix = "https://artifacthub.io/packages/helm/"
+
+// ChartRule allows or blocks charts of an organization's plans. Repository is
+// an Artifact Hub repository name or a chart repository URL, Chart a chart
+// name; an empty one matches any.
+type ChartRule struct {
+	Action     string `json:"action"`
+	Repository string `json:"repository,omitempty"`
+	Chart      string `json:"chart,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Validate trims the rule and checks its action and that it names a
+// repository or a chart
+func (r *ChartRule) Validate() error {
+	r.Action = strings.ToLower(strings.TrimSpace(r.Action))
+	r.Repository = strings.TrimRight(strings.TrimSpace(r.Repository), "/")
+	r.Chart = strings.TrimSpace(r.Chart)
+	r.Reason = strings.TrimSpace(r.Reason)
+	if r.Action != ChartRuleAllow && r.Action != ChartRuleBlock {
+		return fmt.Errorf("action must be %s or %s", ChartRuleAllow, ChartRuleBlock)
+	}
+	if r.Repository == "" && r.Chart == "" {
+		return fmt.Errorf("a rule names a repository, a chart or both")
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to a chart of a repository, known
+// by its Artifact Hub name, its URL or both
+func (r ChartRule) matches(chart, repositoryName, repositoryURL string) bool {
+	if r.Chart != "" && !strings.EqualFold(r.Chart, chart) {
+		return false
+	}
+	if r.Repository == "" {
+		return true
+	}
+	return (repositoryName != "" && strings.EqualFold(r.Repository, repositoryName)) ||
+		(repositoryURL != "" && strings.EqualFold(r.Repository, strings.TrimRight(repositoryURL, "/")))
+}
+
+// ChartRules are the chart rules of an organization. Block rules win over
+// allow rules, and once any chart is allowed, charts no allow rule matches
+// are blocked too.
+type ChartRules []ChartRule
+
+// Check returns why a chart of a repository is blocked, or nil
+func (r ChartRules) Check(chart, repositoryName, repositoryURL string) *BlockedChart {
+	repository := repositoryName
+	if repository == "" {
+		repository = repositoryURL
+	}
+	allowlist := false
+	allowed := false
+	for _, rule := range r {
+		matched := rule.matches(chart, repositoryName, repositoryURL)
+		switch rule.Action {
+		case ChartRuleBlock:
+			if matched {
+				return &BlockedChart{Chart: chart, Repository: repository, Reason: blockReason(rule)}
+			}
+		case ChartRuleAllow:
+			allowlist = true
+			allowed = allowed || matched
+		}
+	}
+	if allowlist && !allowed {
+		return &BlockedChart{Chart: chart, Repository: repository, Reason: "not on the organization's chart allowlist"}
+	}
+	return nil
+}
+
+// Filter returns the search results the rules don't block, and how many they do
+func (r ChartRules) Filter(charts []ChartSearchResult) ([]ChartSearchResult, int) {
+	if len(r) == 0 {
+		return charts, 0
+	}
+	allowed := make([]ChartSearchResult, 0, len(charts))
+	for _, chart := range charts {
+		if r.Check(chart.Name, chart.Provider, chart.Repository) == nil {
+			allowed = append(allowed, chart)
+		}
+	}
+	return allowed, len(charts) - len(allowed)
+}
+
+// CheckPlan returns the charts of a plan the rules block
+func (r ChartRules) CheckPlan(plan *agent.DeploymentPlan) []BlockedChart {
+	if len(r) == 0 {
+		return nil
+	}
+	var blocked []BlockedChart
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		if chart := r.Check(step.Chart.Name, ChartRepositoryName(step.Chart), step.Chart.Repository); chart != nil {
+			chart.StepID = step.ID
+			blocked = append(blocked, *chart)
+		}
+	}
+	return blocked
+}
+
+// BlockedChart is a chart the organization's rules block, and why
+type BlockedChart struct {
+	StepID     string `json:"step_id,omitempty"`
+	Chart      string `json:"chart"`
+	Repository string `json:"repository,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+func (b BlockedChart) String() string {
+	if b.Repository == "" {
+		return fmt.Sprintf("%s is %s", b.Chart, b.Reason)
+	}
+	return fmt.Sprintf("%s from %s is %s", b.Chart, b.Repository, b.Reason)
+}
+
+// ChartRepositoryName returns the Artifact Hub repository of a plan's chart,
+// from its Artifact Hub URL, or "" for charts found elsewhere
+func ChartRepositoryName(chart *agent.HelmChart) string {
+	path, ok := strings.CutPrefix(chart.URL, artifactHubPackagePrefix)
+	if !ok {
+		return ""
+	}
+	repository, _, _ := strings.Cut(path, "/")
+	return repository
+}
+
+// blockReason describes why a block rule blocks charts
+func blockReason(rule ChartRule) string {
+	if rule.Reason != "" {
+		return "blocked by the organization: " + rule.Reason
+	}
+	return "blocked by the organization"
+}
@@ -3,15 +3,19 @@ package services
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	"grafana-ai-agent-platform/backend/internal/agent"
+	kubeclient "grafana-ai-agent-platform/backend/pkg/kubernetes"
+	"grafana-ai-agent-platform/backend/pkg/tracing"
 
+	authorizationv1 "k8s.io/api/authorization/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 // ClusterAnalyzerService analyzes Kubernetes clusters
@@ -23,9 +27,12 @@ func NewClusterAnalyzerService() *ClusterAnalyzerService {
 }
 
 // AnalyzeCluster analyzes a Kubernetes cluster and returns detailed information
-func (s *ClusterAnalyzerService) AnalyzeCluster(ctx context.Context, kubeconfig string) (*agent.ClusterAnalysis, error) {
+func (s *ClusterAnalyzerService) AnalyzeCluster(ctx context.Context, kubeconfig string) (analysis *agent.ClusterAnalysis, err error) {
+	ctx, span := tracing.Start(ctx, "cluster.analyze")
+	defer func() { tracing.End(span, err) }()
+
 	// Create Kubernetes client
-	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	config, err := kubeclient.RESTConfig(kubeconfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create kubeconfig: %w", err)
 	}
@@ -35,6 +42,11 @@ func (s *ClusterAnalyzerService) AnalyzeCluster(ctx context.Context, kubeconfig
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
 	// Get cluster version
 	version, err := clientset.Discovery().ServerVersion()
 	if err != nil {
@@ -71,22 +83,74 @@ func (s *ClusterAnalyzerService) AnalyzeCluster(ctx context.Context, kubeconfig
 	// Analyze security
 	security := s.analyzeSecurity(clientset)
 
+	// Probe what the stored credential may do. Clusters that can't review
+	// access are reported without it.
+	permissions, err := ProbePermissions(ctx, func(ctx context.Context, attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+		return kubeclient.AccessReview(ctx, clientset, attributes)
+	})
+	if err == nil {
+		security.Permissions = permissions
+	}
+
+	// Summarize admission policies the cluster enforces
+	policies := s.analyzePolicies(ctx, clientset.Discovery(), dynamicClient)
+
+	// Detect Istio or Linkerd
+	serviceMesh := s.analyzeServiceMesh(ctx, clientset, dynamicClient, namespaces.Items)
+
+	// Detect a Cluster API management cluster and its workload clusters
+	clusterAPI := s.analyzeClusterAPI(ctx, clientset.Discovery(), dynamicClient)
+
+	// Read the quotas and LimitRanges generated values must fit
+	namespaceLimits := s.analyzeNamespaceLimits(ctx, clientset)
+
+	// List the kinds the cluster's CRDs serve
+	customResources := s.analyzeCustomResources(ctx, dynamicClient)
+
+	// Detect the ingress classes, gateways and certificate issuers charts can use
+	ingress := s.analyzeIngress(ctx, clientset, dynamicClient, customResources)
+	if len(ingress.Classes) > 0 {
+		capabilities.IngressAvailable = true
+	}
+
+	// Sum the requests of the cluster's pods, which capacity forecasts track
+	usage := s.analyzeUsage(ctx, clientset)
+
 	// Get storage class names
 	storageClassNames := make([]string, len(storageClasses.Items))
+	var defaultStorageClass string
 	for i, sc := range storageClasses.Items {
 		storageClassNames[i] = sc.Name
+		if sc.Annotations[defaultStorageClassAnnotation] == "true" {
+			defaultStorageClass = sc.Name
+		}
+	}
+
+	namespaceNames := make([]string, len(namespaces.Items))
+	for i, namespace := range namespaces.Items {
+		namespaceNames[i] = namespace.Name
 	}
+	sort.Strings(namespaceNames)
 
 	// Create cluster analysis
-	analysis := &agent.ClusterAnalysis{
-		ClusterName:    "analyzed-cluster", // This could be extracted from context or config
-		Version:        version.GitVersion,
-		Nodes:          nodeInfos,
-		Resources:      resources,
-		Capabilities:   capabilities,
-		StorageClasses: storageClassNames,
-		NetworkPolicy:  s.detectNetworkPolicy(clientset),
-		Security:       security,
+	analysis = &agent.ClusterAnalysis{
+		ClusterName:         "analyzed-cluster", // This could be extracted from context or config
+		Version:             version.GitVersion,
+		Nodes:               nodeInfos,
+		Resources:           resources,
+		Capabilities:        capabilities,
+		StorageClasses:      storageClassNames,
+		NetworkPolicy:       s.detectNetworkPolicy(clientset),
+		Security:            security,
+		Policies:            policies,
+		ServiceMesh:         serviceMesh,
+		ClusterAPI:          clusterAPI,
+		NamespaceLimits:     namespaceLimits,
+		Namespaces:          namespaceNames,
+		DefaultStorageClass: defaultStorageClass,
+		CustomResources:     customResources,
+		Ingress:             ingress,
+		Usage:               usage,
 	}
 
 	return analysis, nil
@@ -115,14 +179,26 @@ func (s *ClusterAnalyzerService) analyzeNodes(nodes []corev1.Node) []agent.NodeI
 		storage := s.analyzeResource(node.Status.Capacity.StorageEphemeral(), node.Status.Allocatable.StorageEphemeral())
 
 		nodeInfos[i] = agent.NodeInfo{
-			Name:        node.Name,
-			Role:        role,
-			Status:      string(node.Status.Conditions[len(node.Status.Conditions)-1].Type),
-			CPU:         cpu,
-			Memory:      memory,
-			Storage:     storage,
-			Labels:      node.Labels,
-			Annotations: node.Annotations,
+			Name:             node.Name,
+			Role:             role,
+			Status:           string(node.Status.Conditions[len(node.Status.Conditions)-1].Type),
+			CPU:              cpu,
+			Memory:           memory,
+			Storage:          storage,
+			Architecture:     node.Status.NodeInfo.Architecture,
+			OperatingSystem:  node.Status.NodeInfo.OperatingSystem,
+			OSImage:          node.Status.NodeInfo.OSImage,
+			KernelVersion:    node.Status.NodeInfo.KernelVersion,
+			ContainerRuntime: node.Status.NodeInfo.ContainerRuntimeVersion,
+			Labels:           node.Labels,
+			Annotations:      node.Annotations,
+		}
+		for _, taint := range node.Spec.Taints {
+			nodeInfos[i].Taints = append(nodeInfos[i].Taints, agent.NodeTaint{
+				Key:    taint.Key,
+				Value:  taint.Value,
+				Effect: string(taint.Effect),
+			})
 		}
 	}
 
@@ -142,12 +218,12 @@ func (s *ClusterAnalyzerService) analyzeResource(capacity, allocatable *resource
 
 	capacityStr := capacity.String()
 	allocatableStr := allocatable.String()
-	
+
 	// Calculate used resources - create a copy to avoid modifying original
 	used := *capacity
 	used.Sub(*allocatable)
 	usedStr := used.String()
-	
+
 	// Calculate percentage
 	var percentage int
 	if capacity.Value() > 0 {
@@ -162,6 +238,32 @@ func (s *ClusterAnalyzerService) analyzeResource(capacity, allocatable *resource
 	}
 }
 
+// analyzeUsage sums the CPU, memory and ephemeral storage requested by the
+// pods scheduled on nodes that haven't finished, or returns nil when pods
+// can't be listed
+func (s *ClusterAnalyzerService) analyzeUsage(ctx context.Context, clientset *kubernetes.Clientset) *agent.ResourceUsage {
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		fmt.Printf("Failed to list pods for resource usage: %v\n", err)
+		return nil
+	}
+
+	requested := corev1.ResourceList{}
+	usage := &agent.ResourceUsage{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		usage.Pods++
+		for name, quantity := range corePodRequests(pod.Spec) {
+			addQuantity(requested, name, quantity, 1)
+		}
+	}
+	cpu, memory, storage := requested[corev1.ResourceCPU], requested[corev1.ResourceMemory], requested[corev1.ResourceEphemeralStorage]
+	usage.CPU, usage.Memory, usage.Storage = cpu.String(), memory.String(), storage.String()
+	return usage
+}
+
 // analyzeClusterResources analyzes overall cluster resources
 func (s *ClusterAnalyzerService) analyzeClusterResources(nodes []corev1.Node) agent.ClusterResources {
 	var totalCPU, totalMemory, totalStorage resource.Quantity
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+	"grafana-ai-agent-platform/backend/pkg/tunnel"
+)
+
+// ConnectorManager keeps the tunnels of the in-cluster connectors connected to
+// this replica, and serves the loopback proxy the kubeconfigs of connector
+// clusters are pointed at when this replica loads them. A request for a cluster whose connector is connected to
+// another replica fails.
+//
+// The proxy serves TLS with a certificate made at start, as client-go only
+// sends tokens to https servers; kubeconfigs trust it when the connector
+// connects.
+type ConnectorManager struct {
+	proxyAddr   string
+	certificate tls.Certificate
+	caPEM       []byte
+
+	mu      sync.Mutex
+	tunnels map[uint]*connectorTunnel
+}
+
+type connectorTunnel struct {
+	client     *tunnel.Client
+	proxyToken string
+	proxy      *httputil.ReverseProxy
+}
+
+// NewConnectorManager creates a connector manager whose proxy listens on
+// proxyAddr, a loopback address
+func NewConnectorManager(proxyAddr string) (*ConnectorManager, error) {
+	certificate, caPEM, err := proxyCertificate(proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &ConnectorManager{
+		proxyAddr:   proxyAddr,
+		certificate: certificate,
+		caPEM:       caPEM,
+		tunnels:     make(map[uint]*connectorTunnel),
+	}, nil
+}
+
+// ProxyURL is the URL of the loopback proxy
+func (m *ConnectorManager) ProxyURL() string {
+	return "https://" + m.proxyAddr
+}
+
+// ProxyCA is the PEM certificate the loopback proxy serves
+func (m *ConnectorManager) ProxyCA() []byte {
+	return m.caPEM
+}
+
+// Kubeconfig points the stored kubeconfig of a connector cluster at this
+// replica's loopback proxy
+func (m *ConnectorManager) Kubeconfig(stored string) (string, error) {
+	return kubernetes.ResolveConnectorKubeconfig(stored, m.ProxyURL(), m.caPEM)
+}
+
+// Attach routes a cluster's requests through a connector's tunnel, closing
+// the tunnel it replaces. Requests must authenticate with proxyToken.
+func (m *ConnectorManager) Attach(clusterID uint, proxyToken string, client *tunnel.Client) {
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = "connector"
+			req.Host = "connector"
+			// The connector authenticates as its ServiceAccount
+			req.Header.Del("Authorization")
+		},
+		Transport: client,
+		// Watches and log streams are passed on as they arrive
+		FlushInterval: -1,
+	}
+
+	m.mu.Lock()
+	previous := m.tunnels[clusterID]
+	m.tunnels[clusterID] = &connectorTunnel{client: client, proxyToken: proxyToken, proxy: proxy}
+	m.mu.Unlock()
+	if previous != nil {
+		previous.client.Close()
+	}
+}
+
+// Detach stops routing a cluster's requests through a tunnel, unless another
+// tunnel replaced it
+func (m *ConnectorManager) Detach(clusterID uint, client *tunnel.Client) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if current, ok := m.tunnels[clusterID]; ok && current.client == client {
+		delete(m.tunnels, clusterID)
+	}
+}
+
+// Disconnect closes the tunnel of a cluster's connector, if it is connected
+// to this replica
+func (m *ConnectorManager) Disconnect(clusterID uint) {
+	m.mu.Lock()
+	current, ok := m.tunnels[clusterID]
+	delete(m.tunnels, clusterID)
+	m.mu.Unlock()
+	if ok {
+		current.client.Close()
+	}
+}
+
+// Connected reports whether a cluster's connector is connected to this replica
+func (m *ConnectorManager) Connected(clusterID uint) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.tunnels[clusterID]
+	return ok
+}
+
+// ConnectedClusters lists the clusters whose connector is connected to this
+// replica
+func (m *ConnectorManager) ConnectedClusters() []uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clusters := make([]uint, 0, len(m.tunnels))
+	for clusterID := range m.tunnels {
+		clusters = append(clusters, clusterID)
+	}
+	return clusters
+}
+
+// ServeProxy serves the loopback proxy until it fails
+func (m *ConnectorManager) ServeProxy() error {
+	server := &http.Server{
+		Addr:      m.proxyAddr,
+		Handler:   m,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{m.certificate}},
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// ServeHTTP proxies /clusters/<id>/<API path> to the cluster's API server
+// through its connector's tunnel
+func (m *ConnectorManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/clusters/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	id, path, _ := strings.Cut(rest, "/")
+	clusterID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	m.mu.Lock()
+	current, ok := m.tunnels[uint(clusterID)]
+	m.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("the connector of cluster %d is not connected to this replica", clusterID), http.StatusBadGateway)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(current.proxyToken)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	r.URL.Path = "/" + path
+	r.URL.RawPath = ""
+	current.proxy.ServeHTTP(w, r)
+}
+
+// proxyCertificate makes the self-signed certificate of the loopback proxy
+func proxyCertificate(proxyAddr string) (tls.Certificate, []byte, error) {
+	host, _, err := net.SplitHostPort(proxyAddr)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("invalid connector proxy address %q: %w", proxyAddr, err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate connector proxy key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate connector proxy certificate: %w", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "connector proxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+		// Allows the certificate to be its own CA
+		BasicConstraintsValid: true,
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("failed to generate connector proxy certificate: %w", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
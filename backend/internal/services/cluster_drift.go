@@ -0,0 +1,263 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// ClusterDrift lists what changed in a cluster between two analyses. Resource
+// usage is left out since it changes constantly.
+type ClusterDrift struct {
+	From                   time.Time     `json:"from"`
+	To                     time.Time     `json:"to"`
+	Drifted                bool          `json:"drifted"`
+	Version                *FieldChange  `json:"version,omitempty"`
+	NodesAdded             []string      `json:"nodes_added,omitempty"`
+	NodesRemoved           []string      `json:"nodes_removed,omitempty"`
+	NodeChanges            []NodeChange  `json:"node_changes,omitempty"`
+	StorageClassesAdded    []string      `json:"storage_classes_added,omitempty"`
+	StorageClassesRemoved  []string      `json:"storage_classes_removed,omitempty"`
+	DefaultStorageClass    *FieldChange  `json:"default_storage_class,omitempty"`
+	CustomResourcesAdded   []string      `json:"custom_resources_added,omitempty"`
+	CustomResourcesRemoved []string      `json:"custom_resources_removed,omitempty"`
+	CapabilityChanges      []FieldChange `json:"capability_changes,omitempty"`
+	SecurityChanges        []FieldChange `json:"security_changes,omitempty"`
+	NetworkPolicy          *FieldChange  `json:"network_policy,omitempty"`
+	ServiceMesh            *FieldChange  `json:"service_mesh,omitempty"`
+	IngressClass           *FieldChange  `json:"ingress_class,omitempty"`
+	PoliciesAdded          []string      `json:"policies_added,omitempty"`
+	PoliciesRemoved        []string      `json:"policies_removed,omitempty"`
+	Warnings               []string      `json:"warnings"`
+}
+
+// FieldChange is a value that differs between two analyses
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// NodeChange lists the changed fields of a node present in both analyses
+type NodeChange struct {
+	Node    string        `json:"node"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// DiffClusterAnalyses compares an earlier analysis with a later one
+func DiffClusterAnalyses(from, to *agent.ClusterAnalysis, fromTime, toTime time.Time) *ClusterDrift {
+	drift := &ClusterDrift{From: fromTime, To: toTime, Warnings: []string{}}
+
+	if from.Version != to.Version {
+		drift.Version = &FieldChange{Field: "version", From: from.Version, To: to.Version}
+		drift.Warnings = append(drift.Warnings, fmt.Sprintf("Kubernetes version changed from %s to %s; check chart kubeVersion constraints and removed APIs", from.Version, to.Version))
+	}
+
+	fromNodes := make(map[string]agent.NodeInfo, len(from.Nodes))
+	for _, node := range from.Nodes {
+		fromNodes[node.Name] = node
+	}
+	toNodes := make(map[string]agent.NodeInfo, len(to.Nodes))
+	for _, node := range to.Nodes {
+		toNodes[node.Name] = node
+		previous, ok := fromNodes[node.Name]
+		if !ok {
+			drift.NodesAdded = append(drift.NodesAdded, node.Name)
+			continue
+		}
+		if changes := diffNode(previous, node); len(changes) > 0 {
+			drift.NodeChanges = append(drift.NodeChanges, NodeChange{Node: node.Name, Changes: changes})
+		}
+	}
+	for name := range fromNodes {
+		if _, ok := toNodes[name]; !ok {
+			drift.NodesRemoved = append(drift.NodesRemoved, name)
+		}
+	}
+	sort.Strings(drift.NodesAdded)
+	sort.Strings(drift.NodesRemoved)
+	sort.Slice(drift.NodeChanges, func(i, j int) bool { return drift.NodeChanges[i].Node < drift.NodeChanges[j].Node })
+	if len(drift.NodesRemoved) > 0 {
+		drift.Warnings = append(drift.Warnings, fmt.Sprintf("%d node(s) were removed; the plan may no longer fit the cluster's capacity", len(drift.NodesRemoved)))
+	}
+	for _, change := range drift.NodeChanges {
+		for _, field := range change.Changes {
+			if field.Field == "architecture" {
+				drift.Warnings = append(drift.Warnings, fmt.Sprintf("Node %s changed architecture from %s to %s; rerun the image architecture preflight", change.Node, field.From, field.To))
+			}
+		}
+	}
+
+	drift.StorageClassesAdded, drift.StorageClassesRemoved = diffStrings(from.StorageClasses, to.StorageClasses)
+	if len(drift.StorageClassesRemoved) > 0 {
+		drift.Warnings = append(drift.Warnings, fmt.Sprintf("Storage classes removed: %v; persistent volumes that name them will stay Pending", drift.StorageClassesRemoved))
+	}
+
+	if from.DefaultStorageClass != to.DefaultStorageClass {
+		drift.DefaultStorageClass = &FieldChange{Field: "default_storage_class", From: from.DefaultStorageClass, To: to.DefaultStorageClass}
+	}
+
+	drift.CustomResourcesAdded, drift.CustomResourcesRemoved = diffStrings(customResourceNames(from.CustomResources), customResourceNames(to.CustomResources))
+	if len(drift.CustomResourcesRemoved) > 0 {
+		drift.Warnings = append(drift.Warnings, fmt.Sprintf("Custom resources no longer served: %v; plans creating them will fail", drift.CustomResourcesRemoved))
+	}
+
+	drift.CapabilityChanges = diffBools([]boolField{
+		{"helm_installed", from.Capabilities.HelmInstalled, to.Capabilities.HelmInstalled},
+		{"ingress_available", from.Capabilities.IngressAvailable, to.Capabilities.IngressAvailable},
+		{"load_balancer", from.Capabilities.LoadBalancer, to.Capabilities.LoadBalancer},
+		{"persistent_volume", from.Capabilities.PersistentVolume, to.Capabilities.PersistentVolume},
+		{"rbac_enabled", from.Capabilities.RBACEnabled, to.Capabilities.RBACEnabled},
+		{"network_policy", from.Capabilities.NetworkPolicy, to.Capabilities.NetworkPolicy},
+	})
+	for _, change := range drift.CapabilityChanges {
+		if change.To == "false" {
+			drift.Warnings = append(drift.Warnings, fmt.Sprintf("Capability %s is no longer available", change.Field))
+		}
+	}
+
+	drift.SecurityChanges = diffBools([]boolField{
+		{"rbac_enabled", from.Security.RBACEnabled, to.Security.RBACEnabled},
+		{"pod_security_policy", from.Security.PodSecurityPolicy, to.Security.PodSecurityPolicy},
+		{"network_policy", from.Security.NetworkPolicy, to.Security.NetworkPolicy},
+		{"secrets_enabled", from.Security.SecretsEnabled, to.Security.SecretsEnabled},
+	})
+	// Analyses predating the permission probe have no permissions to compare
+	if fromPermissions, toPermissions := from.Security.Permissions, to.Security.Permissions; fromPermissions != nil && toPermissions != nil {
+		permissionChanges := diffBools([]boolField{
+			{"permissions.cluster_admin", fromPermissions.ClusterAdmin, toPermissions.ClusterAdmin},
+			{"permissions.create_deployments", fromPermissions.CreateDeployments, toPermissions.CreateDeployments},
+			{"permissions.create_namespaces", fromPermissions.CreateNamespaces, toPermissions.CreateNamespaces},
+			{"permissions.manage_secrets", fromPermissions.ManageSecrets, toPermissions.ManageSecrets},
+			{"permissions.manage_crds", fromPermissions.ManageCRDs, toPermissions.ManageCRDs},
+			{"permissions.manage_rbac", fromPermissions.ManageRBAC, toPermissions.ManageRBAC},
+			{"permissions.manage_webhooks", fromPermissions.ManageWebhooks, toPermissions.ManageWebhooks},
+		})
+		for _, change := range permissionChanges {
+			if change.To == "false" {
+				drift.Warnings = append(drift.Warnings, fmt.Sprintf("The stored credential lost %s; plans needing it will fail preflight", strings.TrimPrefix(change.Field, "permissions.")))
+			}
+		}
+		drift.SecurityChanges = append(drift.SecurityChanges, permissionChanges...)
+	}
+
+	if from.NetworkPolicy != to.NetworkPolicy {
+		drift.NetworkPolicy = &FieldChange{Field: "network_policy", From: from.NetworkPolicy, To: to.NetworkPolicy}
+	}
+
+	if fromMesh, toMesh := meshDescription(from.ServiceMesh), meshDescription(to.ServiceMesh); fromMesh != toMesh {
+		drift.ServiceMesh = &FieldChange{Field: "service_mesh", From: fromMesh, To: toMesh}
+		drift.Warnings = append(drift.Warnings, fmt.Sprintf("Service mesh changed from %q to %q; generated values and dashboards may need to be regenerated", fromMesh, toMesh))
+	}
+
+	// Analyses predating ingress detection have no ingress class to compare
+	if fromClass, toClass := from.Ingress.IngressClass(), to.Ingress.IngressClass(); from.Ingress != nil && to.Ingress != nil && fromClass != toClass {
+		drift.IngressClass = &FieldChange{Field: "ingress_class", From: fromClass, To: toClass}
+		drift.Warnings = append(drift.Warnings, fmt.Sprintf("Ingress class changed from %q to %q; regenerate plans so their Ingresses use it", fromClass, toClass))
+	}
+
+	drift.PoliciesAdded, drift.PoliciesRemoved = diffStrings(policyNames(from.Policies), policyNames(to.Policies))
+	if len(drift.PoliciesAdded) > 0 {
+		drift.Warnings = append(drift.Warnings, fmt.Sprintf("New admission policies: %v; rerun the admission preflight", drift.PoliciesAdded))
+	}
+
+	drift.Drifted = drift.Version != nil || len(drift.NodesAdded) > 0 || len(drift.NodesRemoved) > 0 ||
+		len(drift.NodeChanges) > 0 || len(drift.StorageClassesAdded) > 0 || len(drift.StorageClassesRemoved) > 0 ||
+		drift.DefaultStorageClass != nil || len(drift.CustomResourcesAdded) > 0 || len(drift.CustomResourcesRemoved) > 0 ||
+		len(drift.CapabilityChanges) > 0 || len(drift.SecurityChanges) > 0 || drift.NetworkPolicy != nil ||
+		drift.ServiceMesh != nil || drift.IngressClass != nil || len(drift.PoliciesAdded) > 0 || len(drift.PoliciesRemoved) > 0
+	return drift
+}
+
+// diffNode compares the stable properties of a node
+func diffNode(from, to agent.NodeInfo) []FieldChange {
+	fields := []FieldChange{
+		{Field: "role", From: from.Role, To: to.Role},
+		{Field: "status", From: from.Status, To: to.Status},
+		{Field: "cpu_capacity", From: from.CPU.Capacity, To: to.CPU.Capacity},
+		{Field: "memory_capacity", From: from.Memory.Capacity, To: to.Memory.Capacity},
+		{Field: "architecture", From: from.Architecture, To: to.Architecture},
+		{Field: "operating_system", From: from.OperatingSystem, To: to.OperatingSystem},
+		{Field: "kernel_version", From: from.KernelVersion, To: to.KernelVersion},
+		{Field: "container_runtime", From: from.ContainerRuntime, To: to.ContainerRuntime},
+	}
+
+	var changes []FieldChange
+	for _, field := range fields {
+		if field.From != field.To {
+			changes = append(changes, field)
+		}
+	}
+	return changes
+}
+
+type boolField struct {
+	name     string
+	from, to bool
+}
+
+func diffBools(fields []boolField) []FieldChange {
+	var changes []FieldChange
+	for _, field := range fields {
+		if field.from != field.to {
+			changes = append(changes, FieldChange{Field: field.name, From: fmt.Sprint(field.from), To: fmt.Sprint(field.to)})
+		}
+	}
+	return changes
+}
+
+// diffStrings returns the values only in to (added) and only in from (removed)
+func diffStrings(from, to []string) (added, removed []string) {
+	fromSet := make(map[string]bool, len(from))
+	for _, value := range from {
+		fromSet[value] = true
+	}
+	toSet := make(map[string]bool, len(to))
+	for _, value := range to {
+		toSet[value] = true
+		if !fromSet[value] {
+			added = append(added, value)
+		}
+	}
+	for _, value := range from {
+		if !toSet[value] {
+			removed = append(removed, value)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+func policyNames(policies []agent.PolicySummary) []string {
+	names := make([]string, 0, len(policies))
+	for _, policy := range policies {
+		name := fmt.Sprintf("%s/%s/%s", policy.Engine, policy.Kind, policy.Name)
+		if policy.Namespace != "" {
+			name = fmt.Sprintf("%s/%s/%s/%s", policy.Engine, policy.Kind, policy.Namespace, policy.Name)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// customResourceNames names each served kind as kind.group/version
+func customResourceNames(resources []agent.CustomResource) []string {
+	var names []string
+	for _, resource := range resources {
+		for _, version := range resource.Versions {
+			names = append(names, fmt.Sprintf("%s.%s/%s", resource.Kind, resource.Group, version))
+		}
+	}
+	return names
+}
+
+func meshDescription(mesh *agent.ServiceMesh) string {
+	if mesh == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%s %s (mTLS %s)", mesh.Type, mesh.Version, mesh.MTLSMode)
+}
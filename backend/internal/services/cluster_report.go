@@ -0,0 +1,425 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// ClusterReportService writes cluster health reports for stakeholders
+type ClusterReportService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewClusterReportService creates a new cluster report service
+func NewClusterReportService(aiAgent *agent.AIAgent) *ClusterReportService {
+	return &ClusterReportService{
+		aiAgent: aiAgent,
+	}
+}
+
+// ClusterReport is a cluster's health at one point in time: its nodes,
+// capacity, capabilities, security posture, installed stacks and the agent's
+// recommendations. Stacks and recommendations that couldn't be gathered are
+// left out, with the reason.
+type ClusterReport struct {
+	Analysis             *agent.ClusterAnalysis `json:"analysis"`
+	Releases             []HelmRelease          `json:"releases"`
+	ReleasesError        string                 `json:"releases_error,omitempty"`
+	Recommendations      []ReportRecommendation `json:"recommendations"`
+	RecommendationsError string                 `json:"recommendations_error,omitempty"`
+	GeneratedAt          time.Time              `json:"generated_at"`
+}
+
+// ReportRecommendation is an improvement the agent recommends
+type ReportRecommendation struct {
+	Title string `json:"title"`
+	// Priority is high, medium or low
+	Priority string `json:"priority"`
+	Detail   string `json:"detail"`
+}
+
+const clusterReportSystemPrompt = `You are a Kubernetes platform engineer reviewing a cluster for its stakeholders.
+
+Recommend the most valuable improvements to the cluster's reliability, capacity, security and operations, based only on the cluster information and the Helm releases you are given.
+
+Rules:
+- Respond with JSON only: {"recommendations": [{"title": "<short imperative>", "priority": "high", "medium" or "low", "detail": "<one to three sentences: why, and how>"}]}.
+- At most 8 recommendations, the most important first.
+- Write for readers who don't run the cluster themselves; avoid jargon where a plain word does.`
+
+// Generate reports on an analyzed cluster, listing its Helm releases with
+// kubeconfig and asking the agent for recommendations
+func (s *ClusterReportService) Generate(ctx context.Context, analysis *agent.ClusterAnalysis, kubeconfig string) *ClusterReport {
+	report := &ClusterReport{Analysis: analysis, GeneratedAt: time.Now().UTC()}
+
+	ReportProgress(ctx, 40, "Listing installed stacks")
+	releases, err := listHelmReleases(ctx, kubeconfig)
+	if err != nil {
+		report.ReleasesError = err.Error()
+	} else {
+		sort.Slice(releases, func(i, j int) bool {
+			if releases[i].Namespace != releases[j].Namespace {
+				return releases[i].Namespace < releases[j].Namespace
+			}
+			return releases[i].Name < releases[j].Name
+		})
+		report.Releases = releases
+	}
+
+	ReportProgress(ctx, 60, "Writing recommendations")
+	recommendations, err := s.recommend(ctx, analysis, report.Releases)
+	if err != nil {
+		report.RecommendationsError = err.Error()
+	} else {
+		report.Recommendations = recommendations
+	}
+	return report
+}
+
+// recommend asks the model for improvements to the cluster
+func (s *ClusterReportService) recommend(ctx context.Context, analysis *agent.ClusterAnalysis, releases []HelmRelease) ([]ReportRecommendation, error) {
+	var userMessage strings.Builder
+	fmt.Fprintf(&userMessage, "Cluster Information:\n%s\n", analysis.Summary())
+	if len(releases) > 0 {
+		userMessage.WriteString("\nHelm releases:\n")
+		for _, release := range releases {
+			fmt.Fprintf(&userMessage, "- %s/%s: %s %s (app %s), %s\n", release.Namespace, release.Name, release.Chart, release.ChartVersion, release.AppVersion, release.Status)
+		}
+	}
+
+	response, err := s.aiAgent.Complete(ctx, clusterReportSystemPrompt, userMessage.String())
+	if err != nil {
+		return nil, err
+	}
+	block := agent.ExtractJSONBlock(response)
+	if block == "" {
+		return nil, fmt.Errorf("model response did not contain recommendations")
+	}
+	var parsed struct {
+		Recommendations []ReportRecommendation `json:"recommendations"`
+	}
+	if err := json.Unmarshal([]byte(block), &parsed); err != nil {
+		return nil, fmt.Errorf("model returned invalid recommendations JSON: %w", err)
+	}
+
+	recommendations := make([]ReportRecommendation, 0, len(parsed.Recommendations))
+	for _, recommendation := range parsed.Recommendations {
+		recommendation.Title = strings.TrimSpace(recommendation.Title)
+		if recommendation.Title == "" {
+			continue
+		}
+		switch recommendation.Priority = strings.ToLower(strings.TrimSpace(recommendation.Priority)); recommendation.Priority {
+		case "high", "medium", "low":
+		default:
+			recommendation.Priority = "medium"
+		}
+		recommendations = append(recommendations, recommendation)
+	}
+	return recommendations, nil
+}
+
+// reportSection is a titled part of a report, rendered the same way in
+// Markdown and PDF
+type reportSection struct {
+	title string
+	text  []string
+	table *reportTable
+	items []string
+}
+
+type reportTable struct {
+	header []string
+	// widths are the columns' shares of the page width in PDFs
+	widths []float64
+	rows   [][]string
+}
+
+// sections lays the report out
+func (r *ClusterReport) sections() []reportSection {
+	a := r.Analysis
+	sections := []reportSection{{
+		title: "Summary",
+		items: []string{
+			fmt.Sprintf("Kubernetes version: %s", valueOrDash(a.Version)),
+			fmt.Sprintf("Nodes: %d", len(a.Nodes)),
+			fmt.Sprintf("Installed Helm releases: %s", countOrDash(len(r.Releases), r.ReleasesError)),
+			fmt.Sprintf("Generated: %s", r.GeneratedAt.Format(time.RFC3339)),
+		},
+	}}
+
+	sections = append(sections, reportSection{
+		title: "Capacity",
+		table: &reportTable{
+			header: []string{"Resource", "Total", "Available"},
+			widths: []float64{0.4, 0.3, 0.3},
+			rows: [][]string{
+				{"CPU", valueOrDash(a.Resources.TotalCPU), valueOrDash(a.Resources.AvailableCPU)},
+				{"Memory", valueOrDash(a.Resources.TotalMemory), valueOrDash(a.Resources.AvailableMemory)},
+				{"Storage", valueOrDash(a.Resources.TotalStorage), valueOrDash(a.Resources.AvailableStorage)},
+			},
+		},
+	})
+
+	nodes := &reportTable{
+		header: []string{"Node", "Role", "Status", "Platform", "CPU", "Memory"},
+		widths: []float64{0.3, 0.12, 0.1, 0.16, 0.16, 0.16},
+	}
+	for _, node := range a.Nodes {
+		nodes.rows = append(nodes.rows, []string{
+			node.Name, node.Role, node.Status, node.OperatingSystem + "/" + node.Architecture,
+			nodeUsage(node.CPU), nodeUsage(node.Memory),
+		})
+	}
+	sections = append(sections, reportSection{
+		title: "Nodes",
+		text:  []string{"CPU and memory show the allocatable amount and the share of it in use."},
+		table: nodes,
+	})
+
+	capabilities := reportSection{
+		title: "Capabilities",
+		table: &reportTable{
+			header: []string{"Capability", "Available"},
+			widths: []float64{0.6, 0.4},
+			rows: [][]string{
+				{"Ingress", yesNo(a.Capabilities.IngressAvailable)},
+				{"Load balancers", yesNo(a.Capabilities.LoadBalancer)},
+				{"Persistent volumes", yesNo(a.Capabilities.PersistentVolume)},
+				{"Network policies", yesNo(a.Capabilities.NetworkPolicy)},
+			},
+		},
+	}
+	if len(a.StorageClasses) > 0 {
+		capabilities.text = []string{"Storage classes: " + strings.Join(a.StorageClasses, ", ")}
+	} else {
+		capabilities.text = []string{"Storage classes: none"}
+	}
+	if ingress := a.Ingress; ingress != nil {
+		capabilities.table.rows = append(capabilities.table.rows,
+			[]string{"Gateway API", valueOrDash(ingress.GatewayAPI)},
+			[]string{"cert-manager", yesNo(ingress.CertManager)},
+		)
+		if len(ingress.Classes) > 0 {
+			capabilities.text = append(capabilities.text, fmt.Sprintf("Ingress classes: %s (default %s)", strings.Join(ingress.Classes, ", "), ingress.IngressClass()))
+		}
+	}
+	sections = append(sections, capabilities)
+
+	posture := []string{
+		fmt.Sprintf("RBAC: %s", enabledDisabled(a.Security.RBACEnabled)),
+		fmt.Sprintf("Network policies: %s", enabledDisabled(a.Security.NetworkPolicy)),
+		fmt.Sprintf("PodSecurityPolicies: %s", enabledDisabled(a.Security.PodSecurityPolicy)),
+		fmt.Sprintf("Namespaces with ResourceQuotas or LimitRanges: %d", len(a.NamespaceLimits)),
+	}
+	if permissions := a.Security.Permissions; permissions != nil {
+		switch missing := permissions.Missing(); {
+		case permissions.ClusterAdmin:
+			posture = append(posture, "Stored credential: cluster-admin")
+		case len(missing) == 0:
+			posture = append(posture, "Stored credential: every probed permission")
+		default:
+			posture = append(posture, fmt.Sprintf("Stored credential: lacks %s", strings.Join(missing, ", ")))
+		}
+	}
+	if mesh := a.ServiceMesh; mesh != nil {
+		posture = append(posture, fmt.Sprintf("Service mesh: %s %s, mTLS %s, %d injected namespace(s)", mesh.Type, mesh.Version, valueOrDash(mesh.MTLSMode), len(mesh.InjectedNamespaces)))
+	} else {
+		posture = append(posture, "Service mesh: none")
+	}
+	security := reportSection{title: "Security posture", items: posture}
+	if len(a.Policies) > 0 {
+		policies := &reportTable{
+			header: []string{"Engine", "Policy", "Action", "Targets"},
+			widths: []float64{0.15, 0.35, 0.15, 0.35},
+		}
+		for _, policy := range a.Policies {
+			name := policy.Kind + "/" + policy.Name
+			if policy.Namespace != "" {
+				name = policy.Namespace + "/" + name
+			}
+			policies.rows = append(policies.rows, []string{policy.Engine, name, policy.Action, strings.Join(policy.Targets, ", ")})
+		}
+		security.table = policies
+	} else {
+		security.text = []string{"No Kyverno or Gatekeeper admission policies are enforced."}
+	}
+	sections = append(sections, security)
+
+	stacks := reportSection{title: "Installed stacks"}
+	switch {
+	case r.ReleasesError != "":
+		stacks.text = []string{"Helm releases couldn't be listed: " + r.ReleasesError}
+	case len(r.Releases) == 0:
+		stacks.text = []string{"No Helm releases are installed."}
+	default:
+		releases := &reportTable{
+			header: []string{"Release", "Namespace", "Chart", "Version", "App version", "Status"},
+			widths: []float64{0.2, 0.18, 0.2, 0.12, 0.14, 0.16},
+		}
+		for _, release := range r.Releases {
+			releases.rows = append(releases.rows, []string{release.Name, release.Namespace, release.Chart, release.ChartVersion, release.AppVersion, release.Status})
+		}
+		stacks.table = releases
+	}
+	sections = append(sections, stacks)
+
+	recommendations := reportSection{title: "Recommendations"}
+	switch {
+	case r.RecommendationsError != "":
+		recommendations.text = []string{"The agent couldn't write recommendations: " + r.RecommendationsError}
+	case len(r.Recommendations) == 0:
+		recommendations.text = []string{"The agent has no recommendations."}
+	default:
+		for _, recommendation := range r.Recommendations {
+			recommendations.items = append(recommendations.items, fmt.Sprintf("%s (%s priority): %s", recommendation.Title, recommendation.Priority, recommendation.Detail))
+		}
+	}
+	return append(sections, recommendations)
+}
+
+// Title is the report's title
+func (r *ClusterReport) Title() string {
+	return fmt.Sprintf("Cluster report: %s", r.Analysis.ClusterName)
+}
+
+// Markdown renders the report as Markdown
+func (r *ClusterReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", r.Title())
+	for _, section := range r.sections() {
+		fmt.Fprintf(&b, "\n## %s\n\n", section.title)
+		for _, text := range section.text {
+			fmt.Fprintf(&b, "%s\n\n", text)
+		}
+		for _, item := range section.items {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+		if len(section.items) > 0 && section.table != nil {
+			b.WriteString("\n")
+		}
+		if table := section.table; table != nil {
+			fmt.Fprintf(&b, "| %s |\n|%s\n", strings.Join(table.header, " | "), strings.Repeat("---|", len(table.header)))
+			for _, row := range table.rows {
+				cells := make([]string, len(row))
+				for i, cell := range row {
+					cells[i] = strings.ReplaceAll(valueOrDash(cell), "|", "\\|")
+				}
+				fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+			}
+		}
+	}
+	return b.String()
+}
+
+// PDF renders the report as an A4 PDF
+func (r *ClusterReport) PDF() ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(15, 15, 15)
+	pdf.SetAutoPageBreak(true, 15)
+	pdf.SetTitle(r.Title(), true)
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	// The core fonts are encoded in cp1252
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	width := pageWidth - left - right
+
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.MultiCell(0, 9, tr(r.Title()), "", "L", false)
+
+	for _, section := range r.sections() {
+		pdf.Ln(4)
+		pdf.SetFont("Helvetica", "B", 13)
+		pdf.CellFormat(0, 8, tr(section.title), "B", 1, "L", false, 0, "")
+		pdf.Ln(2)
+
+		pdf.SetFont("Helvetica", "", 10)
+		for _, text := range section.text {
+			pdf.MultiCell(0, 5, tr(text), "", "L", false)
+			pdf.Ln(1)
+		}
+		for _, item := range section.items {
+			pdf.CellFormat(5, 5, "-", "", 0, "L", false, 0, "")
+			pdf.MultiCell(0, 5, tr(item), "", "L", false)
+		}
+		if len(section.items) > 0 {
+			pdf.Ln(2)
+		}
+
+		if table := section.table; table != nil {
+			pdf.SetFont("Helvetica", "B", 9)
+			pdf.SetFillColor(230, 230, 230)
+			for i, header := range table.header {
+				pdf.CellFormat(table.widths[i]*width, 6, tr(header), "1", 0, "L", true, 0, "")
+			}
+			pdf.Ln(-1)
+			pdf.SetFont("Helvetica", "", 9)
+			for _, row := range table.rows {
+				for i, cell := range row {
+					cellWidth := table.widths[i] * width
+					pdf.CellFormat(cellWidth, 6, fitText(pdf, tr(valueOrDash(cell)), cellWidth-2), "1", 0, "L", false, 0, "")
+				}
+				pdf.Ln(-1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("failed to render PDF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fitText shortens text to fit width in the PDF's current font
+func fitText(pdf *gofpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	for len(text) > 0 && pdf.GetStringWidth(text+"...") > width {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
+
+func nodeUsage(resource agent.ResourceInfo) string {
+	if resource.Allocatable == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%d%%)", resource.Allocatable, resource.Percentage)
+}
+
+func countOrDash(count int, err string) string {
+	if err != "" {
+		return "-"
+	}
+	return fmt.Sprint(count)
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "Yes"
+	}
+	return "No"
+}
+
+func enabledDisabled(value bool) string {
+	if value {
+		return "enabled"
+	}
+	return "disabled"
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Watch alert rules
+const (
+	RuleNodeNotReady     = "node_not_ready"
+	RulePVCPending       = "pvc_pending"
+	RuleCrashLoopBackOff = "crash_loop_backoff"
+	RuleOOMKilled        = "oom_killed"
+	RuleImagePullBackOff = "image_pull_backoff"
+	RuleUnreachable      = "cluster_unreachable"
+)
+
+// oomKilledWindow is how long after a container was OOMKilled its pod alerts
+const oomKilledWindow = 15 * time.Minute
+
+// unreachableAfterPings is how many pings in a row must fail before a cluster
+// counts as unreachable, so a single timeout doesn't alert
+const unreachableAfterPings = 2
+
+// ClusterWatchOptions tune the built-in alert rules
+type ClusterWatchOptions struct {
+	// EvaluateInterval is how often the watched state is checked against the rules
+	EvaluateInterval time.Duration
+	// PVCPendingAfter is how long a claim may stay Pending before alerting
+	PVCPendingAfter time.Duration
+	// CrashLoopRestarts is the restart count at which a crash-looping container alerts
+	CrashLoopRestarts int32
+}
+
+// ClusterWatchService watches nodes, claims and pods of connected clusters and
+// raises alerts on the event bus. It is a bootstrap monitoring capability for
+// clusters that don't run a monitoring stack yet.
+type ClusterWatchService struct {
+	bus     *EventBus
+	options ClusterWatchOptions
+
+	mu      sync.Mutex
+	watches map[uint]*clusterWatch
+}
+
+type clusterWatch struct {
+	clusterID uint
+	userID    uint
+	cancel    context.CancelFunc
+
+	mu     sync.Mutex
+	active map[string]Event
+	// failedPings counts the API server pings that failed in a row
+	failedPings int
+}
+
+// NewClusterWatchService creates a new cluster watch service
+func NewClusterWatchService(bus *EventBus, options ClusterWatchOptions) *ClusterWatchService {
+	if options.EvaluateInterval <= 0 {
+		options.EvaluateInterval = 30 * time.Second
+	}
+	if options.CrashLoopRestarts <= 0 {
+		options.CrashLoopRestarts = 5
+	}
+	return &ClusterWatchService{
+		bus:     bus,
+		options: options,
+		watches: make(map[uint]*clusterWatch),
+	}
+}
+
+// Watch starts watching a cluster, replacing any existing watch on it
+func (s *ClusterWatchService) Watch(clusterID, userID uint, client *kubernetes.KubernetesClient) {
+	ctx, cancel := context.WithCancel(context.Background())
+	watch := &clusterWatch{
+		clusterID: clusterID,
+		userID:    userID,
+		cancel:    cancel,
+		active:    make(map[string]Event),
+	}
+
+	s.mu.Lock()
+	if existing, ok := s.watches[clusterID]; ok {
+		existing.cancel()
+	}
+	s.watches[clusterID] = watch
+	s.mu.Unlock()
+
+	go s.run(ctx, watch, client)
+}
+
+// Unwatch stops watching a cluster
+func (s *ClusterWatchService) Unwatch(clusterID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if watch, ok := s.watches[clusterID]; ok {
+		watch.cancel()
+		delete(s.watches, clusterID)
+	}
+}
+
+// ActiveAlerts returns the alerts currently firing for a cluster
+func (s *ClusterWatchService) ActiveAlerts(clusterID uint) []Event {
+	s.mu.Lock()
+	watch, ok := s.watches[clusterID]
+	s.mu.Unlock()
+	if !ok {
+		return []Event{}
+	}
+
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+	alerts := make([]Event, 0, len(watch.active))
+	for _, alert := range watch.active {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Timestamp.Before(alerts[j].Timestamp) })
+	return alerts
+}
+
+// run keeps informer caches of the watched objects and evaluates the rules on
+// every tick until the watch is cancelled
+func (s *ClusterWatchService) run(ctx context.Context, watch *clusterWatch, client *kubernetes.KubernetesClient) {
+	factory := client.InformerFactory(0)
+	nodes := factory.Core().V1().Nodes()
+	claims := factory.Core().V1().PersistentVolumeClaims()
+	pods := factory.Core().V1().Pods()
+
+	// Listers must be requested before Start so their informers run
+	nodeLister, claimLister, podLister := nodes.Lister(), claims.Lister(), pods.Lister()
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), nodes.Informer().HasSynced, claims.Informer().HasSynced, pods.Informer().HasSynced) {
+		return
+	}
+
+	ticker := time.NewTicker(s.options.EvaluateInterval)
+	defer ticker.Stop()
+	for {
+		if s.checkConnectivity(ctx, watch, client) {
+			s.evaluate(watch, nodeLister, claimLister, podLister)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkConnectivity pings the API server and raises an alert once it stopped
+// answering. While it is unreachable the informer caches are stale, so the
+// alerts that were firing are kept rather than resolved.
+func (s *ClusterWatchService) checkConnectivity(ctx context.Context, watch *clusterWatch, client *kubernetes.KubernetesClient) bool {
+	pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	err := client.Ping(pingCtx)
+	if ctx.Err() != nil {
+		return false
+	}
+	if err == nil {
+		watch.failedPings = 0
+		return true
+	}
+
+	watch.failedPings++
+	if watch.failedPings < unreachableAfterPings {
+		return false
+	}
+	watch.mu.Lock()
+	firing := make(map[string]Event, len(watch.active)+1)
+	for key, alert := range watch.active {
+		firing[key] = alert
+	}
+	watch.mu.Unlock()
+	firing[RuleUnreachable] = Event{
+		Type:     EventClusterUnreachable,
+		Severity: SeverityCritical,
+		Rule:     RuleUnreachable,
+		Resource: "apiserver",
+		Title:    "Cluster API server unreachable",
+		Message:  fmt.Sprintf("The API server did not answer %d pings in a row: %v", watch.failedPings, err),
+	}
+	s.reconcile(watch, firing)
+	return false
+}
+
+// evaluate checks the cached cluster state against the alert rules
+func (s *ClusterWatchService) evaluate(watch *clusterWatch, nodeLister corelisters.NodeLister, claimLister corelisters.PersistentVolumeClaimLister, podLister corelisters.PodLister) {
+	nodeList, err := nodeLister.List(labels.Everything())
+	if err != nil {
+		fmt.Printf("Failed to list watched nodes for cluster %d: %v\n", watch.clusterID, err)
+	}
+	claimList, err := claimLister.List(labels.Everything())
+	if err != nil {
+		fmt.Printf("Failed to list watched claims for cluster %d: %v\n", watch.clusterID, err)
+	}
+	podList, err := podLister.List(labels.Everything())
+	if err != nil {
+		fmt.Printf("Failed to list watched pods for cluster %d: %v\n", watch.clusterID, err)
+	}
+
+	s.reconcile(watch, EvaluateWatchRules(time.Now(), nodeList, claimList, podList, s.options))
+}
+
+// reconcile publishes alerts that started firing and resolutions for those that stopped
+func (s *ClusterWatchService) reconcile(watch *clusterWatch, firing map[string]Event) {
+	watch.mu.Lock()
+	defer watch.mu.Unlock()
+
+	for key, alert := range firing {
+		if _, ok := watch.active[key]; ok {
+			continue
+		}
+		if alert.Type == "" {
+			alert.Type = EventClusterAlert
+		}
+		alert.UserID = watch.userID
+		alert.ClusterID = watch.clusterID
+		watch.active[key] = alert
+		s.bus.Publish(alert)
+	}
+
+	for key, alert := range watch.active {
+		if _, ok := firing[key]; ok {
+			continue
+		}
+		delete(watch.active, key)
+		s.bus.Publish(Event{
+			Type:      EventClusterResolved,
+			UserID:    watch.userID,
+			ClusterID: watch.clusterID,
+			Severity:  SeverityInfo,
+			Rule:      alert.Rule,
+			Resource:  alert.Resource,
+			Title:     "Resolved: " + alert.Title,
+			Message:   fmt.Sprintf("%s is no longer firing for %s", alert.Rule, alert.Resource),
+		})
+	}
+}
+
+// EvaluateWatchRules returns the alerts firing for the given cluster state,
+// keyed by rule and resource
+func EvaluateWatchRules(now time.Time, nodes []*corev1.Node, claims []*corev1.PersistentVolumeClaim, pods []*corev1.Pod, options ClusterWatchOptions) map[string]Event {
+	firing := make(map[string]Event)
+	raise := func(rule, resource, severity, title, message string) {
+		firing[rule+"/"+resource] = Event{
+			Severity:  severity,
+			Rule:      rule,
+			Resource:  resource,
+			Title:     title,
+			Message:   message,
+			Timestamp: now,
+		}
+	}
+
+	for _, node := range nodes {
+		if ready, reason := nodeReady(node); !ready {
+			raise(RuleNodeNotReady, "node/"+node.Name, SeverityCritical,
+				fmt.Sprintf("Node %s is NotReady", node.Name), reason)
+		}
+	}
+
+	for _, claim := range claims {
+		if claim.Status.Phase != corev1.ClaimPending {
+			continue
+		}
+		pendingFor := now.Sub(claim.CreationTimestamp.Time)
+		if pendingFor < options.PVCPendingAfter {
+			continue
+		}
+		storageClass := "the default storage class"
+		if claim.Spec.StorageClassName != nil {
+			storageClass = fmt.Sprintf("storage class %q", *claim.Spec.StorageClassName)
+		}
+		raise(RulePVCPending, fmt.Sprintf("pvc/%s/%s", claim.Namespace, claim.Name), SeverityWarning,
+			fmt.Sprintf("PersistentVolumeClaim %s/%s is stuck Pending", claim.Namespace, claim.Name),
+			fmt.Sprintf("The claim has been Pending for %s. Check that %s can provision volumes.", pendingFor.Round(time.Minute), storageClass))
+	}
+
+	for _, pod := range pods {
+		var looping []string
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if status.State.Waiting == nil || status.State.Waiting.Reason != "CrashLoopBackOff" {
+				continue
+			}
+			if status.RestartCount < options.CrashLoopRestarts {
+				continue
+			}
+			looping = append(looping, fmt.Sprintf("%s (%d restarts)", status.Name, status.RestartCount))
+		}
+		if len(looping) == 0 {
+			continue
+		}
+		raise(RuleCrashLoopBackOff, fmt.Sprintf("pod/%s/%s", pod.Namespace, pod.Name), SeverityWarning,
+			fmt.Sprintf("Pod %s/%s is in CrashLoopBackOff", pod.Namespace, pod.Name),
+			fmt.Sprintf("Crash-looping containers: %s", strings.Join(looping, ", ")))
+	}
+
+	for _, pod := range pods {
+		var killed, pulling []string
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if oomKilledSince(status, now.Add(-oomKilledWindow)) {
+				killed = append(killed, status.Name)
+			}
+			if waiting := status.State.Waiting; waiting != nil && (waiting.Reason == "ImagePullBackOff" || waiting.Reason == "ErrImagePull") {
+				pulling = append(pulling, fmt.Sprintf("%s (%s)", status.Name, status.Image))
+			}
+		}
+		if len(killed) > 0 {
+			raise(RuleOOMKilled, fmt.Sprintf("pod/%s/%s", pod.Namespace, pod.Name), SeverityWarning,
+				fmt.Sprintf("Pod %s/%s was OOMKilled", pod.Namespace, pod.Name),
+				fmt.Sprintf("Containers killed for exceeding their memory limit: %s", strings.Join(killed, ", ")))
+		}
+		if len(pulling) > 0 {
+			raise(RuleImagePullBackOff, fmt.Sprintf("pod/%s/%s", pod.Namespace, pod.Name), SeverityWarning,
+				fmt.Sprintf("Pod %s/%s can't pull its images", pod.Namespace, pod.Name),
+				fmt.Sprintf("Containers in ImagePullBackOff: %s", strings.Join(pulling, ", ")))
+		}
+	}
+
+	return firing
+}
+
+// oomKilledSince reports whether a container was OOMKilled after a time, in its
+// current or its last run
+func oomKilledSince(status corev1.ContainerStatus, since time.Time) bool {
+	for _, terminated := range []*corev1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+		if terminated != nil && terminated.Reason == "OOMKilled" && terminated.FinishedAt.Time.After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeReady reports whether a node's Ready condition is true, with the reason when it isn't
+func nodeReady(node *corev1.Node) (bool, string) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != corev1.NodeReady {
+			continue
+		}
+		if condition.Status == corev1.ConditionTrue {
+			return true, ""
+		}
+		if condition.Message != "" {
+			return false, condition.Message
+		}
+		return false, fmt.Sprintf("Ready condition is %s", condition.Status)
+	}
+	return false, "Node has not reported a Ready condition"
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Pricing is the monthly price of a unit of each requested resource
+type Pricing struct {
+	Currency       string  `json:"currency"`
+	CPUCoreMonth   float64 `json:"cpu_core_month"`
+	MemoryGBMonth  float64 `json:"memory_gb_month"`
+	StorageGBMonth float64 `json:"storage_gb_month"`
+}
+
+// CostTarget is what the price of a plan depends on in the target cluster
+type CostTarget struct {
+	// Provider selects a price sheet: aws, gcp or azure, or empty for the default pricing
+	Provider string
+	// Nodes is the number of Linux nodes DaemonSets run a pod on
+	Nodes int64
+}
+
+// ChartCost is the projected monthly cost of a chart's resource requests
+type ChartCost struct {
+	Chart       string  `json:"chart"`
+	Namespace   string  `json:"namespace"`
+	CPUCores    float64 `json:"cpu_cores"`
+	MemoryGB    float64 `json:"memory_gb"`
+	StorageGB   float64 `json:"storage_gb"`
+	CPUCost     float64 `json:"cpu_cost"`
+	MemoryCost  float64 `json:"memory_cost"`
+	StorageCost float64 `json:"storage_cost"`
+	MonthlyCost float64 `json:"monthly_cost"`
+	// Source is manifests when the chart was rendered, values when only its
+	// values could be read
+	Source string   `json:"source"`
+	Notes  []string `json:"notes,omitempty"`
+}
+
+// PlanCost is the projected monthly cost of a plan, per chart
+type PlanCost struct {
+	PlanID      string      `json:"plan_id"`
+	Provider    string      `json:"provider,omitempty"`
+	Pricing     Pricing     `json:"pricing"`
+	Charts      []ChartCost `json:"charts"`
+	CPUCores    float64     `json:"cpu_cores"`
+	MemoryGB    float64     `json:"memory_gb"`
+	StorageGB   float64     `json:"storage_gb"`
+	MonthlyCost float64     `json:"monthly_cost"`
+	Currency    string      `json:"currency"`
+	EstimatedAt time.Time   `json:"estimated_at"`
+}
+
+// CostEstimatorService projects the monthly cost of the CPU, memory and
+// storage a plan requests, priced per unit
+type CostEstimatorService struct {
+	deploymentExecutor *DeploymentExecutorService
+	pricing            Pricing
+	// priceSheets override the pricing on clusters of a cloud provider
+	priceSheets map[string]Pricing
+}
+
+// NewCostEstimatorService creates a new cost estimator with default pricing and
+// per-provider price sheets
+func NewCostEstimatorService(deploymentExecutor *DeploymentExecutorService, pricing Pricing, priceSheets map[string]Pricing) *CostEstimatorService {
+	if pricing.Currency == "" {
+		pricing.Currency = "USD"
+	}
+	return &CostEstimatorService{
+		deploymentExecutor: deploymentExecutor,
+		pricing:            pricing,
+		priceSheets:        priceSheets,
+	}
+}
+
+// LoadPriceSheets reads per-provider pricing from a JSON file shaped like
+// {"aws": {"currency": "USD", "cpu_core_month": 24.5, ...}, "gcp": {...}}.
+// An empty path loads no sheets.
+func LoadPriceSheets(path string) (map[string]Pricing, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price sheets: %w", err)
+	}
+	var sheets map[string]Pricing
+	if err := json.Unmarshal(data, &sheets); err != nil {
+		return nil, fmt.Errorf("invalid price sheets: %w", err)
+	}
+	normalized := make(map[string]Pricing, len(sheets))
+	for provider, pricing := range sheets {
+		if pricing.CPUCoreMonth < 0 || pricing.MemoryGBMonth < 0 || pricing.StorageGBMonth < 0 {
+			return nil, fmt.Errorf("price sheet %s has negative prices", provider)
+		}
+		normalized[strings.ToLower(provider)] = pricing
+	}
+	return normalized, nil
+}
+
+// PricingFor returns the price sheet of a provider, or the default pricing
+func (s *CostEstimatorService) PricingFor(provider string) Pricing {
+	pricing, ok := s.priceSheets[strings.ToLower(provider)]
+	if !ok {
+		return s.pricing
+	}
+	if pricing.Currency == "" {
+		pricing.Currency = s.pricing.Currency
+	}
+	return pricing
+}
+
+// EstimatePlanCost sums the requests of every chart in the plan and prices
+// them. Charts are rendered to count every workload and volume claim; a chart
+// that fails to render is estimated from its values.
+func (s *CostEstimatorService) EstimatePlanCost(ctx context.Context, plan *agent.DeploymentPlan, target CostTarget) *PlanCost {
+	pricing := s.PricingFor(target.Provider)
+	cost := &PlanCost{
+		PlanID:      plan.ID,
+		Provider:    target.Provider,
+		Pricing:     pricing,
+		Charts:      []ChartCost{},
+		Currency:    pricing.Currency,
+		EstimatedAt: time.Now(),
+	}
+	if target.Nodes < 1 {
+		target.Nodes = 1
+	}
+
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		namespace := step.Chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		chartCost := s.estimateChartCost(ctx, step.Chart, namespace, target.Nodes)
+		chartCost.CPUCost = roundCost(chartCost.CPUCores * pricing.CPUCoreMonth)
+		chartCost.MemoryCost = roundCost(chartCost.MemoryGB * pricing.MemoryGBMonth)
+		chartCost.StorageCost = roundCost(chartCost.StorageGB * pricing.StorageGBMonth)
+		chartCost.MonthlyCost = roundCost(chartCost.CPUCost + chartCost.MemoryCost + chartCost.StorageCost)
+
+		cost.Charts = append(cost.Charts, chartCost)
+		cost.CPUCores += chartCost.CPUCores
+		cost.MemoryGB += chartCost.MemoryGB
+		cost.StorageGB += chartCost.StorageGB
+		cost.MonthlyCost += chartCost.MonthlyCost
+	}
+	cost.MonthlyCost = roundCost(cost.MonthlyCost)
+	return cost
+}
+
+// ApplyToImpact sets a plan's resource impact from its cost estimate
+func (c *PlanCost) ApplyToImpact(impact *agent.ResourceImpact) {
+	impact.CPU = resource.NewMilliQuantity(int64(math.Round(c.CPUCores*1000)), resource.DecimalSI).String()
+	impact.Memory = fmt.Sprintf("%.2fGi", c.MemoryGB)
+	impact.Storage = fmt.Sprintf("%.2fGi", c.StorageGB)
+	impact.EstimatedMonthlyCost = c.MonthlyCost
+	impact.Currency = c.Currency
+}
+
+// estimateChartCost sums the requests of a chart's rendered manifests, or of
+// its values when it can't be rendered
+func (s *CostEstimatorService) estimateChartCost(ctx context.Context, chart *agent.HelmChart, namespace string, nodes int64) ChartCost {
+	chartCost := ChartCost{Chart: chart.Name, Namespace: namespace, Source: "manifests"}
+
+	var requests corev1.ResourceList
+	unset := make(map[corev1.ResourceName]bool)
+	manifest, err := s.deploymentExecutor.RenderChart(ctx, chart, namespace)
+	if err == nil {
+		var objects []*unstructured.Unstructured
+		objects, err = kubernetes.ParseManifest(manifest)
+		if err == nil {
+			requests = objectsRequests(objects, namespace, nodes, unset)
+		}
+	}
+	if err != nil {
+		chartCost.Source = "values"
+		chartCost.Notes = append(chartCost.Notes, fmt.Sprintf("Estimated from the chart's values: %v", err))
+		requests = valuesRequests(chart.Values, unset)
+	}
+
+	cpu := requests[corev1.ResourceCPU]
+	memory := requests[corev1.ResourceMemory]
+	storage := requests[corev1.ResourceRequestsStorage]
+	chartCost.CPUCores = float64(cpu.MilliValue()) / 1000
+	chartCost.MemoryGB = float64(memory.Value()) / (1 << 30)
+	chartCost.StorageGB = float64(storage.Value()) / (1 << 30)
+
+	if unset[corev1.ResourceName("requests.cpu")] || unset[corev1.ResourceName("requests.memory")] {
+		chartCost.Notes = append(chartCost.Notes, "Some containers request no CPU or memory, so their usage is not priced")
+	}
+	return chartCost
+}
+
+// objectsRequests sums the CPU and memory requests of rendered workloads times
+// their replicas, and the storage of their volume claims
+func objectsRequests(objects []*unstructured.Unstructured, namespace string, nodes int64, unset map[corev1.ResourceName]bool) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	noDefaults := containerDefaults{requests: corev1.ResourceList{}, limits: corev1.ResourceList{}}
+	for _, obj := range objects {
+		if obj.GetNamespace() != "" && obj.GetNamespace() != namespace {
+			continue
+		}
+		if path, ok := podSpecPaths[obj.GetKind()]; ok {
+			if podSpec, found, _ := unstructured.NestedMap(obj.Object, path...); found {
+				requests, _ := podResources(podSpec, noDefaults, unset)
+				pods := workloadPods(obj, nodes)
+				for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+					if quantity, ok := requests[name]; ok {
+						addQuantity(total, name, quantity, pods)
+					}
+				}
+			}
+		}
+		switch obj.GetKind() {
+		case "PersistentVolumeClaim":
+			addClaimStorage(total, obj.Object, 1)
+		case "StatefulSet":
+			templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+			replicas := workloadPods(obj, nodes)
+			for _, item := range templates {
+				if template, ok := item.(map[string]interface{}); ok {
+					addClaimStorage(total, template, replicas)
+				}
+			}
+		}
+	}
+	return total
+}
+
+// valuesRequests reads the requests a chart's values set at the conventional
+// resources, replicas and persistence.size keys
+func valuesRequests(values map[string]interface{}, unset map[corev1.ResourceName]bool) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	replicas := int64(1)
+	if _, count, ok := chartReplicas(values); ok {
+		replicas = int64(count)
+	}
+
+	requests, _, _ := unstructured.NestedMap(values, "resources", "requests")
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		quantity, err := resource.ParseQuantity(fmt.Sprint(requests[string(name)]))
+		if requests[string(name)] == nil || err != nil {
+			unset[corev1.ResourceName("requests."+string(name))] = true
+			continue
+		}
+		addQuantity(total, name, quantity, replicas)
+	}
+
+	if enabled, found, _ := unstructured.NestedBool(values, "persistence", "enabled"); !found || enabled {
+		if size, found, _ := unstructured.NestedFieldNoCopy(values, "persistence", "size"); found {
+			if quantity, err := resource.ParseQuantity(fmt.Sprint(size)); err == nil {
+				addQuantity(total, corev1.ResourceRequestsStorage, quantity, replicas)
+			}
+		}
+	}
+	return total
+}
+
+// CloudProvider detects the cloud provider of a node from its provider ID or
+// its labels: aws, gcp, azure, or empty when unknown
+func CloudProvider(providerID string, labels map[string]string) string {
+	switch {
+	case strings.HasPrefix(providerID, "aws://"):
+		return "aws"
+	case strings.HasPrefix(providerID, "gce://"):
+		return "gcp"
+	case strings.HasPrefix(providerID, "azure://"):
+		return "azure"
+	}
+	for label := range labels {
+		switch {
+		case strings.HasPrefix(label, "eks.amazonaws.com/"):
+			return "aws"
+		case strings.HasPrefix(label, "cloud.google.com/"):
+			return "gcp"
+		case strings.HasPrefix(label, "kubernetes.azure.com/"):
+			return "azure"
+		}
+	}
+	return ""
+}
+
+// CostTargetFromAnalysis derives the cost target from a cluster analysis; a
+// nil analysis prices with the default pricing on one node
+func CostTargetFromAnalysis(analysis *agent.ClusterAnalysis) CostTarget {
+	target := CostTarget{Nodes: 1}
+	if analysis == nil {
+		return target
+	}
+	var nodes int64
+	for _, node := range analysis.Nodes {
+		if target.Provider == "" {
+			target.Provider = CloudProvider("", node.Labels)
+		}
+		if node.OperatingSystem != "windows" {
+			nodes++
+		}
+	}
+	if nodes > 0 {
+		target.Nodes = nodes
+	}
+	return target
+}
+
+// roundCost rounds a cost to cents
+func roundCost(cost float64) float64 {
+	return math.Round(cost*100) / 100
+}
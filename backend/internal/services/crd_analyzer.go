@@ -0,0 +1,57 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var crdGVR = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+
+// analyzeCustomResources lists the kinds the cluster's CRDs serve, or none
+// when the kubeconfig may not list CRDs
+func (s *ClusterAnalyzerService) analyzeCustomResources(ctx context.Context, dynamicClient dynamic.Interface) []agent.CustomResource {
+	crds, err := dynamicClient.Resource(crdGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil
+	}
+
+	resources := make([]agent.CustomResource, 0, len(crds.Items))
+	for _, crd := range crds.Items {
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+		scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+		resource := agent.CustomResource{Group: group, Kind: kind, Plural: plural, Namespaced: scope != "Cluster"}
+
+		versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+		for _, item := range versions {
+			version, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if served, _, _ := unstructured.NestedBool(version, "served"); !served {
+				continue
+			}
+			if name, _, _ := unstructured.NestedString(version, "name"); name != "" {
+				resource.Versions = append(resource.Versions, name)
+			}
+		}
+		if len(resource.Versions) > 0 {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].Group != resources[j].Group {
+			return resources[i].Group < resources[j].Group
+		}
+		return resources[i].Kind < resources[j].Kind
+	})
+	return resources
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// DashboardGeneratorService turns natural-language descriptions into Grafana dashboards
+type DashboardGeneratorService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewDashboardGeneratorService creates a new dashboard generator service
+func NewDashboardGeneratorService(aiAgent *agent.AIAgent) *DashboardGeneratorService {
+	return &DashboardGeneratorService{
+		aiAgent: aiAgent,
+	}
+}
+
+// DashboardDatasource identifies the datasource generated panels query
+type DashboardDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid,omitempty"`
+}
+
+// GeneratedDashboard is a dashboard model together with its validation outcome
+type GeneratedDashboard struct {
+	Dashboard map[string]interface{} `json:"dashboard"`
+	Valid     bool                   `json:"valid"`
+	Errors    []string               `json:"errors"`
+}
+
+// supportedPanelTypes lists the panel plugins bundled with Grafana
+var supportedPanelTypes = map[string]bool{
+	"timeseries": true, "graph": true, "stat": true, "gauge": true, "bargauge": true,
+	"table": true, "heatmap": true, "logs": true, "text": true, "piechart": true,
+	"barchart": true, "histogram": true, "state-timeline": true, "status-history": true,
+	"row": true, "alertlist": true, "dashlist": true, "nodeGraph": true, "traces": true,
+}
+
+// panelTypesWithoutQueries are panels that render without datasource targets
+var panelTypesWithoutQueries = map[string]bool{
+	"text": true, "row": true, "alertlist": true, "dashlist": true,
+}
+
+const dashboardSystemPrompt = `You are a Grafana dashboard expert. Produce a single Grafana dashboard JSON model (schemaVersion 38) for the user's description.
+
+Rules:
+- Respond with JSON only, no prose.
+- Top-level fields: "title", "tags", "time", "refresh", "panels".
+- Every panel needs "type", "title", "gridPos" ({"h","w","x","y"} on a 24 column grid) and "targets".
+- Use only these panel types: timeseries, stat, gauge, bargauge, table, heatmap, logs, text, piechart, barchart.
+- For Prometheus datasources targets use {"refId": "A", "expr": "<PromQL>"}; for Loki use {"refId": "A", "expr": "<LogQL>"}.
+- Use "$__rate_interval" for rate windows and template variables where helpful.
+- Do not include "id" or "uid" at the top level.`
+
+// meshTelemetryHints describes the standard metrics each mesh exports
+var meshTelemetryHints = map[string]string{
+	"istio": `Build the panels from Istio standard metrics:
+- istio_requests_total (labels: source_workload, destination_workload, destination_service, response_code, reporter)
+- istio_request_duration_milliseconds_bucket for latency percentiles
+- istio_tcp_sent_bytes_total and istio_tcp_received_bytes_total for TCP traffic
+- Filter on reporter="destination" to avoid double counting.
+Include request rate, success rate (non-5xx), P50/P90/P99 latency per service, and a mTLS panel using connection_security_policy.`,
+	"linkerd": `Build the panels from Linkerd proxy metrics:
+- request_total and response_total (labels: deployment, direction, classification, status_code, tls)
+- response_latency_ms_bucket for latency percentiles
+- tcp_open_connections, tcp_read_bytes_total and tcp_write_bytes_total for TCP traffic
+- Filter on direction="inbound" to avoid double counting.
+Include request rate, success rate (classification="success"), P50/P95/P99 latency per deployment, and a panel for the share of tls="true" traffic.`,
+}
+
+// Generate asks the model for a dashboard and validates the result. When a
+// mesh is given the dashboard is built from that mesh's telemetry.
+func (s *DashboardGeneratorService) Generate(ctx context.Context, description string, datasource DashboardDatasource, clusterInfo string, mesh *agent.ServiceMesh) (*GeneratedDashboard, error) {
+	if datasource.Type == "" {
+		datasource.Type = "prometheus"
+	}
+
+	userMessage := fmt.Sprintf("Dashboard description: %s\nDatasource type: %s", description, datasource.Type)
+	if clusterInfo != "" {
+		userMessage += fmt.Sprintf("\n\nCluster Information:\n%s", clusterInfo)
+	}
+	if mesh != nil {
+		userMessage += fmt.Sprintf("\n\nService mesh: %s %s\n%s", mesh.Type, mesh.Version, meshTelemetryHints[mesh.Type])
+	}
+
+	response, err := s.aiAgent.Complete(ctx, dashboardSystemPrompt, userMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	block := agent.ExtractJSONBlock(response)
+	if block == "" {
+		return nil, fmt.Errorf("model response did not contain dashboard JSON")
+	}
+
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal([]byte(block), &dashboard); err != nil {
+		return nil, fmt.Errorf("model returned invalid dashboard JSON: %w", err)
+	}
+
+	// Some models wrap the model in an import envelope
+	if inner, ok := dashboard["dashboard"].(map[string]interface{}); ok {
+		dashboard = inner
+	}
+
+	s.NormalizeDashboard(dashboard, datasource)
+	errors := s.ValidateDashboard(dashboard)
+
+	return &GeneratedDashboard{
+		Dashboard: dashboard,
+		Valid:     len(errors) == 0,
+		Errors:    errors,
+	}, nil
+}
+
+// NormalizeDashboard fills in defaults Grafana requires for import: panel IDs,
+// grid positions, datasource references, and schema version
+func (s *DashboardGeneratorService) NormalizeDashboard(dashboard map[string]interface{}, datasource DashboardDatasource) {
+	delete(dashboard, "id")
+	dashboard["uid"] = nil
+	if _, ok := dashboard["schemaVersion"]; !ok {
+		dashboard["schemaVersion"] = 38
+	}
+	if _, ok := dashboard["time"]; !ok {
+		dashboard["time"] = map[string]interface{}{"from": "now-6h", "to": "now"}
+	}
+
+	datasourceRef := map[string]interface{}{"type": datasource.Type}
+	if datasource.UID != "" {
+		datasourceRef["uid"] = datasource.UID
+	}
+
+	panels, _ := dashboard["panels"].([]interface{})
+	x, y := 0, 0
+	for i, item := range panels {
+		panel, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		panel["id"] = i + 1
+
+		if _, ok := panel["gridPos"].(map[string]interface{}); !ok {
+			panel["gridPos"] = map[string]interface{}{"h": 8, "w": 12, "x": x, "y": y}
+			x += 12
+			if x >= 24 {
+				x = 0
+				y += 8
+			}
+		}
+
+		panelType, _ := panel["type"].(string)
+		if panelTypesWithoutQueries[panelType] {
+			continue
+		}
+		if _, ok := panel["datasource"]; !ok {
+			panel["datasource"] = datasourceRef
+		}
+		if targets, ok := panel["targets"].([]interface{}); ok {
+			for _, targetItem := range targets {
+				if target, ok := targetItem.(map[string]interface{}); ok {
+					if _, ok := target["datasource"]; !ok {
+						target["datasource"] = datasourceRef
+					}
+				}
+			}
+		}
+	}
+}
+
+// ValidateDashboard checks the dashboard model against the panel schema Grafana expects
+func (s *DashboardGeneratorService) ValidateDashboard(dashboard map[string]interface{}) []string {
+	errors := []string{}
+
+	if title, _ := dashboard["title"].(string); strings.TrimSpace(title) == "" {
+		errors = append(errors, "dashboard title is required")
+	}
+
+	panels, ok := dashboard["panels"].([]interface{})
+	if !ok || len(panels) == 0 {
+		return append(errors, "dashboard must contain at least one panel")
+	}
+
+	for i, item := range panels {
+		panel, ok := item.(map[string]interface{})
+		if !ok {
+			errors = append(errors, fmt.Sprintf("panel %d is not an object", i))
+			continue
+		}
+
+		panelType, _ := panel["type"].(string)
+		label := fmt.Sprintf("panel %d", i)
+		if title, _ := panel["title"].(string); title != "" {
+			label = fmt.Sprintf("panel %d (%s)", i, title)
+		} else if panelType != "row" {
+			errors = append(errors, fmt.Sprintf("%s: title is required", label))
+		}
+
+		if !supportedPanelTypes[panelType] {
+			errors = append(errors, fmt.Sprintf("%s: unsupported panel type %q", label, panelType))
+		}
+
+		errors = append(errors, validateGridPos(label, panel["gridPos"])...)
+
+		if panelTypesWithoutQueries[panelType] {
+			continue
+		}
+		targets, ok := panel["targets"].([]interface{})
+		if !ok || len(targets) == 0 {
+			errors = append(errors, fmt.Sprintf("%s: at least one query target is required", label))
+			continue
+		}
+		for j, targetItem := range targets {
+			target, ok := targetItem.(map[string]interface{})
+			if !ok {
+				errors = append(errors, fmt.Sprintf("%s: target %d is not an object", label, j))
+				continue
+			}
+			if expr, _ := target["expr"].(string); strings.TrimSpace(expr) == "" {
+				errors = append(errors, fmt.Sprintf("%s: target %d has no expr", label, j))
+			}
+		}
+	}
+
+	return errors
+}
+
+// validateGridPos checks a panel's position on Grafana's 24 column grid
+func validateGridPos(label string, value interface{}) []string {
+	gridPos, ok := value.(map[string]interface{})
+	if !ok {
+		return []string{fmt.Sprintf("%s: gridPos is required", label)}
+	}
+
+	var errors []string
+	dims := make(map[string]float64)
+	for _, key := range []string{"h", "w", "x", "y"} {
+		number, ok := toFloat(gridPos[key])
+		if !ok || number < 0 {
+			errors = append(errors, fmt.Sprintf("%s: gridPos.%s must be a non-negative number", label, key))
+			continue
+		}
+		dims[key] = number
+	}
+	if len(errors) > 0 {
+		return errors
+	}
+
+	if dims["w"] < 1 || dims["w"] > 24 {
+		errors = append(errors, fmt.Sprintf("%s: gridPos.w must be between 1 and 24", label))
+	}
+	if dims["x"]+dims["w"] > 24 {
+		errors = append(errors, fmt.Sprintf("%s: panel exceeds the 24 column grid", label))
+	}
+	if dims["h"] < 1 {
+		errors = append(errors, fmt.Sprintf("%s: gridPos.h must be at least 1", label))
+	}
+	return errors
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
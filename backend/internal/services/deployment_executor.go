@@ -2,31 +2,96 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+	"grafana-ai-agent-platform/backend/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"sigs.k8s.io/yaml"
 )
 
 // DeploymentExecutorService handles the execution of deployment plans
 type DeploymentExecutorService struct {
-	helmService *HelmService
+	helmService     *HelmService
+	postDeploySteps []PostDeployStep
+	// secrets resolves the secret references of values when charts are installed
+	secrets *SecretsService
+	// stepConcurrency limits the steps of a deployment that run at once
+	stepConcurrency int
+	// abortRequests reports deployments asked to abort through other replicas
+	abortRequests AbortRequestCheck
+
+	mu      sync.Mutex
+	running map[string]*runningDeployment // deployments running in this process
+}
+
+// AbortRequestCheck reports whether a deployment was asked to abort and
+// whether the releases it installed should be uninstalled
+type AbortRequestCheck func(executionID string) (requested, cleanup bool)
+
+// runningDeployment is a deployment running in this process
+type runningDeployment struct {
+	abort   context.CancelCauseFunc
+	cleanup bool
 }
 
+// ErrDeploymentAborted stops the steps of deployments aborted with AbortDeployment
+var ErrDeploymentAborted = errors.New("deployment aborted")
+
+// ErrDeploymentNotRunning is returned when aborting a deployment that doesn't
+// run in this process
+var ErrDeploymentNotRunning = errors.New("deployment is not running on this server")
+
+// abortPollInterval is how often running deployments check for abort requests
+const abortPollInterval = 5 * time.Second
+
+// abortWaitDelay bounds how long an aborted step waits for the output of the
+// processes its command started after killing it
+const abortWaitDelay = 5 * time.Second
+
+// defaultStepConcurrency is how many independent steps run at once by default
+const defaultStepConcurrency = 4
+
 // NewDeploymentExecutorService creates a new deployment executor service
 func NewDeploymentExecutorService(helmService *HelmService) *DeploymentExecutorService {
 	return &DeploymentExecutorService{
-		helmService: helmService,
+		helmService:     helmService,
+		secrets:         NewSecretsService(SecretBackends{}),
+		stepConcurrency: defaultStepConcurrency,
+		running:         make(map[string]*runningDeployment),
 	}
 }
 
+// UseSecretBackends resolves secret references against Vault and SOPS files
+// as well as Kubernetes Secrets
+func (s *DeploymentExecutorService) UseSecretBackends(backends SecretBackends) {
+	s.secrets = NewSecretsService(backends)
+}
+
 // ExecuteDeployment executes a deployment plan
 func (s *DeploymentExecutorService) ExecuteDeployment(ctx context.Context, plan *agent.DeploymentPlan, kubeconfig string) (*agent.DeploymentExecution, error) {
+	if err := CheckReleaseCollisions(plan); err != nil {
+		return nil, err
+	}
+	dependencies, err := agent.StepDependencies(plan.Steps)
+	if err != nil {
+		return nil, err
+	}
+
 	execution := &agent.DeploymentExecution{
-		ID:        fmt.Sprintf("exec-%d", time.Now().Unix()),
+		ID:        fmt.Sprintf("exec-%d", time.Now().UnixNano()),
 		PlanID:    plan.ID,
 		Status:    "running",
 		StartTime: time.Now(),
@@ -36,71 +101,469 @@ func (s *DeploymentExecutorService) ExecuteDeployment(ctx context.Context, plan
 
 	// Initialize steps
 	for i, step := range plan.Steps {
+		retry := agent.DefaultRetryPolicy()
+		if step.Retry != nil {
+			retry = *step.Retry
+		}
 		execution.Steps[i] = agent.DeploymentStepExecution{
 			StepID:    step.ID,
 			Status:    "pending",
 			StartTime: nil,
 			EndTime:   nil,
 			Logs:      []string{},
+			Retry:     retry,
+			DependsOn: stepIDs(plan.Steps, dependencies[i]),
 		}
 	}
 
-	// Execute steps sequentially
+	s.runSteps(ctx, execution, plan, kubeconfig, dependencies)
+	return execution, nil
+}
+
+// ResumeDeployment runs the steps of a failed or aborted execution that didn't
+// complete. Completed steps are not re-run.
+func (s *DeploymentExecutorService) ResumeDeployment(ctx context.Context, execution *agent.DeploymentExecution, plan *agent.DeploymentPlan, kubeconfig string) (*agent.DeploymentExecution, error) {
+	if execution.Status != "failed" && execution.Status != "aborted" {
+		return nil, fmt.Errorf("only failed or aborted deployments can be resumed, execution is %s", execution.Status)
+	}
+	if len(plan.Steps) != len(execution.Steps) {
+		return nil, fmt.Errorf("plan has %d steps but execution has %d", len(plan.Steps), len(execution.Steps))
+	}
+	dependencies, err := agent.StepDependencies(plan.Steps)
+	if err != nil {
+		return nil, err
+	}
+
+	from := -1
 	for i := range execution.Steps {
-		execution.Steps[i].Status = "running"
-		execution.Steps[i].StartTime = &time.Time{}
-		*execution.Steps[i].StartTime = time.Now()
+		// Executions stored before steps had dependencies didn't record them
+		execution.Steps[i].DependsOn = stepIDs(plan.Steps, dependencies[i])
+		if execution.Steps[i].Status == "completed" {
+			continue
+		}
+		if from == -1 {
+			from = i
+		}
+		execution.Steps[i].Status = "pending"
+		execution.Steps[i].Error = ""
+		execution.Steps[i].EndTime = nil
+	}
+	execution.Status = "running"
+	execution.Error = ""
+	execution.EndTime = nil
+	execution.Resumes++
+	execution.Logs = append(execution.Logs, fmt.Sprintf("Resuming deployment from step %d", from+1))
 
-		// Add log entry
-		execution.Logs = append(execution.Logs, fmt.Sprintf("Executing step %d: %s", i+1, execution.Steps[i].StepID))
+	s.runSteps(ctx, execution, plan, kubeconfig, dependencies)
+	return execution, nil
+}
 
-		// Execute the step
-		err := s.executeStep(ctx, &execution.Steps[i], plan.Steps[i], kubeconfig)
+// SetStepConcurrency limits how many steps of a deployment run at once.
+// Steps only run together when neither depends on the other.
+func (s *DeploymentExecutorService) SetStepConcurrency(limit int) {
+	if limit < 1 {
+		limit = 1
+	}
+	s.stepConcurrency = limit
+}
 
-		if err != nil {
-			execution.Steps[i].Status = "failed"
-			execution.Steps[i].Error = err.Error()
-			execution.Logs = append(execution.Logs, fmt.Sprintf("Step %d failed: %v", i+1, err))
+// WatchAbortRequests makes running deployments check for abort requests made
+// through other replicas
+func (s *DeploymentExecutorService) WatchAbortRequests(check AbortRequestCheck) {
+	s.abortRequests = check
+}
+
+// AbortDeployment aborts a deployment running in this process: running steps
+// are stopped, their Helm operations killed, and steps that didn't start are
+// skipped. With cleanup the releases the deployment installed are uninstalled.
+// It returns ErrDeploymentNotRunning when the deployment doesn't run here.
+func (s *DeploymentExecutorService) AbortDeployment(executionID string, cleanup bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deployment, ok := s.running[executionID]
+	if !ok {
+		return ErrDeploymentNotRunning
+	}
+	deployment.cleanup = deployment.cleanup || cleanup
+	deployment.abort(ErrDeploymentAborted)
+	return nil
+}
+
+// track registers a deployment as running until the returned function is called
+func (s *DeploymentExecutorService) track(executionID string, abort context.CancelCauseFunc) (*runningDeployment, func()) {
+	deployment := &runningDeployment{abort: abort}
+	s.mu.Lock()
+	s.running[executionID] = deployment
+	s.mu.Unlock()
+	return deployment, func() {
+		s.mu.Lock()
+		delete(s.running, executionID)
+		s.mu.Unlock()
+	}
+}
+
+// cleanupRequested reports whether an aborted deployment should be cleaned up
+func (s *DeploymentExecutorService) cleanupRequested(deployment *runningDeployment) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return deployment.cleanup
+}
+
+// watchAbortRequests aborts a deployment asked to abort through another
+// replica, until stop is closed
+func (s *DeploymentExecutorService) watchAbortRequests(executionID string, stop <-chan struct{}) {
+	if s.abortRequests == nil {
+		return
+	}
+	ticker := time.NewTicker(abortPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if requested, cleanup := s.abortRequests(executionID); requested {
+				s.AbortDeployment(executionID, cleanup)
+				return
+			}
+		}
+	}
+}
+
+// stepIDs returns the IDs of the steps at the given indexes
+func stepIDs(steps []agent.DeploymentStep, indexes []int) []string {
+	var ids []string
+	for _, i := range indexes {
+		ids = append(ids, steps[i].ID)
+	}
+	return ids
+}
+
+// executionRun guards an execution whose steps run concurrently. Steps work on
+// a copy of their state and store it through the run, which reports every
+// change to the context's ExecutionObserver one at a time.
+type executionRun struct {
+	ctx context.Context
+	// stepCtx runs the steps. It is only cancelled when the deployment is
+	// aborted, with ErrDeploymentAborted as cause.
+	stepCtx   context.Context
+	mu        sync.Mutex
+	execution *agent.DeploymentExecution
+}
+
+// aborted reports whether the run was aborted
+func (r *executionRun) aborted() bool {
+	return context.Cause(r.stepCtx) == ErrDeploymentAborted
+}
+
+// update changes the execution and reports the change of the given step, or of
+// the execution itself when step is -1
+func (r *executionRun) update(step int, change func(execution *agent.DeploymentExecution)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(r.execution)
+	observeExecution(r.ctx, r.execution, step)
+}
+
+// apply changes the execution without reporting the change
+func (r *executionRun) apply(change func(execution *agent.DeploymentExecution)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(r.execution)
+}
+
+// log adds a line to the execution's logs without reporting a change
+func (r *executionRun) log(message string) {
+	r.apply(func(execution *agent.DeploymentExecution) {
+		execution.Logs = append(execution.Logs, message)
+	})
+}
+
+// step returns a copy of a step's state
+func (r *executionRun) step(index int) agent.DeploymentStepExecution {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stepExec := r.execution.Steps[index]
+	stepExec.Logs = append([]string(nil), stepExec.Logs...)
+	return stepExec
+}
+
+// stepResult is how a step that ran ended
+type stepResult struct {
+	index int
+	err   error
+}
+
+// runSteps executes the plan's steps that haven't completed, each once the
+// steps it depends on have, running up to the step concurrency limit at once.
+// No step starts after one fails or the context is cancelled. Steps already
+// running finish, rather than leave a release half installed, and the
+// execution fails so it can be resumed. Aborting the deployment stops running
+// steps too.
+func (s *DeploymentExecutorService) runSteps(ctx context.Context, execution *agent.DeploymentExecution, plan *agent.DeploymentPlan, kubeconfig string, dependencies [][]int) {
+	ctx, span := tracing.Start(ctx, "deployment.execute",
+		attribute.String("deployment.plan_id", plan.ID),
+		attribute.String("deployment.execution_id", execution.ID),
+		attribute.Int("deployment.steps", len(plan.Steps)),
+	)
+	defer func() {
+		span.SetAttributes(attribute.String("deployment.status", execution.Status))
+		var err error
+		if execution.Error != "" {
+			err = errors.New(execution.Error)
+		}
+		tracing.End(span, err)
+	}()
+
+	stepCtx, abort := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer abort(nil)
+	deployment, untrack := s.track(execution.ID, abort)
+	defer untrack()
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go s.watchAbortRequests(execution.ID, stopWatching)
+
+	run := &executionRun{ctx: ctx, stepCtx: stepCtx, execution: execution}
+	run.update(-1, func(*agent.DeploymentExecution) {})
+	defer run.update(-1, func(*agent.DeploymentExecution) {})
+
+	limit := s.stepConcurrency
+	if limit < 1 {
+		limit = 1
+	}
+	total := len(execution.Steps)
+	started := make([]bool, total)
+	completed := make([]bool, total)
+	done := 0
+	for i, step := range execution.Steps {
+		if step.Status == "completed" {
+			started[i], completed[i] = true, true
+			done++
+		}
+	}
+
+	results := make(chan stepResult)
+	cancelled := ctx.Done()
+	aborted := stepCtx.Done()
+	running := 0
+	stopped := false
+	for {
+		if err := ctx.Err(); err != nil && !stopped {
+			stopped = true
+			cancelRun(run, started, err)
+		}
+		for i := 0; i < total && !stopped && running < limit; i++ {
+			if started[i] || !dependenciesCompleted(dependencies[i], completed) {
+				continue
+			}
+			started[i] = true
+			running++
+			ReportProgress(ctx, done*100/total, fmt.Sprintf("Executing step %d/%d: %s", i+1, total, plan.Steps[i].ID))
+			go func(i int) {
+				results <- stepResult{index: i, err: s.runStep(run, i, plan.Steps[i], kubeconfig)}
+			}(i)
+		}
+		if running == 0 && !run.aborted() {
+			break
+		}
+
+		select {
+		case <-cancelled:
+			cancelled = nil
+		case <-aborted:
+			aborted = nil
+			stopped = true
+			run.update(-1, func(execution *agent.DeploymentExecution) {
+				execution.Logs = append(execution.Logs, fmt.Sprintf("Deployment aborted with %d steps running", running))
+				execution.Status = "aborted"
+				execution.Error = "Deployment aborted"
+			})
+		case result := <-results:
+			running--
+			if result.err != nil {
+				stopped = true
+			} else {
+				completed[result.index] = true
+				done++
+			}
+		}
+		if aborted == nil && running == 0 {
+			break
+		}
+	}
+
+	abortedRun := run.aborted()
+	run.update(-1, func(execution *agent.DeploymentExecution) {
+		if abortedRun {
+			skipped := 0
+			for i := range execution.Steps {
+				if execution.Steps[i].Status == "pending" {
+					execution.Steps[i].Status = "skipped"
+					skipped++
+				}
+			}
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Skipped %d steps that didn't start", skipped))
+		} else if execution.Status == "running" {
+			execution.Status = "completed"
+			execution.Logs = append(execution.Logs, "Deployment completed successfully")
+		}
+		// The run ended completed, failed or aborted
+		execution.EndTime = &time.Time{}
+		*execution.EndTime = time.Now()
+	})
+
+	if abortedRun && s.cleanupRequested(deployment) {
+		s.cleanupAbortedRun(context.WithoutCancel(ctx), run, plan, kubeconfig)
+	}
+}
+
+// cancelRun fails a run that was cancelled before all its steps started
+func cancelRun(run *executionRun, started []bool, err error) {
+	for i := range started {
+		if started[i] {
+			continue
+		}
+		run.update(-1, func(execution *agent.DeploymentExecution) {
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Deployment cancelled before step %d", i+1))
 			execution.Status = "failed"
-			execution.Error = fmt.Sprintf("Step %d failed: %v", i+1, err)
-			return execution, nil
+			execution.Error = fmt.Sprintf("Deployment cancelled before step %d: %v", i+1, err)
+		})
+		return
+	}
+}
+
+// dependenciesCompleted reports whether every step of indexes completed
+func dependenciesCompleted(indexes []int, completed []bool) bool {
+	for _, i := range indexes {
+		if !completed[i] {
+			return false
 		}
+	}
+	return true
+}
+
+// runStep executes a step of a run and records how it ended. Post-deploy steps
+// of installed charts run before the steps depending on it start.
+func (s *DeploymentExecutorService) runStep(run *executionRun, index int, step agent.DeploymentStep, kubeconfig string) error {
+	run.update(index, func(execution *agent.DeploymentExecution) {
+		execution.Steps[index].Status = "running"
+		execution.Steps[index].StartTime = &time.Time{}
+		*execution.Steps[index].StartTime = time.Now()
+		execution.Logs = append(execution.Logs, fmt.Sprintf("Executing step %d: %s", index+1, execution.Steps[index].StepID))
+	})
+
+	err := s.executeStepWithRetry(run, index, step, kubeconfig)
+
+	if err != nil && run.aborted() {
+		run.update(index, func(execution *agent.DeploymentExecution) {
+			execution.Steps[index].Status = "aborted"
+			execution.Steps[index].Error = err.Error()
+			execution.Steps[index].EndTime = &time.Time{}
+			*execution.Steps[index].EndTime = time.Now()
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Step %d aborted", index+1))
+		})
+		return err
+	}
+	if err != nil {
+		run.update(index, func(execution *agent.DeploymentExecution) {
+			execution.Steps[index].Status = "failed"
+			execution.Steps[index].Error = err.Error()
+			execution.Steps[index].EndTime = &time.Time{}
+			*execution.Steps[index].EndTime = time.Now()
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Step %d failed: %v", index+1, err))
+			// Steps running alongside may fail too; the first failure fails the execution
+			if execution.Status == "running" {
+				execution.Status = "failed"
+				execution.Error = fmt.Sprintf("Step %d failed: %v", index+1, err)
+			}
+		})
+		return err
+	}
+
+	run.update(index, func(execution *agent.DeploymentExecution) {
+		execution.Steps[index].Status = "completed"
+		execution.Steps[index].EndTime = &time.Time{}
+		*execution.Steps[index].EndTime = time.Now()
+		execution.Logs = append(execution.Logs, fmt.Sprintf("Step %d completed successfully", index+1))
+	})
 
-		execution.Steps[i].Status = "completed"
-		execution.Steps[i].EndTime = &time.Time{}
-		*execution.Steps[i].EndTime = time.Now()
+	s.runPostDeploySteps(context.WithoutCancel(run.ctx), run, step, kubeconfig)
+	return nil
+}
 
-		execution.Logs = append(execution.Logs, fmt.Sprintf("Step %d completed successfully", i+1))
+// executeStepWithRetry runs a step up to its retry policy's attempt limit, backing
+// off exponentially between attempts
+func (s *DeploymentExecutorService) executeStepWithRetry(run *executionRun, index int, step agent.DeploymentStep, kubeconfig string) error {
+	ctx := run.ctx
+	stepExec := run.step(index)
+	maxAttempts := stepExec.Retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
 	}
 
-	execution.Status = "completed"
-	execution.EndTime = &time.Time{}
-	*execution.EndTime = time.Now()
-	execution.Logs = append(execution.Logs, "Deployment completed successfully")
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			backoff := stepExec.Retry.Backoff(attempt - 1)
+			run.log(fmt.Sprintf("Retrying %s in %s (attempt %d/%d)", stepExec.StepID, backoff, attempt, maxAttempts))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-run.stepCtx.Done():
+				return context.Cause(run.stepCtx)
+			case <-time.After(backoff):
+			}
+		}
 
-	return execution, nil
+		stepExec.Attempts++
+		err = s.executeStep(run.stepCtx, &stepExec, step, kubeconfig)
+		if err != nil {
+			stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Attempt %d failed: %v", stepExec.Attempts, err))
+		}
+		// Failed attempts that are retried are reported here, the caller reports
+		// how the step ended
+		stored := stepExec
+		stored.Logs = append([]string(nil), stepExec.Logs...)
+		store := func(execution *agent.DeploymentExecution) { execution.Steps[index] = stored }
+		if err != nil && attempt < maxAttempts {
+			run.update(index, store)
+		} else {
+			run.apply(store)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
 }
 
 // executeStep executes a single deployment step
-func (s *DeploymentExecutorService) executeStep(ctx context.Context, stepExec *agent.DeploymentStepExecution, step agent.DeploymentStep, kubeconfig string) error {
+func (s *DeploymentExecutorService) executeStep(ctx context.Context, stepExec *agent.DeploymentStepExecution, step agent.DeploymentStep, kubeconfig string) (err error) {
+	ctx, span := tracing.Start(ctx, "deployment.step",
+		attribute.String("deployment.step_id", step.ID),
+		attribute.Int("deployment.step_attempt", stepExec.Attempts),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	// Add step start log
 	stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Starting: %s", step.Description))
 
+	// Raw manifests go straight to the API server
+	if step.Manifest != "" {
+		if err := s.applyManifest(step, kubeconfig, stepExec); err != nil {
+			return fmt.Errorf("manifest apply failed: %w", err)
+		}
+		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Completed: %s", step.Description))
+		return nil
+	}
+
 	// Check if Helm is installed
 	if err := s.ensureHelmInstalled(); err != nil {
 		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Helm installation check failed: %v", err))
 		return fmt.Errorf("helm not available: %w", err)
 	}
 
-	// Add Helm repository if needed
-	if step.Chart != nil {
-		if err := s.addHelmRepository(step.Chart.Repository); err != nil {
-			stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Failed to add repository: %v", err))
-			return fmt.Errorf("failed to add helm repository: %w", err)
-		}
-		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Added repository: %s", step.Chart.Repository))
-	}
-
 	// Execute the deployment command
 	if step.Command != "" {
 		if err := s.executeCommand(ctx, step.Command, stepExec); err != nil {
@@ -108,7 +571,15 @@ func (s *DeploymentExecutorService) executeStep(ctx context.Context, stepExec *a
 		}
 	} else if step.Chart != nil {
 		// Deploy using Helm
-		if err := s.deployHelmChart(ctx, step.Chart, kubeconfig, stepExec); err != nil {
+		helmCtx, helmSpan := tracing.Start(ctx, "helm.install",
+			attribute.String("helm.chart", step.Chart.Name),
+			attribute.String("helm.chart_version", step.Chart.Version),
+			attribute.String("helm.release", releaseName(step.Chart)),
+			attribute.String("k8s.namespace.name", step.Chart.Namespace),
+		)
+		err := s.deployHelmChart(helmCtx, step, kubeconfig, stepExec)
+		tracing.End(helmSpan, err)
+		if err != nil {
 			return fmt.Errorf("helm deployment failed: %w", err)
 		}
 	}
@@ -117,7 +588,13 @@ func (s *DeploymentExecutorService) executeStep(ctx context.Context, stepExec *a
 	return nil
 }
 
-// ensureHelmInstalled checks if Helm is installed and installs it if needed
+// ensureHelmInstalled checks if Helm is installed and installs it if needed.
+//
+// Installs, upgrades, tests, uninstalls and renders run the helm CLI. The
+// executor has driven the binary from the start, aborts stop a step by
+// killing its helm process, and registry logins are per-deployment helm
+// registry config files. Release listings for upgrade checks use the Helm
+// SDK, which doesn't need the binary.
 func (s *DeploymentExecutorService) ensureHelmInstalled() error {
 	// Check if helm command is available
 	if _, err := exec.LookPath("helm"); err == nil {
@@ -150,73 +627,245 @@ func (s *DeploymentExecutorService) installHelm() error {
 	return nil
 }
 
-// addHelmRepository adds a Helm repository
-func (s *DeploymentExecutorService) addHelmRepository(repoURL string) error {
-	// Check if repository already exists
-	checkCmd := exec.Command("helm", "repo", "list")
-	output, err := checkCmd.Output()
+// deployHelmChart installs a step's chart, or upgrades its release when it
+// already exists. Upgrades keep the release's existing values unless the chart
+// carries its own, and releases of other charts are never taken over.
+func (s *DeploymentExecutorService) deployHelmChart(ctx context.Context, step agent.DeploymentStep, kubeconfig string, stepExec *agent.DeploymentStepExecution) error {
+	chart := step.Chart
+	upgrade := step.Action == "upgrade"
+
+	// Write kubeconfig to a temporary file for the helm CLI
+	kubeconfigFile, err := writeKubeconfigFile(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to create kubeconfig file: %w", err)
+	}
+	defer s.cleanupValuesFile(kubeconfigFile)
+
+	// Set KUBECONFIG environment variable
+	env := append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", kubeconfigFile))
+
+	namespace := chart.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	existing, err := findHelmRelease(ctx, env, releaseName(chart), namespace)
+	if err != nil {
+		stepExec.Logs = append(stepExec.Logs, err.Error())
+		return err
+	}
+	if existing != nil {
+		if existing.Chart != chartName(chart) {
+			return fmt.Errorf("release %s in namespace %s belongs to chart %s, not %s", existing.Name, namespace, existing.Chart, chartName(chart))
+		}
+		if strings.HasPrefix(existing.Status, "pending-") {
+			return fmt.Errorf("release %s in namespace %s has an operation in progress (%s)", existing.Name, namespace, existing.Status)
+		}
+		// Only a first attempt can find a release from before the deployment
+		if stepExec.Attempts == 1 {
+			stepExec.ExistingRelease = true
+		}
+		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Release %s exists at revision %s (%s %s, %s), upgrading it", existing.Name, existing.Revision, existing.Chart, existing.ChartVersion, existing.Status))
+	} else if upgrade {
+		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Release %s does not exist, installing it", releaseName(chart)))
+	}
+
+	// Upgrade-or-install also lets retries pick up a release a previous attempt left behind
+	reference, err := s.helmService.chartReference(chart)
 	if err != nil {
-		return fmt.Errorf("failed to check helm repos: %w", err)
+		stepExec.Logs = append(stepExec.Logs, err.Error())
+		return err
 	}
+	args := []string{"upgrade", "--install", releaseName(chart)}
+	args = append(args, reference...)
 
-	if strings.Contains(string(output), repoURL) {
-		return nil // Repository already exists
+	registryArgs, cleanup, err := registryLogin(ctx, chart)
+	if err != nil {
+		stepExec.Logs = append(stepExec.Logs, err.Error())
+		return err
+	}
+	defer cleanup()
+	args = append(args, registryArgs...)
+
+	if upgrade && existing != nil && len(chart.Values) == 0 {
+		args = append(args, "--reuse-values")
+	} else {
+		// Secrets only exist in the temporary values file, never in the plan
+		values, resolved, err := s.secrets.ResolveValues(ctx, chart.Values, kubeconfig)
+		if err != nil {
+			stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Failed to resolve secret references: %v", err))
+			return fmt.Errorf("failed to resolve secret references: %w", err)
+		}
+		if resolved > 0 {
+			stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Resolved %d secret references", resolved))
+		}
+
+		// Create temporary values file
+		valuesFile, err := s.createValuesFile(values)
+		if err != nil {
+			return fmt.Errorf("failed to create values file: %w", err)
+		}
+		defer s.cleanupValuesFile(valuesFile)
+		args = append(args, "--values", valuesFile)
+	}
+
+	if chart.Version != "" {
+		args = append(args, "--version", chart.Version)
+	}
+	if chart.Namespace != "" {
+		args = append(args, "--namespace", chart.Namespace, "--create-namespace")
 	}
+	args = append(args, "--wait", "--timeout", "10m")
+	if step.Atomic {
+		args = append(args, "--atomic")
+	}
+	if step.HistoryMax > 0 {
+		args = append(args, "--history-max", strconv.Itoa(step.HistoryMax))
+	}
+
+	// Execute helm install command
+	installCmd := exec.CommandContext(ctx, "helm", args...)
+	installCmd.Env = env
+	installCmd.WaitDelay = abortWaitDelay
 
-	// Add repository
-	repoName := s.extractRepoName(repoURL)
-	addCmd := exec.Command("helm", "repo", "add", repoName, repoURL)
-	if err := addCmd.Run(); err != nil {
-		return fmt.Errorf("failed to add helm repository: %w", err)
+	operation, done := "install", "installed"
+	if existing != nil {
+		operation, done = "upgrade", "upgraded"
 	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("helm.operation", operation))
+	stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Running helm %s for chart %s from %s", operation, chart.Name, chart.Repository))
 
-	// Update repositories
-	updateCmd := exec.Command("helm", "repo", "update")
-	if err := updateCmd.Run(); err != nil {
-		return fmt.Errorf("failed to update helm repos: %w", err)
+	output, err := installCmd.CombinedOutput()
+	if err != nil {
+		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Helm %s failed: %v", operation, string(output)))
+		if step.Atomic {
+			stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Helm rolled release %s back", releaseName(chart)))
+		}
+		return fmt.Errorf("helm %s failed: %w", operation, err)
 	}
 
+	stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Chart %s successfully: %s", done, string(output)))
 	return nil
 }
 
-// extractRepoName extracts a repository name from URL
-func (s *DeploymentExecutorService) extractRepoName(repoURL string) string {
-	// Simple extraction - in production, you might want more sophisticated logic
-	if strings.Contains(repoURL, "github.com") {
-		parts := strings.Split(repoURL, "/")
-		if len(parts) >= 3 {
-			return parts[len(parts)-1]
+// findHelmRelease returns a release in a namespace, in any state, or nil when
+// it doesn't exist
+func findHelmRelease(ctx context.Context, env []string, name, namespace string) (*HelmRelease, error) {
+	cmd := exec.CommandContext(ctx, "helm", "list", "--namespace", namespace, "--filter", "^"+regexp.QuoteMeta(name)+"$", "--all", "--output", "json")
+	cmd.Env = env
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to look up release %s: %s", name, strings.TrimSpace(stderr.String()))
+	}
+
+	var releases []HelmRelease
+	if err := json.Unmarshal([]byte(stdout.String()), &releases); err != nil {
+		return nil, fmt.Errorf("failed to parse helm list output: %w", err)
+	}
+	for _, release := range releases {
+		if release.Name == name {
+			release.Chart, release.ChartVersion = splitChartVersion(release.Chart)
+			return &release, nil
 		}
 	}
-	return "repo"
+	return nil, nil
 }
 
-// deployHelmChart deploys a Helm chart
-func (s *DeploymentExecutorService) deployHelmChart(ctx context.Context, chart *agent.HelmChart, kubeconfig string, stepExec *agent.DeploymentStepExecution) error {
-	// Create temporary values file
-	valuesFile, err := s.createValuesFile(chart.Values)
-	if err != nil {
-		return fmt.Errorf("failed to create values file: %w", err)
+// CheckReleaseCollisions returns an error when two chart steps of a plan
+// deploy the same release, which would make the second overwrite the first
+func CheckReleaseCollisions(plan *agent.DeploymentPlan) error {
+	steps := make(map[string]string)
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		namespace := step.Chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		release := namespace + "/" + releaseName(step.Chart)
+		if other, ok := steps[release]; ok && step.Action != "upgrade" {
+			return fmt.Errorf("steps %s and %s both install release %s", other, step.ID, release)
+		}
+		steps[release] = step.ID
 	}
-	defer s.cleanupValuesFile(valuesFile)
+	return nil
+}
 
-	// Set KUBECONFIG environment variable
-	env := []string{fmt.Sprintf("KUBECONFIG=%s", kubeconfig)}
+// releaseName returns the Helm release name for a chart
+func releaseName(chart *agent.HelmChart) string {
+	if chart.ReleaseName != "" {
+		return chart.ReleaseName
+	}
+	if strings.HasPrefix(chart.Name, "oci://") {
+		return chart.Name[strings.LastIndex(chart.Name, "/")+1:]
+	}
+	return chart.Name
+}
 
-	// Execute helm install command
-	installCmd := exec.CommandContext(ctx, "helm", "install", chart.Name, chart.Repository+"/"+chart.Name,
-		"--values", valuesFile, "--wait", "--timeout", "10m")
-	installCmd.Env = env
+// chartName returns the name of a chart as Helm records it on releases
+func chartName(chart *agent.HelmChart) string {
+	if IsOCIChart(chart) {
+		reference := ociChartReference(chart)
+		return reference[strings.LastIndex(reference, "/")+1:]
+	}
+	return chart.Name
+}
+
+// chartReference returns the helm arguments that locate a chart: repository URLs
+// are passed with --repo, oci:// registries as a full reference, and anything
+// else is treated as a repo alias. Charts of mirrored repositories are pulled
+// from their mirror.
+func (s *HelmService) chartReference(chart *agent.HelmChart) ([]string, error) {
+	repository, err := s.network.chartRepository(chart)
+	if err != nil {
+		return nil, err
+	}
+	if repository != chart.Repository {
+		mirrored := *chart
+		mirrored.Repository = repository
+		chart = &mirrored
+	}
 
-	stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Installing chart: %s from %s", chart.Name, chart.Repository))
+	if IsOCIChart(chart) {
+		return []string{ociChartReference(chart)}, nil
+	}
+	if strings.HasPrefix(chart.Repository, "http://") || strings.HasPrefix(chart.Repository, "https://") {
+		return []string{chart.Name, "--repo", chart.Repository}, nil
+	}
+	return []string{chart.Repository + "/" + chart.Name}, nil
+}
 
-	output, err := installCmd.CombinedOutput()
+// applyManifest server-side applies a step's raw manifest, logging the outcome of each object
+func (s *DeploymentExecutorService) applyManifest(step agent.DeploymentStep, kubeconfig string, stepExec *agent.DeploymentStepExecution) error {
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+
+	results, err := client.ApplyManifest(step.Manifest, step.Namespace)
 	if err != nil {
-		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Helm install failed: %v", string(output)))
-		return fmt.Errorf("helm install failed: %w", err)
+		return err
 	}
 
-	stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Chart installed successfully: %s", string(output)))
+	failed := 0
+	for _, result := range results {
+		object := result.Kind + "/" + result.Name
+		if result.Namespace != "" {
+			object = result.Namespace + "/" + object
+		}
+		if result.Action == "failed" {
+			failed++
+			stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("%s failed: %s", object, result.Error))
+			continue
+		}
+		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("%s %s", object, result.Action))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects failed to apply", failed, len(results))
+	}
 	return nil
 }
 
@@ -231,6 +880,7 @@ func (s *DeploymentExecutorService) executeCommand(ctx context.Context, command
 	}
 
 	cmd := exec.CommandContext(ctx, parts[0], parts[1:]...)
+	cmd.WaitDelay = abortWaitDelay
 	output, err := cmd.CombinedOutput()
 
 	if err != nil {
@@ -242,43 +892,103 @@ func (s *DeploymentExecutorService) executeCommand(ctx context.Context, command
 	return nil
 }
 
+// RenderChart renders a chart with its generated values using helm template
+func (s *DeploymentExecutorService) RenderChart(ctx context.Context, chart *agent.HelmChart, namespace string) (string, error) {
+	return s.renderChart(ctx, chart, namespace)
+}
+
+// RenderChartWithCRDs renders a chart like RenderChart, including the CRDs of
+// its crds/ directory
+func (s *DeploymentExecutorService) RenderChartWithCRDs(ctx context.Context, chart *agent.HelmChart, namespace string) (string, error) {
+	return s.renderChart(ctx, chart, namespace, "--include-crds")
+}
+
+func (s *DeploymentExecutorService) renderChart(ctx context.Context, chart *agent.HelmChart, namespace string, extraArgs ...string) (string, error) {
+	if err := s.ensureHelmInstalled(); err != nil {
+		return "", fmt.Errorf("helm not available: %w", err)
+	}
+
+	valuesFile, err := s.createValuesFile(chart.Values)
+	if err != nil {
+		return "", fmt.Errorf("failed to create values file: %w", err)
+	}
+	defer s.cleanupValuesFile(valuesFile)
+
+	registryArgs, cleanup, err := registryLogin(ctx, chart)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	reference, err := s.helmService.chartReference(chart)
+	if err != nil {
+		return "", err
+	}
+	args := append([]string{"template", releaseName(chart)}, reference...)
+	args = append(args, registryArgs...)
+	args = append(args, "--values", valuesFile)
+	if chart.Version != "" {
+		args = append(args, "--version", chart.Version)
+	}
+	if namespace != "" {
+		args = append(args, "--namespace", namespace)
+	}
+	args = append(args, extraArgs...)
+
+	cmd := exec.CommandContext(ctx, "helm", args...)
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("helm template failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
 // createValuesFile creates a temporary values file
 func (s *DeploymentExecutorService) createValuesFile(values map[string]interface{}) (string, error) {
-	// For now, create a simple values file
-	// In production, you'd want to use a proper YAML library
-	content := "# Generated values file\n"
+	if values == nil {
+		values = map[string]interface{}{}
+	}
 
-	// Add some basic values
-	if values != nil {
-		for key, value := range values {
-			content += fmt.Sprintf("%s: %v\n", key, value)
-		}
+	content, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode values: %w", err)
+	}
+
+	file, err := os.CreateTemp("", "values-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("failed to create values file: %w", err)
 	}
+	defer file.Close()
 
-	// Create temporary file
-	filename := fmt.Sprintf("/tmp/values-%d.yaml", time.Now().Unix())
-	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+	if _, err := file.Write(append([]byte("# Generated values file\n"), content...)); err != nil {
 		return "", fmt.Errorf("failed to write values file: %w", err)
 	}
 
-	return filename, nil
+	return file.Name(), nil
 }
 
-// cleanupValuesFile removes the temporary values file
-func (s *DeploymentExecutorService) cleanupValuesFile(filename string) {
-	os.Remove(filename)
-}
+// writeKubeconfigFile writes a kubeconfig to a temporary file readable only by the backend
+func writeKubeconfigFile(kubeconfig string) (string, error) {
+	file, err := os.CreateTemp("", "kubeconfig-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create kubeconfig file: %w", err)
+	}
+	defer file.Close()
 
-// AbortDeployment aborts a running deployment
-func (s *DeploymentExecutorService) AbortDeployment(ctx context.Context, executionID string) error {
-	// This would implement deployment abortion logic
-	// For now, we'll just return success
-	return nil
+	if err := file.Chmod(0600); err != nil {
+		return "", fmt.Errorf("failed to secure kubeconfig file: %w", err)
+	}
+	if _, err := file.WriteString(kubeconfig); err != nil {
+		return "", fmt.Errorf("failed to write kubeconfig file: %w", err)
+	}
+
+	return file.Name(), nil
 }
 
-// GetDeploymentStatus gets the current status of a deployment
-func (s *DeploymentExecutorService) GetDeploymentStatus(executionID string) (*agent.DeploymentExecution, error) {
-	// This would retrieve deployment status from storage
-	// For now, return nil
-	return nil, nil
+// cleanupValuesFile removes the temporary values file
+func (s *DeploymentExecutorService) cleanupValuesFile(filename string) {
+	os.Remove(filename)
 }
@@ -0,0 +1,411 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisDeploymentLockPrefix namespaces deployment locks in a shared Redis
+const redisDeploymentLockPrefix = "deployment-lock:"
+
+// defaultDeploymentLockTTL is how long locks last unless refreshed, when the
+// locker isn't given a duration
+const defaultDeploymentLockTTL = time.Minute
+
+// deploymentLockPollInterval is how often a queued deployment retries its locks
+const deploymentLockPollInterval = time.Second
+
+// DeploymentLock is a cluster namespace locked by a running deployment
+type DeploymentLock struct {
+	ClusterID uint   `json:"cluster_id"`
+	Namespace string `json:"namespace"`
+	UserID    uint   `json:"user_id"`
+	PlanID    string `json:"plan_id"`
+	// ExecutionID is set once the deployment started
+	ExecutionID string    `json:"execution_id,omitempty"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	owner       string
+}
+
+// DeploymentLockedError stops a deployment to namespaces another deployment holds
+type DeploymentLockedError struct {
+	Locks []DeploymentLock
+}
+
+func (e *DeploymentLockedError) Error() string {
+	held := make([]string, 0, len(e.Locks))
+	for _, lock := range e.Locks {
+		holder := "plan " + lock.PlanID
+		if lock.ExecutionID != "" {
+			holder = "deployment " + lock.ExecutionID
+		}
+		held = append(held, fmt.Sprintf("namespace %s is being deployed to by %s", lock.Namespace, holder))
+	}
+	return "another deployment is running on the cluster: " + strings.Join(held, "; ")
+}
+
+// Owner is the token of the lease holding the lock
+func (l DeploymentLock) Owner() string {
+	return l.owner
+}
+
+// DeploymentLockStore keeps locks until they are released or expire. Stores are
+// shared by every API replica and worker process, so their deployments see
+// each other's locks.
+type DeploymentLockStore interface {
+	// Acquire takes a free lock and returns nil, or returns the holder
+	Acquire(ctx context.Context, key string, lock DeploymentLock, ttl time.Duration) (*DeploymentLock, error)
+	// Refresh extends a lock the owner holds and stores it as given
+	Refresh(ctx context.Context, key string, lock DeploymentLock, ttl time.Duration) error
+	Release(ctx context.Context, key, owner string) error
+	// List returns the locks whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]DeploymentLock, error)
+}
+
+// DeploymentLocker keeps two deployments from changing the same cluster
+// namespace at once. Locks expire unless the deployment holding them keeps
+// refreshing them, so a crashed replica doesn't hold them forever.
+type DeploymentLocker struct {
+	store DeploymentLockStore
+	ttl   time.Duration
+	// wait is how long a deployment queues for held locks; 0 rejects it
+	wait time.Duration
+}
+
+// NewDeploymentLocker creates a locker keeping its locks in store
+func NewDeploymentLocker(store DeploymentLockStore, ttl, wait time.Duration) *DeploymentLocker {
+	if ttl <= 0 {
+		ttl = defaultDeploymentLockTTL
+	}
+	return &DeploymentLocker{store: store, ttl: ttl, wait: wait}
+}
+
+// NewRedisLockStore creates a lock store in the Redis at redisURL
+func NewRedisLockStore(redisURL string) (DeploymentLockStore, error) {
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	return &redisLockStore{client: redis.NewClient(options)}, nil
+}
+
+// Lock locks the namespaces of a cluster a plan deploys to, all or none. Held
+// locks are waited for up to the locker's wait, then a DeploymentLockedError
+// names their holders.
+func (l *DeploymentLocker) Lock(ctx context.Context, clusterID uint, namespaces []string, userID uint, planID string) (*DeploymentLease, error) {
+	owner, err := lockOwner()
+	if err != nil {
+		return nil, err
+	}
+	lease := &DeploymentLease{locker: l, stop: make(chan struct{})}
+	for _, namespace := range namespaces {
+		lease.locks = append(lease.locks, DeploymentLock{
+			ClusterID: clusterID,
+			Namespace: namespace,
+			UserID:    userID,
+			PlanID:    planID,
+			owner:     owner,
+		})
+	}
+
+	deadline := time.Now().Add(l.wait)
+	for {
+		held, err := lease.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(held) == 0 {
+			go lease.keepAlive()
+			return lease, nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil, &DeploymentLockedError{Locks: held}
+		}
+		ReportProgress(ctx, 0, fmt.Sprintf("Waiting for the deployment holding namespace %s", held[0].Namespace))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(deploymentLockPollInterval):
+		}
+	}
+}
+
+// Locks returns the held locks of a cluster's namespaces
+func (l *DeploymentLocker) Locks(ctx context.Context, clusterID uint) ([]DeploymentLock, error) {
+	locks, err := l.store.List(ctx, fmt.Sprintf("%d/", clusterID))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Namespace < locks[j].Namespace })
+	return locks, nil
+}
+
+// DeploymentLease holds the locks of a deployment until it is released
+type DeploymentLease struct {
+	locker *DeploymentLocker
+	mu     sync.Mutex
+	locks  []DeploymentLock
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// acquire takes the lease's locks, or none of them and returns their holders.
+// Namespaces are locked in order, so deployments locking several don't
+// deadlock waiting for each other.
+func (d *DeploymentLease) acquire(ctx context.Context) ([]DeploymentLock, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	var held []DeploymentLock
+	acquired := 0
+	for i := range d.locks {
+		d.locks[i].AcquiredAt = now
+		d.locks[i].ExpiresAt = now.Add(d.locker.ttl)
+		holder, err := d.locker.store.Acquire(ctx, lockKey(d.locks[i]), d.locks[i], d.locker.ttl)
+		if err != nil {
+			d.releaseFirst(acquired)
+			return nil, fmt.Errorf("failed to lock namespace %s: %w", d.locks[i].Namespace, err)
+		}
+		if holder != nil {
+			held = append(held, *holder)
+			continue
+		}
+		if len(held) > 0 {
+			// Later namespaces are only locked while the earlier ones are
+			d.releaseLock(d.locks[i])
+			continue
+		}
+		acquired++
+	}
+	if len(held) > 0 {
+		d.releaseFirst(acquired)
+	}
+	return held, nil
+}
+
+// Attach records the execution holding the locks once the deployment started
+func (d *DeploymentLease) Attach(executionID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.locks {
+		d.locks[i].ExecutionID = executionID
+	}
+	d.refresh()
+}
+
+// Locks returns the locks the lease holds
+func (d *DeploymentLease) Locks() []DeploymentLock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]DeploymentLock(nil), d.locks...)
+}
+
+// Release releases the lease's locks; releasing it again does nothing
+func (d *DeploymentLease) Release() {
+	d.once.Do(func() {
+		close(d.stop)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.releaseFirst(len(d.locks))
+	})
+}
+
+// keepAlive refreshes the locks until the lease is released
+func (d *DeploymentLease) keepAlive() {
+	ticker := time.NewTicker(d.locker.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+			d.mu.Lock()
+			d.refresh()
+			d.mu.Unlock()
+		}
+	}
+}
+
+// refresh extends the locks; the caller holds d.mu
+func (d *DeploymentLease) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	expiresAt := time.Now().Add(d.locker.ttl)
+	for i := range d.locks {
+		d.locks[i].ExpiresAt = expiresAt
+		if err := d.locker.store.Refresh(ctx, lockKey(d.locks[i]), d.locks[i], d.locker.ttl); err != nil {
+			fmt.Printf("Failed to refresh deployment lock of namespace %s on cluster %d: %v\n", d.locks[i].Namespace, d.locks[i].ClusterID, err)
+		}
+	}
+}
+
+// releaseFirst releases the first n locks; the caller holds d.mu
+func (d *DeploymentLease) releaseFirst(n int) {
+	for _, lock := range d.locks[:n] {
+		d.releaseLock(lock)
+	}
+}
+
+func (d *DeploymentLease) releaseLock(lock DeploymentLock) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := d.locker.store.Release(ctx, lockKey(lock), lock.owner); err != nil {
+		fmt.Printf("Failed to release deployment lock of namespace %s on cluster %d: %v\n", lock.Namespace, lock.ClusterID, err)
+	}
+}
+
+type deploymentLeaseKey struct{}
+
+// WithDeploymentLease returns a context carrying the lease of a deployment
+func WithDeploymentLease(ctx context.Context, lease *DeploymentLease) context.Context {
+	return context.WithValue(ctx, deploymentLeaseKey{}, lease)
+}
+
+// DeploymentLeaseFrom returns the lease of the deployment running with ctx, or nil
+func DeploymentLeaseFrom(ctx context.Context) *DeploymentLease {
+	lease, _ := ctx.Value(deploymentLeaseKey{}).(*DeploymentLease)
+	return lease
+}
+
+// PlanNamespaces returns the namespaces a plan's charts and manifests are
+// deployed to, sorted
+func PlanNamespaces(plan *agent.DeploymentPlan) []string {
+	seen := map[string]bool{}
+	for _, step := range plan.Steps {
+		switch {
+		case step.Chart != nil:
+			seen[chartNamespace(step.Chart)] = true
+		case step.Manifest != "":
+			namespace := step.Namespace
+			if namespace == "" {
+				namespace = "default"
+			}
+			seen[namespace] = true
+		}
+	}
+	namespaces := make([]string, 0, len(seen))
+	for namespace := range seen {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// lockKey is the store key of a cluster namespace's lock
+func lockKey(lock DeploymentLock) string {
+	return fmt.Sprintf("%d/%s", lock.ClusterID, lock.Namespace)
+}
+
+// lockOwner returns a random token telling the locks of a lease from others
+func lockOwner() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate lock owner: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// redisLockStore keeps locks in Redis, shared by every backend replica. A
+// lock is a hash of its owner and its JSON-encoded DeploymentLock.
+type redisLockStore struct {
+	client *redis.Client
+}
+
+var (
+	// redisAcquireLock sets a lock unless it exists, else returns its holder
+	redisAcquireLock = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.call("HGET", KEYS[1], "lock")
+end
+redis.call("HSET", KEYS[1], "owner", ARGV[1], "lock", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return false
+`)
+	// redisRefreshLock updates and extends a lock its owner holds
+	redisRefreshLock = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "owner") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "lock", ARGV[2])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+	// redisReleaseLock deletes a lock its owner holds
+	redisReleaseLock = redis.NewScript(`
+if redis.call("HGET", KEYS[1], "owner") == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+func (s *redisLockStore) Acquire(ctx context.Context, key string, lock DeploymentLock, ttl time.Duration) (*DeploymentLock, error) {
+	encoded, err := json.Marshal(lock)
+	if err != nil {
+		return nil, err
+	}
+	holder, err := redisAcquireLock.Run(ctx, s.client, []string{redisDeploymentLockPrefix + key}, lock.owner, encoded, ttl.Milliseconds()).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var held DeploymentLock
+	if err := json.Unmarshal([]byte(holder), &held); err != nil {
+		return nil, fmt.Errorf("failed to decode lock %s: %w", key, err)
+	}
+	return &held, nil
+}
+
+func (s *redisLockStore) Refresh(ctx context.Context, key string, lock DeploymentLock, ttl time.Duration) error {
+	encoded, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	refreshed, err := redisRefreshLock.Run(ctx, s.client, []string{redisDeploymentLockPrefix + key}, lock.owner, encoded, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if refreshed == 0 {
+		return fmt.Errorf("lock %s was lost", key)
+	}
+	return nil
+}
+
+func (s *redisLockStore) Release(ctx context.Context, key, owner string) error {
+	return redisReleaseLock.Run(ctx, s.client, []string{redisDeploymentLockPrefix + key}, owner).Err()
+}
+
+func (s *redisLockStore) List(ctx context.Context, prefix string) ([]DeploymentLock, error) {
+	var locks []DeploymentLock
+	iter := s.client.Scan(ctx, 0, redisDeploymentLockPrefix+prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		encoded, err := s.client.HGet(ctx, iter.Val(), "lock").Result()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var lock DeploymentLock
+		if err := json.Unmarshal([]byte(encoded), &lock); err != nil {
+			return nil, fmt.Errorf("failed to decode lock %s: %w", iter.Val(), err)
+		}
+		locks = append(locks, lock)
+	}
+	return locks, iter.Err()
+}
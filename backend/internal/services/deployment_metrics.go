@@ -0,0 +1,266 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// ChartRun is the outcome of installing or upgrading one chart
+type ChartRun struct {
+	StepID       string
+	Chart        string
+	ChartVersion string
+	Action       string
+	Status       string
+	Duration     time.Duration
+	Attempts     int
+	Error        string
+	Signature    string
+	StartedAt    time.Time
+}
+
+// ChartStats aggregates the install history of a chart
+type ChartStats struct {
+	Chart       string              `json:"chart"`
+	Runs        int                 `json:"runs"`
+	Failures    int                 `json:"failures"`
+	FailureRate float64             `json:"failure_rate"`
+	Durations   DurationPercentiles `json:"durations"`
+	// Signatures lists the most common failure signatures, most frequent first
+	Signatures []FailureSignatureCount `json:"signatures"`
+}
+
+// DurationPercentiles summarizes successful install durations in seconds
+type DurationPercentiles struct {
+	Samples int     `json:"samples"`
+	Mean    float64 `json:"mean"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Max     float64 `json:"max"`
+}
+
+// FailureSignatureCount counts failures sharing a normalized error
+type FailureSignatureCount struct {
+	Signature string    `json:"signature"`
+	Count     int       `json:"count"`
+	Example   string    `json:"example"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// maxSignaturesPerChart bounds the failure signatures reported per chart
+const maxSignaturesPerChart = 5
+
+// Charts without history are assumed to take this long when estimating a plan
+const (
+	defaultChartEstimateLow  = 3 * time.Minute
+	defaultChartEstimateHigh = 5 * time.Minute
+)
+
+// ChartRuns extracts the finished chart steps of an execution
+func ChartRuns(plan *agent.DeploymentPlan, execution *agent.DeploymentExecution) []ChartRun {
+	steps := make(map[string]agent.DeploymentStep, len(plan.Steps))
+	for _, step := range plan.Steps {
+		steps[step.ID] = step
+	}
+
+	var runs []ChartRun
+	for _, stepExec := range execution.Steps {
+		step, ok := steps[stepExec.StepID]
+		if !ok || step.Chart == nil || stepExec.StartTime == nil || stepExec.EndTime == nil {
+			continue
+		}
+		if stepExec.Status != "completed" && stepExec.Status != "failed" {
+			continue
+		}
+
+		action := step.Action
+		if action == "" {
+			action = "install"
+		}
+		runs = append(runs, ChartRun{
+			StepID:       stepExec.StepID,
+			Chart:        step.Chart.Name,
+			ChartVersion: step.Chart.Version,
+			Action:       action,
+			Status:       stepExec.Status,
+			Duration:     stepExec.EndTime.Sub(*stepExec.StartTime),
+			Attempts:     stepExec.Attempts,
+			Error:        stepExec.Error,
+			Signature:    FailureSignature(stepExec.Error),
+			StartedAt:    *stepExec.StartTime,
+		})
+	}
+	return runs
+}
+
+var signatureReplacements = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`https?://[^\s"']+`), "<url>"},
+	{regexp.MustCompile(`(/[\w.-]+){2,}`), "<path>"},
+	{regexp.MustCompile(`"[^"]*"`), `"<str>"`},
+	{regexp.MustCompile(`\b[a-z0-9]+(-[a-z0-9]+)*-[a-z0-9]{8,10}-[a-z0-9]{5}\b`), "<pod>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{12,}\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)*(ms|s|m|h)?\b`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// FailureSignature normalizes an error message so failures that differ only in
+// names, addresses, durations or identifiers compare equal
+func FailureSignature(message string) string {
+	if message == "" {
+		return ""
+	}
+	signature := strings.ToLower(strings.TrimSpace(message))
+	for _, r := range signatureReplacements {
+		signature = r.pattern.ReplaceAllString(signature, r.replacement)
+	}
+	if len(signature) > 300 {
+		signature = signature[:300]
+	}
+	return strings.TrimSpace(signature)
+}
+
+// SummarizeChartRuns aggregates runs per chart, ordered by number of runs
+func SummarizeChartRuns(runs []ChartRun) []ChartStats {
+	byChart := make(map[string][]ChartRun)
+	for _, run := range runs {
+		byChart[run.Chart] = append(byChart[run.Chart], run)
+	}
+
+	stats := make([]ChartStats, 0, len(byChart))
+	for chart, chartRuns := range byChart {
+		stats = append(stats, summarizeChart(chart, chartRuns))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Runs != stats[j].Runs {
+			return stats[i].Runs > stats[j].Runs
+		}
+		return stats[i].Chart < stats[j].Chart
+	})
+	return stats
+}
+
+func summarizeChart(chart string, runs []ChartRun) ChartStats {
+	stats := ChartStats{Chart: chart, Runs: len(runs), Signatures: []FailureSignatureCount{}}
+
+	var durations []float64
+	signatures := make(map[string]*FailureSignatureCount)
+	for _, run := range runs {
+		if run.Status == "completed" {
+			durations = append(durations, run.Duration.Seconds())
+			continue
+		}
+
+		stats.Failures++
+		if run.Signature == "" {
+			continue
+		}
+		count, ok := signatures[run.Signature]
+		if !ok {
+			count = &FailureSignatureCount{Signature: run.Signature, Example: run.Error}
+			signatures[run.Signature] = count
+		}
+		count.Count++
+		if run.StartedAt.After(count.LastSeen) {
+			count.LastSeen = run.StartedAt
+			count.Example = run.Error
+		}
+	}
+
+	if stats.Runs > 0 {
+		stats.FailureRate = float64(stats.Failures) / float64(stats.Runs)
+	}
+	stats.Durations = durationPercentiles(durations)
+
+	for _, count := range signatures {
+		stats.Signatures = append(stats.Signatures, *count)
+	}
+	sort.Slice(stats.Signatures, func(i, j int) bool {
+		if stats.Signatures[i].Count != stats.Signatures[j].Count {
+			return stats.Signatures[i].Count > stats.Signatures[j].Count
+		}
+		return stats.Signatures[i].LastSeen.After(stats.Signatures[j].LastSeen)
+	})
+	if len(stats.Signatures) > maxSignaturesPerChart {
+		stats.Signatures = stats.Signatures[:maxSignaturesPerChart]
+	}
+
+	return stats
+}
+
+func durationPercentiles(durations []float64) DurationPercentiles {
+	result := DurationPercentiles{Samples: len(durations)}
+	if len(durations) == 0 {
+		return result
+	}
+
+	sort.Float64s(durations)
+	var total float64
+	for _, d := range durations {
+		total += d
+	}
+	result.Mean = total / float64(len(durations))
+	result.P50 = percentile(durations, 50)
+	result.P90 = percentile(durations, 90)
+	result.P95 = percentile(durations, 95)
+	result.P99 = percentile(durations, 99)
+	result.Max = durations[len(durations)-1]
+	return result
+}
+
+// percentile uses the nearest-rank method on sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// EstimateDeploymentTime estimates how long a plan takes from the p50 and p90
+// install durations of its charts. It reports false when none of the charts has
+// history, leaving the plan's own estimate in place.
+func EstimateDeploymentTime(plan *agent.DeploymentPlan, stats map[string]ChartStats) (string, bool) {
+	var low, high time.Duration
+	known := false
+
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		chartStats, ok := stats[step.Chart.Name]
+		if !ok || chartStats.Durations.Samples == 0 {
+			low += defaultChartEstimateLow
+			high += defaultChartEstimateHigh
+			continue
+		}
+		known = true
+		low += time.Duration(chartStats.Durations.P50 * float64(time.Second))
+		high += time.Duration(chartStats.Durations.P90 * float64(time.Second))
+	}
+	if !known {
+		return "", false
+	}
+
+	lowMinutes := int(math.Ceil(low.Minutes()))
+	highMinutes := int(math.Ceil(high.Minutes()))
+	if lowMinutes < 1 {
+		lowMinutes = 1
+	}
+	if highMinutes <= lowMinutes {
+		highMinutes = lowMinutes + 1
+	}
+	return fmt.Sprintf("%d-%d minutes", lowMinutes, highMinutes), true
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event types published on the bus
+const (
+	EventClusterAlert          = "cluster.alert"
+	EventClusterResolved       = "cluster.alert_resolved"
+	EventClusterUnreachable    = "cluster.unreachable"
+	EventPlanCreated           = "plan.created"
+	EventDeploymentStarted     = "deployment.started"
+	EventDeploymentCompleted   = "deployment.completed"
+	EventDeploymentFailed      = "deployment.failed"
+	EventDeploymentAborted     = "deployment.aborted"
+	EventPlanApprovalRequested = "plan.approval_requested"
+	EventAutopilotAction       = "autopilot.action"
+)
+
+// ChannelOnlyEvents announce what a user just did themselves, so they're
+// delivered to notification channels for external systems to react to but not
+// stored as the user's notifications
+var ChannelOnlyEvents = map[string]bool{
+	EventPlanCreated:       true,
+	EventDeploymentStarted: true,
+}
+
+// Event severities
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Event is a platform notification raised for a user and, when OrganizationID
+// is set, for the organization's notification channels. Events for an
+// organization only have no UserID.
+type Event struct {
+	Type           string    `json:"type"`
+	UserID         uint      `json:"user_id,omitempty"`
+	OrganizationID uint      `json:"organization_id,omitempty"`
+	ClusterID      uint      `json:"cluster_id,omitempty"`
+	Severity       string    `json:"severity"`
+	Rule           string    `json:"rule,omitempty"`
+	Resource       string    `json:"resource,omitempty"`
+	Title          string    `json:"title"`
+	Message        string    `json:"message"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// EventBus fans events out to in-process subscribers
+type EventBus struct {
+	mu          sync.RWMutex
+	subscribers map[int]chan Event
+	nextID      int
+}
+
+// NewEventBus creates a new event bus
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[int]chan Event),
+	}
+}
+
+// Subscribe returns a channel receiving every published event and a function
+// that cancels the subscription and closes the channel
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	ch := make(chan Event, buffer)
+	b.subscribers[id] = ch
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers an event to all subscribers. A subscriber whose buffer is
+// full misses the event rather than blocking the publisher.
+func (b *EventBus) Publish(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			fmt.Printf("Dropped %s event for user %d: subscriber is full\n", event.Type, event.UserID)
+		}
+	}
+}
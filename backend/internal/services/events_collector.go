@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Warning categories the summary calls out
+const (
+	WarningCrashLoopBackOff = "CrashLoopBackOff"
+	WarningFailedScheduling = "FailedScheduling"
+	WarningOOMKilled        = "OOMKilled"
+)
+
+// maxSummaryWarnings caps how many warnings are listed in the text summary
+const maxSummaryWarnings = 20
+
+// EventsService collects warning events of stored clusters. Events are listed on
+// demand; with watching enabled, Watch keeps an informer cache of a cluster's
+// events so collecting doesn't hit the API server.
+type EventsService struct {
+	watch bool
+
+	mu      sync.Mutex
+	watches map[uint]*eventsWatch
+}
+
+type eventsWatch struct {
+	cancel context.CancelFunc
+	lister corelisters.EventLister
+	synced cache.InformerSynced
+}
+
+// NewEventsService creates a new events service
+func NewEventsService(watch bool) *EventsService {
+	return &EventsService{
+		watch:   watch,
+		watches: make(map[uint]*eventsWatch),
+	}
+}
+
+// EventWarning is a warning about one object, aggregated over its events
+type EventWarning struct {
+	Category  string    `json:"category"`
+	Reason    string    `json:"reason"`
+	Namespace string    `json:"namespace"`
+	Kind      string    `json:"kind"`
+	Name      string    `json:"name"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// EventsSummary summarizes a cluster's recent warnings
+type EventsSummary struct {
+	Since      time.Time      `json:"since"`
+	Namespace  string         `json:"namespace,omitempty"`
+	Object     string         `json:"object,omitempty"`
+	Watched    bool           `json:"watched"`
+	Categories map[string]int `json:"categories"`
+	Warnings   []EventWarning `json:"warnings"`
+}
+
+// Watch starts caching a cluster's events, replacing any existing watch on it.
+// It does nothing when watching is disabled.
+func (s *EventsService) Watch(clusterID uint, client *kubernetes.KubernetesClient) {
+	if !s.watch {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	factory := client.InformerFactory(0)
+	events := factory.Core().V1().Events()
+	watch := &eventsWatch{
+		cancel: cancel,
+		lister: events.Lister(),
+		synced: events.Informer().HasSynced,
+	}
+	factory.Start(ctx.Done())
+	go func() {
+		<-ctx.Done()
+		factory.Shutdown()
+	}()
+
+	s.mu.Lock()
+	if existing, ok := s.watches[clusterID]; ok {
+		existing.cancel()
+	}
+	s.watches[clusterID] = watch
+	s.mu.Unlock()
+}
+
+// Unwatch stops caching a cluster's events
+func (s *EventsService) Unwatch(clusterID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if watch, ok := s.watches[clusterID]; ok {
+		watch.cancel()
+		delete(s.watches, clusterID)
+	}
+}
+
+// Collect summarizes the warnings of a cluster since the given time. An empty
+// namespace covers all namespaces; object, when set, keeps only warnings about
+// objects whose name contains it.
+func (s *EventsService) Collect(ctx context.Context, clusterID uint, client *kubernetes.KubernetesClient, namespace, object string, since time.Time) (*EventsSummary, error) {
+	events, watched, err := s.events(ctx, clusterID, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	// Pods are always listed, OOM kills only show in container statuses
+	pods, err := client.ListPods(ctx, namespace, "")
+	if err != nil {
+		return nil, err
+	}
+
+	summary := SummarizeWarnings(events, pods, object, since)
+	summary.Namespace = namespace
+	summary.Watched = watched
+	return summary, nil
+}
+
+// events returns a namespace's events from the watch cache when it has synced,
+// or from the API server
+func (s *EventsService) events(ctx context.Context, clusterID uint, client *kubernetes.KubernetesClient, namespace string) ([]corev1.Event, bool, error) {
+	s.mu.Lock()
+	watch, ok := s.watches[clusterID]
+	s.mu.Unlock()
+
+	if ok && watch.synced() {
+		var cached []*corev1.Event
+		var err error
+		if namespace == "" {
+			cached, err = watch.lister.List(labels.Everything())
+		} else {
+			cached, err = watch.lister.Events(namespace).List(labels.Everything())
+		}
+		if err == nil {
+			events := make([]corev1.Event, 0, len(cached))
+			for _, event := range cached {
+				events = append(events, *event)
+			}
+			return events, true, nil
+		}
+	}
+
+	events, err := client.ListEvents(ctx, namespace)
+	return events, false, err
+}
+
+// SummarizeWarnings aggregates Warning events per object and reason, and adds
+// containers whose last termination was an OOM kill
+func SummarizeWarnings(events []corev1.Event, pods []corev1.Pod, object string, since time.Time) *EventsSummary {
+	summary := &EventsSummary{
+		Since:      since,
+		Object:     object,
+		Categories: make(map[string]int),
+		Warnings:   []EventWarning{},
+	}
+	object = strings.ToLower(object)
+	matches := func(name string) bool {
+		return object == "" || strings.Contains(strings.ToLower(name), object)
+	}
+
+	byKey := make(map[string]*EventWarning)
+	for _, event := range events {
+		seen := kubernetes.EventTime(event)
+		if event.Type != corev1.EventTypeWarning || seen.Before(since) || !matches(event.InvolvedObject.Name) {
+			continue
+		}
+		category := warningCategory(event.Reason, event.Message)
+		key := strings.Join([]string{event.InvolvedObject.Namespace, event.InvolvedObject.Kind, event.InvolvedObject.Name, category}, "/")
+
+		count := event.Count
+		if count == 0 {
+			count = 1
+		}
+		if warning, ok := byKey[key]; ok {
+			warning.Count += count
+			if seen.After(warning.LastSeen) {
+				warning.LastSeen = seen
+				warning.Message = event.Message
+			}
+			continue
+		}
+		byKey[key] = &EventWarning{
+			Category:  category,
+			Reason:    event.Reason,
+			Namespace: event.InvolvedObject.Namespace,
+			Kind:      event.InvolvedObject.Kind,
+			Name:      event.InvolvedObject.Name,
+			Message:   event.Message,
+			Count:     count,
+			LastSeen:  seen,
+		}
+	}
+
+	for _, pod := range pods {
+		if !matches(pod.Name) {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			terminated := status.LastTerminationState.Terminated
+			if terminated == nil {
+				terminated = status.State.Terminated
+			}
+			if terminated == nil || terminated.Reason != WarningOOMKilled || terminated.FinishedAt.Time.Before(since) {
+				continue
+			}
+			key := strings.Join([]string{pod.Namespace, "Pod", pod.Name, WarningOOMKilled, status.Name}, "/")
+			byKey[key] = &EventWarning{
+				Category:  WarningOOMKilled,
+				Reason:    WarningOOMKilled,
+				Namespace: pod.Namespace,
+				Kind:      "Pod",
+				Name:      pod.Name,
+				Message:   fmt.Sprintf("container %s was OOM killed (exit code %d, %d restarts)", status.Name, terminated.ExitCode, status.RestartCount),
+				Count:     1,
+				LastSeen:  terminated.FinishedAt.Time,
+			}
+		}
+	}
+
+	for _, warning := range byKey {
+		summary.Categories[warning.Category]++
+		summary.Warnings = append(summary.Warnings, *warning)
+	}
+	sort.Slice(summary.Warnings, func(i, j int) bool {
+		return summary.Warnings[i].LastSeen.After(summary.Warnings[j].LastSeen)
+	})
+	return summary
+}
+
+// warningCategory maps an event to the failure it indicates
+func warningCategory(reason, message string) string {
+	switch {
+	case reason == "BackOff" && strings.Contains(message, "restarting failed container"):
+		return WarningCrashLoopBackOff
+	case reason == "FailedScheduling":
+		return WarningFailedScheduling
+	case reason == "OOMKilling" || strings.Contains(message, "OOMKilled"):
+		return WarningOOMKilled
+	default:
+		return reason
+	}
+}
+
+// Text renders the summary for the agent's cluster context
+func (s *EventsSummary) Text() string {
+	if len(s.Warnings) == 0 {
+		return fmt.Sprintf("No warning events since %s.", s.Since.UTC().Format(time.RFC3339))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Warning events since %s:\n", s.Since.UTC().Format(time.RFC3339))
+	categories := make([]string, 0, len(s.Categories))
+	for category := range s.Categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return s.Categories[categories[i]] > s.Categories[categories[j]] })
+	for _, category := range categories {
+		fmt.Fprintf(&b, "- %s: %d object(s)\n", category, s.Categories[category])
+	}
+
+	b.WriteString("Most recent:\n")
+	for i, warning := range s.Warnings {
+		if i == maxSummaryWarnings {
+			fmt.Fprintf(&b, "- ... and %d more\n", len(s.Warnings)-maxSummaryWarnings)
+			break
+		}
+		fmt.Fprintf(&b, "- [%s] %s %s/%s (x%d, last %s): %s\n", warning.Category, warning.Kind, warning.Namespace,
+			warning.Name, warning.Count, warning.LastSeen.UTC().Format(time.RFC3339), warning.Message)
+	}
+	return b.String()
+}
+
+var (
+	failureQueryPattern  = regexp.MustCompile(`(?i)\b(fail(ing|ed|s)?|crash(ing|loop\w*)?|oom\w*|pending|not (starting|running|ready|working)|stuck|broken|erroring|restarting)\b`)
+	failureTargetPattern = regexp.MustCompile(`(?i)\bwhy (?:is|are|does|do|did|was|were|has|have)\s+(?:the\s+|my\s+|our\s+)?(?:pod\s+|deployment\s+|statefulset\s+|service\s+)?([a-z0-9][a-z0-9.\-/]*)`)
+)
+
+// FailureQueryTarget reports whether a query asks why something is failing and,
+// when the query names it, the object it asks about
+func FailureQueryTarget(query string) (string, bool) {
+	if !failureQueryPattern.MatchString(query) {
+		return "", false
+	}
+	match := failureTargetPattern.FindStringSubmatch(query)
+	if match == nil {
+		return "", strings.Contains(strings.ToLower(query), "why")
+	}
+
+	target := strings.ToLower(match[1])
+	switch target {
+	case "it", "this", "that", "everything", "something", "my", "the", "pods", "deployments", "things":
+		return "", true
+	}
+	// "monitoring/grafana" names a namespace and object, events carry the name only
+	if slash := strings.LastIndex(target, "/"); slash != -1 {
+		target = target[slash+1:]
+	}
+	return target, true
+}
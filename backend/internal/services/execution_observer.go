@@ -0,0 +1,27 @@
+package services
+
+import (
+	"context"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// ExecutionObserver receives a deployment execution whenever its state changes.
+// step is the index of the step that changed, or -1 when the execution itself
+// started or ended. It runs on the deployment's goroutine, between changes.
+type ExecutionObserver func(execution *agent.DeploymentExecution, step int)
+
+type executionObserverKey struct{}
+
+// WithExecutionObserver returns a context whose deployments report their state to fn
+func WithExecutionObserver(ctx context.Context, fn ExecutionObserver) context.Context {
+	return context.WithValue(ctx, executionObserverKey{}, fn)
+}
+
+// observeExecution reports an execution's state to the context's
+// ExecutionObserver, if any
+func observeExecution(ctx context.Context, execution *agent.DeploymentExecution, step int) {
+	if fn, ok := ctx.Value(executionObserverKey{}).(ExecutionObserver); ok {
+		fn(execution, step)
+	}
+}
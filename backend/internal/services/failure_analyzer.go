@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// FailureAnalyzerService explains failed deployment steps, using known issues
+// first and the model only for failures it has not seen before
+type FailureAnalyzerService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewFailureAnalyzerService creates a new failure analyzer service
+func NewFailureAnalyzerService(aiAgent *agent.AIAgent) *FailureAnalyzerService {
+	return &FailureAnalyzerService{
+		aiAgent: aiAgent,
+	}
+}
+
+// KnownIssue is a remediation recorded for a failure signature
+type KnownIssue struct {
+	ID          uint
+	Signature   string
+	Chart       string
+	Title       string
+	Remediation string
+}
+
+// signatureMatchThreshold is the token similarity above which two signatures
+// are treated as the same failure
+const signatureMatchThreshold = 0.8
+
+// builtinKnownIssue matches common Helm and Kubernetes failures by pattern
+type builtinKnownIssue struct {
+	pattern     *regexp.Regexp
+	title       string
+	remediation string
+}
+
+var builtinKnownIssues = []builtinKnownIssue{
+	{
+		pattern:     regexp.MustCompile(`(?i)cannot re-use a name that is still in use`),
+		title:       "Release name already in use",
+		remediation: "A release with this name exists from an earlier attempt. Retry the deployment so it upgrades in place, or uninstall the existing release first.",
+	},
+	{
+		pattern:     regexp.MustCompile(`(?i)timed out waiting for the condition|context deadline exceeded`),
+		title:       "Release did not become ready in time",
+		remediation: "Pods did not become ready before the timeout. Check pod events for image pull errors, pending scheduling or failing probes, then retry.",
+	},
+	{
+		pattern:     regexp.MustCompile(`(?i)no matches for kind|ensure CRDs are installed`),
+		title:       "Missing CustomResourceDefinition",
+		remediation: "The chart uses a custom resource whose CRD is not installed. Install the operator or CRD chart first, or disable the feature creating the resource in values.",
+	},
+	{
+		pattern:     regexp.MustCompile(`(?i)is forbidden|cannot (create|get|list|patch) resource`),
+		title:       "Insufficient RBAC permissions",
+		remediation: "The kubeconfig's user lacks permissions for some chart resources. Grant the missing verbs, or use a kubeconfig with cluster-admin for installs that create cluster-scoped resources.",
+	},
+	{
+		pattern:     regexp.MustCompile(`(?i)exceeded quota|forbidden: exceeded`),
+		title:       "Namespace resource quota exceeded",
+		remediation: "The namespace ResourceQuota does not allow the requested resources. Lower requests and limits in values or raise the quota.",
+	},
+	{
+		pattern:     regexp.MustCompile(`(?i)rendered manifests contain a resource that already exists`),
+		title:       "Resource owned by another release",
+		remediation: "A resource the chart creates already exists outside this release. Delete it, install into another namespace, or adopt it by adding the meta.helm.sh release annotations.",
+	},
+	{
+		pattern:     regexp.MustCompile(`(?i)failed to (download|fetch)|repo .* not found|chart .* not found`),
+		title:       "Chart could not be downloaded",
+		remediation: "The chart repository or version is unavailable. Check the repository URL and that the chart version still exists.",
+	},
+	{
+		pattern:     regexp.MustCompile(`(?i)admission webhook .* denied`),
+		title:       "Rejected by an admission webhook",
+		remediation: "A policy or validating webhook rejected a resource. Read the denial reason and adjust values, for example security contexts or labels, to satisfy the policy.",
+	},
+}
+
+// MatchKnownIssue finds the remediation for a failure, preferring recorded issues
+// for the same chart, then recorded issues for any chart, then built-in patterns.
+// It returns nil when nothing matches.
+func MatchKnownIssue(chart, errorMessage string, issues []KnownIssue) *agent.FailureDiagnosis {
+	signature := FailureSignature(errorMessage)
+	if signature == "" {
+		return nil
+	}
+
+	var best *KnownIssue
+	bestScore := 0.0
+	for i := range issues {
+		issue := &issues[i]
+		if issue.Chart != "" && issue.Chart != chart {
+			continue
+		}
+		score := signatureSimilarity(signature, issue.Signature)
+		if score < signatureMatchThreshold {
+			continue
+		}
+		// Chart-specific issues win ties over global ones
+		if issue.Chart != "" {
+			score += 0.01
+		}
+		if score > bestScore {
+			best, bestScore = issue, score
+		}
+	}
+	if best != nil {
+		return &agent.FailureDiagnosis{
+			Signature:    signature,
+			Title:        best.Title,
+			Remediation:  best.Remediation,
+			Source:       "known_issue",
+			KnownIssueID: best.ID,
+		}
+	}
+
+	for _, builtin := range builtinKnownIssues {
+		if builtin.pattern.MatchString(errorMessage) {
+			return &agent.FailureDiagnosis{
+				Signature:   signature,
+				Title:       builtin.title,
+				Remediation: builtin.remediation,
+				Source:      "builtin",
+			}
+		}
+	}
+
+	return nil
+}
+
+const failureSystemPrompt = `You are a Kubernetes and Helm troubleshooting expert. A chart install failed.
+
+Respond with JSON only: {"title": "<short name of the problem>", "remediation": "<concrete steps to fix it, at most five sentences>"}.
+Base the answer on the error and logs. Do not invent resource names that do not appear in them.`
+
+// Diagnose asks the model to explain a failure no known issue matched
+func (s *FailureAnalyzerService) Diagnose(ctx context.Context, chart, errorMessage string, logs []string) (*agent.FailureDiagnosis, error) {
+	if len(logs) > 20 {
+		logs = logs[len(logs)-20:]
+	}
+	userMessage := fmt.Sprintf("Chart: %s\nError: %s\n\nStep logs:\n%s", chart, errorMessage, strings.Join(logs, "\n"))
+
+	response, err := s.aiAgent.Complete(ctx, failureSystemPrompt, userMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	block := agent.ExtractJSONBlock(response)
+	if block == "" {
+		return nil, fmt.Errorf("model response did not contain a diagnosis")
+	}
+
+	var diagnosis agent.FailureDiagnosis
+	if err := json.Unmarshal([]byte(block), &diagnosis); err != nil {
+		return nil, fmt.Errorf("model returned invalid diagnosis JSON: %w", err)
+	}
+	if strings.TrimSpace(diagnosis.Remediation) == "" {
+		return nil, fmt.Errorf("model returned an empty remediation")
+	}
+
+	diagnosis.Signature = FailureSignature(errorMessage)
+	diagnosis.Source = "llm"
+	return &diagnosis, nil
+}
+
+// FailureCluster groups failures whose normalized errors are near-identical
+type FailureCluster struct {
+	Signature string    `json:"signature"`
+	Variants  []string  `json:"variants"`
+	Count     int       `json:"count"`
+	Charts    []string  `json:"charts"`
+	Example   string    `json:"example"`
+	LastSeen  time.Time `json:"last_seen"`
+	// KnownIssueID links the cluster to the known issue that matches it, if any
+	KnownIssueID uint `json:"known_issue_id,omitempty"`
+}
+
+// ClusterFailures groups failed runs by signature, merging signatures that are
+// similar enough to be the same failure. Largest clusters come first.
+func ClusterFailures(runs []ChartRun, issues []KnownIssue) []FailureCluster {
+	type group struct {
+		cluster FailureCluster
+		charts  map[string]bool
+	}
+
+	var groups []*group
+	for _, run := range runs {
+		if run.Status != "failed" || run.Signature == "" {
+			continue
+		}
+
+		var target *group
+		for _, g := range groups {
+			if signatureSimilarity(run.Signature, g.cluster.Signature) >= signatureMatchThreshold {
+				target = g
+				break
+			}
+		}
+		if target == nil {
+			target = &group{
+				cluster: FailureCluster{Signature: run.Signature, Variants: []string{}},
+				charts:  make(map[string]bool),
+			}
+			groups = append(groups, target)
+		}
+
+		target.cluster.Count++
+		if run.Signature != target.cluster.Signature && !slices.Contains(target.cluster.Variants, run.Signature) {
+			target.cluster.Variants = append(target.cluster.Variants, run.Signature)
+		}
+		if !target.charts[run.Chart] {
+			target.charts[run.Chart] = true
+			target.cluster.Charts = append(target.cluster.Charts, run.Chart)
+		}
+		if run.StartedAt.After(target.cluster.LastSeen) {
+			target.cluster.LastSeen = run.StartedAt
+			target.cluster.Example = run.Error
+		}
+	}
+
+	clusters := make([]FailureCluster, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.cluster.Charts)
+		for _, issue := range issues {
+			if signatureSimilarity(g.cluster.Signature, issue.Signature) >= signatureMatchThreshold {
+				g.cluster.KnownIssueID = issue.ID
+				break
+			}
+		}
+		clusters = append(clusters, g.cluster)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Count != clusters[j].Count {
+			return clusters[i].Count > clusters[j].Count
+		}
+		return clusters[i].LastSeen.After(clusters[j].LastSeen)
+	})
+	return clusters
+}
+
+// signatureSimilarity is the Jaccard similarity of the signatures' word sets
+func signatureSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	tokensA := strings.Fields(a)
+	tokensB := strings.Fields(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	set := make(map[string]bool, len(tokensA))
+	for _, token := range tokensA {
+		set[token] = true
+	}
+	union := len(set)
+	intersection := 0
+	seen := make(map[string]bool, len(tokensB))
+	for _, token := range tokensB {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		if set[token] {
+			intersection++
+		} else {
+			union++
+		}
+	}
+	return float64(intersection) / float64(union)
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// GrafanaClient talks to the Grafana HTTP API
+type GrafanaClient struct {
+	baseURL    string
+	username   string
+	password   string
+	token      string
+	httpClient *http.Client
+}
+
+// NewGrafanaClient creates a Grafana client using basic auth credentials
+func NewGrafanaClient(baseURL, username, password string) *GrafanaClient {
+	return &GrafanaClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// NewGrafanaTokenClient creates a Grafana client using an API key or service account token
+func NewGrafanaTokenClient(baseURL, token string) *GrafanaClient {
+	return &GrafanaClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// GrafanaEndpoint describes how to reach a Grafana instance deployed in a cluster
+type GrafanaEndpoint struct {
+	ExternalURL string
+	Namespace   string
+	Service     string
+	Port        int32
+	APIKey      string
+}
+
+// ConnectGrafana returns a client for the endpoint, port-forwarding through the
+// cluster API when Grafana is not exposed externally. The returned function
+// closes any tunnel and must always be called.
+func ConnectGrafana(ctx context.Context, endpoint GrafanaEndpoint, kubeconfig string) (*GrafanaClient, func(), error) {
+	if endpoint.ExternalURL != "" {
+		return NewGrafanaTokenClient(endpoint.ExternalURL, endpoint.APIKey), func() {}, nil
+	}
+
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+
+	localPort, stop, err := client.PortForwardService(ctx, endpoint.Namespace, endpoint.Service, endpoint.Port)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reach grafana: %w", err)
+	}
+
+	return NewGrafanaTokenClient(fmt.Sprintf("http://127.0.0.1:%d", localPort), endpoint.APIKey), stop, nil
+}
+
+// GrafanaDatasource represents a datasource definition
+type GrafanaDatasource struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	URL       string `json:"url"`
+	Access    string `json:"access"`
+	IsDefault bool   `json:"isDefault"`
+}
+
+// GrafanaAPIError is returned for non-2xx responses from Grafana
+type GrafanaAPIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *GrafanaAPIError) Error() string {
+	return fmt.Sprintf("grafana API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// WaitForHealthy polls the health endpoint until Grafana reports a working database
+func (g *GrafanaClient) WaitForHealthy(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var health struct {
+			Database string `json:"database"`
+		}
+		err := g.do(ctx, http.MethodGet, "/api/health", nil, &health)
+		if err == nil && health.Database == "ok" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("database status %q", health.Database)
+			}
+			return fmt.Errorf("grafana did not become healthy: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// CreateDatasource creates a datasource, returning false if it already existed
+func (g *GrafanaClient) CreateDatasource(ctx context.Context, datasource GrafanaDatasource) (bool, error) {
+	err := g.do(ctx, http.MethodPost, "/api/datasources", datasource, nil)
+	if apiErr, ok := err.(*GrafanaAPIError); ok && apiErr.StatusCode == http.StatusConflict {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ImportDashboard imports a dashboard model, binding datasource inputs by name
+func (g *GrafanaClient) ImportDashboard(ctx context.Context, dashboard map[string]interface{}, inputs []map[string]interface{}) (string, error) {
+	payload := map[string]interface{}{
+		"dashboard": dashboard,
+		"overwrite": true,
+		"inputs":    inputs,
+	}
+
+	var result struct {
+		ImportedURL string `json:"importedUrl"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/api/dashboards/import", payload, &result); err != nil {
+		return "", err
+	}
+	return result.ImportedURL, nil
+}
+
+// SaveDashboard creates or overwrites a dashboard and returns its URL
+func (g *GrafanaClient) SaveDashboard(ctx context.Context, dashboard map[string]interface{}) (string, error) {
+	payload := map[string]interface{}{
+		"dashboard": dashboard,
+		"overwrite": true,
+	}
+
+	var result struct {
+		URL string `json:"url"`
+	}
+	if err := g.do(ctx, http.MethodPost, "/api/dashboards/db", payload, &result); err != nil {
+		return "", err
+	}
+	return result.URL, nil
+}
+
+// CreateServiceAccountToken creates an admin service account and a token for it
+func (g *GrafanaClient) CreateServiceAccountToken(ctx context.Context, name string) (string, error) {
+	var account struct {
+		ID int64 `json:"id"`
+	}
+	err := g.do(ctx, http.MethodPost, "/api/serviceaccounts", map[string]interface{}{
+		"name": name,
+		"role": "Admin",
+	}, &account)
+	if err != nil {
+		// Grafana releases before service accounts only support legacy API keys
+		if apiErr, ok := err.(*GrafanaAPIError); ok && apiErr.StatusCode == http.StatusNotFound {
+			return g.createLegacyAPIKey(ctx, name)
+		}
+		return "", err
+	}
+
+	var token struct {
+		Key string `json:"key"`
+	}
+	err = g.do(ctx, http.MethodPost, fmt.Sprintf("/api/serviceaccounts/%d/tokens", account.ID), map[string]interface{}{
+		"name": name,
+	}, &token)
+	if err != nil {
+		return "", err
+	}
+	return token.Key, nil
+}
+
+func (g *GrafanaClient) createLegacyAPIKey(ctx context.Context, name string) (string, error) {
+	var key struct {
+		Key string `json:"key"`
+	}
+	err := g.do(ctx, http.MethodPost, "/api/auth/keys", map[string]interface{}{
+		"name": name,
+		"role": "Admin",
+	}, &key)
+	if err != nil {
+		return "", err
+	}
+	return key.Key, nil
+}
+
+// do performs an authenticated JSON request against the Grafana API
+func (g *GrafanaClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, g.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	} else if g.username != "" {
+		req.SetBasicAuth(g.username, g.password)
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("grafana request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &GrafanaAPIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// GrafanaProvisionerService configures Grafana after a Grafana chart is installed:
+// datasources for in-cluster Prometheus/Loki, recommended dashboards, and an API key
+type GrafanaProvisionerService struct {
+	httpClient *http.Client
+	dashboards map[string][]int
+}
+
+// NewGrafanaProvisionerService creates a new Grafana provisioner
+func NewGrafanaProvisionerService() *GrafanaProvisionerService {
+	return &GrafanaProvisionerService{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		// Recommended grafana.com dashboard IDs per datasource type
+		dashboards: map[string][]int{
+			"prometheus": {1860, 15757, 15760},
+			"loki":       {13639},
+		},
+	}
+}
+
+// datasourceTarget describes how to find an in-cluster datasource backend
+type datasourceTarget struct {
+	name      string
+	dsType    string
+	selectors []string
+}
+
+// Label selectors for the services common Prometheus and Loki charts create
+var (
+	prometheusServiceSelectors = []string{
+		"app.kubernetes.io/name=prometheus,app.kubernetes.io/component=server",
+		"operated-prometheus=true",
+		"app=kube-prometheus-stack-prometheus",
+		"app.kubernetes.io/name=prometheus",
+	}
+	lokiServiceSelectors = []string{
+		"app.kubernetes.io/name=loki,app.kubernetes.io/component=gateway",
+		"app.kubernetes.io/name=loki",
+		"app=loki",
+	}
+)
+
+var grafanaDatasourceTargets = []datasourceTarget{
+	{name: "Prometheus", dsType: "prometheus", selectors: prometheusServiceSelectors},
+	{name: "Loki", dsType: "loki", selectors: lokiServiceSelectors},
+}
+
+// Name identifies the step in execution results
+func (s *GrafanaProvisionerService) Name() string {
+	return "grafana-provisioning"
+}
+
+// Applies reports whether the installed chart ships Grafana
+func (s *GrafanaProvisionerService) Applies(chart *agent.HelmChart) bool {
+	name := strings.ToLower(chart.Name)
+	return strings.Contains(name, "grafana") || name == "kube-prometheus-stack"
+}
+
+// Run provisions datasources, dashboards, and an API key on the installed Grafana
+func (s *GrafanaProvisionerService) Run(ctx context.Context, chart *agent.HelmChart, kubeconfig string, result *agent.PostDeployResult) error {
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+
+	service, err := s.findGrafanaService(client, chart.Name)
+	if err != nil {
+		return err
+	}
+	port := servicePort(service)
+	result.Outputs["url"] = fmt.Sprintf("http://%s.%s.svc:%d", service.Name, service.Namespace, port)
+	result.Outputs["namespace"] = service.Namespace
+	result.Outputs["service"] = service.Name
+	result.Outputs["port"] = strconv.Itoa(int(port))
+	result.Logs = append(result.Logs, fmt.Sprintf("Found Grafana service %s/%s", service.Namespace, service.Name))
+
+	username, password := s.adminCredentials(client, service, chart)
+	result.Outputs["admin_user"] = username
+	result.Outputs["admin_password"] = password
+
+	localPort, stop, err := client.PortForwardService(ctx, service.Namespace, service.Name, port)
+	if err != nil {
+		return fmt.Errorf("failed to reach grafana: %w", err)
+	}
+	defer stop()
+
+	grafana := NewGrafanaClient(fmt.Sprintf("http://127.0.0.1:%d", localPort), username, password)
+	if err := grafana.WaitForHealthy(ctx, 3*time.Minute); err != nil {
+		return err
+	}
+
+	// Create datasources for every monitoring backend found in the cluster
+	var datasourceNames []string
+	for _, target := range grafanaDatasourceTargets {
+		backend, err := findServiceBySelectors(client, target.selectors)
+		if err != nil {
+			result.Logs = append(result.Logs, fmt.Sprintf("No %s service found, skipping datasource", target.name))
+			continue
+		}
+
+		datasource := GrafanaDatasource{
+			Name:      target.name,
+			Type:      target.dsType,
+			URL:       fmt.Sprintf("http://%s.%s.svc:%d", backend.Name, backend.Namespace, servicePort(backend)),
+			Access:    "proxy",
+			IsDefault: target.dsType == "prometheus",
+		}
+		created, err := grafana.CreateDatasource(ctx, datasource)
+		if err != nil {
+			return fmt.Errorf("failed to create %s datasource: %w", target.name, err)
+		}
+		if created {
+			result.Logs = append(result.Logs, fmt.Sprintf("Created datasource %s -> %s", datasource.Name, datasource.URL))
+		} else {
+			result.Logs = append(result.Logs, fmt.Sprintf("Datasource %s already exists", datasource.Name))
+		}
+		datasourceNames = append(datasourceNames, target.name)
+
+		// Dashboard imports are best effort; a missing dashboard should not block provisioning
+		for _, dashboardID := range s.dashboards[target.dsType] {
+			url, err := s.importDashboard(ctx, grafana, dashboardID, target)
+			if err != nil {
+				result.Logs = append(result.Logs, fmt.Sprintf("Failed to import dashboard %d: %v", dashboardID, err))
+				continue
+			}
+			result.Logs = append(result.Logs, fmt.Sprintf("Imported dashboard %d at %s", dashboardID, url))
+		}
+	}
+	result.Outputs["datasources"] = strings.Join(datasourceNames, ",")
+
+	apiKey, err := grafana.CreateServiceAccountToken(ctx, fmt.Sprintf("ai-agent-%d", time.Now().Unix()))
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	result.Outputs["api_key"] = apiKey
+	result.Logs = append(result.Logs, "Created Grafana API key")
+
+	return nil
+}
+
+// findGrafanaService locates the Grafana service created by the release
+func (s *GrafanaProvisionerService) findGrafanaService(client *kubernetes.KubernetesClient, release string) (*corev1.Service, error) {
+	service, err := findServiceBySelectors(client, []string{
+		fmt.Sprintf("app.kubernetes.io/name=grafana,app.kubernetes.io/instance=%s", release),
+		"app.kubernetes.io/name=grafana",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("grafana service not found: %w", err)
+	}
+	return service, nil
+}
+
+// findServiceBySelectors returns the first service matching any of the selectors
+func findServiceBySelectors(client *kubernetes.KubernetesClient, selectors []string) (*corev1.Service, error) {
+	var lastErr error
+	for _, selector := range selectors {
+		service, err := client.FindService("", selector)
+		if err == nil {
+			return service, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// adminCredentials reads the admin credentials from the chart's secret, falling
+// back to the values used for the install
+func (s *GrafanaProvisionerService) adminCredentials(client *kubernetes.KubernetesClient, service *corev1.Service, chart *agent.HelmChart) (string, string) {
+	if data, err := client.GetSecretData(service.Namespace, service.Name); err == nil {
+		if data["admin-user"] != "" && data["admin-password"] != "" {
+			return data["admin-user"], data["admin-password"]
+		}
+	}
+
+	values := chart.Values
+	if nested, ok := chart.Values["grafana"].(map[string]interface{}); ok {
+		values = nested
+	}
+	username, _ := values["adminUser"].(string)
+	password, _ := values["adminPassword"].(string)
+	if username == "" {
+		username = "admin"
+	}
+	if password == "" {
+		password = "admin"
+	}
+	return username, password
+}
+
+// importDashboard downloads a dashboard from grafana.com and imports it bound to the datasource
+func (s *GrafanaProvisionerService) importDashboard(ctx context.Context, grafana *GrafanaClient, dashboardID int, target datasourceTarget) (string, error) {
+	url := fmt.Sprintf("https://grafana.com/api/dashboards/%d/revisions/latest/download", dashboardID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download dashboard: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read dashboard: %w", err)
+	}
+
+	var dashboard map[string]interface{}
+	if err := json.Unmarshal(body, &dashboard); err != nil {
+		return "", fmt.Errorf("failed to parse dashboard: %w", err)
+	}
+	delete(dashboard, "id")
+
+	// Bind every datasource input the dashboard declares to our datasource
+	var inputs []map[string]interface{}
+	if declared, ok := dashboard["__inputs"].([]interface{}); ok {
+		for _, item := range declared {
+			input, ok := item.(map[string]interface{})
+			if !ok || input["type"] != "datasource" {
+				continue
+			}
+			inputs = append(inputs, map[string]interface{}{
+				"name":     input["name"],
+				"type":     "datasource",
+				"pluginId": input["pluginId"],
+				"value":    target.name,
+			})
+		}
+	}
+
+	return grafana.ImportDashboard(ctx, dashboard, inputs)
+}
+
+// servicePort returns the first port exposed by a service
+func servicePort(service *corev1.Service) int32 {
+	if len(service.Spec.Ports) == 0 {
+		return 80
+	}
+	return service.Spec.Ports[0].Port
+}
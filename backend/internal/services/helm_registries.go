@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// RegistryCredential logs helm into an OCI registry
+type RegistryCredential struct {
+	Host     string
+	Username string
+	Password string
+}
+
+type registryCredentialsKey struct{}
+
+// WithRegistryCredentials returns a context whose helm commands log into OCI
+// registries with the given credentials
+func WithRegistryCredentials(ctx context.Context, credentials []RegistryCredential) context.Context {
+	return context.WithValue(ctx, registryCredentialsKey{}, credentials)
+}
+
+// registryCredential returns the credential of ctx for a registry host
+func registryCredential(ctx context.Context, host string) (RegistryCredential, bool) {
+	credentials, _ := ctx.Value(registryCredentialsKey{}).([]RegistryCredential)
+	for _, credential := range credentials {
+		if strings.EqualFold(credential.Host, host) {
+			return credential, true
+		}
+	}
+	return RegistryCredential{}, false
+}
+
+// IsOCIChart reports whether a chart is pulled from an OCI registry rather than
+// a classic chart repository
+func IsOCIChart(chart *agent.HelmChart) bool {
+	return strings.HasPrefix(chart.Name, "oci://") || strings.HasPrefix(chart.Repository, "oci://")
+}
+
+// ociChartReference returns the oci:// reference of a chart. The repository may
+// already end with the chart's name, or the name be a full reference itself.
+func ociChartReference(chart *agent.HelmChart) string {
+	if strings.HasPrefix(chart.Name, "oci://") {
+		return chart.Name
+	}
+	repository := strings.TrimRight(chart.Repository, "/")
+	if strings.HasSuffix(repository, "/"+chart.Name) {
+		return repository
+	}
+	return repository + "/" + chart.Name
+}
+
+// OCIRegistryHost returns the registry host of an oci:// reference
+func OCIRegistryHost(reference string) string {
+	host := strings.TrimPrefix(reference, "oci://")
+	if i := strings.Index(host, "/"); i != -1 {
+		host = host[:i]
+	}
+	return host
+}
+
+// registryLogin logs helm into the registry of an OCI chart when ctx carries
+// credentials for it. Each login gets a registry config of its own, so
+// credentials never leak between organizations or into the host's helm
+// config. It returns the flags pointing helm at that config, and a cleanup
+// removing it.
+func registryLogin(ctx context.Context, chart *agent.HelmChart) ([]string, func(), error) {
+	noop := func() {}
+	if !IsOCIChart(chart) {
+		return nil, noop, nil
+	}
+	credential, ok := registryCredential(ctx, OCIRegistryHost(ociChartReference(chart)))
+	if !ok {
+		return nil, noop, nil
+	}
+
+	configFile, err := loginRegistry(ctx, credential)
+	if err != nil {
+		return nil, noop, err
+	}
+	return []string{"--registry-config", configFile}, func() { os.Remove(configFile) }, nil
+}
+
+// CheckRegistryLogin verifies registry credentials by logging in with them
+func (s *HelmService) CheckRegistryLogin(ctx context.Context, credential RegistryCredential) error {
+	if _, err := exec.LookPath("helm"); err != nil {
+		return fmt.Errorf("helm not available: %w", err)
+	}
+	configFile, err := loginRegistry(ctx, credential)
+	if err != nil {
+		return err
+	}
+	os.Remove(configFile)
+	return nil
+}
+
+// loginRegistry runs helm registry login into a new registry config file
+// readable only by the backend, and returns its path
+func loginRegistry(ctx context.Context, credential RegistryCredential) (string, error) {
+	file, err := os.CreateTemp("", "helm-registry-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to create registry config: %w", err)
+	}
+	file.Close()
+	if err := os.Chmod(file.Name(), 0600); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to secure registry config: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, "helm", "registry", "login", credential.Host,
+		"--username", credential.Username, "--password-stdin", "--registry-config", file.Name())
+	cmd.Stdin = strings.NewReader(credential.Password)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("helm registry login to %s failed: %s", credential.Host, strings.TrimSpace(string(output)))
+	}
+	return file.Name(), nil
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// HelmRelease is an installed release as reported by helm list
+type HelmRelease struct {
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace"`
+	Revision     string `json:"revision"`
+	Updated      string `json:"updated"`
+	Status       string `json:"status"`
+	Chart        string `json:"chart"`
+	ChartVersion string `json:"chart_version"`
+	AppVersion   string `json:"app_version"`
+}
+
+// ReleaseUpgrade compares an installed release with the latest published chart
+type ReleaseUpgrade struct {
+	Release          HelmRelease `json:"release"`
+	LatestVersion    string      `json:"latest_version,omitempty"`
+	LatestAppVersion string      `json:"latest_app_version,omitempty"`
+	Repository       string      `json:"repository,omitempty"`
+	RepositoryURL    string      `json:"repository_url,omitempty"`
+	Outdated         bool        `json:"outdated"`
+	MajorUpgrade     bool        `json:"major_upgrade"`
+	Error            string      `json:"error,omitempty"`
+}
+
+// artifactHubPackage is a package entry in Artifact Hub search results
+type artifactHubPackage struct {
+	PackageID   string `json:"package_id"`
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	AppVersion  string `json:"app_version"`
+	Description string `json:"description"`
+	License     string `json:"license"` // SPDX expression
+	Deprecated  bool   `json:"deprecated"`
+	Official    bool   `json:"official"`
+	Stars       int    `json:"stars"`
+	Repository  struct {
+		Name              string `json:"name"`
+		URL               string `json:"url"`
+		Official          bool   `json:"official"`
+		VerifiedPublisher bool   `json:"verified_publisher"`
+	} `json:"repository"`
+}
+
+// CheckUpgrades lists the Helm releases installed on a cluster and compares each
+// with the latest version of its chart on Artifact Hub
+func (s *HelmService) CheckUpgrades(ctx context.Context, kubeconfig string) ([]ReleaseUpgrade, error) {
+	releases, err := listHelmReleases(ctx, kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	upgrades := make([]ReleaseUpgrade, 0, len(releases))
+	for _, release := range releases {
+		upgrade := ReleaseUpgrade{Release: release}
+
+		latest, err := s.latestChart(ctx, release.Chart)
+		if err != nil {
+			upgrade.Error = err.Error()
+			upgrades = append(upgrades, upgrade)
+			continue
+		}
+
+		upgrade.LatestVersion = latest.Version
+		upgrade.LatestAppVersion = latest.AppVersion
+		upgrade.Repository = latest.Repository.Name
+		upgrade.RepositoryURL = latest.Repository.URL
+		upgrade.Outdated = compareVersions(latest.Version, release.ChartVersion) > 0
+		upgrade.MajorUpgrade = upgrade.Outdated && majorVersion(latest.Version) > majorVersion(release.ChartVersion)
+		upgrades = append(upgrades, upgrade)
+	}
+
+	return upgrades, nil
+}
+
+// CreateUpgradePlan builds a deployment plan that upgrades outdated releases in place
+func (s *HelmService) CreateUpgradePlan(clusterName string, upgrades []ReleaseUpgrade) *agent.DeploymentPlan {
+	plan := &agent.DeploymentPlan{
+		SchemaVersion: agent.PlanSchemaVersion,
+		ID:            fmt.Sprintf("plan-upgrade-%d", time.Now().UnixNano()),
+		Name:          fmt.Sprintf("Upgrade Helm releases on %s", clusterName),
+		Description:   "Upgrade outdated Helm releases to the latest chart versions, keeping their current values",
+		Charts:        make([]agent.HelmChart, 0),
+		Steps:         make([]agent.DeploymentStep, 0),
+		EstimatedTime: fmt.Sprintf("%d-%d minutes", len(upgrades)*2, len(upgrades)*5),
+		Prerequisites: []string{
+			"Review the chart changelogs for each upgrade",
+			"Back up persistent data for stateful releases",
+		},
+		Risks: []string{
+			"Upgrades may restart workloads",
+		},
+	}
+
+	for _, upgrade := range upgrades {
+		if !upgrade.Outdated {
+			continue
+		}
+
+		chart := agent.HelmChart{
+			Name:        upgrade.Release.Chart,
+			Repository:  upgrade.RepositoryURL,
+			Version:     upgrade.LatestVersion,
+			ReleaseName: upgrade.Release.Name,
+			Namespace:   upgrade.Release.Namespace,
+			Description: fmt.Sprintf("Upgrade %s from %s to %s", upgrade.Release.Name, upgrade.Release.ChartVersion, upgrade.LatestVersion),
+		}
+		plan.Charts = append(plan.Charts, chart)
+
+		plan.Steps = append(plan.Steps, agent.DeploymentStep{
+			ID:          fmt.Sprintf("step-%d", len(plan.Steps)+1),
+			Name:        fmt.Sprintf("Upgrade %s", upgrade.Release.Name),
+			Description: chart.Description,
+			Chart:       &chart,
+			Action:      "upgrade",
+			Status:      "pending",
+		})
+
+		if upgrade.MajorUpgrade {
+			plan.Risks = append(plan.Risks, fmt.Sprintf("%s is a major version upgrade (%s -> %s) and may contain breaking changes",
+				upgrade.Release.Name, upgrade.Release.ChartVersion, upgrade.LatestVersion))
+		}
+	}
+
+	return plan
+}
+
+// latestChart finds the chart on Artifact Hub, preferring official and verified repositories
+func (s *HelmService) latestChart(ctx context.Context, chartName string) (*artifactHubPackage, error) {
+	packages, err := s.searchPackages(ctx, chartName)
+	if err != nil {
+		return nil, err
+	}
+
+	var match *artifactHubPackage
+	for i := range packages {
+		pkg := &packages[i]
+		if pkg.Name != chartName {
+			continue
+		}
+		if match == nil {
+			match = pkg
+		}
+		if pkg.Repository.Official || pkg.Repository.VerifiedPublisher {
+			return pkg, nil
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("chart %s not found on Artifact Hub", chartName)
+	}
+	return match, nil
+}
+
+// ChartLicense returns the SPDX license expression Artifact Hub records for a
+// chart, preferring the package from the chart's own repository
+func (s *HelmService) ChartLicense(ctx context.Context, chart *agent.HelmChart) (string, error) {
+	packages, err := s.searchPackages(ctx, chart.Name)
+	if err != nil {
+		return "", err
+	}
+	repository := strings.TrimRight(chart.Repository, "/")
+	for _, pkg := range packages {
+		if pkg.Name == chart.Name && strings.TrimRight(pkg.Repository.URL, "/") == repository {
+			return pkg.License, nil
+		}
+	}
+
+	pkg, err := s.latestChart(ctx, chart.Name)
+	if err != nil {
+		return "", err
+	}
+	return pkg.License, nil
+}
+
+// searchPackages searches Artifact Hub for Helm charts
+func (s *HelmService) searchPackages(ctx context.Context, query string) ([]artifactHubPackage, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/packages/search?ts_query_web=%s&kind=0&limit=20", s.artifactHubURL, url.QueryEscape(query))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.artifactHubClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search charts: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search failed with status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result struct {
+		Packages []artifactHubPackage `json:"packages"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return result.Packages, nil
+}
+
+// listHelmReleases lists the releases of every namespace with the Helm SDK,
+// from the release records Helm stores in the cluster
+func listHelmReleases(ctx context.Context, kubeconfig string) ([]HelmRelease, error) {
+	kubeconfigFile, err := writeKubeconfigFile(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(kubeconfigFile)
+
+	actionConfig := new(action.Configuration)
+	if err := actionConfig.Init(kube.GetConfig(kubeconfigFile, "", ""), "", os.Getenv("HELM_DRIVER"), func(string, ...interface{}) {}); err != nil {
+		return nil, fmt.Errorf("failed to connect to the cluster: %w", err)
+	}
+	list := action.NewList(actionConfig)
+	list.AllNamespaces = true
+	list.SetStateMask()
+
+	type listResult struct {
+		releases []*release.Release
+		err      error
+	}
+	done := make(chan listResult, 1)
+	go func() {
+		releases, err := list.Run()
+		done <- listResult{releases, err}
+	}()
+	var result listResult
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result = <-done:
+	}
+	if result.err != nil {
+		return nil, fmt.Errorf("failed to list helm releases: %w", result.err)
+	}
+
+	releases := make([]HelmRelease, 0, len(result.releases))
+	for _, r := range result.releases {
+		installed := HelmRelease{
+			Name:      r.Name,
+			Namespace: r.Namespace,
+			Revision:  strconv.Itoa(r.Version),
+		}
+		if r.Info != nil {
+			installed.Status = r.Info.Status.String()
+			installed.Updated = r.Info.LastDeployed.Format("2006-01-02 15:04:05.999999999 -0700 MST")
+		}
+		if r.Chart != nil && r.Chart.Metadata != nil {
+			installed.Chart = r.Chart.Metadata.Name
+			installed.ChartVersion = r.Chart.Metadata.Version
+			installed.AppVersion = r.Chart.Metadata.AppVersion
+		}
+		releases = append(releases, installed)
+	}
+	return releases, nil
+}
+
+// splitChartVersion splits "kube-prometheus-stack-51.2.0" into name and version
+func splitChartVersion(chart string) (string, string) {
+	for i := 0; i < len(chart)-1; i++ {
+		if chart[i] == '-' && chart[i+1] >= '0' && chart[i+1] <= '9' {
+			return chart[:i], chart[i+1:]
+		}
+	}
+	return chart, ""
+}
+
+// compareVersions compares two semantic versions, returning -1, 0 or 1.
+// A release version sorts after its pre-releases.
+func compareVersions(a, b string) int {
+	coreA, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	coreB, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	partsA := strings.Split(strings.SplitN(coreA, "+", 2)[0], ".")
+	partsB := strings.Split(strings.SplitN(coreB, "+", 2)[0], ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numA, numB int
+		if i < len(partsA) {
+			numA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numB, _ = strconv.Atoi(partsB[i])
+		}
+		if numA != numB {
+			if numA > numB {
+				return 1
+			}
+			return -1
+		}
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	case preA > preB:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func majorVersion(version string) int {
+	major, _, _ := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	number, _ := strconv.Atoi(major)
+	return number
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"time"
 
@@ -14,17 +15,29 @@ import (
 // HelmService handles Helm chart operations
 type HelmService struct {
 	artifactHubClient *http.Client
+	artifactHubURL    string
+	network           Network
+	docs              chartDocsCache
 }
 
-// NewHelmService creates a new Helm service
-func NewHelmService() *HelmService {
+// NewHelmService creates a new Helm service using the Artifact Hub API at
+// artifactHubURL, pulling charts and reaching Artifact Hub as the network allows
+func NewHelmService(artifactHubURL string, network Network) *HelmService {
 	return &HelmService{
 		artifactHubClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: network.transport("Artifact Hub", http.DefaultTransport),
 		},
+		artifactHubURL: strings.TrimRight(artifactHubURL, "/"),
+		network:        network,
 	}
 }
 
+// Network returns where the service's calls may go
+func (s *HelmService) Network() Network {
+	return s.network
+}
+
 // ChartSearchResult represents a search result from Artifact Hub
 type ChartSearchResult struct {
 	ID          string   `json:"id"`
@@ -41,12 +54,17 @@ type ChartSearchResult struct {
 	} `json:"maintainers"`
 	Provider   string `json:"provider"`
 	Deprecated bool   `json:"deprecated"`
+	// Official is set for official charts or charts of official repositories
+	Official          bool `json:"official"`
+	VerifiedPublisher bool `json:"verified_publisher"`
+	Stars             int  `json:"stars"`
 }
 
-// SearchCharts searches for Helm charts on Artifact Hub
-func (s *HelmService) SearchCharts(query string) ([]ChartSearchResult, error) {
+// SearchCharts searches for Helm charts on Artifact Hub, leaving out the
+// charts the organization's rules block
+func (s *HelmService) SearchCharts(query string, rules ChartRules) ([]ChartSearchResult, error) {
 	// Artifact Hub search API
-	url := fmt.Sprintf("https://artifacthub.io/api/v1/packages/search?q=%s&kind=0&limit=20", query)
+	url := fmt.Sprintf("%s/api/v1/packages/search?ts_query_web=%s&kind=0&limit=20", s.artifactHubURL, neturl.QueryEscape(query))
 
 	resp, err := s.artifactHubClient.Get(url)
 	if err != nil {
@@ -63,17 +81,37 @@ func (s *HelmService) SearchCharts(query string) ([]ChartSearchResult, error) {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var results []ChartSearchResult
-	if err := json.Unmarshal(body, &results); err != nil {
+	var response struct {
+		Packages []artifactHubPackage `json:"packages"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
 
+	results := make([]ChartSearchResult, 0, len(response.Packages))
+	for _, pkg := range response.Packages {
+		results = append(results, ChartSearchResult{
+			ID:                pkg.PackageID,
+			Name:              pkg.Name,
+			Repository:        pkg.Repository.URL,
+			Version:           pkg.Version,
+			Description:       pkg.Description,
+			URL:               artifactHubPackagePrefix + pkg.Repository.Name + "/" + pkg.Name,
+			Deprecated:        pkg.Deprecated,
+			Provider:          pkg.Repository.Name,
+			Official:          pkg.Official || pkg.Repository.Official,
+			VerifiedPublisher: pkg.Repository.VerifiedPublisher,
+			Stars:             pkg.Stars,
+		})
+	}
+
+	results, _ = rules.Filter(results)
 	return results, nil
 }
 
 // GetChartDetails gets detailed information about a specific chart
 func (s *HelmService) GetChartDetails(chartID string) (*ChartDetails, error) {
-	url := fmt.Sprintf("https://artifacthub.io/api/v1/packages/%s", chartID)
+	url := fmt.Sprintf("%s/api/v1/packages/%s", s.artifactHubURL, chartID)
 
 	resp, err := s.artifactHubClient.Get(url)
 	if err != nil {
@@ -116,10 +154,24 @@ type ChartDetails struct {
 	Deprecated bool   `json:"deprecated"`
 	Values     string `json:"values"` // Default values.yaml content
 	Readme     string `json:"readme"` // README content
+	// ValuesSchema is the chart's values.schema.json, when it ships one
+	ValuesSchema json.RawMessage `json:"values_schema,omitempty"`
+	Data         struct {
+		// Dependencies are the chart's subcharts, configured below their names
+		Dependencies []struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	} `json:"data"`
 }
 
-// GenerateValues generates Helm values based on cluster analysis and requirements
-func (s *HelmService) GenerateValues(chart *agent.HelmChart, clusterAnalysis *agent.ClusterAnalysis, requirements map[string]interface{}) (map[string]interface{}, error) {
+// GenerateValues generates Helm values based on cluster analysis and requirements,
+// then injects the organization's value policy. Later sources win: the chart's
+// values, cluster settings, requirements, best practices, then the policy.
+// Plans keep these values whatever environment they deploy to; the
+// environment's overlays go over them at deployment, below the policy, see
+// ApplyValueOverlays.
+func (s *HelmService) GenerateValues(chart *agent.HelmChart, clusterAnalysis *agent.ClusterAnalysis, requirements map[string]interface{}, policy *ValuePolicy) (map[string]interface{}, error) {
 	// Start with default values
 	values := make(map[string]interface{})
 
@@ -131,7 +183,12 @@ func (s *HelmService) GenerateValues(chart *agent.HelmChart, clusterAnalysis *ag
 	}
 
 	// Apply cluster-specific customizations
-	s.customizeForCluster(values, clusterAnalysis)
+	if err := s.customizeForCluster(values, chart.Namespace, clusterAnalysis); err != nil {
+		return nil, err
+	}
+	if clusterAnalysis != nil {
+		s.configureServiceMesh(values, chart.Name, clusterAnalysis.ServiceMesh)
+	}
 
 	// Apply user requirements
 	s.applyUserRequirements(values, requirements)
@@ -139,15 +196,30 @@ func (s *HelmService) GenerateValues(chart *agent.HelmChart, clusterAnalysis *ag
 	// Apply best practices
 	s.applyBestPractices(values, chart.Name)
 
+	// Apply mandatory organization values last so nothing overrides them
+	s.applyValuePolicy(values, chart.Name, policy)
+
+	// Keep Linux-only components off Windows nodes, without dropping policy tolerations
+	s.configureNodeScheduling(values, clusterAnalysis)
+
 	return values, nil
 }
 
-// customizeForCluster customizes values based on cluster capabilities
-func (s *HelmService) customizeForCluster(values map[string]interface{}, cluster *agent.ClusterAnalysis) {
-	// Set resource limits based on cluster capacity
+// customizeForCluster customizes values based on cluster capabilities and the
+// limits of the namespace the chart is installed in
+func (s *HelmService) customizeForCluster(values map[string]interface{}, namespace string, cluster *agent.ClusterAnalysis) error {
+	if cluster == nil {
+		return nil
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	// Set resource limits the namespace admits
 	if cluster.Resources.AvailableCPU != "" && cluster.Resources.AvailableMemory != "" {
-		// Calculate reasonable resource limits (e.g., 20% of available resources)
-		s.setResourceLimits(values, cluster.Resources)
+		if err := s.setResourceLimits(values, namespace, cluster); err != nil {
+			return err
+		}
 	}
 
 	// Configure storage based on available storage classes
@@ -157,32 +229,126 @@ func (s *HelmService) customizeForCluster(values map[string]interface{}, cluster
 
 	// Configure ingress if available
 	if cluster.Capabilities.IngressAvailable {
-		s.configureIngress(values)
+		s.configureIngress(values, cluster.Ingress)
 	}
 
 	// Configure security settings
 	if cluster.Security.RBACEnabled {
 		s.configureRBAC(values)
 	}
+
+	// Pre-empt rejections from enforced admission policies
+	s.applyPolicyConstraints(values, cluster.Policies)
+	return nil
 }
 
-// setResourceLimits sets resource limits based on cluster capacity
-func (s *HelmService) setResourceLimits(values map[string]interface{}, resources agent.ClusterResources) {
-	// This is a simplified approach - in production, you'd want more sophisticated resource calculation
-	resourceConfig := map[string]interface{}{
-		"resources": map[string]interface{}{
-			"limits": map[string]interface{}{
-				"cpu":    "500m",
-				"memory": "512Mi",
+// applyPolicyConstraints sets values that enforced Kyverno/Gatekeeper policies require
+func (s *HelmService) applyPolicyConstraints(values map[string]interface{}, policies []agent.PolicySummary) {
+	for _, policy := range policies {
+		if !policy.Enforced() {
+			continue
+		}
+		for _, constraint := range policy.Constraints {
+			for _, adjustment := range translateRejection("", constraint) {
+				if adjustment.Automatic {
+					s.mergeValues(values, valuesAtPath(adjustment.Path, adjustment.Value))
+				}
+			}
+		}
+	}
+}
+
+// configureServiceMesh joins workloads to a detected mesh: sidecar injection,
+// probes that keep working behind the proxy, and ServiceMonitor settings that
+// scrape through mTLS without picking up the sidecar's own ports
+func (s *HelmService) configureServiceMesh(values map[string]interface{}, chartName string, mesh *agent.ServiceMesh) {
+	name := strings.ToLower(chartName)
+	if mesh == nil || strings.Contains(name, "istio") || strings.Contains(name, "linkerd") {
+		return
+	}
+
+	var meshConfig map[string]interface{}
+	var proxyContainer string
+	switch mesh.Type {
+	case "istio":
+		proxyContainer = "istio-proxy"
+		meshConfig = map[string]interface{}{
+			"podAnnotations": map[string]interface{}{
+				"sidecar.istio.io/inject": "true",
+				// Have the sidecar answer kubelet HTTP probes so they pass under mTLS
+				"sidecar.istio.io/rewriteAppHTTPProbers": "true",
+				"proxy.istio.io/config":                  `{"holdApplicationUntilProxyStarts": true}`,
 			},
-			"requests": map[string]interface{}{
-				"cpu":    "100m",
-				"memory": "128Mi",
+		}
+	case "linkerd":
+		proxyContainer = "linkerd-proxy"
+		meshConfig = map[string]interface{}{
+			"podAnnotations": map[string]interface{}{
+				"linkerd.io/inject": "enabled",
+			},
+		}
+	default:
+		return
+	}
+	s.mergeValues(values, meshConfig)
+
+	if !exposesServiceMonitor(values, chartName) {
+		return
+	}
+
+	serviceMonitor := map[string]interface{}{
+		"relabelings": []interface{}{
+			map[string]interface{}{
+				"sourceLabels": []interface{}{"__meta_kubernetes_pod_container_name"},
+				"regex":        proxyContainer,
+				"action":       "drop",
 			},
 		},
 	}
+	// Under strict mTLS Prometheus must present the mesh certificates, which
+	// Istio's documented setup writes to /etc/prom-certs in the Prometheus pod
+	if mesh.Type == "istio" && mesh.MTLSMode == "STRICT" {
+		serviceMonitor["scheme"] = "https"
+		serviceMonitor["tlsConfig"] = map[string]interface{}{
+			"caFile":             "/etc/prom-certs/root-cert.pem",
+			"certFile":           "/etc/prom-certs/cert-chain.pem",
+			"keyFile":            "/etc/prom-certs/key.pem",
+			"insecureSkipVerify": true,
+		}
+	}
+	s.mergeValues(values, map[string]interface{}{"serviceMonitor": serviceMonitor})
+}
+
+// exposesServiceMonitor reports whether the chart's values configure a ServiceMonitor
+func exposesServiceMonitor(values map[string]interface{}, chartName string) bool {
+	if _, ok := values["serviceMonitor"]; ok {
+		return true
+	}
+	name := strings.ToLower(chartName)
+	return strings.Contains(name, "prometheus") || strings.Contains(name, "grafana")
+}
+
+// setResourceLimits sets container requests and limits the LimitRanges of the
+// chart's namespace admit, starting from their defaults when they set any.
+// Production clusters request what the containers may use, so their pods are
+// never overcommitted or evicted first.
+func (s *HelmService) setResourceLimits(values map[string]interface{}, namespace string, cluster *agent.ClusterAnalysis) error {
+	requests, limits, err := containerResources(cluster.NamespaceLimitsOf(namespace))
+	if err != nil {
+		return err
+	}
+	if cluster.Production() {
+		requests = limits.DeepCopy()
+	}
+	resourceConfig := map[string]interface{}{
+		"resources": map[string]interface{}{
+			"limits":   resourceValues(limits),
+			"requests": resourceValues(requests),
+		},
+	}
 
 	s.mergeValues(values, resourceConfig)
+	return nil
 }
 
 // configureStorage configures storage settings
@@ -198,17 +364,17 @@ func (s *HelmService) configureStorage(values map[string]interface{}, storageCla
 	}
 }
 
-// configureIngress configures ingress settings
-func (s *HelmService) configureIngress(values map[string]interface{}) {
-	ingressConfig := map[string]interface{}{
-		"ingress": map[string]interface{}{
-			"enabled": true,
-			"annotations": map[string]interface{}{
-				"kubernetes.io/ingress.class": "nginx",
-			},
-		},
+// configureIngress enables the chart's Ingress with the cluster's ingress
+// class. Without a known class the cluster's default class applies.
+func (s *HelmService) configureIngress(values map[string]interface{}, ingress *agent.IngressSupport) {
+	ingressValues := map[string]interface{}{
+		"enabled": true,
+	}
+	// The class annotation is deprecated and rejected along with the field
+	if class := ingress.IngressClass(); class != "" {
+		ingressValues["ingressClassName"] = class
 	}
-	s.mergeValues(values, ingressConfig)
+	s.mergeValues(values, map[string]interface{}{"ingress": ingressValues})
 }
 
 // configureRBAC configures RBAC settings
@@ -267,20 +433,27 @@ func (s *HelmService) mergeValues(target, source map[string]interface{}) {
 	}
 }
 
-// CreateDeploymentPlan creates a deployment plan for a specific stack
-func (s *HelmService) CreateDeploymentPlan(stackName string, clusterAnalysis *agent.ClusterAnalysis) (*agent.DeploymentPlan, error) {
+// CreateDeploymentPlan creates a deployment plan for a specific stack from
+// the best ranked charts of a search the organization's rules allow, see
+// RankCharts
+func (s *HelmService) CreateDeploymentPlan(stackName string, clusterAnalysis *agent.ClusterAnalysis, policy *ValuePolicy, chartPolicy *ChartPolicy, rules ChartRules) (*agent.DeploymentPlan, error) {
 	// Search for relevant charts
-	charts, err := s.SearchCharts(stackName)
+	results, err := s.SearchCharts(stackName, rules)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search charts: %w", err)
 	}
 
+	charts, excluded := RankCharts(results, stackName, chartPolicy)
 	if len(charts) == 0 {
+		if excluded > 0 {
+			return nil, fmt.Errorf("no charts found for stack: %s (%d deprecated or left out by the chart policy)", stackName, excluded)
+		}
 		return nil, fmt.Errorf("no charts found for stack: %s", stackName)
 	}
 
 	// Create deployment plan
 	plan := &agent.DeploymentPlan{
+		SchemaVersion: agent.PlanSchemaVersion,
 		ID:            fmt.Sprintf("plan-%s-%d", stackName, time.Now().Unix()),
 		Name:          fmt.Sprintf("Deploy %s Stack", stackName),
 		Description:   fmt.Sprintf("Deployment plan for %s stack", stackName),
@@ -304,20 +477,28 @@ func (s *HelmService) CreateDeploymentPlan(stackName string, clusterAnalysis *ag
 			"Rollback may be required if issues occur",
 		},
 	}
+	plan.Risks = append(plan.Risks, nodeSchedulingRisks(clusterAnalysis, policy)...)
 
 	// Add charts to the plan
-	for i, chart := range charts[:3] { // Limit to top 3 charts
+	for i, chart := range charts[:min(planChartLimit, len(charts))] {
+		if !chart.Trusted {
+			plan.Risks = append(plan.Risks, fmt.Sprintf("%s is from %s, which isn't an official, verified or trusted publisher", chart.Name, chart.Provider))
+		}
+		if chart.Deprecated {
+			plan.Risks = append(plan.Risks, fmt.Sprintf("%s is deprecated", chart.Name))
+		}
 		helmChart := agent.HelmChart{
 			Name:        chart.Name,
 			Repository:  chart.Repository,
 			Version:     chart.Version,
 			Description: chart.Description,
 			URL:         chart.URL,
+			ChartID:     chart.ID,
 			Values:      make(map[string]interface{}),
 		}
 
 		// Generate values for this chart
-		values, err := s.GenerateValues(&helmChart, clusterAnalysis, nil)
+		values, err := s.GenerateValues(&helmChart, clusterAnalysis, nil, policy)
 		if err == nil {
 			helmChart.Values = values
 		}
@@ -337,3 +518,65 @@ func (s *HelmService) CreateDeploymentPlan(stackName string, clusterAnalysis *ag
 
 	return plan, nil
 }
+
+// PrepareGeneratedPlan turns a plan the model generated into one that can be
+// stored and deployed: it gets an ID, pending steps and the Artifact Hub
+// package of each chart found there. The model's chart values are applied as
+// requirements, so cluster settings, best practices and the value policy apply
+// as they do to searched plans.
+func (s *HelmService) PrepareGeneratedPlan(plan *agent.DeploymentPlan, clusterAnalysis *agent.ClusterAnalysis, policy *ValuePolicy) error {
+	plan.SchemaVersion = agent.PlanSchemaVersion
+	plan.ID = fmt.Sprintf("plan-%d", time.Now().UnixNano())
+	plan.SecurityReport = nil
+	plan.Risks = append(plan.Risks, nodeSchedulingRisks(clusterAnalysis, policy)...)
+
+	// The chart list is rebuilt from the steps so both share each chart's values
+	plan.Charts = make([]agent.HelmChart, 0, len(plan.Steps))
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		step.Status = "pending"
+		step.Logs = nil
+		step.StartTime = nil
+		step.EndTime = nil
+		step.Error = ""
+		if step.Chart == nil {
+			continue
+		}
+
+		if step.Chart.ChartID == "" {
+			s.resolveChartPackage(step.Chart)
+		}
+		requirements := step.Chart.Values
+		step.Chart.Values = nil
+		values, err := s.GenerateValues(step.Chart, clusterAnalysis, requirements, policy)
+		if err != nil {
+			return fmt.Errorf("failed to generate values of chart %s: %w", step.Chart.Name, err)
+		}
+		step.Chart.Values = values
+		plan.Charts = append(plan.Charts, *step.Chart)
+	}
+	return nil
+}
+
+// resolveChartPackage fills in the Artifact Hub package of a chart from its
+// name and repository. Charts that aren't found are left as they are.
+func (s *HelmService) resolveChartPackage(chart *agent.HelmChart) {
+	results, err := s.SearchCharts(chart.Name, nil)
+	if err != nil {
+		fmt.Printf("Failed to look up chart %s: %v\n", chart.Name, err)
+		return
+	}
+	for _, result := range results {
+		if result.Name != chart.Name || strings.TrimRight(result.Repository, "/") != strings.TrimRight(chart.Repository, "/") {
+			continue
+		}
+		chart.ChartID = result.ID
+		if chart.URL == "" {
+			chart.URL = result.URL
+		}
+		if chart.Description == "" {
+			chart.Description = result.Description
+		}
+		return
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// HelmTestStep verifies an installed release by running the chart's helm tests
+type HelmTestStep struct{}
+
+// NewHelmTestStep creates a new helm test verification step
+func NewHelmTestStep() *HelmTestStep {
+	return &HelmTestStep{}
+}
+
+var testHookPattern = regexp.MustCompile(`helm\.sh/hook["']?\s*:\s*["']?[^"'\n]*\btest(-success)?\b`)
+
+// Name identifies the step in execution results
+func (s *HelmTestStep) Name() string {
+	return "helm-test"
+}
+
+// Applies reports whether the step should run; charts without tests are skipped in Run
+func (s *HelmTestStep) Applies(chart *agent.HelmChart) bool {
+	return chart != nil
+}
+
+// Run executes helm test for the release, attaching test pod logs as artifacts.
+// Failing tests fail verification.
+func (s *HelmTestStep) Run(ctx context.Context, chart *agent.HelmChart, kubeconfig string, result *agent.PostDeployResult) error {
+	kubeconfigFile, err := writeKubeconfigFile(kubeconfig)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(kubeconfigFile)
+	env := append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", kubeconfigFile))
+
+	release := releaseName(chart)
+	namespaceArgs := []string{}
+	if chart.Namespace != "" {
+		namespaceArgs = []string{"--namespace", chart.Namespace}
+	}
+
+	// Only charts that ship test hooks have anything to run
+	hooks := exec.CommandContext(ctx, "helm", append([]string{"get", "hooks", release}, namespaceArgs...)...)
+	hooks.Env = env
+	hooksOutput, err := hooks.Output()
+	if err != nil {
+		return fmt.Errorf("failed to read release hooks: %w", err)
+	}
+	if !testHookPattern.Match(hooksOutput) {
+		result.Status = "skipped"
+		result.Logs = append(result.Logs, fmt.Sprintf("Chart %s defines no tests", chart.Name))
+		return nil
+	}
+
+	args := append([]string{"test", release, "--logs", "--timeout", "5m"}, namespaceArgs...)
+	test := exec.CommandContext(ctx, "helm", args...)
+	test.Env = env
+	output, testErr := test.CombinedOutput()
+
+	result.Artifacts = append(result.Artifacts, parseTestPodLogs(string(output))...)
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "TEST SUITE:") || strings.HasPrefix(line, "Phase:") {
+			result.Logs = append(result.Logs, strings.TrimSpace(line))
+		}
+	}
+
+	if testErr != nil {
+		result.Artifacts = append(result.Artifacts, agent.ExecutionArtifact{Name: "helm-test-output", Content: string(output)})
+		return fmt.Errorf("helm tests failed for %s: %w", release, testErr)
+	}
+
+	result.Logs = append(result.Logs, fmt.Sprintf("Helm tests passed for %s", release))
+	return nil
+}
+
+// parseTestPodLogs splits the "POD LOGS: <pod>" sections of helm test --logs output
+func parseTestPodLogs(output string) []agent.ExecutionArtifact {
+	var artifacts []agent.ExecutionArtifact
+	var current *agent.ExecutionArtifact
+	var content strings.Builder
+
+	flush := func() {
+		if current != nil {
+			current.Content = strings.TrimSpace(content.String())
+			artifacts = append(artifacts, *current)
+			content.Reset()
+		}
+	}
+
+	for _, line := range strings.Split(output, "\n") {
+		if pod, ok := strings.CutPrefix(line, "POD LOGS: "); ok {
+			flush()
+			current = &agent.ExecutionArtifact{Name: "test-pod-logs/" + strings.TrimSpace(pod)}
+			continue
+		}
+		if current != nil {
+			content.WriteString(line)
+			content.WriteString("\n")
+		}
+	}
+	flush()
+
+	return artifacts
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Value change types
+const (
+	ValueAdded   = "added"   // the chart has no default for the value
+	ValueChanged = "changed" // the value overrides a different default
+	ValueRemoved = "removed" // the value is null, which deletes the default
+)
+
+// ValueChange is one value the generated values set differently from the
+// chart's defaults
+type ValueChange struct {
+	// Path is the dotted path of the value, e.g. resources.limits.memory. Lists
+	// replace the default list as a whole, so they are compared as one value.
+	Path    string      `json:"path"`
+	Type    string      `json:"type"`
+	Default interface{} `json:"default,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+}
+
+// ValuesDiff is how a chart's generated values differ from its default values.yaml
+type ValuesDiff struct {
+	Chart   string        `json:"chart"`
+	Version string        `json:"version,omitempty"`
+	Changes []ValueChange `json:"changes"`
+	// Unchanged counts generated values equal to their default
+	Unchanged int `json:"unchanged"`
+}
+
+// DiffValues compares a chart's generated values with the chart's default
+// values.yaml, listing every value the plan adds or overrides
+func (s *HelmService) DiffValues(ctx context.Context, chart *agent.HelmChart) (*ValuesDiff, error) {
+	defaults, err := s.ChartDefaultValues(ctx, chart)
+	if err != nil {
+		return nil, err
+	}
+
+	// Compare the generated values as they'd reach helm, e.g. with numbers as floats
+	encoded, err := json.Marshal(chart.Values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode values: %w", err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(encoded, &values); err != nil {
+		return nil, fmt.Errorf("failed to decode values: %w", err)
+	}
+
+	diff := &ValuesDiff{Chart: chart.Name, Version: chart.Version, Changes: []ValueChange{}}
+	diffValueMaps(diff, "", defaults, values)
+	sort.Slice(diff.Changes, func(i, j int) bool { return diff.Changes[i].Path < diff.Changes[j].Path })
+	return diff, nil
+}
+
+// ChartDefaultValues reads a chart's values.yaml with helm show values
+func (s *HelmService) ChartDefaultValues(ctx context.Context, chart *agent.HelmChart) (map[string]interface{}, error) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		return nil, fmt.Errorf("helm not available: %w", err)
+	}
+
+	registryArgs, cleanup, err := registryLogin(ctx, chart)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	reference, err := s.chartReference(chart)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"show", "values"}, reference...)
+	args = append(args, registryArgs...)
+	if chart.Version != "" {
+		args = append(args, "--version", chart.Version)
+	}
+	cmd := exec.CommandContext(ctx, "helm", args...)
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("helm show values failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	defaults := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(stdout.String()), &defaults); err != nil {
+		return nil, fmt.Errorf("failed to parse values.yaml of %s: %w", chart.Name, err)
+	}
+	return defaults, nil
+}
+
+// diffValueMaps records the changes of values against defaults below path.
+// Maps merge with the defaults the way helm merges them, key by key.
+func diffValueMaps(diff *ValuesDiff, path string, defaults, values map[string]interface{}) {
+	for key, value := range values {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+		defaultValue, hasDefault := defaults[key]
+
+		switch {
+		case value == nil:
+			if hasDefault && defaultValue != nil {
+				diff.Changes = append(diff.Changes, ValueChange{Path: keyPath, Type: ValueRemoved, Default: defaultValue})
+			} else {
+				diff.Unchanged++
+			}
+		case isValueMap(value) && (isValueMap(defaultValue) || defaultValue == nil):
+			defaultMap, _ := defaultValue.(map[string]interface{})
+			nested := value.(map[string]interface{})
+			if len(nested) == 0 && hasDefault {
+				diff.Unchanged++
+				continue
+			}
+			diffValueMaps(diff, keyPath, defaultMap, nested)
+		case !hasDefault || defaultValue == nil:
+			diff.Changes = append(diff.Changes, ValueChange{Path: keyPath, Type: ValueAdded, Value: value})
+		case reflect.DeepEqual(value, defaultValue):
+			diff.Unchanged++
+		default:
+			diff.Changes = append(diff.Changes, ValueChange{Path: keyPath, Type: ValueChanged, Default: defaultValue, Value: value})
+		}
+	}
+}
+
+// isValueMap reports whether a decoded value is a map
+func isValueMap(value interface{}) bool {
+	_, ok := value.(map[string]interface{})
+	return ok
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// chartDocsTTL is how long a chart's values, schema and README are reused
+// between suggestions, so autocompletion doesn't hit Artifact Hub per keystroke
+const chartDocsTTL = 10 * time.Minute
+
+// ValueSuggestion is a key the values editor can complete
+type ValueSuggestion struct {
+	// Path is the full dotted path of the key
+	Path string `json:"path"`
+	Key  string `json:"key"`
+	// Type is a JSON schema type: object, array, string, integer, number, boolean or null
+	Type        string        `json:"type,omitempty"`
+	Default     interface{}   `json:"default,omitempty"`
+	Description string        `json:"description,omitempty"`
+	Enum        []interface{} `json:"enum,omitempty"`
+}
+
+// ValueSuggestions are the keys valid below a partial values path
+type ValueSuggestions struct {
+	ChartID string `json:"chart_id"`
+	Version string `json:"version"`
+	// Parent is the object the suggested keys belong to, Prefix the partial key typed so far
+	Parent      string            `json:"parent"`
+	Prefix      string            `json:"prefix"`
+	Suggestions []ValueSuggestion `json:"suggestions"`
+	// HasSchema reports whether the chart ships a values.schema.json
+	HasSchema bool `json:"has_schema"`
+}
+
+// chartDocs are the parsed sources of value suggestions of one chart version
+type chartDocs struct {
+	version      string
+	values       map[string]interface{}
+	schema       map[string]interface{}
+	descriptions map[string]string
+	readme       string
+	// subcharts are the names of the chart's dependencies
+	subcharts map[string]bool
+	fetchedAt time.Time
+}
+
+// chartDocsCache caches chart docs by chart ID and version
+type chartDocsCache struct {
+	mu    sync.Mutex
+	items map[string]*chartDocs
+}
+
+// SuggestValues lists the keys valid at a partial values path, e.g.
+// "resources.lim" or "image.", with their types, defaults and documentation
+// taken from the chart's values.yaml, values.schema.json and README parameter
+// tables. An empty version uses the latest.
+func (s *HelmService) SuggestValues(chartID, version, path string) (*ValueSuggestions, error) {
+	docs, err := s.chartDocs(chartID, version)
+	if err != nil {
+		return nil, err
+	}
+
+	parent, prefix := "", path
+	if i := strings.LastIndex(path, "."); i != -1 {
+		parent, prefix = path[:i], path[i+1:]
+	}
+	var segments []string
+	if parent != "" {
+		segments = strings.Split(parent, ".")
+	}
+
+	result := &ValueSuggestions{
+		ChartID:     chartID,
+		Version:     docs.version,
+		Parent:      parent,
+		Prefix:      prefix,
+		Suggestions: []ValueSuggestion{},
+		HasSchema:   docs.schema != nil,
+	}
+
+	suggestions := map[string]*ValueSuggestion{}
+	suggest := func(key string) *ValueSuggestion {
+		if !strings.HasPrefix(strings.ToLower(key), strings.ToLower(prefix)) {
+			return nil
+		}
+		if suggestion, ok := suggestions[key]; ok {
+			return suggestion
+		}
+		keyPath := key
+		if parent != "" {
+			keyPath = parent + "." + key
+		}
+		suggestion := &ValueSuggestion{Path: keyPath, Key: key, Description: docs.descriptions[keyPath]}
+		suggestions[key] = suggestion
+		return suggestion
+	}
+
+	if defaults, ok := lookupValue(docs.values, segments).(map[string]interface{}); ok {
+		for key, value := range defaults {
+			if suggestion := suggest(key); suggestion != nil {
+				suggestion.Type = valueType(value)
+				// Objects are completed key by key, their defaults with them
+				if suggestion.Type != "object" {
+					suggestion.Default = value
+				}
+			}
+		}
+	}
+	if properties, ok := lookupSchema(docs.schema, segments)["properties"].(map[string]interface{}); ok {
+		for key, property := range properties {
+			property, _ := property.(map[string]interface{})
+			suggestion := suggest(key)
+			if suggestion == nil || property == nil {
+				continue
+			}
+			if schemaType := schemaType(property); schemaType != "" {
+				suggestion.Type = schemaType
+			}
+			if description, ok := property["description"].(string); ok && suggestion.Description == "" {
+				suggestion.Description = description
+			}
+			if value, ok := property["default"]; ok && suggestion.Default == nil {
+				suggestion.Default = value
+			}
+			if enum, ok := property["enum"].([]interface{}); ok {
+				suggestion.Enum = enum
+			}
+		}
+	}
+	// Documented keys missing from values.yaml, e.g. commented-out defaults
+	for documented, description := range docs.descriptions {
+		rest := documented
+		if parent != "" {
+			if !strings.HasPrefix(documented, parent+".") {
+				continue
+			}
+			rest = strings.TrimPrefix(documented, parent+".")
+		}
+		key := strings.SplitN(rest, ".", 2)[0]
+		if _, ok := suggestions[key]; ok {
+			continue
+		}
+		if suggestion := suggest(key); suggestion != nil && key == rest {
+			suggestion.Description = description
+		} else if suggestion != nil {
+			suggestion.Type = "object"
+		}
+	}
+
+	for _, suggestion := range suggestions {
+		result.Suggestions = append(result.Suggestions, *suggestion)
+	}
+	sort.Slice(result.Suggestions, func(i, j int) bool { return result.Suggestions[i].Key < result.Suggestions[j].Key })
+	return result, nil
+}
+
+// chartDocs returns a chart version's parsed values, schema and README
+// descriptions, from the cache when fresh
+func (s *HelmService) chartDocs(chartID, version string) (*chartDocs, error) {
+	cacheKey := chartID + "@" + version
+	s.docs.mu.Lock()
+	cached, ok := s.docs.items[cacheKey]
+	s.docs.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < chartDocsTTL {
+		return cached, nil
+	}
+
+	detailsID := chartID
+	if version != "" {
+		detailsID = chartID + "/" + version
+	}
+	details, err := s.GetChartDetails(detailsID)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := &chartDocs{version: details.Version, fetchedAt: time.Now()}
+	if docs.version == "" {
+		docs.version = version
+	}
+	valuesYAML := details.Values
+	if valuesYAML == "" {
+		// The package API leaves the values out; they have an endpoint of their own
+		valuesYAML, _ = s.fetchChartValues(chartID, docs.version)
+	}
+	if valuesYAML != "" {
+		if err := yaml.Unmarshal([]byte(valuesYAML), &docs.values); err != nil {
+			return nil, fmt.Errorf("failed to parse values.yaml: %w", err)
+		}
+	}
+	if len(details.ValuesSchema) > 0 {
+		var schema map[string]interface{}
+		if err := json.Unmarshal(details.ValuesSchema, &schema); err == nil && len(schema) > 0 {
+			docs.schema = schema
+		}
+	}
+	docs.descriptions = parseValueDescriptions(details.Readme, valuesYAML)
+	docs.readme = details.Readme
+	docs.subcharts = make(map[string]bool, len(details.Data.Dependencies))
+	for _, dependency := range details.Data.Dependencies {
+		docs.subcharts[dependency.Name] = true
+	}
+
+	s.docs.mu.Lock()
+	if s.docs.items == nil {
+		s.docs.items = make(map[string]*chartDocs)
+	}
+	s.docs.items[cacheKey] = docs
+	s.docs.mu.Unlock()
+	return docs, nil
+}
+
+// fetchChartValues downloads a chart version's default values.yaml
+func (s *HelmService) fetchChartValues(chartID, version string) (string, error) {
+	url := fmt.Sprintf("%s/api/v1/packages/%s/%s/values", s.artifactHubURL, chartID, version)
+	resp, err := s.artifactHubClient.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("failed to get chart values: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get chart values with status: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	return string(body), nil
+}
+
+var (
+	// readmeTableRow matches a parameter table row whose first cell is the
+	// key, as generated by helm-docs and the Bitnami readme generator
+	readmeTableRow = regexp.MustCompile("^\\|\\s*`?([A-Za-z0-9_.\\-\\[\\]\"]+)`?\\s*\\|(.*)\\|\\s*$")
+	// valuesParamComment matches "## @param key description" annotations in values.yaml
+	valuesParamComment = regexp.MustCompile(`^\s*#+\s*@param\s+(\S+)\s+(.+)$`)
+)
+
+// parseValueDescriptions collects value descriptions from README parameter
+// tables and @param annotations in values.yaml, keyed by dotted path
+func parseValueDescriptions(readme, valuesYAML string) map[string]string {
+	descriptions := map[string]string{}
+
+	descriptionColumn := -1
+	for _, line := range strings.Split(readme, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "|") {
+			descriptionColumn = -1
+			continue
+		}
+		cells := strings.Split(strings.Trim(line, "|"), "|")
+		if descriptionColumn == -1 {
+			// A header row names the description column of the rows below it
+			for i, cell := range cells {
+				if strings.EqualFold(strings.TrimSpace(cell), "description") {
+					descriptionColumn = i
+				}
+			}
+			continue
+		}
+		match := readmeTableRow.FindStringSubmatch(line)
+		if match == nil || descriptionColumn >= len(cells) {
+			continue
+		}
+		description := strings.TrimSpace(cells[descriptionColumn])
+		if description != "" && !strings.HasPrefix(description, "---") {
+			descriptions[match[1]] = description
+		}
+	}
+
+	for _, line := range strings.Split(valuesYAML, "\n") {
+		if match := valuesParamComment.FindStringSubmatch(line); match != nil {
+			descriptions[match[1]] = strings.TrimSpace(match[2])
+		}
+	}
+	return descriptions
+}
+
+// lookupValue walks decoded values down a path, indexing lists by number
+func lookupValue(value interface{}, segments []string) interface{} {
+	for _, segment := range segments {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			value = typed[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(typed) {
+				return nil
+			}
+			value = typed[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// lookupSchema walks a JSON schema down a path through object properties and
+// array items
+func lookupSchema(schema map[string]interface{}, segments []string) map[string]interface{} {
+	for _, segment := range segments {
+		if schema == nil {
+			return nil
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			if property, ok := properties[segment].(map[string]interface{}); ok {
+				schema = property
+				continue
+			}
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			if _, err := strconv.Atoi(segment); err == nil {
+				schema = items
+				continue
+			}
+		}
+		return nil
+	}
+	return schema
+}
+
+// schemaType returns a schema's type, skipping null in type lists
+func schemaType(schema map[string]interface{}) string {
+	switch typed := schema["type"].(type) {
+	case string:
+		return typed
+	case []interface{}:
+		for _, candidate := range typed {
+			if name, ok := candidate.(string); ok && name != "null" {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// valueType returns the JSON schema type of a decoded value
+func valueType(value interface{}) string {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if typed == float64(int64(typed)) {
+			return "integer"
+		}
+		return "number"
+	case nil:
+		return "null"
+	}
+	return ""
+}
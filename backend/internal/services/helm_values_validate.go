@@ -0,0 +1,160 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ValuesValidation is the outcome of checking a chart's values against the
+// keys the chart has and its values.schema.json
+type ValuesValidation struct {
+	Chart string `json:"chart"`
+	// Dropped are keys the chart doesn't have, removed from its values since
+	// Helm would silently ignore them
+	Dropped []string `json:"dropped,omitempty"`
+	// Violations are the values.schema.json violations of the values, which
+	// Helm refuses to install
+	Violations []string `json:"violations,omitempty"`
+	// SchemaError is why the chart's schema couldn't be checked, e.g. remote references
+	SchemaError string `json:"schema_error,omitempty"`
+}
+
+// Valid reports whether the values have no schema violations
+func (v *ValuesValidation) Valid() bool {
+	return len(v.Violations) == 0
+}
+
+// ValidateValues checks a chart's values against the chart's values.yaml,
+// README and values.schema.json. With correct, keys the chart doesn't have
+// are dropped from chart.Values first. Keys of subcharts and globals are
+// always kept, as are keys below maps the chart leaves free-form. Charts not
+// found on Artifact Hub can't be checked and return nil.
+func (s *HelmService) ValidateValues(chart *agent.HelmChart, correct bool) (*ValuesValidation, error) {
+	if chart.ChartID == "" {
+		return nil, nil
+	}
+	docs, err := s.chartDocs(chart.ChartID, chart.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	validation := &ValuesValidation{Chart: chart.Name}
+	// Without values.yaml or a schema every key would look undocumented
+	if correct && chart.Values != nil && (len(docs.values) > 0 || docs.schema != nil) {
+		pruneUndocumentedValues(docs, "", chart.Values, validation)
+		sort.Strings(validation.Dropped)
+	}
+	if docs.schema == nil {
+		return validation, nil
+	}
+
+	schema, err := compileValuesSchema(docs.schema)
+	if err != nil {
+		validation.SchemaError = err.Error()
+		return validation, nil
+	}
+	values, err := schemaInstance(chart.Values)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.Validate(values); err != nil {
+		validationErr, ok := err.(*jsonschema.ValidationError)
+		if !ok {
+			return nil, err
+		}
+		validation.Violations = agent.SchemaViolations(validationErr)
+	}
+	return validation, nil
+}
+
+// ValidatePlanValues validates the values of every chart of a plan, dropping
+// the keys the charts don't have and noting them under the plan's risks along
+// with schema violations. Charts that can't be checked are skipped.
+func (s *HelmService) ValidatePlanValues(plan *agent.DeploymentPlan) []ValuesValidation {
+	var validations []ValuesValidation
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		// The plan's chart list shares the step's values map
+		validation, err := s.ValidateValues(step.Chart, true)
+		if err != nil {
+			fmt.Printf("Failed to validate values of chart %s: %v\n", step.Chart.Name, err)
+			continue
+		}
+		if validation == nil {
+			continue
+		}
+		if len(validation.Dropped) > 0 {
+			plan.Risks = append(plan.Risks, fmt.Sprintf("Dropped values chart %s doesn't have: %s", step.Chart.Name, strings.Join(validation.Dropped, ", ")))
+		}
+		if !validation.Valid() {
+			plan.Risks = append(plan.Risks, fmt.Sprintf("Values of chart %s violate its values.schema.json and must be fixed before deploying: %s", step.Chart.Name, strings.Join(validation.Violations, "; ")))
+		}
+		validations = append(validations, *validation)
+	}
+	return validations
+}
+
+// pruneUndocumentedValues deletes the keys of values the chart doesn't have
+func pruneUndocumentedValues(docs *chartDocs, parent string, values map[string]interface{}, validation *ValuesValidation) {
+	for key, value := range values {
+		if parent == "" && (key == "global" || docs.subcharts[key]) {
+			continue
+		}
+		path := joinValuePath(parent, key)
+		if !documentsValuePath(docs, path) {
+			delete(values, key)
+			validation.Dropped = append(validation.Dropped, path)
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok && !isFreeFormValue(docs, path) {
+			pruneUndocumentedValues(docs, path, nested, validation)
+		}
+	}
+}
+
+// compileValuesSchema compiles a chart's values.schema.json. Charts declare
+// draft-07 or earlier as Helm validates with them; $schema overrides it.
+func compileValuesSchema(schema map[string]interface{}) (*jsonschema.Schema, error) {
+	encoded, err := json.Marshal(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode values schema: %w", err)
+	}
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft7
+	if err := compiler.AddResource("values.schema.json", bytes.NewReader(encoded)); err != nil {
+		return nil, fmt.Errorf("invalid values schema: %w", err)
+	}
+	compiled, err := compiler.Compile("values.schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("invalid values schema: %w", err)
+	}
+	return compiled, nil
+}
+
+// schemaInstance converts values to the JSON types the schema validator
+// expects, e.g. integers from YAML to numbers
+func schemaInstance(values map[string]interface{}) (interface{}, error) {
+	if values == nil {
+		values = map[string]interface{}{}
+	}
+	encoded, err := json.Marshal(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode values: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var instance interface{}
+	if err := decoder.Decode(&instance); err != nil {
+		return nil, fmt.Errorf("failed to decode values: %w", err)
+	}
+	return instance, nil
+}
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImageInspector reads image manifests from OCI/Docker registries
+type ImageInspector struct {
+	httpClient *http.Client
+	mu         sync.Mutex
+	platforms  map[string][]string
+}
+
+// NewImageInspector creates a new image inspector reaching the registries the
+// network allows
+func NewImageInspector(network Network) *ImageInspector {
+	return &ImageInspector{
+		httpClient: &http.Client{Timeout: 30 * time.Second, Transport: network.transport("Image registry", http.DefaultTransport)},
+		platforms:  make(map[string][]string),
+	}
+}
+
+// ImageReference is a parsed image name
+type ImageReference struct {
+	Registry   string
+	Repository string
+	Reference  string // tag or digest
+}
+
+// ParseImageReference splits an image into registry, repository and tag or digest,
+// applying Docker Hub defaults
+func ParseImageReference(image string) ImageReference {
+	ref := ImageReference{Registry: "registry-1.docker.io", Reference: "latest"}
+
+	name := image
+	if at := strings.Index(name, "@"); at >= 0 {
+		ref.Reference = name[at+1:]
+		name = name[:at]
+	} else if colon := strings.LastIndex(name, ":"); colon > strings.LastIndex(name, "/") {
+		ref.Reference = name[colon+1:]
+		name = name[:colon]
+	}
+
+	if slash := strings.Index(name, "/"); slash >= 0 {
+		first := name[:slash]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.Registry = first
+			name = name[slash+1:]
+		}
+	}
+	if ref.Registry == "docker.io" || ref.Registry == "index.docker.io" {
+		ref.Registry = "registry-1.docker.io"
+	}
+	if ref.Registry == "registry-1.docker.io" && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	ref.Repository = name
+
+	return ref
+}
+
+var manifestMediaTypes = strings.Join([]string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}, ", ")
+
+// Platforms returns the os/arch pairs an image publishes, e.g. "linux/amd64"
+func (i *ImageInspector) Platforms(ctx context.Context, image string) ([]string, error) {
+	i.mu.Lock()
+	cached, ok := i.platforms[image]
+	i.mu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	ref := ParseImageReference(image)
+	body, err := i.get(ctx, ref, fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, ref.Reference), manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest struct {
+		Manifests []struct {
+			Platform imagePlatform `json:"platform"`
+		} `json:"manifests"`
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	var platforms []string
+	if len(manifest.Manifests) > 0 {
+		seen := make(map[string]bool)
+		for _, entry := range manifest.Manifests {
+			// Attestation manifests are listed with an unknown platform
+			if entry.Platform.OS == "" || entry.Platform.OS == "unknown" {
+				continue
+			}
+			platform := entry.Platform.String()
+			if !seen[platform] {
+				seen[platform] = true
+				platforms = append(platforms, platform)
+			}
+		}
+	} else if manifest.Config.Digest != "" {
+		// Single-platform images record their platform in the config blob
+		configBody, err := i.get(ctx, ref, fmt.Sprintf("/v2/%s/blobs/%s", ref.Repository, manifest.Config.Digest), "*/*")
+		if err != nil {
+			return nil, err
+		}
+		var config imagePlatform
+		if err := json.Unmarshal(configBody, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse image config: %w", err)
+		}
+		platforms = append(platforms, config.String())
+	}
+
+	i.mu.Lock()
+	i.platforms[image] = platforms
+	i.mu.Unlock()
+
+	return platforms, nil
+}
+
+// imageLicensesLabel is the OCI annotation and label holding an SPDX license expression
+const imageLicensesLabel = "org.opencontainers.image.licenses"
+
+// Licenses returns the SPDX license expression an image declares in its OCI
+// annotations or config labels, or "" when it declares none
+func (i *ImageInspector) Licenses(ctx context.Context, image string) (string, error) {
+	ref := ParseImageReference(image)
+	body, err := i.get(ctx, ref, fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, ref.Reference), manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+
+	var manifest struct {
+		Annotations map[string]string `json:"annotations"`
+		Manifests   []struct {
+			Digest   string        `json:"digest"`
+			Platform imagePlatform `json:"platform"`
+		} `json:"manifests"`
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if license := manifest.Annotations[imageLicensesLabel]; license != "" {
+		return license, nil
+	}
+
+	// Multi-platform images keep labels in each platform's config; they are
+	// built from the same source, so one platform is enough
+	if len(manifest.Manifests) > 0 {
+		digest := ""
+		for _, entry := range manifest.Manifests {
+			if entry.Platform.OS == "" || entry.Platform.OS == "unknown" {
+				continue
+			}
+			if digest == "" || entry.Platform.String() == "linux/amd64" {
+				digest = entry.Digest
+			}
+		}
+		if digest == "" {
+			return "", nil
+		}
+		body, err = i.get(ctx, ref, fmt.Sprintf("/v2/%s/manifests/%s", ref.Repository, digest), manifestMediaTypes)
+		if err != nil {
+			return "", err
+		}
+		manifest.Annotations = nil
+		manifest.Config.Digest = ""
+		if err := json.Unmarshal(body, &manifest); err != nil {
+			return "", fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if license := manifest.Annotations[imageLicensesLabel]; license != "" {
+			return license, nil
+		}
+	}
+	if manifest.Config.Digest == "" {
+		return "", nil
+	}
+
+	configBody, err := i.get(ctx, ref, fmt.Sprintf("/v2/%s/blobs/%s", ref.Repository, manifest.Config.Digest), "*/*")
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		Config struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(configBody, &config); err != nil {
+		return "", fmt.Errorf("failed to parse image config: %w", err)
+	}
+	return config.Config.Labels[imageLicensesLabel], nil
+}
+
+type imagePlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+}
+
+func (p imagePlatform) String() string {
+	return p.OS + "/" + p.Architecture
+}
+
+var bearerParamPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// get fetches a registry path, performing the anonymous token handshake when challenged
+func (i *ImageInspector) get(ctx context.Context, ref ImageReference, path, accept string) ([]byte, error) {
+	endpoint := "https://" + ref.Registry + path
+
+	resp, err := i.request(ctx, endpoint, accept, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		token, err := i.token(ctx, challenge, ref.Repository)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = i.request(ctx, endpoint, accept, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry %s returned %d for %s", ref.Registry, resp.StatusCode, ref.Repository)
+	}
+	return body, nil
+}
+
+func (i *ImageInspector) request(ctx context.Context, endpoint, accept, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", accept)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	return resp, nil
+}
+
+// token obtains an anonymous pull token from the realm named in a Bearer challenge
+func (i *ImageInspector) token(ctx context.Context, challenge, repository string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return "", fmt.Errorf("registry requires unsupported authentication: %s", challenge)
+	}
+
+	params := make(map[string]string)
+	for _, match := range bearerParamPattern.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("registry challenge has no realm")
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", repository)
+	}
+	query.Set("scope", scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	resp, err := i.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %d, the image may be private", resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
@@ -0,0 +1,441 @@
+package services
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// letsEncryptServer is the ACME directory certificates are requested from by default
+const letsEncryptServer = "https://acme-v02.api.letsencrypt.org/directory"
+
+// httpsPattern matches requests asking for charts to be served over HTTPS
+var httpsPattern = regexp.MustCompile(`(?i)\b(https|tls|ssl|certificates?|cert-manager|let'?s ?encrypt)\b`)
+
+// IngressPolicy is how an organization's plans expose charts: the hostnames
+// they are served on and who issues their certificates
+type IngressPolicy struct {
+	// HostnameTemplate is a text/template of the hostname a chart is served
+	// on, given .Release, .Chart, .Namespace, .Cluster and .Environment, e.g.
+	// "{{.Release}}.{{.Environment}}.example.com". Charts aren't given a
+	// hostname without one.
+	HostnameTemplate string `json:"hostname_template,omitempty"`
+	// ClusterIssuer is the cert-manager ClusterIssuer certificates are
+	// requested from. Without one plans add an Issuer to each namespace:
+	// an ACME one when ACMEEmail is set, else a self-signed one.
+	ClusterIssuer string `json:"cluster_issuer,omitempty"`
+	ACMEEmail     string `json:"acme_email,omitempty"`
+	// ACMEServer is the ACME directory, Let's Encrypt's by default
+	ACMEServer string `json:"acme_server,omitempty"`
+}
+
+// HostnameData is what hostname templates are given, reduced to DNS labels
+type HostnameData struct {
+	Release     string
+	Chart       string
+	Namespace   string
+	Cluster     string
+	Environment string
+}
+
+// Validate checks that the policy's template renders hostnames and that its
+// issuer, email and ACME server are well-formed
+func (p *IngressPolicy) Validate() error {
+	p.HostnameTemplate = strings.TrimSpace(p.HostnameTemplate)
+	p.ClusterIssuer = strings.TrimSpace(p.ClusterIssuer)
+	p.ACMEEmail = strings.TrimSpace(p.ACMEEmail)
+	p.ACMEServer = strings.TrimSpace(p.ACMEServer)
+
+	if p.HostnameTemplate != "" {
+		sample := HostnameData{Release: "grafana", Chart: "grafana", Namespace: "monitoring", Cluster: "cluster", Environment: "dev"}
+		if _, err := p.Hostname(sample); err != nil {
+			return err
+		}
+	}
+	if p.ClusterIssuer != "" {
+		if errs := validation.IsDNS1123Subdomain(p.ClusterIssuer); len(errs) > 0 {
+			return fmt.Errorf("invalid cluster issuer %q: %s", p.ClusterIssuer, strings.Join(errs, ", "))
+		}
+	}
+	if p.ACMEEmail != "" {
+		if _, err := mail.ParseAddress(p.ACMEEmail); err != nil {
+			return fmt.Errorf("invalid ACME email %q: %w", p.ACMEEmail, err)
+		}
+	}
+	if p.ACMEServer != "" {
+		server, err := url.Parse(p.ACMEServer)
+		if err != nil || server.Scheme != "https" || server.Host == "" {
+			return fmt.Errorf("invalid ACME server %q, expected an https URL", p.ACMEServer)
+		}
+	}
+	return nil
+}
+
+// Hostname renders the hostname of a chart from the policy's template. The
+// data is reduced to DNS labels first, so cluster names with spaces or
+// capitals still give valid hostnames.
+func (p *IngressPolicy) Hostname(data HostnameData) (string, error) {
+	tmpl, err := template.New("hostname").Option("missingkey=error").Parse(p.HostnameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname template: %w", err)
+	}
+	data = HostnameData{
+		Release:     dnsLabel(data.Release),
+		Chart:       dnsLabel(data.Chart),
+		Namespace:   dnsLabel(data.Namespace),
+		Cluster:     dnsLabel(data.Cluster),
+		Environment: dnsLabel(data.Environment),
+	}
+	var hostname strings.Builder
+	if err := tmpl.Execute(&hostname, data); err != nil {
+		return "", fmt.Errorf("invalid hostname template: %w", err)
+	}
+
+	host := strings.ToLower(strings.TrimSpace(hostname.String()))
+	if errs := validation.IsDNS1123Subdomain(host); len(errs) > 0 {
+		return "", fmt.Errorf("hostname template renders %q, which is not a hostname: %s", host, strings.Join(errs, ", "))
+	}
+	return host, nil
+}
+
+// dnsLabel lowercases a value and replaces what DNS labels can't hold with dashes
+func dnsLabel(value string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, value)
+	label = strings.Trim(label, "-")
+	if len(label) > validation.DNS1123LabelMaxLength {
+		label = strings.TrimRight(label[:validation.DNS1123LabelMaxLength], "-")
+	}
+	return label
+}
+
+// WantsHTTPS reports whether a request asks for charts to be served over HTTPS
+func WantsHTTPS(query string) bool {
+	return httpsPattern.MatchString(query)
+}
+
+// exposure is a chart served on a hostname
+type exposure struct {
+	step     *agent.DeploymentStep
+	hostname string
+}
+
+// ExposePlan serves the plan's charts on the hostnames of the organization's
+// ingress policy: through their Ingress, or through HTTPRoutes on clusters
+// that only route with the Gateway API. With https the plan also requests
+// certificates for the hostnames from cert-manager, in steps applied before
+// the charts.
+func (s *HelmService) ExposePlan(plan *agent.DeploymentPlan, cluster *agent.ClusterAnalysis, policy *IngressPolicy, https bool) {
+	if policy == nil || policy.HostnameTemplate == "" {
+		if https {
+			plan.Risks = append(plan.Risks, "HTTPS was requested, but the organization's ingress policy has no hostname template to request certificates for")
+		}
+		return
+	}
+
+	var ingress *agent.IngressSupport
+	data := HostnameData{}
+	if cluster != nil {
+		ingress = cluster.Ingress
+		data.Cluster, data.Environment = cluster.ClusterName, cluster.Environment
+	}
+	gateway := routeGateway(ingress)
+	// Steps declaring no dependencies run in order, so routes come after the
+	// charts they route to and certificates before the charts using them.
+	// Otherwise the added steps declare what they wait for.
+	declared := planDeclaresDependencies(plan)
+
+	var exposures []exposure
+	for i := range plan.Steps {
+		step := &plan.Steps[i]
+		if step.Chart == nil {
+			continue
+		}
+		data.Release, data.Chart, data.Namespace = step.Chart.ReleaseName, step.Chart.Name, chartNamespace(step.Chart)
+		hostname, err := policy.Hostname(data)
+		if err != nil {
+			plan.Risks = append(plan.Risks, fmt.Sprintf("%s is not exposed: %v", step.Chart.Name, err))
+			continue
+		}
+		exposures = append(exposures, exposure{step: step, hostname: hostname})
+	}
+	if len(exposures) == 0 {
+		return
+	}
+
+	var before, after []agent.DeploymentStep
+	issuers := make(map[string]string)
+	for _, exposed := range exposures {
+		chart := exposed.step.Chart
+		secretName := chart.ReleaseName + "-tls"
+		namespace := chartNamespace(chart)
+
+		if gateway != nil {
+			route, err := httpRouteStep(exposed, ingress.GatewayAPI, gateway)
+			if err != nil {
+				plan.Risks = append(plan.Risks, fmt.Sprintf("%s is not exposed: %v", chart.Name, err))
+				continue
+			}
+			if declared {
+				route.DependsOn = []string{exposed.step.ID}
+			}
+			after = append(after, route)
+			allowed := fmt.Sprintf("Gateway %s/%s allows routes from namespace %s", gateway.Namespace, gateway.Name, namespace)
+			if gateway.Namespace != namespace && !containsString(plan.Prerequisites, allowed) {
+				plan.Prerequisites = append(plan.Prerequisites, allowed)
+			}
+			if https {
+				// Gateways terminate TLS, so their certificates live beside them
+				namespace = gateway.Namespace
+				plan.Prerequisites = append(plan.Prerequisites, fmt.Sprintf("Gateway %s/%s has an HTTPS listener for %s using the Secret %s", gateway.Namespace, gateway.Name, exposed.hostname, secretName))
+			}
+		} else {
+			ingressValues := map[string]interface{}{
+				"enabled": true,
+				"hosts":   []interface{}{exposed.hostname},
+			}
+			if class := ingress.IngressClass(); class != "" {
+				ingressValues["ingressClassName"] = class
+			}
+			if https {
+				ingressValues["tls"] = []interface{}{
+					map[string]interface{}{"secretName": secretName, "hosts": []interface{}{exposed.hostname}},
+				}
+			}
+			if chart.Values == nil {
+				chart.Values = make(map[string]interface{})
+			}
+			s.mergeValues(chart.Values, map[string]interface{}{"ingress": ingressValues})
+		}
+
+		if !https {
+			continue
+		}
+		issuerRef := map[string]interface{}{"kind": "ClusterIssuer", "name": policy.ClusterIssuer}
+		if policy.ClusterIssuer == "" {
+			name := "platform-selfsigned"
+			if policy.ACMEEmail != "" {
+				name = "platform-acme"
+			}
+			issuerRef = map[string]interface{}{"kind": "Issuer", "name": name}
+			if _, ok := issuers[namespace]; !ok {
+				issuer, err := issuerStep(name, namespace, policy, ingress, gateway)
+				if err != nil {
+					plan.Risks = append(plan.Risks, fmt.Sprintf("%s is not served over HTTPS: %v", chart.Name, err))
+					continue
+				}
+				issuers[namespace] = issuer.ID
+				before = append(before, issuer)
+			}
+		}
+		certificate, err := certificateStep(exposed, namespace, secretName, issuerRef)
+		if err != nil {
+			plan.Risks = append(plan.Risks, fmt.Sprintf("%s is not served over HTTPS: %v", chart.Name, err))
+			continue
+		}
+		if declared && issuers[namespace] != "" {
+			certificate.DependsOn = []string{issuers[namespace]}
+		}
+		before = append(before, certificate)
+	}
+
+	if https {
+		switch {
+		case ingress != nil && !ingress.CertManager:
+			plan.Risks = append(plan.Risks, "cert-manager is not installed on the cluster, so the certificate steps will fail until it is")
+		case policy.ClusterIssuer != "" && ingress != nil && !containsString(ingress.ClusterIssuers, policy.ClusterIssuer):
+			plan.Risks = append(plan.Risks, fmt.Sprintf("The cluster has no ClusterIssuer %s to issue certificates", policy.ClusterIssuer))
+		case policy.ClusterIssuer == "" && policy.ACMEEmail == "":
+			plan.Risks = append(plan.Risks, "Certificates are self-signed since the organization's ingress policy has no issuer or ACME email; browsers will not trust them")
+		}
+	}
+
+	plan.Steps = append(append(before, plan.Steps...), after...)
+}
+
+// routeGateway is the Gateway charts are routed through on clusters without
+// ingress classes, or nil when they use Ingresses
+func routeGateway(ingress *agent.IngressSupport) *agent.Gateway {
+	if ingress == nil || len(ingress.Classes) > 0 || ingress.GatewayAPI == "" || len(ingress.Gateways) == 0 {
+		return nil
+	}
+	return &ingress.Gateways[0]
+}
+
+// chartNamespace is the namespace a chart is installed in
+func chartNamespace(chart *agent.HelmChart) string {
+	if chart.Namespace == "" {
+		return "default"
+	}
+	return chart.Namespace
+}
+
+// chartServiceName is the service charts following Helm's fullname
+// convention create for a release
+func chartServiceName(chart *agent.HelmChart) string {
+	name := chart.ReleaseName
+	if !strings.Contains(name, chart.Name) {
+		name += "-" + chart.Name
+	}
+	if len(name) > validation.DNS1123LabelMaxLength {
+		name = name[:validation.DNS1123LabelMaxLength]
+	}
+	return strings.TrimRight(name, "-")
+}
+
+// chartServicePort is the port of the chart's service, from service.port
+// when its values set one
+func chartServicePort(values map[string]interface{}) int {
+	service, _ := values["service"].(map[string]interface{})
+	switch port := service["port"].(type) {
+	case int:
+		return port
+	case float64:
+		return int(port)
+	}
+	return 80
+}
+
+// httpRouteStep routes a chart's hostname to its service through a Gateway
+func httpRouteStep(exposed exposure, version string, gateway *agent.Gateway) (agent.DeploymentStep, error) {
+	chart := exposed.step.Chart
+	manifest, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": gatewayAPIGroup + "/" + version,
+		"kind":       "HTTPRoute",
+		"metadata": map[string]interface{}{
+			"name":      chart.ReleaseName,
+			"namespace": chartNamespace(chart),
+		},
+		"spec": map[string]interface{}{
+			"parentRefs": []interface{}{
+				map[string]interface{}{"name": gateway.Name, "namespace": gateway.Namespace},
+			},
+			"hostnames": []interface{}{exposed.hostname},
+			"rules": []interface{}{
+				map[string]interface{}{
+					"backendRefs": []interface{}{
+						map[string]interface{}{"name": chartServiceName(chart), "port": chartServicePort(chart.Values)},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return agent.DeploymentStep{}, fmt.Errorf("failed to encode HTTPRoute: %w", err)
+	}
+	return agent.DeploymentStep{
+		ID:          "step-route-" + chart.ReleaseName,
+		Name:        fmt.Sprintf("Route %s", exposed.hostname),
+		Description: fmt.Sprintf("Route %s to %s through Gateway %s/%s", exposed.hostname, chart.ReleaseName, gateway.Namespace, gateway.Name),
+		Manifest:    string(manifest),
+		Namespace:   chartNamespace(chart),
+		Status:      "pending",
+	}, nil
+}
+
+// issuerStep adds a namespaced cert-manager Issuer: an ACME one solving HTTP-01
+// challenges through the cluster's ingress class or Gateway, or a self-signed one
+func issuerStep(name, namespace string, policy *IngressPolicy, ingress *agent.IngressSupport, gateway *agent.Gateway) (agent.DeploymentStep, error) {
+	spec := map[string]interface{}{"selfSigned": map[string]interface{}{}}
+	description := fmt.Sprintf("Issue self-signed certificates in %s", namespace)
+	if policy.ACMEEmail != "" {
+		server := policy.ACMEServer
+		if server == "" {
+			server = letsEncryptServer
+		}
+		solver := map[string]interface{}{}
+		if gateway != nil {
+			solver["gatewayHTTPRoute"] = map[string]interface{}{
+				"parentRefs": []interface{}{
+					map[string]interface{}{"name": gateway.Name, "namespace": gateway.Namespace, "kind": "Gateway"},
+				},
+			}
+		} else {
+			solverIngress := map[string]interface{}{}
+			if class := ingress.IngressClass(); class != "" {
+				solverIngress["ingressClassName"] = class
+			}
+			solver["ingress"] = solverIngress
+		}
+		spec = map[string]interface{}{
+			"acme": map[string]interface{}{
+				"server":              server,
+				"email":               policy.ACMEEmail,
+				"privateKeySecretRef": map[string]interface{}{"name": name + "-account-key"},
+				"solvers":             []interface{}{map[string]interface{}{"http01": solver}},
+			},
+		}
+		description = fmt.Sprintf("Issue certificates in %s from %s", namespace, server)
+	}
+
+	manifest, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": certManagerGroup + "/v1",
+		"kind":       "Issuer",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       spec,
+	})
+	if err != nil {
+		return agent.DeploymentStep{}, fmt.Errorf("failed to encode Issuer: %w", err)
+	}
+	return agent.DeploymentStep{
+		ID:          "step-issuer-" + namespace,
+		Name:        fmt.Sprintf("Create Issuer %s", name),
+		Description: description,
+		Manifest:    string(manifest),
+		Namespace:   namespace,
+		Status:      "pending",
+	}, nil
+}
+
+// certificateStep requests the certificate of a chart's hostname, stored in secretName
+func certificateStep(exposed exposure, namespace, secretName string, issuerRef map[string]interface{}) (agent.DeploymentStep, error) {
+	chart := exposed.step.Chart
+	manifest, err := yaml.Marshal(map[string]interface{}{
+		"apiVersion": certManagerGroup + "/v1",
+		"kind":       "Certificate",
+		"metadata":   map[string]interface{}{"name": chart.ReleaseName, "namespace": namespace},
+		"spec": map[string]interface{}{
+			"secretName": secretName,
+			"dnsNames":   []interface{}{exposed.hostname},
+			"issuerRef":  issuerRef,
+		},
+	})
+	if err != nil {
+		return agent.DeploymentStep{}, fmt.Errorf("failed to encode Certificate: %w", err)
+	}
+	return agent.DeploymentStep{
+		ID:          "step-certificate-" + chart.ReleaseName,
+		Name:        fmt.Sprintf("Request certificate for %s", exposed.hostname),
+		Description: fmt.Sprintf("Request a certificate for %s from %s %s, stored in Secret %s", exposed.hostname, issuerRef["kind"], issuerRef["name"], secretName),
+		Manifest:    string(manifest),
+		Namespace:   namespace,
+		Status:      "pending",
+	}, nil
+}
+
+// planDeclaresDependencies reports whether any step of the plan declares the
+// steps it depends on, in which case the others no longer run in order
+func planDeclaresDependencies(plan *agent.DeploymentPlan) bool {
+	for _, step := range plan.Steps {
+		if len(step.DependsOn) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+	legacyIngressClassAnnotation  = "kubernetes.io/ingress.class"
+	gatewayAPIGroup               = "gateway.networking.k8s.io"
+	certManagerGroup              = "cert-manager.io"
+)
+
+var clusterIssuerGVR = schema.GroupVersionResource{Group: certManagerGroup, Version: "v1", Resource: "clusterissuers"}
+
+// analyzeIngress detects the ingress classes, Gateway API gateways and
+// cert-manager ClusterIssuers of the cluster, from the kinds its CRDs serve
+func (s *ClusterAnalyzerService) analyzeIngress(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, customResources []agent.CustomResource) *agent.IngressSupport {
+	ingress := &agent.IngressSupport{}
+
+	classes, err := clientset.NetworkingV1().IngressClasses().List(ctx, metav1.ListOptions{})
+	if err == nil {
+		for _, class := range classes.Items {
+			ingress.Classes = append(ingress.Classes, class.Name)
+			if class.Annotations[defaultIngressClassAnnotation] == "true" {
+				ingress.DefaultClass = class.Name
+			}
+		}
+	}
+	// Controllers predating IngressClasses are only known by the class
+	// existing Ingresses name
+	if len(ingress.Classes) == 0 {
+		ingresses, err := clientset.NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{})
+		if err == nil {
+			for _, item := range ingresses.Items {
+				class := item.Annotations[legacyIngressClassAnnotation]
+				if item.Spec.IngressClassName != nil {
+					class = *item.Spec.IngressClassName
+				}
+				if class != "" && !containsString(ingress.Classes, class) {
+					ingress.Classes = append(ingress.Classes, class)
+				}
+			}
+		}
+	}
+	sort.Strings(ingress.Classes)
+
+	for _, resource := range customResources {
+		switch {
+		case resource.Group == gatewayAPIGroup && resource.Kind == "Gateway":
+			ingress.GatewayAPI = gatewayAPIVersion(resource.Versions)
+		case resource.Group == certManagerGroup && resource.Kind == "Certificate":
+			ingress.CertManager = true
+		}
+	}
+
+	if ingress.GatewayAPI != "" {
+		gatewayGVR := schema.GroupVersionResource{Group: gatewayAPIGroup, Version: ingress.GatewayAPI, Resource: "gateways"}
+		gateways, err := dynamicClient.Resource(gatewayGVR).List(ctx, metav1.ListOptions{})
+		if err == nil {
+			for _, item := range gateways.Items {
+				class, _, _ := unstructured.NestedString(item.Object, "spec", "gatewayClassName")
+				ingress.Gateways = append(ingress.Gateways, agent.Gateway{Name: item.GetName(), Namespace: item.GetNamespace(), Class: class})
+			}
+		}
+		sort.Slice(ingress.Gateways, func(i, j int) bool {
+			if ingress.Gateways[i].Namespace != ingress.Gateways[j].Namespace {
+				return ingress.Gateways[i].Namespace < ingress.Gateways[j].Namespace
+			}
+			return ingress.Gateways[i].Name < ingress.Gateways[j].Name
+		})
+	}
+
+	if ingress.CertManager {
+		issuers, err := dynamicClient.Resource(clusterIssuerGVR).List(ctx, metav1.ListOptions{})
+		if err == nil {
+			for _, item := range issuers.Items {
+				ingress.ClusterIssuers = append(ingress.ClusterIssuers, item.GetName())
+			}
+		}
+		sort.Strings(ingress.ClusterIssuers)
+	}
+
+	return ingress
+}
+
+// gatewayAPIVersion picks the most stable Gateway API version served
+func gatewayAPIVersion(versions []string) string {
+	for _, preferred := range []string{"v1", "v1beta1"} {
+		if containsString(versions, preferred) {
+			return preferred
+		}
+	}
+	if len(versions) > 0 {
+		return versions[0]
+	}
+	return ""
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+const (
+	// knowledgeChunkSize is the target length of a chunk in characters, a few
+	// hundred tokens, so a retrieved chunk is a focused passage
+	knowledgeChunkSize = 1500
+	// knowledgeChunkOverlap is how much of the end of a chunk starts the next,
+	// so a procedure split between chunks is found from either half
+	knowledgeChunkOverlap = 200
+	// knowledgeEmbeddingBatch chunks are embedded per request
+	knowledgeEmbeddingBatch = 64
+	// answeredQueryChars bounds the text of an answered query that is
+	// embedded, well within the embedding models' input limit
+	answeredQueryChars = 8000
+)
+
+// KnowledgeChunk is an embedded passage of a knowledge base document
+type KnowledgeChunk struct {
+	Index     int
+	Content   string
+	Embedding []float32
+}
+
+// KnowledgeBaseService chunks and embeds runbooks so the passages relevant to
+// a query can be retrieved by similarity
+type KnowledgeBaseService struct {
+	aiAgent *agent.AIAgent
+	topK    int
+}
+
+// NewKnowledgeBaseService creates a new knowledge base service retrieving topK
+// passages per query
+func NewKnowledgeBaseService(aiAgent *agent.AIAgent, topK int) *KnowledgeBaseService {
+	if topK <= 0 {
+		topK = 4
+	}
+	return &KnowledgeBaseService{
+		aiAgent: aiAgent,
+		topK:    topK,
+	}
+}
+
+// TopK is the number of passages to ground a query in
+func (s *KnowledgeBaseService) TopK() int {
+	return s.topK
+}
+
+// Index splits a document into chunks and embeds them
+func (s *KnowledgeBaseService) Index(ctx context.Context, content string) ([]KnowledgeChunk, error) {
+	texts := ChunkDocument(content)
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("document has no content")
+	}
+
+	chunks := make([]KnowledgeChunk, 0, len(texts))
+	for start := 0; start < len(texts); start += knowledgeEmbeddingBatch {
+		end := start + knowledgeEmbeddingBatch
+		if end > len(texts) {
+			end = len(texts)
+		}
+		ReportProgress(ctx, 100*start/len(texts), fmt.Sprintf("Embedding chunks %d-%d of %d", start+1, end, len(texts)))
+		embeddings, err := s.aiAgent.Embed(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for i, embedding := range embeddings {
+			chunks = append(chunks, KnowledgeChunk{Index: start + i, Content: texts[start+i], Embedding: embedding})
+		}
+	}
+	return chunks, nil
+}
+
+// EmbedQuery embeds a query to compare against the chunks
+func (s *KnowledgeBaseService) EmbedQuery(ctx context.Context, query string) ([]float32, error) {
+	embeddings, err := s.aiAgent.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// EmbedAnsweredQuery embeds a query along with its response, so later
+// questions find it whether they resemble the question or the answer
+func (s *KnowledgeBaseService) EmbedAnsweredQuery(ctx context.Context, query, response string) ([]float32, error) {
+	text := "Q: " + strings.TrimSpace(query) + "\n\nA: " + strings.TrimSpace(response)
+	if len(text) > answeredQueryChars {
+		text = strings.ToValidUTF8(text[:answeredQueryChars], "")
+	}
+	return s.EmbedQuery(ctx, text)
+}
+
+// ChunkDocument splits Markdown or plain text into chunks of about
+// knowledgeChunkSize characters at paragraph boundaries. Chunks below a
+// heading start with it, so a passage keeps the context of its section.
+func ChunkDocument(content string) []string {
+	var chunks []string
+	var heading string
+	var current strings.Builder
+	// fresh is set once the current chunk has content beyond the carried-over overlap
+	fresh := false
+
+	flush := func() {
+		text := strings.TrimSpace(current.String())
+		current.Reset()
+		if !fresh {
+			return
+		}
+		fresh = false
+		chunks = append(chunks, text)
+		// Carry the end of the chunk over into the next one
+		if overlap := chunkOverlap(text); overlap != "" {
+			if heading != "" && !strings.HasPrefix(overlap, heading) {
+				current.WriteString(heading + "\n\n")
+			}
+			current.WriteString(overlap + "\n\n")
+		}
+	}
+
+	for _, paragraph := range splitParagraphs(content) {
+		if strings.HasPrefix(paragraph, "#") {
+			// A new section starts a new chunk
+			flush()
+			current.Reset()
+			lines := strings.SplitN(paragraph, "\n", 2)
+			heading = lines[0]
+			if len(lines) == 1 {
+				continue
+			}
+			paragraph = lines[1]
+		}
+		for _, piece := range splitLong(paragraph, knowledgeChunkSize) {
+			if current.Len() > 0 && current.Len()+len(piece) > knowledgeChunkSize {
+				flush()
+			}
+			if current.Len() == 0 && heading != "" && !strings.HasPrefix(piece, heading) {
+				current.WriteString(heading + "\n\n")
+			}
+			current.WriteString(piece + "\n\n")
+			fresh = true
+		}
+	}
+	flush()
+	// A document of headings only
+	if len(chunks) == 0 && heading != "" {
+		chunks = append(chunks, heading)
+	}
+	return chunks
+}
+
+// splitParagraphs splits text at blank lines, keeping fenced code blocks whole
+func splitParagraphs(content string) []string {
+	var paragraphs []string
+	var current []string
+	inFence := false
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") {
+			inFence = !inFence
+		}
+		// Headings start a paragraph of their own
+		if !inFence && (trimmed == "" || strings.HasPrefix(trimmed, "#")) && len(current) > 0 {
+			paragraphs = append(paragraphs, strings.Join(current, "\n"))
+			current = nil
+		}
+		if trimmed != "" || inFence {
+			current = append(current, strings.TrimRight(line, " \t"))
+		}
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, strings.Join(current, "\n"))
+	}
+	return paragraphs
+}
+
+// splitLong splits a paragraph longer than size at line ends, and lines
+// longer than size at spaces
+func splitLong(paragraph string, size int) []string {
+	if len(paragraph) <= size {
+		return []string{paragraph}
+	}
+	var pieces []string
+	var current strings.Builder
+	for _, line := range strings.SplitAfter(paragraph, "\n") {
+		for len(line) > size {
+			cut := strings.LastIndex(line[:size], " ")
+			if cut <= 0 {
+				cut = size
+			}
+			if current.Len() > 0 {
+				pieces = append(pieces, strings.TrimSpace(current.String()))
+				current.Reset()
+			}
+			pieces = append(pieces, strings.TrimSpace(line[:cut]))
+			line = line[cut:]
+		}
+		if current.Len()+len(line) > size {
+			pieces = append(pieces, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+		current.WriteString(line)
+	}
+	if text := strings.TrimSpace(current.String()); text != "" {
+		pieces = append(pieces, text)
+	}
+	return pieces
+}
+
+// chunkOverlap returns the last paragraph of a chunk when it is short enough
+// to repeat
+func chunkOverlap(chunk string) string {
+	i := strings.LastIndex(chunk, "\n\n")
+	if i == -1 {
+		return ""
+	}
+	last := strings.TrimSpace(chunk[i:])
+	if len(last) > knowledgeChunkOverlap || strings.HasPrefix(last, "#") {
+		return ""
+	}
+	return last
+}
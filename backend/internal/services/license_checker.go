@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// LicensePolicy lists the licenses an organization accepts in deployed software.
+// Entries are SPDX identifiers and may use "*" wildcards, e.g. "AGPL-*".
+type LicensePolicy struct {
+	Disallowed []string `json:"disallowed,omitempty"`
+	// Allowed, when set, flags every license not listed
+	Allowed []string `json:"allowed,omitempty"`
+	// FlagUnknown flags charts and images that declare no license
+	FlagUnknown bool `json:"flag_unknown,omitempty"`
+}
+
+// LicenseCheckerService collects the licenses of a plan's charts and images
+type LicenseCheckerService struct {
+	helmService        *HelmService
+	deploymentExecutor *DeploymentExecutorService
+	imageInspector     *ImageInspector
+}
+
+// NewLicenseCheckerService creates a new license checker service
+func NewLicenseCheckerService(helmService *HelmService, deploymentExecutor *DeploymentExecutorService) *LicenseCheckerService {
+	return &LicenseCheckerService{
+		helmService:        helmService,
+		deploymentExecutor: deploymentExecutor,
+		imageInspector:     NewImageInspector(helmService.network),
+	}
+}
+
+// LicenseReport lists the licenses of everything a plan deploys
+type LicenseReport struct {
+	PlanID     string         `json:"plan_id"`
+	Compliant  bool           `json:"compliant"`
+	Violations int            `json:"violations"`
+	Unknown    int            `json:"unknown"`
+	Licenses   map[string]int `json:"licenses"` // license expression -> number of charts and images
+	Charts     []ChartLicense `json:"charts"`
+	CheckedAt  time.Time      `json:"checked_at"`
+}
+
+// ChartLicense is the license of a chart and of the images it runs
+type ChartLicense struct {
+	Chart     string         `json:"chart"`
+	Version   string         `json:"version"`
+	License   string         `json:"license"`
+	Violation string         `json:"violation,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Images    []ImageLicense `json:"images"`
+}
+
+// ImageLicense is the license an image declares in its OCI labels
+type ImageLicense struct {
+	Image     string `json:"image"`
+	License   string `json:"license"`
+	Violation string `json:"violation,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// CheckPlan collects chart licenses from Artifact Hub and image licenses from
+// the images the rendered charts run, and flags those the policy disallows
+func (s *LicenseCheckerService) CheckPlan(ctx context.Context, plan *agent.DeploymentPlan, policy *LicensePolicy) *LicenseReport {
+	report := &LicenseReport{
+		PlanID:    plan.ID,
+		Licenses:  make(map[string]int),
+		Charts:    []ChartLicense{},
+		CheckedAt: time.Now(),
+	}
+
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		chart := ChartLicense{Chart: step.Chart.Name, Version: step.Chart.Version, Images: []ImageLicense{}}
+
+		license, err := s.helmService.ChartLicense(ctx, step.Chart)
+		if err != nil {
+			chart.Error = fmt.Sprintf("failed to look up chart license: %v", err)
+		}
+		chart.License = license
+		chart.Violation = policy.Violation(license)
+
+		manifest, err := s.deploymentExecutor.RenderChart(ctx, step.Chart, "default")
+		if err != nil {
+			chart.Error = joinErrors(chart.Error, fmt.Sprintf("failed to render chart, images not checked: %v", err))
+		} else if objects, err := kubernetes.ParseManifest(manifest); err != nil {
+			chart.Error = joinErrors(chart.Error, fmt.Sprintf("failed to parse rendered chart: %v", err))
+		} else {
+			for _, image := range workloadImages(objects) {
+				imageLicense := ImageLicense{Image: image}
+				license, err := s.imageInspector.Licenses(ctx, image)
+				if err != nil {
+					imageLicense.Error = err.Error()
+				}
+				imageLicense.License = license
+				imageLicense.Violation = policy.Violation(license)
+				chart.Images = append(chart.Images, imageLicense)
+			}
+		}
+
+		report.Charts = append(report.Charts, chart)
+	}
+
+	report.tally()
+	return report
+}
+
+// tally counts licenses and violations
+func (r *LicenseReport) tally() {
+	count := func(license, violation string) {
+		if license == "" {
+			r.Unknown++
+			license = "unknown"
+		}
+		r.Licenses[license]++
+		if violation != "" {
+			r.Violations++
+		}
+	}
+	for _, chart := range r.Charts {
+		count(chart.License, chart.Violation)
+		for _, image := range chart.Images {
+			count(image.License, image.Violation)
+		}
+	}
+	r.Compliant = r.Violations == 0
+}
+
+// Summary renders the report as Markdown
+func (r *LicenseReport) Summary() string {
+	var b strings.Builder
+	if r.Compliant {
+		b.WriteString("All charts and images comply with the organization's license policy.\n\n")
+	} else {
+		fmt.Fprintf(&b, "**%d license violation(s)** against the organization's license policy.\n\n", r.Violations)
+	}
+
+	licenses := make([]string, 0, len(r.Licenses))
+	for license := range r.Licenses {
+		licenses = append(licenses, license)
+	}
+	sort.Strings(licenses)
+	b.WriteString("| License | Charts and images |\n|---|---|\n")
+	for _, license := range licenses {
+		fmt.Fprintf(&b, "| %s | %d |\n", license, r.Licenses[license])
+	}
+
+	b.WriteString("\n| Chart / image | License | Policy |\n|---|---|---|\n")
+	for _, chart := range r.Charts {
+		fmt.Fprintf(&b, "| %s %s | %s | %s |\n", chart.Chart, chart.Version, licenseOrUnknown(chart.License), violationOrOK(chart.Violation))
+		for _, image := range chart.Images {
+			fmt.Fprintf(&b, "| &nbsp;&nbsp;%s | %s | %s |\n", image.Image, licenseOrUnknown(image.License), violationOrOK(image.Violation))
+		}
+	}
+	return b.String()
+}
+
+// Violation explains why the policy rejects a license expression, or returns ""
+// when it accepts it. An OR expression is accepted when any alternative is; an
+// AND expression only when every license in it is.
+func (p *LicensePolicy) Violation(expression string) string {
+	if p == nil {
+		return ""
+	}
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		if p.FlagUnknown {
+			return "no license declared"
+		}
+		return ""
+	}
+
+	var reasons []string
+	for _, alternative := range splitLicenseExpression(expression, " or ") {
+		var rejected []string
+		for _, license := range splitLicenseExpression(alternative, " and ") {
+			if reason := p.licenseViolation(license); reason != "" {
+				rejected = append(rejected, reason)
+			}
+		}
+		if len(rejected) == 0 {
+			return ""
+		}
+		reasons = append(reasons, rejected...)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func (p *LicensePolicy) licenseViolation(license string) string {
+	// "WITH" exceptions narrow a license, the base license decides
+	if with := strings.Index(strings.ToLower(license), " with "); with != -1 {
+		license = strings.TrimSpace(license[:with])
+	}
+	if matchesLicense(license, p.Disallowed) {
+		return fmt.Sprintf("%s is disallowed", license)
+	}
+	if len(p.Allowed) > 0 && !matchesLicense(license, p.Allowed) {
+		return fmt.Sprintf("%s is not on the allowed list", license)
+	}
+	return ""
+}
+
+// splitLicenseExpression splits an SPDX expression on an operator, ignoring parentheses
+func splitLicenseExpression(expression, operator string) []string {
+	expression = strings.NewReplacer("(", " ", ")", " ").Replace(expression)
+	lower := strings.ToLower(expression)
+
+	var parts []string
+	for {
+		index := strings.Index(lower, operator)
+		if index == -1 {
+			break
+		}
+		parts = append(parts, strings.TrimSpace(expression[:index]))
+		expression, lower = expression[index+len(operator):], lower[index+len(operator):]
+	}
+	return append(parts, strings.TrimSpace(expression))
+}
+
+func matchesLicense(license string, patterns []string) bool {
+	license = strings.ToLower(license)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == license {
+			return true
+		}
+		if matched, err := path.Match(pattern, license); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func licenseOrUnknown(license string) string {
+	if license == "" {
+		return "unknown"
+	}
+	return license
+}
+
+func violationOrOK(violation string) string {
+	if violation == "" {
+		return "ok"
+	}
+	return "**" + violation + "**"
+}
+
+func joinErrors(existing, message string) string {
+	if existing == "" {
+		return message
+	}
+	return existing + "; " + message
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+var istioPeerAuthenticationGVR = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1beta1", Resource: "peerauthentications"}
+
+// Control plane deployments identifying each mesh
+var (
+	istioControlPlaneSelector   = "app=istiod"
+	linkerdControlPlaneSelector = "linkerd.io/control-plane-component=destination"
+)
+
+// analyzeServiceMesh detects an Istio or Linkerd control plane and how the mesh is configured
+func (s *ClusterAnalyzerService) analyzeServiceMesh(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, namespaces []corev1.Namespace) *agent.ServiceMesh {
+	if mesh := s.detectIstio(ctx, clientset, dynamicClient, namespaces); mesh != nil {
+		return mesh
+	}
+	return s.detectLinkerd(ctx, clientset, namespaces)
+}
+
+// detectIstio looks for istiod and reads the mesh-wide PeerAuthentication
+func (s *ClusterAnalyzerService) detectIstio(ctx context.Context, clientset *kubernetes.Clientset, dynamicClient dynamic.Interface, namespaces []corev1.Namespace) *agent.ServiceMesh {
+	deployments, err := clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{LabelSelector: istioControlPlaneSelector})
+	if err != nil || len(deployments.Items) == 0 {
+		return nil
+	}
+	istiod := deployments.Items[0]
+
+	mesh := &agent.ServiceMesh{
+		Type:      "istio",
+		Version:   controlPlaneVersion(istiod.Spec.Template.Spec.Containers),
+		Namespace: istiod.Namespace,
+		// Istio accepts plaintext alongside mTLS unless told otherwise
+		MTLSMode: "PERMISSIVE",
+	}
+
+	// The mesh-wide policy is the PeerAuthentication named default in the root namespace
+	policy, err := dynamicClient.Resource(istioPeerAuthenticationGVR).Namespace(istiod.Namespace).Get(ctx, "default", metav1.GetOptions{})
+	if err == nil {
+		if mode, found, _ := unstructured.NestedString(policy.Object, "spec", "mtls", "mode"); found && mode != "" && mode != "UNSET" {
+			mesh.MTLSMode = mode
+		}
+	}
+
+	for _, namespace := range namespaces {
+		if namespace.Labels["istio-injection"] == "enabled" || namespace.Labels["istio.io/rev"] != "" {
+			mesh.InjectedNamespaces = append(mesh.InjectedNamespaces, namespace.Name)
+		}
+	}
+	sort.Strings(mesh.InjectedNamespaces)
+
+	return mesh
+}
+
+// detectLinkerd looks for the Linkerd destination controller
+func (s *ClusterAnalyzerService) detectLinkerd(ctx context.Context, clientset *kubernetes.Clientset, namespaces []corev1.Namespace) *agent.ServiceMesh {
+	deployments, err := clientset.AppsV1().Deployments("").List(ctx, metav1.ListOptions{LabelSelector: linkerdControlPlaneSelector})
+	if err != nil || len(deployments.Items) == 0 {
+		return nil
+	}
+	destination := deployments.Items[0]
+
+	version := destination.Labels["linkerd.io/control-plane-version"]
+	if version == "" {
+		version = controlPlaneVersion(destination.Spec.Template.Spec.Containers)
+	}
+
+	mesh := &agent.ServiceMesh{
+		Type:      "linkerd",
+		Version:   version,
+		Namespace: destination.Namespace,
+		// Linkerd always encrypts meshed traffic but still accepts unmeshed clients
+		MTLSMode: "PERMISSIVE",
+	}
+
+	for _, namespace := range namespaces {
+		if namespace.Annotations["linkerd.io/inject"] == "enabled" {
+			mesh.InjectedNamespaces = append(mesh.InjectedNamespaces, namespace.Name)
+		}
+	}
+	sort.Strings(mesh.InjectedNamespaces)
+
+	return mesh
+}
+
+// controlPlaneVersion takes the image tag of the first container as the version
+func controlPlaneVersion(containers []corev1.Container) string {
+	if len(containers) == 0 {
+		return "unknown"
+	}
+	image := containers[0].Image
+	if at := strings.Index(image, "@"); at >= 0 {
+		image = image[:at]
+	}
+	if colon := strings.LastIndex(image, ":"); colon >= 0 && colon > strings.LastIndex(image, "/") {
+		return image[colon+1:]
+	}
+	return "unknown"
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// analyzeNamespaceLimits reads the ResourceQuotas and container LimitRanges of
+// every namespace. Clusters that don't let the kubeconfig list them report none.
+func (s *ClusterAnalyzerService) analyzeNamespaceLimits(ctx context.Context, clientset *kubernetes.Clientset) []agent.NamespaceLimits {
+	byNamespace := make(map[string]*agent.NamespaceLimits)
+	limitsOf := func(namespace string) *agent.NamespaceLimits {
+		limits, ok := byNamespace[namespace]
+		if !ok {
+			limits = &agent.NamespaceLimits{Namespace: namespace}
+			byNamespace[namespace] = limits
+		}
+		return limits
+	}
+
+	if quotas, err := clientset.CoreV1().ResourceQuotas("").List(ctx, metav1.ListOptions{}); err == nil {
+		remaining := make(map[string]map[corev1.ResourceName]resource.Quantity)
+		for _, quota := range quotas.Items {
+			// Scoped quotas only count some pods, e.g. BestEffort or by priority class
+			if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+				continue
+			}
+			limits := limitsOf(quota.Namespace)
+			if remaining[quota.Namespace] == nil {
+				remaining[quota.Namespace] = make(map[corev1.ResourceName]resource.Quantity)
+				limits.QuotaRemaining = make(map[string]string)
+				limits.Quotas = make(map[string]string)
+			}
+			for name, hard := range quota.Spec.Hard {
+				left := hard.DeepCopy()
+				left.Sub(quota.Status.Used[name])
+				name = normalizeQuotaResource(name)
+				if current, ok := remaining[quota.Namespace][name]; ok && left.Cmp(current) >= 0 {
+					continue
+				}
+				remaining[quota.Namespace][name] = left
+				limits.QuotaRemaining[string(name)] = left.String()
+				limits.Quotas[string(name)] = quota.Name
+			}
+		}
+	}
+
+	if limitRanges, err := clientset.CoreV1().LimitRanges("").List(ctx, metav1.ListOptions{}); err == nil {
+		for _, limitRange := range limitRanges.Items {
+			for _, item := range limitRange.Spec.Limits {
+				if item.Type != corev1.LimitTypeContainer {
+					continue
+				}
+				limits := limitsOf(limitRange.Namespace)
+				limits.ContainerMin = mergeResourceList(limits.ContainerMin, item.Min)
+				limits.ContainerMax = mergeResourceList(limits.ContainerMax, item.Max)
+				limits.ContainerDefaultRequest = mergeResourceList(limits.ContainerDefaultRequest, item.DefaultRequest)
+				limits.ContainerDefaultLimit = mergeResourceList(limits.ContainerDefaultLimit, item.Default)
+				limits.MaxLimitRequestRatio = mergeResourceList(limits.MaxLimitRequestRatio, item.MaxLimitRequestRatio)
+			}
+		}
+	}
+
+	namespaces := make([]agent.NamespaceLimits, 0, len(byNamespace))
+	for _, limits := range byNamespace {
+		namespaces = append(namespaces, *limits)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Namespace < namespaces[j].Namespace })
+	return namespaces
+}
+
+// mergeResourceList adds a LimitRange's resources to a map of earlier ones.
+// When several LimitRanges set a resource the last one listed wins.
+func mergeResourceList(into map[string]string, list corev1.ResourceList) map[string]string {
+	if len(list) == 0 {
+		return into
+	}
+	if into == nil {
+		into = make(map[string]string)
+	}
+	for name, quantity := range list {
+		into[string(name)] = quantity.String()
+	}
+	return into
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// Network is where the platform's calls outside the clusters may go. Offline,
+// only the allowed hosts are reached; chart mirrors apply either way.
+type Network struct {
+	Offline bool
+	// AllowedHosts are the hosts inside the network offline calls may reach
+	AllowedHosts []string
+	// ChartMirrors maps chart repository URLs to the internal mirrors helm
+	// pulls their charts from
+	ChartMirrors map[string]string
+}
+
+// OfflineError fails a call offline mode blocks, naming the service it was for
+type OfflineError struct {
+	Service string
+	Host    string
+}
+
+func (e *OfflineError) Error() string {
+	return fmt.Sprintf("%s at %s is unavailable in offline mode; add the host to OFFLINE_ALLOWED_HOSTS if it is inside the network", e.Service, e.Host)
+}
+
+// Allows reports whether calls may reach host, a host or host:port
+func (n Network) Allows(host string) bool {
+	if !n.Offline {
+		return true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.ToLower(host)
+	if host == "localhost" || strings.HasSuffix(host, ".svc") || strings.Contains(host, ".svc.cluster.local") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && (ip.IsLoopback() || ip.IsPrivate()) {
+		return true
+	}
+	for _, allowed := range n.AllowedHosts {
+		if name, _, err := net.SplitHostPort(allowed); err == nil {
+			allowed = name
+		}
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an OfflineError when calls to service at rawURL are blocked
+func (n Network) Check(service, rawURL string) error {
+	u, err := neturl.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	if !n.Allows(u.Host) {
+		return &OfflineError{Service: service, Host: u.Hostname()}
+	}
+	return nil
+}
+
+// transport refuses the requests of service to hosts offline mode blocks
+func (n Network) transport(service string, next http.RoundTripper) http.RoundTripper {
+	if !n.Offline {
+		return next
+	}
+	return offlineTransport{network: n, service: service, next: next}
+}
+
+type offlineTransport struct {
+	network Network
+	service string
+	next    http.RoundTripper
+}
+
+func (t offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.network.Allows(req.URL.Host) {
+		return nil, &OfflineError{Service: t.service, Host: req.URL.Hostname()}
+	}
+	return t.next.RoundTrip(req)
+}
+
+// chartRepository returns the repository helm pulls a chart from: its mirror
+// when one is configured. Offline, charts of repositories neither mirrored nor
+// allowed fail before helm tries to reach them.
+func (n Network) chartRepository(chart *agent.HelmChart) (string, error) {
+	repository := strings.TrimRight(chart.Repository, "/")
+	for source, mirror := range n.ChartMirrors {
+		if strings.TrimRight(source, "/") == repository {
+			return mirror, nil
+		}
+	}
+	reference := chart.Repository
+	if IsOCIChart(chart) {
+		reference = "oci://" + OCIRegistryHost(ociChartReference(chart))
+	}
+	if err := n.Check("Chart repository "+repository, reference); err != nil {
+		return "", fmt.Errorf("%w, or mirror it with CHART_REPO_MIRRORS", err)
+	}
+	return chart.Repository, nil
+}
+
+// MirroredRepositories lists the chart repositories with a mirror, sorted
+func (n Network) MirroredRepositories() []string {
+	repositories := make([]string, 0, len(n.ChartMirrors))
+	for repository := range n.ChartMirrors {
+		repositories = append(repositories, repository)
+	}
+	slices.Sort(repositories)
+	return repositories
+}
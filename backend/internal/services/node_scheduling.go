@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+const (
+	osLabel = "kubernetes.io/os"
+	linuxOS = "linux"
+)
+
+// osTaintKeys are taint keys clusters use to reserve nodes for one operating system
+var osTaintKeys = map[string]bool{
+	"os":                    true,
+	"kubernetes.io/os":      true,
+	"node.kubernetes.io/os": true,
+}
+
+// configureNodeScheduling keeps Linux-only components off Windows nodes: it pins
+// the chart and every component whose values carry a nodeSelector to Linux nodes,
+// and tolerates the OS taints Linux nodes carry. It runs after the value policy
+// and adds to its nodeSelectors and tolerations instead of replacing them.
+func (s *HelmService) configureNodeScheduling(values map[string]interface{}, cluster *agent.ClusterAnalysis) {
+	if cluster == nil || len(cluster.WindowsNodes()) == 0 {
+		return
+	}
+
+	if _, ok := values["nodeSelector"].(map[string]interface{}); !ok {
+		values["nodeSelector"] = map[string]interface{}{}
+	}
+	tolerations := linuxTolerations(cluster)
+	if _, ok := values["tolerations"].([]interface{}); !ok && len(tolerations) > 0 {
+		values["tolerations"] = []interface{}{}
+	}
+	addSchedulingConstraints(values, tolerations)
+}
+
+// addSchedulingConstraints adds the Linux nodeSelector to every nodeSelector map
+// in the values, and the tolerations to every tolerations list
+func addSchedulingConstraints(values map[string]interface{}, tolerations []interface{}) {
+	for key, value := range values {
+		switch key {
+		case "nodeSelector":
+			if selector, ok := value.(map[string]interface{}); ok {
+				if _, set := selector[osLabel]; !set {
+					selector[osLabel] = linuxOS
+				}
+				continue
+			}
+		case "tolerations":
+			if existing, ok := value.([]interface{}); ok {
+				values[key] = appendTolerations(existing, tolerations)
+				continue
+			}
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			addSchedulingConstraints(nested, tolerations)
+		}
+	}
+}
+
+// linuxTolerations tolerates the OS taints found on Linux nodes
+func linuxTolerations(cluster *agent.ClusterAnalysis) []interface{} {
+	seen := make(map[string]bool)
+	var tolerations []interface{}
+	for _, node := range cluster.Nodes {
+		if node.IsWindows() {
+			continue
+		}
+		for _, taint := range node.Taints {
+			if !osTaintKeys[taint.Key] || seen[taint.String()] {
+				continue
+			}
+			seen[taint.String()] = true
+			tolerations = append(tolerations, tolerationFor(taint))
+		}
+	}
+	return tolerations
+}
+
+func tolerationFor(taint agent.NodeTaint) map[string]interface{} {
+	toleration := map[string]interface{}{"key": taint.Key, "effect": taint.Effect}
+	if taint.Value == "" {
+		toleration["operator"] = "Exists"
+	} else {
+		toleration["operator"] = "Equal"
+		toleration["value"] = taint.Value
+	}
+	return toleration
+}
+
+func appendTolerations(existing, tolerations []interface{}) []interface{} {
+	merged := existing
+	for _, toleration := range tolerations {
+		duplicate := false
+		for _, present := range existing {
+			if fmt.Sprint(present) == fmt.Sprint(toleration) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, toleration)
+		}
+	}
+	return merged
+}
+
+// nodeSchedulingRisks warns about mixed-OS clusters, and about value policy
+// tolerations that let components onto tainted Windows nodes
+func nodeSchedulingRisks(cluster *agent.ClusterAnalysis, policy *ValuePolicy) []string {
+	if cluster == nil {
+		return nil
+	}
+	windows := cluster.WindowsNodes()
+	if len(windows) == 0 {
+		return nil
+	}
+
+	var risks []string
+	if len(windows) == len(cluster.Nodes) {
+		risks = append(risks, "All nodes run Windows: Linux-only monitoring components cannot be scheduled on this cluster")
+	} else {
+		risks = append(risks, fmt.Sprintf("Mixed-OS cluster: %d of %d nodes run Windows (%s). Generated values pin components to "+
+			"Linux with nodeSelector %s=%s; components of charts that don't expose a nodeSelector may still land on Windows nodes",
+			len(windows), len(cluster.Nodes), strings.Join(windows, ", "), osLabel, linuxOS))
+	}
+
+	if policy != nil {
+		for _, node := range cluster.Nodes {
+			if !node.IsWindows() {
+				continue
+			}
+			for _, taint := range node.Taints {
+				for _, toleration := range policy.Tolerations {
+					if tolerates(toleration, taint) {
+						risks = append(risks, fmt.Sprintf("The value policy tolerates taint %s of Windows node %s; only the nodeSelector keeps components off it", taint, node.Name))
+						break
+					}
+				}
+			}
+		}
+	}
+	return risks
+}
+
+// tolerates reports whether a toleration from the value policy matches a taint
+func tolerates(toleration map[string]interface{}, taint agent.NodeTaint) bool {
+	key, _ := toleration["key"].(string)
+	operator, _ := toleration["operator"].(string)
+	value, _ := toleration["value"].(string)
+	effect, _ := toleration["effect"].(string)
+
+	if effect != "" && effect != taint.Effect {
+		return false
+	}
+	if key == "" {
+		// An empty key with Exists tolerates every taint
+		return operator == "Exists"
+	}
+	if key != taint.Key {
+		return false
+	}
+	return operator == "Exists" || value == taint.Value
+}
@@ -0,0 +1,313 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification channel types
+const (
+	ChannelSlack   = "slack"
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+)
+
+// NotificationEventTypes are the event types channels can subscribe to
+var NotificationEventTypes = []string{
+	EventPlanCreated,
+	EventDeploymentStarted,
+	EventDeploymentCompleted,
+	EventDeploymentFailed,
+	EventDeploymentAborted,
+	EventPlanApprovalRequested,
+	EventClusterUnreachable,
+	EventClusterAlert,
+	EventClusterResolved,
+	EventAutopilotAction,
+}
+
+// defaultNotificationTemplate renders events whose type has no template of its own
+const defaultNotificationTemplate = `[{{.Severity}}] {{.Title}}
+{{.Message}}{{if .Resource}}
+Resource: {{.Resource}}{{end}}`
+
+// notificationTemplates are the default message templates per event type.
+// Channels may replace them with their own.
+var notificationTemplates = map[string]string{
+	EventPlanCreated: `{{.Title}}
+{{.Message}}
+Review it with GET /api/agent/plans/{{.Resource}}.`,
+	EventDeploymentStarted: `{{.Title}}
+{{.Message}}`,
+	EventDeploymentCompleted: `{{.Title}}
+{{.Message}}`,
+	EventDeploymentFailed: `[{{.Severity}}] {{.Title}}
+{{.Message}}
+Retry it with POST /api/agent/deployments/{{.Resource}}/retry once the cause is fixed.`,
+	EventDeploymentAborted: `[{{.Severity}}] {{.Title}}
+{{.Message}}
+Resume it with POST /api/agent/deployments/{{.Resource}}/retry.`,
+	EventPlanApprovalRequested: `{{.Title}}
+{{.Message}}
+Review it with GET /api/agent/plans/pending.`,
+	EventClusterUnreachable: `[{{.Severity}}] {{.Title}}
+{{.Message}}`,
+	EventAutopilotAction: `[{{.Severity}}] {{.Title}}
+{{.Message}}
+Review autopilot actions with GET /api/kubernetes/clusters/{{.ClusterID}}/autopilot/actions.`,
+}
+
+// Slack and webhook deliveries failing with a network error, a 429 or a 5xx
+// answer are attempted deliveryAttempts times, waiting deliveryBackoff before
+// the first retry and twice as long before each next one
+const (
+	deliveryAttempts = 4
+	deliveryBackoff  = 2 * time.Second
+	// maxRetryAfter caps how long a Retry-After answer delays the next attempt
+	maxRetryAfter = 30 * time.Second
+)
+
+// SMTPConfig is the mail server email channels send through
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// NotificationTarget is where and how a channel delivers events
+type NotificationTarget struct {
+	Type string
+	// URL is the Slack incoming webhook or the generic webhook URL
+	URL        string
+	Recipients []string
+	// Secret signs generic webhook payloads in the X-Signature-256 header
+	Secret string
+	// Template replaces the default message template of the event's type
+	Template string
+}
+
+// NotifierService delivers events to Slack, email and webhook channels
+type NotifierService struct {
+	smtp   SMTPConfig
+	client *http.Client
+}
+
+// NewNotifierService creates a new notifier. Email channels need smtp.Host.
+func NewNotifierService(smtp SMTPConfig) *NotifierService {
+	return &NotifierService{
+		smtp:   smtp,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Validate checks that a target can be delivered to before it is stored
+func (s *NotifierService) Validate(target NotificationTarget) error {
+	switch target.Type {
+	case ChannelSlack, ChannelWebhook:
+		parsed, err := url.Parse(target.URL)
+		if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+			return fmt.Errorf("%s channels need an http(s) url", target.Type)
+		}
+	case ChannelEmail:
+		if s.smtp.Host == "" {
+			return fmt.Errorf("email channels are unavailable, SMTP_HOST is not configured")
+		}
+		if len(target.Recipients) == 0 {
+			return fmt.Errorf("email channels need at least one recipient")
+		}
+		for _, recipient := range target.Recipients {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				return fmt.Errorf("invalid recipient %q: %w", recipient, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown channel type %q, expected slack, email or webhook", target.Type)
+	}
+
+	if target.Template != "" {
+		if _, err := template.New("notification").Parse(target.Template); err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+	}
+	return nil
+}
+
+// Send renders an event with the target's template and delivers it
+func (s *NotifierService) Send(ctx context.Context, target NotificationTarget, event Event) error {
+	text, err := RenderNotification(target.Template, event)
+	if err != nil {
+		return err
+	}
+
+	switch target.Type {
+	case ChannelSlack:
+		payload, err := json.Marshal(map[string]string{"text": text})
+		if err != nil {
+			return err
+		}
+		return s.deliver(ctx, target.URL, payload, nil)
+	case ChannelWebhook:
+		payload, err := json.Marshal(map[string]interface{}{"event": event, "text": text})
+		if err != nil {
+			return err
+		}
+		// Every attempt carries the same delivery ID, so receivers can drop
+		// deliveries retried after they were already processed
+		headers := map[string]string{
+			"X-Event-Type":  event.Type,
+			"X-Delivery-ID": uuid.NewString(),
+		}
+		if target.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(target.Secret))
+			mac.Write(payload)
+			headers["X-Signature-256"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		}
+		return s.deliver(ctx, target.URL, payload, headers)
+	case ChannelEmail:
+		return s.sendEmail(target.Recipients, event.Title, text)
+	}
+	return fmt.Errorf("unknown channel type %q", target.Type)
+}
+
+// RenderNotification renders an event with the given template, or the default
+// template of its type when empty
+func RenderNotification(text string, event Event) (string, error) {
+	if text == "" {
+		text = notificationTemplates[event.Type]
+	}
+	if text == "" {
+		text = defaultNotificationTemplate
+	}
+
+	tmpl, err := template.New("notification").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, event); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
+
+// deliveryError is a failed attempt to post a notification
+type deliveryError struct {
+	err       error
+	retryable bool
+	// retryAfter is how long the endpoint asked to wait before retrying
+	retryAfter time.Duration
+}
+
+func (e *deliveryError) Error() string { return e.err.Error() }
+
+func (e *deliveryError) Unwrap() error { return e.err }
+
+// deliver posts a JSON payload, retrying failures the endpoint may recover
+// from with exponential backoff until deliveryAttempts or the context run out.
+// Each attempt is numbered in the X-Delivery-Attempt header.
+func (s *NotifierService) deliver(ctx context.Context, target string, payload []byte, headers map[string]string) error {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	backoff := deliveryBackoff
+	for attempt := 1; ; attempt++ {
+		headers["X-Delivery-Attempt"] = strconv.Itoa(attempt)
+		err := s.post(ctx, target, payload, headers)
+		if err == nil {
+			return nil
+		}
+		var failed *deliveryError
+		if !errors.As(err, &failed) || !failed.retryable || attempt == deliveryAttempts {
+			if attempt > 1 {
+				return fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+
+		wait := backoff
+		if failed.retryAfter > wait {
+			wait = min(failed.retryAfter, maxRetryAfter)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (gave up after %d attempts: %v)", err, attempt, ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a JSON payload, failing on non-2xx answers
+func (s *NotifierService) post(ctx context.Context, target string, payload []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &deliveryError{err: fmt.Errorf("failed to send notification: %w", err), retryable: ctx.Err() == nil}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		failed := &deliveryError{
+			err:       fmt.Errorf("notification endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(body))),
+			retryable: resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500,
+		}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			failed.retryAfter = time.Duration(seconds) * time.Second
+		}
+		return failed
+	}
+	return nil
+}
+
+// sendEmail sends a plain text mail through the configured SMTP server
+func (s *NotifierService) sendEmail(recipients []string, subject, body string) error {
+	if s.smtp.Host == "" {
+		return fmt.Errorf("SMTP is not configured")
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.smtp.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if s.smtp.Username != "" {
+		auth = smtp.PlainAuth("", s.smtp.Username, s.smtp.Password, s.smtp.Host)
+	}
+	addr := s.smtp.Host + ":" + strconv.Itoa(s.smtp.Port)
+	if err := smtp.SendMail(addr, auth, s.smtp.From, recipients, message.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
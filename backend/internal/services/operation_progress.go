@@ -0,0 +1,22 @@
+package services
+
+import "context"
+
+// ProgressFunc receives the progress of a long-running operation in percent,
+// with a short description of the current stage
+type ProgressFunc func(percent int, message string)
+
+type progressKey struct{}
+
+// WithProgress returns a context whose work reports its progress to fn
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ReportProgress reports progress to the context's ProgressFunc, if any, so
+// services can report progress whether or not they run as an operation
+func ReportProgress(ctx context.Context, percent int, message string) {
+	if fn, ok := ctx.Value(progressKey{}).(ProgressFunc); ok {
+		fn(percent, message)
+	}
+}
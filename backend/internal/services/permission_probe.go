@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// credentialProbes are the actions reviewed, in every namespace, to probe what
+// a credential may do
+var credentialProbes = []agent.PermissionProbe{
+	{Capability: "cluster_admin", Verb: "*", Group: "*", Resource: "*"},
+	{Capability: "create_deployments", Verb: "create", Group: "apps", Resource: "deployments"},
+	{Capability: "create_namespaces", Verb: "create", Resource: "namespaces"},
+	{Capability: "manage_secrets", Verb: "create", Resource: "secrets"},
+	{Capability: "manage_crds", Verb: "create", Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"},
+	{Capability: "manage_rbac", Verb: "create", Group: "rbac.authorization.k8s.io", Resource: "clusterrolebindings"},
+	{Capability: "manage_webhooks", Verb: "create", Group: "admissionregistration.k8s.io", Resource: "validatingwebhookconfigurations"},
+}
+
+// AccessReviewer asks the API server whether a credential may perform an
+// action, with the authorizer's reason when it may not
+type AccessReviewer func(ctx context.Context, attributes authorizationv1.ResourceAttributes) (bool, string, error)
+
+// ProbePermissions reports what the credential the reviewer asks for may do:
+// whether it is cluster-admin and may create deployments, namespaces, secrets,
+// CRDs, cluster role bindings and admission webhooks in every namespace
+func ProbePermissions(ctx context.Context, review AccessReviewer) (*agent.CredentialPermissions, error) {
+	permissions := &agent.CredentialPermissions{Checks: make([]agent.PermissionProbe, 0, len(credentialProbes))}
+	for _, probe := range credentialProbes {
+		allowed, reason, err := review(ctx, authorizationv1.ResourceAttributes{Verb: probe.Verb, Group: probe.Group, Resource: probe.Resource})
+		if err != nil {
+			return nil, err
+		}
+		probe.Allowed, probe.Reason = allowed, reason
+		permissions.Checks = append(permissions.Checks, probe)
+
+		switch probe.Capability {
+		case "cluster_admin":
+			permissions.ClusterAdmin = allowed
+		case "create_deployments":
+			permissions.CreateDeployments = allowed
+		case "create_namespaces":
+			permissions.CreateNamespaces = allowed
+		case "manage_secrets":
+			permissions.ManageSecrets = allowed
+		case "manage_crds":
+			permissions.ManageCRDs = allowed
+		case "manage_rbac":
+			permissions.ManageRBAC = allowed
+		case "manage_webhooks":
+			permissions.ManageWebhooks = allowed
+		}
+	}
+	return permissions, nil
+}
+
+// checkCredential probes the kubeconfig's permissions and, unless it may
+// create deployments and secrets everywhere, checks it may in each namespace
+// the plan installs charts to. It reports whether those basics passed, so the
+// plan's charts aren't rendered for a kubeconfig that can't install them.
+func checkCredential(ctx context.Context, client *kubernetes.KubernetesClient, plan *agent.DeploymentPlan, readiness *ClusterReadiness) (bool, error) {
+	credential, err := ProbePermissions(ctx, client.CanI)
+	if err != nil {
+		return false, err
+	}
+	readiness.Credential = credential
+	if credential.ClusterAdmin || (credential.CreateDeployments && credential.ManageSecrets) {
+		return true, nil
+	}
+
+	seen := map[string]bool{}
+	for _, step := range plan.Steps {
+		if step.Chart != nil {
+			seen[chartNamespace(step.Chart)] = true
+		}
+	}
+	namespaces := make([]string, 0, len(seen))
+	for namespace := range seen {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	passed := true
+	for _, namespace := range namespaces {
+		// Charts run workloads, and Helm stores each release revision as a secret
+		for _, attributes := range []authorizationv1.ResourceAttributes{
+			{Verb: "create", Group: "apps", Resource: "deployments", Namespace: namespace},
+			{Verb: "create", Resource: "secrets", Namespace: namespace},
+		} {
+			allowed, reason, err := client.CanI(ctx, attributes)
+			if err != nil {
+				return false, err
+			}
+			if allowed {
+				continue
+			}
+			passed = false
+			readiness.Permissions = append(readiness.Permissions, PermissionCheck{
+				Verb:      attributes.Verb,
+				Group:     attributes.Group,
+				Resource:  attributes.Resource,
+				Namespace: attributes.Namespace,
+				Reason:    reason,
+			})
+			target := attributes.Resource
+			if attributes.Group != "" {
+				target += "." + attributes.Group
+			}
+			readiness.Failures = append(readiness.Failures, fmt.Sprintf("The kubeconfig may not %s %s in namespace %s", attributes.Verb, target, namespace))
+		}
+	}
+	return passed, nil
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// Plan edit operations
+const (
+	PlanEditSetVersion = "set_version"
+	PlanEditSetValue   = "set_value"
+	PlanEditRemoveStep = "remove_step"
+	PlanEditMoveStep   = "move_step"
+)
+
+// PlanEdit is a structured change to a stored plan, so users can adjust a
+// generated plan instead of generating it again
+type PlanEdit struct {
+	Op     string `json:"op"` // set_version, set_value, remove_step or move_step
+	StepID string `json:"step_id"`
+	// Version is the chart version set_version installs
+	Version string `json:"version,omitempty"`
+	// Path is the dotted values key set_value overrides, e.g. persistence.size,
+	// and Value what it is set to. A null value removes the key.
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value"`
+	// Position is the index, from 0, move_step moves the step to
+	Position *int `json:"position,omitempty"`
+}
+
+// ApplyPlanEdits applies edits to a plan in order and checks that the result
+// is still a valid plan. It stops at the first edit that doesn't apply,
+// leaving the plan partly edited, so callers edit a freshly decoded plan.
+func ApplyPlanEdits(plan *agent.DeploymentPlan, edits []PlanEdit) error {
+	for i, edit := range edits {
+		if err := applyPlanEdit(plan, edit); err != nil {
+			return fmt.Errorf("edit %d (%s): %w", i+1, edit.Op, err)
+		}
+	}
+
+	// The chart list is rebuilt from the steps so both share each chart's values
+	plan.Charts = make([]agent.HelmChart, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		if step.Chart != nil {
+			plan.Charts = append(plan.Charts, *step.Chart)
+		}
+	}
+	if _, err := agent.StepDependencies(plan.Steps); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	return agent.ValidatePlan(encoded)
+}
+
+func applyPlanEdit(plan *agent.DeploymentPlan, edit PlanEdit) error {
+	index := -1
+	for i, step := range plan.Steps {
+		if step.ID == edit.StepID {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return fmt.Errorf("plan has no step %q", edit.StepID)
+	}
+	step := &plan.Steps[index]
+
+	switch edit.Op {
+	case PlanEditSetVersion:
+		if step.Chart == nil {
+			return fmt.Errorf("step %s installs no chart", step.ID)
+		}
+		version := strings.TrimSpace(edit.Version)
+		if version == "" {
+			return fmt.Errorf("version is required")
+		}
+		step.Chart.Version = version
+	case PlanEditSetValue:
+		if step.Chart == nil {
+			return fmt.Errorf("step %s installs no chart", step.ID)
+		}
+		keys, err := splitValuePath(edit.Path)
+		if err != nil {
+			return err
+		}
+		if step.Chart.Values == nil {
+			step.Chart.Values = make(map[string]interface{})
+		}
+		if edit.Value == nil {
+			unsetValue(step.Chart.Values, keys)
+			return nil
+		}
+		return setValue(step.Chart.Values, keys, edit.Value)
+	case PlanEditRemoveStep:
+		for _, other := range plan.Steps {
+			if containsString(other.DependsOn, step.ID) {
+				return fmt.Errorf("step %s depends on step %s", other.ID, step.ID)
+			}
+		}
+		plan.Steps = append(plan.Steps[:index], plan.Steps[index+1:]...)
+	case PlanEditMoveStep:
+		if edit.Position == nil {
+			return fmt.Errorf("position is required")
+		}
+		position := *edit.Position
+		if position < 0 || position >= len(plan.Steps) {
+			return fmt.Errorf("position %d is outside the plan's %d steps", position, len(plan.Steps))
+		}
+		moved := *step
+		plan.Steps = append(plan.Steps[:index], plan.Steps[index+1:]...)
+		plan.Steps = append(plan.Steps[:position], append([]agent.DeploymentStep{moved}, plan.Steps[position:]...)...)
+	default:
+		return fmt.Errorf("unknown operation, use one of %s, %s, %s or %s", PlanEditSetVersion, PlanEditSetValue, PlanEditRemoveStep, PlanEditMoveStep)
+	}
+	return nil
+}
+
+// splitValuePath splits a dotted values key into its keys
+func splitValuePath(path string) ([]string, error) {
+	keys := strings.Split(strings.TrimSpace(path), ".")
+	for _, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("invalid values path %q", path)
+		}
+	}
+	return keys, nil
+}
+
+// setValue sets the value at a path of values, creating the maps above it
+func setValue(values map[string]interface{}, keys []string, value interface{}) error {
+	current := values
+	for i, key := range keys[:len(keys)-1] {
+		next, exists := current[key]
+		if !exists {
+			created := make(map[string]interface{})
+			current[key] = created
+			current = created
+			continue
+		}
+		nested, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not a map of values", strings.Join(keys[:i+1], "."))
+		}
+		current = nested
+	}
+	current[keys[len(keys)-1]] = copyValue(value)
+	return nil
+}
+
+// unsetValue removes the value at a path of values, if it is set
+func unsetValue(values map[string]interface{}, keys []string) {
+	current := values
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := current[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = nested
+	}
+	delete(current, keys[len(keys)-1])
+}
+
+// ValidatePlanEdits checks the charts edits changed against their Artifact
+// Hub package: that the versions set exist and that the values set are keys
+// the chart has, satisfying its values.schema.json. It returns the problems
+// found. Charts not found on Artifact Hub can't be checked.
+func (s *HelmService) ValidatePlanEdits(plan *agent.DeploymentPlan, edits []PlanEdit) []string {
+	editedPaths := make(map[string][]string)
+	versionEdited := make(map[string]bool)
+	for _, edit := range edits {
+		switch edit.Op {
+		case PlanEditSetValue:
+			editedPaths[edit.StepID] = append(editedPaths[edit.StepID], strings.TrimSpace(edit.Path))
+		case PlanEditSetVersion:
+			versionEdited[edit.StepID] = true
+		}
+	}
+
+	var problems []string
+	for _, step := range plan.Steps {
+		paths, valuesEdited := editedPaths[step.ID]
+		if step.Chart == nil || (!valuesEdited && !versionEdited[step.ID]) {
+			continue
+		}
+		// Checking drops undocumented keys, which the plan keeps until saved
+		chart := *step.Chart
+		chart.Values, _ = copyValue(step.Chart.Values).(map[string]interface{})
+		validation, err := s.ValidateValues(&chart, true)
+		if err != nil {
+			if versionEdited[step.ID] {
+				problems = append(problems, fmt.Sprintf("Failed to find version %s of chart %s: %v", chart.Version, chart.Name, err))
+			} else {
+				fmt.Printf("Failed to validate edited values of chart %s: %v\n", chart.Name, err)
+			}
+			continue
+		}
+		if validation == nil {
+			continue
+		}
+		for _, dropped := range validation.Dropped {
+			for _, path := range paths {
+				if dropped == path || strings.HasPrefix(path, dropped+".") || strings.HasPrefix(dropped, path+".") {
+					problems = append(problems, fmt.Sprintf("Chart %s has no value %s", chart.Name, dropped))
+					break
+				}
+			}
+		}
+		for _, violation := range validation.Violations {
+			problems = append(problems, fmt.Sprintf("Values of chart %s violate its values.schema.json: %s", chart.Name, violation))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// StepManifest is the YAML a plan step applies: its chart rendered with the
+// plan's values, or its raw manifest
+type StepManifest struct {
+	StepID    string `json:"step_id"`
+	Step      string `json:"step"`
+	Chart     string `json:"chart,omitempty"`
+	Namespace string `json:"namespace"`
+	Manifest  string `json:"manifest,omitempty"`
+	// Resources lists the objects of the manifest
+	Resources []ManifestResource `json:"resources"`
+	// Error is why the step couldn't be rendered or parsed
+	Error string `json:"error,omitempty"`
+
+	objects []*unstructured.Unstructured
+}
+
+// ManifestResource identifies an object of a rendered manifest
+type ManifestResource struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace,omitempty"`
+}
+
+// RenderPlanManifests renders the manifest of every chart and manifest step
+// of a plan; command steps have none. With includeCRDs charts also render the
+// CRDs of their crds/ directory. Steps that fail carry their error.
+func (s *DeploymentExecutorService) RenderPlanManifests(ctx context.Context, plan *agent.DeploymentPlan, includeCRDs bool) []StepManifest {
+	var manifests []StepManifest
+	for _, step := range plan.Steps {
+		rendered := StepManifest{StepID: step.ID, Step: step.Name, Namespace: step.Namespace, Resources: []ManifestResource{}}
+		switch {
+		case step.Chart != nil:
+			rendered.Chart = step.Chart.Name
+			rendered.Namespace = step.Chart.Namespace
+			if rendered.Namespace == "" {
+				rendered.Namespace = "default"
+			}
+			var manifest string
+			var err error
+			if includeCRDs {
+				manifest, err = s.RenderChartWithCRDs(ctx, step.Chart, rendered.Namespace)
+			} else {
+				manifest, err = s.RenderChart(ctx, step.Chart, rendered.Namespace)
+			}
+			if err != nil {
+				rendered.Error = err.Error()
+				manifests = append(manifests, rendered)
+				continue
+			}
+			rendered.Manifest = manifest
+		case step.Manifest != "":
+			rendered.Manifest = step.Manifest
+		default:
+			continue
+		}
+		if rendered.Namespace == "" {
+			rendered.Namespace = "default"
+		}
+
+		objects, err := kubernetes.ParseManifest(rendered.Manifest)
+		if err != nil {
+			rendered.Error = fmt.Sprintf("failed to parse manifests: %v", err)
+			manifests = append(manifests, rendered)
+			continue
+		}
+		rendered.objects = objects
+		for _, object := range objects {
+			rendered.Resources = append(rendered.Resources, ManifestResource{
+				APIVersion: object.GetAPIVersion(),
+				Kind:       object.GetKind(),
+				Name:       object.GetName(),
+				Namespace:  object.GetNamespace(),
+			})
+		}
+		manifests = append(manifests, rendered)
+	}
+	return manifests
+}
+
+// JoinStepManifests concatenates the manifests of a plan's steps into one
+// YAML stream, each step introduced by a comment naming it
+func JoinStepManifests(manifests []StepManifest) string {
+	var b strings.Builder
+	for _, manifest := range manifests {
+		if manifest.Manifest == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "---\n# Step: %s (%s)\n", manifest.StepID, manifest.Step)
+		b.WriteString(strings.TrimPrefix(strings.TrimSpace(manifest.Manifest), "---"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// PlanSimulation is the outcome of executing a plan against an in-memory copy
+// of a cluster rebuilt from its latest snapshot: the objects each step would
+// create and the preflight checks that would fail. The real cluster is never
+// contacted.
+type PlanSimulation struct {
+	PlanID     string              `json:"plan_id"`
+	ClusterID  uint                `json:"cluster_id"`
+	SnapshotAt time.Time           `json:"snapshot_at"`
+	Passed     bool                `json:"passed"`
+	Steps      []SimulatedStep     `json:"steps"`
+	Quotas     *QuotaCompatibility `json:"quotas"`
+	Cluster    *ClusterReadiness   `json:"cluster"`
+	// Failures lists every object and preflight check that failed
+	Failures []string `json:"failures"`
+	// Assumptions are what the snapshot doesn't record, so the simulation
+	// can't check
+	Assumptions []string  `json:"assumptions"`
+	SimulatedAt time.Time `json:"simulated_at"`
+}
+
+// SimulatedStep lists what a step would do to the cluster
+type SimulatedStep struct {
+	StepID  string                            `json:"step_id"`
+	Name    string                            `json:"name"`
+	Objects []kubernetes.ManifestObjectResult `json:"objects"`
+	// Skipped says why the step wasn't simulated, e.g. commands
+	Skipped string `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// simulationAssumptions are the checks a snapshot can't back
+var simulationAssumptions = []string{
+	"The kubeconfig is assumed to have every permission the plan needs",
+	"Node capacity excludes the requests of running pods, which snapshots don't record",
+	"Admission webhooks and policies are not run",
+	"Only namespaces, quotas, LimitRanges, nodes, storage classes and CRDs of the snapshot exist; other existing objects show as created",
+}
+
+// SimulatePlan executes a plan against a simulated cluster seeded from an
+// analysis snapshot taken at snapshotAt. Charts are rendered locally and their
+// objects applied in memory, then the quota and readiness preflight checks run
+// against the simulated cluster.
+func (s *PreflightService) SimulatePlan(ctx context.Context, plan *agent.DeploymentPlan, analysis *agent.ClusterAnalysis, snapshotAt time.Time, policy *ValuePolicy) (*PlanSimulation, error) {
+	client := kubernetes.NewSimulatedClient(simulatedKinds(analysis), simulatedObjects(analysis)...)
+
+	simulation := &PlanSimulation{
+		PlanID:      plan.ID,
+		ClusterID:   analysis.ClusterID,
+		SnapshotAt:  snapshotAt,
+		Steps:       make([]SimulatedStep, 0, len(plan.Steps)),
+		Failures:    []string{},
+		Assumptions: simulationAssumptions,
+		SimulatedAt: time.Now(),
+	}
+	if analysis.DefaultStorageClass == "" && len(analysis.StorageClasses) > 0 {
+		simulation.Assumptions = append(simulation.Assumptions, "The snapshot records no default storage class; take a new snapshot if the cluster has one")
+	}
+
+	// Preflight checks see the cluster as it is before the plan
+	quotas, err := s.CheckQuotaCompatibility(ctx, client, plan, policy)
+	if err != nil {
+		return nil, fmt.Errorf("quota check failed: %w", err)
+	}
+	simulation.Quotas = quotas
+	for _, namespace := range quotas.Namespaces {
+		for _, shortfall := range namespace.Shortfalls {
+			simulation.Failures = append(simulation.Failures, fmt.Sprintf("Namespace %s: %s", namespace.Namespace, shortfall))
+		}
+	}
+
+	readiness, err := s.CheckClusterReadiness(ctx, client, plan)
+	if err != nil {
+		return nil, fmt.Errorf("readiness check failed: %w", err)
+	}
+	simulation.Cluster = readiness
+	simulation.Failures = append(simulation.Failures, readiness.Failures...)
+
+	// The readiness check already reports steps that fail to render
+	reported := make(map[string]bool)
+	for _, failure := range simulation.Failures {
+		reported[failure] = true
+	}
+	fail := func(failure string) {
+		if !reported[failure] {
+			reported[failure] = true
+			simulation.Failures = append(simulation.Failures, failure)
+		}
+	}
+	for _, step := range plan.Steps {
+		result := s.simulateStep(ctx, client, step)
+		if result.Error != "" {
+			fail(fmt.Sprintf("%s: %s", step.Name, result.Error))
+		}
+		for _, obj := range result.Objects {
+			if obj.Action == "failed" {
+				fail(fmt.Sprintf("%s: %s/%s: %s", step.Name, obj.Kind, obj.Name, obj.Error))
+			}
+		}
+		simulation.Steps = append(simulation.Steps, result)
+	}
+
+	simulation.Passed = len(simulation.Failures) == 0
+	return simulation, nil
+}
+
+// simulateStep renders a step and applies its objects to the simulated
+// cluster, creating its namespace first as deployments do
+func (s *PreflightService) simulateStep(ctx context.Context, client *kubernetes.KubernetesClient, step agent.DeploymentStep) SimulatedStep {
+	result := SimulatedStep{StepID: step.ID, Name: step.Name, Objects: []kubernetes.ManifestObjectResult{}}
+
+	namespace, manifest := step.Namespace, step.Manifest
+	switch {
+	case step.Chart != nil:
+		namespace = step.Chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		rendered, err := s.deploymentExecutor.RenderChartWithCRDs(ctx, step.Chart, namespace)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		manifest = rendered
+	case step.Manifest != "":
+		if namespace == "" {
+			namespace = "default"
+		}
+	case step.Command != "":
+		result.Skipped = "Commands are not simulated"
+		return result
+	default:
+		return result
+	}
+
+	objects, err := kubernetes.ParseManifest(manifest)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	exists, err := client.NamespaceExists(ctx, namespace)
+	if err == nil && !exists {
+		if err := client.EnsureNamespace(ctx, namespace); err == nil {
+			result.Objects = append(result.Objects, kubernetes.ManifestObjectResult{Kind: "Namespace", Name: namespace, Action: "created"})
+		}
+	}
+	result.Objects = append(result.Objects, client.ApplyObjects(ctx, objects, namespace)...)
+	return result
+}
+
+// simulatedKinds are the served versions of the CRDs of the snapshot
+func simulatedKinds(analysis *agent.ClusterAnalysis) []kubernetes.ServedKind {
+	var kinds []kubernetes.ServedKind
+	for _, crd := range analysis.CustomResources {
+		for _, version := range crd.Versions {
+			kinds = append(kinds, kubernetes.ServedKind{
+				GroupVersionKind: schema.GroupVersionKind{Group: crd.Group, Version: version, Kind: crd.Kind},
+				Plural:           crd.Plural,
+				Namespaced:       crd.Namespaced,
+			})
+		}
+	}
+	return kinds
+}
+
+// simulatedObjects rebuilds the nodes, storage classes, namespaces, quotas and
+// LimitRanges of a snapshot. Quotas hard-limit what the snapshot's quotas had
+// left, so nothing counts as used.
+func simulatedObjects(analysis *agent.ClusterAnalysis) []runtime.Object {
+	var objects []runtime.Object
+
+	for _, info := range analysis.Nodes {
+		node := &corev1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: info.Name, Labels: info.Labels, Annotations: info.Annotations},
+			Status: corev1.NodeStatus{
+				Capacity:    simulatedResources(info.CPU.Capacity, info.Memory.Capacity),
+				Allocatable: simulatedResources(info.CPU.Allocatable, info.Memory.Allocatable),
+				NodeInfo: corev1.NodeSystemInfo{
+					Architecture:    info.Architecture,
+					OperatingSystem: info.OperatingSystem,
+				},
+			},
+		}
+		ready := corev1.ConditionFalse
+		if info.Status == string(corev1.NodeReady) {
+			ready = corev1.ConditionTrue
+		}
+		node.Status.Conditions = []corev1.NodeCondition{{Type: corev1.NodeReady, Status: ready}}
+		for _, taint := range info.Taints {
+			node.Spec.Taints = append(node.Spec.Taints, corev1.Taint{Key: taint.Key, Value: taint.Value, Effect: corev1.TaintEffect(taint.Effect)})
+			if taint.Key == corev1.TaintNodeUnschedulable {
+				node.Spec.Unschedulable = true
+			}
+		}
+		objects = append(objects, node)
+	}
+
+	for _, name := range analysis.StorageClasses {
+		class := &storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		if name == analysis.DefaultStorageClass {
+			class.Annotations = map[string]string{defaultStorageClassAnnotation: "true"}
+		}
+		objects = append(objects, class)
+	}
+
+	namespaces := make(map[string]bool)
+	for _, name := range analysis.Namespaces {
+		namespaces[name] = true
+	}
+	for _, limits := range analysis.NamespaceLimits {
+		namespaces[limits.Namespace] = true
+		objects = append(objects, simulatedLimits(limits)...)
+	}
+	names := make([]string, 0, len(namespaces))
+	for name := range namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		objects = append(objects, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	return objects
+}
+
+// simulatedLimits rebuilds the quotas and LimitRange of a namespace
+func simulatedLimits(limits agent.NamespaceLimits) []runtime.Object {
+	var objects []runtime.Object
+
+	quotas := make(map[string]*corev1.ResourceQuota)
+	var quotaNames []string
+	for name, remaining := range limits.QuotaRemaining {
+		quantity, err := resource.ParseQuantity(remaining)
+		if err != nil {
+			continue
+		}
+		quotaName := limits.Quotas[name]
+		if quotaName == "" {
+			quotaName = "quota"
+		}
+		quota, ok := quotas[quotaName]
+		if !ok {
+			quota = &corev1.ResourceQuota{
+				ObjectMeta: metav1.ObjectMeta{Name: quotaName, Namespace: limits.Namespace},
+				Spec:       corev1.ResourceQuotaSpec{Hard: corev1.ResourceList{}},
+			}
+			quotas[quotaName] = quota
+			quotaNames = append(quotaNames, quotaName)
+		}
+		quota.Spec.Hard[corev1.ResourceName(name)] = quantity
+	}
+	sort.Strings(quotaNames)
+	for _, name := range quotaNames {
+		objects = append(objects, quotas[name])
+	}
+
+	container := corev1.LimitRangeItem{
+		Type:                 corev1.LimitTypeContainer,
+		Min:                  parseResourceList(limits.ContainerMin),
+		Max:                  parseResourceList(limits.ContainerMax),
+		DefaultRequest:       parseResourceList(limits.ContainerDefaultRequest),
+		Default:              parseResourceList(limits.ContainerDefaultLimit),
+		MaxLimitRequestRatio: parseResourceList(limits.MaxLimitRequestRatio),
+	}
+	if len(container.Min)+len(container.Max)+len(container.DefaultRequest)+len(container.Default)+len(container.MaxLimitRequestRatio) > 0 {
+		objects = append(objects, &corev1.LimitRange{
+			ObjectMeta: metav1.ObjectMeta{Name: "limits", Namespace: limits.Namespace},
+			Spec:       corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{container}},
+		})
+	}
+	return objects
+}
+
+// simulatedResources is the CPU and memory of a node, skipping unparsable quantities
+func simulatedResources(cpu, memory string) corev1.ResourceList {
+	return parseResourceList(map[string]string{string(corev1.ResourceCPU): cpu, string(corev1.ResourceMemory): memory})
+}
+
+// parseResourceList parses quantities keyed by resource name, skipping the
+// ones that don't parse
+func parseResourceList(quantities map[string]string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	for name, value := range quantities {
+		quantity, err := resource.ParseQuantity(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		list[corev1.ResourceName(name)] = quantity
+	}
+	return list
+}
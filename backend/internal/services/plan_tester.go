@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// PlanTesterService validates deployment plans against a target cluster before execution
+type PlanTesterService struct {
+	deploymentExecutor *DeploymentExecutorService
+}
+
+// NewPlanTesterService creates a new plan tester service
+func NewPlanTesterService(deploymentExecutor *DeploymentExecutorService) *PlanTesterService {
+	return &PlanTesterService{
+		deploymentExecutor: deploymentExecutor,
+	}
+}
+
+// PlanTestReport summarizes the result of testing every step of a plan
+type PlanTestReport struct {
+	PlanID    string           `json:"plan_id"`
+	ClusterID uint             `json:"cluster_id"`
+	Passed    bool             `json:"passed"`
+	Steps     []StepTestResult `json:"steps"`
+	TestedAt  time.Time        `json:"tested_at"`
+}
+
+// StepTestResult holds the render and dry-run outcome of a single plan step
+type StepTestResult struct {
+	StepID   string                            `json:"step_id"`
+	Chart    string                            `json:"chart,omitempty"`
+	Rendered bool                              `json:"rendered"`
+	Objects  []kubernetes.ManifestObjectResult `json:"objects"`
+	Issues   []PlanTestIssue                   `json:"issues"`
+}
+
+// PlanTestIssue describes a problem that would make a real deployment fail
+type PlanTestIssue struct {
+	Type    string `json:"type"` // render, schema, admission, forbidden, conflict, error
+	Object  string `json:"object,omitempty"`
+	Message string `json:"message"`
+}
+
+// TestPlan renders every chart in the plan and submits the output to the
+// cluster with server-side dry-run
+func (s *PlanTesterService) TestPlan(ctx context.Context, plan *agent.DeploymentPlan, clusterID uint, kubeconfig string) (*PlanTestReport, error) {
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+
+	report := &PlanTestReport{
+		PlanID:    plan.ID,
+		ClusterID: clusterID,
+		Passed:    true,
+		Steps:     make([]StepTestResult, 0, len(plan.Steps)),
+		TestedAt:  time.Now(),
+	}
+
+	for _, step := range plan.Steps {
+		result := s.testStep(ctx, client, step)
+		if len(result.Issues) > 0 {
+			report.Passed = false
+		}
+		report.Steps = append(report.Steps, result)
+	}
+
+	return report, nil
+}
+
+// testStep renders and dry-runs a single step
+func (s *PlanTesterService) testStep(ctx context.Context, client *kubernetes.KubernetesClient, step agent.DeploymentStep) StepTestResult {
+	result := StepTestResult{
+		StepID:  step.ID,
+		Objects: []kubernetes.ManifestObjectResult{},
+		Issues:  []PlanTestIssue{},
+	}
+
+	// Manifest steps are dry-run as written; command steps cannot be tested without running them
+	manifest, namespace := step.Manifest, step.Namespace
+	if manifest == "" {
+		if step.Chart == nil {
+			return result
+		}
+		result.Chart = step.Chart.Name
+
+		rendered, err := s.deploymentExecutor.RenderChart(ctx, step.Chart, "")
+		if err != nil {
+			result.Issues = append(result.Issues, PlanTestIssue{
+				Type:    "render",
+				Message: err.Error(),
+			})
+			return result
+		}
+		manifest, namespace = rendered, ""
+	}
+	result.Rendered = true
+
+	objects, err := client.DryRunManifest(manifest, namespace)
+	if err != nil {
+		result.Issues = append(result.Issues, PlanTestIssue{
+			Type:    "render",
+			Message: err.Error(),
+		})
+		return result
+	}
+	result.Objects = objects
+
+	for _, obj := range objects {
+		if obj.Action != "failed" {
+			continue
+		}
+		result.Issues = append(result.Issues, PlanTestIssue{
+			Type:    obj.Reason,
+			Object:  fmt.Sprintf("%s/%s", obj.Kind, obj.Name),
+			Message: obj.Error,
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+const (
+	// maxChartReferenceKeys bounds the documented keys offered to the model per chart
+	maxChartReferenceKeys = 150
+	// maxChartOverviewLength bounds the README introduction offered to the model
+	maxChartOverviewLength = 2000
+)
+
+// PlanValuesService tailors the values of a plan's charts to the user's
+// request, grounding the model in each chart's documented values so it sets
+// real keys instead of guessed ones
+type PlanValuesService struct {
+	aiAgent     *agent.AIAgent
+	helmService *HelmService
+}
+
+// NewPlanValuesService creates a new plan values service
+func NewPlanValuesService(aiAgent *agent.AIAgent, helmService *HelmService) *PlanValuesService {
+	return &PlanValuesService{
+		aiAgent:     aiAgent,
+		helmService: helmService,
+	}
+}
+
+const planValuesSystemPrompt = `You are a Kubernetes engineer configuring a Helm chart for a user's request.
+
+You are given the request, the chart's documentation and a reference of the chart's values with their types, defaults and descriptions.
+
+Respond with one JSON object of values overrides that the request calls for, nested like values.yaml.
+
+Rules:
+- Only use keys from the values reference. Never invent keys.
+- Only set values the request or the cluster calls for; leave everything else at its default.
+- Do not set resources, storage classes, ingress, security contexts, tolerations or node selectors; the platform sets them from the cluster.
+- Respond with {} when the defaults already fit.
+- Respond with the JSON object only.`
+
+// ChartValueKey is a documented key of a chart's values
+type ChartValueKey struct {
+	Path        string      `json:"path"`
+	Type        string      `json:"type,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// TailoredValues are the overrides the model set on a chart, and the keys it
+// proposed that the chart doesn't have
+type TailoredValues struct {
+	Overrides map[string]interface{} `json:"overrides"`
+	Dropped   []string               `json:"dropped,omitempty"`
+}
+
+// TailorValues asks the model which of the chart's documented values the
+// request calls for. Proposed keys the chart doesn't document are dropped.
+func (s *PlanValuesService) TailorValues(ctx context.Context, query string, chart *agent.HelmChart, clusterAnalysis *agent.ClusterAnalysis) (*TailoredValues, error) {
+	if chart.ChartID == "" {
+		return nil, fmt.Errorf("chart %s has no Artifact Hub package", chart.Name)
+	}
+	docs, err := s.helmService.chartDocs(chart.ChartID, chart.Version)
+	if err != nil {
+		return nil, err
+	}
+	keys := chartValueKeys(docs)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("chart %s documents no values", chart.Name)
+	}
+
+	reference, err := json.Marshal(relevantValueKeys(keys, query, maxChartReferenceKeys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode values reference: %w", err)
+	}
+
+	var userMessage strings.Builder
+	fmt.Fprintf(&userMessage, "Request: %s\n\nChart: %s %s\n%s\n", query, chart.Name, docs.version, chart.Description)
+	if overview := chartOverview(docs.readme); overview != "" {
+		fmt.Fprintf(&userMessage, "\nDocumentation:\n%s\n", overview)
+	}
+	if clusterAnalysis != nil {
+		fmt.Fprintf(&userMessage, "\nCluster:\n%s\n", clusterAnalysis.Summary())
+	}
+	fmt.Fprintf(&userMessage, "\nValues reference:\n%s\n", reference)
+
+	response, err := s.aiAgent.Complete(ctx, planValuesSystemPrompt, userMessage.String())
+	if err != nil {
+		return nil, err
+	}
+	block := agent.ExtractJSONBlock(response)
+	if block == "" {
+		return nil, fmt.Errorf("model response did not contain values JSON")
+	}
+	var proposed map[string]interface{}
+	if err := json.Unmarshal([]byte(block), &proposed); err != nil {
+		return nil, fmt.Errorf("model returned invalid values JSON: %w", err)
+	}
+
+	tailored := &TailoredValues{Overrides: map[string]interface{}{}}
+	s.keepDocumentedValues(docs, "", proposed, tailored)
+	sort.Strings(tailored.Dropped)
+	return tailored, nil
+}
+
+// chartValueKeys lists the leaf keys of a chart's values.yaml, schema and
+// README parameter tables
+func chartValueKeys(docs *chartDocs) []ChartValueKey {
+	keys := map[string]*ChartValueKey{}
+	key := func(path string) *ChartValueKey {
+		if existing, ok := keys[path]; ok {
+			return existing
+		}
+		entry := &ChartValueKey{Path: path, Description: docs.descriptions[path]}
+		keys[path] = entry
+		return entry
+	}
+
+	var walkValues func(path string, value interface{})
+	walkValues = func(path string, value interface{}) {
+		if nested, ok := value.(map[string]interface{}); ok && len(nested) > 0 {
+			for name, child := range nested {
+				walkValues(joinValuePath(path, name), child)
+			}
+			return
+		}
+		if path == "" {
+			return
+		}
+		entry := key(path)
+		entry.Type = valueType(value)
+		entry.Default = value
+	}
+	walkValues("", docs.values)
+
+	var walkSchema func(path string, schema map[string]interface{})
+	walkSchema = func(path string, schema map[string]interface{}) {
+		if properties, ok := schema["properties"].(map[string]interface{}); ok && len(properties) > 0 {
+			for name, property := range properties {
+				if property, ok := property.(map[string]interface{}); ok {
+					walkSchema(joinValuePath(path, name), property)
+				}
+			}
+			return
+		}
+		if path == "" {
+			return
+		}
+		entry := key(path)
+		if schemaType := schemaType(schema); schemaType != "" {
+			entry.Type = schemaType
+		}
+		if description, ok := schema["description"].(string); ok && entry.Description == "" {
+			entry.Description = description
+		}
+		if value, ok := schema["default"]; ok && entry.Default == nil {
+			entry.Default = value
+		}
+	}
+	walkSchema("", docs.schema)
+
+	for path := range docs.descriptions {
+		key(path)
+	}
+
+	result := make([]ChartValueKey, 0, len(keys))
+	for _, entry := range keys {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// relevantValueKeys keeps the limit keys that share the most words with the
+// query, preferring documented keys and then shallow ones
+func relevantValueKeys(keys []ChartValueKey, query string, limit int) []ChartValueKey {
+	if len(keys) <= limit {
+		return keys
+	}
+
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if len(word) >= 3 {
+			words = append(words, word)
+		}
+	}
+
+	scores := make(map[string]int, len(keys))
+	for _, key := range keys {
+		text := strings.ToLower(key.Path + " " + key.Description)
+		score := 0
+		for _, word := range words {
+			if strings.Contains(text, word) {
+				score += 10
+			}
+		}
+		if key.Description != "" {
+			score += 2
+		}
+		score -= strings.Count(key.Path, ".")
+		scores[key.Path] = score
+	}
+
+	ranked := append([]ChartValueKey(nil), keys...)
+	sort.SliceStable(ranked, func(i, j int) bool { return scores[ranked[i].Path] > scores[ranked[j].Path] })
+	ranked = ranked[:limit]
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].Path < ranked[j].Path })
+	return ranked
+}
+
+// chartOverview returns the introduction of a chart's README, before its
+// installation and parameter sections
+func chartOverview(readme string) string {
+	var lines []string
+	length := 0
+	for i, line := range strings.Split(readme, "\n") {
+		trimmed := strings.TrimSpace(line)
+		lower := strings.ToLower(trimmed)
+		if i > 0 && strings.HasPrefix(trimmed, "#") &&
+			(strings.Contains(lower, "parameter") || strings.Contains(lower, "install") || strings.Contains(lower, "configuration")) {
+			break
+		}
+		if strings.HasPrefix(trimmed, "|") || strings.HasPrefix(trimmed, "[![") {
+			continue
+		}
+		if length+len(line) > maxChartOverviewLength {
+			break
+		}
+		lines = append(lines, line)
+		length += len(line) + 1
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// keepDocumentedValues copies the proposed values whose keys the chart
+// documents into tailored, and records the others as dropped. Keys below a
+// map the chart leaves free-form, like podAnnotations, are all kept.
+func (s *PlanValuesService) keepDocumentedValues(docs *chartDocs, parent string, proposed map[string]interface{}, tailored *TailoredValues) {
+	for key, value := range proposed {
+		path := joinValuePath(parent, key)
+		if !documentsValuePath(docs, path) {
+			tailored.Dropped = append(tailored.Dropped, path)
+			continue
+		}
+		nested, isMap := value.(map[string]interface{})
+		if isMap && !isFreeFormValue(docs, path) {
+			s.keepDocumentedValues(docs, path, nested, tailored)
+			continue
+		}
+		s.helmService.mergeValues(tailored.Overrides, valuesAtPath(path, value))
+	}
+}
+
+// documentsValuePath reports whether a path is in the chart's values, schema
+// or documentation, or below a free-form map
+func documentsValuePath(docs *chartDocs, path string) bool {
+	segments := strings.Split(path, ".")
+	if hasValuePath(docs.values, segments) || lookupSchema(docs.schema, segments) != nil {
+		return true
+	}
+	if _, ok := docs.descriptions[path]; ok {
+		return true
+	}
+	for documented := range docs.descriptions {
+		if strings.HasPrefix(documented, path+".") {
+			return true
+		}
+	}
+	for i := len(segments) - 1; i > 0; i-- {
+		if isFreeFormValue(docs, strings.Join(segments[:i], ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFreeFormValue reports whether a path holds a map whose keys the chart
+// doesn't fix: an empty map default, or a schema with additionalProperties
+func isFreeFormValue(docs *chartDocs, path string) bool {
+	segments := strings.Split(path, ".")
+	if schema := lookupSchema(docs.schema, segments); schema != nil {
+		if _, ok := schema["additionalProperties"].(map[string]interface{}); ok {
+			return true
+		}
+		if allowed, ok := schema["additionalProperties"].(bool); ok && allowed {
+			return true
+		}
+	}
+	value, ok := lookupValue(docs.values, segments).(map[string]interface{})
+	return ok && len(value) == 0
+}
+
+// hasValuePath reports whether decoded values have a key at a path, even one
+// set to null
+func hasValuePath(values map[string]interface{}, segments []string) bool {
+	if len(segments) == 0 {
+		return false
+	}
+	parent, ok := lookupValue(values, segments[:len(segments)-1]).(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = parent[segments[len(segments)-1]]
+	return ok
+}
+
+func joinValuePath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+)
+
+var (
+	kyvernoClusterPolicyGVR = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "clusterpolicies"}
+	kyvernoPolicyGVR        = schema.GroupVersionResource{Group: "kyverno.io", Version: "v1", Resource: "policies"}
+	constraintTemplateGVR   = schema.GroupVersionResource{Group: "templates.gatekeeper.sh", Version: "v1", Resource: "constrainttemplates"}
+)
+
+// analyzePolicies enumerates Kyverno and Gatekeeper policies installed on the cluster
+func (s *ClusterAnalyzerService) analyzePolicies(ctx context.Context, discoveryClient discovery.DiscoveryInterface, dynamicClient dynamic.Interface) []agent.PolicySummary {
+	policies := []agent.PolicySummary{}
+
+	if groupVersionServed(discoveryClient, "kyverno.io/v1") {
+		policies = append(policies, s.kyvernoPolicies(ctx, dynamicClient)...)
+	}
+	if groupVersionServed(discoveryClient, "templates.gatekeeper.sh/v1") {
+		policies = append(policies, s.gatekeeperConstraints(ctx, dynamicClient)...)
+	}
+
+	return policies
+}
+
+// kyvernoPolicies summarizes Kyverno ClusterPolicies and namespaced Policies
+func (s *ClusterAnalyzerService) kyvernoPolicies(ctx context.Context, dynamicClient dynamic.Interface) []agent.PolicySummary {
+	var policies []agent.PolicySummary
+
+	for _, gvr := range []schema.GroupVersionResource{kyvernoClusterPolicyGVR, kyvernoPolicyGVR} {
+		list, err := dynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			continue
+		}
+
+		for _, item := range list.Items {
+			action, _, _ := unstructured.NestedString(item.Object, "spec", "validationFailureAction")
+			summary := agent.PolicySummary{
+				Engine:    "kyverno",
+				Kind:      item.GetKind(),
+				Name:      item.GetName(),
+				Namespace: item.GetNamespace(),
+				Action:    strings.ToLower(action),
+			}
+			if summary.Action == "" {
+				summary.Action = "audit"
+			}
+
+			rules, _, _ := unstructured.NestedSlice(item.Object, "spec", "rules")
+			targets := make(map[string]bool)
+			for _, ruleItem := range rules {
+				rule, ok := ruleItem.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				for _, kind := range kyvernoRuleKinds(rule) {
+					targets[kind] = true
+				}
+
+				// Newer Kyverno releases set the failure action per rule
+				if ruleAction, found, _ := unstructured.NestedString(rule, "validate", "failureAction"); found && ruleAction != "" {
+					summary.Action = strings.ToLower(ruleAction)
+				}
+
+				if constraint := kyvernoRuleConstraint(rule); constraint != "" {
+					summary.Constraints = append(summary.Constraints, constraint)
+				}
+			}
+			summary.Targets = sortedKeys(targets)
+
+			if len(summary.Constraints) > 0 {
+				policies = append(policies, summary)
+			}
+		}
+	}
+
+	return policies
+}
+
+// kyvernoRuleKinds collects the resource kinds a Kyverno rule matches
+func kyvernoRuleKinds(rule map[string]interface{}) []string {
+	var kinds []string
+	if direct, found, _ := unstructured.NestedStringSlice(rule, "match", "resources", "kinds"); found {
+		kinds = append(kinds, direct...)
+	}
+	for _, key := range []string{"any", "all"} {
+		filters, _, _ := unstructured.NestedSlice(rule, "match", key)
+		for _, filterItem := range filters {
+			filter, ok := filterItem.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if nested, found, _ := unstructured.NestedStringSlice(filter, "resources", "kinds"); found {
+				kinds = append(kinds, nested...)
+			}
+		}
+	}
+	return kinds
+}
+
+// kyvernoRuleConstraint describes what a validate rule requires in one line
+func kyvernoRuleConstraint(rule map[string]interface{}) string {
+	validate, found, _ := unstructured.NestedMap(rule, "validate")
+	if !found {
+		return ""
+	}
+
+	name, _ := rule["name"].(string)
+	message, _ := validate["message"].(string)
+	if message == "" {
+		if pattern, ok := validate["pattern"]; ok {
+			message = "must match pattern " + compactJSON(pattern, 300)
+		} else if deny, ok := validate["deny"]; ok {
+			message = "denied when " + compactJSON(deny, 300)
+		} else if podSecurity, ok := validate["podSecurity"]; ok {
+			message = "pod security " + compactJSON(podSecurity, 300)
+		}
+	}
+	if message == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s: %s", name, message)
+}
+
+// gatekeeperConstraints summarizes Gatekeeper constraints for every ConstraintTemplate
+func (s *ClusterAnalyzerService) gatekeeperConstraints(ctx context.Context, dynamicClient dynamic.Interface) []agent.PolicySummary {
+	var policies []agent.PolicySummary
+
+	templates, err := dynamicClient.Resource(constraintTemplateGVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return policies
+	}
+
+	for _, template := range templates.Items {
+		kind, _, _ := unstructured.NestedString(template.Object, "spec", "crd", "spec", "names", "kind")
+		if kind == "" {
+			continue
+		}
+
+		constraintGVR := schema.GroupVersionResource{Group: "constraints.gatekeeper.sh", Version: "v1beta1", Resource: strings.ToLower(kind)}
+		constraints, err := dynamicClient.Resource(constraintGVR).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			continue
+		}
+
+		description := template.GetAnnotations()["description"]
+		for _, constraint := range constraints.Items {
+			action, _, _ := unstructured.NestedString(constraint.Object, "spec", "enforcementAction")
+			if action == "" {
+				action = "deny"
+			}
+
+			summary := agent.PolicySummary{
+				Engine: "gatekeeper",
+				Kind:   kind,
+				Name:   constraint.GetName(),
+				Action: strings.ToLower(action),
+			}
+
+			kinds, _, _ := unstructured.NestedSlice(constraint.Object, "spec", "match", "kinds")
+			for _, kindItem := range kinds {
+				if matcher, ok := kindItem.(map[string]interface{}); ok {
+					if names, found, _ := unstructured.NestedStringSlice(matcher, "kinds"); found {
+						summary.Targets = append(summary.Targets, names...)
+					}
+				}
+			}
+
+			text := kind
+			if description != "" {
+				text = fmt.Sprintf("%s (%s)", kind, description)
+			}
+			if parameters, found, _ := unstructured.NestedFieldNoCopy(constraint.Object, "spec", "parameters"); found {
+				text += " with parameters " + compactJSON(parameters, 300)
+			}
+			summary.Constraints = append(summary.Constraints, text)
+
+			policies = append(policies, summary)
+		}
+	}
+
+	return policies
+}
+
+// groupVersionServed reports whether the API server serves a group/version
+func groupVersionServed(discoveryClient discovery.DiscoveryInterface, groupVersion string) bool {
+	_, err := discoveryClient.ServerResourcesForGroupVersion(groupVersion)
+	return err == nil
+}
+
+// compactJSON renders a value as single-line JSON, truncated for prompt use
+func compactJSON(value interface{}, limit int) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	if len(encoded) > limit {
+		return string(encoded[:limit]) + "..."
+	}
+	return string(encoded)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
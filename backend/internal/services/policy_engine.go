@@ -0,0 +1,244 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// opaBinary is the Open Policy Agent CLI policies are evaluated with
+const opaBinary = "opa"
+
+var (
+	// regoPackage matches the package declaration of a Rego module
+	regoPackage = regexp.MustCompile(`(?m)^\s*package\s+([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)\s*$`)
+	// regoDenyRule matches the head of a deny rule
+	regoDenyRule = regexp.MustCompile(`(?m)^\s*deny\b`)
+)
+
+// RegoPolicy is an organization policy written in Rego. Its module defines a
+// deny rule that yields a message for everything the policy forbids.
+type RegoPolicy struct {
+	Name   string `json:"name"`
+	Module string `json:"module"`
+}
+
+// PolicyInput is the document policies are evaluated against, as input
+type PolicyInput struct {
+	Plan *agent.DeploymentPlan `json:"plan"`
+	// Resources are the objects every step creates, charts rendered
+	Resources []PolicyResource `json:"resources"`
+}
+
+// PolicyResource is an object a plan step creates
+type PolicyResource struct {
+	StepID    string                 `json:"step_id"`
+	Step      string                 `json:"step"`
+	Chart     string                 `json:"chart,omitempty"`
+	Namespace string                 `json:"namespace"`
+	Object    map[string]interface{} `json:"object"`
+}
+
+// PolicyEvaluation is the outcome of a plan's policy checks
+type PolicyEvaluation struct {
+	PlanID     string            `json:"plan_id"`
+	Passed     bool              `json:"passed"`
+	Policies   []string          `json:"policies"`
+	Violations []PolicyViolation `json:"violations"`
+	// Errors are steps that couldn't be rendered and policies that failed to
+	// run; either fails the evaluation, since the plan couldn't be checked
+	Errors      []string  `json:"errors"`
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// PolicyViolation is a message a policy's deny rule yielded
+type PolicyViolation struct {
+	Policy  string `json:"policy"`
+	Message string `json:"message"`
+}
+
+// PolicyEngineService checks deployment plans against organization policies
+type PolicyEngineService struct {
+	deploymentExecutor *DeploymentExecutorService
+}
+
+// NewPolicyEngineService creates a new policy engine service
+func NewPolicyEngineService(deploymentExecutor *DeploymentExecutorService) *PolicyEngineService {
+	return &PolicyEngineService{
+		deploymentExecutor: deploymentExecutor,
+	}
+}
+
+// ValidateRegoPolicy checks that a module compiles and defines a deny rule
+func ValidateRegoPolicy(ctx context.Context, module string) error {
+	if _, err := regoPackageOf(module); err != nil {
+		return err
+	}
+	if !regoDenyRule.MatchString(module) {
+		return fmt.Errorf("policy defines no deny rule")
+	}
+
+	dir, file, err := writeRegoModule(module)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	output, err := exec.CommandContext(ctx, opaBinary, "check", file).CombinedOutput()
+	if err != nil {
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return fmt.Errorf("%s", strings.ReplaceAll(message, file, "policy.rego"))
+		}
+		return fmt.Errorf("opa check failed: %w", err)
+	}
+	return nil
+}
+
+// EvaluatePlan renders every step of the plan and evaluates each policy's deny
+// rule against the plan and its objects. A plan without policies passes.
+func (s *PolicyEngineService) EvaluatePlan(ctx context.Context, plan *agent.DeploymentPlan, policies []RegoPolicy) (*PolicyEvaluation, error) {
+	evaluation := &PolicyEvaluation{
+		PlanID:      plan.ID,
+		Policies:    []string{},
+		Violations:  []PolicyViolation{},
+		Errors:      []string{},
+		EvaluatedAt: time.Now(),
+	}
+	if len(policies) == 0 {
+		evaluation.Passed = true
+		return evaluation, nil
+	}
+	if _, err := exec.LookPath(opaBinary); err != nil {
+		return nil, fmt.Errorf("opa not available: %w", err)
+	}
+
+	input, err := json.Marshal(s.policyInput(ctx, plan, evaluation))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode policy input: %w", err)
+	}
+
+	for _, policy := range policies {
+		evaluation.Policies = append(evaluation.Policies, policy.Name)
+		messages, err := evaluateDeny(ctx, policy.Module, input)
+		if err != nil {
+			evaluation.Errors = append(evaluation.Errors, fmt.Sprintf("%s: %v", policy.Name, err))
+			continue
+		}
+		for _, message := range messages {
+			evaluation.Violations = append(evaluation.Violations, PolicyViolation{Policy: policy.Name, Message: message})
+		}
+	}
+
+	evaluation.Passed = len(evaluation.Violations) == 0 && len(evaluation.Errors) == 0
+	return evaluation, nil
+}
+
+// policyInput collects the objects of every step. Steps that can't be rendered
+// are recorded as errors.
+func (s *PolicyEngineService) policyInput(ctx context.Context, plan *agent.DeploymentPlan, evaluation *PolicyEvaluation) *PolicyInput {
+	input := &PolicyInput{Plan: plan, Resources: []PolicyResource{}}
+	for _, manifest := range s.deploymentExecutor.RenderPlanManifests(ctx, plan, false) {
+		if manifest.Error != "" {
+			evaluation.Errors = append(evaluation.Errors, fmt.Sprintf("%s: %s", manifest.Step, manifest.Error))
+			continue
+		}
+		for _, object := range manifest.objects {
+			input.Resources = append(input.Resources, PolicyResource{
+				StepID:    manifest.StepID,
+				Step:      manifest.Step,
+				Chart:     manifest.Chart,
+				Namespace: manifest.Namespace,
+				Object:    object.Object,
+			})
+		}
+	}
+	return input
+}
+
+// evaluateDeny runs a module's deny rule with opa eval and returns the
+// messages it yields. Messages that aren't strings are returned as JSON.
+func evaluateDeny(ctx context.Context, module string, input []byte) ([]string, error) {
+	pkg, err := regoPackageOf(module)
+	if err != nil {
+		return nil, err
+	}
+	dir, file, err := writeRegoModule(module)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, opaBinary, "eval", "--format", "json", "--stdin-input", "--data", file, "data."+pkg+".deny")
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String() + string(output)); message != "" {
+			return nil, fmt.Errorf("opa eval failed: %s", strings.ReplaceAll(message, file, "policy.rego"))
+		}
+		return nil, fmt.Errorf("opa eval failed: %w", err)
+	}
+
+	var result struct {
+		Result []struct {
+			Expressions []struct {
+				Value interface{} `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode opa output: %w", err)
+	}
+
+	var messages []string
+	for _, entry := range result.Result {
+		for _, expression := range entry.Expressions {
+			values, ok := expression.Value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("deny is not a set of messages")
+			}
+			for _, value := range values {
+				if message, ok := value.(string); ok {
+					messages = append(messages, message)
+					continue
+				}
+				encoded, _ := json.Marshal(value)
+				messages = append(messages, string(encoded))
+			}
+		}
+	}
+	return messages, nil
+}
+
+// regoPackageOf returns the package a module declares
+func regoPackageOf(module string) (string, error) {
+	match := regoPackage.FindStringSubmatch(module)
+	if match == nil {
+		return "", fmt.Errorf("policy declares no package")
+	}
+	return match[1], nil
+}
+
+// writeRegoModule writes a module to a temporary directory of its own
+func writeRegoModule(module string) (string, string, error) {
+	dir, err := os.MkdirTemp("", "policy-")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create policy directory: %w", err)
+	}
+	file := filepath.Join(dir, "policy.rego")
+	if err := os.WriteFile(file, []byte(module), 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", "", fmt.Errorf("failed to write policy: %w", err)
+	}
+	return dir, file, nil
+}
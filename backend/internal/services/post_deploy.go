@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PostDeployStep provisions additional configuration after a chart has been installed
+type PostDeployStep interface {
+	// Name identifies the step in execution results
+	Name() string
+	// Applies reports whether the step should run for the installed chart
+	Applies(chart *agent.HelmChart) bool
+	// Run performs the provisioning, recording logs and outputs on the result
+	Run(ctx context.Context, chart *agent.HelmChart, kubeconfig string, result *agent.PostDeployResult) error
+}
+
+// RegisterPostDeployStep adds a step that runs after every matching chart install
+func (s *DeploymentExecutorService) RegisterPostDeployStep(step PostDeployStep) {
+	s.postDeploySteps = append(s.postDeploySteps, step)
+}
+
+// runPostDeploySteps runs every applicable post-deploy step for an installed chart.
+// Failures are recorded on the execution but never fail the deployment itself.
+func (s *DeploymentExecutorService) runPostDeploySteps(ctx context.Context, run *executionRun, step agent.DeploymentStep, kubeconfig string) {
+	if step.Chart == nil {
+		return
+	}
+
+	for _, postDeploy := range s.postDeploySteps {
+		if !postDeploy.Applies(step.Chart) {
+			continue
+		}
+
+		result := agent.PostDeployResult{
+			Name:    postDeploy.Name(),
+			StepID:  step.ID,
+			Status:  "completed",
+			Outputs: make(map[string]string),
+			Logs:    []string{},
+		}
+
+		run.log(fmt.Sprintf("Running post-deploy step %s for %s", postDeploy.Name(), step.Chart.Name))
+		stepCtx, span := tracing.Start(ctx, "deployment.post_deploy",
+			attribute.String("deployment.post_deploy", postDeploy.Name()),
+			attribute.String("helm.release", releaseName(step.Chart)),
+		)
+		err := postDeploy.Run(stepCtx, step.Chart, kubeconfig, &result)
+		tracing.End(span, err)
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			run.log(fmt.Sprintf("Post-deploy step %s failed: %v", postDeploy.Name(), err))
+		}
+
+		run.apply(func(execution *agent.DeploymentExecution) {
+			execution.PostDeploy = append(execution.PostDeploy, result)
+		})
+	}
+}
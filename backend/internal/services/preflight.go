@@ -0,0 +1,409 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// PreflightService checks whether a deployment plan can be executed on a cluster
+type PreflightService struct {
+	helmService        *HelmService
+	deploymentExecutor *DeploymentExecutorService
+	imageInspector     *ImageInspector
+}
+
+// NewPreflightService creates a new preflight service
+func NewPreflightService(helmService *HelmService, deploymentExecutor *DeploymentExecutorService) *PreflightService {
+	return &PreflightService{
+		helmService:        helmService,
+		deploymentExecutor: deploymentExecutor,
+		imageInspector:     NewImageInspector(helmService.network),
+	}
+}
+
+// PreflightReport is the structured result of all preflight checks for a plan
+type PreflightReport struct {
+	PlanID       string                     `json:"plan_id"`
+	ClusterID    uint                       `json:"cluster_id"`
+	Passed       bool                       `json:"passed"`
+	Admission    *AdmissionCompatibility    `json:"admission,omitempty"`
+	Architecture *ArchitectureCompatibility `json:"architecture,omitempty"`
+	Quotas       *QuotaCompatibility        `json:"quotas,omitempty"`
+	Cluster      *ClusterReadiness          `json:"cluster,omitempty"`
+	// Drift lists cluster changes since the plan was generated
+	Drift     *ClusterDrift `json:"drift,omitempty"`
+	CheckedAt time.Time     `json:"checked_at"`
+}
+
+// AdmissionCompatibility reports how the cluster's admission webhooks treat the plan
+type AdmissionCompatibility struct {
+	Webhooks    []kubernetes.AdmissionWebhookInfo `json:"webhooks"`
+	Engines     []string                          `json:"engines"`
+	Probes      []AdmissionProbeResult            `json:"probes"`
+	Adjustments []PlanAdjustment                  `json:"adjustments"`
+}
+
+// AdmissionProbeResult is the outcome of dry-running a representative resource
+type AdmissionProbeResult struct {
+	Chart    string `json:"chart"`
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// PlanAdjustment is a values change that makes a chart acceptable to cluster policy
+type PlanAdjustment struct {
+	Chart     string      `json:"chart"`
+	Path      string      `json:"path"`
+	Value     interface{} `json:"value,omitempty"`
+	Automatic bool        `json:"automatic"`
+	Reason    string      `json:"reason"`
+}
+
+// rejectionRule maps a webhook rejection message to a values adjustment
+type rejectionRule struct {
+	pattern *regexp.Regexp
+	path    string
+	value   interface{}
+	reason  string
+}
+
+var rejectionRules = []rejectionRule{
+	{regexp.MustCompile(`(?i)runasnonroot|run as non-?root|running as root`), "securityContext.runAsNonRoot", true, "Policy requires containers to run as non-root"},
+	{regexp.MustCompile(`(?i)allowprivilegeescalation|privilege escalation`), "securityContext.allowPrivilegeEscalation", false, "Policy forbids privilege escalation"},
+	{regexp.MustCompile(`(?i)privileged`), "securityContext.privileged", false, "Policy forbids privileged containers"},
+	{regexp.MustCompile(`(?i)readonlyrootfilesystem|read-only root`), "securityContext.readOnlyRootFilesystem", true, "Policy requires a read-only root filesystem"},
+	{regexp.MustCompile(`(?i)capabilit`), "securityContext.capabilities.drop", []interface{}{"ALL"}, "Policy requires dropping all Linux capabilities"},
+	{regexp.MustCompile(`(?i)seccomp`), "securityContext.seccompProfile.type", "RuntimeDefault", "Policy requires a seccomp profile"},
+	{regexp.MustCompile(`(?i)hostnetwork|host network`), "hostNetwork", false, "Policy forbids host networking"},
+	{regexp.MustCompile(`(?i)(cpu|memory)?\s*limits?\b.*(required|must|missing)|resource limits|limits are required`), "resources.limits", map[string]interface{}{"cpu": "500m", "memory": "512Mi"}, "Policy requires resource limits"},
+	{regexp.MustCompile(`(?i)(cpu|memory)?\s*requests?\b.*(required|must|missing)|resource requests`), "resources.requests", map[string]interface{}{"cpu": "100m", "memory": "128Mi"}, "Policy requires resource requests"},
+}
+
+var (
+	requiredLabelPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)must provide labels?:\s*\{"?([^"}]+)"?\}`),
+		regexp.MustCompile(`(?i)label '?"?([A-Za-z0-9./_-]+)'?"? is required`),
+	}
+	registryPattern  = regexp.MustCompile(`(?i)registr|repos|image.*not allowed|allowed images`)
+	latestTagPattern = regexp.MustCompile(`(?i)latest`)
+)
+
+// CheckAdmissionCompatibility detects policy webhooks and dry-runs representative
+// resources for every chart in the plan against them
+func (s *PreflightService) CheckAdmissionCompatibility(ctx context.Context, client *kubernetes.KubernetesClient, plan *agent.DeploymentPlan) (*AdmissionCompatibility, error) {
+	webhooks, err := client.ListAdmissionWebhooks()
+	if err != nil {
+		return nil, err
+	}
+
+	compatibility := &AdmissionCompatibility{
+		Webhooks:    webhooks,
+		Engines:     []string{},
+		Probes:      []AdmissionProbeResult{},
+		Adjustments: []PlanAdjustment{},
+	}
+
+	engines := make(map[string]bool)
+	for _, webhook := range webhooks {
+		if !engines[webhook.Engine] {
+			engines[webhook.Engine] = true
+			compatibility.Engines = append(compatibility.Engines, webhook.Engine)
+		}
+	}
+
+	// Without webhooks nothing beyond built-in validation can reject the plan
+	if len(webhooks) == 0 {
+		return compatibility, nil
+	}
+
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+
+		probes := buildAdmissionProbes(step.Chart)
+		results := client.DryRunObjects(probes, "default")
+		for _, result := range results {
+			probe := AdmissionProbeResult{
+				Chart:    step.Chart.Name,
+				Kind:     result.Kind,
+				Name:     result.Name,
+				Accepted: result.Action != "failed",
+				Reason:   result.Reason,
+				Message:  result.Error,
+			}
+			compatibility.Probes = append(compatibility.Probes, probe)
+
+			if !probe.Accepted {
+				compatibility.Adjustments = append(compatibility.Adjustments, translateRejection(step.Chart.Name, result.Error)...)
+			}
+		}
+	}
+
+	compatibility.Adjustments = dedupeAdjustments(compatibility.Adjustments)
+	return compatibility, nil
+}
+
+// ApplyAdjustments merges automatic adjustments into the values of the matching
+// charts and returns the number of adjustments applied
+func (s *PreflightService) ApplyAdjustments(plan *agent.DeploymentPlan, adjustments []PlanAdjustment) int {
+	applied := 0
+	for _, adjustment := range adjustments {
+		if !adjustment.Automatic {
+			continue
+		}
+
+		matched := false
+		for i := range plan.Charts {
+			if plan.Charts[i].Name == adjustment.Chart {
+				s.applyAdjustment(&plan.Charts[i], adjustment)
+				matched = true
+			}
+		}
+		for i := range plan.Steps {
+			if plan.Steps[i].Chart != nil && plan.Steps[i].Chart.Name == adjustment.Chart {
+				s.applyAdjustment(plan.Steps[i].Chart, adjustment)
+				matched = true
+			}
+		}
+		if matched {
+			applied++
+		}
+	}
+	return applied
+}
+
+func (s *PreflightService) applyAdjustment(chart *agent.HelmChart, adjustment PlanAdjustment) {
+	if adjustment.Path == namespaceAdjustmentPath {
+		if namespace, ok := adjustment.Value.(string); ok {
+			chart.Namespace = namespace
+		}
+		return
+	}
+	if chart.Values == nil {
+		chart.Values = make(map[string]interface{})
+	}
+	s.helmService.mergeValues(chart.Values, valuesAtPath(adjustment.Path, adjustment.Value))
+}
+
+// buildAdmissionProbes creates representative workload objects reflecting the chart's values
+func buildAdmissionProbes(chart *agent.HelmChart) []*unstructured.Unstructured {
+	name := fmt.Sprintf("%s-preflight-probe", sanitizeName(chart.Name))
+	labels := map[string]interface{}{
+		"app.kubernetes.io/name":       sanitizeName(chart.Name),
+		"app.kubernetes.io/managed-by": "Helm",
+	}
+
+	container := map[string]interface{}{
+		"name":  sanitizeName(chart.Name),
+		"image": probeImage(chart.Values),
+	}
+	if securityContext, ok := chart.Values["securityContext"].(map[string]interface{}); ok {
+		container["securityContext"] = securityContext
+	}
+	if resources, ok := chart.Values["resources"].(map[string]interface{}); ok {
+		container["resources"] = resources
+	}
+
+	podSpec := map[string]interface{}{
+		"containers": []interface{}{container},
+	}
+	if hostNetwork, ok := chart.Values["hostNetwork"].(bool); ok {
+		podSpec["hostNetwork"] = hostNetwork
+	}
+
+	deployment := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": labels,
+		},
+		"spec": map[string]interface{}{
+			"replicas": int64(1),
+			"selector": map[string]interface{}{
+				"matchLabels": labels,
+			},
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"labels": labels,
+				},
+				"spec": podSpec,
+			},
+		},
+	}}
+
+	service := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":   name,
+			"labels": labels,
+		},
+		"spec": map[string]interface{}{
+			"selector": labels,
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80)},
+			},
+		},
+	}}
+
+	return []*unstructured.Unstructured{deployment, service}
+}
+
+// probeImage derives an image reference from common chart value layouts
+func probeImage(values map[string]interface{}) string {
+	image, ok := values["image"].(map[string]interface{})
+	if !ok {
+		return "busybox:1.36"
+	}
+
+	repository, _ := image["repository"].(string)
+	if repository == "" {
+		return "busybox:1.36"
+	}
+	if registry, ok := image["registry"].(string); ok && registry != "" {
+		repository = registry + "/" + repository
+	}
+	if tag, ok := image["tag"].(string); ok && tag != "" {
+		return repository + ":" + tag
+	}
+	return repository
+}
+
+// translateRejection turns a webhook rejection message into plan adjustments
+func translateRejection(chart, message string) []PlanAdjustment {
+	var adjustments []PlanAdjustment
+
+	for _, rule := range rejectionRules {
+		if rule.pattern.MatchString(message) {
+			adjustments = append(adjustments, PlanAdjustment{
+				Chart:     chart,
+				Path:      rule.path,
+				Value:     rule.value,
+				Automatic: true,
+				Reason:    rule.reason,
+			})
+		}
+	}
+
+	for _, pattern := range requiredLabelPatterns {
+		for _, match := range pattern.FindAllStringSubmatch(message, -1) {
+			for _, label := range strings.Split(match[1], `", "`) {
+				adjustments = append(adjustments, PlanAdjustment{
+					Chart:  chart,
+					Path:   "podLabels." + strings.Trim(label, `" `),
+					Reason: fmt.Sprintf("Policy requires label %q; choose a value for your organization", strings.Trim(label, `" `)),
+				})
+			}
+		}
+	}
+
+	if registryPattern.MatchString(message) {
+		adjustments = append(adjustments, PlanAdjustment{
+			Chart:  chart,
+			Path:   "image.registry",
+			Reason: "Policy restricts image registries; mirror the chart images to an allowed registry",
+		})
+	}
+	if latestTagPattern.MatchString(message) {
+		adjustments = append(adjustments, PlanAdjustment{
+			Chart:  chart,
+			Path:   "image.tag",
+			Reason: "Policy forbids the latest tag; pin an explicit image version",
+		})
+	}
+
+	if len(adjustments) == 0 {
+		adjustments = append(adjustments, PlanAdjustment{
+			Chart:  chart,
+			Reason: fmt.Sprintf("Rejected by admission webhook: %s", message),
+		})
+	}
+
+	return adjustments
+}
+
+// dedupeAdjustments removes repeated chart/path pairs while keeping order
+func dedupeAdjustments(adjustments []PlanAdjustment) []PlanAdjustment {
+	seen := make(map[string]bool)
+	unique := make([]PlanAdjustment, 0, len(adjustments))
+	for _, adjustment := range adjustments {
+		key := adjustment.Chart + "|" + adjustment.Path + "|" + adjustment.Reason
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, adjustment)
+	}
+	return unique
+}
+
+// valuesAtPath builds a nested values map that sets a dotted path to a value
+func valuesAtPath(path string, value interface{}) map[string]interface{} {
+	keys := strings.Split(path, ".")
+	root := make(map[string]interface{})
+	current := root
+	for i, key := range keys {
+		if i == len(keys)-1 {
+			current[key] = copyValue(value)
+			break
+		}
+		next := make(map[string]interface{})
+		current[key] = next
+		current = next
+	}
+	return root
+}
+
+// copyValue deep-copies nested values so merged charts never share maps or slices
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	default:
+		return v
+	}
+}
+
+// sanitizeName converts an arbitrary chart name into a DNS-1123 compatible name
+func sanitizeName(name string) string {
+	name = strings.ToLower(name)
+	var b strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	sanitized := strings.Trim(b.String(), "-")
+	if len(sanitized) > 40 {
+		sanitized = strings.TrimRight(sanitized[:40], "-")
+	}
+	if sanitized == "" {
+		return "chart"
+	}
+	return sanitized
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// defaultStorageClassAnnotation marks the storage class of claims that name none
+const defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+// ClusterReadiness reports whether a cluster has what a plan needs: room for
+// its requests, its storage classes and CRDs, and the permissions to create
+// its objects. Failures lists every check that failed.
+type ClusterReadiness struct {
+	// Credential is what the kubeconfig may do in every namespace
+	Credential     *agent.CredentialPermissions `json:"credential,omitempty"`
+	Capacity       CapacityCheck                `json:"capacity"`
+	StorageClasses []StorageClassCheck          `json:"storage_classes"`
+	CRDs           []CRDCheck                   `json:"crds"`
+	Permissions    []PermissionCheck            `json:"permissions"`
+	Failures       []string                     `json:"failures"`
+}
+
+// Passed reports whether every readiness check passed
+func (r *ClusterReadiness) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// CapacityCheck compares the plan's resource impact with the CPU and memory
+// the cluster's schedulable nodes have left after the requests of their pods
+type CapacityCheck struct {
+	RequestedCPU    string `json:"requested_cpu"`
+	RequestedMemory string `json:"requested_memory"`
+	AvailableCPU    string `json:"available_cpu"`
+	AvailableMemory string `json:"available_memory"`
+	Sufficient      bool   `json:"sufficient"`
+	Message         string `json:"message,omitempty"`
+}
+
+// StorageClassCheck is a storage class the plan's volume claims use. An empty
+// name stands for the cluster's default class.
+type StorageClassCheck struct {
+	Name      string   `json:"name"`
+	Steps     []string `json:"steps"`
+	Available bool     `json:"available"`
+}
+
+// CRDCheck is a kind the plan creates objects of that the cluster doesn't
+// serve yet, or whose CRD the plan installs
+type CRDCheck struct {
+	Group   string   `json:"group"`
+	Version string   `json:"version"`
+	Kind    string   `json:"kind"`
+	Steps   []string `json:"steps"`
+	// Installed is set when the cluster serves the kind, ProvidedByPlan when a
+	// step of the plan installs its CRD
+	Installed      bool `json:"installed"`
+	ProvidedByPlan bool `json:"provided_by_plan"`
+}
+
+// PermissionCheck is an action the kubeconfig must be allowed to deploy the plan
+type PermissionCheck struct {
+	Verb      string `json:"verb"`
+	Group     string `json:"group,omitempty"`
+	Resource  string `json:"resource"`
+	Namespace string `json:"namespace,omitempty"`
+	Allowed   bool   `json:"allowed"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// stepObjects are the objects a plan step creates
+type stepObjects struct {
+	name      string
+	namespace string
+	upgrade   bool
+	chart     bool
+	objects   []*unstructured.Unstructured
+}
+
+// crdNames is what a CRD in the plan defines
+type crdNames struct {
+	plural     string
+	namespaced bool
+}
+
+// CheckClusterReadiness renders every step of the plan and checks the cluster
+// can take it, so a deployment fails before its first step instead of midway.
+// A kubeconfig that may not install charts in the plan's namespaces fails
+// before the other checks run.
+func (s *PreflightService) CheckClusterReadiness(ctx context.Context, client *kubernetes.KubernetesClient, plan *agent.DeploymentPlan) (*ClusterReadiness, error) {
+	readiness := &ClusterReadiness{
+		StorageClasses: []StorageClassCheck{},
+		CRDs:           []CRDCheck{},
+		Permissions:    []PermissionCheck{},
+		Failures:       []string{},
+	}
+	if passed, err := checkCredential(ctx, client, plan, readiness); err != nil || !passed {
+		return readiness, err
+	}
+
+	var steps []stepObjects
+	for _, step := range plan.Steps {
+		entry := stepObjects{name: step.Name, namespace: step.Namespace, upgrade: step.Action == "upgrade"}
+		var manifest string
+		switch {
+		case step.Chart != nil:
+			entry.chart = true
+			entry.namespace = step.Chart.Namespace
+			if entry.namespace == "" {
+				entry.namespace = "default"
+			}
+			rendered, err := s.deploymentExecutor.RenderChartWithCRDs(ctx, step.Chart, entry.namespace)
+			if err != nil {
+				readiness.Failures = append(readiness.Failures, fmt.Sprintf("%s: %v", step.Name, err))
+				continue
+			}
+			manifest = rendered
+		case step.Manifest != "":
+			if entry.namespace == "" {
+				entry.namespace = "default"
+			}
+			manifest = step.Manifest
+		default:
+			continue
+		}
+		objects, err := kubernetes.ParseManifest(manifest)
+		if err != nil {
+			readiness.Failures = append(readiness.Failures, fmt.Sprintf("%s: failed to parse manifests: %v", step.Name, err))
+			continue
+		}
+		entry.objects = objects
+		steps = append(steps, entry)
+	}
+
+	if upgradesOnly(plan) {
+		readiness.Capacity = CapacityCheck{Sufficient: true, Message: "Skipped: the plan upgrades releases that already hold their resources"}
+	} else if err := s.checkCapacity(ctx, client, plan.ResourceImpact, readiness); err != nil {
+		return nil, err
+	}
+	if err := checkStorageClasses(ctx, client, steps, readiness); err != nil {
+		return nil, err
+	}
+	crds := checkCRDs(client, steps, readiness)
+	if err := checkPermissions(ctx, client, steps, crds, readiness); err != nil {
+		return nil, err
+	}
+	return readiness, nil
+}
+
+// checkCapacity compares the plan's CPU and memory with what the Ready,
+// schedulable nodes have left. The total may still be split across nodes too
+// small for a single pod.
+func (s *PreflightService) checkCapacity(ctx context.Context, client *kubernetes.KubernetesClient, impact agent.ResourceImpact, readiness *ClusterReadiness) error {
+	check := &readiness.Capacity
+	check.RequestedCPU, check.RequestedMemory = impact.CPU, impact.Memory
+	check.Sufficient = true
+
+	nodes, err := client.ListNodes(ctx)
+	if err != nil {
+		return err
+	}
+	pods, err := client.ListPods(ctx, "", "")
+	if err != nil {
+		return err
+	}
+
+	available := corev1.ResourceList{}
+	schedulable := make(map[string]bool)
+	for i := range nodes {
+		node := &nodes[i]
+		if ready, _ := nodeReady(node); node.Spec.Unschedulable || !ready {
+			continue
+		}
+		schedulable[node.Name] = true
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if quantity, ok := node.Status.Allocatable[name]; ok {
+				addQuantity(available, name, quantity, 1)
+			}
+		}
+	}
+	for _, pod := range pods {
+		if !schedulable[pod.Spec.NodeName] || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		for name, quantity := range corePodRequests(pod.Spec) {
+			if current, ok := available[name]; ok {
+				current.Sub(quantity)
+				available[name] = current
+			}
+		}
+	}
+	cpu, memory := available[corev1.ResourceCPU], available[corev1.ResourceMemory]
+	check.AvailableCPU, check.AvailableMemory = cpu.String(), memory.String()
+
+	var short []string
+	for _, requested := range []struct {
+		name      string
+		value     string
+		available resource.Quantity
+	}{{"CPU", impact.CPU, cpu}, {"memory", impact.Memory, memory}} {
+		if requested.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(requested.value)
+		if err != nil {
+			check.Message = fmt.Sprintf("the plan's %s impact %q is not a quantity", requested.name, requested.value)
+			continue
+		}
+		if quantity.Cmp(requested.available) > 0 {
+			short = append(short, fmt.Sprintf("%s %s requested, %s available", requested.name, requested.value, requested.available.String()))
+		}
+	}
+	if len(short) > 0 {
+		check.Sufficient = false
+		check.Message = "Not enough room on schedulable nodes: " + strings.Join(short, "; ")
+		readiness.Failures = append(readiness.Failures, check.Message)
+	}
+	return nil
+}
+
+// checkStorageClasses checks that the storage classes of the plan's volume
+// claims exist, and that there is a default class for claims naming none
+func checkStorageClasses(ctx context.Context, client *kubernetes.KubernetesClient, steps []stepObjects, readiness *ClusterReadiness) error {
+	used := make(map[string][]string)
+	var names []string
+	use := func(claim map[string]interface{}, step string) {
+		class, _, _ := unstructured.NestedString(claim, "spec", "storageClassName")
+		if _, ok := used[class]; !ok {
+			names = append(names, class)
+		}
+		if steps := used[class]; len(steps) == 0 || steps[len(steps)-1] != step {
+			used[class] = append(steps, step)
+		}
+	}
+	for _, step := range steps {
+		for _, obj := range step.objects {
+			switch obj.GetKind() {
+			case "PersistentVolumeClaim":
+				use(obj.Object, step.name)
+			case "StatefulSet":
+				templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+				for _, item := range templates {
+					if template, ok := item.(map[string]interface{}); ok {
+						use(template, step.name)
+					}
+				}
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	classes, err := client.ListStorageClasses(ctx)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	hasDefault := false
+	for _, class := range classes {
+		existing[class.Name] = true
+		if class.Annotations[defaultStorageClassAnnotation] == "true" {
+			hasDefault = true
+		}
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		check := StorageClassCheck{Name: name, Steps: used[name], Available: existing[name]}
+		if name == "" {
+			check.Available = hasDefault
+		}
+		readiness.StorageClasses = append(readiness.StorageClasses, check)
+		switch {
+		case check.Available:
+		case name == "":
+			readiness.Failures = append(readiness.Failures, fmt.Sprintf("Volume claims of %s use the default storage class, but the cluster has none", strings.Join(check.Steps, ", ")))
+		default:
+			readiness.Failures = append(readiness.Failures, fmt.Sprintf("Storage class %s used by %s does not exist", name, strings.Join(check.Steps, ", ")))
+		}
+	}
+	return nil
+}
+
+// checkCRDs checks that the cluster serves every kind the plan creates, or
+// that a step of the plan installs its CRD. It returns the CRDs the plan installs.
+func checkCRDs(client *kubernetes.KubernetesClient, steps []stepObjects, readiness *ClusterReadiness) map[schema.GroupKind]crdNames {
+	provided := make(map[schema.GroupKind]crdNames)
+	for _, step := range steps {
+		for _, obj := range step.objects {
+			if obj.GetKind() != "CustomResourceDefinition" {
+				continue
+			}
+			group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+			kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+			plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+			scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+			provided[schema.GroupKind{Group: group, Kind: kind}] = crdNames{plural: plural, namespaced: scope != "Cluster"}
+		}
+	}
+
+	checks := make(map[schema.GroupVersionKind]*CRDCheck)
+	var order []schema.GroupVersionKind
+	for _, step := range steps {
+		for _, obj := range step.objects {
+			gvk := obj.GroupVersionKind()
+			check, ok := checks[gvk]
+			if !ok {
+				_, _, err := client.ResourceMapping(gvk)
+				_, planned := provided[gvk.GroupKind()]
+				if err == nil && !planned {
+					continue
+				}
+				check = &CRDCheck{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind, Installed: err == nil, ProvidedByPlan: planned}
+				checks[gvk] = check
+				order = append(order, gvk)
+			}
+			if len(check.Steps) == 0 || check.Steps[len(check.Steps)-1] != step.name {
+				check.Steps = append(check.Steps, step.name)
+			}
+		}
+	}
+
+	for _, gvk := range order {
+		check := checks[gvk]
+		readiness.CRDs = append(readiness.CRDs, *check)
+		if !check.Installed && !check.ProvidedByPlan {
+			readiness.Failures = append(readiness.Failures, fmt.Sprintf("The cluster does not serve %s, needed by %s; install its CRD first", gvk.String(), strings.Join(check.Steps, ", ")))
+		}
+	}
+	return provided
+}
+
+// checkPermissions asks the API server whether the kubeconfig may create each
+// kind of object in each namespace the plan deploys to, patch them for
+// upgrades, store Helm releases and create missing namespaces
+func checkPermissions(ctx context.Context, client *kubernetes.KubernetesClient, steps []stepObjects, crds map[schema.GroupKind]crdNames, readiness *ClusterReadiness) error {
+	seen := make(map[authorizationv1.ResourceAttributes]bool)
+	var required []authorizationv1.ResourceAttributes
+	require := func(attributes authorizationv1.ResourceAttributes) {
+		if !seen[attributes] {
+			seen[attributes] = true
+			required = append(required, attributes)
+		}
+	}
+
+	namespaces := make(map[string]bool)
+	for _, step := range steps {
+		verb := "create"
+		if step.upgrade {
+			verb = "patch"
+		}
+		if step.chart {
+			// Helm stores each release revision as a secret of its namespace
+			require(authorizationv1.ResourceAttributes{Verb: "create", Resource: "secrets", Namespace: step.namespace})
+		}
+		for _, obj := range step.objects {
+			gvk := obj.GroupVersionKind()
+			resourceName, namespaced, err := client.ResourceMapping(gvk)
+			if err != nil {
+				names, ok := crds[gvk.GroupKind()]
+				if !ok {
+					continue // reported by the CRD check
+				}
+				resourceName, namespaced = names.plural, names.namespaced
+			}
+			attributes := authorizationv1.ResourceAttributes{Verb: verb, Group: gvk.Group, Resource: resourceName}
+			if namespaced {
+				attributes.Namespace = obj.GetNamespace()
+				if attributes.Namespace == "" {
+					attributes.Namespace = step.namespace
+				}
+				namespaces[attributes.Namespace] = true
+			}
+			require(attributes)
+		}
+		namespaces[step.namespace] = true
+	}
+
+	var names []string
+	for namespace := range namespaces {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+	for _, namespace := range names {
+		exists, err := client.NamespaceExists(ctx, namespace)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			require(authorizationv1.ResourceAttributes{Verb: "create", Resource: "namespaces"})
+			break
+		}
+	}
+
+	for _, attributes := range required {
+		allowed, reason, err := client.CanI(ctx, attributes)
+		if err != nil {
+			return err
+		}
+		readiness.Permissions = append(readiness.Permissions, PermissionCheck{
+			Verb:      attributes.Verb,
+			Group:     attributes.Group,
+			Resource:  attributes.Resource,
+			Namespace: attributes.Namespace,
+			Allowed:   allowed,
+			Reason:    reason,
+		})
+		if !allowed {
+			target := attributes.Resource
+			if attributes.Group != "" {
+				target += "." + attributes.Group
+			}
+			if attributes.Namespace != "" {
+				target += " in namespace " + attributes.Namespace
+			}
+			readiness.Failures = append(readiness.Failures, fmt.Sprintf("The kubeconfig may not %s %s", attributes.Verb, target))
+		}
+	}
+	return nil
+}
+
+// upgradesOnly reports whether every chart step of a plan upgrades a release
+func upgradesOnly(plan *agent.DeploymentPlan) bool {
+	charts := 0
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		if step.Action != "upgrade" {
+			return false
+		}
+		charts++
+	}
+	return charts > 0
+}
+
+// corePodRequests returns the requests a pod is scheduled with: the sum of its
+// containers, or its largest init container if that is more
+func corePodRequests(spec corev1.PodSpec) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, container := range spec.Containers {
+		for name, quantity := range container.Resources.Requests {
+			addQuantity(requests, name, quantity, 1)
+		}
+	}
+	for _, container := range spec.InitContainers {
+		for name, quantity := range container.Resources.Requests {
+			if current := requests[name]; quantity.Cmp(current) > 0 {
+				requests[name] = quantity
+			}
+		}
+	}
+	return requests
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ArchitectureCompatibility reports whether chart images run on the cluster's node platforms
+type ArchitectureCompatibility struct {
+	NodePlatforms map[string]int       `json:"node_platforms"`
+	Images        []ImagePlatformCheck `json:"images"`
+	Adjustments   []PlanAdjustment     `json:"adjustments"`
+}
+
+// ImagePlatformCheck compares the platforms an image publishes with the cluster's nodes
+type ImagePlatformCheck struct {
+	Chart     string   `json:"chart"`
+	Image     string   `json:"image,omitempty"`
+	Platforms []string `json:"platforms"`
+	// Missing lists node platforms the image has no manifest for
+	Missing []string `json:"missing"`
+	// Error is set when the image could not be inspected, so it is unverified
+	Error string `json:"error,omitempty"`
+}
+
+// CheckArchitectureCompatibility renders every chart, inspects the manifests of
+// the images it uses, and pins charts to nodes their images can run on
+func (s *PreflightService) CheckArchitectureCompatibility(ctx context.Context, client *kubernetes.KubernetesClient, plan *agent.DeploymentPlan) (*ArchitectureCompatibility, error) {
+	nodePlatforms, err := client.NodePlatforms()
+	if err != nil {
+		return nil, err
+	}
+
+	compatibility := &ArchitectureCompatibility{
+		NodePlatforms: nodePlatforms,
+		Images:        []ImagePlatformCheck{},
+		Adjustments:   []PlanAdjustment{},
+	}
+
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+
+		manifest, err := s.deploymentExecutor.RenderChart(ctx, step.Chart, "default")
+		if err != nil {
+			compatibility.Images = append(compatibility.Images, ImagePlatformCheck{
+				Chart: step.Chart.Name,
+				Error: fmt.Sprintf("failed to render chart: %v", err),
+			})
+			continue
+		}
+		objects, err := kubernetes.ParseManifest(manifest)
+		if err != nil {
+			compatibility.Images = append(compatibility.Images, ImagePlatformCheck{
+				Chart: step.Chart.Name,
+				Error: fmt.Sprintf("failed to parse rendered chart: %v", err),
+			})
+			continue
+		}
+
+		// Node platforms every image of the chart supports
+		supportedByAll := make(map[string]bool)
+		for platform := range nodePlatforms {
+			supportedByAll[platform] = true
+		}
+		incompatible := false
+
+		for _, image := range workloadImages(objects) {
+			check := ImagePlatformCheck{Chart: step.Chart.Name, Image: image, Platforms: []string{}, Missing: []string{}}
+
+			platforms, err := s.imageInspector.Platforms(ctx, image)
+			if err != nil {
+				check.Error = err.Error()
+				compatibility.Images = append(compatibility.Images, check)
+				continue
+			}
+			check.Platforms = platforms
+
+			published := make(map[string]bool, len(platforms))
+			for _, platform := range platforms {
+				published[platform] = true
+			}
+			for platform := range nodePlatforms {
+				// Generated values keep components off Windows nodes
+				if strings.HasPrefix(platform, "windows/") {
+					continue
+				}
+				if !published[platform] {
+					check.Missing = append(check.Missing, platform)
+					supportedByAll[platform] = false
+					incompatible = true
+				}
+			}
+			sort.Strings(check.Missing)
+			compatibility.Images = append(compatibility.Images, check)
+		}
+
+		if incompatible {
+			compatibility.Adjustments = append(compatibility.Adjustments, platformAdjustment(step.Chart.Name, nodePlatforms, supportedByAll))
+		}
+	}
+
+	return compatibility, nil
+}
+
+// platformAdjustment pins a chart to the most common node platform all its images
+// support, or flags the chart when no such platform exists
+func platformAdjustment(chart string, nodePlatforms map[string]int, supportedByAll map[string]bool) PlanAdjustment {
+	best := ""
+	for platform, count := range nodePlatforms {
+		if strings.HasPrefix(platform, "windows/") {
+			continue
+		}
+		if supportedByAll[platform] && (best == "" || count > nodePlatforms[best]) {
+			best = platform
+		}
+	}
+
+	if best == "" {
+		return PlanAdjustment{
+			Chart:  chart,
+			Path:   "image",
+			Reason: "No node platform is supported by every image; use multi-arch images or add matching nodes",
+		}
+	}
+
+	osName, arch, _ := strings.Cut(best, "/")
+	return PlanAdjustment{
+		Chart: chart,
+		Path:  "nodeSelector",
+		Value: map[string]interface{}{
+			"kubernetes.io/os":   osName,
+			"kubernetes.io/arch": arch,
+		},
+		Automatic: true,
+		Reason:    fmt.Sprintf("Some images do not publish every node platform; schedule on %s nodes only", best),
+	}
+}
+
+// podSpecPaths locates the pod spec within each workload kind
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// workloadImages returns the distinct container images used by rendered workloads
+func workloadImages(objects []*unstructured.Unstructured) []string {
+	seen := make(map[string]bool)
+	var images []string
+
+	for _, obj := range objects {
+		path, ok := podSpecPaths[obj.GetKind()]
+		if !ok {
+			continue
+		}
+		podSpec, found, _ := unstructured.NestedMap(obj.Object, path...)
+		if !found {
+			continue
+		}
+
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, _, _ := unstructured.NestedSlice(podSpec, field)
+			for _, item := range containers {
+				container, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				if image, _ := container["image"].(string); image != "" && !seen[image] {
+					seen[image] = true
+					images = append(images, image)
+				}
+			}
+		}
+	}
+
+	return images
+}
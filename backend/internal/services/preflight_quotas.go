@@ -0,0 +1,776 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// namespaceAdjustmentPath marks adjustments that move a chart to another
+// namespace instead of changing its values
+const namespaceAdjustmentPath = "namespace"
+
+// replicaValueKeys are the values charts commonly read their replica count from
+var replicaValueKeys = []string{"replicaCount", "replicas"}
+
+// QuotaCompatibility reports whether the plan fits the ResourceQuotas of the
+// namespaces it deploys to
+type QuotaCompatibility struct {
+	Namespaces  []NamespaceQuotaCheck `json:"namespaces"`
+	Adjustments []PlanAdjustment      `json:"adjustments"`
+}
+
+// NamespaceQuotaCheck compares what the plan adds to a namespace with the room
+// its quotas leave
+type NamespaceQuotaCheck struct {
+	Namespace string   `json:"namespace"`
+	Steps     []string `json:"steps"`
+	// Requested and Available are keyed by quota resource, e.g. requests.cpu
+	Requested  map[string]string `json:"requested"`
+	Available  map[string]string `json:"available"`
+	Shortfalls []QuotaShortfall  `json:"shortfalls"`
+	// Resolved is set when the proposed adjustments make the plan fit
+	Resolved bool `json:"resolved"`
+	// Unverified lists steps that could not be rendered, so they are not counted
+	Unverified []string `json:"unverified,omitempty"`
+}
+
+// QuotaShortfall is a quota resource the plan would exceed
+type QuotaShortfall struct {
+	Quota     string `json:"quota"`
+	Resource  string `json:"resource"`
+	Requested string `json:"requested,omitempty"`
+	Available string `json:"available,omitempty"`
+	Missing   string `json:"missing,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// String describes the shortfall for adjustment reasons
+func (s QuotaShortfall) String() string {
+	if s.Reason != "" {
+		return s.Reason
+	}
+	return fmt.Sprintf("quota %s leaves %s of %s but the plan needs %s", s.Quota, s.Available, s.Resource, s.Requested)
+}
+
+// quotaRoom is what the quotas of a namespace still allow
+type quotaRoom struct {
+	available map[corev1.ResourceName]resource.Quantity
+	// quotas names the quota leaving the least room for each resource
+	quotas   map[corev1.ResourceName]string
+	defaults containerDefaults
+}
+
+// containerDefaults are the requests and limits LimitRanges give containers
+// that set none
+type containerDefaults struct {
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+}
+
+// quotaUsage is what a step adds to the quota usage of its namespace
+type quotaUsage struct {
+	name      string
+	chart     *agent.HelmChart // nil for manifest steps
+	resources corev1.ResourceList
+	// unset lists the compute resources some container specifies no value for
+	unset map[corev1.ResourceName]bool
+}
+
+// CheckQuotaCompatibility sums what every step adds to the ResourceQuotas of its
+// namespace and, where a namespace would run out, proposes adjustments that make
+// the plan fit instead of leaving pods Pending after install. Values the policy
+// sets are never adjusted.
+func (s *PreflightService) CheckQuotaCompatibility(ctx context.Context, client *kubernetes.KubernetesClient, plan *agent.DeploymentPlan, policy *ValuePolicy) (*QuotaCompatibility, error) {
+	nodePlatforms, err := client.NodePlatforms()
+	if err != nil {
+		return nil, err
+	}
+	// DaemonSets run a pod per node; generated values keep them off Windows nodes
+	var nodes int64
+	for platform, count := range nodePlatforms {
+		if !strings.HasPrefix(platform, "windows/") {
+			nodes += int64(count)
+		}
+	}
+
+	compatibility := &QuotaCompatibility{
+		Namespaces:  []NamespaceQuotaCheck{},
+		Adjustments: []PlanAdjustment{},
+	}
+
+	rooms := make(map[string]*quotaRoom)
+	usages := make(map[string][]*quotaUsage)
+	unverified := make(map[string][]string)
+	var namespaces []string
+
+	for _, step := range plan.Steps {
+		namespace := step.Namespace
+		if step.Chart != nil {
+			namespace = step.Chart.Namespace
+		} else if step.Manifest == "" {
+			continue
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		room, ok := rooms[namespace]
+		if !ok {
+			room, err = namespaceQuotaRoom(ctx, client, namespace)
+			if err != nil {
+				return nil, err
+			}
+			rooms[namespace] = room
+			namespaces = append(namespaces, namespace)
+		}
+		// Namespaces without quotas have nothing to exceed
+		if len(room.available) == 0 {
+			continue
+		}
+
+		usage := &quotaUsage{name: step.Name, chart: step.Chart}
+		if step.Chart != nil {
+			usage.name = step.Chart.Name
+			usage.resources, usage.unset, err = s.chartQuotaUsage(ctx, client, step.Chart, namespace, room.defaults, nodes)
+		} else {
+			var objects []*unstructured.Unstructured
+			if objects, err = kubernetes.ParseManifest(step.Manifest); err == nil {
+				usage.resources, usage.unset = objectsQuotaUsage(client, objects, namespace, room.defaults, nodes)
+			}
+		}
+		if err != nil {
+			unverified[namespace] = append(unverified[namespace], fmt.Sprintf("%s: %v", usage.name, err))
+			continue
+		}
+		usages[namespace] = append(usages[namespace], usage)
+	}
+
+	for _, namespace := range namespaces {
+		room := rooms[namespace]
+		if len(room.available) == 0 {
+			continue
+		}
+
+		check := namespaceQuotaCheck(namespace, room, usages[namespace])
+		check.Unverified = unverified[namespace]
+		if len(check.Shortfalls) > 0 {
+			adjustments, resolved := s.resolveQuotaShortfalls(ctx, client, namespace, room, usages[namespace], policy, nodes)
+			check.Resolved = resolved
+			compatibility.Adjustments = append(compatibility.Adjustments, adjustments...)
+		}
+		compatibility.Namespaces = append(compatibility.Namespaces, check)
+	}
+
+	return compatibility, nil
+}
+
+// resolveQuotaShortfalls proposes adjustments until the steps of a namespace fit
+// its quotas, least disruptive first: set requests the quota requires, lower
+// limits to requests, run fewer replicas, and last move charts to a namespace of
+// their own. It reports whether the adjustments make everything fit.
+func (s *PreflightService) resolveQuotaShortfalls(ctx context.Context, client *kubernetes.KubernetesClient, namespace string, room *quotaRoom, usages []*quotaUsage, policy *ValuePolicy, nodes int64) ([]PlanAdjustment, bool) {
+	// Adjust copies so the plan only changes when the adjustments are applied
+	current := make([]*quotaUsage, len(usages))
+	for i, usage := range usages {
+		copied := *usage
+		if usage.chart != nil {
+			chart := *usage.chart
+			chart.Values, _ = copyValue(usage.chart.Values).(map[string]interface{})
+			copied.chart = &chart
+		}
+		current[i] = &copied
+	}
+	adjustments := make([][]PlanAdjustment, len(usages))
+	moved := make([]bool, len(usages))
+
+	remaining := func() []*quotaUsage {
+		var staying []*quotaUsage
+		for i, usage := range current {
+			if !moved[i] {
+				staying = append(staying, usage)
+			}
+		}
+		return staying
+	}
+	shortfalls := func() []QuotaShortfall {
+		return quotaShortfalls(room, remaining())
+	}
+
+	// try re-renders a chart with a values change and keeps the change when
+	// accept approves of the new usage
+	try := func(i int, path string, value interface{}, reason string, accept func(next *quotaUsage) bool) bool {
+		chart := *current[i].chart
+		chart.Values, _ = copyValue(current[i].chart.Values).(map[string]interface{})
+		if chart.Values == nil {
+			chart.Values = make(map[string]interface{})
+		}
+		s.helmService.mergeValues(chart.Values, valuesAtPath(path, value))
+
+		next := &quotaUsage{name: current[i].name, chart: &chart}
+		var err error
+		next.resources, next.unset, err = s.chartQuotaUsage(ctx, client, &chart, namespace, room.defaults, nodes)
+		if err != nil || !accept(next) {
+			return false
+		}
+		current[i] = next
+		adjustments[i] = append(adjustments[i], PlanAdjustment{Chart: chart.Name, Path: path, Value: value, Automatic: true, Reason: reason})
+		return true
+	}
+
+	// Containers without requests are rejected outright by quotas on requests
+	for i, usage := range current {
+		if usage.chart == nil {
+			continue
+		}
+		for _, kind := range []string{"requests", "limits"} {
+			missing := false
+			for name := range usage.unset {
+				if _, tracked := room.available[name]; tracked && strings.HasPrefix(string(name), kind+".") {
+					missing = true
+				}
+			}
+			if !missing || policyPins(policy, usage.chart.Name, "resources."+kind) {
+				continue
+			}
+			value := resourceValues(defaultContainerResources.requests)
+			if kind == "limits" {
+				value = resourceValues(defaultContainerResources.limits)
+			}
+			reason := fmt.Sprintf("Quotas in %s require every container to set resource %s", namespace, kind)
+			try(i, "resources."+kind, value, reason, func(*quotaUsage) bool { return true })
+		}
+	}
+
+	reduces := func(i int) func(next *quotaUsage) bool {
+		return func(next *quotaUsage) bool {
+			return usageReduced(room, current[i].resources, next.resources)
+		}
+	}
+
+	// Lower limits to the requests when limits run out
+	for i, usage := range current {
+		missing := shortfalls()
+		if len(missing) == 0 || !limitsShort(missing) {
+			break
+		}
+		if usage.chart == nil || policyPins(policy, usage.chart.Name, "resources.limits") {
+			continue
+		}
+		requests, found, _ := unstructured.NestedMap(usage.chart.Values, "resources", "requests")
+		if !found || len(requests) == 0 {
+			continue
+		}
+		reason := fmt.Sprintf("In %s, %s; lower limits to the requests", namespace, missing[0])
+		try(i, "resources.limits", requests, reason, reduces(i))
+	}
+
+	// Run fewer replicas, down to one
+	for i := range current {
+		if current[i].chart == nil {
+			continue
+		}
+		key, replicas, ok := chartReplicas(current[i].chart.Values)
+		if !ok || policyPins(policy, current[i].chart.Name, key) {
+			continue
+		}
+		for count := replicas - 1; count >= 1; count-- {
+			missing := shortfalls()
+			if len(missing) == 0 {
+				break
+			}
+			reason := fmt.Sprintf("In %s, %s; run %d replicas instead of %d", namespace, missing[0], count, replicas)
+			if !try(i, key, count, reason, reduces(i)) {
+				break
+			}
+		}
+	}
+
+	// Move the charts using most of what runs out to namespaces of their own
+	var moves []PlanAdjustment
+	unmovable := make(map[int]bool)
+	for {
+		missing := shortfalls()
+		if len(missing) == 0 {
+			break
+		}
+		resourceName := corev1.ResourceName(missing[0].Resource)
+
+		candidate := -1
+		var largest resource.Quantity
+		for i, usage := range usages {
+			if moved[i] || unmovable[i] || usage.chart == nil {
+				continue
+			}
+			if used := usage.resources[resourceName]; candidate == -1 || used.Cmp(largest) > 0 {
+				candidate, largest = i, used
+			}
+		}
+		if candidate == -1 {
+			break
+		}
+
+		// The chart moves with its original values, unaffected by the reductions above
+		chart := usages[candidate].chart
+		target := sanitizeName(namespace + "-" + chart.Name)
+		if !s.fitsNamespace(ctx, client, chart, target, nodes) {
+			unmovable[candidate] = true
+			continue
+		}
+		moved[candidate] = true
+		adjustments[candidate] = nil
+		moves = append(moves, PlanAdjustment{
+			Chart:     chart.Name,
+			Path:      namespaceAdjustmentPath,
+			Value:     target,
+			Automatic: true,
+			Reason: fmt.Sprintf("In %s, %s; install %s in namespace %s instead. Other charts reaching its services must use the new namespace",
+				namespace, missing[0], chart.Name, target),
+		})
+	}
+
+	var proposed []PlanAdjustment
+	for _, chartAdjustments := range adjustments {
+		proposed = append(proposed, chartAdjustments...)
+	}
+	proposed = append(proposed, moves...)
+	return proposed, len(shortfalls()) == 0
+}
+
+// fitsNamespace reports whether a chart fits the quotas of another namespace,
+// which fits when the namespace doesn't exist yet
+func (s *PreflightService) fitsNamespace(ctx context.Context, client *kubernetes.KubernetesClient, chart *agent.HelmChart, namespace string, nodes int64) bool {
+	room, err := namespaceQuotaRoom(ctx, client, namespace)
+	if err != nil {
+		return false
+	}
+	if len(room.available) == 0 {
+		return true
+	}
+	resources, unset, err := s.chartQuotaUsage(ctx, client, chart, namespace, room.defaults, nodes)
+	if err != nil {
+		return false
+	}
+	return len(quotaShortfalls(room, []*quotaUsage{{name: chart.Name, chart: chart, resources: resources, unset: unset}})) == 0
+}
+
+// chartQuotaUsage renders a chart into a namespace and sums what it adds to the
+// namespace's quota usage
+func (s *PreflightService) chartQuotaUsage(ctx context.Context, client *kubernetes.KubernetesClient, chart *agent.HelmChart, namespace string, defaults containerDefaults, nodes int64) (corev1.ResourceList, map[corev1.ResourceName]bool, error) {
+	manifest, err := s.deploymentExecutor.RenderChart(ctx, chart, namespace)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to render chart: %w", err)
+	}
+	objects, err := kubernetes.ParseManifest(manifest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse rendered chart: %w", err)
+	}
+
+	resources, unset := objectsQuotaUsage(client, objects, namespace, defaults, nodes)
+	// helm stores the release in a secret of its namespace
+	addQuantity(resources, corev1.ResourceSecrets, *resource.NewQuantity(1, resource.DecimalSI), 1)
+	return resources, unset, nil
+}
+
+// namespaceQuotaRoom reads how much the quotas of a namespace still allow, and
+// the container defaults of its LimitRanges
+func namespaceQuotaRoom(ctx context.Context, client *kubernetes.KubernetesClient, namespace string) (*quotaRoom, error) {
+	quotas, err := client.ListResourceQuotas(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	room := &quotaRoom{
+		available: make(map[corev1.ResourceName]resource.Quantity),
+		quotas:    make(map[corev1.ResourceName]string),
+		defaults:  containerDefaults{requests: corev1.ResourceList{}, limits: corev1.ResourceList{}},
+	}
+	for _, quota := range quotas {
+		// Scoped quotas only count some pods, e.g. BestEffort or by priority class
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		for name, hard := range quota.Spec.Hard {
+			left := hard.DeepCopy()
+			left.Sub(quota.Status.Used[name])
+			name = normalizeQuotaResource(name)
+			if available, ok := room.available[name]; !ok || left.Cmp(available) < 0 {
+				room.available[name] = left
+				room.quotas[name] = quota.Name
+			}
+		}
+	}
+	if len(room.available) == 0 {
+		return room, nil
+	}
+
+	limitRanges, err := client.ListLimitRanges(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, limitRange := range limitRanges {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for name, quantity := range item.DefaultRequest {
+				room.defaults.requests[name] = quantity
+			}
+			for name, quantity := range item.Default {
+				room.defaults.limits[name] = quantity
+			}
+		}
+	}
+	return room, nil
+}
+
+// normalizeQuotaResource maps quota resource names with the same meaning to one
+// name: cpu and memory are requests, count/<core resource> is the resource
+func normalizeQuotaResource(name corev1.ResourceName) corev1.ResourceName {
+	switch name {
+	case corev1.ResourceCPU:
+		return corev1.ResourceRequestsCPU
+	case corev1.ResourceMemory:
+		return corev1.ResourceRequestsMemory
+	}
+	if counted, ok := strings.CutPrefix(string(name), "count/"); ok && !strings.Contains(counted, ".") {
+		return corev1.ResourceName(counted)
+	}
+	return name
+}
+
+// objectsQuotaUsage sums what objects add to the quota usage of a namespace:
+// pod compute resources times replicas, pods, storage and object counts.
+// Objects explicitly in another namespace are skipped.
+func objectsQuotaUsage(client *kubernetes.KubernetesClient, objects []*unstructured.Unstructured, namespace string, defaults containerDefaults, nodes int64) (corev1.ResourceList, map[corev1.ResourceName]bool) {
+	usage := corev1.ResourceList{}
+	unset := make(map[corev1.ResourceName]bool)
+	one := *resource.NewQuantity(1, resource.DecimalSI)
+
+	for _, obj := range objects {
+		if obj.GetNamespace() != "" && obj.GetNamespace() != namespace {
+			continue
+		}
+		kind := obj.GetKind()
+
+		if path, ok := podSpecPaths[kind]; ok {
+			if podSpec, found, _ := unstructured.NestedMap(obj.Object, path...); found {
+				pods := workloadPods(obj, nodes)
+				requests, limits := podResources(podSpec, defaults, unset)
+				addQuantity(usage, corev1.ResourcePods, one, pods)
+				for name, quantity := range requests {
+					addQuantity(usage, corev1.ResourceName("requests."+string(name)), quantity, pods)
+				}
+				for name, quantity := range limits {
+					addQuantity(usage, corev1.ResourceName("limits."+string(name)), quantity, pods)
+				}
+			}
+		}
+
+		switch kind {
+		case "PersistentVolumeClaim":
+			addClaimStorage(usage, obj.Object, 1)
+		case "StatefulSet":
+			templates, _, _ := unstructured.NestedSlice(obj.Object, "spec", "volumeClaimTemplates")
+			replicas := workloadPods(obj, nodes)
+			for _, item := range templates {
+				if template, ok := item.(map[string]interface{}); ok {
+					addClaimStorage(usage, template, replicas)
+					addQuantity(usage, corev1.ResourcePersistentVolumeClaims, one, replicas)
+				}
+			}
+		case "Service":
+			switch serviceType, _, _ := unstructured.NestedString(obj.Object, "spec", "type"); serviceType {
+			case string(corev1.ServiceTypeLoadBalancer):
+				addQuantity(usage, corev1.ResourceServicesLoadBalancers, one, 1)
+			case string(corev1.ServiceTypeNodePort):
+				addQuantity(usage, corev1.ResourceServicesNodePorts, one, 1)
+			}
+		}
+
+		// Pods are counted per replica above
+		if kind == "Pod" {
+			continue
+		}
+		if name := objectCountResource(client, obj); name != "" {
+			addQuantity(usage, name, one, 1)
+		}
+	}
+	return usage, unset
+}
+
+// objectCountResource is the quota resource counting objects of the object's
+// kind, or empty for kinds unknown to the cluster or not namespaced
+func objectCountResource(client *kubernetes.KubernetesClient, obj *unstructured.Unstructured) corev1.ResourceName {
+	gvk := obj.GroupVersionKind()
+	resourceName, namespaced, err := client.ResourceMapping(gvk)
+	if err != nil || !namespaced {
+		return ""
+	}
+	if gvk.Group == "" {
+		return corev1.ResourceName(resourceName)
+	}
+	return corev1.ResourceName("count/" + resourceName + "." + gvk.Group)
+}
+
+// workloadPods is the number of pods a workload runs
+func workloadPods(obj *unstructured.Unstructured, nodes int64) int64 {
+	var path []string
+	switch obj.GetKind() {
+	case "Pod":
+		return 1
+	case "DaemonSet":
+		return nodes
+	case "Job":
+		path = []string{"spec", "parallelism"}
+	case "CronJob":
+		path = []string{"spec", "jobTemplate", "spec", "parallelism"}
+	default:
+		path = []string{"spec", "replicas"}
+	}
+	value, found, _ := unstructured.NestedFieldNoCopy(obj.Object, path...)
+	if !found {
+		return 1
+	}
+	count, ok := toFloat(value)
+	if !ok || count < 0 {
+		return 1
+	}
+	return int64(count)
+}
+
+// podResources returns the requests and limits a pod counts against quotas:
+// the sum of its containers, or its largest init container if that is more.
+// Containers get LimitRange defaults, and requests default to limits, as the
+// API server does. Compute resources a container leaves unset are recorded.
+func podResources(podSpec map[string]interface{}, defaults containerDefaults, unset map[corev1.ResourceName]bool) (corev1.ResourceList, corev1.ResourceList) {
+	containerResources := func(item interface{}) (corev1.ResourceList, corev1.ResourceList) {
+		requests, limits := corev1.ResourceList{}, corev1.ResourceList{}
+		container, ok := item.(map[string]interface{})
+		if !ok {
+			return requests, limits
+		}
+		parse := func(list corev1.ResourceList, field string) {
+			values, _, _ := unstructured.NestedMap(container, "resources", field)
+			for name, value := range values {
+				if quantity, err := resource.ParseQuantity(fmt.Sprint(value)); err == nil {
+					list[corev1.ResourceName(name)] = quantity
+				}
+			}
+		}
+		parse(requests, "requests")
+		parse(limits, "limits")
+
+		for name, quantity := range defaults.limits {
+			if _, ok := limits[name]; !ok {
+				limits[name] = quantity
+			}
+		}
+		for name, quantity := range defaults.requests {
+			if _, ok := requests[name]; !ok {
+				requests[name] = quantity
+			}
+		}
+		for name, quantity := range limits {
+			if _, ok := requests[name]; !ok {
+				requests[name] = quantity
+			}
+		}
+
+		for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			if _, ok := requests[name]; !ok {
+				unset[corev1.ResourceName("requests."+string(name))] = true
+			}
+			if _, ok := limits[name]; !ok {
+				unset[corev1.ResourceName("limits."+string(name))] = true
+			}
+		}
+		return requests, limits
+	}
+
+	requests, limits := corev1.ResourceList{}, corev1.ResourceList{}
+	containers, _, _ := unstructured.NestedSlice(podSpec, "containers")
+	for _, item := range containers {
+		containerRequests, containerLimits := containerResources(item)
+		for name, quantity := range containerRequests {
+			addQuantity(requests, name, quantity, 1)
+		}
+		for name, quantity := range containerLimits {
+			addQuantity(limits, name, quantity, 1)
+		}
+	}
+
+	initContainers, _, _ := unstructured.NestedSlice(podSpec, "initContainers")
+	for _, item := range initContainers {
+		initRequests, initLimits := containerResources(item)
+		for name, quantity := range initRequests {
+			if current := requests[name]; quantity.Cmp(current) > 0 {
+				requests[name] = quantity
+			}
+		}
+		for name, quantity := range initLimits {
+			if current := limits[name]; quantity.Cmp(current) > 0 {
+				limits[name] = quantity
+			}
+		}
+	}
+	return requests, limits
+}
+
+// addClaimStorage adds the storage a PersistentVolumeClaim spec requests
+func addClaimStorage(usage corev1.ResourceList, claim map[string]interface{}, times int64) {
+	value, found, _ := unstructured.NestedFieldNoCopy(claim, "spec", "resources", "requests", "storage")
+	if !found {
+		return
+	}
+	if quantity, err := resource.ParseQuantity(fmt.Sprint(value)); err == nil {
+		addQuantity(usage, corev1.ResourceRequestsStorage, quantity, times)
+	}
+}
+
+// addQuantity adds a quantity times over to a resource of the list
+func addQuantity(list corev1.ResourceList, name corev1.ResourceName, quantity resource.Quantity, times int64) {
+	total := list[name].DeepCopy()
+	for i := int64(0); i < times; i++ {
+		total.Add(quantity)
+	}
+	list[name] = total
+}
+
+// namespaceQuotaCheck builds the report of a namespace's quotas
+func namespaceQuotaCheck(namespace string, room *quotaRoom, usages []*quotaUsage) NamespaceQuotaCheck {
+	check := NamespaceQuotaCheck{
+		Namespace:  namespace,
+		Steps:      []string{},
+		Requested:  make(map[string]string),
+		Available:  make(map[string]string),
+		Shortfalls: quotaShortfalls(room, usages),
+	}
+	for _, usage := range usages {
+		check.Steps = append(check.Steps, usage.name)
+	}
+
+	requested := totalQuotaUsage(usages)
+	for name, available := range room.available {
+		used := requested[name]
+		check.Requested[string(name)] = used.String()
+		check.Available[string(name)] = available.String()
+	}
+	return check
+}
+
+// quotaShortfalls lists the quota resources the steps need more of than the
+// namespace has left, and the required resources containers leave unset
+func quotaShortfalls(room *quotaRoom, usages []*quotaUsage) []QuotaShortfall {
+	shortfalls := []QuotaShortfall{}
+	requested := totalQuotaUsage(usages)
+	for _, name := range sortedResourceNames(room.available) {
+		available := room.available[name]
+		used := requested[name]
+		if used.Cmp(available) <= 0 {
+			continue
+		}
+		missing := used.DeepCopy()
+		missing.Sub(available)
+		shortfalls = append(shortfalls, QuotaShortfall{
+			Quota:     room.quotas[name],
+			Resource:  string(name),
+			Requested: used.String(),
+			Available: available.String(),
+			Missing:   missing.String(),
+		})
+	}
+
+	for _, usage := range usages {
+		for _, name := range sortedResourceNames(usage.unset) {
+			if _, tracked := room.available[name]; tracked {
+				shortfalls = append(shortfalls, QuotaShortfall{
+					Quota:    room.quotas[name],
+					Resource: string(name),
+					Reason:   fmt.Sprintf("%s has containers without %s, which quota %s requires", usage.name, name, room.quotas[name]),
+				})
+			}
+		}
+	}
+	return shortfalls
+}
+
+// totalQuotaUsage sums the usage of several steps
+func totalQuotaUsage(usages []*quotaUsage) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, usage := range usages {
+		for name, quantity := range usage.resources {
+			addQuantity(total, name, quantity, 1)
+		}
+	}
+	return total
+}
+
+// usageReduced reports whether next uses less of some resource the quotas track
+// and more of none
+func usageReduced(room *quotaRoom, previous, next corev1.ResourceList) bool {
+	reduced := false
+	for name := range room.available {
+		before, after := previous[name], next[name]
+		switch after.Cmp(before) {
+		case 1:
+			return false
+		case -1:
+			reduced = true
+		}
+	}
+	return reduced
+}
+
+// limitsShort reports whether the namespace runs out of some limit
+func limitsShort(shortfalls []QuotaShortfall) bool {
+	for _, shortfall := range shortfalls {
+		if strings.HasPrefix(shortfall.Resource, "limits.") && shortfall.Reason == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// chartReplicas reads the replica count from a chart's values
+func chartReplicas(values map[string]interface{}) (string, int, bool) {
+	for _, key := range replicaValueKeys {
+		if count, ok := toFloat(values[key]); ok && count > 1 {
+			return key, int(count), true
+		}
+	}
+	return "", 0, false
+}
+
+// policyPins reports whether the value policy sets a values path for a chart,
+// which the planner must then leave alone
+func policyPins(policy *ValuePolicy, chart, path string) bool {
+	if policy == nil {
+		return false
+	}
+	keys := strings.Split(path, ".")
+	for _, values := range []map[string]interface{}{policy.Values, policy.ChartValues[chart]} {
+		if _, found, _ := unstructured.NestedFieldNoCopy(values, keys...); found {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedResourceNames returns the keys of a resource map in order
+func sortedResourceNames[T any](resources map[corev1.ResourceName]T) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
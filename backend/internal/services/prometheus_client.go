@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// PrometheusClient runs queries against the Prometheus HTTP API
+type PrometheusClient struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// NewPrometheusClient creates a Prometheus client for the given base URL
+func NewPrometheusClient(baseURL string) *PrometheusClient {
+	return &PrometheusClient{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// ConnectPrometheus returns a client for the cluster's Prometheus. A configured
+// URL is used directly; otherwise the Prometheus service is discovered in the
+// cluster and reached through a port-forward. The returned function closes any
+// tunnel and must always be called.
+func ConnectPrometheus(ctx context.Context, configuredURL, kubeconfig string) (*PrometheusClient, func(), error) {
+	if configuredURL != "" {
+		return NewPrometheusClient(configuredURL), func() {}, nil
+	}
+
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+
+	service, err := findServiceBySelectors(client, prometheusServiceSelectors)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no prometheus endpoint configured and none found in cluster: %w", err)
+	}
+
+	localPort, stop, err := client.PortForwardService(ctx, service.Namespace, service.Name, servicePort(service))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reach prometheus: %w", err)
+	}
+
+	return NewPrometheusClient(fmt.Sprintf("http://127.0.0.1:%d", localPort)), stop, nil
+}
+
+// PrometheusResult is the data section of a Prometheus query response
+type PrometheusResult struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+	Warnings   []string        `json:"warnings,omitempty"`
+}
+
+// PrometheusAPIError is returned when Prometheus rejects a query
+type PrometheusAPIError struct {
+	StatusCode int
+	ErrorType  string
+	Message    string
+}
+
+func (e *PrometheusAPIError) Error() string {
+	return fmt.Sprintf("prometheus %s error: %s", e.ErrorType, e.Message)
+}
+
+// Query evaluates an instant query at the given time
+func (p *PrometheusClient) Query(ctx context.Context, expr string, at time.Time) (*PrometheusResult, error) {
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("time", formatPrometheusTime(at))
+	return p.query(ctx, "/api/v1/query", params)
+}
+
+// QueryRange evaluates a range query between start and end
+func (p *PrometheusClient) QueryRange(ctx context.Context, expr string, start, end time.Time, step time.Duration) (*PrometheusResult, error) {
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("start", formatPrometheusTime(start))
+	params.Set("end", formatPrometheusTime(end))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	return p.query(ctx, "/api/v1/query_range", params)
+}
+
+func (p *PrometheusClient) query(ctx context.Context, path string, params url.Values) (*PrometheusResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var envelope struct {
+		Status    string           `json:"status"`
+		Data      PrometheusResult `json:"data"`
+		ErrorType string           `json:"errorType"`
+		Error     string           `json:"error"`
+		Warnings  []string         `json:"warnings"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, &PrometheusAPIError{StatusCode: resp.StatusCode, ErrorType: "response", Message: strings.TrimSpace(string(body))}
+	}
+
+	if envelope.Status != "success" {
+		return nil, &PrometheusAPIError{StatusCode: resp.StatusCode, ErrorType: envelope.ErrorType, Message: envelope.Error}
+	}
+
+	envelope.Data.Warnings = envelope.Warnings
+	return &envelope.Data, nil
+}
+
+func formatPrometheusTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// PromQLGeneratorService translates natural-language metric questions into PromQL
+type PromQLGeneratorService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewPromQLGeneratorService creates a new PromQL generator service
+func NewPromQLGeneratorService(aiAgent *agent.AIAgent) *PromQLGeneratorService {
+	return &PromQLGeneratorService{
+		aiAgent: aiAgent,
+	}
+}
+
+// GeneratedPromQL is a query produced by the model for a question
+type GeneratedPromQL struct {
+	Query       string `json:"query"`
+	Explanation string `json:"explanation"`
+	// QueryType is "instant" for point-in-time answers or "range" for trends
+	QueryType string `json:"query_type"`
+}
+
+const promqlSystemPrompt = `You are a Prometheus expert. Translate the user's question into a single PromQL expression.
+
+Rules:
+- Respond with JSON only: {"query": "<PromQL>", "explanation": "<one or two sentences>", "query_type": "instant" or "range"}.
+- Use metrics exposed by kube-state-metrics, node-exporter, cAdvisor and the Kubernetes API server unless the question names others.
+- Use rate() or increase() over counters, never raw counter values.
+- Choose "range" when the question asks about a trend or a period of time, otherwise "instant".`
+
+// Generate asks the model for a PromQL query answering the question
+func (s *PromQLGeneratorService) Generate(ctx context.Context, question, clusterInfo string) (*GeneratedPromQL, error) {
+	userMessage := fmt.Sprintf("Question: %s", question)
+	if clusterInfo != "" {
+		userMessage += fmt.Sprintf("\n\nCluster Information:\n%s", clusterInfo)
+	}
+
+	response, err := s.aiAgent.Complete(ctx, promqlSystemPrompt, userMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	block := agent.ExtractJSONBlock(response)
+	if block == "" {
+		return nil, fmt.Errorf("model response did not contain a query")
+	}
+
+	var generated GeneratedPromQL
+	if err := json.Unmarshal([]byte(block), &generated); err != nil {
+		return nil, fmt.Errorf("model returned invalid query JSON: %w", err)
+	}
+
+	generated.Query = strings.TrimSpace(generated.Query)
+	if generated.Query == "" {
+		return nil, fmt.Errorf("model returned an empty query")
+	}
+	if generated.QueryType != "range" {
+		generated.QueryType = "instant"
+	}
+
+	return &generated, nil
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Query cache results reported in query responses
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+// redisQueryCachePrefix namespaces query cache keys in a shared Redis
+const redisQueryCachePrefix = "query-cache:"
+
+// QueryCacheStore holds encoded cache entries until they expire
+type QueryCacheStore interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// QueryCache keeps agent answers so identical questions about an unchanged
+// cluster don't call the model again
+type QueryCache struct {
+	store QueryCacheStore
+	ttl   time.Duration
+}
+
+// NewQueryCache creates a query cache kept in memory for up to size entries,
+// or in Redis when redisURL is set
+func NewQueryCache(size int, ttl time.Duration, redisURL string) (*QueryCache, error) {
+	if redisURL == "" {
+		return &QueryCache{store: newMemoryCacheStore(size), ttl: ttl}, nil
+	}
+	options, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	return &QueryCache{store: &redisCacheStore{client: redis.NewClient(options)}, ttl: ttl}, nil
+}
+
+// QueryCacheKey derives a cache key from the parts an answer depends on. The
+// query is normalized, so case, spacing and trailing punctuation don't matter.
+func QueryCacheKey(query string, parts ...string) string {
+	hash := sha256.New()
+	hash.Write([]byte(NormalizeQuery(query)))
+	for _, part := range parts {
+		hash.Write([]byte{0})
+		hash.Write([]byte(part))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// NormalizeQuery lowercases a query, collapses its whitespace and drops
+// trailing punctuation
+func NormalizeQuery(query string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	return strings.TrimRightFunc(normalized, unicode.IsPunct)
+}
+
+// Get decodes the entry under key into value and reports whether there was
+// one. Store failures count as misses.
+func (c *QueryCache) Get(ctx context.Context, key string, value interface{}) bool {
+	data, ok, err := c.store.Get(ctx, key)
+	if err != nil {
+		fmt.Printf("Failed to read query cache: %v\n", err)
+		return false
+	}
+	if !ok {
+		return false
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		fmt.Printf("Failed to decode query cache entry: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// Set stores value under key for the cache's TTL
+func (c *QueryCache) Set(ctx context.Context, key string, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		fmt.Printf("Failed to encode query cache entry: %v\n", err)
+		return
+	}
+	if err := c.store.Set(ctx, key, data, c.ttl); err != nil {
+		fmt.Printf("Failed to write query cache: %v\n", err)
+	}
+}
+
+// memoryCacheStore is a least recently used cache of a fixed number of entries
+type memoryCacheStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newMemoryCacheStore(capacity int) *memoryCacheStore {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &memoryCacheStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *memoryCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expires) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+	s.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (s *memoryCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryCacheEntry)
+		entry.value, entry.expires = value, time.Now().Add(ttl)
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(&memoryCacheEntry{key: key, value: value, expires: time.Now().Add(ttl)})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*memoryCacheEntry).key)
+	}
+	return nil
+}
+
+// redisCacheStore keeps entries in Redis, shared by every backend replica
+type redisCacheStore struct {
+	client *redis.Client
+}
+
+func (s *redisCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, redisQueryCachePrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (s *redisCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, redisQueryCachePrefix+key, value, ttl).Err()
+}
@@ -0,0 +1,356 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// computeResources are the container resources generated values set
+var computeResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// defaultContainerResources are the requests and limits generated values give
+// charts whose namespace's LimitRanges set no defaults
+var defaultContainerResources = containerDefaults{
+	requests: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("100m"),
+		corev1.ResourceMemory: resource.MustParse("128Mi"),
+	},
+	limits: corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("500m"),
+		corev1.ResourceMemory: resource.MustParse("512Mi"),
+	},
+}
+
+// minimumContainerResources are the least a chart's requests and limits are
+// lowered to when fitting it into quotas
+var minimumContainerResources = corev1.ResourceList{
+	corev1.ResourceCPU:    resource.MustParse("10m"),
+	corev1.ResourceMemory: resource.MustParse("32Mi"),
+}
+
+// NamespaceFitError stops plan generation when the charts of a namespace can't
+// fit its ResourceQuotas or LimitRanges. Each problem says what to change.
+type NamespaceFitError struct {
+	Namespace string
+	Problems  []string
+}
+
+func (e *NamespaceFitError) Error() string {
+	return fmt.Sprintf("the plan does not fit namespace %s: %s", e.Namespace, strings.Join(e.Problems, "; "))
+}
+
+// containerResources returns the requests and limits generated values give the
+// containers of a namespace: its LimitRange defaults, else the platform's,
+// within the LimitRange bounds
+func containerResources(limits *agent.NamespaceLimits) (corev1.ResourceList, corev1.ResourceList, error) {
+	requests := defaultContainerResources.requests.DeepCopy()
+	limitList := defaultContainerResources.limits.DeepCopy()
+	if limits == nil {
+		return requests, limitList, nil
+	}
+	for _, name := range computeResources {
+		if quantity, ok := parseResource(limits.ContainerDefaultRequest, name); ok {
+			requests[name] = quantity
+		}
+		if quantity, ok := parseResource(limits.ContainerDefaultLimit, name); ok {
+			limitList[name] = quantity
+			// The API server defaults requests to limits
+			if _, ok := limits.ContainerDefaultRequest[string(name)]; !ok && quantity.Cmp(requests[name]) < 0 {
+				requests[name] = quantity
+			}
+		}
+	}
+	if _, err := clampToLimitRange(requests, limitList, limits); err != nil {
+		return nil, nil, err
+	}
+	return requests, limitList, nil
+}
+
+// clampToLimitRange brings requests and limits within a namespace's container
+// min, max and max limit/request ratio, and reports whether it changed them.
+// Bounds no values can satisfy are an error.
+func clampToLimitRange(requests, limits corev1.ResourceList, namespace *agent.NamespaceLimits) (bool, error) {
+	changed := false
+	set := func(list corev1.ResourceList, name corev1.ResourceName, quantity resource.Quantity) {
+		list[name] = quantity
+		changed = true
+	}
+
+	for _, name := range computeResources {
+		min, hasMin := parseResource(namespace.ContainerMin, name)
+		max, hasMax := parseResource(namespace.ContainerMax, name)
+		if hasMin && hasMax && min.Cmp(max) > 0 {
+			return false, fmt.Errorf("LimitRanges of namespace %s require a %s of at least %s and at most %s; fix the LimitRanges or deploy to another namespace",
+				namespace.Namespace, name, min.String(), max.String())
+		}
+
+		request, hasRequest := requests[name]
+		limit, hasLimit := limits[name]
+		if hasMin && hasRequest && request.Cmp(min) < 0 {
+			set(requests, name, min)
+		}
+		if hasMin && hasLimit && limit.Cmp(min) < 0 {
+			set(limits, name, min)
+		}
+		if hasMax && hasLimit && limit.Cmp(max) > 0 {
+			set(limits, name, max)
+		}
+		if request, limit := requests[name], limits[name]; hasMax && hasRequest && request.Cmp(max) > 0 {
+			set(requests, name, max)
+		} else if hasRequest && hasLimit && request.Cmp(limit) > 0 {
+			set(requests, name, limit)
+		}
+
+		ratio, hasRatio := parseResource(namespace.MaxLimitRequestRatio, name)
+		if hasRatio && hasRequest && hasLimit {
+			request, limit := requests[name], limits[name]
+			highest := int64(float64(request.MilliValue()) * ratio.AsApproximateFloat64())
+			if limit.MilliValue() > highest {
+				lowered := formatResource(name, highest)
+				if hasMin && lowered.Cmp(min) < 0 {
+					return false, fmt.Errorf("LimitRanges of namespace %s allow %s limits of at most %s times the request, which puts them below the minimum of %s",
+						namespace.Namespace, name, ratio.String(), min.String())
+				}
+				set(limits, name, lowered)
+			}
+		}
+	}
+	return changed, nil
+}
+
+// chartResources is what a chart's values request for its pods
+type chartResources struct {
+	chart    *agent.HelmChart
+	pods     int64
+	requests corev1.ResourceList
+	limits   corev1.ResourceList
+	changed  bool
+}
+
+// FitNamespaceLimits brings the resources of each chart within the LimitRanges
+// of its namespace, then lowers the charts' requests and limits until the
+// namespace's ResourceQuotas can hold them, keeping what the value policy sets.
+// Usage is estimated from each chart's top-level resources and replica values;
+// preflight checks render the charts for an exact check. Adjusted charts are
+// listed in the plan's risks. When the charts can't fit, a *NamespaceFitError
+// explains what to change.
+func (s *HelmService) FitNamespaceLimits(plan *agent.DeploymentPlan, clusterAnalysis *agent.ClusterAnalysis, policy *ValuePolicy) error {
+	if clusterAnalysis == nil || len(clusterAnalysis.NamespaceLimits) == 0 {
+		return nil
+	}
+
+	byNamespace := make(map[string][]*chartResources)
+	var namespaces []string
+	for i := range plan.Steps {
+		chart := plan.Steps[i].Chart
+		if chart == nil {
+			continue
+		}
+		namespace := chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		if clusterAnalysis.NamespaceLimitsOf(namespace) == nil {
+			continue
+		}
+		if _, ok := byNamespace[namespace]; !ok {
+			namespaces = append(namespaces, namespace)
+		}
+		byNamespace[namespace] = append(byNamespace[namespace], readChartResources(chart))
+	}
+
+	for _, namespace := range namespaces {
+		limits := clusterAnalysis.NamespaceLimitsOf(namespace)
+		charts := byNamespace[namespace]
+		fitErr := &NamespaceFitError{Namespace: namespace}
+
+		for _, chart := range charts {
+			if policyPins(policy, chart.chart.Name, "resources") {
+				continue
+			}
+			changed, err := clampToLimitRange(chart.requests, chart.limits, limits)
+			if err != nil {
+				fitErr.Problems = append(fitErr.Problems, err.Error())
+				continue
+			}
+			chart.changed = chart.changed || changed
+		}
+		fitErr.Problems = append(fitErr.Problems, fitQuotas(namespace, charts, limits, policy)...)
+		// Lowered requests may leave limits above the max limit/request ratio
+		for _, chart := range charts {
+			if !chart.changed || len(fitErr.Problems) > 0 {
+				continue
+			}
+			if _, err := clampToLimitRange(chart.requests, chart.limits, limits); err != nil {
+				fitErr.Problems = append(fitErr.Problems, err.Error())
+			}
+		}
+		if len(fitErr.Problems) > 0 {
+			return fitErr
+		}
+
+		for _, chart := range charts {
+			if !chart.changed {
+				continue
+			}
+			s.mergeValues(chart.chart.Values, map[string]interface{}{"resources": map[string]interface{}{
+				"requests": resourceValues(chart.requests),
+				"limits":   resourceValues(chart.limits),
+			}})
+			plan.Risks = append(plan.Risks, fmt.Sprintf("Resources of %s were lowered to fit the ResourceQuotas and LimitRanges of namespace %s", chart.chart.Name, namespace))
+		}
+	}
+	return nil
+}
+
+// fitQuotas lowers limits, then requests, of the charts of a namespace where
+// they add up to more than its quotas leave. Each chart keeps at least the
+// minimum it may be lowered to and gives up its share of the rest. Problems are
+// returned for the quotas that can't hold even that.
+func fitQuotas(namespace string, charts []*chartResources, limits *agent.NamespaceLimits, policy *ValuePolicy) []string {
+	var problems []string
+
+	if remaining, ok := parseResource(limits.QuotaRemaining, corev1.ResourcePods); ok {
+		var pods int64
+		for _, chart := range charts {
+			pods += chart.pods
+		}
+		if pods > remaining.Value() {
+			problems = append(problems, fmt.Sprintf("quota %s allows %s more pods but the charts run %d; lower replicaCount, raise the quota or deploy to another namespace",
+				limits.Quotas[string(corev1.ResourcePods)], remaining.String(), pods))
+		}
+	}
+
+	for _, kind := range []string{"limits", "requests"} {
+		for _, name := range computeResources {
+			quotaResource := kind + "." + string(name)
+			remaining, ok := parseResource(limits.QuotaRemaining, corev1.ResourceName(quotaResource))
+			if !ok {
+				continue
+			}
+
+			list := func(chart *chartResources) corev1.ResourceList {
+				if kind == "limits" {
+					return chart.limits
+				}
+				return chart.requests
+			}
+			least := minimumContainerResources[name]
+			floor := least.MilliValue()
+			if min, ok := parseResource(limits.ContainerMin, name); ok && min.MilliValue() > floor {
+				floor = min.MilliValue()
+			}
+
+			// fixed is what can't be lowered, spare what the lowerable charts share above their floor
+			var total, fixed, excess int64
+			var lowerable []*chartResources
+			for _, chart := range charts {
+				quantity := list(chart)[name]
+				used := quantity.MilliValue() * chart.pods
+				total += used
+				if quantity.MilliValue() <= floor || policyPins(policy, chart.chart.Name, "resources."+kind) {
+					fixed += used
+					continue
+				}
+				fixed += floor * chart.pods
+				excess += (quantity.MilliValue() - floor) * chart.pods
+				lowerable = append(lowerable, chart)
+			}
+			if total <= remaining.MilliValue() {
+				continue
+			}
+			if fixed > remaining.MilliValue() {
+				needed, perPod := formatResource(name, fixed), formatResource(name, floor)
+				problems = append(problems, fmt.Sprintf("quota %s leaves %s of %s but the charts need at least %s, with %s at no less than %s per pod; raise the quota, free up %s in %s, lower replicaCount or deploy to another namespace",
+					limits.Quotas[quotaResource], remaining.String(), quotaResource, needed.String(),
+					chartNames(charts), perPod.String(), quotaResource, namespace))
+				continue
+			}
+
+			spare := remaining.MilliValue() - fixed
+			for _, chart := range lowerable {
+				quantity := list(chart)[name]
+				share := int64(float64(quantity.MilliValue()-floor) * float64(spare) / float64(excess))
+				lowered := formatResource(name, floor+share)
+				if lowered.MilliValue() < floor {
+					lowered = *resource.NewMilliQuantity(floor, resource.DecimalSI)
+				}
+				list(chart)[name] = lowered
+				chart.changed = true
+				// Requests may not exceed limits
+				if request := chart.requests[name]; kind == "limits" && request.Cmp(lowered) > 0 {
+					chart.requests[name] = lowered
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// readChartResources reads the cpu and memory requests and limits of a chart's
+// values and how many pods it runs
+func readChartResources(chart *agent.HelmChart) *chartResources {
+	resources := &chartResources{chart: chart, pods: 1, requests: corev1.ResourceList{}, limits: corev1.ResourceList{}}
+	if _, replicas, ok := chartReplicas(chart.Values); ok {
+		resources.pods = int64(replicas)
+	}
+	for kind, list := range map[string]corev1.ResourceList{"requests": resources.requests, "limits": resources.limits} {
+		values, _, _ := unstructured.NestedMap(chart.Values, "resources", kind)
+		for _, name := range computeResources {
+			if value, ok := values[string(name)]; ok {
+				if quantity, err := resource.ParseQuantity(fmt.Sprint(value)); err == nil {
+					list[name] = quantity
+				}
+			}
+		}
+	}
+	return resources
+}
+
+// resourceValues renders resources as chart values
+func resourceValues(list corev1.ResourceList) map[string]interface{} {
+	values := make(map[string]interface{}, len(list))
+	for name, quantity := range list {
+		values[string(name)] = quantity.String()
+	}
+	return values
+}
+
+// formatResource turns a milli-value into a quantity charts read as they
+// usually write it: millicores of cpu and whole mebibytes of memory, rounded down
+func formatResource(name corev1.ResourceName, milli int64) resource.Quantity {
+	if name == corev1.ResourceMemory {
+		return resource.MustParse(fmt.Sprintf("%dMi", milli/1000/(1<<20)))
+	}
+	return *resource.NewMilliQuantity(milli, resource.DecimalSI)
+}
+
+// parseResource parses a resource of a map of quantities
+func parseResource(resources map[string]string, name corev1.ResourceName) (resource.Quantity, bool) {
+	value, ok := resources[string(name)]
+	if !ok {
+		return resource.Quantity{}, false
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return resource.Quantity{}, false
+	}
+	return quantity, true
+}
+
+// chartNames lists the names of charts in order
+func chartNames(charts []*chartResources) string {
+	names := make([]string, len(charts))
+	for i, chart := range charts {
+		names[i] = chart.chart.Name
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// Runbook sources
+const (
+	RunbookSourceAgent    = "agent"
+	RunbookSourceTemplate = "template"
+	RunbookSourceUser     = "user"
+)
+
+// RunbookGeneratorService writes operational runbooks for deployed stacks
+type RunbookGeneratorService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewRunbookGeneratorService creates a new runbook generator service
+func NewRunbookGeneratorService(aiAgent *agent.AIAgent) *RunbookGeneratorService {
+	return &RunbookGeneratorService{
+		aiAgent: aiAgent,
+	}
+}
+
+const runbookSystemPrompt = `You are a Kubernetes site reliability engineer writing an operational runbook for a stack that was just deployed with Helm.
+
+Write Markdown with these sections, in order:
+1. "## Overview" - what was deployed, one line per release with its namespace.
+2. "## Restarting components" - kubectl commands to restart each workload of each release.
+3. "## Where data lives" - persistent volumes, databases and object storage each release uses, and how to back them up. Say so when a release keeps no data.
+4. "## Scaling" - how to scale each component, with the helm upgrade --reuse-values --set flags to use.
+5. "## Known failure modes" - symptoms, how to confirm them, and how to fix them.
+
+Rules:
+- Use the release names and namespaces you are given in every command.
+- Prefer commands that are safe to copy and paste.
+- Respond with the Markdown only.`
+
+// runbookRelease is the part of a chart step a runbook needs
+type runbookRelease struct {
+	Release   string                 `json:"release"`
+	Chart     string                 `json:"chart"`
+	Version   string                 `json:"version"`
+	Namespace string                 `json:"namespace"`
+	Values    map[string]interface{} `json:"values,omitempty"`
+}
+
+// Generate asks the model for a runbook covering the releases of a deployment.
+// Known issues for the deployed charts are offered as failure modes.
+func (s *RunbookGeneratorService) Generate(ctx context.Context, plan *agent.DeploymentPlan, issues []KnownIssue) (string, error) {
+	releases := runbookReleases(plan)
+	if len(releases) == 0 {
+		return "", fmt.Errorf("plan %s deploys no charts", plan.ID)
+	}
+
+	encoded, err := json.MarshalIndent(releases, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode releases: %w", err)
+	}
+
+	var userMessage strings.Builder
+	fmt.Fprintf(&userMessage, "Stack: %s\n%s\n\nReleases:\n%s\n", plan.Name, plan.Description, encoded)
+	if failures := runbookFailureModes(releases, issues); len(failures) > 0 {
+		userMessage.WriteString("\nFailures seen before with these charts:\n")
+		for _, failure := range failures {
+			fmt.Fprintf(&userMessage, "- %s\n", failure)
+		}
+	}
+
+	response, err := s.aiAgent.Complete(ctx, runbookSystemPrompt, userMessage.String())
+	if err != nil {
+		return "", err
+	}
+	response = strings.TrimSpace(response)
+	if response == "" {
+		return "", fmt.Errorf("model returned an empty runbook")
+	}
+	return response, nil
+}
+
+// TemplateRunbook builds a runbook from the plan alone, for when the model is unavailable
+func (s *RunbookGeneratorService) TemplateRunbook(plan *agent.DeploymentPlan, issues []KnownIssue) string {
+	releases := runbookReleases(plan)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Runbook: %s\n\n", plan.Name)
+
+	b.WriteString("## Overview\n\n")
+	for _, release := range releases {
+		fmt.Fprintf(&b, "- `%s` (%s %s) in namespace `%s`\n", release.Release, release.Chart, release.Version, release.Namespace)
+	}
+
+	b.WriteString("\n## Restarting components\n\n")
+	for _, release := range releases {
+		fmt.Fprintf(&b, "```sh\nkubectl -n %s rollout restart deployment,statefulset,daemonset -l app.kubernetes.io/instance=%s\n```\n\n", release.Namespace, release.Release)
+	}
+
+	b.WriteString("## Where data lives\n\n")
+	for _, release := range releases {
+		fmt.Fprintf(&b, "- `%s`: `kubectl -n %s get pvc -l app.kubernetes.io/instance=%s`\n", release.Release, release.Namespace, release.Release)
+	}
+
+	b.WriteString("\n## Scaling\n\n")
+	for _, release := range releases {
+		fmt.Fprintf(&b, "```sh\nhelm -n %s upgrade %s %s --reuse-values --set replicaCount=<replicas>\n```\n\n", release.Namespace, release.Release, release.Chart)
+	}
+
+	b.WriteString("## Known failure modes\n\n")
+	failures := runbookFailureModes(releases, issues)
+	if len(failures) == 0 {
+		b.WriteString("None recorded yet.\n")
+	}
+	for _, failure := range failures {
+		fmt.Fprintf(&b, "- %s\n", failure)
+	}
+
+	return b.String()
+}
+
+// runbookReleases lists the chart releases a plan deploys
+func runbookReleases(plan *agent.DeploymentPlan) []runbookRelease {
+	var releases []runbookRelease
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		namespace := step.Chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		releases = append(releases, runbookRelease{
+			Release:   releaseName(step.Chart),
+			Chart:     step.Chart.Name,
+			Version:   step.Chart.Version,
+			Namespace: namespace,
+			Values:    step.Chart.Values,
+		})
+	}
+	return releases
+}
+
+// runbookFailureModes describes the known issues that apply to the released charts
+func runbookFailureModes(releases []runbookRelease, issues []KnownIssue) []string {
+	charts := make(map[string]bool, len(releases))
+	for _, release := range releases {
+		charts[release.Chart] = true
+	}
+
+	var failures []string
+	for _, issue := range issues {
+		if issue.Chart == "" || !charts[issue.Chart] {
+			continue
+		}
+		failures = append(failures, fmt.Sprintf("**%s** (%s): %s", issue.Title, issue.Chart, issue.Remediation))
+	}
+	sort.Strings(failures)
+	return failures
+}
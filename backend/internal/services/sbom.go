@@ -0,0 +1,426 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SBOM document formats
+const (
+	SBOMFormatSPDX      = "spdx"
+	SBOMFormatCycloneDX = "cyclonedx"
+)
+
+// sbomTool names the platform as the creator of SBOM documents
+const sbomTool = "grafana-ai-agent-platform"
+
+// GenerateSBOM lists the charts a completed deployment installed, with the
+// versions Helm reports for their releases, and the images the releases' pods
+// run with the digests they were pulled by. Releases that can't be read are
+// listed under warnings rather than failing the SBOM.
+func GenerateSBOM(ctx context.Context, kubeconfig string, plan *agent.DeploymentPlan, execution *agent.DeploymentExecution) (*agent.SBOM, error) {
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+
+	sbom := &agent.SBOM{GeneratedAt: time.Now().UTC(), Charts: []agent.SBOMChart{}, Images: []agent.SBOMImage{}}
+	releases := map[string]HelmRelease{}
+	installed, err := listHelmReleases(ctx, kubeconfig)
+	if err != nil {
+		sbom.Warnings = append(sbom.Warnings, fmt.Sprintf("Chart versions are the planned ones: %v", err))
+	}
+	for _, release := range installed {
+		releases[release.Namespace+"/"+release.Name] = release
+	}
+
+	completed := map[string]bool{}
+	for _, step := range execution.Steps {
+		completed[step.StepID] = step.Status == "completed"
+	}
+	images := map[string]*agent.SBOMImage{}
+	for _, step := range plan.Steps {
+		if step.Chart == nil || !completed[step.ID] {
+			continue
+		}
+		chart := agent.SBOMChart{
+			StepID:     step.ID,
+			Name:       step.Chart.Name,
+			Version:    step.Chart.Version,
+			Repository: step.Chart.Repository,
+			Release:    releaseName(step.Chart),
+			Namespace:  step.Chart.Namespace,
+		}
+		if chart.Namespace == "" {
+			chart.Namespace = "default"
+		}
+		if release, ok := releases[chart.Namespace+"/"+chart.Release]; ok {
+			chart.Version, chart.AppVersion = release.ChartVersion, release.AppVersion
+		}
+		sbom.Charts = append(sbom.Charts, chart)
+
+		pods, err := releasePods(ctx, client, chart.Namespace, chart.Release)
+		if err != nil {
+			sbom.Warnings = append(sbom.Warnings, fmt.Sprintf("Images of release %s are missing: %v", chart.Release, err))
+			continue
+		}
+		if len(pods) == 0 {
+			sbom.Warnings = append(sbom.Warnings, fmt.Sprintf("Release %s runs no pods to list images of", chart.Release))
+		}
+		for _, pod := range pods {
+			for _, container := range podImages(pod) {
+				key := container.Image + "@" + container.Digest
+				image, ok := images[key]
+				if !ok {
+					image = &agent.SBOMImage{Image: container.Image, Digest: container.Digest}
+					images[key] = image
+				}
+				if !containsString(image.Releases, chart.Release) {
+					image.Releases = append(image.Releases, chart.Release)
+				}
+			}
+		}
+	}
+
+	for _, image := range images {
+		sbom.Images = append(sbom.Images, *image)
+	}
+	sort.Slice(sbom.Images, func(i, j int) bool {
+		if sbom.Images[i].Image != sbom.Images[j].Image {
+			return sbom.Images[i].Image < sbom.Images[j].Image
+		}
+		return sbom.Images[i].Digest < sbom.Images[j].Digest
+	})
+	return sbom, nil
+}
+
+// releasePods lists the pods of a Helm release by the recommended instance
+// label, or the release label older charts set
+func releasePods(ctx context.Context, client *kubernetes.KubernetesClient, namespace, release string) ([]corev1.Pod, error) {
+	for _, selector := range []string{"app.kubernetes.io/instance=" + release, "release=" + release} {
+		pods, err := client.ListPods(ctx, namespace, selector)
+		if err != nil || len(pods) > 0 {
+			return pods, err
+		}
+	}
+	return nil, nil
+}
+
+// podImages returns the images of a pod's containers, with the digest the
+// runtime pulled each by when it reports one
+func podImages(pod corev1.Pod) []agent.SBOMImage {
+	imageIDs := map[string]string{}
+	for _, status := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		imageIDs[status.Name] = status.ImageID
+	}
+
+	var images []agent.SBOMImage
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		images = append(images, agent.SBOMImage{Image: container.Image, Digest: imageDigest(container.Image, imageIDs[container.Name])})
+	}
+	return images
+}
+
+// imageDigest returns the repository digest of an image ID like
+// docker.io/library/nginx@sha256:..., or of the image itself when it is
+// pinned by digest. Bare image IDs are local config digests and are ignored.
+func imageDigest(image, imageID string) string {
+	if _, digest, ok := strings.Cut(imageID, "@"); ok {
+		return digest
+	}
+	if _, digest, ok := strings.Cut(image, "@"); ok {
+		return digest
+	}
+	return ""
+}
+
+// containsString reports whether values contain value
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderSBOM encodes the SBOM of a deployment as an SPDX 2.3 or a CycloneDX
+// 1.5 JSON document, returning its content type
+func RenderSBOM(sbom *agent.SBOM, executionID, stackName, format string) ([]byte, string, error) {
+	var document interface{}
+	var contentType string
+	switch format {
+	case SBOMFormatSPDX:
+		document, contentType = spdxDocument(sbom, executionID, stackName), "application/spdx+json"
+	case SBOMFormatCycloneDX:
+		document, contentType = cycloneDXDocument(sbom, executionID, stackName), "application/vnd.cyclonedx+json"
+	default:
+		return nil, "", fmt.Errorf("unknown SBOM format %q, formats are %s and %s", format, SBOMFormatSPDX, SBOMFormatCycloneDX)
+	}
+	// Package URLs keep their & unescaped
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(document); err != nil {
+		return nil, "", fmt.Errorf("failed to encode SBOM: %w", err)
+	}
+	return data.Bytes(), contentType, nil
+}
+
+type spdxDoc struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name                  string            `json:"name"`
+	SPDXID                string            `json:"SPDXID"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose"`
+	Checksums             []spdxChecksum    `json:"checksums,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxDocument describes the charts of a deployment, each containing its images
+func spdxDocument(sbom *agent.SBOM, executionID, stackName string) spdxDoc {
+	doc := spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              fmt.Sprintf("%s deployment %s", stackName, executionID),
+		DocumentNamespace: "https://spdx.org/spdxdocs/" + sbomTool + "/deployments/" + executionID,
+		CreationInfo: spdxCreationInfo{
+			Created:  sbom.GeneratedAt.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + sbomTool},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+
+	chartIDs := map[string]string{}
+	for i, chart := range sbom.Charts {
+		id := fmt.Sprintf("SPDXRef-chart-%d", i+1)
+		chartIDs[chart.Release] = id
+		location := chart.Repository
+		if location == "" {
+			location = "NOASSERTION"
+		}
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:                  chart.Name,
+			SPDXID:                id,
+			VersionInfo:           chart.Version,
+			DownloadLocation:      location,
+			PrimaryPackagePurpose: "APPLICATION",
+			Comment:               fmt.Sprintf("Helm release %s in namespace %s", chart.Release, chart.Namespace),
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSPDXElement: id})
+	}
+
+	for i, image := range sbom.Images {
+		id := fmt.Sprintf("SPDXRef-image-%d", i+1)
+		ref := ParseImageReference(image.Image)
+		pkg := spdxPackage{
+			Name:                  ref.Repository,
+			SPDXID:                id,
+			VersionInfo:           imageVersion(ref, image.Digest),
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "CONTAINER",
+			ExternalRefs:          []spdxExternalRef{{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: imagePURL(ref, image.Digest)}},
+		}
+		if algorithm, value, ok := strings.Cut(image.Digest, ":"); ok && algorithm == "sha256" {
+			pkg.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: value}}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		for _, release := range image.Releases {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{SPDXElementID: chartIDs[release], RelationshipType: "CONTAINS", RelatedSPDXElement: id})
+		}
+	}
+	return doc
+}
+
+type cycloneDXDoc struct {
+	BOMFormat    string                `json:"bomFormat"`
+	SpecVersion  string                `json:"specVersion"`
+	SerialNumber string                `json:"serialNumber"`
+	Version      int                   `json:"version"`
+	Metadata     cycloneDXMetadata     `json:"metadata"`
+	Components   []cycloneDXComponent  `json:"components"`
+	Dependencies []cycloneDXDependency `json:"dependencies"`
+}
+
+type cycloneDXMetadata struct {
+	Timestamp string             `json:"timestamp"`
+	Tools     cycloneDXTools     `json:"tools"`
+	Component cycloneDXComponent `json:"component"`
+}
+
+type cycloneDXTools struct {
+	Components []cycloneDXComponent `json:"components"`
+}
+
+type cycloneDXComponent struct {
+	Type       string              `json:"type"`
+	BOMRef     string              `json:"bom-ref,omitempty"`
+	Name       string              `json:"name"`
+	Version    string              `json:"version,omitempty"`
+	PURL       string              `json:"purl,omitempty"`
+	Hashes     []cycloneDXHash     `json:"hashes,omitempty"`
+	Properties []cycloneDXProperty `json:"properties,omitempty"`
+}
+
+type cycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type cycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cycloneDXDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// cycloneDXDocument describes a deployment depending on its charts, each
+// depending on its images
+func cycloneDXDocument(sbom *agent.SBOM, executionID, stackName string) cycloneDXDoc {
+	root := "deployment/" + executionID
+	doc := cycloneDXDoc{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + uuid.NewSHA1(uuid.NameSpaceURL, []byte(sbomTool+"/"+root)).String(),
+		Version:      1,
+		Metadata: cycloneDXMetadata{
+			Timestamp: sbom.GeneratedAt.UTC().Format(time.RFC3339),
+			Tools:     cycloneDXTools{Components: []cycloneDXComponent{{Type: "application", Name: sbomTool}}},
+			Component: cycloneDXComponent{Type: "application", BOMRef: root, Name: stackName, Version: executionID},
+		},
+		Components:   []cycloneDXComponent{},
+		Dependencies: []cycloneDXDependency{},
+	}
+
+	rootDependency := cycloneDXDependency{Ref: root, DependsOn: []string{}}
+	chartDependencies := map[string]*cycloneDXDependency{}
+	for _, chart := range sbom.Charts {
+		ref := "chart/" + chart.Namespace + "/" + chart.Release
+		component := cycloneDXComponent{
+			Type:    "application",
+			BOMRef:  ref,
+			Name:    chart.Name,
+			Version: chart.Version,
+			Properties: []cycloneDXProperty{
+				{Name: "helm:release", Value: chart.Release},
+				{Name: "helm:namespace", Value: chart.Namespace},
+			},
+		}
+		if chart.Repository != "" {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "helm:repository", Value: chart.Repository})
+		}
+		if chart.AppVersion != "" {
+			component.Properties = append(component.Properties, cycloneDXProperty{Name: "helm:appVersion", Value: chart.AppVersion})
+		}
+		doc.Components = append(doc.Components, component)
+		rootDependency.DependsOn = append(rootDependency.DependsOn, ref)
+		chartDependencies[chart.Release] = &cycloneDXDependency{Ref: ref, DependsOn: []string{}}
+	}
+
+	for i, image := range sbom.Images {
+		ref := ParseImageReference(image.Image)
+		bomRef := fmt.Sprintf("image/%d", i+1)
+		component := cycloneDXComponent{
+			Type:    "container",
+			BOMRef:  bomRef,
+			Name:    ref.Repository,
+			Version: imageVersion(ref, image.Digest),
+			PURL:    imagePURL(ref, image.Digest),
+		}
+		if algorithm, value, ok := strings.Cut(image.Digest, ":"); ok && algorithm == "sha256" {
+			component.Hashes = []cycloneDXHash{{Algorithm: "SHA-256", Content: value}}
+		}
+		doc.Components = append(doc.Components, component)
+		for _, release := range image.Releases {
+			if dependency, ok := chartDependencies[release]; ok {
+				dependency.DependsOn = append(dependency.DependsOn, bomRef)
+			}
+		}
+	}
+
+	doc.Dependencies = append(doc.Dependencies, rootDependency)
+	for _, chart := range sbom.Charts {
+		doc.Dependencies = append(doc.Dependencies, *chartDependencies[chart.Release])
+	}
+	return doc
+}
+
+// imageVersion is the tag of an image, or its digest when it has no tag
+func imageVersion(ref ImageReference, digest string) string {
+	if !strings.Contains(ref.Reference, ":") {
+		return ref.Reference
+	}
+	return digest
+}
+
+// imagePURL is the package URL of an image, e.g.
+// pkg:oci/nginx@sha256%3Aabc?repository_url=docker.io/library/nginx&tag=1.25
+func imagePURL(ref ImageReference, digest string) string {
+	registry := ref.Registry
+	if registry == "registry-1.docker.io" {
+		registry = "docker.io"
+	}
+	name := strings.ToLower(ref.Repository[strings.LastIndex(ref.Repository, "/")+1:])
+
+	purl := "pkg:oci/" + name
+	if digest != "" {
+		purl += "@" + strings.ReplaceAll(digest, ":", "%3A")
+	}
+	purl += "?repository_url=" + strings.ToLower(registry+"/"+ref.Repository)
+	if !strings.Contains(ref.Reference, ":") {
+		purl += "&tag=" + ref.Reference
+	}
+	return purl
+}
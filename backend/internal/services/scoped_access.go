@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// scopedAccountNamespace is where ephemeral execution ServiceAccounts live
+const scopedAccountNamespace = "kube-system"
+
+// helmStepTimeout matches the --timeout helm install and upgrade run with
+const helmStepTimeout = 10 * time.Minute
+
+var (
+	manageVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete"}
+	readVerbs   = []string{"get", "list", "watch"}
+)
+
+// ScopedAccessService runs deployments as an ephemeral ServiceAccount whose
+// roles only cover the resources the plan deploys, instead of the stored admin
+// kubeconfig
+type ScopedAccessService struct {
+	deploymentExecutor *DeploymentExecutorService
+}
+
+// NewScopedAccessService creates a new scoped access service
+func NewScopedAccessService(deploymentExecutor *DeploymentExecutorService) *ScopedAccessService {
+	return &ScopedAccessService{deploymentExecutor: deploymentExecutor}
+}
+
+// RunScoped creates a ServiceAccount scoped to the plan's resources with the
+// admin kubeconfig, calls run with a kubeconfig holding a short-lived token for
+// it, and deletes the ServiceAccount once run returns
+func (s *ScopedAccessService) RunScoped(ctx context.Context, adminKubeconfig string, plan *agent.DeploymentPlan, run func(kubeconfig string) (*agent.DeploymentExecution, error)) (*agent.DeploymentExecution, error) {
+	client, err := kubernetes.NewKubernetesClient(adminKubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+
+	scope, err := s.PlanScope(ctx, client, plan)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("ai-agent-exec-%d", time.Now().UnixNano())
+	account, err := client.CreateScopedServiceAccount(ctx, name, scopedAccountNamespace, scope, executionTokenTTL(plan))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scoped service account: %w", err)
+	}
+
+	execution, runErr := run(account.Kubeconfig)
+
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	cleanupErr := account.Delete(cleanupCtx)
+
+	if execution != nil {
+		namespaces := make([]string, 0, len(scope.Namespaces))
+		for namespace := range scope.Namespaces {
+			namespaces = append(namespaces, namespace)
+		}
+		sort.Strings(namespaces)
+		execution.Logs = append(execution.Logs, fmt.Sprintf("Ran as ephemeral service account %s/%s scoped to namespaces %s (token expires %s)",
+			account.Namespace, account.Name, strings.Join(namespaces, ", "), account.ExpiresAt.UTC().Format(time.RFC3339)))
+		if cleanupErr != nil {
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Failed to delete ephemeral service account, its token stays valid until it expires: %v", cleanupErr))
+		} else {
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Deleted ephemeral service account %s/%s", account.Namespace, account.Name))
+		}
+	} else if cleanupErr != nil {
+		fmt.Printf("Failed to delete ephemeral service account %s/%s: %v\n", account.Namespace, account.Name, cleanupErr)
+	}
+	return execution, runErr
+}
+
+// PlanScope renders every step of the plan and grants full access to the kinds
+// it deploys, in the namespaces it deploys them to. Every namespace also gets
+// what helm needs to store releases, wait for workloads and run tests.
+func (s *ScopedAccessService) PlanScope(ctx context.Context, client *kubernetes.KubernetesClient, plan *agent.DeploymentPlan) (kubernetes.AccessScope, error) {
+	namespaced := make(map[string]map[string]map[string]bool) // namespace -> group -> resources
+	cluster := make(map[string]map[string]bool)
+
+	grant := func(rules map[string]map[string]bool, group, resource string) {
+		if rules[group] == nil {
+			rules[group] = make(map[string]bool)
+		}
+		rules[group][resource] = true
+	}
+
+	for _, step := range plan.Steps {
+		namespace := step.Namespace
+		var objects []*unstructured.Unstructured
+		var err error
+		switch {
+		case step.Chart != nil:
+			namespace = step.Chart.Namespace
+			if namespace == "" {
+				namespace = "default"
+			}
+			manifest, renderErr := s.deploymentExecutor.RenderChart(ctx, step.Chart, namespace)
+			if renderErr != nil {
+				return kubernetes.AccessScope{}, fmt.Errorf("failed to render %s to scope its permissions: %w", step.Chart.Name, renderErr)
+			}
+			objects, err = kubernetes.ParseManifest(manifest)
+		case step.Manifest != "":
+			objects, err = kubernetes.ParseManifest(step.Manifest)
+		default:
+			continue
+		}
+		if err != nil {
+			return kubernetes.AccessScope{}, fmt.Errorf("failed to parse manifest of step %s: %w", step.ID, err)
+		}
+		if namespace == "" {
+			namespace = "default"
+		}
+		if namespaced[namespace] == nil {
+			namespaced[namespace] = make(map[string]map[string]bool)
+		}
+
+		// Kinds defined by CRDs in the same manifest are not known to the cluster yet
+		crds := crdResources(objects)
+		for _, obj := range objects {
+			gvk := obj.GroupVersionKind()
+			resource, isNamespaced, err := client.ResourceMapping(gvk)
+			if err != nil {
+				crd, ok := crds[gvk.GroupKind()]
+				if !ok {
+					return kubernetes.AccessScope{}, fmt.Errorf("failed to scope permissions for %s %s: %w", gvk.Kind, obj.GetName(), err)
+				}
+				resource, isNamespaced = crd.resource, crd.namespaced
+			}
+
+			switch {
+			case !isNamespaced:
+				grant(cluster, gvk.Group, resource)
+			case obj.GetNamespace() != "" && obj.GetNamespace() != namespace:
+				if namespaced[obj.GetNamespace()] == nil {
+					namespaced[obj.GetNamespace()] = make(map[string]map[string]bool)
+				}
+				grant(namespaced[obj.GetNamespace()], gvk.Group, resource)
+			default:
+				grant(namespaced[namespace], gvk.Group, resource)
+			}
+		}
+	}
+
+	scope := kubernetes.AccessScope{Namespaces: make(map[string][]rbacv1.PolicyRule)}
+	for namespace, groups := range namespaced {
+		rules := append(policyRules(groups, manageVerbs), helmNamespaceRules()...)
+		// Charts that create roles grant permissions the account doesn't hold itself
+		if groups[rbacv1.GroupName]["roles"] || groups[rbacv1.GroupName]["rolebindings"] {
+			rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{rbacv1.GroupName}, Resources: []string{"roles"}, Verbs: []string{"bind", "escalate"}})
+		}
+		scope.Namespaces[namespace] = rules
+	}
+
+	scope.ClusterRules = policyRules(cluster, manageVerbs)
+	// helm --create-namespace checks the namespace exists
+	scope.ClusterRules = append(scope.ClusterRules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"namespaces"}, Verbs: []string{"get", "list"}})
+	if cluster[rbacv1.GroupName]["clusterroles"] || cluster[rbacv1.GroupName]["clusterrolebindings"] {
+		scope.ClusterRules = append(scope.ClusterRules, rbacv1.PolicyRule{APIGroups: []string{rbacv1.GroupName}, Resources: []string{"clusterroles"}, Verbs: []string{"bind", "escalate"}})
+	}
+	return scope, nil
+}
+
+type crdResource struct {
+	resource   string
+	namespaced bool
+}
+
+// crdResources maps the kinds defined by CustomResourceDefinitions among the
+// objects to their resource names and scope
+func crdResources(objects []*unstructured.Unstructured) map[schema.GroupKind]crdResource {
+	crds := make(map[schema.GroupKind]crdResource)
+	for _, obj := range objects {
+		if obj.GetKind() != "CustomResourceDefinition" {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "plural")
+		scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+		if kind == "" || plural == "" {
+			continue
+		}
+		crds[schema.GroupKind{Group: group, Kind: kind}] = crdResource{resource: plural, namespaced: scope != "Cluster"}
+	}
+	return crds
+}
+
+// helmNamespaceRules cover helm's release secrets, --wait, helm test and the
+// post-deploy steps
+func helmNamespaceRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets", "pods"}, Verbs: manageVerbs},
+		{APIGroups: []string{""}, Resources: []string{"pods/log", "events", "services", "endpoints", "configmaps", "persistentvolumeclaims"}, Verbs: readVerbs},
+		{APIGroups: []string{""}, Resources: []string{"pods/portforward"}, Verbs: []string{"get", "create"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets", "daemonsets", "replicasets"}, Verbs: readVerbs},
+		{APIGroups: []string{"batch"}, Resources: []string{"jobs"}, Verbs: readVerbs},
+	}
+}
+
+// policyRules turns group -> resources sets into one rule per group, sorted
+func policyRules(groups map[string]map[string]bool, verbs []string) []rbacv1.PolicyRule {
+	names := make([]string, 0, len(groups))
+	for group := range groups {
+		names = append(names, group)
+	}
+	sort.Strings(names)
+
+	rules := make([]rbacv1.PolicyRule, 0, len(names))
+	for _, group := range names {
+		resources := make([]string, 0, len(groups[group]))
+		for resource := range groups[group] {
+			resources = append(resources, resource)
+		}
+		sort.Strings(resources)
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{group}, Resources: resources, Verbs: verbs})
+	}
+	return rules
+}
+
+// executionTokenTTL covers every attempt of every step at helm's timeout, plus
+// time for post-deploy steps. The API server enforces a ten minute minimum.
+func executionTokenTTL(plan *agent.DeploymentPlan) time.Duration {
+	ttl := 10 * time.Minute
+	for _, step := range plan.Steps {
+		retry := agent.DefaultRetryPolicy()
+		if step.Retry != nil {
+			retry = *step.Retry
+		}
+		attempts := retry.MaxAttempts
+		if attempts < 1 {
+			attempts = 1
+		}
+		ttl += time.Duration(attempts) * (helmStepTimeout + time.Duration(retry.MaxBackoffSeconds)*time.Second)
+	}
+	return ttl
+}
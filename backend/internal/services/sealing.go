@@ -0,0 +1,70 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix marks values encrypted at rest
+const sealedPrefix = "sealed:v1:"
+
+// Sealer encrypts values stored in the database with AES-GCM, under a key
+// derived from a secret the API replicas and worker processes share
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer creates a sealer whose key is derived from secret and purpose, so
+// values sealed for one purpose can't be opened as another's
+func NewSealer(secret, purpose string) *Sealer {
+	key := sha256.Sum256([]byte(purpose + ":" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(fmt.Sprintf("failed to create %s cipher: %v", purpose, err))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create %s cipher: %v", purpose, err))
+	}
+	return &Sealer{aead: aead}
+}
+
+// Seal encrypts value, bound to the record it is stored in so it can't be
+// moved to another
+func (s *Sealer) Seal(value []byte, record string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := s.aead.Seal(nonce, nonce, value, []byte(record))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed for record. Values stored before they were
+// sealed are returned as they are.
+func (s *Sealer) Open(value, record string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, sealedPrefix)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("invalid sealed value")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	opened, err := s.aead.Open(nil, nonce, ciphertext, []byte(record))
+	if err != nil {
+		return "", err
+	}
+	return string(opened), nil
+}
+
+// IsSealed reports whether a stored value is sealed
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
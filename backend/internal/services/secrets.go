@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// SecretRefPrefix starts every secret reference in chart values, e.g.
+// ref+k8s://monitoring/grafana-admin#password, ref+vault://secret/data/grafana#password
+// or ref+sops://grafana.enc.yaml#admin.password
+const SecretRefPrefix = "ref+"
+
+// generatedPasswordLength is the length of passwords generated for references
+// that replaced plaintext
+const generatedPasswordLength = 24
+
+var (
+	// sensitiveValueKey matches value keys that hold credentials
+	sensitiveValueKey = regexp.MustCompile(`(?i)(password|passwd|apikey|api_key|secretkey|secret_key|accesskey|access_key|clientsecret|client_secret|token)$`)
+	// secretKeyInvalid matches characters Kubernetes doesn't allow in secret keys
+	secretKeyInvalid = regexp.MustCompile(`[^-._a-zA-Z0-9]`)
+)
+
+// SecretBackends configures the stores secret references resolve against.
+// Kubernetes Secrets of the target cluster are always available.
+type SecretBackends struct {
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+	// SOPSDir holds the SOPS-encrypted files ref+sops:// references name
+	SOPSDir string
+}
+
+// SecretsService resolves secret references in chart values when charts are
+// installed, so plans only ever hold references
+type SecretsService struct {
+	backends   SecretBackends
+	httpClient *http.Client
+}
+
+// NewSecretsService creates a new secrets service
+func NewSecretsService(backends SecretBackends) *SecretsService {
+	return &SecretsService{
+		backends:   backends,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// secretRef is a parsed secret reference
+type secretRef struct {
+	backend string
+	path    string
+	key     string
+	// generate creates a random value in the Kubernetes Secret when the key is missing
+	generate bool
+}
+
+// ScrubPlanSecrets replaces plaintext credentials in the plan's chart values
+// with references to a Kubernetes Secret per release, whose values are
+// generated when the chart is first installed. It returns the scrubbed
+// value paths.
+func ScrubPlanSecrets(plan *agent.DeploymentPlan) []string {
+	charts := make([]*agent.HelmChart, 0, len(plan.Charts)+len(plan.Steps))
+	for i := range plan.Charts {
+		charts = append(charts, &plan.Charts[i])
+	}
+	for _, step := range plan.Steps {
+		if step.Chart != nil {
+			charts = append(charts, step.Chart)
+		}
+	}
+
+	var scrubbed []string
+	for _, chart := range charts {
+		if chart.Values == nil {
+			continue
+		}
+		namespace := chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		secret := releaseName(chart) + "-generated-secrets"
+		for _, path := range scrubValues(chart.Values, "", namespace, secret) {
+			scrubbed = append(scrubbed, fmt.Sprintf("%s: %s", chart.Name, path))
+		}
+	}
+	return scrubbed
+}
+
+// scrubValues replaces plaintext credentials below a values node
+func scrubValues(node interface{}, path, namespace, secret string) []string {
+	var scrubbed []string
+	switch node := node.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			keyPath := joinValuePath(path, key)
+			if plaintext, ok := value.(string); ok && plaintext != "" && !IsSecretRef(plaintext) &&
+				sensitiveValueKey.MatchString(key) && !strings.HasPrefix(strings.ToLower(key), "existing") {
+				node[key] = fmt.Sprintf("%sk8s://%s/%s?generate=true#%s", SecretRefPrefix, namespace, secret, secretKeyInvalid.ReplaceAllString(keyPath, "_"))
+				scrubbed = append(scrubbed, keyPath)
+				continue
+			}
+			scrubbed = append(scrubbed, scrubValues(value, keyPath, namespace, secret)...)
+		}
+	case []interface{}:
+		for i, value := range node {
+			scrubbed = append(scrubbed, scrubValues(value, joinValuePath(path, strconv.Itoa(i)), namespace, secret)...)
+		}
+	}
+	return scrubbed
+}
+
+// IsSecretRef reports whether a value is a secret reference
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretRefPrefix)
+}
+
+// ResolveValues returns a copy of chart values with every secret reference
+// replaced by its value. Kubernetes references are read from the cluster of
+// the kubeconfig. It also returns the number of references resolved.
+func (s *SecretsService) ResolveValues(ctx context.Context, values map[string]interface{}, kubeconfig string) (map[string]interface{}, int, error) {
+	resolved, _ := copyValue(values).(map[string]interface{})
+	var client *kubernetes.KubernetesClient
+	count := 0
+
+	var resolve func(node interface{}) error
+	replace := func(value interface{}) (interface{}, error) {
+		reference, ok := value.(string)
+		if !ok || !IsSecretRef(reference) {
+			return value, resolve(value)
+		}
+		if client == nil && strings.HasPrefix(reference, SecretRefPrefix+"k8s://") {
+			var err error
+			if client, err = kubernetes.NewKubernetesClient(kubeconfig); err != nil {
+				return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+			}
+		}
+		secret, err := s.resolveRef(ctx, client, reference)
+		if err != nil {
+			return nil, err
+		}
+		count++
+		return secret, nil
+	}
+	resolve = func(node interface{}) error {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			for key, value := range node {
+				secret, err := replace(value)
+				if err != nil {
+					return err
+				}
+				node[key] = secret
+			}
+		case []interface{}:
+			for i, value := range node {
+				secret, err := replace(value)
+				if err != nil {
+					return err
+				}
+				node[i] = secret
+			}
+		}
+		return nil
+	}
+
+	if err := resolve(resolved); err != nil {
+		return nil, 0, err
+	}
+	return resolved, count, nil
+}
+
+// resolveRef reads the value of one reference from its backend
+func (s *SecretsService) resolveRef(ctx context.Context, client *kubernetes.KubernetesClient, reference string) (string, error) {
+	ref, err := parseSecretRef(reference)
+	if err != nil {
+		return "", err
+	}
+	switch ref.backend {
+	case "k8s":
+		return resolveKubernetesSecret(ctx, client, ref)
+	case "vault":
+		return s.resolveVaultSecret(ctx, ref)
+	case "sops":
+		return s.resolveSOPSSecret(ctx, ref)
+	}
+	return "", fmt.Errorf("unknown secret backend %q", ref.backend)
+}
+
+// parseSecretRef parses ref+<backend>://<path>[?generate=true]#<key>
+func parseSecretRef(reference string) (*secretRef, error) {
+	parsed, err := url.Parse(strings.TrimPrefix(reference, SecretRefPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret reference %q: %w", reference, err)
+	}
+	ref := &secretRef{
+		backend:  parsed.Scheme,
+		path:     strings.Trim(parsed.Host+parsed.Path, "/"),
+		key:      parsed.Fragment,
+		generate: parsed.Query().Get("generate") == "true",
+	}
+	if ref.path == "" || ref.key == "" {
+		return nil, fmt.Errorf("secret reference %q needs a path and a #key", reference)
+	}
+	return ref, nil
+}
+
+// resolveKubernetesSecret reads a key of a Secret in the target cluster,
+// generating it first when the reference asks for it
+func resolveKubernetesSecret(ctx context.Context, client *kubernetes.KubernetesClient, ref *secretRef) (string, error) {
+	namespace, name, ok := strings.Cut(ref.path, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("kubernetes secret references name namespace/secret, got %q", ref.path)
+	}
+
+	secret, err := client.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return "", err
+	}
+	if secret != nil {
+		if value, ok := secret.Data[ref.key]; ok {
+			return string(value), nil
+		}
+	}
+	if !ref.generate {
+		return "", fmt.Errorf("secret %s/%s has no key %s", namespace, name, ref.key)
+	}
+
+	value, err := generatePassword(generatedPasswordLength)
+	if err != nil {
+		return "", err
+	}
+	labels := map[string]string{"app.kubernetes.io/managed-by": "grafana-ai-agent-platform"}
+	if err := client.SetSecretKey(ctx, namespace, name, ref.key, value, labels); err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// resolveVaultSecret reads a field of a Vault KV secret, version 1 or 2
+func (s *SecretsService) resolveVaultSecret(ctx context.Context, ref *secretRef) (string, error) {
+	if s.backends.VaultAddr == "" {
+		return "", fmt.Errorf("vault is not configured")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(s.backends.VaultAddr, "/")+"/v1/"+ref.path, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("X-Vault-Token", s.backends.VaultToken)
+	if s.backends.VaultNamespace != "" {
+		request.Header.Set("X-Vault-Namespace", s.backends.VaultNamespace)
+	}
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from vault: %w", ref.path, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", response.Status, ref.path)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	data := body.Data
+	// KV version 2 nests the secret under data.data next to its metadata
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	value, ok := data[ref.key]
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no key %s", ref.path, ref.key)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// resolveSOPSSecret decrypts a value of a SOPS-encrypted file. The key is the
+// dotted path of the value in the file.
+func (s *SecretsService) resolveSOPSSecret(ctx context.Context, ref *secretRef) (string, error) {
+	if s.backends.SOPSDir == "" {
+		return "", fmt.Errorf("sops is not configured")
+	}
+	file := filepath.Join(s.backends.SOPSDir, filepath.Clean("/"+ref.path))
+
+	var extract strings.Builder
+	for _, segment := range strings.Split(ref.key, ".") {
+		if index, err := strconv.Atoi(segment); err == nil {
+			fmt.Fprintf(&extract, "[%d]", index)
+		} else {
+			fmt.Fprintf(&extract, "[%q]", segment)
+		}
+	}
+
+	var stderr strings.Builder
+	cmd := exec.CommandContext(ctx, "sops", "--decrypt", "--extract", extract.String(), file)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("sops failed to decrypt %s#%s: %s", ref.path, ref.key, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSuffix(string(output), "\n"), nil
+}
+
+// generatePassword returns a random alphanumeric password
+func generatePassword(length int) (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	password := make([]byte, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate password: %w", err)
+		}
+		password[i] = alphabet[n.Int64()]
+	}
+	return string(password), nil
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// trivyBinary is the Trivy CLI images are scanned with
+const trivyBinary = "trivy"
+
+// severityRank orders vulnerability severities
+var severityRank = map[string]int{
+	agent.SeverityUnknown:  0,
+	agent.SeverityLow:      1,
+	agent.SeverityMedium:   2,
+	agent.SeverityHigh:     3,
+	agent.SeverityCritical: 4,
+}
+
+// SecurityPolicy decides which vulnerabilities block the deployment of a plan
+type SecurityPolicy struct {
+	// BlockSeverity blocks plans running an image with a vulnerability of this
+	// severity or above, e.g. "HIGH". Empty doesn't scan before deployments.
+	BlockSeverity string `json:"block_severity,omitempty"`
+	// IgnoreUnfixed doesn't block on vulnerabilities without a fixed version
+	IgnoreUnfixed bool `json:"ignore_unfixed,omitempty"`
+	// Ignore lists accepted vulnerability IDs, e.g. "CVE-2023-1234"
+	Ignore []string `json:"ignore,omitempty"`
+}
+
+// Validate checks the policy's severity and normalizes its case
+func (p *SecurityPolicy) Validate() error {
+	p.BlockSeverity = strings.ToUpper(strings.TrimSpace(p.BlockSeverity))
+	if _, ok := severityRank[p.BlockSeverity]; p.BlockSeverity != "" && !ok {
+		return fmt.Errorf("unknown severity %q, use one of UNKNOWN, LOW, MEDIUM, HIGH or CRITICAL", p.BlockSeverity)
+	}
+	return nil
+}
+
+// Enforced reports whether deployments are scanned and blocked by the policy
+func (p *SecurityPolicy) Enforced() bool {
+	return p != nil && p.BlockSeverity != ""
+}
+
+// Violations returns why a scanned plan may not be deployed, an entry per
+// image. Images that couldn't be scanned are violations too.
+func (p *SecurityPolicy) Violations(report *agent.SecurityReport) []string {
+	if !p.Enforced() {
+		return nil
+	}
+	ignored := make(map[string]bool, len(p.Ignore))
+	for _, id := range p.Ignore {
+		ignored[strings.ToUpper(id)] = true
+	}
+
+	var violations []string
+	for _, image := range report.Images {
+		if image.Error != "" {
+			violations = append(violations, fmt.Sprintf("%s: not scanned: %s", image.Image, image.Error))
+			continue
+		}
+		var blocking []string
+		for _, vulnerability := range image.Vulnerabilities {
+			if severityRank[vulnerability.Severity] < severityRank[p.BlockSeverity] || ignored[strings.ToUpper(vulnerability.ID)] {
+				continue
+			}
+			if p.IgnoreUnfixed && vulnerability.FixedVersion == "" {
+				continue
+			}
+			blocking = append(blocking, fmt.Sprintf("%s (%s in %s)", vulnerability.ID, vulnerability.Severity, vulnerability.Package))
+		}
+		if len(blocking) == 0 {
+			continue
+		}
+		listed := blocking
+		if len(listed) > 5 {
+			listed = append(listed[:5:5], fmt.Sprintf("%d more", len(blocking)-5))
+		}
+		violations = append(violations, fmt.Sprintf("%s: %d vulnerabilities of severity %s or above: %s", image.Image, len(blocking), p.BlockSeverity, strings.Join(listed, ", ")))
+	}
+	return violations
+}
+
+// SecurityScannerService scans the images of a plan's charts for known vulnerabilities
+type SecurityScannerService struct {
+	deploymentExecutor *DeploymentExecutorService
+}
+
+// NewSecurityScannerService creates a new security scanner service
+func NewSecurityScannerService(deploymentExecutor *DeploymentExecutorService) *SecurityScannerService {
+	return &SecurityScannerService{
+		deploymentExecutor: deploymentExecutor,
+	}
+}
+
+// ScanPlan renders each chart of the plan and scans the images its templates
+// reference with Trivy. Charts that can't be rendered and images that can't be
+// scanned are reported with their error.
+func (s *SecurityScannerService) ScanPlan(ctx context.Context, plan *agent.DeploymentPlan) (*agent.SecurityReport, error) {
+	if _, err := exec.LookPath(trivyBinary); err != nil {
+		return nil, fmt.Errorf("trivy not available: %w", err)
+	}
+
+	report := &agent.SecurityReport{
+		Scanner:   trivyBinary,
+		ScannedAt: time.Now(),
+		Summary:   make(map[string]int),
+		Images:    []agent.ImageScan{},
+	}
+	scanned := make(map[string]bool)
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			continue
+		}
+		manifest, err := s.deploymentExecutor.RenderChart(ctx, step.Chart, "default")
+		if err != nil {
+			report.Images = append(report.Images, agent.ImageScan{Chart: step.Chart.Name, Error: fmt.Sprintf("failed to render chart, images not scanned: %v", err)})
+			continue
+		}
+		objects, err := kubernetes.ParseManifest(manifest)
+		if err != nil {
+			report.Images = append(report.Images, agent.ImageScan{Chart: step.Chart.Name, Error: fmt.Sprintf("failed to parse rendered chart: %v", err)})
+			continue
+		}
+
+		for _, image := range workloadImages(objects) {
+			if scanned[image] {
+				continue
+			}
+			scanned[image] = true
+			ReportProgress(ctx, 0, "Scanning "+image)
+
+			scan := agent.ImageScan{Image: image, Chart: step.Chart.Name, Summary: make(map[string]int), Vulnerabilities: []agent.Vulnerability{}}
+			vulnerabilities, err := scanImage(ctx, image)
+			if err != nil {
+				scan.Error = err.Error()
+			}
+			for _, vulnerability := range vulnerabilities {
+				scan.Vulnerabilities = append(scan.Vulnerabilities, vulnerability)
+				scan.Summary[vulnerability.Severity]++
+				report.Summary[vulnerability.Severity]++
+			}
+			report.Images = append(report.Images, scan)
+		}
+	}
+	return report, nil
+}
+
+// trivyReport is the part of trivy's JSON output the scanner reads
+type trivyReport struct {
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+			PrimaryURL       string `json:"PrimaryURL"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// scanImage runs trivy against an image, most severe vulnerabilities first.
+// Registries with stored credentials are logged into.
+func scanImage(ctx context.Context, image string) ([]agent.Vulnerability, error) {
+	cmd := exec.CommandContext(ctx, trivyBinary, "image", "--quiet", "--format", "json", "--scanners", "vuln", image)
+	cmd.Env = os.Environ()
+	if credential, ok := registryCredential(ctx, ParseImageReference(image).Registry); ok {
+		cmd.Env = append(cmd.Env, "TRIVY_USERNAME="+credential.Username, "TRIVY_PASSWORD="+credential.Password)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("trivy failed: %s", lastLine(message))
+		}
+		return nil, fmt.Errorf("trivy failed: %w", err)
+	}
+
+	var parsed trivyReport
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse trivy output: %w", err)
+	}
+
+	var vulnerabilities []agent.Vulnerability
+	seen := make(map[string]bool)
+	for _, result := range parsed.Results {
+		for _, found := range result.Vulnerabilities {
+			key := found.VulnerabilityID + "/" + found.PkgName + "/" + found.InstalledVersion
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			severity := strings.ToUpper(found.Severity)
+			if _, ok := severityRank[severity]; !ok {
+				severity = agent.SeverityUnknown
+			}
+			vulnerabilities = append(vulnerabilities, agent.Vulnerability{
+				ID:               found.VulnerabilityID,
+				Package:          found.PkgName,
+				InstalledVersion: found.InstalledVersion,
+				FixedVersion:     found.FixedVersion,
+				Severity:         severity,
+				Title:            found.Title,
+				URL:              found.PrimaryURL,
+			})
+		}
+	}
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		return severityRank[vulnerabilities[i].Severity] > severityRank[vulnerabilities[j].Severity]
+	})
+	return vulnerabilities, nil
+}
+
+// lastLine returns the last line of multi-line CLI output, where errors are reported
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
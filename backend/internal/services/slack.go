@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"time"
+)
+
+// slackRequestMaxAge is how old a signed Slack request may be, against replays
+const slackRequestMaxAge = 5 * time.Minute
+
+// slackTextLimit is the most characters Slack shows in a section block
+const slackTextLimit = 3000
+
+// Slack interactive actions
+const (
+	SlackActionCreatePlan = "create_plan"
+	SlackActionDeployPlan = "deploy_plan"
+)
+
+// ErrInvalidSlackSignature fails requests that Slack didn't sign, or signed
+// too long ago
+var ErrInvalidSlackSignature = errors.New("invalid Slack request signature")
+
+// VerifySlackRequest checks the signature Slack sends with slash commands and
+// interactions: v0= and the hex HMAC-SHA256 of "v0:timestamp:body" keyed with
+// the app's signing secret
+func VerifySlackRequest(signingSecret, timestamp, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSlackSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return ErrInvalidSlackSignature
+	}
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSlackSignature
+	}
+	return nil
+}
+
+// SlackMessage is a message answering a slash command or interaction.
+// Ephemeral messages are only shown to the user who sent the command.
+type SlackMessage struct {
+	ResponseType    string       `json:"response_type,omitempty"` // ephemeral (default) or in_channel
+	ReplaceOriginal bool         `json:"replace_original,omitempty"`
+	Text            string       `json:"text"`
+	Blocks          []SlackBlock `json:"blocks,omitempty"`
+}
+
+// SlackBlock is a section of text or a row of buttons of a message
+type SlackBlock struct {
+	Type     string         `json:"type"` // section, actions or context
+	Text     *SlackText     `json:"text,omitempty"`
+	Elements []SlackElement `json:"elements,omitempty"`
+}
+
+// SlackText is text of a block or button, mrkdwn or plain_text
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackElement is a button of an actions block, or text of a context block
+type SlackElement struct {
+	Type     string       `json:"type"`
+	Text     interface{}  `json:"text,omitempty"`
+	ActionID string       `json:"action_id,omitempty"`
+	Value    string       `json:"value,omitempty"`
+	Style    string       `json:"style,omitempty"` // primary or danger
+	Confirm  *SlackDialog `json:"confirm,omitempty"`
+}
+
+// SlackDialog asks users to confirm a button before its action is sent
+type SlackDialog struct {
+	Title   SlackText `json:"title"`
+	Text    SlackText `json:"text"`
+	Confirm SlackText `json:"confirm"`
+	Deny    SlackText `json:"deny"`
+}
+
+// SlackSection returns a section block of mrkdwn text, shortened to what
+// Slack shows
+func SlackSection(text string) SlackBlock {
+	if runes := []rune(text); len(runes) > slackTextLimit {
+		text = string(runes[:slackTextLimit-1]) + "…"
+	}
+	return SlackBlock{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: text}}
+}
+
+// SlackContext returns a context block, the small print below a message
+func SlackContext(text string) SlackBlock {
+	return SlackBlock{Type: "context", Elements: []SlackElement{{Type: "mrkdwn", Text: text}}}
+}
+
+// SlackButton returns a button sending action with value when clicked
+func SlackButton(label, action, value string) SlackElement {
+	return SlackElement{
+		Type:     "button",
+		Text:     SlackText{Type: "plain_text", Text: label},
+		ActionID: action,
+		Value:    value,
+	}
+}
+
+// SlackConfirm returns a dialog asking to confirm a button
+func SlackConfirm(title, text, confirm string) *SlackDialog {
+	return &SlackDialog{
+		Title:   SlackText{Type: "plain_text", Text: title},
+		Text:    SlackText{Type: "mrkdwn", Text: text},
+		Confirm: SlackText{Type: "plain_text", Text: confirm},
+		Deny:    SlackText{Type: "plain_text", Text: "Cancel"},
+	}
+}
+
+// SlackResponder posts the delayed answers of slash commands and interactions
+// to their response URLs, which Slack accepts for 30 minutes
+type SlackResponder struct {
+	client *http.Client
+}
+
+// NewSlackResponder creates a new Slack responder
+func NewSlackResponder() *SlackResponder {
+	return &SlackResponder{client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Respond posts a message to a response URL. Only Slack's own URLs are
+// posted to, since they come with the request.
+func (r *SlackResponder) Respond(ctx context.Context, responseURL string, message SlackMessage) error {
+	u, err := neturl.Parse(responseURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() != "hooks.slack.com" {
+		return fmt.Errorf("invalid Slack response URL %q", responseURL)
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post Slack response: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("slack answered %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// GenerateSlackLinkCode returns a short code linking a Slack user to the
+// platform user who enters it, and its hash, which is what is stored
+func GenerateSlackLinkCode() (code, hash string, err error) {
+	secret := make([]byte, 5)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate link code: %w", err)
+	}
+	code = base32.StdEncoding.EncodeToString(secret)
+	return code, HashSlackLinkCode(code), nil
+}
+
+// HashSlackLinkCode hashes a link code the way it is stored
+func HashSlackLinkCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
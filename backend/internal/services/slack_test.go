@@ -0,0 +1,52 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signSlackRequest signs a request body like Slack does
+func signSlackRequest(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// TestVerifySlackRequest checks that only requests recently signed with the
+// app's signing secret are accepted
+func TestVerifySlackRequest(t *testing.T) {
+	const secret = "signing-secret"
+	body := []byte("command=%2Fdeploy&text=grafana")
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := signSlackRequest(secret, timestamp, body)
+
+	if err := VerifySlackRequest(secret, timestamp, signature, body, now.Add(time.Minute)); err != nil {
+		t.Fatalf("signed request was rejected: %v", err)
+	}
+
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	rejected := map[string]struct {
+		timestamp string
+		signature string
+		body      []byte
+	}{
+		"another secret":        {timestamp, signSlackRequest("other-secret", timestamp, body), body},
+		"changed body":          {timestamp, signature, []byte("command=%2Fdeploy&text=loki")},
+		"missing signature":     {timestamp, "", body},
+		"replayed request":      {stale, signSlackRequest(secret, stale, body), body},
+		"non-numeric timestamp": {"yesterday", signSlackRequest(secret, "yesterday", body), body},
+	}
+	for name, request := range rejected {
+		err := VerifySlackRequest(secret, request.timestamp, request.signature, request.body, now)
+		if !errors.Is(err, ErrInvalidSlackSignature) {
+			t.Errorf("%s: returned %v, want ErrInvalidSlackSignature", name, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// profileGrafanaChart installs Grafana with a stack whose cluster has none
+var profileGrafanaChart = agent.ProfileChart{
+	Name:        "grafana",
+	Repository:  "https://grafana.github.io/helm-charts",
+	Version:     "7.3.9",
+	ReleaseName: "grafana",
+	Description: "Grafana with the stack's datasource",
+	Values: map[string]interface{}{
+		"persistence": map[string]interface{}{"enabled": true, "size": "5Gi"},
+	},
+}
+
+// CreateProfilePlan creates the deployment plan of a named stack from its
+// curated charts. existingGrafana names the Grafana already serving the
+// cluster, which the stack's datasource is added to once it is deployed; with
+// none, Grafana is installed along with the stack, its datasource provisioned.
+func (s *HelmService) CreateProfilePlan(profile *agent.StackProfile, existingGrafana string, clusterAnalysis *agent.ClusterAnalysis, policy *ValuePolicy) (*agent.DeploymentPlan, error) {
+	plan := &agent.DeploymentPlan{
+		Name:        fmt.Sprintf("Deploy %s Stack", profile.Title),
+		Description: profile.Description,
+		Prerequisites: []string{
+			"Kubernetes cluster with sufficient resources",
+			"A default storage class for persistent volumes",
+		},
+		Risks: []string{
+			"Resource consumption may impact other workloads",
+		},
+	}
+
+	charts := append([]agent.ProfileChart{}, profile.Charts...)
+	if profile.Datasource != nil {
+		if existingGrafana != "" {
+			plan.Prerequisites = append(plan.Prerequisites, fmt.Sprintf("Grafana %s gets the %s datasource once %s is deployed", existingGrafana, profile.Datasource.Name, profile.Datasource.Chart))
+		} else {
+			charts = append(charts, provisionedGrafanaChart(profile.Datasource))
+		}
+	}
+	plan.EstimatedTime = fmt.Sprintf("%d-%d minutes", len(charts)*3, len(charts)*6)
+
+	stepIDs := make(map[string]string, len(charts))
+	for i, chart := range charts {
+		stepIDs[chart.ReleaseName] = fmt.Sprintf("step-%d", i+1)
+	}
+	for _, chart := range charts {
+		step := agent.DeploymentStep{
+			ID:          stepIDs[chart.ReleaseName],
+			Name:        fmt.Sprintf("Deploy %s", chart.Name),
+			Description: chart.Description,
+			Chart: &agent.HelmChart{
+				Name:        chart.Name,
+				Repository:  chart.Repository,
+				Version:     chart.Version,
+				ReleaseName: chart.ReleaseName,
+				Namespace:   profile.Namespace,
+				Description: chart.Description,
+				// Plans must never share the profile's values
+				Values: copyValue(chart.Values).(map[string]interface{}),
+			},
+		}
+		for _, release := range chart.DependsOn {
+			step.DependsOn = append(step.DependsOn, stepIDs[release])
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	if err := s.PrepareGeneratedPlan(plan, clusterAnalysis, policy); err != nil {
+		return nil, err
+	}
+	plan.ID = fmt.Sprintf("plan-%s-%d", profile.Name, time.Now().Unix())
+	plan.Template = profile.Template()
+	return plan, nil
+}
+
+// provisionedGrafanaChart is the Grafana chart installed after the release
+// serving datasource, with the datasource provisioned as its default
+func provisionedGrafanaChart(datasource *agent.ProfileDatasource) agent.ProfileChart {
+	chart := profileGrafanaChart
+	chart.Values = copyValue(profileGrafanaChart.Values).(map[string]interface{})
+	chart.Values["datasources"] = map[string]interface{}{
+		"datasources.yaml": map[string]interface{}{
+			"apiVersion": 1,
+			"datasources": []interface{}{
+				map[string]interface{}{
+					"name":      datasource.Name,
+					"type":      datasource.Type,
+					"url":       datasource.URL,
+					"access":    "proxy",
+					"isDefault": true,
+				},
+			},
+		},
+	}
+	chart.DependsOn = []string{datasource.Chart}
+	return chart
+}
+
+type grafanaEndpointsKey struct{}
+
+// WithGrafanaEndpoints returns a context whose deployments add the datasources
+// of stack profiles to the given Grafana instances
+func WithGrafanaEndpoints(ctx context.Context, endpoints []GrafanaEndpoint) context.Context {
+	return context.WithValue(ctx, grafanaEndpointsKey{}, endpoints)
+}
+
+// ProfileDatasourceStep adds the datasource of a stack profile to the cluster's
+// existing Grafana instances once the chart serving it is installed
+type ProfileDatasourceStep struct{}
+
+// NewProfileDatasourceStep creates a new profile datasource step
+func NewProfileDatasourceStep() *ProfileDatasourceStep {
+	return &ProfileDatasourceStep{}
+}
+
+// Name identifies the step in execution results
+func (s *ProfileDatasourceStep) Name() string {
+	return "profile-datasource"
+}
+
+// Applies reports whether the chart serves the datasource of a stack profile
+func (s *ProfileDatasourceStep) Applies(chart *agent.HelmChart) bool {
+	return profileDatasource(chart) != nil
+}
+
+// Run creates the datasource on every Grafana of the deployment's context,
+// pointing at the service of the installed release
+func (s *ProfileDatasourceStep) Run(ctx context.Context, chart *agent.HelmChart, kubeconfig string, result *agent.PostDeployResult) error {
+	endpoints, _ := ctx.Value(grafanaEndpointsKey{}).([]GrafanaEndpoint)
+	if len(endpoints) == 0 {
+		result.Logs = append(result.Logs, "The cluster has no registered Grafana, skipping datasource")
+		return nil
+	}
+	datasource := profileDatasource(chart)
+
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	release := chart.ReleaseName
+	if release == "" {
+		release = chart.Name
+	}
+	url := datasource.URL
+	service, err := findServiceBySelectors(client, []string{
+		fmt.Sprintf("app.kubernetes.io/instance=%s,app.kubernetes.io/component=gateway", release),
+		fmt.Sprintf("app.kubernetes.io/instance=%s", release),
+	})
+	if err == nil {
+		url = fmt.Sprintf("http://%s.%s.svc:%d", service.Name, service.Namespace, servicePort(service))
+	}
+	result.Outputs["url"] = url
+
+	var provisioned []string
+	for _, endpoint := range endpoints {
+		name := endpoint.ExternalURL
+		if name == "" {
+			name = fmt.Sprintf("%s/%s", endpoint.Namespace, endpoint.Service)
+		}
+		if err := s.createDatasource(ctx, endpoint, name, kubeconfig, GrafanaDatasource{Name: datasource.Name, Type: datasource.Type, URL: url, Access: "proxy"}, result); err != nil {
+			return fmt.Errorf("failed to add datasource to grafana %s: %w", name, err)
+		}
+		provisioned = append(provisioned, name)
+	}
+	result.Outputs["grafana"] = strings.Join(provisioned, ",")
+	return nil
+}
+
+// createDatasource adds the datasource to the Grafana of endpoint, called name in logs
+func (s *ProfileDatasourceStep) createDatasource(ctx context.Context, endpoint GrafanaEndpoint, name, kubeconfig string, datasource GrafanaDatasource, result *agent.PostDeployResult) error {
+	grafana, closeGrafana, err := ConnectGrafana(ctx, endpoint, kubeconfig)
+	if err != nil {
+		return err
+	}
+	defer closeGrafana()
+
+	created, err := grafana.CreateDatasource(ctx, datasource)
+	if err != nil {
+		return err
+	}
+	if created {
+		result.Logs = append(result.Logs, fmt.Sprintf("Created datasource %s -> %s on Grafana %s", datasource.Name, datasource.URL, name))
+	} else {
+		result.Logs = append(result.Logs, fmt.Sprintf("Datasource %s already exists on Grafana %s", datasource.Name, name))
+	}
+	return nil
+}
+
+// profileDatasource returns the datasource of the stack profile whose chart
+// serves it, or nil
+func profileDatasource(chart *agent.HelmChart) *agent.ProfileDatasource {
+	for _, profile := range agent.StackProfiles {
+		if profile.Datasource == nil {
+			continue
+		}
+		for _, profileChart := range profile.Charts {
+			if profileChart.ReleaseName == profile.Datasource.Chart && profileChart.Name == chart.Name && profileChart.Repository == strings.TrimRight(chart.Repository, "/") {
+				return profile.Datasource
+			}
+		}
+	}
+	return nil
+}
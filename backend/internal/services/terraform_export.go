@@ -0,0 +1,224 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+
+	"sigs.k8s.io/yaml"
+)
+
+// terraformHelmProvider is the helm provider version range the exported
+// module is written for
+const terraformHelmProvider = "~> 2.12"
+
+// terraformIdentifierInvalid matches characters Terraform doesn't allow in names
+var terraformIdentifierInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// TerraformExport renders a plan as a Terraform module of helm_release
+// resources with the generated values embedded, zipped for download. The
+// module works with OpenTofu as well. Steps other than charts are listed in
+// the module's README but not exported.
+func TerraformExport(plan *agent.DeploymentPlan, info ChangeRequestInfo) ([]byte, error) {
+	var main strings.Builder
+	fmt.Fprintf(&main, "# %s\n# Exported from deployment plan %s\n", hclComment(plan.Name), plan.ID)
+
+	var skipped []agent.DeploymentStep
+	names := make(map[string]bool)
+	previous := ""
+	for _, step := range plan.Steps {
+		if step.Chart == nil {
+			skipped = append(skipped, step)
+			continue
+		}
+		name := terraformName(releaseName(step.Chart), names)
+		if err := writeHelmRelease(&main, step, name, previous); err != nil {
+			return nil, err
+		}
+		previous = name
+	}
+	if previous == "" {
+		return nil, fmt.Errorf("plan %s has no chart steps to export", plan.ID)
+	}
+
+	files := []struct{ name, content string }{
+		{"versions.tf", terraformVersions},
+		{"providers.tf", terraformProviders},
+		{"variables.tf", terraformVariables},
+		{"main.tf", main.String()},
+		{"README.md", terraformReadme(plan, info, skipped)},
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	modified := time.Now()
+	if !info.CreatedAt.IsZero() {
+		modified = info.CreatedAt
+	}
+	for _, file := range files {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", file.name, err)
+		}
+		if _, err := writer.Write([]byte(file.content)); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeHelmRelease writes the helm_release of a chart step, depending on the
+// release before it so Terraform installs them in the plan's order
+func writeHelmRelease(b *strings.Builder, step agent.DeploymentStep, name, previous string) error {
+	chart := step.Chart
+	namespace := chart.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	fmt.Fprintf(b, "\n# %s\n", hclComment(step.Name))
+	fmt.Fprintf(b, "resource \"helm_release\" %q {\n", name)
+	fmt.Fprintf(b, "  name             = %s\n", hclString(releaseName(chart)))
+	repository, chartName := terraformChartSource(chart)
+	if repository != "" {
+		fmt.Fprintf(b, "  repository       = %s\n", hclString(repository))
+	}
+	fmt.Fprintf(b, "  chart            = %s\n", hclString(chartName))
+	if chart.Version != "" {
+		fmt.Fprintf(b, "  version          = %s\n", hclString(chart.Version))
+	}
+	fmt.Fprintf(b, "  namespace        = %s\n", hclString(namespace))
+	b.WriteString("  create_namespace = true\n")
+
+	if len(chart.Values) > 0 {
+		values, err := yaml.Marshal(chart.Values)
+		if err != nil {
+			return fmt.Errorf("failed to encode values of %s: %w", chart.Name, err)
+		}
+		b.WriteString("\n  values = [\n    <<-VALUES\n")
+		for _, line := range strings.Split(strings.TrimRight(string(values), "\n"), "\n") {
+			fmt.Fprintf(b, "    %s\n", hclTemplateEscape(line))
+		}
+		b.WriteString("    VALUES\n  ]\n")
+	}
+
+	if previous != "" {
+		fmt.Fprintf(b, "\n  depends_on = [helm_release.%s]\n", previous)
+	}
+	b.WriteString("}\n")
+	return nil
+}
+
+// terraformChartSource returns the repository and chart attributes of a
+// helm_release. OCI charts name their registry path as the repository.
+func terraformChartSource(chart *agent.HelmChart) (string, string) {
+	if IsOCIChart(chart) {
+		reference := ociChartReference(chart)
+		i := strings.LastIndex(reference, "/")
+		return reference[:i], reference[i+1:]
+	}
+	return chart.Repository, chart.Name
+}
+
+// terraformName returns a unique resource name for a release
+func terraformName(release string, used map[string]bool) string {
+	name := terraformIdentifierInvalid.ReplaceAllString(release, "_")
+	if name == "" || !(name[0] == '_' || name[0] >= 'A' && name[0] <= 'Z' || name[0] >= 'a' && name[0] <= 'z') {
+		name = "release_" + name
+	}
+	unique := name
+	for i := 2; used[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[unique] = true
+	return unique
+}
+
+// hclString quotes a string for HCL, escaping template sequences
+func hclString(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + hclTemplateEscape(replacer.Replace(value)) + `"`
+}
+
+// hclTemplateEscape keeps ${ and %{ literal in HCL strings and heredocs
+func hclTemplateEscape(value string) string {
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(value)
+}
+
+// hclComment keeps text on one comment line
+func hclComment(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// terraformReadme describes the exported module and the steps it leaves out
+func terraformReadme(plan *agent.DeploymentPlan, info ChangeRequestInfo, skipped []agent.DeploymentStep) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", plan.Name)
+	fmt.Fprintf(&b, "Terraform module exported from deployment plan `%s`.\n", plan.ID)
+	if info.Query != "" {
+		fmt.Fprintf(&b, "\n- **Request:** %s\n", info.Query)
+	}
+	if info.Cluster != "" {
+		fmt.Fprintf(&b, "- **Cluster:** %s\n", info.Cluster)
+	}
+	if info.RequestedBy != "" {
+		fmt.Fprintf(&b, "- **Requested by:** %s\n", info.RequestedBy)
+	}
+
+	b.WriteString("\n## Usage\n\n```sh\nterraform init   # or: tofu init\n")
+	b.WriteString("terraform apply -var kubeconfig_path=~/.kube/config\n```\n")
+	b.WriteString("\nReleases are installed in the plan's order. Set `kube_context` to pick a context of the kubeconfig.\n")
+
+	if len(skipped) > 0 {
+		b.WriteString("\n## Steps not exported\n\nThese steps are not Helm charts and must be applied separately:\n\n")
+		for _, step := range skipped {
+			fmt.Fprintf(&b, "- %s", step.Name)
+			if step.Description != "" {
+				fmt.Fprintf(&b, ": %s", step.Description)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+var terraformVersions = fmt.Sprintf(`terraform {
+  required_version = ">= 1.3"
+
+  required_providers {
+    helm = {
+      source  = "hashicorp/helm"
+      version = "%s"
+    }
+  }
+}
+`, terraformHelmProvider)
+
+const terraformProviders = `provider "helm" {
+  kubernetes {
+    config_path    = var.kubeconfig_path
+    config_context = var.kube_context
+  }
+}
+`
+
+const terraformVariables = `variable "kubeconfig_path" {
+  description = "Path of the kubeconfig of the target cluster"
+  type        = string
+  default     = "~/.kube/config"
+}
+
+variable "kube_context" {
+  description = "Context of the kubeconfig to use; the current context when null"
+  type        = string
+  default     = null
+}
+`
@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// maxTroubleshootPods bounds how many pods are examined, unhealthy ones first
+	maxTroubleshootPods = 10
+	// maxTroubleshootEvents keeps the most recent events
+	maxTroubleshootEvents = 40
+	// troubleshootLogLines is how many log lines are read per container
+	troubleshootLogLines = 60
+	// maxLogBytes truncates each container log sent to the model
+	maxLogBytes = 4000
+)
+
+// TroubleshooterService gathers evidence about a failing workload and asks the
+// model for a root cause
+type TroubleshooterService struct {
+	aiAgent *agent.AIAgent
+}
+
+// NewTroubleshooterService creates a new troubleshooter service
+func NewTroubleshooterService(aiAgent *agent.AIAgent) *TroubleshooterService {
+	return &TroubleshooterService{
+		aiAgent: aiAgent,
+	}
+}
+
+// TroubleshootEvidence is what was collected from the cluster
+type TroubleshootEvidence struct {
+	Namespace    string             `json:"namespace"`
+	Workload     string             `json:"workload,omitempty"`
+	WorkloadKind string             `json:"workload_kind,omitempty"`
+	Selector     string             `json:"selector,omitempty"`
+	Pods         []PodEvidence      `json:"pods"`
+	TotalPods    int                `json:"total_pods"`
+	Events       []EventEvidence    `json:"events"`
+	Nodes        []NodePressureInfo `json:"nodes,omitempty"`
+	// Errors lists evidence that could not be collected
+	Errors      []string  `json:"errors,omitempty"`
+	CollectedAt time.Time `json:"collected_at"`
+}
+
+// PodEvidence describes a pod's state
+type PodEvidence struct {
+	Name       string              `json:"name"`
+	Phase      string              `json:"phase"`
+	Node       string              `json:"node,omitempty"`
+	Ready      bool                `json:"ready"`
+	Reason     string              `json:"reason,omitempty"`
+	Message    string              `json:"message,omitempty"`
+	Containers []ContainerEvidence `json:"containers"`
+}
+
+// ContainerEvidence describes a container's state, resources and recent logs
+type ContainerEvidence struct {
+	Name         string            `json:"name"`
+	Init         bool              `json:"init,omitempty"`
+	State        string            `json:"state"` // running, waiting, terminated
+	Reason       string            `json:"reason,omitempty"`
+	Message      string            `json:"message,omitempty"`
+	ExitCode     int32             `json:"exit_code,omitempty"`
+	LastReason   string            `json:"last_termination_reason,omitempty"`
+	Restarts     int32             `json:"restarts"`
+	Ready        bool              `json:"ready"`
+	Requests     map[string]string `json:"requests,omitempty"`
+	Limits       map[string]string `json:"limits,omitempty"`
+	Logs         string            `json:"logs,omitempty"`
+	PreviousLogs string            `json:"previous_logs,omitempty"`
+}
+
+// EventEvidence is a Kubernetes event related to the workload
+type EventEvidence struct {
+	Type     string    `json:"type"`
+	Reason   string    `json:"reason"`
+	Object   string    `json:"object"`
+	Message  string    `json:"message"`
+	Count    int32     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// NodePressureInfo lists the adverse conditions of a node hosting examined pods
+type NodePressureInfo struct {
+	Node       string   `json:"node"`
+	Conditions []string `json:"conditions"`
+}
+
+// TroubleshootReport is the model's diagnosis
+type TroubleshootReport struct {
+	Summary     string   `json:"summary"`
+	RootCause   string   `json:"root_cause"`
+	Confidence  string   `json:"confidence"` // high, medium, low
+	Evidence    []string `json:"evidence"`
+	Remediation []string `json:"remediation"`
+	Commands    []string `json:"commands"`
+}
+
+// WorkloadAction is a remediation the troubleshooter offers to run on the
+// examined workload
+type WorkloadAction struct {
+	Action    string `json:"action"` // restart
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Reason    string `json:"reason"`
+}
+
+const troubleshootSystemPrompt = `You are a Kubernetes incident responder. You are given pod statuses, container states and logs, recent events and node conditions for a workload.
+
+Respond with JSON only:
+{"summary": "<one sentence>", "root_cause": "<most likely root cause>", "confidence": "high|medium|low",
+ "evidence": ["<facts from the input that support the root cause>"],
+ "remediation": ["<ordered steps to fix it>"],
+ "commands": ["<kubectl or helm commands that confirm or fix it>"]}
+
+Rules:
+- Base the root cause only on the given evidence and quote it; say what is missing when evidence is inconclusive and lower the confidence.
+- Distinguish application errors (logs, exit codes) from platform problems (scheduling, image pulls, probes, resources, node pressure).
+- Use the given namespace and names in commands.`
+
+// Gather collects evidence about a workload, or about every pod in the
+// namespace when no workload is given. A workload that is not a deployment,
+// statefulset or daemonset is matched against pod name prefixes.
+func (s *TroubleshooterService) Gather(ctx context.Context, client *kubernetes.KubernetesClient, namespace, workload string) (*TroubleshootEvidence, error) {
+	evidence := &TroubleshootEvidence{
+		Namespace:   namespace,
+		Workload:    workload,
+		Pods:        []PodEvidence{},
+		Events:      []EventEvidence{},
+		CollectedAt: time.Now(),
+	}
+
+	if workload != "" {
+		kind, selector, err := client.WorkloadSelector(ctx, namespace, workload)
+		if err == nil {
+			evidence.WorkloadKind = kind
+			evidence.Selector = selector
+		}
+	}
+
+	pods, err := client.ListPods(ctx, namespace, evidence.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if workload != "" && evidence.Selector == "" {
+		pods = podsWithPrefix(pods, workload)
+	}
+	evidence.TotalPods = len(pods)
+	if workload != "" && len(pods) == 0 {
+		return nil, fmt.Errorf("no workload or pods named %s in namespace %s", workload, namespace)
+	}
+
+	sort.SliceStable(pods, func(i, j int) bool { return podSeverity(&pods[i]) > podSeverity(&pods[j]) })
+	if len(pods) > maxTroubleshootPods {
+		pods = pods[:maxTroubleshootPods]
+	}
+
+	related := make(map[string]bool)
+	if workload != "" {
+		related[workload] = true
+	}
+	nodeNames := make(map[string]bool)
+	for i := range pods {
+		pod := &pods[i]
+		related[pod.Name] = true
+		if pod.Spec.NodeName != "" {
+			nodeNames[pod.Spec.NodeName] = true
+		}
+		evidence.Pods = append(evidence.Pods, s.podEvidence(ctx, client, pod, evidence))
+	}
+
+	events, err := client.ListEvents(ctx, namespace)
+	if err != nil {
+		evidence.Errors = append(evidence.Errors, err.Error())
+	}
+	for _, event := range events {
+		if workload != "" && !eventRelated(event, related) {
+			continue
+		}
+		if workload == "" && event.Type != corev1.EventTypeWarning {
+			continue
+		}
+		evidence.Events = append(evidence.Events, EventEvidence{
+			Type:     event.Type,
+			Reason:   event.Reason,
+			Object:   fmt.Sprintf("%s/%s", event.InvolvedObject.Kind, event.InvolvedObject.Name),
+			Message:  event.Message,
+			Count:    event.Count,
+			LastSeen: kubernetes.EventTime(event),
+		})
+	}
+	if len(evidence.Events) > maxTroubleshootEvents {
+		evidence.Events = evidence.Events[len(evidence.Events)-maxTroubleshootEvents:]
+	}
+
+	if len(nodeNames) > 0 {
+		nodes, err := client.ListNodes(ctx)
+		if err != nil {
+			evidence.Errors = append(evidence.Errors, err.Error())
+		}
+		for _, node := range nodes {
+			if !nodeNames[node.Name] {
+				continue
+			}
+			if conditions := adverseNodeConditions(&node); len(conditions) > 0 {
+				evidence.Nodes = append(evidence.Nodes, NodePressureInfo{Node: node.Name, Conditions: conditions})
+			}
+		}
+	}
+
+	return evidence, nil
+}
+
+// Diagnose asks the model for a root cause hypothesis from the evidence
+func (s *TroubleshooterService) Diagnose(ctx context.Context, evidence *TroubleshootEvidence, question string) (*TroubleshootReport, error) {
+	encoded, err := json.MarshalIndent(evidence, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode evidence: %w", err)
+	}
+
+	userMessage := fmt.Sprintf("Evidence:\n%s", encoded)
+	if question != "" {
+		userMessage = fmt.Sprintf("Reported problem: %s\n\n%s", question, userMessage)
+	}
+
+	response, err := s.aiAgent.Complete(ctx, troubleshootSystemPrompt, userMessage)
+	if err != nil {
+		return nil, err
+	}
+
+	block := agent.ExtractJSONBlock(response)
+	if block == "" {
+		return nil, fmt.Errorf("model response did not contain a diagnosis")
+	}
+	var report TroubleshootReport
+	if err := json.Unmarshal([]byte(block), &report); err != nil {
+		return nil, fmt.Errorf("model returned invalid diagnosis JSON: %w", err)
+	}
+	if strings.TrimSpace(report.RootCause) == "" {
+		return nil, fmt.Errorf("model returned no root cause")
+	}
+	return &report, nil
+}
+
+// SuggestActions returns the workload actions worth offering for the evidence:
+// a restart when containers of a deployment, statefulset or daemonset are
+// crash looping, which clears failures caused by something transient
+func SuggestActions(evidence *TroubleshootEvidence) []WorkloadAction {
+	if evidence.WorkloadKind == "" {
+		return nil
+	}
+	crashLooping := 0
+	for _, pod := range evidence.Pods {
+		for _, container := range pod.Containers {
+			if container.Reason == "CrashLoopBackOff" {
+				crashLooping++
+			}
+		}
+	}
+	if crashLooping == 0 {
+		return nil
+	}
+	return []WorkloadAction{{
+		Action:    "restart",
+		Kind:      evidence.WorkloadKind,
+		Namespace: evidence.Namespace,
+		Name:      evidence.Workload,
+		Reason:    fmt.Sprintf("%d container(s) are in CrashLoopBackOff; restarting recreates the pods, which helps when they failed on something that has since recovered", crashLooping),
+	}}
+}
+
+// podEvidence describes a pod, reading logs of containers that are unhealthy
+func (s *TroubleshooterService) podEvidence(ctx context.Context, client *kubernetes.KubernetesClient, pod *corev1.Pod, evidence *TroubleshootEvidence) PodEvidence {
+	result := PodEvidence{
+		Name:    pod.Name,
+		Phase:   string(pod.Status.Phase),
+		Node:    pod.Spec.NodeName,
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			result.Ready = condition.Status == corev1.ConditionTrue
+		}
+		if condition.Type == corev1.PodScheduled && condition.Status != corev1.ConditionTrue && result.Message == "" {
+			result.Message = condition.Message
+		}
+	}
+
+	specs := make(map[string]corev1.Container)
+	for _, container := range pod.Spec.InitContainers {
+		specs[container.Name] = container
+	}
+	for _, container := range pod.Spec.Containers {
+		specs[container.Name] = container
+	}
+
+	addContainer := func(status corev1.ContainerStatus, init bool) {
+		container := containerEvidence(status, specs[status.Name])
+		container.Init = init
+
+		unhealthy := !status.Ready && !(init && status.State.Terminated != nil && status.State.Terminated.ExitCode == 0)
+		if unhealthy || status.RestartCount > 0 {
+			if status.State.Waiting == nil || status.State.Waiting.Reason != "ContainerCreating" {
+				logs, err := client.GetPodLogs(ctx, pod.Namespace, pod.Name, status.Name, troubleshootLogLines, false)
+				if err != nil {
+					evidence.Errors = append(evidence.Errors, err.Error())
+				}
+				container.Logs = truncateLog(logs)
+			}
+		}
+		if status.RestartCount > 0 {
+			logs, err := client.GetPodLogs(ctx, pod.Namespace, pod.Name, status.Name, troubleshootLogLines, true)
+			if err == nil {
+				container.PreviousLogs = truncateLog(logs)
+			}
+		}
+		result.Containers = append(result.Containers, container)
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		addContainer(status, true)
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		addContainer(status, false)
+	}
+
+	return result
+}
+
+// containerEvidence describes a container status with its resource settings
+func containerEvidence(status corev1.ContainerStatus, spec corev1.Container) ContainerEvidence {
+	container := ContainerEvidence{
+		Name:     status.Name,
+		Restarts: status.RestartCount,
+		Ready:    status.Ready,
+		Requests: resourceStrings(spec.Resources.Requests),
+		Limits:   resourceStrings(spec.Resources.Limits),
+	}
+	switch {
+	case status.State.Waiting != nil:
+		container.State = "waiting"
+		container.Reason = status.State.Waiting.Reason
+		container.Message = status.State.Waiting.Message
+	case status.State.Terminated != nil:
+		container.State = "terminated"
+		container.Reason = status.State.Terminated.Reason
+		container.Message = status.State.Terminated.Message
+		container.ExitCode = status.State.Terminated.ExitCode
+	default:
+		container.State = "running"
+	}
+	if last := status.LastTerminationState.Terminated; last != nil {
+		container.LastReason = last.Reason
+		if container.ExitCode == 0 {
+			container.ExitCode = last.ExitCode
+		}
+	}
+	return container
+}
+
+func resourceStrings(resources corev1.ResourceList) map[string]string {
+	if len(resources) == 0 {
+		return nil
+	}
+	values := make(map[string]string, len(resources))
+	for name, quantity := range resources {
+		values[string(name)] = quantity.String()
+	}
+	return values
+}
+
+// podSeverity ranks pods so the unhealthiest are examined first
+func podSeverity(pod *corev1.Pod) int {
+	severity := 0
+	switch pod.Status.Phase {
+	case corev1.PodFailed:
+		severity += 4
+	case corev1.PodPending, corev1.PodUnknown:
+		severity += 3
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if !status.Ready {
+			severity += 2
+		}
+		if status.RestartCount > 0 {
+			severity++
+		}
+	}
+	return severity
+}
+
+func podsWithPrefix(pods []corev1.Pod, prefix string) []corev1.Pod {
+	var matched []corev1.Pod
+	for _, pod := range pods {
+		if strings.HasPrefix(pod.Name, prefix) {
+			matched = append(matched, pod)
+		}
+	}
+	return matched
+}
+
+// eventRelated reports whether an event concerns the workload, its pods or the
+// replica sets between them, whose names extend the workload name
+func eventRelated(event corev1.Event, related map[string]bool) bool {
+	name := event.InvolvedObject.Name
+	if related[name] {
+		return true
+	}
+	for relatedName := range related {
+		if strings.HasPrefix(name, relatedName+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// adverseNodeConditions lists pressure conditions that are true and a Ready
+// condition that isn't
+func adverseNodeConditions(node *corev1.Node) []string {
+	var conditions []string
+	for _, condition := range node.Status.Conditions {
+		adverse := condition.Status == corev1.ConditionTrue
+		if condition.Type == corev1.NodeReady {
+			adverse = condition.Status != corev1.ConditionTrue
+		}
+		if adverse {
+			conditions = append(conditions, fmt.Sprintf("%s=%s: %s", condition.Type, condition.Status, condition.Message))
+		}
+	}
+	return conditions
+}
+
+// truncateLog keeps the end of a log, where the failure usually is
+func truncateLog(logs string) string {
+	if len(logs) <= maxLogBytes {
+		return logs
+	}
+	return "...\n" + logs[len(logs)-maxLogBytes:]
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/pkg/kubernetes"
+)
+
+// UninstallOptions selects what an uninstall removes besides the releases
+type UninstallOptions struct {
+	// DeletePVCs deletes the volume claims the releases leave behind, like
+	// those of StatefulSets, and with them their data
+	DeletePVCs bool `json:"delete_pvcs"`
+	// DeleteNamespaces deletes the namespaces of the releases once no release
+	// or pod is left in them
+	DeleteNamespaces bool `json:"delete_namespaces"`
+}
+
+// UninstallDeployment removes the Helm releases a deployment installed, steps
+// depending on others before them, and records the removal as an execution of its own. Steps
+// that upgraded existing releases, applied manifests or ran commands are left
+// alone. Every release is attempted even when one fails.
+func (s *DeploymentExecutorService) UninstallDeployment(ctx context.Context, deployment *agent.DeploymentExecution, plan *agent.DeploymentPlan, kubeconfig string, options UninstallOptions) (*agent.DeploymentExecution, error) {
+	if len(plan.Steps) != len(deployment.Steps) {
+		return nil, fmt.Errorf("plan has %d steps but execution has %d", len(plan.Steps), len(deployment.Steps))
+	}
+	if err := s.ensureHelmInstalled(); err != nil {
+		return nil, fmt.Errorf("helm not available: %w", err)
+	}
+	client, err := kubernetes.NewKubernetesClient(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to cluster: %w", err)
+	}
+	kubeconfigFile, err := writeKubeconfigFile(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(kubeconfigFile)
+
+	execution := &agent.DeploymentExecution{
+		ID:         fmt.Sprintf("exec-%d", time.Now().UnixNano()),
+		PlanID:     plan.ID,
+		Status:     "running",
+		StartTime:  time.Now(),
+		Steps:      []agent.DeploymentStepExecution{},
+		Logs:       []string{fmt.Sprintf("Uninstalling deployment %s of %s", deployment.ID, plan.Name)},
+		Action:     "uninstall",
+		Uninstalls: deployment.ID,
+	}
+
+	order, err := uninstallOrder(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	var charts []*agent.HelmChart
+	for _, i := range order {
+		step := plan.Steps[i]
+		switch {
+		case !startedStep(deployment.Steps[i]):
+			continue
+		case step.Chart == nil:
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Skipping step %s: only Helm releases are uninstalled", step.ID))
+			continue
+		case step.Action == "upgrade" || deployment.Steps[i].ExistingRelease:
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Skipping step %s: it upgraded release %s, which existed before the deployment", step.ID, releaseName(step.Chart)))
+			continue
+		}
+		charts = append(charts, step.Chart)
+		execution.Steps = append(execution.Steps, agent.DeploymentStepExecution{
+			StepID: "uninstall-" + step.ID,
+			Status: "pending",
+			Logs:   []string{},
+		})
+	}
+
+	var failed, namespaces []string
+	seen := make(map[string]bool)
+	for i, chart := range charts {
+		stepExec := &execution.Steps[i]
+		ReportProgress(ctx, i*100/len(charts), fmt.Sprintf("Uninstalling %s", releaseName(chart)))
+		start := time.Now()
+		stepExec.StartTime = &start
+		stepExec.Status = "running"
+		stepExec.Attempts = 1
+
+		namespace := chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+		if !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+
+		err := s.uninstallRelease(ctx, client, chart, namespace, kubeconfigFile, options, stepExec)
+		end := time.Now()
+		stepExec.EndTime = &end
+		if err != nil {
+			stepExec.Status = "failed"
+			stepExec.Error = err.Error()
+			failed = append(failed, releaseName(chart))
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Uninstalling %s failed: %v", releaseName(chart), err))
+			continue
+		}
+		stepExec.Status = "completed"
+		execution.Logs = append(execution.Logs, fmt.Sprintf("Uninstalled %s", releaseName(chart)))
+	}
+
+	if options.DeleteNamespaces {
+		for _, namespace := range namespaces {
+			if err := s.deleteOrphanedNamespace(ctx, client, namespace, kubeconfigFile, execution); err != nil {
+				failed = append(failed, "namespace "+namespace)
+				execution.Logs = append(execution.Logs, err.Error())
+			}
+		}
+	}
+
+	end := time.Now()
+	execution.EndTime = &end
+	if len(failed) > 0 {
+		execution.Status = "failed"
+		execution.Error = "Failed to uninstall " + strings.Join(failed, ", ")
+	} else {
+		execution.Status = "completed"
+		execution.Logs = append(execution.Logs, "Uninstall completed successfully")
+	}
+	return execution, nil
+}
+
+// cleanupAbortedRun uninstalls the releases an aborted execution installed, so
+// the cluster is left as it was before the deployment. Cleaned up steps are
+// marked uninstalled, and run again when the deployment is resumed.
+func (s *DeploymentExecutorService) cleanupAbortedRun(ctx context.Context, run *executionRun, plan *agent.DeploymentPlan, kubeconfig string) {
+	var order []int
+	var err error
+	run.apply(func(execution *agent.DeploymentExecution) {
+		order, err = uninstallOrder(execution)
+	})
+	if err != nil {
+		run.update(-1, func(execution *agent.DeploymentExecution) {
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Cleanup failed: %v", err))
+		})
+		return
+	}
+	kubeconfigFile, err := writeKubeconfigFile(kubeconfig)
+	if err != nil {
+		run.update(-1, func(execution *agent.DeploymentExecution) {
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Cleanup failed: %v", err))
+		})
+		return
+	}
+	defer os.Remove(kubeconfigFile)
+
+	run.log("Cleaning up the releases the deployment installed")
+	for _, i := range order {
+		step := plan.Steps[i]
+		stepExec := run.step(i)
+		if step.Chart == nil || !startedStep(stepExec) || step.Action == "upgrade" || stepExec.ExistingRelease {
+			continue
+		}
+		namespace := step.Chart.Namespace
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		// Volume claims are kept, they may hold data worth keeping
+		err := s.uninstallRelease(ctx, nil, step.Chart, namespace, kubeconfigFile, UninstallOptions{}, &stepExec)
+		run.update(i, func(execution *agent.DeploymentExecution) {
+			if err != nil {
+				execution.Logs = append(execution.Logs, fmt.Sprintf("Failed to uninstall %s: %v", releaseName(step.Chart), err))
+			} else {
+				stepExec.Status = "uninstalled"
+				execution.Logs = append(execution.Logs, fmt.Sprintf("Uninstalled %s", releaseName(step.Chart)))
+			}
+			execution.Steps[i] = stepExec
+		})
+	}
+}
+
+// uninstallOrder returns the indexes of an execution's steps with the steps
+// depending on others first, and of steps that could run together the later
+// one in the plan first
+func uninstallOrder(execution *agent.DeploymentExecution) ([]int, error) {
+	graph, err := execution.Graph()
+	if err != nil {
+		return nil, err
+	}
+	order := make([]int, len(execution.Steps))
+	for i := range order {
+		order[i] = len(order) - 1 - i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return graph.Nodes[order[a]].Level > graph.Nodes[order[b]].Level })
+	return order, nil
+}
+
+// startedStep reports whether a step ran and may have installed its release
+func startedStep(step agent.DeploymentStepExecution) bool {
+	switch step.Status {
+	case "pending", "skipped", "uninstalled":
+		return false
+	}
+	return true
+}
+
+// uninstallRelease uninstalls a chart's release, treating a release that is
+// already gone as uninstalled, and deletes its volume claims when asked. client
+// is only used for the volume claims.
+func (s *DeploymentExecutorService) uninstallRelease(ctx context.Context, client *kubernetes.KubernetesClient, chart *agent.HelmChart, namespace, kubeconfigFile string, options UninstallOptions, stepExec *agent.DeploymentStepExecution) error {
+	release := releaseName(chart)
+	stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Running helm uninstall %s in namespace %s", release, namespace))
+
+	cmd := exec.CommandContext(ctx, "helm", "uninstall", release, "--namespace", namespace, "--wait", "--timeout", "10m")
+	cmd.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", kubeconfigFile))
+	output, err := cmd.CombinedOutput()
+	switch {
+	case err != nil && strings.Contains(string(output), "not found"):
+		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Release %s is already gone", release))
+	case err != nil:
+		stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Helm uninstall failed: %s", strings.TrimSpace(string(output))))
+		return fmt.Errorf("helm uninstall failed: %w", err)
+	default:
+		stepExec.Logs = append(stepExec.Logs, strings.TrimSpace(string(output)))
+	}
+
+	if !options.DeletePVCs {
+		return nil
+	}
+	// Charts label their objects with the release under the recommended or the
+	// older Helm label
+	for _, selector := range []string{"app.kubernetes.io/instance=" + release, "release=" + release} {
+		deleted, err := client.DeletePersistentVolumeClaims(ctx, namespace, selector)
+		if len(deleted) > 0 {
+			stepExec.Logs = append(stepExec.Logs, fmt.Sprintf("Deleted persistent volume claims: %s", strings.Join(deleted, ", ")))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOrphanedNamespace deletes a namespace no release or pod is left in.
+// default and the kube- namespaces are never deleted.
+func (s *DeploymentExecutorService) deleteOrphanedNamespace(ctx context.Context, client *kubernetes.KubernetesClient, namespace, kubeconfigFile string, execution *agent.DeploymentExecution) error {
+	if namespace == "default" || strings.HasPrefix(namespace, "kube-") {
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, "helm", "list", "--namespace", namespace, "--all", "--short")
+	cmd.Env = append(os.Environ(), fmt.Sprintf("KUBECONFIG=%s", kubeconfigFile))
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list releases in namespace %s: %w", namespace, err)
+	}
+	if releases := strings.Fields(string(output)); len(releases) > 0 {
+		execution.Logs = append(execution.Logs, fmt.Sprintf("Keeping namespace %s: releases %s are still installed", namespace, strings.Join(releases, ", ")))
+		return nil
+	}
+
+	pods, err := client.ListPods(ctx, namespace, "")
+	if err != nil {
+		return err
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil {
+			execution.Logs = append(execution.Logs, fmt.Sprintf("Keeping namespace %s: pod %s still runs in it", namespace, pod.Name))
+			return nil
+		}
+	}
+
+	if err := client.DeleteNamespace(ctx, namespace); err != nil {
+		return err
+	}
+	execution.Logs = append(execution.Logs, fmt.Sprintf("Deleted namespace %s", namespace))
+	return nil
+}
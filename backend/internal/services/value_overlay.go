@@ -0,0 +1,66 @@
+package services
+
+import (
+	"grafana-ai-agent-platform/backend/internal/agent"
+)
+
+// ApplyValueOverlays merges the overlays of the environment a plan deploys to
+// into its charts' values, in order, so a plan generated once deploys with
+// each environment's settings. Overlays go over the generated values, but
+// never over the paths the value policy sets, which stay mandatory.
+func (s *HelmService) ApplyValueOverlays(plan *agent.DeploymentPlan, overlays []*agent.ValueOverlay, policy *ValuePolicy) {
+	if len(overlays) == 0 {
+		return
+	}
+	for i := range plan.Charts {
+		s.applyValueOverlays(&plan.Charts[i], overlays, policy)
+	}
+	for _, step := range plan.Steps {
+		if step.Chart != nil {
+			s.applyValueOverlays(step.Chart, overlays, policy)
+		}
+	}
+}
+
+// applyValueOverlays merges overlays into a chart's values, leaving the paths
+// the policy requires of the chart
+func (s *HelmService) applyValueOverlays(chart *agent.HelmChart, overlays []*agent.ValueOverlay, policy *ValuePolicy) {
+	mandatory := policyValues(chart.Name, policy)
+	for _, overlay := range overlays {
+		if overlay.IsEmpty() {
+			continue
+		}
+		if chart.Values == nil {
+			chart.Values = make(map[string]interface{})
+		}
+		// Copies keep the charts from sharing the overlay's maps
+		if len(overlay.Values) > 0 {
+			s.mergeValues(chart.Values, withoutPaths(deepMergeValues(nil, overlay.Values), mandatory))
+		}
+		if chartValues, ok := overlay.ChartValues[chart.Name]; ok {
+			s.mergeValues(chart.Values, withoutPaths(deepMergeValues(nil, chartValues), mandatory))
+		}
+	}
+}
+
+// withoutPaths returns values without the paths set in mandatory, recursing
+// into the maps both set
+func withoutPaths(values, mandatory map[string]interface{}) map[string]interface{} {
+	if len(mandatory) == 0 {
+		return values
+	}
+	kept := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		set, ok := mandatory[key]
+		if !ok {
+			kept[key] = value
+			continue
+		}
+		valueMap, isMap := value.(map[string]interface{})
+		setMap, setIsMap := set.(map[string]interface{})
+		if isMap && setIsMap {
+			kept[key] = withoutPaths(valueMap, setMap)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"sort"
+	"strings"
+)
+
+// ValuePolicy lists values an organization injects into every generated chart.
+// They are applied after all other customizations, so they always win.
+type ValuePolicy struct {
+	ImagePullSecrets  []string                 `json:"image_pull_secrets,omitempty"`
+	Tolerations       []map[string]interface{} `json:"tolerations,omitempty"`
+	PriorityClassName string                   `json:"priority_class_name,omitempty"`
+	// ProxyEnv holds HTTP_PROXY, HTTPS_PROXY and NO_PROXY style variables
+	ProxyEnv map[string]string `json:"proxy_env,omitempty"`
+	// Values are merged into every chart's values
+	Values map[string]interface{} `json:"values,omitempty"`
+	// ChartValues are merged into the values of the named chart only
+	ChartValues map[string]map[string]interface{} `json:"chart_values,omitempty"`
+}
+
+// IsEmpty reports whether the policy injects nothing
+func (p *ValuePolicy) IsEmpty() bool {
+	return p == nil || (len(p.ImagePullSecrets) == 0 && len(p.Tolerations) == 0 && p.PriorityClassName == "" &&
+		len(p.ProxyEnv) == 0 && len(p.Values) == 0 && len(p.ChartValues) == 0)
+}
+
+// MergeValuePolicies overlays a cluster override on the organization default.
+// Fields set on the override replace the default's; maps are merged by key.
+func MergeValuePolicies(orgDefault, clusterOverride *ValuePolicy) *ValuePolicy {
+	if orgDefault == nil {
+		return clusterOverride
+	}
+	if clusterOverride == nil {
+		return orgDefault
+	}
+
+	merged := *orgDefault
+	if clusterOverride.ImagePullSecrets != nil {
+		merged.ImagePullSecrets = clusterOverride.ImagePullSecrets
+	}
+	if clusterOverride.Tolerations != nil {
+		merged.Tolerations = clusterOverride.Tolerations
+	}
+	if clusterOverride.PriorityClassName != "" {
+		merged.PriorityClassName = clusterOverride.PriorityClassName
+	}
+
+	if len(clusterOverride.ProxyEnv) > 0 {
+		merged.ProxyEnv = make(map[string]string, len(orgDefault.ProxyEnv)+len(clusterOverride.ProxyEnv))
+		for key, value := range orgDefault.ProxyEnv {
+			merged.ProxyEnv[key] = value
+		}
+		for key, value := range clusterOverride.ProxyEnv {
+			merged.ProxyEnv[key] = value
+		}
+	}
+
+	if len(clusterOverride.Values) > 0 {
+		merged.Values = deepMergeValues(orgDefault.Values, clusterOverride.Values)
+	}
+	if len(clusterOverride.ChartValues) > 0 {
+		merged.ChartValues = make(map[string]map[string]interface{})
+		for chart, values := range orgDefault.ChartValues {
+			merged.ChartValues[chart] = values
+		}
+		for chart, values := range clusterOverride.ChartValues {
+			merged.ChartValues[chart] = deepMergeValues(merged.ChartValues[chart], values)
+		}
+	}
+
+	return &merged
+}
+
+// applyValuePolicy injects the policy's values at the top level and under
+// global, which most charts pass down to their subcharts
+func (s *HelmService) applyValuePolicy(values map[string]interface{}, chartName string, policy *ValuePolicy) {
+	if injected := policyValues(chartName, policy); len(injected) > 0 {
+		s.mergeValues(values, injected)
+	}
+}
+
+// policyValues returns the values the policy requires of a chart
+func policyValues(chartName string, policy *ValuePolicy) map[string]interface{} {
+	if policy.IsEmpty() {
+		return nil
+	}
+
+	injected := make(map[string]interface{})
+	global := make(map[string]interface{})
+
+	if len(policy.ImagePullSecrets) > 0 {
+		secrets := make([]interface{}, 0, len(policy.ImagePullSecrets))
+		for _, name := range policy.ImagePullSecrets {
+			secrets = append(secrets, map[string]interface{}{"name": name})
+		}
+		injected["imagePullSecrets"] = secrets
+		global["imagePullSecrets"] = secrets
+	}
+	if len(policy.Tolerations) > 0 {
+		tolerations := make([]interface{}, 0, len(policy.Tolerations))
+		for _, toleration := range policy.Tolerations {
+			tolerations = append(tolerations, toleration)
+		}
+		injected["tolerations"] = tolerations
+	}
+	if policy.PriorityClassName != "" {
+		injected["priorityClassName"] = policy.PriorityClassName
+		global["priorityClassName"] = policy.PriorityClassName
+	}
+	if len(policy.ProxyEnv) > 0 {
+		injected["extraEnv"] = proxyEnvVars(policy.ProxyEnv)
+	}
+	if len(global) > 0 {
+		injected["global"] = global
+	}
+
+	if len(policy.Values) > 0 {
+		injected = deepMergeValues(injected, policy.Values)
+	}
+	if chartValues, ok := policy.ChartValues[chartName]; ok {
+		injected = deepMergeValues(injected, chartValues)
+	}
+	return injected
+}
+
+// proxyEnvVars renders proxy variables as a container env list, adding the
+// lower-case spellings some tools read
+func proxyEnvVars(proxyEnv map[string]string) []interface{} {
+	names := make([]string, 0, len(proxyEnv))
+	for name := range proxyEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]interface{}, 0, len(names)*2)
+	for _, name := range names {
+		env = append(env, map[string]interface{}{"name": name, "value": proxyEnv[name]})
+		if lower := strings.ToLower(name); lower != name {
+			if _, ok := proxyEnv[lower]; !ok {
+				env = append(env, map[string]interface{}{"name": lower, "value": proxyEnv[name]})
+			}
+		}
+	}
+	return env
+}
+
+// deepMergeValues returns a copy of base with overlay merged in, recursing into maps
+func deepMergeValues(base, overlay map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(overlay))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range overlay {
+		if overlayMap, ok := value.(map[string]interface{}); ok {
+			baseMap, _ := merged[key].(map[string]interface{})
+			merged[key] = deepMergeValues(baseMap, overlayMap)
+			continue
+		}
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,242 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Tables of analytical records
+const (
+	TableEvents         = "platform_events"
+	TableClusterMetrics = "cluster_metrics"
+	TableLLMUsage       = "llm_usage"
+)
+
+// Sink drivers
+const (
+	DriverClickHouse  = "clickhouse"
+	DriverTimescaleDB = "timescaledb"
+)
+
+// Column types, mapped to native types by each driver
+const (
+	columnTime   = "time"
+	columnInt    = "int"
+	columnFloat  = "float"
+	columnString = "string"
+)
+
+type column struct {
+	name  string
+	ctype string
+}
+
+// schema lists the columns of each table. Every table is keyed by its time column.
+var schema = map[string][]column{
+	TableEvents: {
+		{"time", columnTime},
+		{"type", columnString},
+		{"user_id", columnInt},
+		{"organization_id", columnInt},
+		{"cluster_id", columnInt},
+		{"severity", columnString},
+		{"rule", columnString},
+		{"resource", columnString},
+		{"title", columnString},
+	},
+	TableClusterMetrics: {
+		{"time", columnTime},
+		{"cluster_id", columnInt},
+		{"user_id", columnInt},
+		{"version", columnString},
+		{"nodes", columnInt},
+		{"ready_nodes", columnInt},
+		{"cpu_cores", columnFloat},
+		{"memory_bytes", columnFloat},
+		{"available_cpu_cores", columnFloat},
+		{"available_memory_bytes", columnFloat},
+		{"policies", columnInt},
+	},
+	TableLLMUsage: {
+		{"time", columnTime},
+		{"model", columnString},
+		{"prompt_tokens", columnInt},
+		{"completion_tokens", columnInt},
+		{"total_tokens", columnInt},
+		{"duration_ms", columnInt},
+		{"error", columnString},
+		{"provider", columnString},
+		{"cost", columnFloat},
+	},
+}
+
+// Row is one analytical record, keyed by column name. Missing columns are
+// stored as their type's zero value.
+type Row map[string]interface{}
+
+// Sink is an append-only store for high-volume analytical records, kept apart
+// from the relational database holding transactional state
+type Sink interface {
+	// Migrate creates the tables that don't exist yet
+	Migrate(ctx context.Context) error
+	// Insert stores rows in a table in one batch
+	Insert(ctx context.Context, table string, rows []Row) error
+	Close() error
+}
+
+// NewSink opens the sink of the given driver
+func NewSink(driver, dsn string) (Sink, error) {
+	switch driver {
+	case DriverClickHouse:
+		return newClickHouseSink(dsn)
+	case DriverTimescaleDB:
+		return newTimescaleSink(dsn)
+	}
+	return nil, fmt.Errorf("unknown analytics sink %q, expected clickhouse or timescaledb", driver)
+}
+
+// rowValues returns a row's values in schema column order, filling in zero
+// values for missing columns
+func rowValues(table string, row Row) []interface{} {
+	columns := schema[table]
+	values := make([]interface{}, len(columns))
+	for i, col := range columns {
+		value, ok := row[col.name]
+		if !ok || value == nil {
+			value = zeroValue(col.ctype)
+		}
+		values[i] = value
+	}
+	return values
+}
+
+func zeroValue(ctype string) interface{} {
+	switch ctype {
+	case columnTime:
+		return time.Now().UTC()
+	case columnInt:
+		return 0
+	case columnFloat:
+		return 0.0
+	}
+	return ""
+}
+
+// Recorder buffers rows and writes them to a sink in batches in the
+// background, so recording never waits on the analytics store. Analytics are
+// best effort: rows are dropped when the buffer is full or a write fails.
+// A nil Recorder records nothing.
+type Recorder struct {
+	sink       Sink
+	batchSize  int
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[string][]Row
+	count   int
+	dropped int
+
+	flush   chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewRecorder starts a recorder writing to sink whenever batchSize rows are
+// pending, and at least every interval
+func NewRecorder(sink Sink, batchSize int, interval time.Duration) *Recorder {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	r := &Recorder{
+		sink:       sink,
+		batchSize:  batchSize,
+		maxPending: batchSize * 20,
+		pending:    make(map[string][]Row),
+		flush:      make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go r.run(interval)
+	return r
+}
+
+// Record queues a row for a table
+func (r *Recorder) Record(table string, row Row) {
+	if r == nil {
+		return
+	}
+	if _, ok := row["time"]; !ok {
+		row["time"] = time.Now().UTC()
+	}
+
+	r.mu.Lock()
+	if r.count >= r.maxPending {
+		r.dropped++
+		r.mu.Unlock()
+		return
+	}
+	r.pending[table] = append(r.pending[table], row)
+	r.count++
+	full := r.count >= r.batchSize
+	r.mu.Unlock()
+
+	if full {
+		select {
+		case r.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close writes the pending rows and closes the sink
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	close(r.stop)
+	<-r.stopped
+	return r.sink.Close()
+}
+
+// run writes pending rows on every tick, when a batch fills up and on close
+func (r *Recorder) run(interval time.Duration) {
+	defer close(r.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			r.write()
+			return
+		case <-ticker.C:
+		case <-r.flush:
+		}
+		r.write()
+	}
+}
+
+// write sends every pending batch to the sink
+func (r *Recorder) write() {
+	r.mu.Lock()
+	pending, dropped := r.pending, r.dropped
+	r.pending = make(map[string][]Row)
+	r.count, r.dropped = 0, 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		log.Printf("Dropped %d analytics rows: the buffer was full", dropped)
+	}
+	for table, rows := range pending {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := r.sink.Insert(ctx, table, rows); err != nil {
+			log.Printf("Failed to write %d rows to analytics table %s: %v", len(rows), table, err)
+		}
+		cancel()
+	}
+}
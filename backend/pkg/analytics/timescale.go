@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var timescaleTypes = map[string]string{
+	columnTime:   "TIMESTAMPTZ NOT NULL",
+	columnInt:    "BIGINT",
+	columnFloat:  "DOUBLE PRECISION",
+	columnString: "TEXT",
+}
+
+// timescaleSink writes to hypertables in a TimescaleDB database, separate from
+// the platform's own database, e.g.
+// host=timescale user=analytics password=secret dbname=analytics sslmode=disable
+type timescaleSink struct {
+	db *gorm.DB
+}
+
+func newTimescaleSink(dsn string) (*timescaleSink, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Warn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to timescaledb: %w", err)
+	}
+	return &timescaleSink{db: db}, nil
+}
+
+// Migrate creates the tables as hypertables chunked by time
+func (s *timescaleSink) Migrate(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS timescaledb").Error; err != nil {
+		return fmt.Errorf("failed to enable timescaledb: %w", err)
+	}
+	for table, columns := range schema {
+		definitions := make([]string, len(columns))
+		for i, col := range columns {
+			definitions[i] = fmt.Sprintf("%q %s", col.name, timescaleTypes[col.ctype])
+		}
+		if err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %q (%s)", table, strings.Join(definitions, ", "))).Error; err != nil {
+			return fmt.Errorf("failed to create %s: %w", table, err)
+		}
+		if err := db.Exec("SELECT create_hypertable(?, 'time', if_not_exists => TRUE)", table).Error; err != nil {
+			return fmt.Errorf("failed to make %s a hypertable: %w", table, err)
+		}
+		// Tables created by earlier versions get the columns added since
+		for _, col := range columns {
+			if err := db.Exec(fmt.Sprintf("ALTER TABLE %q ADD COLUMN IF NOT EXISTS %q %s", table, col.name, timescaleTypes[col.ctype])).Error; err != nil {
+				return fmt.Errorf("failed to add %s.%s: %w", table, col.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Insert writes the rows with one multi-row INSERT
+func (s *timescaleSink) Insert(ctx context.Context, table string, rows []Row) error {
+	columns, ok := schema[table]
+	if !ok {
+		return fmt.Errorf("unknown analytics table %s", table)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = fmt.Sprintf("%q", col.name)
+	}
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	tuples := make([]string, len(rows))
+	args := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		tuples[i] = placeholders
+		args = append(args, rowValues(table, row)...)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %q (%s) VALUES %s", table, strings.Join(names, ", "), strings.Join(tuples, ", "))
+	return s.db.WithContext(ctx).Exec(query, args...).Error
+}
+
+func (s *timescaleSink) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
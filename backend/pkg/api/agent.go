@@ -0,0 +1,135 @@
+// Package api holds the request and response bodies of the platform's API,
+// shared by its handlers and the Go client in pkg/client.
+package api
+
+import (
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/agent"
+	"grafana-ai-agent-platform/backend/internal/services"
+)
+
+// QueryRequest represents a user query to the AI agent
+type QueryRequest struct {
+	Query string `json:"query" binding:"required"`
+	// ClusterID and Namespace default to the session's context, set with
+	// POST /api/agent/context
+	ClusterID *uint  `json:"cluster_id,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Model answers the query instead of the configured model, one of GET /api/agent/models
+	Model string `json:"model,omitempty"`
+	// BypassCache asks the model again even when a cached answer exists
+	BypassCache bool `json:"bypass_cache,omitempty"`
+	// Format is the format of the answer: markdown (the default), plain, json
+	// or yaml-manifests-only
+	Format string `json:"format,omitempty" binding:"omitempty,oneof=markdown plain json yaml-manifests-only"`
+	// PlanRequested asks for a deployment plan even when the query doesn't
+	// read like a deployment request
+	PlanRequested bool `json:"plan_requested,omitempty"`
+}
+
+// QueryResponse represents the AI agent response
+type QueryResponse struct {
+	// QueryID is the query's history entry, which feedback on the answer rates
+	QueryID  uint   `json:"query_id,omitempty"`
+	Response string `json:"response"`
+	// Format is the format Response is in
+	Format          string                 `json:"format"`
+	DeploymentPlan  *agent.DeploymentPlan  `json:"deployment_plan,omitempty"`
+	ClusterAnalysis *agent.ClusterAnalysis `json:"cluster_analysis,omitempty"`
+	// PlanErrors are the schema violations of the plan the model generated,
+	// when the deployment plan was made from a chart search instead
+	PlanErrors []string `json:"plan_errors,omitempty"`
+	// Sources are the runbooks the answer was grounded in
+	Sources []string `json:"sources,omitempty"`
+	// SimilarQueries are the team's past queries the answer was grounded in
+	SimilarQueries []SimilarQuery `json:"similar_queries,omitempty"`
+	Status         string         `json:"status"`
+	// Model answered the query, a fallback when the requested one failed
+	Model string `json:"model"`
+	// Provider served Model and took LatencyMs to answer, over every model tried
+	Provider  string `json:"provider,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+	// ContextTruncated reports whether the cluster information was shortened
+	// to fit LLM_MAX_PROMPT_CHARS
+	ContextTruncated bool `json:"context_truncated,omitempty"`
+	// Context is the cluster and namespace the query was answered about
+	Context *ConversationContext `json:"context,omitempty"`
+	// Cache is "hit" for answers served from the query cache, "miss" for new
+	// ones, and empty when the cache is disabled
+	Cache     string `json:"cache,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// SetContextRequest sets the cluster, and optionally the namespace, that the
+// session's queries are about when they don't name a cluster
+type SetContextRequest struct {
+	ClusterID uint   `json:"cluster_id" binding:"required"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ConversationContext is the cluster and namespace a query is about. FromSession
+// is set when they came from the session's context rather than the query.
+type ConversationContext struct {
+	ClusterID   uint   `json:"cluster_id"`
+	ClusterName string `json:"cluster_name"`
+	Namespace   string `json:"namespace,omitempty"`
+	FromSession bool   `json:"from_session"`
+}
+
+// SimilarQuery is a past answered query resembling a new one, most similar first
+type SimilarQuery struct {
+	QueryID     uint      `json:"query_id"`
+	UserID      uint      `json:"user_id"`
+	ClusterID   *uint     `json:"cluster_id,omitempty"`
+	ClusterName string    `json:"cluster_name,omitempty"`
+	Query       string    `json:"query"`
+	Response    string    `json:"response"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Similarity is the cosine similarity to the new query, 1 being identical
+	Similarity float64 `json:"similarity"`
+}
+
+// DeployRequest represents a deployment request
+type DeployRequest struct {
+	PlanID     string `json:"plan_id" binding:"required"`
+	ClusterID  uint   `json:"cluster_id" binding:"required"`
+	KubeConfig string `json:"kube_config" binding:"required"`
+	// ScopedCredentials runs the deployment as an ephemeral ServiceAccount limited
+	// to the plan's resources instead of the kubeconfig's own identity
+	ScopedCredentials bool `json:"scoped_credentials,omitempty"`
+	// SkipPreflight deploys without checking capacity, storage classes, CRDs
+	// and permissions first
+	SkipPreflight bool `json:"skip_preflight,omitempty"`
+}
+
+// DeployResponse represents a deployment response
+type DeployResponse struct {
+	ExecutionID string                   `json:"execution_id"`
+	Status      string                   `json:"status"`
+	Message     string                   `json:"message"`
+	PostDeploy  []agent.PostDeployResult `json:"post_deploy,omitempty"`
+	Diagnoses   []agent.FailureDiagnosis `json:"diagnoses,omitempty"`
+}
+
+// DeploymentStatusResponse is the state of a deployment execution, live while
+// it runs
+type DeploymentStatusResponse struct {
+	ID             string `json:"id"`
+	ClusterID      uint   `json:"cluster_id"`
+	PlanID         string `json:"plan_id"`
+	Status         string `json:"status"`
+	CompletedSteps int    `json:"completed_steps"`
+	TotalSteps     int    `json:"total_steps"`
+	// CurrentStep is the first of the steps running now, RunningSteps all of
+	// them, as steps that don't depend on each other run in parallel
+	CurrentStep  string   `json:"current_step,omitempty"`
+	RunningSteps []string `json:"running_steps"`
+	// Graph is the dependency graph of the steps with their state
+	Graph     *agent.StepGraph           `json:"graph,omitempty"`
+	Execution *agent.DeploymentExecution `json:"execution"`
+	// Locks are the cluster namespaces the deployment holds while it runs
+	Locks     []services.DeploymentLock `json:"locks,omitempty"`
+	CreatedAt time.Time                 `json:"created_at"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
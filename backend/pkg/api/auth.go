@@ -0,0 +1,28 @@
+package api
+
+import "grafana-ai-agent-platform/backend/internal/models"
+
+// LoginRequest signs in with an email and password
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// AuthResponse is a session token with the user it authenticates
+type AuthResponse struct {
+	Token string              `json:"token"`
+	User  models.UserResponse `json:"user"`
+}
+
+// CreateAPIKeyRequest names a new API key and optionally limits how long it
+// is valid
+type CreateAPIKeyRequest struct {
+	Name          string `json:"name" binding:"required"`
+	ExpiresInDays int    `json:"expires_in_days,omitempty" binding:"min=0"`
+}
+
+// CreateAPIKeyResponse carries the only copy of a new API key
+type CreateAPIKeyResponse struct {
+	models.APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"grafana-ai-agent-platform/backend/internal/models"
+)
+
+// AddClusterRequest is a cluster to store, with how to authenticate to it.
+// Without a name the cluster is named after its kubeconfig's cluster.
+type AddClusterRequest struct {
+	Name string `json:"name,omitempty"`
+	ClusterAuthRequest
+	// Context is the kubeconfig context to use instead of its current one
+	Context string `json:"context,omitempty"`
+	// Contexts adds a cluster per listed context of the kubeconfig, each named
+	// after its cluster, instead of a single one
+	Contexts      []string `json:"contexts,omitempty"`
+	PrometheusURL string   `json:"prometheus_url,omitempty"`
+	// Environment is dev, staging or prod
+	Environment string            `json:"environment,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// ClusterAuthRequest selects how the platform authenticates to a cluster: a
+// full kubeconfig (the default), a bearer token with the API server's CA, or a
+// ServiceAccount token. Any mode may impersonate another user.
+type ClusterAuthRequest struct {
+	AuthMode   string `json:"auth_mode,omitempty"`
+	KubeConfig string `json:"kube_config,omitempty"`
+	// Server, Token and CACert are used by the token and service_account modes
+	Server                string   `json:"server,omitempty"`
+	Token                 string   `json:"token,omitempty"`
+	CACert                string   `json:"ca_cert,omitempty"`
+	InsecureSkipTLSVerify bool     `json:"insecure_skip_tls_verify,omitempty"`
+	Impersonate           string   `json:"impersonate,omitempty"`
+	ImpersonateGroups     []string `json:"impersonate_groups,omitempty"`
+}
+
+// AddClusterResponse is a stored cluster. Warning is set when the cluster
+// couldn't be reached and was stored inactive.
+type AddClusterResponse struct {
+	Message string                   `json:"message"`
+	Cluster models.KubernetesCluster `json:"cluster"`
+	Warning string                   `json:"warning,omitempty"`
+}
+
+// AddClustersResponse are the clusters stored for the contexts of a kubeconfig
+type AddClustersResponse struct {
+	Clusters []AddClusterResponse `json:"clusters"`
+}
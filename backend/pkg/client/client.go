@@ -0,0 +1,306 @@
+// Package client is a Go client of the platform's API. Its requests and
+// responses are the API's own bodies from pkg/api, so it stays in step with
+// the server it ships with.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/api"
+)
+
+const (
+	// defaultAttempts is how many times a request is sent before giving up
+	defaultAttempts = 3
+	// defaultBackoff is the wait before the first retry, doubled after each
+	defaultBackoff = time.Second
+	// maxRetryAfter caps how long a Retry-After header makes a retry wait
+	maxRetryAfter = 30 * time.Second
+)
+
+// Client calls the API as the owner of an API key, or of a token from Login
+type Client struct {
+	baseURL  string
+	http     *http.Client
+	attempts int
+	backoff  time.Duration
+
+	mu    sync.RWMutex
+	token string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey authenticates with an API key created with POST /api/api-keys
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.token = key }
+}
+
+// WithToken authenticates with a session token from POST /api/auth/login
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHTTPClient sends requests with the given HTTP client, e.g. one with a
+// custom transport
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.http = httpClient }
+}
+
+// WithRetries sets how many times requests are sent in all and the wait before
+// the first retry. One attempt disables retries.
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.attempts = max(attempts, 1)
+		c.backoff = backoff
+	}
+}
+
+// APIError is an answer of the API that isn't a success
+type APIError struct {
+	StatusCode int
+	Message    string
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// ErrUnauthorized matches, with errors.Is, the APIError of a request whose API
+// key or token is missing, invalid or expired
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Is matches ErrUnauthorized to 401 answers
+func (e *APIError) Is(target error) bool {
+	return target == ErrUnauthorized && e.StatusCode == http.StatusUnauthorized
+}
+
+// New creates a client of the API served at baseURL, e.g.
+// https://platform.example.com. Requests have no timeout of their own;
+// deployments run until they finish, so callers bound them with their context.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/") + "/api",
+		http:     &http.Client{},
+		attempts: defaultAttempts,
+		backoff:  defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Login signs in with an email and password and authenticates the client's
+// further requests with the session token
+func (c *Client) Login(ctx context.Context, email, password string) error {
+	var resp api.AuthResponse
+	if err := c.do(ctx, http.MethodPost, "/auth/login", api.LoginRequest{Email: email, Password: password}, &resp); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.token = resp.Token
+	c.mu.Unlock()
+	return nil
+}
+
+// QueryAgent asks the agent a question, answered with a deployment plan when
+// it asks for a deployment
+func (c *Client) QueryAgent(ctx context.Context, req api.QueryRequest) (*api.QueryResponse, error) {
+	var resp api.QueryResponse
+	if err := c.do(ctx, http.MethodPost, "/agent/query", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// SetContext sets the cluster and namespace that the client's queries naming no
+// cluster are about, for as long as its API key or token is valid
+func (c *Client) SetContext(ctx context.Context, req api.SetContextRequest) (*api.ConversationContext, error) {
+	var resp api.ConversationContext
+	if err := c.do(ctx, http.MethodPost, "/agent/context", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// ClearContext clears the context set with SetContext
+func (c *Client) ClearContext(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/agent/context", nil, nil)
+}
+
+// AddCluster stores a cluster and checks its connection
+func (c *Client) AddCluster(ctx context.Context, req api.AddClusterRequest) (*api.AddClusterResponse, error) {
+	var resp api.AddClusterResponse
+	if err := c.do(ctx, http.MethodPost, "/kubernetes/clusters", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Deploy deploys a stored plan and returns once the deployment finished
+func (c *Client) Deploy(ctx context.Context, req api.DeployRequest) (*api.DeployResponse, error) {
+	var resp api.DeployResponse
+	if err := c.do(ctx, http.MethodPost, "/agent/deploy", req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetDeployment returns the state of a deployment with its logs
+func (c *Client) GetDeployment(ctx context.Context, executionID string) (*api.DeploymentStatusResponse, error) {
+	var resp api.DeploymentStatusResponse
+	if err := c.do(ctx, http.MethodGet, "/agent/deployments/"+url.PathEscape(executionID), nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// FollowDeployment calls fn with the state of a deployment every interval
+// until it stops running, fn returns an error or ctx is done
+func (c *Client) FollowDeployment(ctx context.Context, executionID string, interval time.Duration, fn func(*api.DeploymentStatusResponse) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := c.GetDeployment(ctx, executionID)
+		if err != nil {
+			return err
+		}
+		if err := fn(status); err != nil {
+			return err
+		}
+		if status.Status != "running" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// do sends a request with a JSON body and decodes the JSON answer into out,
+// retrying failures that are likely to pass
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	wait := c.backoff
+	for attempt := 1; ; attempt++ {
+		err := c.send(ctx, method, path, encoded, out)
+		if err == nil || attempt >= c.attempts || !retryable(method, err) {
+			return err
+		}
+		delay := wait
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+			delay = apiErr.retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		wait *= 2
+	}
+}
+
+// send sends a request once
+func (c *Client) send(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.mu.RLock()
+	token := c.token
+	c.mu.RUnlock()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &failure) == nil && failure.Error != "" {
+			message = failure.Error
+		}
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: message}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			apiErr.retryAfter = min(time.Duration(seconds)*time.Second, maxRetryAfter)
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// retryable reports whether a failed request is worth sending again. Reads
+// are retried on server and connection errors; writes only when the server
+// can't have acted on them: rate limited, turned away by admission control
+// (503 with Retry-After), or never connected to.
+func retryable(method string, err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			return true
+		case apiErr.StatusCode == http.StatusServiceUnavailable && apiErr.retryAfter > 0:
+			return true
+		}
+		return method == http.MethodGet && apiErr.StatusCode >= 500
+	}
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if method == http.MethodGet {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"grafana-ai-agent-platform/backend/pkg/api"
+)
+
+// LogPollInterval is how often StreamLogs polls a running deployment
+const LogPollInterval = 2 * time.Second
+
+// LogLine is a line of a deployment's log. StepID is empty for lines of the
+// deployment itself.
+type LogLine struct {
+	StepID string
+	Text   string
+}
+
+// StreamLogs calls fn with each line of a deployment's logs, then with the
+// lines added while it runs, and returns its state once it stopped running.
+// A step's error is streamed as its last line.
+func (c *Client) StreamLogs(ctx context.Context, executionID string, fn func(LogLine) error) (*api.DeploymentStatusResponse, error) {
+	// streamed counts the lines streamed so far per step, "" for the deployment
+	streamed := map[string]int{}
+	failed := map[string]bool{}
+	var final *api.DeploymentStatusResponse
+	err := c.FollowDeployment(ctx, executionID, LogPollInterval, func(status *api.DeploymentStatusResponse) error {
+		final = status
+		if status.Execution == nil {
+			return nil
+		}
+		if err := streamLines(streamed, "", status.Execution.Logs, fn); err != nil {
+			return err
+		}
+		for _, step := range status.Execution.Steps {
+			if err := streamLines(streamed, step.StepID, step.Logs, fn); err != nil {
+				return err
+			}
+			if step.Error != "" && !failed[step.StepID] {
+				failed[step.StepID] = true
+				if err := fn(LogLine{StepID: step.StepID, Text: "error: " + step.Error}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return final, nil
+}
+
+// streamLines streams the lines of a log not streamed yet
+func streamLines(streamed map[string]int, stepID string, lines []string, fn func(LogLine) error) error {
+	for _, line := range lines[min(streamed[stepID], len(lines)):] {
+		if err := fn(LogLine{StepID: stepID, Text: line}); err != nil {
+			return err
+		}
+	}
+	streamed[stepID] = len(lines)
+	return nil
+}
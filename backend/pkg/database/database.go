@@ -1,57 +1,168 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"grafana-ai-agent-platform/backend/internal/config"
-	"grafana-ai-agent-platform/backend/internal/models"
+	"grafana-ai-agent-platform/backend/pkg/analytics"
 
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
+// replicaResolver names the resolver holding the read replicas. No table has this
+// name, so queries reach the replicas only through Reader.
+const replicaResolver = "replicas"
+
 type Database struct {
 	DB *gorm.DB
+	// Analytics records high-volume analytical data to the configured sink
+	// instead of the relational database. It is nil, recording nothing, when no
+	// sink is configured.
+	Analytics *analytics.Recorder
+	// VectorSearch reports whether the pgvector extension is available, which
+	// the runbook knowledge base and similar query search need
+	VectorSearch bool
+	hasReplicas  bool
 }
 
 func NewDatabase(cfg *config.Config) (*Database, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=UTC",
-		cfg.Database.Host,
-		cfg.Database.User,
-		cfg.Database.Password,
-		cfg.Database.DBName,
-		cfg.Database.Port,
-		cfg.Database.SSLMode,
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+	db, err := Connect(cfg.Database, logger.Info)
+	if err != nil {
+		return nil, err
+	}
+
+	hasReplicas := len(cfg.Database.ReplicaDSNs) > 0
+	if hasReplicas {
+		replicas := make([]gorm.Dialector, 0, len(cfg.Database.ReplicaDSNs))
+		for _, replicaDSN := range cfg.Database.ReplicaDSNs {
+			replica, err := replicaDialector(cfg.Database.Driver, replicaDSN)
+			if err != nil {
+				return nil, err
+			}
+			replicas = append(replicas, replica)
+		}
+		err := db.Use(dbresolver.Register(dbresolver.Config{
+			Replicas: replicas,
+			Policy:   dbresolver.RandomPolicy{},
+		}, replicaResolver))
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure read replicas: %w", err)
+		}
+		log.Printf("Routing history and analytics reads to %d replica(s)", len(replicas))
+	}
+
+	if err := migrateAtStartup(db, cfg); err != nil {
+		return nil, err
+	}
+
+	vectorSearch := vectorSearchAvailable(db)
+
+	recorder, err := newAnalyticsRecorder(cfg.Analytics)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Database connected successfully (%s)", db.Dialector.Name())
+	return &Database{DB: db, Analytics: recorder, VectorSearch: vectorSearch, hasReplicas: hasReplicas}, nil
+}
+
+// Connect opens the configured database without migrating it
+func Connect(cfg config.DatabaseConfig, logLevel logger.LogLevel) (*gorm.DB, error) {
+	primary, err := dialector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(primary, &gorm.Config{
+		Logger: logger.Default.LogMode(logLevel),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
+	return db, nil
+}
+
+// migrateAtStartup applies pending migrations when DB_AUTO_MIGRATE is on,
+// except destructive ones in production, and otherwise refuses to start on a
+// schema that is behind
+func migrateAtStartup(db *gorm.DB, cfg *config.Config) error {
+	if !cfg.Database.AutoMigrate {
+		pending, err := PendingMigrations(db)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("database schema is missing migrations %s, apply them with migrate up", strings.Join(pending, ", "))
+		}
+		return nil
+	}
 
-	// Auto migrate the schema
-	if err := autoMigrate(db); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	applied, err := Migrate(db, MigrateOptions{AllowDestructive: !cfg.Server.Production()})
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
 	}
+	if len(applied) > 0 {
+		log.Printf("Applied migrations %s", strings.Join(applied, ", "))
+	}
+	return nil
+}
 
-	log.Println("Database connected successfully")
-	return &Database{DB: db}, nil
+// vectorSearchAvailable reports whether migrations created the knowledge base
+// chunk and query embedding tables, which need PostgreSQL with the pgvector
+// extension. Without them the platform runs with the knowledge base and
+// similar query search disabled.
+func vectorSearchAvailable(db *gorm.DB) bool {
+	if db.Dialector.Name() != DriverPostgres {
+		log.Printf("Knowledge base disabled: it needs PostgreSQL with the pgvector extension")
+		return false
+	}
+	if !db.Migrator().HasTable("knowledge_chunks") || !db.Migrator().HasTable("query_embeddings") {
+		log.Printf("Knowledge base disabled: the pgvector extension wasn't available when migrations 0024_knowledge_chunks and 0025_query_embeddings were applied")
+		return false
+	}
+	return true
 }
 
-func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
-		&models.User{},
-		&models.KubernetesCluster{},
-		&models.AgentQuery{},
-		&models.Deployment{},
-	)
+// newAnalyticsRecorder opens the configured analytics sink and creates its tables
+func newAnalyticsRecorder(cfg config.AnalyticsConfig) (*analytics.Recorder, error) {
+	if cfg.Sink == "" {
+		return nil, nil
+	}
+
+	sink, err := analytics.NewSink(cfg.Sink, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open analytics sink: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := sink.Migrate(ctx); err != nil {
+		sink.Close()
+		return nil, fmt.Errorf("failed to migrate analytics sink: %w", err)
+	}
+
+	log.Printf("Recording analytics to %s", cfg.Sink)
+	return analytics.NewRecorder(sink, cfg.BatchSize, cfg.FlushInterval), nil
+}
+
+// Reader returns a session that reads from a replica when replicas are configured,
+// and from the primary otherwise. Use it for history, search and analytics queries
+// that tolerate replication lag, never for state that was just written.
+func (d *Database) Reader() *gorm.DB {
+	if !d.hasReplicas {
+		return d.DB
+	}
+	return d.DB.Clauses(dbresolver.Use(replicaResolver), dbresolver.Read)
 }
 
 func (d *Database) Close() error {
+	if err := d.Analytics.Close(); err != nil {
+		log.Printf("Failed to close analytics sink: %v", err)
+	}
 	sqlDB, err := d.DB.DB()
 	if err != nil {
 		return err
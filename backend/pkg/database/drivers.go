@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+
+	"grafana-ai-agent-platform/backend/internal/config"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+)
+
+// dialector returns the dialector connecting to the configured database
+func dialector(cfg config.DatabaseConfig) (gorm.Dialector, error) {
+	switch cfg.Driver {
+	case DriverPostgres, "":
+		return postgres.Open(fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=UTC",
+			cfg.Host,
+			cfg.User,
+			cfg.Password,
+			cfg.DBName,
+			cfg.Port,
+			cfg.SSLMode,
+		)), nil
+	case DriverMySQL:
+		params := url.Values{}
+		params.Set("charset", "utf8mb4")
+		params.Set("parseTime", "true")
+		params.Set("loc", "UTC")
+		switch cfg.SSLMode {
+		case "", "disable":
+		case "require", "prefer", "allow":
+			params.Set("tls", "skip-verify")
+		default:
+			params.Set("tls", "true")
+		}
+		return mysql.Open(fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?%s",
+			cfg.User,
+			cfg.Password,
+			cfg.Host,
+			cfg.Port,
+			cfg.DBName,
+			params.Encode(),
+		)), nil
+	case DriverSQLite:
+		// WAL lets readers run alongside the single writer, which waits for
+		// locks instead of failing
+		return sqlite.Open(cfg.Path + "?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on"), nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q, use postgres, mysql or sqlite", cfg.Driver)
+}
+
+// replicaDialector returns the dialector connecting to a read replica given as
+// a DSN of the configured driver
+func replicaDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverPostgres, "":
+		return postgres.Open(dsn), nil
+	case DriverMySQL:
+		return mysql.Open(dsn), nil
+	}
+	return nil, fmt.Errorf("the %s driver doesn't support read replicas", driver)
+}
@@ -0,0 +1,415 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The tables 0001_initial_schema creates, declared as the models were when
+// versioned migrations were introduced. Later migrations change them, so
+// these structs stay as they are when the models change.
+
+type initialOrganization struct {
+	ID            uint   `gorm:"primaryKey"`
+	Name          string `gorm:"not null"`
+	LicensePolicy string `gorm:"type:text"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
+
+	Members []initialUser `gorm:"foreignKey:OrganizationID"`
+}
+
+func (initialOrganization) TableName() string { return "organizations" }
+
+type initialUser struct {
+	ID             uint   `gorm:"primaryKey"`
+	Email          string `gorm:"size:191;uniqueIndex;not null"`
+	Password       string `gorm:"not null"`
+	FirstName      string
+	LastName       string
+	OrganizationID *uint  `gorm:"index"`
+	Role           string `gorm:"default:'member'"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+
+	Clusters []initialKubernetesCluster `gorm:"foreignKey:UserID"`
+}
+
+func (initialUser) TableName() string { return "users" }
+
+type initialKubernetesCluster struct {
+	ID                  uint   `gorm:"primaryKey"`
+	UserID              uint   `gorm:"not null"`
+	Name                string `gorm:"not null"`
+	KubeConfig          string `gorm:"type:text;not null"`
+	AuthMode            string `gorm:"default:'kubeconfig'"`
+	ClusterURL          string
+	Version             string
+	PrometheusURL       string
+	ManagementClusterID *uint `gorm:"index"`
+	CAPIRef             string
+	Status              string `gorm:"default:'pending'"`
+	IsActive            bool   `gorm:"default:true"`
+	HealthCheckedAt     *time.Time
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	DeletedAt           gorm.DeletedAt `gorm:"index"`
+
+	User initialUser `gorm:"foreignKey:UserID"`
+}
+
+func (initialKubernetesCluster) TableName() string { return "kubernetes_clusters" }
+
+type initialClusterSnapshot struct {
+	ID        uint      `gorm:"primaryKey"`
+	ClusterID uint      `gorm:"not null;index"`
+	UserID    uint      `gorm:"not null"`
+	Analysis  string    `gorm:"type:text;not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (initialClusterSnapshot) TableName() string { return "cluster_snapshots" }
+
+type initialClusterHealthCheck struct {
+	ID        uint `gorm:"primaryKey"`
+	ClusterID uint `gorm:"not null;index:idx_cluster_health,priority:1"`
+	Reachable bool
+	LatencyMs int64
+	Version   string
+	Error     string    `gorm:"type:text"`
+	CheckedAt time.Time `gorm:"not null;index:idx_cluster_health,priority:2"`
+}
+
+func (initialClusterHealthCheck) TableName() string { return "cluster_health_checks" }
+
+type initialAgentQuery struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"not null;index"`
+	ClusterID *uint
+	Query     string `gorm:"type:text;not null"`
+	Response  string `gorm:"type:text"`
+	Status    string `gorm:"default:'pending'"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	User    initialUser              `gorm:"foreignKey:UserID"`
+	Cluster initialKubernetesCluster `gorm:"foreignKey:ClusterID"`
+}
+
+func (initialAgentQuery) TableName() string { return "agent_queries" }
+
+type initialDeployment struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null"`
+	ClusterID uint   `gorm:"not null"`
+	StackName string `gorm:"not null"`
+	Status    string `gorm:"default:'pending'"`
+	Manifest  string `gorm:"type:text"`
+	Error     string `gorm:"type:text"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	User    initialUser              `gorm:"foreignKey:UserID"`
+	Cluster initialKubernetesCluster `gorm:"foreignKey:ClusterID"`
+}
+
+func (initialDeployment) TableName() string { return "deployments" }
+
+type initialDeploymentPlanRecord struct {
+	ID             string `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	OrganizationID *uint  `gorm:"index"`
+	ClusterID      *uint
+	Query          string `gorm:"type:text"`
+	Name           string
+	Plan           string `gorm:"type:text;not null"`
+	Status         string `gorm:"default:'draft'"`
+	ReviewedBy     *uint
+	ReviewedAt     *time.Time
+	ReviewComment  string `gorm:"type:text"`
+	LicenseReport  string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+
+	User initialUser `gorm:"foreignKey:UserID"`
+}
+
+func (initialDeploymentPlanRecord) TableName() string { return "deployment_plan_records" }
+
+type initialDeploymentExecutionRecord struct {
+	ID        string `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	ClusterID uint   `gorm:"not null"`
+	PlanID    string `gorm:"index"`
+	Status    string `gorm:"default:'running'"`
+	Execution string `gorm:"type:text;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	User initialUser `gorm:"foreignKey:UserID"`
+}
+
+func (initialDeploymentExecutionRecord) TableName() string { return "deployment_execution_records" }
+
+type initialDeploymentStepRecord struct {
+	ID          uint   `gorm:"primaryKey"`
+	ExecutionID string `gorm:"size:191;not null;uniqueIndex:idx_deployment_step_records_step"`
+	StepID      string `gorm:"size:191;not null;uniqueIndex:idx_deployment_step_records_step"`
+	Position    int
+	Status      string
+	Attempts    int
+	StartedAt   *time.Time
+	FinishedAt  *time.Time
+	Error       string `gorm:"type:text"`
+	Logs        string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (initialDeploymentStepRecord) TableName() string { return "deployment_step_records" }
+
+type initialDeploymentStepMetric struct {
+	ID              uint   `gorm:"primaryKey"`
+	ExecutionID     string `gorm:"not null;index"`
+	StepID          string `gorm:"not null"`
+	UserID          uint   `gorm:"not null;index"`
+	ClusterID       uint
+	Chart           string `gorm:"not null;index"`
+	ChartVersion    string
+	Action          string
+	Status          string
+	DurationSeconds float64
+	Attempts        int
+	Error           string    `gorm:"type:text"`
+	Signature       string    `gorm:"type:text"`
+	StartedAt       time.Time `gorm:"index"`
+	CreatedAt       time.Time
+}
+
+func (initialDeploymentStepMetric) TableName() string { return "deployment_step_metrics" }
+
+type initialKnownIssue struct {
+	ID          uint   `gorm:"primaryKey"`
+	Signature   string `gorm:"type:text;not null;index:,length:191"`
+	Chart       string `gorm:"index"`
+	Title       string `gorm:"not null"`
+	Remediation string `gorm:"type:text;not null"`
+	Source      string `gorm:"default:'manual'"`
+	Occurrences int
+	LastSeen    *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+}
+
+func (initialKnownIssue) TableName() string { return "known_issues" }
+
+type initialOrgValuePolicy struct {
+	ID             uint   `gorm:"primaryKey"`
+	OrganizationID uint   `gorm:"not null;index"`
+	ClusterID      *uint  `gorm:"index"`
+	Policy         string `gorm:"type:text;not null"`
+	UpdatedBy      uint
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (initialOrgValuePolicy) TableName() string { return "org_value_policies" }
+
+type initialOrgPolicy struct {
+	ID             uint   `gorm:"primaryKey"`
+	OrganizationID uint   `gorm:"not null;uniqueIndex:idx_org_policy_name"`
+	Name           string `gorm:"size:191;not null;uniqueIndex:idx_org_policy_name"`
+	Description    string
+	Module         string `gorm:"type:text;not null"`
+	Enabled        bool
+	UpdatedBy      uint
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (initialOrgPolicy) TableName() string { return "org_policies" }
+
+type initialHelmRegistry struct {
+	ID             uint   `gorm:"primaryKey"`
+	OrganizationID uint   `gorm:"not null;uniqueIndex:idx_helm_registry_host"`
+	Host           string `gorm:"size:191;not null;uniqueIndex:idx_helm_registry_host"`
+	Username       string
+	Password       string
+	UpdatedBy      uint
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func (initialHelmRegistry) TableName() string { return "helm_registries" }
+
+type initialGrafanaInstance struct {
+	ID          uint `gorm:"primaryKey"`
+	UserID      uint `gorm:"not null;index"`
+	ClusterID   uint `gorm:"not null;index"`
+	Name        string
+	URL         string
+	ExternalURL string
+	Namespace   string
+	ServiceName string
+	Port        int32
+	APIKey      string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   gorm.DeletedAt `gorm:"index"`
+
+	User    initialUser              `gorm:"foreignKey:UserID"`
+	Cluster initialKubernetesCluster `gorm:"foreignKey:ClusterID"`
+}
+
+func (initialGrafanaInstance) TableName() string { return "grafana_instances" }
+
+type initialRunbook struct {
+	ID          uint   `gorm:"primaryKey"`
+	ExecutionID string `gorm:"size:191;not null;uniqueIndex:idx_runbook_version"`
+	Version     int    `gorm:"not null;uniqueIndex:idx_runbook_version"`
+	UserID      uint   `gorm:"not null;index"`
+	ClusterID   uint
+	PlanID      string
+	Title       string
+	Content     string `gorm:"type:text;not null"`
+	Source      string
+	CreatedAt   time.Time
+}
+
+func (initialRunbook) TableName() string { return "runbooks" }
+
+type initialKnowledgeDocument struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	OrganizationID *uint  `gorm:"index"`
+	Title          string `gorm:"not null"`
+	Filename       string
+	Content        string `gorm:"type:text;not null"`
+	Chunks         int
+	Status         string `gorm:"default:'indexing'"`
+	Error          string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (initialKnowledgeDocument) TableName() string { return "knowledge_documents" }
+
+type initialNotification struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	ClusterID *uint  `gorm:"index"`
+	Type      string `gorm:"not null"`
+	Severity  string
+	Rule      string
+	Resource  string
+	Title     string `gorm:"not null"`
+	Message   string `gorm:"type:text"`
+	ReadAt    *time.Time
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (initialNotification) TableName() string { return "notifications" }
+
+type initialNotificationChannel struct {
+	ID             uint   `gorm:"primaryKey"`
+	UserID         uint   `gorm:"not null;index"`
+	OrganizationID *uint  `gorm:"index"`
+	Name           string `gorm:"not null"`
+	Type           string `gorm:"not null"`
+	URL            string
+	Recipients     string
+	Secret         string
+	Events         string
+	Template       string `gorm:"type:text"`
+	Enabled        bool
+	LastSentAt     *time.Time
+	LastError      string `gorm:"type:text"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (initialNotificationChannel) TableName() string { return "notification_channels" }
+
+type initialScheduledDeployment struct {
+	ID                uint   `gorm:"primaryKey"`
+	UserID            uint   `gorm:"not null;index"`
+	PlanID            string `gorm:"not null;index"`
+	ClusterID         uint   `gorm:"not null"`
+	Cron              string
+	Timezone          string `gorm:"default:'UTC'"`
+	RunAt             *time.Time
+	WindowMinutes     int
+	ScopedCredentials bool
+	Status            string     `gorm:"default:'active';index"`
+	NextRunAt         *time.Time `gorm:"index"`
+	LastRunAt         *time.Time
+	LastExecutionID   string
+	LastStatus        string
+	LastError         string `gorm:"type:text"`
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+	DeletedAt         gorm.DeletedAt `gorm:"index"`
+}
+
+func (initialScheduledDeployment) TableName() string { return "scheduled_deployments" }
+
+type initialOperation struct {
+	ID              string `gorm:"primaryKey"`
+	UserID          uint   `gorm:"not null;index"`
+	Type            string `gorm:"not null;index"`
+	Target          string
+	Status          string `gorm:"default:'pending';index"`
+	Progress        int
+	Message         string
+	CancelRequested bool
+	Result          string `gorm:"type:text"`
+	ResultType      string
+	ResultName      string
+	Error           string `gorm:"type:text"`
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+	CreatedAt       time.Time `gorm:"index"`
+	UpdatedAt       time.Time
+}
+
+func (initialOperation) TableName() string { return "operations" }
+
+// initialSchema returns the tables of 0001_initial_schema, referenced ones
+// before the ones referencing them
+func initialSchema() []interface{} {
+	return []interface{}{
+		&initialOrganization{},
+		&initialUser{},
+		&initialKubernetesCluster{},
+		&initialClusterSnapshot{},
+		&initialClusterHealthCheck{},
+		&initialAgentQuery{},
+		&initialDeployment{},
+		&initialDeploymentPlanRecord{},
+		&initialDeploymentExecutionRecord{},
+		&initialDeploymentStepRecord{},
+		&initialDeploymentStepMetric{},
+		&initialKnownIssue{},
+		&initialOrgValuePolicy{},
+		&initialOrgPolicy{},
+		&initialHelmRegistry{},
+		&initialGrafanaInstance{},
+		&initialRunbook{},
+		&initialKnowledgeDocument{},
+		&initialNotification{},
+		&initialNotificationChannel{},
+		&initialScheduledDeployment{},
+		&initialOperation{},
+	}
+}
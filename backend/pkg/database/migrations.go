@@ -0,0 +1,1081 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// migrationLockName serializes migrations of replicas starting together
+const migrationLockName = "grafana_ai_agent_platform_migrations"
+
+// migrationLockKey is migrationLockName as a PostgreSQL advisory lock key
+const migrationLockKey = 7316842091
+
+// Migration is a numbered, reversible schema change. Migrations run in ID
+// order, each in a transaction, though MySQL commits DDL as it goes and may
+// leave a failed migration partly applied.
+//
+// The models describe the latest schema, so migrations declare the structs
+// they need as they were when the migration was written.
+type Migration struct {
+	ID          string
+	Description string
+	// Destructive migrations drop or rewrite data. Startup never applies them
+	// in production; migrate up --allow-destructive does.
+	Destructive bool
+	Up          func(tx *gorm.DB) error
+	Down        func(tx *gorm.DB) error
+}
+
+// MigrationStatus reports whether a migration was applied
+type MigrationStatus struct {
+	ID          string     `json:"id"`
+	Description string     `json:"description"`
+	Destructive bool       `json:"destructive"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// MigrateOptions selects the migrations Migrate applies
+type MigrateOptions struct {
+	// Target is the last migration to apply, all of them when empty
+	Target string
+	// AllowDestructive applies destructive migrations instead of refusing to
+	// migrate past them
+	AllowDestructive bool
+}
+
+// migrationRecord is a row of the migrations table
+type migrationRecord struct {
+	ID        string `gorm:"primaryKey;size:191"`
+	AppliedAt time.Time
+}
+
+func (migrationRecord) TableName() string {
+	return "migrations"
+}
+
+// migrations lists every schema migration in order. Append new migrations and
+// never change one that was released.
+var migrations = []Migration{
+	{
+		// Databases from before versioned migrations were auto-migrated at
+		// every start, so this brings them up to date with the models of then
+		ID:          "0001_initial_schema",
+		Description: "Create the tables of every model",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(initialSchema()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			tables := initialSchema()
+			for i := len(tables) - 1; i >= 0; i-- {
+				if err := tx.Migrator().DropTable(tables[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "0002_audit_logs",
+		Description: "Create the audit log of workload actions",
+		Up: func(tx *gorm.DB) error {
+			type auditLog struct {
+				ID             uint   `gorm:"primaryKey"`
+				UserID         uint   `gorm:"not null;index"`
+				OrganizationID *uint  `gorm:"index"`
+				ClusterID      uint   `gorm:"not null;index"`
+				Action         string `gorm:"not null;index"`
+				Resource       string
+				Details        string `gorm:"type:text"`
+				Result         string
+				Error          string    `gorm:"type:text"`
+				CreatedAt      time.Time `gorm:"index"`
+			}
+			return tx.Table("audit_logs").AutoMigrate(&auditLog{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("audit_logs")
+		},
+	},
+	{
+		ID:          "0003_organization_security_policy",
+		Description: "Add the vulnerability policy of organizations",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				SecurityPolicy string `gorm:"type:text"`
+			}
+			if tx.Migrator().HasColumn("organizations", "security_policy") {
+				return nil
+			}
+			return tx.Table("organizations").Migrator().AddColumn(&organization{}, "SecurityPolicy")
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				SecurityPolicy string `gorm:"type:text"`
+			}
+			return tx.Table("organizations").Migrator().DropColumn(&organization{}, "SecurityPolicy")
+		},
+	},
+	{
+		ID:          "0004_deployment_abort_requests",
+		Description: "Add abort requests to deployment executions",
+		Up: func(tx *gorm.DB) error {
+			type deploymentExecutionRecord struct {
+				AbortRequested bool `gorm:"not null;default:false"`
+				AbortCleanup   bool `gorm:"not null;default:false"`
+			}
+			for _, field := range []string{"AbortRequested", "AbortCleanup"} {
+				if tx.Migrator().HasColumn("deployment_execution_records", tx.NamingStrategy.ColumnName("", field)) {
+					continue
+				}
+				if err := tx.Table("deployment_execution_records").Migrator().AddColumn(&deploymentExecutionRecord{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			type deploymentExecutionRecord struct {
+				AbortRequested bool `gorm:"not null;default:false"`
+				AbortCleanup   bool `gorm:"not null;default:false"`
+			}
+			for _, field := range []string{"AbortRequested", "AbortCleanup"} {
+				if err := tx.Table("deployment_execution_records").Migrator().DropColumn(&deploymentExecutionRecord{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "0005_cluster_autopilot",
+		Description: "Add the autopilot policy of clusters",
+		Up: func(tx *gorm.DB) error {
+			type kubernetesCluster struct {
+				Autopilot string `gorm:"type:text"`
+			}
+			if tx.Migrator().HasColumn("kubernetes_clusters", "autopilot") {
+				return nil
+			}
+			return tx.Table("kubernetes_clusters").Migrator().AddColumn(&kubernetesCluster{}, "Autopilot")
+		},
+		Down: func(tx *gorm.DB) error {
+			type kubernetesCluster struct {
+				Autopilot string `gorm:"type:text"`
+			}
+			return tx.Table("kubernetes_clusters").Migrator().DropColumn(&kubernetesCluster{}, "Autopilot")
+		},
+	},
+	{
+		ID:          "0006_cluster_connectors",
+		Description: "Create the in-cluster connectors of clusters",
+		Up: func(tx *gorm.DB) error {
+			type clusterConnector struct {
+				ID             uint `gorm:"primaryKey"`
+				ClusterID      uint `gorm:"not null;uniqueIndex"`
+				Namespace      string
+				ClusterRole    string
+				TokenHash      string `gorm:"not null;uniqueIndex"`
+				ProxyToken     string `gorm:"not null"`
+				RemoteAddr     string
+				ConnectedAt    *time.Time
+				DisconnectedAt *time.Time
+				CreatedAt      time.Time
+				UpdatedAt      time.Time
+			}
+			return tx.Table("cluster_connectors").AutoMigrate(&clusterConnector{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("cluster_connectors")
+		},
+	},
+	{
+		ID:          "0007_agent_query_search",
+		Description: "Index query history by cluster and for full-text search",
+		Up: func(tx *gorm.DB) error {
+			type agentQuery struct {
+				ClusterID *uint `gorm:"index"`
+			}
+			if !tx.Table("agent_queries").Migrator().HasIndex(&agentQuery{}, "ClusterID") {
+				if err := tx.Table("agent_queries").Migrator().CreateIndex(&agentQuery{}, "ClusterID"); err != nil {
+					return err
+				}
+			}
+			return createQuerySearchIndex(tx)
+		},
+		Down: func(tx *gorm.DB) error {
+			if tx.Dialector.Name() == DriverPostgres {
+				if err := tx.Exec("DROP INDEX IF EXISTS " + querySearchIndex).Error; err != nil {
+					return err
+				}
+			}
+			type agentQuery struct {
+				ClusterID *uint `gorm:"index"`
+			}
+			// SQLite drops indexes with the table it rebuilds to drop a column
+			migrator := tx.Table("agent_queries").Migrator()
+			if !migrator.HasIndex(&agentQuery{}, "ClusterID") {
+				return nil
+			}
+			return migrator.DropIndex(&agentQuery{}, "ClusterID")
+		},
+	},
+	{
+		ID:          "0008_deployment_history",
+		Description: "Link deployments to their executions and backfill them",
+		Destructive: true,
+		Up: func(tx *gorm.DB) error {
+			type deployment struct {
+				ID              uint      `gorm:"primaryKey"`
+				UserID          uint      `gorm:"not null;index"`
+				ClusterID       uint      `gorm:"not null;index"`
+				StackName       string    `gorm:"not null"`
+				Status          string    `gorm:"default:'pending'"`
+				Manifest        string    `gorm:"type:text"`
+				Error           string    `gorm:"type:text"`
+				ExecutionID     string    `gorm:"size:191;uniqueIndex"`
+				PlanID          string    `gorm:"index"`
+				StartedAt       time.Time `gorm:"index"`
+				FinishedAt      *time.Time
+				DurationSeconds float64
+				CreatedAt       time.Time
+				UpdatedAt       time.Time
+				DeletedAt       gorm.DeletedAt `gorm:"index"`
+			}
+			if err := tx.Table("deployments").AutoMigrate(&deployment{}); err != nil {
+				return err
+			}
+
+			// Deployments ran before only have their execution records
+			type executionRecord struct {
+				ID        string
+				UserID    uint
+				ClusterID uint
+				PlanID    string
+				Status    string
+				Execution string
+			}
+			var records []executionRecord
+			return tx.Table("deployment_execution_records").Where("deleted_at IS NULL").
+				FindInBatches(&records, 100, func(batch *gorm.DB, _ int) error {
+					deployments := make([]deployment, 0, len(records))
+					for _, record := range records {
+						var execution struct {
+							StartTime time.Time  `json:"start_time"`
+							EndTime   *time.Time `json:"end_time"`
+							Error     string     `json:"error"`
+							Action    string     `json:"action"`
+						}
+						if err := json.Unmarshal([]byte(record.Execution), &execution); err != nil || execution.Action == "uninstall" {
+							continue
+						}
+						var names []string
+						if err := tx.Table("deployment_plan_records").Where("id = ?", record.PlanID).Pluck("name", &names).Error; err != nil {
+							return err
+						}
+						entry := deployment{
+							UserID:      record.UserID,
+							ClusterID:   record.ClusterID,
+							StackName:   record.PlanID,
+							Status:      record.Status,
+							Error:       execution.Error,
+							ExecutionID: record.ID,
+							PlanID:      record.PlanID,
+							StartedAt:   execution.StartTime,
+							FinishedAt:  execution.EndTime,
+						}
+						if len(names) > 0 && names[0] != "" {
+							entry.StackName = names[0]
+						}
+						if execution.EndTime != nil {
+							entry.DurationSeconds = execution.EndTime.Sub(execution.StartTime).Seconds()
+						}
+						deployments = append(deployments, entry)
+					}
+					if len(deployments) == 0 {
+						return nil
+					}
+					return tx.Table("deployments").Clauses(clause.OnConflict{DoNothing: true}).Create(&deployments).Error
+				}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type deployment struct {
+				UserID      uint      `gorm:"index"`
+				ClusterID   uint      `gorm:"index"`
+				ExecutionID string    `gorm:"size:191;uniqueIndex"`
+				PlanID      string    `gorm:"index"`
+				StartedAt   time.Time `gorm:"index"`
+			}
+			// The entries the migration added, or deployments added since
+			if err := tx.Exec("DELETE FROM deployments WHERE execution_id <> ''").Error; err != nil {
+				return err
+			}
+			migrator := tx.Table("deployments").Migrator()
+			for _, field := range []string{"UserID", "ClusterID", "ExecutionID", "PlanID", "StartedAt"} {
+				if migrator.HasIndex(&deployment{}, field) {
+					if err := migrator.DropIndex(&deployment{}, field); err != nil {
+						return err
+					}
+				}
+			}
+			for _, column := range []string{"execution_id", "plan_id", "started_at", "finished_at", "duration_seconds"} {
+				if err := migrator.DropColumn(&deployment{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "0009_platform_administration",
+		Description: "Add the deactivation of users and the LLM usage of completions",
+		Up: func(tx *gorm.DB) error {
+			type user struct {
+				DeactivatedAt *time.Time
+			}
+			if !tx.Migrator().HasColumn("users", "deactivated_at") {
+				if err := tx.Table("users").Migrator().AddColumn(&user{}, "DeactivatedAt"); err != nil {
+					return err
+				}
+			}
+			type llmUsageRecord struct {
+				ID               uint  `gorm:"primaryKey"`
+				UserID           uint  `gorm:"index"`
+				OrganizationID   *uint `gorm:"index"`
+				Model            string
+				Provider         string
+				PromptTokens     int
+				CompletionTokens int
+				TotalTokens      int
+				Cost             float64
+				DurationMs       int64
+				Failed           bool
+				CreatedAt        time.Time `gorm:"index"`
+			}
+			return tx.Table("llm_usage_records").AutoMigrate(&llmUsageRecord{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable("llm_usage_records"); err != nil {
+				return err
+			}
+			type user struct {
+				DeactivatedAt *time.Time
+			}
+			return tx.Table("users").Migrator().DropColumn(&user{}, "DeactivatedAt")
+		},
+	},
+	{
+		ID:          "0010_cluster_labels",
+		Description: "Add the environment and labels of clusters",
+		Up: func(tx *gorm.DB) error {
+			type kubernetesCluster struct {
+				Environment string `gorm:"size:16;index"`
+				Labels      models.Labels
+			}
+			migrator := tx.Table("kubernetes_clusters").Migrator()
+			for _, field := range []string{"Environment", "Labels"} {
+				if tx.Migrator().HasColumn("kubernetes_clusters", tx.NamingStrategy.ColumnName("", field)) {
+					continue
+				}
+				if err := migrator.AddColumn(&kubernetesCluster{}, field); err != nil {
+					return err
+				}
+			}
+			if migrator.HasIndex(&kubernetesCluster{}, "Environment") {
+				return nil
+			}
+			return migrator.CreateIndex(&kubernetesCluster{}, "Environment")
+		},
+		Down: func(tx *gorm.DB) error {
+			type kubernetesCluster struct {
+				Environment string `gorm:"size:16;index"`
+				Labels      models.Labels
+			}
+			migrator := tx.Table("kubernetes_clusters").Migrator()
+			if migrator.HasIndex(&kubernetesCluster{}, "Environment") {
+				if err := migrator.DropIndex(&kubernetesCluster{}, "Environment"); err != nil {
+					return err
+				}
+			}
+			for _, field := range []string{"Environment", "Labels"} {
+				if err := migrator.DropColumn(&kubernetesCluster{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "0011_organization_ingress_policy",
+		Description: "Add the hostname and certificate policy of organizations",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				IngressPolicy string `gorm:"type:text"`
+			}
+			if tx.Migrator().HasColumn("organizations", "ingress_policy") {
+				return nil
+			}
+			return tx.Table("organizations").Migrator().AddColumn(&organization{}, "IngressPolicy")
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				IngressPolicy string `gorm:"type:text"`
+			}
+			return tx.Table("organizations").Migrator().DropColumn(&organization{}, "IngressPolicy")
+		},
+	},
+	{
+		ID:          "0012_plan_edits",
+		Description: "Create the edit history of deployment plans",
+		Up: func(tx *gorm.DB) error {
+			type planEditRecord struct {
+				ID        uint   `gorm:"primaryKey"`
+				PlanID    string `gorm:"size:191;not null;index"`
+				UserID    uint   `gorm:"not null"`
+				Edits     string `gorm:"type:text;not null"`
+				Comment   string `gorm:"type:text"`
+				CreatedAt time.Time
+			}
+			return tx.Table("plan_edit_records").AutoMigrate(&planEditRecord{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("plan_edit_records")
+		},
+	},
+	{
+		ID:          "0013_cluster_snapshot_usage_samples",
+		Description: "Mark cluster snapshots taken to track resource usage",
+		Up: func(tx *gorm.DB) error {
+			type clusterSnapshot struct {
+				UsageSample bool `gorm:"not null;default:false"`
+			}
+			if tx.Migrator().HasColumn("cluster_snapshots", "usage_sample") {
+				return nil
+			}
+			return tx.Table("cluster_snapshots").Migrator().AddColumn(&clusterSnapshot{}, "UsageSample")
+		},
+		Down: func(tx *gorm.DB) error {
+			type clusterSnapshot struct {
+				UsageSample bool `gorm:"not null;default:false"`
+			}
+			return tx.Table("cluster_snapshots").Migrator().DropColumn(&clusterSnapshot{}, "UsageSample")
+		},
+	},
+	{
+		ID:          "0014_api_keys",
+		Description: "Create the API keys users authenticate scripts and the CLI with",
+		Up: func(tx *gorm.DB) error {
+			type apiKey struct {
+				ID         uint   `gorm:"primaryKey"`
+				UserID     uint   `gorm:"not null;index"`
+				Name       string `gorm:"not null"`
+				Prefix     string `gorm:"size:16;not null"`
+				KeyHash    string `gorm:"size:64;uniqueIndex;not null"`
+				ExpiresAt  *time.Time
+				LastUsedAt *time.Time
+				CreatedAt  time.Time
+			}
+			return tx.Table("api_keys").AutoMigrate(&apiKey{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("api_keys")
+		},
+	},
+	{
+		ID:          "0015_conversation_contexts",
+		Description: "Create the default cluster and namespace of a session's queries",
+		Up: func(tx *gorm.DB) error {
+			type conversationContext struct {
+				ID        uint   `gorm:"primaryKey"`
+				SessionID string `gorm:"size:64;uniqueIndex;not null"`
+				UserID    uint   `gorm:"not null;index"`
+				ClusterID uint   `gorm:"not null"`
+				Namespace string
+				ExpiresAt *time.Time `gorm:"index"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			return tx.Table("conversation_contexts").AutoMigrate(&conversationContext{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("conversation_contexts")
+		},
+	},
+	{
+		ID:          "0016_organization_chart_policy",
+		Description: "Add the chart ranking policy of organizations",
+		Up: func(tx *gorm.DB) error {
+			type organization struct {
+				ChartPolicy string `gorm:"type:text"`
+			}
+			if tx.Migrator().HasColumn("organizations", "chart_policy") {
+				return nil
+			}
+			return tx.Table("organizations").Migrator().AddColumn(&organization{}, "ChartPolicy")
+		},
+		Down: func(tx *gorm.DB) error {
+			type organization struct {
+				ChartPolicy string `gorm:"type:text"`
+			}
+			return tx.Table("organizations").Migrator().DropColumn(&organization{}, "ChartPolicy")
+		},
+	},
+	{
+		ID:          "0017_org_chart_rules",
+		Description: "Create the charts and repositories organizations allow or block",
+		Up: func(tx *gorm.DB) error {
+			type orgChartRule struct {
+				ID             uint   `gorm:"primaryKey"`
+				OrganizationID uint   `gorm:"not null;index"`
+				Action         string `gorm:"size:16;not null"`
+				Repository     string
+				Chart          string
+				Reason         string `gorm:"type:text"`
+				UpdatedBy      uint
+				CreatedAt      time.Time
+				UpdatedAt      time.Time
+			}
+			return tx.Table("org_chart_rules").AutoMigrate(&orgChartRule{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("org_chart_rules")
+		},
+	},
+	{
+		ID:          "0018_deployment_jobs",
+		Description: "Create the deployment job queue and its workers",
+		Up: func(tx *gorm.DB) error {
+			type job struct {
+				ID             string `gorm:"primaryKey"`
+				Kind           string `gorm:"not null;index"`
+				UserID         uint   `gorm:"not null;index"`
+				OperationID    string `gorm:"index"`
+				Payload        string `gorm:"type:text"`
+				Status         string `gorm:"default:'queued';index"`
+				WorkerID       string `gorm:"index"`
+				Attempts       int
+				ResponseStatus int
+				Response       string `gorm:"type:text"`
+				Error          string `gorm:"type:text"`
+				StartedAt      *time.Time
+				FinishedAt     *time.Time
+				CreatedAt      time.Time `gorm:"index"`
+				UpdatedAt      time.Time
+			}
+			type worker struct {
+				ID            string `gorm:"primaryKey"`
+				Hostname      string
+				Concurrency   int
+				RunningJobs   int
+				JobsSucceeded int
+				JobsFailed    int
+				StartedAt     time.Time
+				HeartbeatAt   time.Time `gorm:"index"`
+				StoppedAt     *time.Time
+			}
+			if err := tx.Table("jobs").AutoMigrate(&job{}); err != nil {
+				return err
+			}
+			return tx.Table("workers").AutoMigrate(&worker{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable("workers"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable("jobs")
+		},
+	},
+	{
+		ID:          "0019_agent_query_feedback",
+		Description: "Add the prompt version and the asking user's rating of agent answers",
+		Destructive: true,
+		Up: func(tx *gorm.DB) error {
+			type agentQuery struct {
+				PromptVersion   string `gorm:"size:32;index"`
+				Rating          *int   `gorm:"index"`
+				FeedbackComment string `gorm:"type:text"`
+				RatedAt         *time.Time
+			}
+			migrator := tx.Table("agent_queries").Migrator()
+			for _, field := range []string{"PromptVersion", "Rating", "FeedbackComment", "RatedAt"} {
+				if tx.Migrator().HasColumn("agent_queries", tx.NamingStrategy.ColumnName("", field)) {
+					continue
+				}
+				if err := migrator.AddColumn(&agentQuery{}, field); err != nil {
+					return err
+				}
+			}
+			for _, field := range []string{"PromptVersion", "Rating"} {
+				if migrator.HasIndex(&agentQuery{}, field) {
+					continue
+				}
+				if err := migrator.CreateIndex(&agentQuery{}, field); err != nil {
+					return err
+				}
+			}
+			// Earlier queries were answered with the first prompt
+			return tx.Table("agent_queries").Where("prompt_version IS NULL OR prompt_version = ''").Update("prompt_version", "v1").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type agentQuery struct {
+				PromptVersion   string `gorm:"size:32;index"`
+				Rating          *int   `gorm:"index"`
+				FeedbackComment string `gorm:"type:text"`
+				RatedAt         *time.Time
+			}
+			migrator := tx.Table("agent_queries").Migrator()
+			for _, field := range []string{"PromptVersion", "Rating", "FeedbackComment", "RatedAt"} {
+				if err := migrator.DropColumn(&agentQuery{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "0020_cluster_contexts",
+		Description: "Add the kubeconfig context clusters are reached through and the contexts of their kubeconfig",
+		Up: func(tx *gorm.DB) error {
+			type kubernetesCluster struct {
+				Context  string
+				Contexts models.KubeContexts
+			}
+			migrator := tx.Table("kubernetes_clusters").Migrator()
+			for _, field := range []string{"Context", "Contexts"} {
+				if tx.Migrator().HasColumn("kubernetes_clusters", tx.NamingStrategy.ColumnName("", field)) {
+					continue
+				}
+				if err := migrator.AddColumn(&kubernetesCluster{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			type kubernetesCluster struct {
+				Context  string
+				Contexts models.KubeContexts
+			}
+			migrator := tx.Table("kubernetes_clusters").Migrator()
+			for _, field := range []string{"Context", "Contexts"} {
+				if err := migrator.DropColumn(&kubernetesCluster{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID:          "0021_org_stack_templates",
+		Description: "Create the stack templates organizations publish and the approvals of plans needing several",
+		Up: func(tx *gorm.DB) error {
+			type orgStackTemplate struct {
+				ID                uint   `gorm:"primaryKey"`
+				OrganizationID    uint   `gorm:"not null;uniqueIndex:idx_org_stack_template_name"`
+				Name              string `gorm:"size:191;not null;uniqueIndex:idx_org_stack_template_name"`
+				Category          string `gorm:"size:32;not null"`
+				Version           string `gorm:"size:64;not null"`
+				Template          string `gorm:"type:text;not null"`
+				Instructions      string `gorm:"type:text"`
+				RequiredApprovals int
+				UpdatedBy         uint
+				CreatedAt         time.Time
+				UpdatedAt         time.Time
+			}
+			type planApproval struct {
+				ID        uint   `gorm:"primaryKey"`
+				PlanID    string `gorm:"size:191;not null;uniqueIndex:idx_plan_approval_user"`
+				UserID    uint   `gorm:"not null;uniqueIndex:idx_plan_approval_user"`
+				Comment   string `gorm:"type:text"`
+				CreatedAt time.Time
+			}
+			type deploymentPlanRecord struct {
+				RequiredApprovals int
+			}
+			if err := tx.Table("org_stack_templates").AutoMigrate(&orgStackTemplate{}); err != nil {
+				return err
+			}
+			if err := tx.Table("plan_approvals").AutoMigrate(&planApproval{}); err != nil {
+				return err
+			}
+			if tx.Migrator().HasColumn("deployment_plan_records", "required_approvals") {
+				return nil
+			}
+			return tx.Table("deployment_plan_records").Migrator().AddColumn(&deploymentPlanRecord{}, "RequiredApprovals")
+		},
+		Down: func(tx *gorm.DB) error {
+			type deploymentPlanRecord struct {
+				RequiredApprovals int
+			}
+			if err := tx.Table("deployment_plan_records").Migrator().DropColumn(&deploymentPlanRecord{}, "RequiredApprovals"); err != nil {
+				return err
+			}
+			if err := tx.Migrator().DropTable("plan_approvals"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable("org_stack_templates")
+		},
+	},
+	{
+		ID:          "0022_org_value_overlays",
+		Description: "Create the value overlays organizations set for each environment",
+		Up: func(tx *gorm.DB) error {
+			type orgValueOverlay struct {
+				ID             uint   `gorm:"primaryKey"`
+				OrganizationID uint   `gorm:"not null;uniqueIndex:idx_org_value_overlay_environment"`
+				Environment    string `gorm:"size:16;not null;uniqueIndex:idx_org_value_overlay_environment"`
+				Overlay        string `gorm:"type:text;not null"`
+				UpdatedBy      uint
+				CreatedAt      time.Time
+				UpdatedAt      time.Time
+			}
+			return tx.Table("org_value_overlays").AutoMigrate(&orgValueOverlay{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("org_value_overlays")
+		},
+	},
+	{
+		ID:          "0023_slack_accounts",
+		Description: "Create the Slack accounts linked to platform users",
+		Up: func(tx *gorm.DB) error {
+			type slackAccount struct {
+				ID                uint   `gorm:"primaryKey"`
+				TeamID            string `gorm:"size:32;not null;uniqueIndex:idx_slack_account_user"`
+				SlackUserID       string `gorm:"size:32;not null;uniqueIndex:idx_slack_account_user"`
+				SlackUserName     string
+				UserID            *uint `gorm:"index"`
+				ClusterID         *uint
+				LinkCodeHash      string `gorm:"size:64;index"`
+				LinkCodeExpiresAt *time.Time
+				LinkedAt          *time.Time
+				CreatedAt         time.Time
+				UpdatedAt         time.Time
+			}
+			return tx.Table("slack_accounts").AutoMigrate(&slackAccount{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("slack_accounts")
+		},
+	},
+	{
+		// The table was auto-migrated at every start before. Only PostgreSQL
+		// servers with pgvector get it, so install the extension first.
+		ID:          "0024_knowledge_chunks",
+		Description: "Create the knowledge base chunk table on PostgreSQL with pgvector",
+		Up: func(tx *gorm.DB) error {
+			if enabled, err := enableVectorExtension(tx); err != nil || !enabled {
+				return err
+			}
+			type knowledgeChunk struct {
+				ID             uint  `gorm:"primaryKey"`
+				DocumentID     uint  `gorm:"not null;index"`
+				UserID         uint  `gorm:"not null;index"`
+				OrganizationID *uint `gorm:"index"`
+				Index          int
+				Content        string        `gorm:"type:text;not null"`
+				Embedding      models.Vector `gorm:"not null"`
+				CreatedAt      time.Time
+			}
+			return tx.Table("knowledge_chunks").AutoMigrate(&knowledgeChunk{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("knowledge_chunks")
+		},
+	},
+	{
+		// Like the knowledge base chunks, only on PostgreSQL with pgvector
+		ID:          "0025_query_embeddings",
+		Description: "Create the embeddings of answered queries for similar query search on PostgreSQL with pgvector",
+		Up: func(tx *gorm.DB) error {
+			if enabled, err := enableVectorExtension(tx); err != nil || !enabled {
+				return err
+			}
+			type queryEmbedding struct {
+				ID             uint          `gorm:"primaryKey"`
+				QueryID        uint          `gorm:"not null;uniqueIndex"`
+				UserID         uint          `gorm:"not null;index"`
+				OrganizationID *uint         `gorm:"index"`
+				Embedding      models.Vector `gorm:"not null"`
+				CreatedAt      time.Time
+			}
+			return tx.Table("query_embeddings").AutoMigrate(&queryEmbedding{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("query_embeddings")
+		},
+	},
+	{
+		ID:          "0026_job_executions",
+		Description: "Add the deployment a job started, which requeued jobs resume",
+		Up: func(tx *gorm.DB) error {
+			type job struct {
+				ExecutionID string
+			}
+			if tx.Migrator().HasColumn("jobs", "execution_id") {
+				return nil
+			}
+			return tx.Table("jobs").Migrator().AddColumn(&job{}, "ExecutionID")
+		},
+		Down: func(tx *gorm.DB) error {
+			type job struct {
+				ExecutionID string
+			}
+			return tx.Table("jobs").Migrator().DropColumn(&job{}, "ExecutionID")
+		},
+	},
+	{
+		ID:          "0027_job_connector_clusters",
+		Description: "Add the connector cluster of jobs, which only the replica holding its tunnel runs",
+		Up: func(tx *gorm.DB) error {
+			type job struct {
+				ConnectorClusterID *uint `gorm:"index"`
+			}
+			if tx.Migrator().HasColumn("jobs", "connector_cluster_id") {
+				return nil
+			}
+			return tx.Table("jobs").Migrator().AddColumn(&job{}, "ConnectorClusterID")
+		},
+		Down: func(tx *gorm.DB) error {
+			type job struct {
+				ConnectorClusterID *uint `gorm:"index"`
+			}
+			return tx.Table("jobs").Migrator().DropColumn(&job{}, "ConnectorClusterID")
+		},
+	},
+	{
+		ID:          "0028_deployment_locks",
+		Description: "Create the deployment namespace locks shared by replicas without Redis",
+		Up: func(tx *gorm.DB) error {
+			type deploymentLockRecord struct {
+				ID        string    `gorm:"primaryKey;size:191"`
+				Owner     string    `gorm:"size:64;not null"`
+				Holder    string    `gorm:"type:text;not null"`
+				ExpiresAt time.Time `gorm:"not null;index"`
+			}
+			return tx.Table("deployment_lock_records").AutoMigrate(&deploymentLockRecord{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("deployment_lock_records")
+		},
+	},
+}
+
+// enableVectorExtension enables pgvector on PostgreSQL servers that have it
+// and reports whether it did. Without it the knowledge base and similar query
+// search are disabled.
+func enableVectorExtension(tx *gorm.DB) (bool, error) {
+	if tx.Dialector.Name() != DriverPostgres {
+		return false, nil
+	}
+	var available int64
+	if err := tx.Raw("SELECT COUNT(*) FROM pg_available_extensions WHERE name = 'vector'").Scan(&available).Error; err != nil {
+		return false, err
+	}
+	if available == 0 {
+		return false, nil
+	}
+	return true, tx.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error
+}
+
+// QuerySearchDocument is the text of a query history entry that PostgreSQL's
+// full-text search matches
+const QuerySearchDocument = "to_tsvector('english', query || ' ' || COALESCE(response, ''))"
+
+// querySearchIndex serves full-text searches of the query history
+const querySearchIndex = "idx_agent_queries_search"
+
+// createQuerySearchIndex indexes the query history for full-text search on
+// PostgreSQL, whose searches other databases can't serve from an index
+func createQuerySearchIndex(tx *gorm.DB) error {
+	if tx.Dialector.Name() != DriverPostgres {
+		return nil
+	}
+	return tx.Exec("CREATE INDEX IF NOT EXISTS " + querySearchIndex + " ON agent_queries USING GIN (" + QuerySearchDocument + ")").Error
+}
+
+// Migrate applies pending migrations in order and returns the IDs applied.
+// Nothing is applied when a destructive migration is pending and not allowed,
+// except on an empty database, which has no data to lose.
+func Migrate(db *gorm.DB, opts MigrateOptions) ([]string, error) {
+	var applied []string
+	err := withMigrationLock(db, func(conn *gorm.DB) error {
+		fresh := !conn.Migrator().HasTable(&migrationRecord{}) && !conn.Migrator().HasTable("users")
+		if err := conn.AutoMigrate(&migrationRecord{}); err != nil {
+			return fmt.Errorf("failed to create migrations table: %w", err)
+		}
+
+		pending, err := pendingMigrations(conn, opts.Target)
+		if err != nil {
+			return err
+		}
+		if !opts.AllowDestructive && !fresh {
+			for _, migration := range pending {
+				if migration.Destructive {
+					return fmt.Errorf("migration %s is destructive (%s), apply it with migrate up --allow-destructive", migration.ID, migration.Description)
+				}
+			}
+		}
+
+		for _, migration := range pending {
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&migrationRecord{ID: migration.ID, AppliedAt: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration.ID, err)
+			}
+			applied = append(applied, migration.ID)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Rollback reverts the last steps applied migrations, newest first, and
+// returns their IDs. Reverting drops data, so it has to be allowed.
+func Rollback(db *gorm.DB, steps int, allowDestructive bool) ([]string, error) {
+	if !allowDestructive {
+		return nil, fmt.Errorf("rolling back drops data, allow it with --allow-destructive")
+	}
+
+	var reverted []string
+	err := withMigrationLock(db, func(conn *gorm.DB) error {
+		var records []migrationRecord
+		if err := conn.Order("id DESC").Limit(steps).Find(&records).Error; err != nil {
+			return fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		for _, record := range records {
+			migration, ok := findMigration(record.ID)
+			if !ok {
+				return fmt.Errorf("migration %s is applied but unknown to this version", record.ID)
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&migrationRecord{}, "id = ?", migration.ID).Error
+			})
+			if err != nil {
+				return fmt.Errorf("rolling back migration %s failed: %w", migration.ID, err)
+			}
+			reverted = append(reverted, migration.ID)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatuses lists every migration and when it was applied
+func MigrationStatuses(db *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{ID: migration.ID, Description: migration.Description, Destructive: migration.Destructive}
+		if at, ok := applied[migration.ID]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// PendingMigrations returns the IDs of the migrations not yet applied
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	pending, err := pendingMigrations(db, "")
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(pending))
+	for _, migration := range pending {
+		ids = append(ids, migration.ID)
+	}
+	return ids, nil
+}
+
+// pendingMigrations returns the migrations up to target that aren't applied
+func pendingMigrations(db *gorm.DB, target string) ([]Migration, error) {
+	if target != "" {
+		if _, ok := findMigration(target); !ok {
+			return nil, fmt.Errorf("unknown migration %s", target)
+		}
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.ID]; !ok {
+			pending = append(pending, migration)
+		}
+		if migration.ID == target {
+			break
+		}
+	}
+	return pending, nil
+}
+
+// appliedMigrations returns when each applied migration was applied
+func appliedMigrations(db *gorm.DB) (map[string]time.Time, error) {
+	applied := make(map[string]time.Time)
+	if !db.Migrator().HasTable(&migrationRecord{}) {
+		return applied, nil
+	}
+	var records []migrationRecord
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	for _, record := range records {
+		applied[record.ID] = record.AppliedAt
+	}
+	return applied, nil
+}
+
+func findMigration(id string) (Migration, bool) {
+	i := sort.Search(len(migrations), func(i int) bool { return migrations[i].ID >= id })
+	if i < len(migrations) && migrations[i].ID == id {
+		return migrations[i], true
+	}
+	return Migration{}, false
+}
+
+// withMigrationLock runs fn on a single connection holding a lock that keeps
+// other replicas from migrating at the same time. SQLite databases belong to
+// one process and need none.
+func withMigrationLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	return db.Connection(func(conn *gorm.DB) error {
+		// Chained calls on the connection would otherwise share its statement
+		conn = conn.Session(&gorm.Session{})
+		switch conn.Dialector.Name() {
+		case DriverPostgres:
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+				return fmt.Errorf("failed to lock migrations: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+		case DriverMySQL:
+			var locked int
+			if err := conn.Raw("SELECT GET_LOCK(?, 600)", migrationLockName).Scan(&locked).Error; err != nil {
+				return fmt.Errorf("failed to lock migrations: %w", err)
+			}
+			if locked != 1 {
+				return fmt.Errorf("timed out waiting for another replica's migrations")
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", migrationLockName)
+		}
+		return fn(conn)
+	})
+}
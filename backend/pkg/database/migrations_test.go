@@ -0,0 +1,173 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"grafana-ai-agent-platform/backend/internal/config"
+	"grafana-ai-agent-platform/backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// connectTestDatabase opens an empty SQLite database
+func connectTestDatabase(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Connect(config.DatabaseConfig{
+		Driver: DriverSQLite,
+		Path:   filepath.Join(t.TempDir(), "platform.db"),
+	}, logger.Silent)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	return db
+}
+
+// TestMigrationsCreateModels migrates an empty database and checks that every
+// column of the models has a table and column to go to
+func TestMigrationsCreateModels(t *testing.T) {
+	db := connectTestDatabase(t)
+	applied, err := Migrate(db, MigrateOptions{})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+
+	stored := []interface{}{
+		&models.Organization{},
+		&models.User{},
+		&models.APIKey{},
+		&models.KubernetesCluster{},
+		&models.ClusterSnapshot{},
+		&models.ClusterHealthCheck{},
+		&models.ClusterConnector{},
+		&models.AgentQuery{},
+		&models.ConversationContext{},
+		&models.LLMUsageRecord{},
+		&models.Deployment{},
+		&models.DeploymentPlanRecord{},
+		&models.PlanEditRecord{},
+		&models.PlanApproval{},
+		&models.DeploymentExecutionRecord{},
+		&models.DeploymentLockRecord{},
+		&models.DeploymentStepRecord{},
+		&models.DeploymentStepMetric{},
+		&models.KnownIssue{},
+		&models.OrgValuePolicy{},
+		&models.OrgValueOverlay{},
+		&models.OrgPolicy{},
+		&models.OrgChartRule{},
+		&models.OrgStackTemplate{},
+		&models.HelmRegistry{},
+		&models.GrafanaInstance{},
+		&models.Runbook{},
+		&models.KnowledgeDocument{},
+		&models.Notification{},
+		&models.NotificationChannel{},
+		&models.SlackAccount{},
+		&models.ScheduledDeployment{},
+		&models.Operation{},
+		&models.Job{},
+		&models.Worker{},
+		&models.AuditLog{},
+	}
+	for _, model := range stored {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		table := stmt.Schema.Table
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("no migration creates table %s", table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !db.Migrator().HasColumn(table, field.DBName) {
+				t.Errorf("no migration adds column %s.%s", table, field.DBName)
+			}
+		}
+	}
+}
+
+// TestDestructiveMigrationsNeedAllowing checks that a database with data is
+// neither migrated past a destructive migration nor rolled back unless that
+// is allowed
+func TestDestructiveMigrationsNeedAllowing(t *testing.T) {
+	var destructive string
+	for _, migration := range migrations {
+		if migration.Destructive {
+			destructive = migration.ID
+			break
+		}
+	}
+	if destructive == "" {
+		t.Skip("no destructive migration")
+	}
+	var before string
+	for _, migration := range migrations {
+		if migration.ID == destructive {
+			break
+		}
+		before = migration.ID
+	}
+
+	db := connectTestDatabase(t)
+	if _, err := Migrate(db, MigrateOptions{Target: before}); err != nil {
+		t.Fatalf("migrate to %s: %v", before, err)
+	}
+
+	applied, err := Migrate(db, MigrateOptions{})
+	if err == nil || !strings.Contains(err.Error(), destructive) {
+		t.Fatalf("migrating past %s without allowing it: err = %v, want it refused", destructive, err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("refused migration still applied %v", applied)
+	}
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		t.Fatalf("pending migrations: %v", err)
+	}
+	if len(pending) == 0 || pending[0] != destructive {
+		t.Fatalf("pending migrations = %v, want them to start with %s", pending, destructive)
+	}
+
+	if _, err := Rollback(db, 1, false); err == nil {
+		t.Fatal("rolled back without allowing it")
+	}
+
+	if _, err := Migrate(db, MigrateOptions{AllowDestructive: true}); err != nil {
+		t.Fatalf("migrate allowing destructive migrations: %v", err)
+	}
+	if pending, err := PendingMigrations(db); err != nil || len(pending) != 0 {
+		t.Fatalf("pending migrations = %v (%v), want none", pending, err)
+	}
+}
+
+// TestRollbackRevertsMigrations rolls every migration back and applies them
+// again, so Down and Up stay each other's reverse
+func TestRollbackRevertsMigrations(t *testing.T) {
+	db := connectTestDatabase(t)
+	if _, err := Migrate(db, MigrateOptions{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	reverted, err := Rollback(db, len(migrations), true)
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if len(reverted) != len(migrations) {
+		t.Fatalf("reverted %d migrations, want %d", len(reverted), len(migrations))
+	}
+	if db.Migrator().HasTable("users") {
+		t.Fatal("users table left after rolling back every migration")
+	}
+	if _, err := Migrate(db, MigrateOptions{AllowDestructive: true}); err != nil {
+		t.Fatalf("migrate again: %v", err)
+	}
+}
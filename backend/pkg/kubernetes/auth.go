@@ -0,0 +1,265 @@
+package kubernetes
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Cluster authentication modes
+const (
+	// AuthModeKubeconfig connects with a full kubeconfig
+	AuthModeKubeconfig = "kubeconfig"
+	// AuthModeToken connects with a bearer token and the API server's CA
+	AuthModeToken = "token"
+	// AuthModeServiceAccount connects with a ServiceAccount token, checked to
+	// belong to the ServiceAccount it names
+	AuthModeServiceAccount = "service_account"
+	// AuthModeConnector connects through the tunnel of an in-cluster connector
+	AuthModeConnector = "connector"
+)
+
+// serviceAccountUserPrefix starts the username of ServiceAccount tokens
+const serviceAccountUserPrefix = "system:serviceaccount:"
+
+// ClusterAuth is how the platform authenticates to a cluster. Every mode is
+// stored as a kubeconfig, so clients and helm connect the same way.
+type ClusterAuth struct {
+	Mode       string
+	KubeConfig string
+	// Server, Token and CACert (PEM) are used by the token modes
+	Server                string
+	Token                 string
+	CACert                string
+	InsecureSkipTLSVerify bool
+	// Impersonate and ImpersonateGroups act as another user, in any mode
+	Impersonate       string
+	ImpersonateGroups []string
+}
+
+// Validate checks that the fields of the auth mode are present and well formed
+func (a ClusterAuth) Validate() error {
+	switch a.Mode {
+	case "", AuthModeKubeconfig:
+		if a.KubeConfig == "" {
+			return fmt.Errorf("kube_config is required")
+		}
+		if err := ValidateKubeconfigFormat(a.KubeConfig); err != nil {
+			return fmt.Errorf("invalid kubeconfig format: %w", err)
+		}
+	case AuthModeToken, AuthModeServiceAccount:
+		if err := a.validateToken(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown auth mode %q, expected kubeconfig, token or service_account", a.Mode)
+	}
+
+	if len(a.ImpersonateGroups) > 0 && a.Impersonate == "" {
+		return fmt.Errorf("impersonate is required to impersonate groups")
+	}
+	return nil
+}
+
+// validateToken checks the fields of the token modes
+func (a ClusterAuth) validateToken() error {
+	server, err := url.Parse(a.Server)
+	if err != nil || server.Scheme != "https" || server.Host == "" {
+		return fmt.Errorf("server must be the https URL of the API server")
+	}
+	token := strings.TrimSpace(a.Token)
+	if token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if strings.ContainsAny(token, " \t\n") {
+		return fmt.Errorf("token must be a single bearer token")
+	}
+	if a.CACert == "" && !a.InsecureSkipTLSVerify {
+		return fmt.Errorf("ca_cert is required unless insecure_skip_tls_verify is set")
+	}
+	if a.CACert != "" {
+		if err := validateCACert(a.CACert); err != nil {
+			return err
+		}
+	}
+
+	if a.Mode == AuthModeServiceAccount {
+		username, err := ServiceAccountTokenUser(token)
+		if err != nil {
+			return err
+		}
+		if a.Impersonate != "" && a.Impersonate == username {
+			return fmt.Errorf("impersonate names the token's own ServiceAccount")
+		}
+	}
+	return nil
+}
+
+// validateCACert checks that a CA bundle holds at least one PEM certificate
+func validateCACert(caCert string) error {
+	rest := []byte(caCert)
+	found := false
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("invalid ca_cert: %w", err)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("ca_cert must hold a PEM encoded certificate")
+	}
+	return nil
+}
+
+// ServiceAccountTokenUser returns the username of a ServiceAccount token,
+// system:serviceaccount:<namespace>:<name>, from its unverified claims. The API
+// server verifies the signature when the token is used.
+func ServiceAccountTokenUser(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("token is not a ServiceAccount token: expected a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("token is not a ServiceAccount token: %w", err)
+	}
+
+	var claims struct {
+		Subject   string `json:"sub"`
+		ExpiresAt int64  `json:"exp"`
+		// Legacy Secret-based tokens name the ServiceAccount in claims of their own
+		Namespace      string `json:"kubernetes.io/serviceaccount/namespace"`
+		ServiceAccount string `json:"kubernetes.io/serviceaccount/service-account.name"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("token is not a ServiceAccount token: %w", err)
+	}
+	if claims.ExpiresAt != 0 && time.Unix(claims.ExpiresAt, 0).Before(time.Now()) {
+		return "", fmt.Errorf("token expired at %s", time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+
+	username := claims.Subject
+	if username == "" && claims.Namespace != "" && claims.ServiceAccount != "" {
+		username = serviceAccountUserPrefix + claims.Namespace + ":" + claims.ServiceAccount
+	}
+	if !strings.HasPrefix(username, serviceAccountUserPrefix) || strings.Count(username, ":") != 3 {
+		return "", fmt.Errorf("token does not belong to a ServiceAccount")
+	}
+	return username, nil
+}
+
+// Kubeconfig returns the kubeconfig that authenticates as the auth mode says
+func (a ClusterAuth) Kubeconfig() (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+
+	var config *api.Config
+	switch a.Mode {
+	case AuthModeToken, AuthModeServiceAccount:
+		config = api.NewConfig()
+		config.Clusters["cluster"] = &api.Cluster{
+			Server:                   strings.TrimRight(a.Server, "/"),
+			CertificateAuthorityData: []byte(a.CACert),
+			InsecureSkipTLSVerify:    a.InsecureSkipTLSVerify,
+		}
+		config.AuthInfos["user"] = &api.AuthInfo{Token: strings.TrimSpace(a.Token)}
+		config.Contexts["default"] = &api.Context{Cluster: "cluster", AuthInfo: "user"}
+		config.CurrentContext = "default"
+	default:
+		if a.Impersonate == "" {
+			return a.KubeConfig, nil
+		}
+		parsed, err := ParseKubeconfig(a.KubeConfig)
+		if err != nil {
+			return "", err
+		}
+		config = parsed
+	}
+
+	if a.Impersonate != "" {
+		current := config.Contexts[config.CurrentContext]
+		authInfo := config.AuthInfos[current.AuthInfo]
+		if authInfo == nil {
+			return "", fmt.Errorf("the current context has no user to impersonate with")
+		}
+		authInfo.Impersonate = a.Impersonate
+		authInfo.ImpersonateGroups = a.ImpersonateGroups
+	}
+
+	encoded, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// VerifyIdentity checks that the cluster authenticates the client as the auth
+// mode expects: as the token's ServiceAccount, or as the impersonated user.
+// Clusters too old for SelfSubjectReview (before 1.28) are not checked.
+func (k *KubernetesClient) VerifyIdentity(ctx context.Context, auth ClusterAuth) (string, error) {
+	review, err := k.clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to review the authenticated user: %w", err)
+	}
+	username := review.Status.UserInfo.Username
+
+	switch {
+	case auth.Impersonate != "":
+		if username != auth.Impersonate {
+			return username, fmt.Errorf("the cluster authenticated %s instead of the impersonated %s", username, auth.Impersonate)
+		}
+	case auth.Mode == AuthModeServiceAccount:
+		expected, err := ServiceAccountTokenUser(auth.Token)
+		if err != nil {
+			return username, err
+		}
+		if username != expected {
+			return username, fmt.Errorf("the cluster authenticated %s instead of the token's ServiceAccount %s", username, expected)
+		}
+	}
+	return username, nil
+}
+
+// CanI reports whether the client may perform an action, with the
+// authorizer's reason when it may not
+func (k *KubernetesClient) CanI(ctx context.Context, attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+	return AccessReview(ctx, k.clientset, attributes)
+}
+
+// AccessReview asks the API server with a SelfSubjectAccessReview whether the
+// clientset's credential may perform an action
+func AccessReview(ctx context.Context, clientset kubernetes.Interface, attributes authorizationv1.ResourceAttributes) (bool, string, error) {
+	review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to review access: %w", err)
+	}
+	return review.Status.Allowed, review.Status.Reason, nil
+}
@@ -1,27 +1,78 @@
 package kubernetes
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 	"time"
 
+	"grafana-ai-agent-platform/backend/pkg/tracing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
 )
 
 type KubernetesClient struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	mapper    meta.RESTMapper
 	config    *rest.Config
 }
 
+// ManifestObjectResult describes the outcome of submitting a single manifest object
+type ManifestObjectResult struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	Action    string `json:"action"`           // created, configured, unchanged, failed
+	Reason    string `json:"reason,omitempty"` // schema, admission, forbidden, conflict, error
+	Error     string `json:"error,omitempty"`
+}
+
 type ClusterInfo struct {
 	Version   string `json:"version"`
 	ServerURL string `json:"server_url"`
 	IsValid   bool   `json:"is_valid"`
 	Error     string `json:"error,omitempty"`
+	// Identity is the user the cluster authenticated, when it reports it
+	Identity string `json:"identity,omitempty"`
+	// Kubeconfig describes the validated kubeconfig and suggests a cluster name
+	Kubeconfig *KubeconfigInfo `json:"kubeconfig,omitempty"`
+}
+
+// RESTConfig parses a kubeconfig into the config of client-go clients. API
+// requests made on behalf of a traced operation are traced.
+func RESTConfig(kubeconfig string) (*rest.Config, error) {
+	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	if err != nil {
+		return nil, err
+	}
+	config.Wrap(tracing.WrapTransport("k8s"))
+	return config, nil
 }
 
 func NewKubernetesClient(kubeconfig string) (*KubernetesClient, error) {
@@ -31,7 +82,7 @@ func NewKubernetesClient(kubeconfig string) (*KubernetesClient, error) {
 	}
 
 	// Parse kubeconfig
-	config, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	config, err := RESTConfig(kubeconfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
 	}
@@ -47,8 +98,17 @@ func NewKubernetesClient(kubeconfig string) (*KubernetesClient, error) {
 		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+
 	return &KubernetesClient{
 		clientset: clientset,
+		dynamic:   dynamicClient,
+		mapper:    mapper,
 		config:    config,
 	}, nil
 }
@@ -58,7 +118,7 @@ func (k *KubernetesClient) ValidateCluster() (*ClusterInfo, error) {
 	defer cancel()
 
 	// Get server info
-	serverVersion, err := k.clientset.ServerVersion()
+	serverVersion, err := k.clientset.Discovery().ServerVersion()
 	if err != nil {
 		return &ClusterInfo{
 			IsValid: false,
@@ -109,17 +169,708 @@ func (k *KubernetesClient) GetClusterResources() (map[string]interface{}, error)
 	return resources, nil
 }
 
-func (k *KubernetesClient) ApplyManifest(manifest string) error {
-	// This is a simplified version. In production, you'd want to use kubectl apply
-	// or implement proper manifest parsing and application
-	_, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+// ApplyManifest applies every object of a multi-document YAML manifest with
+// server-side apply. Namespaces and CRDs are applied before the objects that
+// depend on them.
+func (k *KubernetesClient) ApplyManifest(manifest, defaultNamespace string) ([]ManifestObjectResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	objects, err := ParseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.ApplyObjects(ctx, objects, defaultNamespace), nil
+}
+
+// applyFieldManager owns the fields the platform sets through server-side apply
+const applyFieldManager = "grafana-ai-agent-platform"
+
+// applyOrder ranks kinds that other objects depend on; unlisted kinds come last
+var applyOrder = map[string]int{
+	"Namespace":                0,
+	"CustomResourceDefinition": 1,
+	"PriorityClass":            2,
+	"StorageClass":             2,
+	"ServiceAccount":           3,
+	"ClusterRole":              3,
+	"Role":                     3,
+	"ClusterRoleBinding":       4,
+	"RoleBinding":              4,
+	"ConfigMap":                5,
+	"Secret":                   5,
+	"PersistentVolumeClaim":    5,
+	"Service":                  6,
+}
+
+// ApplyObjects server-side applies objects in dependency order, reporting whether
+// each was created, configured or left unchanged
+func (k *KubernetesClient) ApplyObjects(ctx context.Context, objects []*unstructured.Unstructured, defaultNamespace string) []ManifestObjectResult {
+	ordered := make([]*unstructured.Unstructured, len(objects))
+	copy(ordered, objects)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return applyRank(ordered[i].GetKind()) < applyRank(ordered[j].GetKind())
+	})
+
+	results := make([]ManifestObjectResult, 0, len(ordered))
+	for _, obj := range ordered {
+		result := ManifestObjectResult{
+			Kind:      obj.GetKind(),
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+		}
+
+		resourceClient, err := k.resourceFor(obj, defaultNamespace)
+		if err != nil {
+			// Kinds from CRDs applied earlier in this manifest are not in the cached discovery yet
+			if resetter, ok := k.mapper.(meta.ResettableRESTMapper); ok {
+				resetter.Reset()
+				resourceClient, err = k.resourceFor(obj, defaultNamespace)
+			}
+		}
+		if err != nil {
+			result.Action = "failed"
+			result.Reason = "schema"
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Namespace = obj.GetNamespace()
+
+		result.Action, err = applyObject(ctx, resourceClient, obj)
+		if err != nil {
+			result.Action = "failed"
+			result.Reason = ClassifyAPIError(err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// applyObject server-side applies one object, comparing resource versions to
+// tell a no-op apply from one that changed the object
+func applyObject(ctx context.Context, resourceClient dynamic.ResourceInterface, obj *unstructured.Unstructured) (string, error) {
+	existing, err := resourceClient.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		existing = nil
+	} else if err != nil {
+		return "", err
+	}
+
+	applied, err := resourceClient.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: applyFieldManager, Force: true})
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case existing == nil:
+		return "created", nil
+	case existing.GetResourceVersion() == applied.GetResourceVersion():
+		return "unchanged", nil
+	default:
+		return "configured", nil
+	}
+}
+
+func applyRank(kind string) int {
+	if rank, ok := applyOrder[kind]; ok {
+		return rank
+	}
+	return len(applyOrder)
+}
+
+// DryRunManifest submits every object of a multi-document YAML manifest to the
+// API server with server-side dry-run, so schema validation and admission
+// webhooks run without persisting anything
+func (k *KubernetesClient) DryRunManifest(manifest, defaultNamespace string) ([]ManifestObjectResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	objects, err := ParseManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return k.dryRunObjects(ctx, objects, defaultNamespace), nil
+}
+
+// DryRunObjects submits already-built objects with server-side dry-run
+func (k *KubernetesClient) DryRunObjects(objects []*unstructured.Unstructured, defaultNamespace string) []ManifestObjectResult {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	// For now, we'll just validate the manifest can be parsed
-	// In a real implementation, you'd parse the YAML and apply it
+	return k.dryRunObjects(ctx, objects, defaultNamespace)
+}
+
+func (k *KubernetesClient) dryRunObjects(ctx context.Context, objects []*unstructured.Unstructured, defaultNamespace string) []ManifestObjectResult {
+	results := make([]ManifestObjectResult, 0, len(objects))
+	for _, obj := range objects {
+		result := ManifestObjectResult{
+			Kind:      obj.GetKind(),
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+		}
+
+		resourceClient, err := k.resourceFor(obj, defaultNamespace)
+		if err != nil {
+			result.Action = "failed"
+			result.Reason = "schema"
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Namespace = obj.GetNamespace()
+
+		_, err = resourceClient.Create(ctx, obj, metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}})
+		switch {
+		case err == nil:
+			result.Action = "created"
+		case apierrors.IsAlreadyExists(err):
+			result.Action = "configured"
+		default:
+			result.Action = "failed"
+			result.Reason = ClassifyAPIError(err)
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// resourceFor resolves the dynamic resource client for an object, defaulting
+// the namespace of namespaced objects that do not declare one
+func (k *KubernetesClient) resourceFor(obj *unstructured.Unstructured, defaultNamespace string) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := k.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("unknown resource type %s: %w", gvk.String(), err)
+	}
+
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		obj.SetNamespace("")
+		return k.dynamic.Resource(mapping.Resource), nil
+	}
+
+	if obj.GetNamespace() == "" {
+		if defaultNamespace == "" {
+			defaultNamespace = "default"
+		}
+		obj.SetNamespace(defaultNamespace)
+	}
+	return k.dynamic.Resource(mapping.Resource).Namespace(obj.GetNamespace()), nil
+}
+
+// ParseManifest decodes a multi-document YAML or JSON manifest into unstructured objects
+func ParseManifest(manifest string) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(manifest)), 4096)
+
+	var objects []*unstructured.Unstructured
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse list: %w", err)
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetAPIVersion() == "" {
+			return nil, fmt.Errorf("manifest object is missing apiVersion or kind")
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// ClassifyAPIError maps an API server error to a coarse failure reason
+func ClassifyAPIError(err error) string {
+	message := err.Error()
+	switch {
+	case strings.Contains(message, "admission webhook") || strings.Contains(message, "denied the request"):
+		return "admission"
+	case apierrors.IsInvalid(err) || apierrors.IsBadRequest(err):
+		return "schema"
+	case apierrors.IsForbidden(err):
+		return "forbidden"
+	case apierrors.IsConflict(err):
+		return "conflict"
+	default:
+		return "error"
+	}
+}
+
+// AdmissionWebhookInfo describes a validating or mutating webhook registered on the cluster
+type AdmissionWebhookInfo struct {
+	Name          string   `json:"name"`
+	Configuration string   `json:"configuration"`
+	Type          string   `json:"type"`   // validating, mutating
+	Engine        string   `json:"engine"` // gatekeeper, kyverno, custom
+	FailurePolicy string   `json:"failure_policy"`
+	Resources     []string `json:"resources"`
+}
+
+// ListAdmissionWebhooks returns every validating and mutating webhook on the cluster
+func (k *KubernetesClient) ListAdmissionWebhooks() ([]AdmissionWebhookInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var webhooks []AdmissionWebhookInfo
+
+	validating, err := k.clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list validating webhooks: %w", err)
+	}
+	for _, config := range validating.Items {
+		for _, webhook := range config.Webhooks {
+			webhooks = append(webhooks, AdmissionWebhookInfo{
+				Name:          webhook.Name,
+				Configuration: config.Name,
+				Type:          "validating",
+				Engine:        detectWebhookEngine(config.Name, webhook.Name, webhook.ClientConfig),
+				FailurePolicy: failurePolicyString(webhook.FailurePolicy),
+				Resources:     ruleResources(webhook.Rules),
+			})
+		}
+	}
+
+	mutating, err := k.clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mutating webhooks: %w", err)
+	}
+	for _, config := range mutating.Items {
+		for _, webhook := range config.Webhooks {
+			webhooks = append(webhooks, AdmissionWebhookInfo{
+				Name:          webhook.Name,
+				Configuration: config.Name,
+				Type:          "mutating",
+				Engine:        detectWebhookEngine(config.Name, webhook.Name, webhook.ClientConfig),
+				FailurePolicy: failurePolicyString(webhook.FailurePolicy),
+				Resources:     ruleResources(webhook.Rules),
+			})
+		}
+	}
+
+	return webhooks, nil
+}
+
+// detectWebhookEngine identifies well-known policy engines from webhook naming
+func detectWebhookEngine(configName, webhookName string, clientConfig admissionregistrationv1.WebhookClientConfig) string {
+	identifiers := []string{configName, webhookName}
+	if clientConfig.Service != nil {
+		identifiers = append(identifiers, clientConfig.Service.Namespace, clientConfig.Service.Name)
+	}
+
+	joined := strings.ToLower(strings.Join(identifiers, " "))
+	switch {
+	case strings.Contains(joined, "gatekeeper"):
+		return "gatekeeper"
+	case strings.Contains(joined, "kyverno"):
+		return "kyverno"
+	default:
+		return "custom"
+	}
+}
+
+func failurePolicyString(policy *admissionregistrationv1.FailurePolicyType) string {
+	if policy == nil {
+		return string(admissionregistrationv1.Fail)
+	}
+	return string(*policy)
+}
+
+func ruleResources(rules []admissionregistrationv1.RuleWithOperations) []string {
+	var resources []string
+	for _, rule := range rules {
+		resources = append(resources, rule.Resources...)
+	}
+	return resources
+}
+
+// FindService returns the first service matching a label selector, searching all
+// namespaces when namespace is empty
+func (k *KubernetesClient) FindService(namespace, labelSelector string) (*corev1.Service, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	services, err := k.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	if len(services.Items) == 0 {
+		return nil, fmt.Errorf("no service matches %q", labelSelector)
+	}
+
+	return &services.Items[0], nil
+}
+
+// WorkloadSelector returns the pod label selector of the deployment, statefulset
+// or daemonset with the given name, and its kind
+func (k *KubernetesClient) WorkloadSelector(ctx context.Context, namespace, name string) (string, string, error) {
+	if deployment, err := k.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+		selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+		return "Deployment", selectorString(selector, err), err
+	} else if !apierrors.IsNotFound(err) {
+		return "", "", fmt.Errorf("failed to get deployment: %w", err)
+	}
+	if statefulSet, err := k.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+		selector, err := metav1.LabelSelectorAsSelector(statefulSet.Spec.Selector)
+		return "StatefulSet", selectorString(selector, err), err
+	} else if !apierrors.IsNotFound(err) {
+		return "", "", fmt.Errorf("failed to get statefulset: %w", err)
+	}
+	if daemonSet, err := k.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+		selector, err := metav1.LabelSelectorAsSelector(daemonSet.Spec.Selector)
+		return "DaemonSet", selectorString(selector, err), err
+	} else if !apierrors.IsNotFound(err) {
+		return "", "", fmt.Errorf("failed to get daemonset: %w", err)
+	}
+	return "", "", fmt.Errorf("no deployment, statefulset or daemonset named %s in namespace %s", name, namespace)
+}
+
+func selectorString(selector labels.Selector, err error) string {
+	if err != nil {
+		return ""
+	}
+	return selector.String()
+}
+
+// ListPods lists the pods of a namespace matching a label selector
+func (k *KubernetesClient) ListPods(ctx context.Context, namespace, labelSelector string) ([]corev1.Pod, error) {
+	pods, err := k.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	return pods.Items, nil
+}
+
+// ListEvents lists the events of a namespace, oldest first
+func (k *KubernetesClient) ListEvents(ctx context.Context, namespace string) ([]corev1.Event, error) {
+	events, err := k.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	sort.Slice(events.Items, func(i, j int) bool {
+		return EventTime(events.Items[i]).Before(EventTime(events.Items[j]))
+	})
+	return events.Items, nil
+}
+
+// ListResourceQuotas lists the ResourceQuotas of a namespace. A namespace that
+// doesn't exist yet has none.
+func (k *KubernetesClient) ListResourceQuotas(ctx context.Context, namespace string) ([]corev1.ResourceQuota, error) {
+	quotas, err := k.clientset.CoreV1().ResourceQuotas(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource quotas of %s: %w", namespace, err)
+	}
+	return quotas.Items, nil
+}
+
+// ListLimitRanges lists the LimitRanges of a namespace
+func (k *KubernetesClient) ListLimitRanges(ctx context.Context, namespace string) ([]corev1.LimitRange, error) {
+	limitRanges, err := k.clientset.CoreV1().LimitRanges(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list limit ranges of %s: %w", namespace, err)
+	}
+	return limitRanges.Items, nil
+}
+
+// EventTime returns when an event last happened
+func EventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
+
+// GetPodLogs returns the last lines of a container's logs. With previous set it
+// returns the logs of the container's last terminated instance.
+func (k *KubernetesClient) GetPodLogs(ctx context.Context, namespace, pod, container string, tailLines int64, previous bool) (string, error) {
+	request := k.clientset.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &tailLines,
+		Previous:  previous,
+	})
+	logs, err := request.DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs of %s/%s: %w", pod, container, err)
+	}
+	return string(logs), nil
+}
+
+// StreamPodLogs opens a pod's log stream; with options.Follow set it stays open
+// until the context is cancelled or the container stops. The caller closes it.
+func (k *KubernetesClient) StreamPodLogs(ctx context.Context, namespace, pod string, options *corev1.PodLogOptions) (io.ReadCloser, error) {
+	stream, err := k.clientset.CoreV1().Pods(namespace).GetLogs(pod, options).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stream logs of %s/%s: %w", namespace, pod, err)
+	}
+	return stream, nil
+}
+
+// Ping checks that the API server answers
+func (k *KubernetesClient) Ping(ctx context.Context) error {
+	if err := k.clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+		return fmt.Errorf("API server unreachable: %w", err)
+	}
+	return nil
+}
+
+// ListNodes lists the cluster's nodes
+func (k *KubernetesClient) ListNodes(ctx context.Context) ([]corev1.Node, error) {
+	nodes, err := k.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return nodes.Items, nil
+}
+
+// ListStorageClasses lists the cluster's storage classes
+func (k *KubernetesClient) ListStorageClasses(ctx context.Context) ([]storagev1.StorageClass, error) {
+	classes, err := k.clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage classes: %w", err)
+	}
+	return classes.Items, nil
+}
+
+// NamespaceExists reports whether a namespace exists
+func (k *KubernetesClient) NamespaceExists(ctx context.Context, name string) (bool, error) {
+	_, err := k.clientset.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get namespace %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// DeletePersistentVolumeClaims deletes the claims of a namespace matching a
+// label selector and returns their names
+func (k *KubernetesClient) DeletePersistentVolumeClaims(ctx context.Context, namespace, labelSelector string) ([]string, error) {
+	claims, err := k.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims: %w", err)
+	}
+	var deleted []string
+	for _, claim := range claims.Items {
+		err := k.clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, claim.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return deleted, fmt.Errorf("failed to delete persistent volume claim %s: %w", claim.Name, err)
+		}
+		deleted = append(deleted, claim.Name)
+	}
+	return deleted, nil
+}
+
+// DeleteNamespace deletes a namespace and everything in it
+func (k *KubernetesClient) DeleteNamespace(ctx context.Context, name string) error {
+	err := k.clientset.CoreV1().Namespaces().Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// NodePlatforms returns the os/arch pairs of schedulable nodes, e.g. "linux/arm64",
+// with the number of nodes for each
+func (k *KubernetesClient) NodePlatforms() (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	nodes, err := k.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	platforms := make(map[string]int)
+	for _, node := range nodes.Items {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		platforms[node.Status.NodeInfo.OperatingSystem+"/"+node.Status.NodeInfo.Architecture]++
+	}
+	return platforms, nil
+}
+
+// InformerFactory returns a shared informer factory for watching cluster objects
+func (k *KubernetesClient) InformerFactory(resync time.Duration) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactory(k.clientset, resync)
+}
+
+// GetSecretData returns the decoded data of a secret
+func (k *KubernetesClient) GetSecretData(namespace, name string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	secret, err := k.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	data := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	return data, nil
+}
+
+// GetSecret returns a secret, or nil when it doesn't exist
+func (k *KubernetesClient) GetSecret(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+	secret, err := k.clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+	return secret, nil
+}
+
+// SetSecretKey sets one key of a secret, creating the secret and its
+// namespace with the labels when they don't exist
+func (k *KubernetesClient) SetSecretKey(ctx context.Context, namespace, name, key, value string, labels map[string]string) error {
+	secret, err := k.GetSecret(ctx, namespace, name)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		if err := k.EnsureNamespace(ctx, namespace); err != nil {
+			return err
+		}
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{key: []byte(value)},
+		}
+		if _, err := k.clientset.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create secret %s/%s: %w", namespace, name, err)
+		}
+		return nil
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[key] = []byte(value)
+	if _, err := k.clientset.CoreV1().Secrets(namespace).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %w", namespace, name, err)
+	}
 	return nil
 }
 
+// PortForwardService forwards a local port to a running pod backing the service
+// and returns the local port with a function that stops the tunnel
+func (k *KubernetesClient) PortForwardService(ctx context.Context, namespace, name string, port int32) (int, func(), error) {
+	service, err := k.clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get service %s/%s: %w", namespace, name, err)
+	}
+
+	pods, err := k.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String(),
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to list pods for service %s: %w", name, err)
+	}
+
+	var pod *corev1.Pod
+	for i := range pods.Items {
+		if pods.Items[i].Status.Phase == corev1.PodRunning {
+			pod = &pods.Items[i]
+			break
+		}
+	}
+	if pod == nil {
+		return 0, nil, fmt.Errorf("no running pod backs service %s/%s", namespace, name)
+	}
+
+	targetPort := resolveTargetPort(service, pod, port)
+
+	transport, upgrader, err := spdy.RoundTripperFor(k.config)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create port-forward transport: %w", err)
+	}
+
+	url := k.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod.Name).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stopCh := make(chan struct{})
+	readyCh := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", targetPort)}, stopCh, readyCh, io.Discard, io.Discard)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create port forwarder: %w", err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- forwarder.ForwardPorts()
+	}()
+
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		return 0, nil, fmt.Errorf("port forward failed: %w", err)
+	case <-ctx.Done():
+		close(stopCh)
+		return 0, nil, ctx.Err()
+	}
+
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		close(stopCh)
+		return 0, nil, fmt.Errorf("failed to determine forwarded port: %v", err)
+	}
+
+	return int(ports[0].Local), func() { close(stopCh) }, nil
+}
+
+// resolveTargetPort maps a service port to the container port of the backing pod
+func resolveTargetPort(service *corev1.Service, pod *corev1.Pod, port int32) int32 {
+	for _, servicePort := range service.Spec.Ports {
+		if servicePort.Port != port {
+			continue
+		}
+		if servicePort.TargetPort.Type == intstr.Int && servicePort.TargetPort.IntVal > 0 {
+			return servicePort.TargetPort.IntVal
+		}
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == servicePort.TargetPort.StrVal {
+					return containerPort.ContainerPort
+				}
+			}
+		}
+	}
+	return port
+}
+
 func ParseKubeconfig(kubeconfig string) (*api.Config, error) {
 	if kubeconfig == "" {
 		return nil, fmt.Errorf("kubeconfig is empty")
@@ -167,27 +918,132 @@ func ValidateKubeconfigFormat(kubeconfig string) error {
 	return err
 }
 
-func ExtractClusterInfo(kubeconfig string) (string, error) {
+// KubeconfigContext is a context of a kubeconfig: the cluster, API server,
+// user and default namespace it selects
+type KubeconfigContext struct {
+	Name      string `json:"name"`
+	Cluster   string `json:"cluster"`
+	Server    string `json:"server,omitempty"`
+	User      string `json:"user,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// DefaultName is the name suggested for a cluster added for the context
+	DefaultName string `json:"-"`
+}
+
+// KubeconfigInfo describes a kubeconfig: its current context, the cluster and
+// API server that context selects, and every context it has
+type KubeconfigInfo struct {
+	CurrentContext string `json:"current_context"`
+	ClusterName    string `json:"cluster_name"`
+	Server         string `json:"server"`
+	// Host is the API server's host name, without scheme or port
+	Host      string `json:"host"`
+	Namespace string `json:"namespace,omitempty"`
+	// DefaultName is the name suggested for a cluster added with the kubeconfig
+	DefaultName string              `json:"default_name"`
+	Contexts    []KubeconfigContext `json:"contexts"`
+}
+
+// ExtractClusterInfo describes a kubeconfig and suggests a name for its
+// current context's cluster
+func ExtractClusterInfo(kubeconfig string) (*KubeconfigInfo, error) {
 	config, err := ParseKubeconfig(kubeconfig)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Get current context
-	currentContext := config.CurrentContext
-	if currentContext == "" {
-		return "", fmt.Errorf("no current context found")
+	info := &KubeconfigInfo{CurrentContext: config.CurrentContext, Contexts: []KubeconfigContext{}}
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	for _, name := range names {
+		context := config.Contexts[name]
+		entry := KubeconfigContext{Name: name, Cluster: context.Cluster, User: context.AuthInfo, Namespace: context.Namespace}
+		if cluster := config.Clusters[context.Cluster]; cluster != nil {
+			entry.Server = cluster.Server
+		}
+		entry.DefaultName = defaultClusterName(name, entry.Cluster, serverHost(entry.Server))
+		info.Contexts = append(info.Contexts, entry)
+		if name == config.CurrentContext {
+			info.ClusterName, info.Server, info.Namespace = entry.Cluster, entry.Server, entry.Namespace
+		}
+	}
+	info.Host = serverHost(info.Server)
+	info.DefaultName = defaultClusterName(info.CurrentContext, info.ClusterName, info.Host)
+	return info, nil
+}
 
-	context := config.Contexts[currentContext]
-	if context == nil {
-		return "", fmt.Errorf("current context not found")
+// serverHost returns the host name of an API server URL
+func serverHost(server string) string {
+	parsed, err := url.Parse(server)
+	if err != nil {
+		return ""
 	}
+	return parsed.Hostname()
+}
 
-	cluster := config.Clusters[context.Cluster]
-	if cluster == nil {
-		return "", fmt.Errorf("cluster not found")
+// genericClusterNames are cluster names kubeconfigs commonly use that don't
+// tell clusters apart
+var genericClusterNames = map[string]bool{"": true, "default": true, "kubernetes": true, "cluster": true, "local": true}
+
+// defaultClusterName derives a readable cluster name from a kubeconfig's
+// cluster or context name: the cluster of an EKS ARN, the last part of a GKE
+// name or the cluster of a user@cluster context, else the API server's host
+// when both are generic
+func defaultClusterName(contextName, clusterName, host string) string {
+	for _, name := range []string{clusterName, contextName} {
+		switch {
+		case strings.HasPrefix(name, "arn:") && strings.Contains(name, "/"):
+			// arn:aws:eks:<region>:<account>:cluster/<name>
+			name = name[strings.LastIndex(name, "/")+1:]
+		case strings.HasPrefix(name, "gke_") && strings.Count(name, "_") >= 3:
+			// gke_<project>_<location>_<name>
+			name = strings.SplitN(name, "_", 4)[3]
+		case strings.Contains(name, "@"):
+			// <user>@<cluster>, as kubeadm names contexts
+			name = name[strings.LastIndex(name, "@")+1:]
+		}
+		if !genericClusterNames[strings.ToLower(name)] {
+			return name
+		}
 	}
+	if host != "" {
+		return host
+	}
+	return contextName
+}
+
+// NewKubernetesClientForContext connects through a context of the kubeconfig
+// other than its current one. An empty context uses the current one.
+func NewKubernetesClientForContext(kubeconfig, contextName string) (*KubernetesClient, error) {
+	if contextName != "" {
+		switched, err := UseContext(kubeconfig, contextName)
+		if err != nil {
+			return nil, err
+		}
+		kubeconfig = switched
+	}
+	return NewKubernetesClient(kubeconfig)
+}
 
-	return cluster.Server, nil
+// UseContext returns the kubeconfig with another of its contexts current
+func UseContext(kubeconfig, contextName string) (string, error) {
+	config, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	if _, ok := config.Contexts[contextName]; !ok {
+		return "", fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	config.CurrentContext = contextName
+	encoded, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	if _, err := ParseKubeconfig(string(encoded)); err != nil {
+		return "", err
+	}
+	return string(encoded), nil
 }
@@ -0,0 +1,151 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/yaml"
+)
+
+// connectorName names the connector's objects
+const connectorName = "grafana-ai-agent-connector"
+
+// ConnectorManifestOptions describe the connector a manifest installs
+type ConnectorManifestOptions struct {
+	Namespace string
+	// ServerURL is the platform URL the connector dials out to
+	ServerURL string
+	Token     string
+	Image     string
+	// ClusterRole is bound to the connector's ServiceAccount, and limits what
+	// the platform may do in the cluster
+	ClusterRole string
+}
+
+// ConnectorManifest returns the manifest installing a connector: a
+// ServiceAccount bound to the cluster role, a Secret with its token and a
+// Deployment running it. Apply it with kubectl apply -f.
+func ConnectorManifest(options ConnectorManifestOptions) (string, error) {
+	labels := map[string]string{"app.kubernetes.io/name": connectorName}
+	meta := metav1.ObjectMeta{Name: connectorName, Namespace: options.Namespace, Labels: labels}
+	replicas := int32(1)
+	allowPrivilegeEscalation := false
+
+	objects := []runtime.Object{
+		&corev1.Namespace{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Namespace"},
+			ObjectMeta: metav1.ObjectMeta{Name: options.Namespace},
+		},
+		&corev1.ServiceAccount{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+			ObjectMeta: meta,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: connectorName, Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: "rbac.authorization.k8s.io", Kind: "ClusterRole", Name: options.ClusterRole},
+			Subjects:   []rbacv1.Subject{{Kind: "ServiceAccount", Name: connectorName, Namespace: options.Namespace}},
+		},
+		&corev1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: meta,
+			StringData: map[string]string{
+				"CONNECTOR_SERVER_URL": strings.TrimRight(options.ServerURL, "/"),
+				"CONNECTOR_TOKEN":      options.Token,
+			},
+		},
+		&appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: meta,
+			Spec: appsv1.DeploymentSpec{
+				// A single connector; the platform keeps one tunnel per cluster
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: labels},
+				Strategy: appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: labels},
+					Spec: corev1.PodSpec{
+						ServiceAccountName: connectorName,
+						Containers: []corev1.Container{{
+							Name:    "connector",
+							Image:   options.Image,
+							Command: []string{"./main", "connector"},
+							EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: connectorName}}}},
+							Resources: corev1.ResourceRequirements{
+								Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("10m"), corev1.ResourceMemory: resource.MustParse("32Mi")},
+								Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+							},
+							SecurityContext: &corev1.SecurityContext{
+								AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+							},
+						}},
+					},
+				},
+			},
+		},
+	}
+
+	documents := make([]string, 0, len(objects))
+	for _, object := range objects {
+		encoded, err := yaml.Marshal(object)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode connector manifest: %w", err)
+		}
+		documents = append(documents, strings.TrimSpace(string(encoded)))
+	}
+	return strings.Join(documents, "\n---\n") + "\n", nil
+}
+
+// ConnectorProxyPlaceholder is the proxy URL of stored connector kubeconfigs.
+// Each replica serves its own proxy, with its own certificate, so the stored
+// kubeconfig names none and is resolved with ResolveConnectorKubeconfig when
+// a replica loads it.
+const ConnectorProxyPlaceholder = "https://connector-proxy"
+
+// ConnectorKubeconfig returns the kubeconfig of a connector cluster, which
+// points at the platform's loopback proxy of the connector's tunnel
+func ConnectorKubeconfig(proxyURL string, caPEM []byte, clusterID uint, token string) (string, error) {
+	config := api.NewConfig()
+	config.Clusters["connector"] = &api.Cluster{
+		Server:                   fmt.Sprintf("%s/clusters/%d", proxyURL, clusterID),
+		CertificateAuthorityData: caPEM,
+	}
+	config.AuthInfos["connector"] = &api.AuthInfo{Token: token}
+	config.Contexts["connector"] = &api.Context{Cluster: "connector", AuthInfo: "connector"}
+	config.CurrentContext = "connector"
+	encoded, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// ResolveConnectorKubeconfig points a stored connector kubeconfig at a
+// replica's loopback proxy, whatever proxy it named before
+func ResolveConnectorKubeconfig(stored, proxyURL string, caPEM []byte) (string, error) {
+	config, err := clientcmd.Load([]byte(stored))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse connector kubeconfig: %w", err)
+	}
+	for _, cluster := range config.Clusters {
+		path := cluster.Server
+		if i := strings.Index(path, "/clusters/"); i >= 0 {
+			path = path[i:]
+		}
+		cluster.Server = proxyURL + path
+		cluster.CertificateAuthorityData = caPEM
+	}
+	encoded, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	return string(encoded), nil
+}
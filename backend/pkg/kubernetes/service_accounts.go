@@ -0,0 +1,203 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+// managedByLabel marks objects the platform creates and removes on its own
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+const managedByValue = "grafana-ai-agent-platform"
+
+// AccessScope lists the permissions of a scoped ServiceAccount
+type AccessScope struct {
+	// Namespaces maps each namespace to the rules granted in it
+	Namespaces map[string][]rbacv1.PolicyRule
+	// ClusterRules are granted cluster-wide, for cluster-scoped resources
+	ClusterRules []rbacv1.PolicyRule
+}
+
+// ScopedServiceAccount is an ephemeral ServiceAccount bound to an AccessScope,
+// with a kubeconfig holding a short-lived token for it
+type ScopedServiceAccount struct {
+	Name       string
+	Namespace  string
+	Kubeconfig string
+	ExpiresAt  time.Time
+
+	client       *KubernetesClient
+	namespaces   []string
+	clusterScope bool
+}
+
+// CreateScopedServiceAccount creates a ServiceAccount with a Role and RoleBinding
+// in every namespace of the scope, plus a ClusterRole and ClusterRoleBinding for
+// its cluster rules, and mints a token valid for ttl. Namespaces of the scope are
+// created if missing. Everything created so far is removed when a step fails.
+func (k *KubernetesClient) CreateScopedServiceAccount(ctx context.Context, name, namespace string, scope AccessScope, ttl time.Duration) (*ScopedServiceAccount, error) {
+	account := &ScopedServiceAccount{Name: name, Namespace: namespace, client: k}
+	labels := map[string]string{managedByLabel: managedByValue}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: namespace}}
+
+	fail := func(err error) (*ScopedServiceAccount, error) {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if cleanupErr := account.Delete(cleanupCtx); cleanupErr != nil {
+			err = fmt.Errorf("%w (cleanup also failed: %v)", err, cleanupErr)
+		}
+		return nil, err
+	}
+
+	serviceAccount := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}}
+	if _, err := k.clientset.CoreV1().ServiceAccounts(namespace).Create(ctx, serviceAccount, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create service account %s/%s: %w", namespace, name, err)
+	}
+
+	namespaces := make([]string, 0, len(scope.Namespaces))
+	for ns := range scope.Namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		if err := k.EnsureNamespace(ctx, ns); err != nil {
+			return fail(err)
+		}
+		account.namespaces = append(account.namespaces, ns)
+
+		role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: labels}, Rules: scope.Namespaces[ns]}
+		if _, err := k.clientset.RbacV1().Roles(ns).Create(ctx, role, metav1.CreateOptions{}); err != nil {
+			return fail(fmt.Errorf("failed to create role %s/%s: %w", ns, name, err))
+		}
+		binding := &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects:   subjects,
+		}
+		if _, err := k.clientset.RbacV1().RoleBindings(ns).Create(ctx, binding, metav1.CreateOptions{}); err != nil {
+			return fail(fmt.Errorf("failed to create role binding %s/%s: %w", ns, name, err))
+		}
+	}
+
+	if len(scope.ClusterRules) > 0 {
+		account.clusterScope = true
+		clusterRole := &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}, Rules: scope.ClusterRules}
+		if _, err := k.clientset.RbacV1().ClusterRoles().Create(ctx, clusterRole, metav1.CreateOptions{}); err != nil {
+			return fail(fmt.Errorf("failed to create cluster role %s: %w", name, err))
+		}
+		binding := &rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name},
+			Subjects:   subjects,
+		}
+		if _, err := k.clientset.RbacV1().ClusterRoleBindings().Create(ctx, binding, metav1.CreateOptions{}); err != nil {
+			return fail(fmt.Errorf("failed to create cluster role binding %s: %w", name, err))
+		}
+	}
+
+	seconds := int64(ttl.Seconds())
+	token, err := k.clientset.CoreV1().ServiceAccounts(namespace).CreateToken(ctx, name, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{ExpirationSeconds: &seconds},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return fail(fmt.Errorf("failed to create token for %s/%s: %w", namespace, name, err))
+	}
+	account.ExpiresAt = token.Status.ExpirationTimestamp.Time
+
+	kubeconfig, err := k.tokenKubeconfig(name, token.Status.Token)
+	if err != nil {
+		return fail(err)
+	}
+	account.Kubeconfig = kubeconfig
+	return account, nil
+}
+
+// Delete removes the ServiceAccount and its roles and bindings, which also
+// invalidates its token. Objects that are already gone are skipped.
+func (a *ScopedServiceAccount) Delete(ctx context.Context) error {
+	rbac := a.client.clientset.RbacV1()
+	var errs []error
+	collect := func(err error) {
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	if a.clusterScope {
+		collect(rbac.ClusterRoleBindings().Delete(ctx, a.Name, metav1.DeleteOptions{}))
+		collect(rbac.ClusterRoles().Delete(ctx, a.Name, metav1.DeleteOptions{}))
+	}
+	for _, ns := range a.namespaces {
+		collect(rbac.RoleBindings(ns).Delete(ctx, a.Name, metav1.DeleteOptions{}))
+		collect(rbac.Roles(ns).Delete(ctx, a.Name, metav1.DeleteOptions{}))
+	}
+	collect(a.client.clientset.CoreV1().ServiceAccounts(a.Namespace).Delete(ctx, a.Name, metav1.DeleteOptions{}))
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("failed to delete service account %s/%s: %w", a.Namespace, a.Name, err)
+	}
+	return nil
+}
+
+// tokenKubeconfig builds a kubeconfig for the client's cluster that
+// authenticates with a bearer token
+func (k *KubernetesClient) tokenKubeconfig(user, token string) (string, error) {
+	caData := k.config.CAData
+	if len(caData) == 0 && k.config.CAFile != "" {
+		data, err := os.ReadFile(k.config.CAFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read cluster CA: %w", err)
+		}
+		caData = data
+	}
+
+	config := api.NewConfig()
+	config.Clusters["cluster"] = &api.Cluster{
+		Server:                   k.config.Host,
+		CertificateAuthorityData: caData,
+		InsecureSkipTLSVerify:    k.config.Insecure,
+		TLSServerName:            k.config.ServerName,
+	}
+	config.AuthInfos[user] = &api.AuthInfo{Token: token}
+	config.Contexts["default"] = &api.Context{Cluster: "cluster", AuthInfo: user}
+	config.CurrentContext = "default"
+
+	encoded, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode kubeconfig: %w", err)
+	}
+	return string(encoded), nil
+}
+
+// EnsureNamespace creates a namespace unless it exists
+func (k *KubernetesClient) EnsureNamespace(ctx context.Context, name string) error {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if _, err := k.clientset.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create namespace %s: %w", name, err)
+	}
+	return nil
+}
+
+// ResourceMapping resolves the resource name of a kind and whether it is namespaced
+func (k *KubernetesClient) ResourceMapping(gvk schema.GroupVersionKind) (string, bool, error) {
+	mapping, err := k.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return "", false, fmt.Errorf("unknown resource type %s: %w", gvk.String(), err)
+	}
+	return mapping.Resource.Resource, mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
@@ -0,0 +1,204 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// SimulatedAccessReason is the reason simulated clusters give for allowing
+// every access review
+const SimulatedAccessReason = "simulated: the kubeconfig's permissions are not recorded"
+
+// ServedKind is a kind a simulated cluster serves besides the built-in kinds,
+// e.g. one of its CRDs
+type ServedKind struct {
+	GroupVersionKind schema.GroupVersionKind
+	Plural           string
+	Namespaced       bool
+}
+
+// clusterScopedKinds are the built-in kinds that aren't namespaced
+var clusterScopedKinds = map[string]bool{
+	"APIService":                       true,
+	"CertificateSigningRequest":        true,
+	"ClusterRole":                      true,
+	"ClusterRoleBinding":               true,
+	"ClusterTrustBundle":               true,
+	"ComponentStatus":                  true,
+	"CSIDriver":                        true,
+	"CSINode":                          true,
+	"CustomResourceDefinition":         true,
+	"FlowSchema":                       true,
+	"IngressClass":                     true,
+	"MutatingWebhookConfiguration":     true,
+	"Namespace":                        true,
+	"Node":                             true,
+	"PersistentVolume":                 true,
+	"PriorityClass":                    true,
+	"PriorityLevelConfiguration":       true,
+	"RuntimeClass":                     true,
+	"SelfSubjectAccessReview":          true,
+	"SelfSubjectReview":                true,
+	"SelfSubjectRulesReview":           true,
+	"StorageClass":                     true,
+	"SubjectAccessReview":              true,
+	"TokenReview":                      true,
+	"ValidatingAdmissionPolicy":        true,
+	"ValidatingAdmissionPolicyBinding": true,
+	"ValidatingWebhookConfiguration":   true,
+	"VolumeAttachment":                 true,
+}
+
+// NewSimulatedClient returns a client of an in-memory cluster holding objects
+// and serving the built-in kinds and kinds. Nothing it does reaches a real
+// cluster: applied objects are kept in memory, and every access review is
+// allowed since a kubeconfig's permissions can't be known offline.
+func NewSimulatedClient(kinds []ServedKind, objects ...runtime.Object) *KubernetesClient {
+	dynamicObjects := make([]runtime.Object, len(objects))
+	for i, obj := range objects {
+		dynamicObjects[i] = obj.DeepCopyObject()
+	}
+
+	clientset := fake.NewSimpleClientset(objects...)
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview).DeepCopy()
+		review.Status = authorizationv1.SubjectAccessReviewStatus{Allowed: true, Reason: SimulatedAccessReason}
+		return true, review, nil
+	})
+
+	mapper := simulatedRESTMapper(kinds)
+	dynamicClient := dynamicfake.NewSimpleDynamicClient(scheme.Scheme, dynamicObjects...)
+	dynamicClient.PrependReactor("patch", "*", simulatedApply(dynamicClient.Tracker(), mapper))
+
+	return &KubernetesClient{
+		clientset: clientset,
+		dynamic:   dynamicClient,
+		mapper:    mapper,
+		config:    &rest.Config{Host: "simulated"},
+	}
+}
+
+// simulatedApply stores server-side applied objects, creating the missing
+// ones, which the fake's own patch handling can't. Each write gets a new
+// resource version so applies report the objects as created or configured.
+// Applied CRDs make the mapper serve their kinds.
+func simulatedApply(tracker k8stesting.ObjectTracker, mapper *meta.DefaultRESTMapper) k8stesting.ReactionFunc {
+	revision := 0
+	return func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch, ok := action.(k8stesting.PatchAction)
+		if !ok || patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(patch.GetPatch()); err != nil {
+			return true, nil, apierrors.NewBadRequest(err.Error())
+		}
+		revision++
+		obj.SetResourceVersion(strconv.Itoa(revision))
+
+		resource, namespace := patch.GetResource(), patch.GetNamespace()
+		_, err := tracker.Get(resource, namespace, patch.GetName())
+		switch {
+		case apierrors.IsNotFound(err):
+			err = tracker.Create(resource, obj, namespace)
+		case err == nil:
+			err = tracker.Update(resource, obj, namespace)
+		}
+		if err != nil {
+			return true, nil, err
+		}
+		if resource.GroupResource() == crdResource {
+			for _, kind := range crdKinds(obj) {
+				addServedKind(mapper, kind)
+			}
+		}
+		return true, obj, nil
+	}
+}
+
+var crdResource = schema.GroupResource{Group: "apiextensions.k8s.io", Resource: "customresourcedefinitions"}
+
+// crdKinds are the kinds the served versions of a CRD define
+func crdKinds(crd *unstructured.Unstructured) []ServedKind {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+
+	var kinds []ServedKind
+	for _, item := range versions {
+		version, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(version, "name")
+		if served, _, _ := unstructured.NestedBool(version, "served"); !served || name == "" {
+			continue
+		}
+		kinds = append(kinds, ServedKind{
+			GroupVersionKind: schema.GroupVersionKind{Group: group, Version: name, Kind: kind},
+			Plural:           plural,
+			Namespaced:       scope != "Cluster",
+		})
+	}
+	return kinds
+}
+
+// simulatedRESTMapper maps the kinds client-go knows and the served kinds to
+// their resources
+func simulatedRESTMapper(kinds []ServedKind) *meta.DefaultRESTMapper {
+	metaPackage := reflect.TypeOf(metav1.Status{}).PkgPath()
+	mapper := meta.NewDefaultRESTMapper(nil)
+	add := func(gvk schema.GroupVersionKind) {
+		scope := meta.RESTScopeNamespace
+		if clusterScopedKinds[gvk.Kind] {
+			scope = meta.RESTScopeRoot
+		}
+		mapper.Add(gvk, scope)
+	}
+	for gvk, goType := range scheme.Scheme.AllKnownTypes() {
+		// Skip lists and the options every group version registers
+		if gvk.Version == runtime.APIVersionInternal || strings.HasSuffix(gvk.Kind, "List") || goType.PkgPath() == metaPackage {
+			continue
+		}
+		add(gvk)
+	}
+	add(schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1", Kind: "CustomResourceDefinition"})
+	add(schema.GroupVersionKind{Group: "apiregistration.k8s.io", Version: "v1", Kind: "APIService"})
+
+	for _, kind := range kinds {
+		addServedKind(mapper, kind)
+	}
+	return mapper
+}
+
+// addServedKind maps a served kind to its resource
+func addServedKind(mapper *meta.DefaultRESTMapper, kind ServedKind) {
+	scope := meta.RESTScopeRoot
+	if kind.Namespaced {
+		scope = meta.RESTScopeNamespace
+	}
+	gvk := kind.GroupVersionKind
+	plural := gvk.GroupVersion().WithResource(kind.Plural)
+	if kind.Plural == "" {
+		plural, _ = meta.UnsafeGuessKindToResource(gvk)
+	}
+	singular := gvk.GroupVersion().WithResource(strings.ToLower(gvk.Kind))
+	mapper.AddSpecific(gvk, plural, singular, scope)
+}
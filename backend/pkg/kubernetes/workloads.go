@@ -0,0 +1,488 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Workload kinds the restart and scale actions work on
+const (
+	KindDeployment  = "Deployment"
+	KindStatefulSet = "StatefulSet"
+	KindDaemonSet   = "DaemonSet"
+)
+
+// restartedAtAnnotation is the pod template annotation kubectl rollout restart
+// sets, whose change rolls the pods
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// NamespaceSummary describes a namespace of the namespace browser
+type NamespaceSummary struct {
+	Name      string            `json:"name"`
+	Status    string            `json:"status"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// NamespaceWorkloads lists the workloads of a namespace and what exposes and
+// stores their data
+type NamespaceWorkloads struct {
+	Namespace              string                         `json:"namespace"`
+	Deployments            []DeploymentSummary            `json:"deployments"`
+	StatefulSets           []StatefulSetSummary           `json:"statefulsets"`
+	Services               []ServiceSummary               `json:"services"`
+	Ingresses              []IngressSummary               `json:"ingresses"`
+	PersistentVolumeClaims []PersistentVolumeClaimSummary `json:"persistent_volume_claims"`
+}
+
+// DeploymentSummary is the rollout state of a Deployment
+type DeploymentSummary struct {
+	Name              string    `json:"name"`
+	Replicas          int32     `json:"replicas"`
+	ReadyReplicas     int32     `json:"ready_replicas"`
+	UpdatedReplicas   int32     `json:"updated_replicas"`
+	AvailableReplicas int32     `json:"available_replicas"`
+	Images            []string  `json:"images"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// StatefulSetSummary is the rollout state of a StatefulSet
+type StatefulSetSummary struct {
+	Name            string    `json:"name"`
+	Replicas        int32     `json:"replicas"`
+	ReadyReplicas   int32     `json:"ready_replicas"`
+	UpdatedReplicas int32     `json:"updated_replicas"`
+	ServiceName     string    `json:"service_name,omitempty"`
+	Images          []string  `json:"images"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ServiceSummary describes how a Service is reached
+type ServiceSummary struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	ClusterIP string `json:"cluster_ip,omitempty"`
+	// ExternalAddresses are the load balancer's and the external IPs
+	ExternalAddresses []string `json:"external_addresses,omitempty"`
+	// Ports are written like 80:8080/TCP, port:target port/protocol
+	Ports     []string          `json:"ports"`
+	Selector  map[string]string `json:"selector,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// IngressSummary describes the hosts an Ingress routes
+type IngressSummary struct {
+	Name      string    `json:"name"`
+	ClassName string    `json:"class_name,omitempty"`
+	Hosts     []string  `json:"hosts"`
+	Addresses []string  `json:"addresses,omitempty"`
+	TLS       bool      `json:"tls"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PersistentVolumeClaimSummary describes a claim and the volume bound to it
+type PersistentVolumeClaimSummary struct {
+	Name         string    `json:"name"`
+	Status       string    `json:"status"`
+	Capacity     string    `json:"capacity,omitempty"`
+	Requested    string    `json:"requested,omitempty"`
+	StorageClass string    `json:"storage_class,omitempty"`
+	AccessModes  []string  `json:"access_modes"`
+	VolumeName   string    `json:"volume_name,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ListNamespaces lists the cluster's namespaces by name
+func (k *KubernetesClient) ListNamespaces(ctx context.Context) ([]NamespaceSummary, error) {
+	namespaces, err := k.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list namespaces: %w", err)
+	}
+
+	summaries := make([]NamespaceSummary, 0, len(namespaces.Items))
+	for _, namespace := range namespaces.Items {
+		summaries = append(summaries, NamespaceSummary{
+			Name:      namespace.Name,
+			Status:    string(namespace.Status.Phase),
+			Labels:    namespace.Labels,
+			CreatedAt: namespace.CreationTimestamp.Time,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries, nil
+}
+
+// ListNamespaceWorkloads lists the Deployments, StatefulSets, Services,
+// Ingresses and PersistentVolumeClaims of a namespace, each by name
+func (k *KubernetesClient) ListNamespaceWorkloads(ctx context.Context, namespace string) (*NamespaceWorkloads, error) {
+	workloads := &NamespaceWorkloads{Namespace: namespace}
+
+	deployments, err := k.clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments of %s: %w", namespace, err)
+	}
+	workloads.Deployments = make([]DeploymentSummary, 0, len(deployments.Items))
+	for _, deployment := range deployments.Items {
+		workloads.Deployments = append(workloads.Deployments, summarizeDeployment(deployment))
+	}
+
+	statefulSets, err := k.clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets of %s: %w", namespace, err)
+	}
+	workloads.StatefulSets = make([]StatefulSetSummary, 0, len(statefulSets.Items))
+	for _, statefulSet := range statefulSets.Items {
+		workloads.StatefulSets = append(workloads.StatefulSets, summarizeStatefulSet(statefulSet))
+	}
+
+	services, err := k.clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services of %s: %w", namespace, err)
+	}
+	workloads.Services = make([]ServiceSummary, 0, len(services.Items))
+	for _, service := range services.Items {
+		workloads.Services = append(workloads.Services, summarizeService(service))
+	}
+
+	ingresses, err := k.clientset.NetworkingV1().Ingresses(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses of %s: %w", namespace, err)
+	}
+	workloads.Ingresses = make([]IngressSummary, 0, len(ingresses.Items))
+	for _, ingress := range ingresses.Items {
+		workloads.Ingresses = append(workloads.Ingresses, summarizeIngress(ingress))
+	}
+
+	claims, err := k.clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volume claims of %s: %w", namespace, err)
+	}
+	workloads.PersistentVolumeClaims = make([]PersistentVolumeClaimSummary, 0, len(claims.Items))
+	for _, claim := range claims.Items {
+		workloads.PersistentVolumeClaims = append(workloads.PersistentVolumeClaims, summarizeClaim(claim))
+	}
+
+	sort.Slice(workloads.Deployments, func(i, j int) bool { return workloads.Deployments[i].Name < workloads.Deployments[j].Name })
+	sort.Slice(workloads.StatefulSets, func(i, j int) bool { return workloads.StatefulSets[i].Name < workloads.StatefulSets[j].Name })
+	sort.Slice(workloads.Services, func(i, j int) bool { return workloads.Services[i].Name < workloads.Services[j].Name })
+	sort.Slice(workloads.Ingresses, func(i, j int) bool { return workloads.Ingresses[i].Name < workloads.Ingresses[j].Name })
+	sort.Slice(workloads.PersistentVolumeClaims, func(i, j int) bool {
+		return workloads.PersistentVolumeClaims[i].Name < workloads.PersistentVolumeClaims[j].Name
+	})
+	return workloads, nil
+}
+
+// ParseWorkloadKind returns the kind named by a deployment, statefulset or
+// daemonset path segment, singular or plural and in any case
+func ParseWorkloadKind(kind string) (string, error) {
+	switch strings.TrimSuffix(strings.ToLower(kind), "s") {
+	case "deployment":
+		return KindDeployment, nil
+	case "statefulset":
+		return KindStatefulSet, nil
+	case "daemonset":
+		return KindDaemonSet, nil
+	}
+	return "", fmt.Errorf("unsupported workload kind %q, use deployment, statefulset or daemonset", kind)
+}
+
+// RestartWorkload rolls the pods of a workload the way kubectl rollout restart
+// does, and returns the restart time it recorded
+func (k *KubernetesClient) RestartWorkload(ctx context.Context, kind, namespace, name string) (time.Time, error) {
+	restartedAt := time.Now().UTC()
+	patch := []byte(fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, restartedAt.Format(time.RFC3339)))
+
+	var err error
+	switch kind {
+	case KindDeployment:
+		_, err = k.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case KindStatefulSet:
+		_, err = k.clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case KindDaemonSet:
+		_, err = k.clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	default:
+		return time.Time{}, fmt.Errorf("cannot restart a %s", kind)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to restart %s %s/%s: %w", kind, namespace, name, err)
+	}
+	return restartedAt, nil
+}
+
+// ScaleWorkload sets the replicas of a deployment or statefulset through its
+// scale subresource and returns the replicas it had before
+func (k *KubernetesClient) ScaleWorkload(ctx context.Context, kind, namespace, name string, replicas int32) (int32, error) {
+	var (
+		scale *autoscalingv1.Scale
+		err   error
+	)
+	switch kind {
+	case KindDeployment:
+		scale, err = k.clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+	case KindStatefulSet:
+		scale, err = k.clientset.AppsV1().StatefulSets(namespace).GetScale(ctx, name, metav1.GetOptions{})
+	default:
+		return 0, fmt.Errorf("cannot scale a %s", kind)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get scale of %s %s/%s: %w", kind, namespace, name, err)
+	}
+
+	previous := scale.Spec.Replicas
+	scale.Spec.Replicas = replicas
+	if kind == KindDeployment {
+		_, err = k.clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+	} else {
+		_, err = k.clientset.AppsV1().StatefulSets(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return previous, fmt.Errorf("failed to scale %s %s/%s: %w", kind, namespace, name, err)
+	}
+	return previous, nil
+}
+
+// PodWorkload returns the kind and name of the deployment, statefulset or
+// daemonset running a pod, following a ReplicaSet to its Deployment
+func (k *KubernetesClient) PodWorkload(ctx context.Context, namespace, name string) (*corev1.Pod, string, string, error) {
+	pod, err := k.clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to get pod %s/%s: %w", namespace, name, err)
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return pod, "", "", fmt.Errorf("pod %s/%s is not managed by a workload", namespace, name)
+	}
+	switch owner.Kind {
+	case KindStatefulSet, KindDaemonSet:
+		return pod, owner.Kind, owner.Name, nil
+	case "ReplicaSet":
+		replicaSet, err := k.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return pod, "", "", fmt.Errorf("failed to get replicaset %s/%s: %w", namespace, owner.Name, err)
+		}
+		if deployment := metav1.GetControllerOf(replicaSet); deployment != nil && deployment.Kind == KindDeployment {
+			return pod, KindDeployment, deployment.Name, nil
+		}
+	}
+	return pod, "", "", fmt.Errorf("pod %s/%s is managed by %s %s, not a deployment, statefulset or daemonset", namespace, name, owner.Kind, owner.Name)
+}
+
+// SetContainerLimits sets resource limits of a container in a workload's pod
+// template, which rolls its pods, and returns the limits it had before
+func (k *KubernetesClient) SetContainerLimits(ctx context.Context, kind, namespace, name, container string, limits corev1.ResourceList) (corev1.ResourceList, error) {
+	var (
+		template *corev1.PodTemplateSpec
+		err      error
+	)
+	switch kind {
+	case KindDeployment:
+		var deployment *appsv1.Deployment
+		if deployment, err = k.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template = &deployment.Spec.Template
+		}
+	case KindStatefulSet:
+		var statefulSet *appsv1.StatefulSet
+		if statefulSet, err = k.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template = &statefulSet.Spec.Template
+		}
+	case KindDaemonSet:
+		var daemonSet *appsv1.DaemonSet
+		if daemonSet, err = k.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template = &daemonSet.Spec.Template
+		}
+	default:
+		return nil, fmt.Errorf("cannot set limits of a %s", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s/%s: %w", kind, namespace, name, err)
+	}
+
+	// Init containers are patched through their own list
+	field, previous := "", corev1.ResourceList(nil)
+	for _, list := range []struct {
+		field      string
+		containers []corev1.Container
+	}{{"containers", template.Spec.Containers}, {"initContainers", template.Spec.InitContainers}} {
+		for _, c := range list.containers {
+			if c.Name == container {
+				field, previous = list.field, c.Resources.Limits.DeepCopy()
+			}
+		}
+	}
+	if field == "" {
+		return nil, fmt.Errorf("%s %s/%s has no container %s", kind, namespace, name, container)
+	}
+
+	encoded := make(map[string]string, len(limits))
+	for resource, quantity := range limits {
+		encoded[string(resource)] = quantity.String()
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					field: []interface{}{map[string]interface{}{
+						"name":      container,
+						"resources": map[string]interface{}{"limits": encoded},
+					}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return previous, fmt.Errorf("failed to encode limits: %w", err)
+	}
+
+	switch kind {
+	case KindDeployment:
+		_, err = k.clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case KindStatefulSet:
+		_, err = k.clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	case KindDaemonSet:
+		_, err = k.clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	}
+	if err != nil {
+		return previous, fmt.Errorf("failed to set limits of %s %s/%s: %w", kind, namespace, name, err)
+	}
+	return previous, nil
+}
+
+func summarizeDeployment(deployment appsv1.Deployment) DeploymentSummary {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return DeploymentSummary{
+		Name:              deployment.Name,
+		Replicas:          replicas,
+		ReadyReplicas:     deployment.Status.ReadyReplicas,
+		UpdatedReplicas:   deployment.Status.UpdatedReplicas,
+		AvailableReplicas: deployment.Status.AvailableReplicas,
+		Images:            containerImages(deployment.Spec.Template.Spec),
+		CreatedAt:         deployment.CreationTimestamp.Time,
+	}
+}
+
+func summarizeStatefulSet(statefulSet appsv1.StatefulSet) StatefulSetSummary {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	return StatefulSetSummary{
+		Name:            statefulSet.Name,
+		Replicas:        replicas,
+		ReadyReplicas:   statefulSet.Status.ReadyReplicas,
+		UpdatedReplicas: statefulSet.Status.UpdatedReplicas,
+		ServiceName:     statefulSet.Spec.ServiceName,
+		Images:          containerImages(statefulSet.Spec.Template.Spec),
+		CreatedAt:       statefulSet.CreationTimestamp.Time,
+	}
+}
+
+func summarizeService(service corev1.Service) ServiceSummary {
+	summary := ServiceSummary{
+		Name:      service.Name,
+		Type:      string(service.Spec.Type),
+		ClusterIP: service.Spec.ClusterIP,
+		Ports:     make([]string, 0, len(service.Spec.Ports)),
+		Selector:  service.Spec.Selector,
+		CreatedAt: service.CreationTimestamp.Time,
+	}
+	for _, ingress := range service.Status.LoadBalancer.Ingress {
+		summary.ExternalAddresses = append(summary.ExternalAddresses, loadBalancerAddress(ingress.IP, ingress.Hostname))
+	}
+	summary.ExternalAddresses = append(summary.ExternalAddresses, service.Spec.ExternalIPs...)
+	if service.Spec.Type == corev1.ServiceTypeExternalName {
+		summary.ExternalAddresses = append(summary.ExternalAddresses, service.Spec.ExternalName)
+	}
+	for _, port := range service.Spec.Ports {
+		value := strconv.Itoa(int(port.Port))
+		if target := port.TargetPort.String(); target != "" && target != "0" && target != value {
+			value += ":" + target
+		}
+		summary.Ports = append(summary.Ports, value+"/"+string(port.Protocol))
+	}
+	return summary
+}
+
+func summarizeIngress(ingress networkingv1.Ingress) IngressSummary {
+	summary := IngressSummary{
+		Name:      ingress.Name,
+		Hosts:     []string{},
+		TLS:       len(ingress.Spec.TLS) > 0,
+		CreatedAt: ingress.CreationTimestamp.Time,
+	}
+	if ingress.Spec.IngressClassName != nil {
+		summary.ClassName = *ingress.Spec.IngressClassName
+	}
+	seen := make(map[string]bool)
+	for _, rule := range ingress.Spec.Rules {
+		host := rule.Host
+		if host == "" {
+			host = "*"
+		}
+		if !seen[host] {
+			seen[host] = true
+			summary.Hosts = append(summary.Hosts, host)
+		}
+	}
+	for _, lb := range ingress.Status.LoadBalancer.Ingress {
+		summary.Addresses = append(summary.Addresses, loadBalancerAddress(lb.IP, lb.Hostname))
+	}
+	return summary
+}
+
+func summarizeClaim(claim corev1.PersistentVolumeClaim) PersistentVolumeClaimSummary {
+	summary := PersistentVolumeClaimSummary{
+		Name:        claim.Name,
+		Status:      string(claim.Status.Phase),
+		AccessModes: make([]string, 0, len(claim.Spec.AccessModes)),
+		VolumeName:  claim.Spec.VolumeName,
+		CreatedAt:   claim.CreationTimestamp.Time,
+	}
+	if capacity, ok := claim.Status.Capacity[corev1.ResourceStorage]; ok {
+		summary.Capacity = capacity.String()
+	}
+	if requested, ok := claim.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+		summary.Requested = requested.String()
+	}
+	if claim.Spec.StorageClassName != nil {
+		summary.StorageClass = *claim.Spec.StorageClassName
+	}
+	for _, mode := range claim.Spec.AccessModes {
+		summary.AccessModes = append(summary.AccessModes, string(mode))
+	}
+	return summary
+}
+
+// containerImages returns the images of a pod template's containers, init
+// containers first
+func containerImages(spec corev1.PodSpec) []string {
+	images := make([]string, 0, len(spec.InitContainers)+len(spec.Containers))
+	for _, container := range spec.InitContainers {
+		images = append(images, container.Image)
+	}
+	for _, container := range spec.Containers {
+		images = append(images, container.Image)
+	}
+	return images
+}
+
+func loadBalancerAddress(ip, hostname string) string {
+	if hostname != "" {
+		return hostname
+	}
+	return ip
+}
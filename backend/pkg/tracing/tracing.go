@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"grafana-ai-agent-platform/backend/internal/config"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation names the tracer of the backend's own spans
+const instrumentation = "grafana-ai-agent-platform/backend"
+
+// Setup installs the global tracer provider, exporting spans over OTLP/HTTP to
+// the configured collector. Without an endpoint tracing stays disabled and
+// spans are dropped. The returned function flushes the spans still buffered.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	if cfg.Tracing.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.Tracing.Endpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(cfg.Tracing.ServiceName),
+		semconv.DeploymentEnvironment(cfg.Server.Environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the service: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// Requests of traced callers stay traced whatever the ratio
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.Tracing.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Start starts a span of the backend as a child of the span of ctx
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends a span, recording err as its failure
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WrapTransport traces the requests of an HTTP client, such as client-go's or
+// the LLM providers', made on behalf of a traced operation. Requests without
+// a span in their context, like background polling, aren't traced.
+func WrapTransport(name string) func(http.RoundTripper) http.RoundTripper {
+	return func(transport http.RoundTripper) http.RoundTripper {
+		return otelhttp.NewTransport(transport,
+			otelhttp.WithFilter(func(r *http.Request) bool {
+				return trace.SpanFromContext(r.Context()).SpanContext().IsValid()
+			}),
+			otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+				return fmt.Sprintf("%s %s", name, r.Method)
+			}),
+		)
+	}
+}
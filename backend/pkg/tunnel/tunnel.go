@@ -0,0 +1,179 @@
+// Package tunnel carries HTTP requests from the platform to an in-cluster
+// connector over a connection the connector opened. The connector dials out
+// with an HTTP Upgrade request; the upgraded connection then speaks HTTP/2 in
+// reverse, the platform sending requests and the connector serving them.
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Protocol is the Upgrade protocol of tunnel connections
+const Protocol = "grafana-ai-agent-connector"
+
+const (
+	// pingInterval is how long a tunnel may be silent before it's pinged
+	pingInterval = 30 * time.Second
+	// pingTimeout is how long a ping may go unanswered before the tunnel closes
+	pingTimeout = 15 * time.Second
+)
+
+// Client sends requests through a tunnel
+type Client struct {
+	conn *http2.ClientConn
+	done chan struct{}
+}
+
+// Accept upgrades a connector's request to a tunnel and returns a client
+// sending requests through it. It writes the 101 response itself.
+func Accept(w http.ResponseWriter, r *http.Request) (*Client, error) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), Protocol) {
+		return nil, fmt.Errorf("expected an Upgrade to %s", Protocol)
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("connection can't be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade connection: %w", err)
+	}
+	if _, err := fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: %s\r\nConnection: Upgrade\r\n\r\n", Protocol); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to upgrade connection: %w", err)
+	}
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to upgrade connection: %w", err)
+	}
+	return newClient(&bufferedConn{Conn: conn, reader: rw.Reader})
+}
+
+func newClient(conn net.Conn) (*Client, error) {
+	closing := &closeNotifyConn{Conn: conn, done: make(chan struct{})}
+	transport := &http2.Transport{
+		AllowHTTP:       true,
+		ReadIdleTimeout: pingInterval,
+		PingTimeout:     pingTimeout,
+	}
+	clientConn, err := transport.NewClientConn(closing)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start tunnel: %w", err)
+	}
+	return &Client{conn: clientConn, done: closing.done}, nil
+}
+
+// RoundTrip sends a request through the tunnel
+func (c *Client) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.conn.RoundTrip(req)
+}
+
+// Done is closed once the tunnel is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the tunnel
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Dial opens a tunnel to the platform at serverURL, authenticating with
+// token, and returns the connection to serve requests on
+func Dial(ctx context.Context, serverURL, token string) (net.Conn, error) {
+	target, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server URL: %w", err)
+	}
+	address := target.Host
+	if target.Port() == "" {
+		if target.Scheme == "https" {
+			address = net.JoinHostPort(target.Hostname(), "443")
+		} else {
+			address = net.JoinHostPort(target.Hostname(), "80")
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	var conn net.Conn
+	if target.Scheme == "https" {
+		// HTTP/1.1 only, the upgrade isn't possible over HTTP/2
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: target.Hostname(), NextProtos: []string{"http/1.1"}}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(serverURL, "/")+"/api/connectors/connect", nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", Protocol)
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to request tunnel: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read tunnel response: %w", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, fmt.Errorf("platform refused the tunnel: %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// Serve serves the platform's requests on a tunnel with handler until the
+// tunnel closes. The platform pings idle tunnels, and the dialer's TCP
+// keep-alives notice a platform that went away.
+func Serve(conn net.Conn, handler http.Handler) {
+	server := &http2.Server{}
+	server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+}
+
+// bufferedConn reads what was buffered while upgrading the connection first
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// closeNotifyConn closes done when the connection is closed
+type closeNotifyConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *closeNotifyConn) Close() error {
+	c.once.Do(func() { close(c.done) })
+	return c.Conn.Close()
+}
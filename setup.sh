@@ -81,7 +81,7 @@ echo "🎉 Setup completed successfully!"
 echo ""
 echo "📋 Next steps:"
 echo "1. Update the OPENROUTER_KEY in backend/.env with your API key"
-echo "2. Start the backend: cd backend && go run cmd/main.go"
+echo "2. Start the backend: cd backend && go run ./cmd"
 echo "3. Start the frontend: cd frontend && npm run dev"
 echo "4. Access the application at http://localhost:3000"
 echo ""